@@ -17,14 +17,21 @@
 package vcert
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"github.com/Venafi/vcert/v4/pkg/breaker"
+	"github.com/Venafi/vcert/v4/pkg/dns"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/failover"
+	"github.com/Venafi/vcert/v4/pkg/proxy"
 	"github.com/Venafi/vcert/v4/pkg/venafi/cloud"
 	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
 	"github.com/Venafi/vcert/v4/pkg/venafi/tpp"
 	"github.com/Venafi/vcert/v4/pkg/verror"
 	"log"
+	"net/http"
+	"time"
 )
 
 type newClientArgs struct {
@@ -75,7 +82,26 @@ func (cfg *Config) newClient(args []interface{}) (connector endpoint.Connector,
 	}
 
 	connector.SetZone(cfg.Zone)
-	connector.SetHTTPClient(cfg.Client)
+	client := cfg.Client
+	if cfg.ConnectorType != endpoint.ConnectorTypeFake {
+		if cfg.Dialer != nil || cfg.Proxy != nil {
+			client = dialClient(client, connectionTrustBundle, cfg.Dialer, cfg.Proxy)
+		}
+		if cfg.DebugDump != nil {
+			client = wrapClient(client, connectionTrustBundle, cfg.DebugDump.Wrap)
+		}
+		// wrapped last, so the dumps show the headers actually sent
+		if cfg.UserAgent != "" || len(cfg.Headers) > 0 {
+			ua := "vcert/" + GetFormattedVersionString()
+			if cfg.UserAgent != "" {
+				ua += " " + cfg.UserAgent
+			}
+			client = wrapClient(client, connectionTrustBundle, func(rt http.RoundTripper) http.RoundTripper {
+				return &headerTransport{base: rt, userAgent: ua, headers: cfg.Headers}
+			})
+		}
+	}
+	connector.SetHTTPClient(client)
 
 	if clientArgs.authenticate {
 		err = connector.Authenticate(cfg.Credentials)
@@ -84,6 +110,87 @@ func (cfg *Config) newClient(args []interface{}) (connector endpoint.Connector,
 	return
 }
 
+// wrapClient returns a copy of client whose transport is wrapped by wrap. Without client, it's set up like the
+// connectors set up their own.
+func wrapClient(client *http.Client, trust *x509.CertPool, wrap func(http.RoundTripper) http.RoundTripper) *http.Client {
+	if client == nil {
+		client = newHTTPClient(trust)
+	}
+	c := *client
+	c.Transport = wrap(client.Transport)
+	return &c
+}
+
+// dialClient returns a copy of client whose connections are dialed by dialer, through px when it's set. Without
+// client, it's set up like the connectors set up their own. A client with a transport that isn't an *http.Transport
+// is returned as it is.
+func dialClient(client *http.Client, trust *x509.CertPool, dialer *dns.Dialer, px *proxy.Proxy) *http.Client {
+	if client == nil {
+		client = newHTTPClient(trust)
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if client.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if !ok {
+		log.Printf("The dialer and the proxy aren't used: the transport of the HTTP client is a %T", client.Transport)
+		return client
+	}
+	transport = transport.Clone()
+	if dialer != nil {
+		transport.DialContext = dialer.DialContext
+	}
+	if px != nil {
+		p := *px
+		if dialer != nil {
+			p.Forward = dialer.DialContext
+			p.Resolver = dialer.Resolver()
+		}
+		// the proxy of the environment is replaced, the connections are tunneled by the dialer
+		transport.Proxy = nil
+		transport.DialContext = p.DialContext
+	}
+	c := *client
+	c.Transport = transport
+	return &c
+}
+
+func newHTTPClient(trust *x509.CertPool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	/* #nosec */
+	if trust != nil {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = trust
+	}
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}
+}
+
+// headerTransport sets the User-Agent and the custom headers of the requests
+type headerTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	headers   map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// a RoundTripper must not modify the request it's given
+	r := req.Clone(req.Context())
+	for name, value := range t.headers {
+		// the headers of the connector, credentials in particular, are never replaced
+		if r.Header.Get(name) == "" {
+			r.Header.Set(name, value)
+		}
+	}
+	r.Header.Set("User-Agent", t.userAgent)
+	return base.RoundTrip(r)
+}
+
 func getNewClientArguments(args []interface{}) (*newClientArgs, error) {
 
 	if len(args) > 1 {
@@ -119,3 +226,27 @@ func getNewClientArguments(args []interface{}) (*newClientArgs, error) {
 func NewClient(cfg *Config, args ...interface{}) (endpoint.Connector, error) {
 	return cfg.newClient(args)
 }
+
+// NewFailoverClient returns a connector that uses the platform of primary, and fails over to the platform of
+// secondary while the primary one is unreachable. The primary connector is authenticated again when calls switch
+// back to it. An unreachable primary doesn't prevent the creation of the connector, which starts on secondary then.
+func NewFailoverClient(primary, secondary *Config) (*failover.Connector, error) {
+	p, err := primary.newClient([]interface{}{false})
+	if err != nil {
+		return nil, err
+	}
+	s, err := secondary.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	c := failover.NewConnector(p, s)
+	c.PrimaryAuth = primary.Credentials
+	c.SecondaryZone = secondary.Zone
+	err = p.Authenticate(primary.Credentials)
+	if breaker.IsServerFailure(err) {
+		c.FailOver(err)
+	} else if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
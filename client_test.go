@@ -22,10 +22,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/dns"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/proxy"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -127,3 +133,102 @@ func TestNewClientWithFileConfig(t *testing.T) {
 	haltIf(err)
 	print(certs)
 }
+
+func TestNewClientHeaders(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer srv.Close()
+
+	cfg := &Config{
+		ConnectorType: endpoint.ConnectorTypeTPP,
+		BaseUrl:       srv.URL,
+		UserAgent:     "cert-rotation/1.2",
+		Headers:       map[string]string{"X-Correlation-ID": "42"},
+	}
+	c, err := NewClient(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if ua := got.Get("User-Agent"); ua != "vcert/"+GetFormattedVersionString()+" cert-rotation/1.2" {
+		t.Errorf("unexpected User-Agent %q", ua)
+	}
+	if id := got.Get("X-Correlation-ID"); id != "42" {
+		t.Errorf("unexpected correlation ID %q", id)
+	}
+}
+
+func TestNewClientDialer(t *testing.T) {
+	pinged := false
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pinged = true
+	}))
+	defer srv.Close()
+
+	cfg := &Config{
+		ConnectorType: endpoint.ConnectorTypeTPP,
+		BaseUrl:       "https://tpp.management.example:" + srv.URL[strings.LastIndex(srv.URL, ":")+1:],
+		Dialer:        &dns.Dialer{Hosts: map[string]string{"tpp.management.example": "127.0.0.1"}},
+	}
+	c, err := NewClient(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if !pinged {
+		t.Fatal("the request wasn't sent to the address of the hosts")
+	}
+}
+
+func TestNewClientProxy(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	tunnels := 0
+	px := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.Header.Get("Proxy-Authorization") == "" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		tunnels++
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			return
+		}
+		defer target.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	}))
+	defer px.Close()
+
+	p, err := proxy.Parse(strings.Replace(px.URL, "http://", "http://jump:secret@", 1), "basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		ConnectorType: endpoint.ConnectorTypeTPP,
+		BaseUrl:       srv.URL,
+		Proxy:         p,
+	}
+	c, err := NewClient(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if tunnels != 1 {
+		t.Fatalf("expected the request to be tunneled through the proxy, got %d tunnels", tunnels)
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+type applicationsReport struct {
+	ID           string   `json:"id"`
+	Applications []string `json:"applications"`
+}
+
+func (r *applicationsReport) print() {
+	if len(r.Applications) == 0 {
+		fmt.Println("no applications")
+		return
+	}
+	for _, application := range r.Applications {
+		fmt.Println(application)
+	}
+}
+
+func newApplicationAssociator(c *cli.Context) (endpoint.ApplicationAssociator, error) {
+	err := setTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	associator, ok := connector.(endpoint.ApplicationAssociator)
+	if !ok {
+		return nil, fmt.Errorf("application associations are not supported by %s", connector.GetType())
+	}
+	return associator, nil
+}
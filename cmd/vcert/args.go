@@ -17,23 +17,66 @@
 package main
 
 import (
+	"time"
+
 	"github.com/Venafi/vcert/v4/pkg/certificate"
 )
 
 const (
-	commandGenCSRName       = "gencsr"
-	commandEnrollName       = "enroll"
-	commandPickupName       = "pickup"
-	commandRevokeName       = "revoke"
-	commandRenewName        = "renew"
-	commandGetCredName      = "getcred"
-	commandCheckCredName    = "checkcred"
-	commandVoidCredName     = "voidcred"
-	commandCreatePolicyName = "setpolicy"
-	commandGetePolicyName   = "getpolicy"
-	commandSshPickupName    = "sshpickup"
-	commandSshEnrollName    = "sshenroll"
-	commandSshGetConfigName = "sshgetconfig"
+	commandGenCSRName         = "gencsr"
+	commandEnrollName         = "enroll"
+	commandPickupName         = "pickup"
+	commandRevokeName         = "revoke"
+	commandRenewName          = "renew"
+	commandGetCredName        = "getcred"
+	commandCheckCredName      = "checkcred"
+	commandVoidCredName       = "voidcred"
+	commandCreatePolicyName   = "setpolicy"
+	commandGetePolicyName     = "getpolicy"
+	commandSshPickupName      = "sshpickup"
+	commandSshEnrollName      = "sshenroll"
+	commandSshGetConfigName   = "sshgetconfig"
+	commandStatusName         = "status"
+	commandRunName            = "run"
+	commandExportName         = "export"
+	commandListName           = "list"
+	commandLineageName        = "lineage"
+	commandBlastRadiusName    = "blastradius"
+	commandAuditName          = "audit"
+	commandMetricsName        = "metrics"
+	commandOfflineRequestName = "offlinerequest"
+	commandOfflineSubmitName  = "offlinesubmit"
+	commandOfflineImportName  = "offlineimport"
+	commandPolicyName         = "policy"
+	commandPolicyDiffName     = "diff"
+	commandPolicyApplyName    = "apply"
+	commandContactsName       = "contacts"
+	commandContactsGetName    = "get"
+	commandContactsSetName    = "set"
+	commandApplicationsName   = "applications"
+	commandAppListName        = "list"
+	commandAppAddName         = "add"
+	commandAppRemoveName      = "remove"
+	commandSignName           = "sign"
+	commandCAHierarchyName    = "cahierarchy"
+	commandListenName         = "listen"
+	commandServiceName        = "service"
+	commandServiceInstallName = "install"
+	commandServiceRemoveName  = "uninstall"
+	commandServiceStartName   = "start"
+	commandServiceStopName    = "stop"
+	commandValidateConfigName = "validate-config"
+	commandBackupName         = "backup"
+	commandRestoreName        = "restore"
+	commandInspectName        = "inspect"
+	commandConvertName        = "convert"
+	commandCleanupName        = "cleanup"
+	commandCancelName         = "cancel"
+	commandControllerName     = "controller"
+	commandBootstrapName      = "bootstrap"
+	commandTimestampName      = "timestamp"
+	commandDeviceName         = "device"
+	commandSDSName            = "sds"
 )
 
 var (
@@ -62,6 +105,7 @@ type commandFlags struct {
 	file                 string
 	format               string
 	friendlyName         string
+	inPassword           string
 	insecure             bool
 	instance             string
 	ipSans               ipSlice
@@ -131,4 +175,109 @@ type commandFlags struct {
 	sshCertWindows       bool
 	sshFileCertEnroll    string
 	sshFileGetConfig     string
+	playbookFile         string
+	daemon               bool
+	interval             int
+	manifestFile         string
+	check                bool
+	manifestKeyFile      string
+	onDuplicate          string
+	exportFormat         string
+	exportFile           string
+	checkpointFile       string
+	cursorFile           string
+	expiringWithin       string
+	sortBy               string
+	withExpired          bool
+	offlineRequestFile   string
+	offlineResponseFile  string
+	listenAddress        string
+	webhookSecret        string
+	tlsCertFile          string
+	tlsKeyFile           string
+	clientCAFile         string
+	rbacFile             string
+	serviceName          string
+	vaultDir             string
+	vaultRecipients      stringSlice
+	identityFile         string
+	vaultList            bool
+	metricsEndpoints     stringSlice
+	expiringDays         int
+	debugDumpDir         string
+	debugDumpGzip        bool
+	userAgent            string
+	headers              stringSlice
+	experimentalPQC      string
+	policyZones          stringSlice
+	policyZonesFile      string
+	policyZonePattern    string
+	policyConcurrency    int
+	continueOnError      bool
+	contacts             stringSlice
+	addContacts          stringSlice
+	removeContacts       stringSlice
+	applications         stringSlice
+	pushToApplications   bool
+	instanceIP           string
+	installPath          string
+	resume               bool
+	csrAttributes        string
+	csrChallengePassword string
+	csrExtensions        stringSlice
+	csrKeyFile           string
+	keyPasswordFile      string
+	keyPasswordCommand   string
+	keyPasswordLength    int
+	keyPasswordCharset   string
+	lint                 bool
+	lintEKUs             stringSlice
+	clockSkew            int
+	clockSkewError       bool
+	maxBackdate          int
+	olderThan            int
+	cancelRequests       bool
+	dryRun               bool
+	reissueFrom          string
+	reissueFromID        string
+	removeSans           stringSlice
+	kubeconfig           string
+	namespace            string
+	gateways             bool
+	renewBeforeDays      int
+	clusterFile          string
+	force                bool
+	certProfile          string
+	tsaURL               string
+	tsHash               string
+	tsDigest             string
+	tsVerify             string
+	keyEscrow            bool
+	deviceDir            string
+	outputProfile        string
+	outputDir            string
+	dhParams             int
+	sdsSecrets           []string
+	inject               bool
+	resolve              stringSlice
+	dnsServer            string
+	dohURL               string
+	ipVersion            int
+	happyEyeballsDelay   time.Duration
+	proxyURL             string
+	proxyAuth            string
+	replayProtection     bool
+	stateStore           string
+	inventoryCache       string
+	local                bool
+	revokeAll            bool
+	assumeYes            bool
+	auditSeverity        string
+	publicCA             bool
+	noPossessionCheck    bool
+	chainPreference      string
+	chainRoot            string
+	issuerPins           string
+	caaIssuers           []string
+	caaWarn              bool
 }
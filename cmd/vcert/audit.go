@@ -0,0 +1,75 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/audit"
+)
+
+func doCommandAudit(c *cli.Context) error {
+	err := validateAuditFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	min, err := audit.ParseSeverity(flags.auditSeverity)
+	if err != nil {
+		return err
+	}
+	a := &audit.Auditor{Endpoints: flags.metricsEndpoints}
+	if flags.zone != "" || flags.config != "" || flags.testMode {
+		err = setTLSConfig()
+		if err != nil {
+			return err
+		}
+		cfg, err := buildConfig(c, &flags)
+		if err != nil {
+			return fmt.Errorf("Failed to build vcert config: %w", err)
+		}
+		a.Connector, err = vcert.NewClient(&cfg)
+		if err != nil {
+			return err
+		}
+	}
+	// the findings of the certificates that were audited are written even when others failed
+	findings, auditErr := a.Audit(context.Background())
+	findings = audit.Filter(findings, min)
+	switch flags.credFormat {
+	case "json":
+		if findings == nil {
+			findings = []audit.Finding{}
+		}
+		err = outputJSON(findings)
+	case "csv":
+		err = audit.WriteCSV(os.Stdout, findings)
+	default:
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		logf("%d finding(s)", len(findings))
+	}
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
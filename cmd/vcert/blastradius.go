@@ -0,0 +1,170 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/inspect"
+	"github.com/Venafi/vcert/v4/pkg/inventory"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// blastRadiusOutput is the JSON output of the blastradius command
+type blastRadiusOutput struct {
+	Affected []inventory.Affected
+	Revoked  int `json:",omitempty"`
+}
+
+func doCommandBlastRadius(c *cli.Context) error {
+	err := validateBlastRadiusFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	connector, err := listConnector(c)
+	if err != nil {
+		return err
+	}
+	pub, cn, err := compromisedKey(connector)
+	if err != nil {
+		return err
+	}
+	if flags.commonName != "" {
+		cn = flags.commonName
+	}
+	affected, err := inventory.BlastRadius(connector, pub, cn)
+	if err != nil {
+		return err
+	}
+	if !flags.revokeAll {
+		if flags.credFormat == "json" {
+			return outputJSON(blastRadiusOutput{Affected: affected})
+		}
+		printAffected(affected)
+		return nil
+	}
+	if len(affected) == 0 {
+		logf("No valid certificate shares the compromised key or common name")
+		return nil
+	}
+	if flags.credFormat != "json" {
+		printAffected(affected)
+	}
+	if !flags.assumeYes && !confirm(fmt.Sprintf("Revoke %d certificate(s)?", len(affected))) {
+		return fmt.Errorf("%w: revocation cancelled", verror.UserDataError)
+	}
+	revoked, err := inventory.RevokeAll(connector, affected, flags.revocationReason)
+	if flags.credFormat == "json" {
+		if jsonErr := outputJSON(blastRadiusOutput{Affected: affected, Revoked: revoked}); jsonErr != nil {
+			return jsonErr
+		}
+	} else {
+		logf("Revoked %d of %d certificate(s)", revoked, len(affected))
+	}
+	return err
+}
+
+// compromisedKey returns the public key and the common name of the compromised certificate or key file. The common
+// name is empty when only a key or a request without one is given.
+func compromisedKey(connector endpoint.Connector) (crypto.PublicKey, string, error) {
+	if flags.thumbprint != "" {
+		pcc, err := connector.RetrieveCertificate(&certificate.Request{
+			Thumbprint:  flags.thumbprint,
+			ChainOption: certificate.ChainOptionIgnore,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to retrieve the compromised certificate: %w", err)
+		}
+		block, _ := pem.Decode([]byte(pcc.Certificate))
+		if block == nil {
+			return nil, "", fmt.Errorf("%w: failed to decode the compromised certificate", verror.ServerBadDataResponce)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: failed to parse the compromised certificate: %s", verror.ServerBadDataResponce, err)
+		}
+		return cert.PublicKey, cert.Subject.CommonName, nil
+	}
+	if flags.keyFile == "" {
+		return nil, "", nil
+	}
+	data, err := ioutil.ReadFile(flags.keyFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: failed to read the compromised key: %s", verror.UserDataError, err)
+	}
+	password, err := readPasswordsFromInputFlag(flags.keyPassword, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	contents, err := inspect.Decode(data, password)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case len(contents.Keys) > 0:
+		if contents.Keys[0].Key == nil {
+			return nil, "", fmt.Errorf("%w: the private key is encrypted, use --key-password to decrypt it", verror.UserDataError)
+		}
+		return contents.Keys[0].Key.Public(), "", nil
+	case len(contents.Certificates) > 0:
+		cert := contents.Chain()[0]
+		return cert.PublicKey, cert.Subject.CommonName, nil
+	default:
+		return contents.Requests[0].PublicKey, "", nil
+	}
+}
+
+// confirm asks question on stderr and reads the answer from stdin, anything but y or yes declines
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func printAffected(affected []inventory.Affected) {
+	if len(affected) == 0 {
+		fmt.Println("No valid certificate shares the compromised key or common name")
+		return
+	}
+	for _, a := range affected {
+		var shared []string
+		if a.SameKey {
+			shared = append(shared, "key")
+		}
+		if a.SameCN {
+			shared = append(shared, "cn")
+		}
+		fmt.Printf("%s  %s  expires %s  shares %s  %s\n", a.Thumbprint, a.CN, a.ValidTo.Format(time.RFC3339),
+			strings.Join(shared, ","), a.ID)
+	}
+}
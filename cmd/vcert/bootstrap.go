@@ -0,0 +1,76 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/bootstrap"
+)
+
+func doCommandBootstrap(c *cli.Context) error {
+	err := validateBootstrapFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	cluster, err := bootstrap.Load(flags.clusterFile)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+	// the zone of the command line wins over the one of the cluster definition
+	if cfg.Zone != "" {
+		cluster.Zone = cfg.Zone
+	}
+	if cluster.Zone == "" {
+		return fmt.Errorf("a zone is required, use --zone or set it in the cluster definition")
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
+	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
+
+	results, err := bootstrap.Run(context.Background(), connector, cluster, bootstrap.Options{
+		Force:       flags.force,
+		RenewBefore: time.Duration(flags.renewBeforeDays) * 24 * time.Hour,
+	})
+	for _, r := range results {
+		if r.Kept {
+			logf("Kept the %s certificate of %s: %s (serial %s)", r.Role, r.Owner, r.CertFile, r.Serial)
+		} else {
+			logf("Issued the %s certificate of %s: %s (serial %s)", r.Role, r.Owner, r.CertFile, r.Serial)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	logf("The bundles of the %d nodes of the %s cluster are in %s", len(cluster.Nodes), cluster.Kind, cluster.OutputDir)
+	return nil
+}
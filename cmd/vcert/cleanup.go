@@ -0,0 +1,95 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4/pkg/playbook"
+)
+
+func doCommandCleanup(c *cli.Context) error {
+	err := validateCleanupFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	pb, err := playbook.Load(flags.playbookFile)
+	if err != nil {
+		return err
+	}
+	runner := playbook.NewRunner(pb)
+	runner.Log = logf
+	if flags.checkpointFile != "" {
+		runner.Checkpoint, err = playbook.LoadCheckpoint(flags.checkpointFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := playbook.CleanupOptions{
+		MaxAge: time.Duration(flags.olderThan) * 24 * time.Hour,
+		Cancel: flags.cancelRequests,
+		DryRun: flags.dryRun,
+	}
+	leftovers, err := runner.Cleanup(context.Background(), opts)
+	if runner.Checkpoint != nil && !flags.dryRun {
+		if cpErr := saveRunCheckpoint(runner.Checkpoint); cpErr != nil {
+			return cpErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, l := range leftovers {
+		if l.Error != "" {
+			failed++
+		}
+	}
+	if flags.credFormat == "json" {
+		if leftovers == nil {
+			leftovers = []playbook.Leftover{}
+		}
+		err = outputJSON(leftovers)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, l := range leftovers {
+			switch {
+			case l.Error != "":
+				logf("failed to clean up %s: %s", l, l.Error)
+			case flags.dryRun:
+				logf("found %s", l)
+			case l.Cancelled:
+				logf("cancelled %s", l)
+			default:
+				logf("removed %s", l)
+			}
+		}
+		logf("%d leftover(s) found", len(leftovers))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d leftover(s) couldn't be cleaned up", failed)
+	}
+	return nil
+}
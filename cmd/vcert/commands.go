@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -30,8 +31,11 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/Venafi/vcert/v4/pkg/policy"
@@ -41,6 +45,12 @@ import (
 	"github.com/Venafi/vcert/v4"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/exporter"
+	"github.com/Venafi/vcert/v4/pkg/inventory"
+	"github.com/Venafi/vcert/v4/pkg/offline"
+	"github.com/Venafi/vcert/v4/pkg/playbook"
+	"github.com/Venafi/vcert/v4/pkg/state"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/crypto/pkcs12"
 )
@@ -119,6 +129,68 @@ var (
 		vcert revoke -u https://tpp.example.com -t <TPP access token> --thumbprint <cert SHA1 thumbprint>
 		vcert revoke -u https://tpp.example.com -t <TPP access token> --id <ID value>`,
 	}
+	commandCancel = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandCancelName,
+		Flags:  cancelFlags,
+		Action: doCommandCancel,
+		Usage:  "To cancel a certificate request that wasn't retrieved",
+		UsageText: ` vcert cancel <Required Trust Protection Platform Config> <Options>
+		vcert cancel -u https://tpp.example.com -t <TPP access token> --pickup-id <ID value>
+		vcert cancel -u https://tpp.example.com -t <TPP access token> --pickup-id-file <file name>`,
+	}
+	commandController = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandControllerName,
+		Flags:  controllerFlags,
+		Action: doCommandController,
+		Usage:  "To keep the TLS secrets of annotated Kubernetes Ingresses and Gateways issued",
+		UsageText: ` vcert controller <Required Venafi as a Service -OR- Trust Protection Platform Config> <Options>
+		vcert controller -u https://tpp.example.com -t <TPP access token> -z "DevOps\Kubernetes"
+		vcert controller -k <VaaS API key> -z "Kubernetes\Default" --namespace web --gateways`,
+	}
+	commandBootstrap = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandBootstrapName,
+		Flags:  bootstrapFlags,
+		Action: doCommandBootstrap,
+		Usage:  "To issue the server, peer and client certificates of an etcd or Redis cluster",
+		UsageText: ` vcert bootstrap <Required Venafi as a Service -OR- Trust Protection Platform Config> --file <cluster definition> <Options>
+		vcert bootstrap -u https://tpp.example.com -t <TPP access token> -z "DevOps\etcd" --file etcd-cluster.yaml
+		vcert bootstrap -k <VaaS API key> -z "Redis\Default" --file redis-cluster.yaml --force`,
+	}
+	commandDevice = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandDeviceName,
+		Flags:  deviceFlags,
+		Action: doCommandDevice,
+		Usage:  "To enroll, renew and install the identity certificate of a workstation for 802.1X EAP-TLS",
+		UsageText: ` vcert device <Required Venafi as a Service -OR- Trust Protection Platform Config> <Options>
+		vcert device -u https://tpp.example.com -t <TPP access token> -z "Devices\Workstations"
+		vcert device -k <VaaS API key> -z "Workstations\Default" --key-type ecdsa --daemon`,
+	}
+	commandSDS = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandSDSName,
+		Flags:  sdsFlags,
+		Action: doCommandSDS,
+		Usage:  "To serve certificates to Envoy proxies and Istio sidecars with the Secret Discovery Service",
+		UsageText: ` vcert sds <Required Venafi as a Service -OR- Trust Protection Platform Config> --tls-cert <file> --tls-key <file> <Options>
+		vcert sds -u https://tpp.example.com -t <TPP access token> -z "Mesh\Workloads" --cn web.shop.svc --san-uri spiffe://cluster.local/ns/shop/sa/web --tls-cert sds.pem --tls-key sds.key
+		vcert sds -k <VaaS API key> -z "Mesh\Default" --secret-name api.example.com --listen unix:/var/run/vcert/sds.sock --tls-cert sds.pem --tls-key sds.key --client-ca proxies.pem`,
+	}
+	commandTimestamp = &cli.Command{
+		Before:    runBeforeCommand,
+		Name:      commandTimestampName,
+		Flags:     timestampFlags,
+		Action:    doCommandTimestamp,
+		Usage:     "To request or verify an RFC 3161 time-stamp token of a file, e.g. a signature",
+		ArgsUsage: "<file>",
+		UsageText: ` vcert timestamp --tsa-url <TSA URL> --file <token file> <file to time-stamp>
+		vcert timestamp --tsa-url http://timestamp.digicert.com --file app.sig.tsr app.sig
+		vcert timestamp --tsa-url https://tsa.example.com --hash sha384 --digest 38b060a751ac9638... --file doc.tsr
+		vcert timestamp --verify app.sig.tsr --chain-file tsa-chain.pem app.sig`,
+	}
 	commandRenew = &cli.Command{
 		Before: runBeforeCommand,
 		Name:   commandRenewName,
@@ -178,6 +250,340 @@ var (
 		Usage:     "To get the SSH CA public key and default principals",
 		UsageText: `vcert sshgetconfig -u https://tpp.example.com -t <TPP access token> --template <val>`,
 	}
+
+	commandStatus = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandStatusName,
+		Flags:  statusFlags,
+		Action: doCommandStatus,
+		Usage:  "To check the reachability, TLS trust and credentials of a Venafi endpoint",
+		UsageText: ` vcert status -u https://tpp.example.com -t <TPP access token> --trust-bundle /path-to/bundle.pem
+		vcert status -k <VaaS API key> --format json`,
+	}
+
+	commandSign = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandSignName,
+		Flags:  signFlags,
+		Action: doCommandSign,
+		Usage:  "To sign a CSR read from the standard input and write the certificate to the standard output",
+		UsageText: ` openssl req -new -key www.key -subj /CN=www.example.com | vcert sign -u https://tpp.example.com -t <TPP access token> -z "DevOps\Certificates" > www.pem
+		vcert sign -k <VaaS API key> -z "<app name>\<CIT alias>" --chain ignore < www.csr > www.pem`,
+	}
+
+	commandRun = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandRunName,
+		Flags:  runFlags,
+		Action: doCommandRun,
+		Usage:  "To enroll and install the certificates described in a playbook, once or as a daemon",
+		UsageText: ` vcert run --file /etc/vcert/playbook.yaml
+		vcert run --file /etc/vcert/playbook.yaml --daemon --interval 60
+		vcert run --file /etc/vcert/playbook.yaml --check
+		vcert run --file /etc/vcert/playbook.yaml --manifest certificates.json --manifest-key signing-key.pem`,
+	}
+
+	commandCleanup = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandCleanupName,
+		Flags:  cleanupFlags,
+		Action: doCommandCleanup,
+		Usage:  "To clean up the pending requests and lock files a playbook left behind",
+		UsageText: ` vcert cleanup --file /etc/vcert/playbook.yaml --checkpoint run-checkpoint.json --dry-run
+		vcert cleanup --file /etc/vcert/playbook.yaml --checkpoint run-checkpoint.json --older-than 30 --cancel`,
+	}
+
+	commandOfflineRequest = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandOfflineRequestName,
+		Flags:  offlineRequestFlags,
+		Action: doCommandOfflineRequest,
+		Usage:  "To prepare an enrollment request file on an air-gapped host, the private key stays on the host",
+		UsageText: ` vcert offlinerequest -z "DevOps\Certificates" --cn www.example.com --key-file key.pem --request request.json
+		vcert offlinerequest -z "DevOps\Certificates" --cn www.example.com --san-dns example.com --field "Cost Center=42" --key-file key.pem --no-prompt --request request.json`,
+	}
+
+	commandOfflineSubmit = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandOfflineSubmitName,
+		Flags:  offlineSubmitFlags,
+		Action: doCommandOfflineSubmit,
+		Usage:  "To submit an offline enrollment request from a connected network and write the response file",
+		UsageText: ` vcert offlinesubmit -u https://tpp.example.com -t <TPP access token> --request request.json --response response.json
+		vcert offlinesubmit -k <VaaS API key> --request request.json --response response.json`,
+	}
+
+	commandOfflineImport = &cli.Command{
+		Before:    runBeforeCommand,
+		Name:      commandOfflineImportName,
+		Flags:     offlineImportFlags,
+		Action:    doCommandOfflineImport,
+		Usage:     "To import the certificate of an offline enrollment response on the air-gapped host",
+		UsageText: ` vcert offlineimport --request request.json --response response.json --cert-file cert.pem --chain-file chain.pem`,
+	}
+
+	commandPolicy = &cli.Command{
+		Name:  commandPolicyName,
+		Usage: "To compare the certificate policies of zones, or apply a policy to many zones",
+		Subcommands: []*cli.Command{
+			{
+				Before: runBeforeCommand,
+				Name:   commandPolicyDiffName,
+				Flags:  policyDiffFlags,
+				Action: doCommandPolicyDiff,
+				Usage:  "To show the differences between the certificate policies of two zones",
+				UsageText: ` vcert policy diff -u https://tpp.example.com -t <TPP access token> --zone "Legacy\Web" --zone "Certificates\Web"
+		vcert policy diff -k <VaaS API key> --zone "<app name>\<CIT alias>" --zone "<app name>\<CIT alias>" --format json`,
+			},
+			{
+				Before: runBeforeCommand,
+				Name:   commandPolicyApplyName,
+				Flags:  policyApplyFlags,
+				Action: doCommandPolicyApply,
+				Usage:  "To apply a certificate policy specification to many zones",
+				UsageText: ` vcert policy apply -u https://tpp.example.com -t <TPP access token> --file /path-to/policy.spec --zones-file zones.txt
+		vcert policy apply -u https://tpp.example.com -t <TPP access token> --file /path-to/policy.spec --zone-pattern "Legacy\Web*" --concurrency 8 --continue-on-error`,
+			},
+		},
+	}
+
+	commandContacts = &cli.Command{
+		Name:  commandContactsName,
+		Usage: "To get or change the contacts owning a certificate or a zone",
+		Subcommands: []*cli.Command{
+			{
+				Before: runBeforeCommand,
+				Name:   commandContactsGetName,
+				Flags:  contactsGetFlags,
+				Action: doCommandContactsGet,
+				Usage:  "To list the contacts of a certificate or a zone",
+				UsageText: ` vcert contacts get -u https://tpp.example.com -t <TPP access token> --id "\VED\Policy\Web\www.example.com"
+		vcert contacts get -k <VaaS API key> -z "<app name>\<CIT alias>" --format json`,
+			},
+			{
+				Before: runBeforeCommand,
+				Name:   commandContactsSetName,
+				Flags:  contactsSetFlags,
+				Action: doCommandContactsSet,
+				Usage:  "To replace, add or remove contacts of a certificate or a zone",
+				UsageText: ` vcert contacts set -u https://tpp.example.com -t <TPP access token> -z "Web" --contact "Web Team" --contact alice
+		vcert contacts set -u https://tpp.example.com -t <TPP access token> --id "\VED\Policy\Web\www.example.com" --add "Platform Team" --remove "Web Team"`,
+			},
+		},
+	}
+
+	commandApplications = &cli.Command{
+		Name:  commandApplicationsName,
+		Usage: "To list or change the applications a certificate is associated with",
+		Subcommands: []*cli.Command{
+			{
+				Before:    runBeforeCommand,
+				Name:      commandAppListName,
+				Flags:     applicationsListFlags,
+				Action:    doCommandApplications,
+				Usage:     "To list the applications a certificate is associated with",
+				UsageText: ` vcert applications list -u https://tpp.example.com -t <TPP access token> --id "\VED\Policy\Web\www.example.com"`,
+			},
+			{
+				Before:    runBeforeCommand,
+				Name:      commandAppAddName,
+				Flags:     applicationsAddFlags,
+				Action:    doCommandApplications,
+				Usage:     "To associate a certificate with applications",
+				UsageText: ` vcert applications add -u https://tpp.example.com -t <TPP access token> --id "\VED\Policy\Web\www.example.com" --app "\VED\Policy\Web\web01\nginx" --push`,
+			},
+			{
+				Before:    runBeforeCommand,
+				Name:      commandAppRemoveName,
+				Flags:     applicationsRemoveFlags,
+				Action:    doCommandApplications,
+				Usage:     "To remove the association of a certificate with applications",
+				UsageText: ` vcert applications remove -u https://tpp.example.com -t <TPP access token> --id "\VED\Policy\Web\www.example.com" --app "\VED\Policy\Web\web01\nginx"`,
+			},
+		},
+	}
+
+	commandExport = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandExportName,
+		Flags:  exportFlags,
+		Action: doCommandExport,
+		Usage:  "To export the certificate inventory of a zone for analytics",
+		UsageText: ` vcert export -u https://tpp.example.com -t <TPP access token> -z "DevOps\Certificates" --file inventory.csv
+		vcert export -k <VaaS API key> -z "<app name>\<CIT alias>" --format parquet --file inventory.parquet
+		vcert export -k <VaaS API key> -z "<app name>\<CIT alias>" --format jsonl --file inventory.jsonl --checkpoint export.json
+		vcert export -u https://tpp.example.com -t <TPP access token> -z "DevOps\Certificates" --format jsonl --file changes.jsonl --cursor cursor.json`,
+	}
+
+	commandList = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandListName,
+		Flags:  listFlags,
+		Action: doCommandList,
+		Usage:  "To list the certificate inventory of a zone, or of a local copy of it",
+		UsageText: ` vcert list -u https://tpp.example.com -t <TPP access token> -z "DevOps\Certificates" --expiring-within 30d --sort expiry
+		vcert list -k <VaaS API key> -z "<app name>\<CIT alias>" --cache inventory.db
+		vcert list --cache inventory.db --local --cn example.com --format json`,
+	}
+
+	commandAudit = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandAuditName,
+		Flags:  auditFlags,
+		Action: doCommandAudit,
+		Usage:  "To report the weak keys, deprecated signatures, expired intermediates and overlong validities of a zone and of TLS endpoints",
+		UsageText: ` vcert audit -u https://tpp.example.com -t <TPP access token> -z "DevOps\Certificates" --format csv
+		vcert audit --endpoint www.example.com:443 --endpoint api.example.com:443 --min-severity high`,
+	}
+
+	commandBlastRadius = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandBlastRadiusName,
+		Flags:  blastRadiusFlags,
+		Action: doCommandBlastRadius,
+		Usage:  "To find the certificates sharing the key or the common name of a compromised certificate, and revoke them",
+		UsageText: ` vcert blastradius -u https://tpp.example.com -t <TPP access token> -z "DevOps\Certificates" --thumbprint file:compromised.pem
+		vcert blastradius -k <VaaS API key> -z "<app name>\<CIT alias>" --key-file leaked.key --revoke --reason key-compromise`,
+	}
+
+	commandLineage = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandLineageName,
+		Flags:  lineageFlags,
+		Action: doCommandLineage,
+		Usage:  "To show the certificates a certificate renewed and the ones that renewed it",
+		UsageText: ` vcert lineage -u https://tpp.example.com -t <TPP access token> --id "\VED\Policy\DevOps\www.example.com"
+		vcert lineage --cache inventory.db --thumbprint file:compromised.pem --format json`,
+	}
+
+	commandCAHierarchy = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandCAHierarchyName,
+		Flags:  caHierarchyFlags,
+		Action: doCommandCAHierarchy,
+		Usage:  "To show the CA hierarchy issuing the certificates of a zone and check the expiry of its CAs",
+		UsageText: ` vcert cahierarchy -u https://tpp.example.com -t <TPP access token> -z "DevOps\Certificates" --expiring-days 180
+		vcert cahierarchy -k <VaaS API key> -z "<app name>\<CIT alias>" --format json`,
+	}
+
+	commandValidateConfig = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandValidateConfigName,
+		Flags:  validateConfigFlags,
+		Action: doCommandValidateConfig,
+		Usage:  "To check a config file or a playbook for unknown keys, wrong types and conflicting options",
+		UsageText: ` vcert validate-config --config ~/.vcert/vcert.ini
+		vcert validate-config --file /etc/vcert/playbook.yaml`,
+	}
+
+	commandBackup = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandBackupName,
+		Flags:  backupFlags,
+		Action: doCommandBackup,
+		Usage:  "To store a certificate, its chain and its private key in an encrypted local vault",
+		UsageText: ` vcert backup --vault /var/backups/vcert --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p --cert-file cert.pem --key-file key.pem --chain-file chain.pem
+		vcert backup --vault /var/backups/vcert --file bundle.pem`,
+	}
+
+	commandRestore = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandRestoreName,
+		Flags:  restoreFlags,
+		Action: doCommandRestore,
+		Usage:  "To list or restore the certificates of an encrypted local vault",
+		UsageText: ` vcert restore --vault /var/backups/vcert --list
+		vcert restore --vault /var/backups/vcert --cn www.example.com --cert-file cert.pem --key-file key.pem --chain-file chain.pem
+		vcert restore --vault /var/backups/vcert --thumbprint 9F2A...C1 --identity ~/.config/vcert/vault-key.txt --file bundle.pem`,
+	}
+
+	commandInspect = &cli.Command{
+		Before:    runBeforeCommand,
+		Name:      commandInspectName,
+		Flags:     inspectFlags,
+		Action:    doCommandInspect,
+		Usage:     "To print the details of the certificates, requests and keys of PEM, DER, PKCS#7, PKCS#12 and OpenSSH certificate files",
+		ArgsUsage: "[file...]",
+		UsageText: ` vcert inspect cert.pem
+		vcert inspect --format openssl chain.p7b
+		vcert inspect --key-password file:/path-to/mypasswd.txt --format json keystore.p12
+		vcert inspect /etc/ssh/ssh_host_ed25519_key-cert.pub`,
+	}
+
+	commandConvert = &cli.Command{
+		Before:    runBeforeCommand,
+		Name:      commandConvertName,
+		Flags:     convertFlags,
+		Action:    doCommandConvert,
+		Usage:     "To convert the certificates and keys of a file between PEM, DER, PKCS#7, PKCS#12, JKS and OpenSSH formats",
+		ArgsUsage: "[file]",
+		UsageText: ` vcert convert --in-password file:/path-to/p12passwd.txt --no-prompt --file bundle.pem keystore.p12
+		vcert convert --format pkcs12 --key-password file:/path-to/mypasswd.txt --file keystore.p12 cert.pem
+		vcert convert --in-password file:/path-to/mypasswd.txt --format jks --jks-alias www --key-password file:/path-to/jkspasswd.txt --file keystore.jks keystore.p12
+		vcert convert --format der --cert-file cert.cer --key-file key.der bundle.pem
+		vcert convert --format pkcs7 --file chain.p7b bundle.pem
+		vcert convert --format openssh --no-prompt --file id_ecdsa key.pem`,
+	}
+
+	commandService = &cli.Command{
+		Name:  commandServiceName,
+		Usage: "To run the renewals of a playbook as a Windows service or a launchd daemon",
+		Subcommands: []*cli.Command{
+			{
+				Before:    runBeforeCommand,
+				Name:      commandServiceInstallName,
+				Flags:     serviceInstallFlags,
+				Action:    doCommandServiceInstall,
+				Usage:     "To install the service running the playbook as a daemon, started at boot",
+				UsageText: ` vcert service install --file C:\ProgramData\vcert\playbook.yaml --interval 30`,
+			},
+			{
+				Before:    runBeforeCommand,
+				Name:      commandServiceRemoveName,
+				Flags:     serviceFlags,
+				Action:    doCommandServiceUninstall,
+				Usage:     "To remove the service",
+				UsageText: ` vcert service uninstall`,
+			},
+			{
+				Before:    runBeforeCommand,
+				Name:      commandServiceStartName,
+				Flags:     serviceFlags,
+				Action:    doCommandServiceStart,
+				Usage:     "To start the service",
+				UsageText: ` vcert service start`,
+			},
+			{
+				Before:    runBeforeCommand,
+				Name:      commandServiceStopName,
+				Flags:     serviceFlags,
+				Action:    doCommandServiceStop,
+				Usage:     "To stop the service",
+				UsageText: ` vcert service stop --service-name vcert-web`,
+			},
+		},
+	}
+
+	commandListen = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandListenName,
+		Flags:  listenFlags,
+		Action: doCommandListen,
+		Usage:  "To run the certificate tasks of a playbook when the platform notifies expiry warnings or approvals",
+		UsageText: ` vcert listen --file /etc/vcert/playbook.yaml --secret file:/etc/vcert/webhook-secret --checkpoint /var/lib/vcert/checkpoint.json
+		vcert listen --file playbook.yaml --secret file:webhook-secret --listen :8443 --tls-cert listen.pem --tls-key listen.key
+		vcert listen --file playbook.yaml --secret file:webhook-secret --tls-cert listen.pem --tls-key listen.key --client-ca clients.pem --rbac rbac.yaml`,
+	}
+
+	commandMetrics = &cli.Command{
+		Before: runBeforeCommand,
+		Name:   commandMetricsName,
+		Flags:  metricsFlags,
+		Action: doCommandMetrics,
+		Usage:  "To serve the expiry of the certificates of a zone and of TLS endpoints as Prometheus metrics",
+		UsageText: ` vcert metrics -u https://tpp.example.com -t <TPP access token> -z "DevOps\Certificates" --listen :9219
+		vcert metrics --endpoint www.example.com:443 --endpoint api.example.com:443 --interval 15`,
+	}
 )
 
 func runBeforeCommand(c *cli.Context) error {
@@ -191,6 +597,28 @@ func runBeforeCommand(c *cli.Context) error {
 	flags.sshCertPrincipal = c.StringSlice("principal")
 	flags.sshCertSourceAddrs = c.StringSlice("source-address")
 	flags.sshCertDestAddrs = c.StringSlice("destination-address")
+	flags.metricsEndpoints = c.StringSlice("endpoint")
+	flags.headers = c.StringSlice("header")
+	flags.policyZones = c.StringSlice("zone")
+	flags.contacts = c.StringSlice("contact")
+	flags.addContacts = c.StringSlice("add")
+	flags.removeContacts = c.StringSlice("remove")
+	flags.applications = c.StringSlice("app")
+	flags.csrExtensions = c.StringSlice("csr-extension")
+	flags.lintEKUs = c.StringSlice("lint-eku")
+	flags.vaultRecipients = c.StringSlice("recipient")
+	flags.removeSans = c.StringSlice("remove-san")
+	flags.sdsSecrets = c.StringSlice("secret-name")
+	flags.caaIssuers = c.StringSlice("caa-issuer")
+	for _, h := range flags.headers {
+		if i := strings.Index(h, ":"); i <= 0 || strings.TrimSpace(h[:i]) == "" {
+			return fmt.Errorf("header %q is not in the \"Name: value\" format", h)
+		}
+	}
+	flags.resolve = c.StringSlice("resolve")
+	if err := validateDialFlags(); err != nil {
+		return err
+	}
 
 	noDuplicatedFlags := []string{"instance", "tls-address", "app-info"}
 	for _, f := range noDuplicatedFlags {
@@ -271,6 +699,13 @@ func setTLSConfig() error {
 }
 
 func doCommandEnroll1(c *cli.Context) error {
+	// signing tools and mail clients import the certificate with its key and chain from a PKCS#12 file
+	if flags.certProfile != "" && flags.file != "" && !c.IsSet("format") {
+		flags.format = Pkcs12
+	}
+	if flags.keyEscrow && flags.csrOption == "" {
+		flags.csrOption = "service"
+	}
 	err := validateEnrollFlags(c.Command.Name)
 	if err != nil {
 		return err
@@ -284,15 +719,14 @@ func doCommandEnroll1(c *cli.Context) error {
 
 	cfg, err := buildConfig(c, &flags)
 	if err != nil {
-		return fmt.Errorf("Failed to build vcert config: %s", err)
+		return fmt.Errorf("Failed to build vcert config: %w", err)
 	}
 
 	connector, err := vcert.NewClient(&cfg)
 	if err != nil {
-		logf("Unable to connect to %s: %s", cfg.ConnectorType, err)
-	} else {
-		logf("Successfully connected to %s", cfg.ConnectorType)
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
 	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
 	var req = &certificate.Request{}
 	var pcc = &certificate.PEMCollection{}
 
@@ -302,11 +736,31 @@ func doCommandEnroll1(c *cli.Context) error {
 		return err
 	}
 	logf("Successfully read zone configuration for %s", flags.zone)
-	req = fillCertificateRequest(req, &flags)
+	if flags.reissueFrom != "" || flags.reissueFromID != "" {
+		req, err = reissueRequest(connector, &flags)
+		if err != nil {
+			return err
+		}
+	} else {
+		req = fillCertificateRequest(req, &flags)
+	}
+	err = applyCertProfile(req)
+	if err != nil {
+		return err
+	}
+	applyOutputProfile(req)
 	err = connector.GenerateRequest(zoneConfig, req)
 	if err != nil {
 		return err
 	}
+	err = checkPublicCA(req)
+	if err != nil {
+		return err
+	}
+	err = checkCAA(req)
+	if err != nil {
+		return err
+	}
 
 	var requestedFor string
 	if req.Subject.CommonName != "" {
@@ -316,14 +770,23 @@ func doCommandEnroll1(c *cli.Context) error {
 	}
 
 	logf("Successfully created request for %s", requestedFor)
-	flags.pickupID, err = connector.RequestCertificate(req)
+	reused, err := checkDuplicate(connector, req)
 	if err != nil {
 		return err
 	}
-	logf("Successfully posted request for %s, will pick up by %s", requestedFor, flags.pickupID)
+	if reused == nil {
+		flags.pickupID, err = connector.RequestCertificate(req)
+		if err != nil {
+			return err
+		}
+		logf("Successfully posted request for %s, will pick up by %s", requestedFor, flags.pickupID)
+	}
 
 	wasPasswordEmpty := false
-	if flags.noPickup {
+	if reused != nil {
+		logf("Reusing the existing certificate for %s", requestedFor)
+		pcc = reused
+	} else if flags.noPickup {
 		pcc, err = certificate.NewPEMCollection(nil, req.PrivateKey, []byte(flags.keyPassword), flags.format)
 		if err != nil {
 			return err
@@ -331,6 +794,7 @@ func doCommandEnroll1(c *cli.Context) error {
 	} else {
 		req.PickupID = flags.pickupID
 		req.ChainOption = certificate.ChainOptionFromString(flags.chainOption)
+		setChainSelection(req)
 		req.KeyPassword = flags.keyPassword
 
 		if flags.noPrompt && flags.keyPassword == "" && flags.format != "pkcs12" && flags.format != "jks" && flags.csrOption == "service" {
@@ -355,7 +819,7 @@ func doCommandEnroll1(c *cli.Context) error {
 		}
 	}
 
-	if (pcc.PrivateKey != "" && (flags.format == Pkcs12 || flags.format == JKSFormat)) || (flags.format == util.LegacyPem && flags.csrOption == "service") || flags.noPrompt && wasPasswordEmpty {
+	if (pcc.PrivateKey != "" && (flags.format == Pkcs12 || flags.format == JKSFormat || flags.outputProfile != "" && flags.keyPassword != "")) || (flags.format == util.LegacyPem && flags.csrOption == "service") || flags.noPrompt && wasPasswordEmpty {
 		privKey, err := util.DecryptPkcs8PrivateKey(pcc.PrivateKey, flags.keyPassword)
 		if err != nil {
 			if err.Error() == "pkcs8: only PBES2 supported" && connector.GetType() == endpoint.ConnectorTypeTPP {
@@ -376,21 +840,42 @@ func doCommandEnroll1(c *cli.Context) error {
 	if wasPasswordEmpty {
 		flags.keyPassword = ""
 	}
+	checkCertProfile(pcc)
+	err = verifyPossession(pcc)
+	if err != nil {
+		return err
+	}
+	err = verifyIssuer(&cfg, pcc)
+	if err != nil {
+		return err
+	}
+	validity, err := lintCertificate(pcc)
+	if err != nil {
+		return err
+	}
+	if flags.outputProfile != "" {
+		return installOutputProfile(pcc)
+	}
+	logWarnings(req)
 	result := &Result{
 		Pcc:      pcc,
 		PickupId: flags.pickupID,
+		Validity: validity,
+		Warnings: req.Warnings,
 		Config: &Config{
-			Command:      c.Command.Name,
-			Format:       flags.format,
-			JKSAlias:     flags.jksAlias,
-			JKSPassword:  flags.jksPassword,
-			ChainOption:  certificate.ChainOptionFromString(flags.chainOption),
-			AllFile:      flags.file,
-			KeyFile:      flags.keyFile,
-			CertFile:     flags.certFile,
-			ChainFile:    flags.chainFile,
-			PickupIdFile: flags.pickupIDFile,
-			KeyPassword:  flags.keyPassword,
+			Command:            c.Command.Name,
+			Format:             flags.format,
+			JKSAlias:           flags.jksAlias,
+			JKSPassword:        flags.jksPassword,
+			ChainOption:        certificate.ChainOptionFromString(flags.chainOption),
+			AllFile:            flags.file,
+			KeyFile:            flags.keyFile,
+			CertFile:           flags.certFile,
+			ChainFile:          flags.chainFile,
+			PickupIdFile:       flags.pickupIDFile,
+			KeyPassword:        flags.keyPassword,
+			KeyPasswordFile:    flags.keyPasswordFile,
+			KeyPasswordCommand: flags.keyPasswordCommand,
 		},
 	}
 
@@ -417,23 +902,22 @@ func doCommandEnrollSshCert(c *cli.Context) error {
 
 	cfg, err := buildConfig(c, &flags)
 	if err != nil {
-		return fmt.Errorf("Failed to build vcert config: %s", err)
+		return fmt.Errorf("Failed to build vcert config: %w", err)
 	}
 
 	connector, err := vcert.NewClient(&cfg)
 
 	if err != nil {
-		logf("Unable to build connector for %s: %s", cfg.ConnectorType, err)
-	} else {
-		if flags.verbose {
-			logf("Successfully built connector for %s", cfg.ConnectorType)
-		}
+		return fmt.Errorf("Unable to build connector for %s: %w", cfg.ConnectorType, err)
+	}
+	if flags.verbose {
+		logf("Successfully built connector for %s", cfg.ConnectorType)
 	}
 
 	err = connector.Ping()
 
 	if err != nil {
-		logf("Unable to connect to %s: %s", cfg.ConnectorType, err)
+		logf("Unable to connect to %s: %w", cfg.ConnectorType, err)
 	} else {
 		if flags.verbose {
 			logf("Successfully connected to %s", cfg.ConnectorType)
@@ -609,7 +1093,7 @@ func doCommandCredMgmt1(c *cli.Context) error {
 
 	cfg, err := buildConfig(c, &flags)
 	if err != nil {
-		return fmt.Errorf("Failed to build vcert config: %s", err)
+		return fmt.Errorf("Failed to build vcert config: %w", err)
 	}
 
 	var clientP12 bool
@@ -619,7 +1103,7 @@ func doCommandCredMgmt1(c *cli.Context) error {
 
 	connector, err := vcert.NewClient(&cfg, false) // Everything else requires an endpoint connection
 	if err != nil {
-		return fmt.Errorf("could not create connector: %s", err)
+		return fmt.Errorf("could not create connector: %w", err)
 	}
 
 	//getting the concrete connector
@@ -827,164 +1311,839 @@ func getVaaSCredentials(vaasConnector *cloud.Connector, cfg *vcert.Config) error
 	return nil
 }
 
-func doCommandGenCSR1(c *cli.Context) error {
-	err := validateGenerateFlags1(c.Command.Name)
+func doCommandStatus(c *cli.Context) error {
+	err := validateStatusFlags(c.Command.Name)
 	if err != nil {
 		return err
 	}
-	key, csr, err := generateCsrForCommandGenCsr(&flags, []byte(flags.keyPassword))
+
+	err = setTLSConfig()
 	if err != nil {
 		return err
 	}
-	err = writeOutKeyAndCsr(c.Command.Name, &flags, key, csr)
+
+	cfg, err := buildConfig(c, &flags)
 	if err != nil {
-		return err
+		return fmt.Errorf("Failed to build vcert config: %w", err)
 	}
 
-	return nil
-}
-
-func doCommandPickup1(c *cli.Context) error {
+	report := checkStatus(&cfg, time.Duration(flags.timeout)*time.Second)
+	if flags.credFormat == "json" {
+		err = outputJSON(report)
+		if err != nil {
+			return err
+		}
+	} else {
+		report.print()
+	}
 
-	isServiceGen := IsCSRServiceVaaSGenerated(c.Command.Name)
-	wasPasswordEmpty := false
-	if flags.noPrompt && flags.keyPassword == "" && flags.format != "pkcs12" && flags.format != "jks" && (isServiceGen || isTppConnector(c.Command.Name)) {
-		flags.keyPassword = fmt.Sprintf("t%d-%s.tem.pwd", time.Now().Unix(), randRunes(4))
-		wasPasswordEmpty = true
+	if !report.Ready() {
+		return fmt.Errorf("%s is not ready: %s", cfg.ConnectorType, report.Error)
 	}
+	return nil
+}
 
-	err := validatePickupFlags1(c.Command.Name)
+func doCommandPolicyDiff(c *cli.Context) error {
+	err := validatePolicyDiffFlags(c.Command.Name)
 	if err != nil {
 		return err
 	}
+
 	err = setTLSConfig()
 	if err != nil {
 		return err
 	}
 
-	validateOverWritingEnviromentVariables()
-
 	cfg, err := buildConfig(c, &flags)
 	if err != nil {
-		return fmt.Errorf("Failed to build vcert config: %s", err)
+		return fmt.Errorf("failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return err
 	}
 
-	connector, err := vcert.NewClient(&cfg) // Everything else requires an endpoint connection
+	report, err := diffZonePolicies(connector, flags.policyZones[0], flags.policyZones[1])
 	if err != nil {
-		logf("Unable to connect to %s: %s", cfg.ConnectorType, err)
-	} else {
-		logf("Successfully connected to %s", cfg.ConnectorType)
+		return err
+	}
+	if flags.credFormat == "json" {
+		return outputJSON(report)
 	}
+	report.print()
+	return nil
+}
 
-	if flags.pickupIDFile != "" {
-		bytes, err := ioutil.ReadFile(flags.pickupIDFile)
-		if err != nil {
-			return fmt.Errorf("Failed to read Pickup ID value: %s", err)
-		}
-		flags.pickupID = strings.TrimSpace(string(bytes))
+func doCommandPolicyApply(c *cli.Context) error {
+	err := validatePolicyApplyFlags(c.Command.Name)
+	if err != nil {
+		return err
 	}
-	var req = &certificate.Request{
-		PickupID:    flags.pickupID,
-		ChainOption: certificate.ChainOptionFromString(flags.chainOption),
+
+	err = setTLSConfig()
+	if err != nil {
+		return err
 	}
-	if flags.keyPassword != "" {
-		// key password is provided, which means will be requesting private key
-		req.KeyPassword = flags.keyPassword
-		req.FetchPrivateKey = true
+
+	file, bytes, err := policy.GetFileAndBytes(flags.policySpecLocation)
+	if err != nil {
+		return err
 	}
-	var pcc *certificate.PEMCollection
-	pcc, err = retrieveCertificate(connector, req, time.Duration(flags.timeout)*time.Second)
+	file.Close()
+	ps, err := parsePolicySpecification(bytes, strings.ToLower(policy.GetFileType(flags.policySpecLocation)))
 	if err != nil {
-		errStr := err.Error()
-		sliceString := strings.Split(errStr, ":")
-		size := len(sliceString)
-		errToValidate := sliceString[size-1]
-		if strings.TrimSpace(errToValidate) == "Failed to lookup private key vault id" && wasPasswordEmpty {
-			req.KeyPassword = ""
-			req.FetchPrivateKey = false
-			pcc, err = retrieveCertificate(connector, req, time.Duration(flags.timeout)*time.Second)
+		return err
+	}
 
-			if err != nil {
-				return fmt.Errorf("Failed to retrieve certificate: %s", err)
-			}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return err
+	}
 
-		} else {
-			return fmt.Errorf("Failed to retrieve certificate: %s", err)
-		}
+	zones, err := policyApplyZones(connector)
+	if err != nil {
+		return err
 	}
-	logf("Successfully retrieved request for %s", flags.pickupID)
+	if len(zones) == 0 {
+		return fmt.Errorf("no zone to apply the policy to")
+	}
+	logf("Applying policy specification %s to %d zones", flags.policySpecLocation, len(zones))
 
-	if pcc.PrivateKey != "" && (flags.format == Pkcs12 || flags.format == JKSFormat || flags.format == util.LegacyPem) || (flags.noPrompt && wasPasswordEmpty && pcc.PrivateKey != "") {
-		privKey, err := util.DecryptPkcs8PrivateKey(pcc.PrivateKey, flags.keyPassword)
+	newSetter := func() (policy.Setter, error) {
+		return vcert.NewClient(&cfg)
+	}
+	results := policy.ApplyBulk(newSetter, ps, zones, policy.BulkOptions{
+		Concurrency:     flags.policyConcurrency,
+		ContinueOnError: flags.continueOnError,
+	})
+	if flags.credFormat == "json" {
+		err = outputJSON(results)
 		if err != nil {
-			if err.Error() == "pkcs8: only PBES2 supported" && connector.GetType() == endpoint.ConnectorTypeTPP {
-				return fmt.Errorf("ERROR: To continue, you must select either the SHA1 3DES or SHA256 AES256 private key PBE algorithm. In a web browser, log in to TLS Protect and go to Configuration > Folders, select your zone, then click Certificate Policy and expand Show Advanced Options to make the change.")
-			}
 			return err
 		}
-		pcc.PrivateKey = privKey
+	} else {
+		printBulkResults(results)
 	}
 
-	if pcc.PrivateKey != "" && flags.format == util.LegacyPem && !wasPasswordEmpty {
-		pcc.PrivateKey, err = util.EncryptPkcs1PrivateKey(pcc.PrivateKey, flags.keyPassword)
-		if err != nil {
-			return err
+	failed := 0
+	for _, r := range results {
+		if r.Status != policy.BulkStatusApplied {
+			failed++
 		}
 	}
-
-	if wasPasswordEmpty {
-		flags.keyPassword = ""
+	if failed > 0 {
+		return fmt.Errorf("the policy wasn't applied to %d of %d zones", failed, len(results))
 	}
+	return nil
+}
 
-	result := &Result{
-		Pcc:      pcc,
-		PickupId: flags.pickupID,
-		Config: &Config{
-			Command:      c.Command.Name,
-			Format:       flags.format,
-			JKSAlias:     flags.jksAlias,
-			JKSPassword:  flags.jksPassword,
-			ChainOption:  certificate.ChainOptionFromString(flags.chainOption),
-			AllFile:      flags.file,
-			KeyFile:      flags.keyFile,
-			CertFile:     flags.certFile,
-			ChainFile:    flags.chainFile,
-			PickupIdFile: flags.pickupIDFile,
-			KeyPassword:  flags.keyPassword,
-		},
+func doCommandContactsGet(c *cli.Context) error {
+	err := validateContactsFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	manager, err := newContactManager(c)
+	if err != nil {
+		return err
 	}
-	err = result.Flush()
 
+	report := &contactsReport{ID: flags.distinguishedName, Zone: flags.policyName}
+	report.Contacts, err = getContacts(manager, report.ID, report.Zone)
 	if err != nil {
-		return fmt.Errorf("Failed to output the results: %s", err)
+		return err
+	}
+	if flags.credFormat == "json" {
+		return outputJSON(report)
 	}
+	report.print()
 	return nil
 }
 
-func doCommandRevoke1(c *cli.Context) error {
-	err := validateRevokeFlags1(c.Command.Name)
+func doCommandContactsSet(c *cli.Context) error {
+	err := validateContactsFlags(c.Command.Name)
 	if err != nil {
 		return err
 	}
-	err = setTLSConfig()
+	manager, err := newContactManager(c)
 	if err != nil {
 		return err
 	}
 
-	validateOverWritingEnviromentVariables()
-
-	cfg, err := buildConfig(c, &flags)
+	report := &contactsReport{ID: flags.distinguishedName, Zone: flags.policyName}
+	current := []string(flags.contacts)
+	if len(flags.contacts) == 0 {
+		current, err = getContacts(manager, report.ID, report.Zone)
+		if err != nil {
+			return err
+		}
+	}
+	report.Contacts = changeContacts(current, flags.addContacts, flags.removeContacts)
+	if report.ID != "" {
+		err = manager.SetCertificateContacts(report.ID, report.Contacts)
+	} else {
+		err = manager.SetZoneContacts(report.Zone, report.Contacts)
+	}
 	if err != nil {
-		return fmt.Errorf("Failed to build vcert config: %s", err)
+		return err
+	}
+	if flags.credFormat == "json" {
+		return outputJSON(report)
 	}
+	report.print()
+	return nil
+}
 
-	connector, err := vcert.NewClient(&cfg) // Everything else requires an endpoint connection
+func doCommandApplications(c *cli.Context) error {
+	err := validateApplicationsFlags(c.Command.Name)
 	if err != nil {
-		logf("Unable to connect to %s: %s", cfg.ConnectorType, err)
-	} else {
-		logf("Successfully connected to %s", cfg.ConnectorType)
+		return err
 	}
-
+	associator, err := newApplicationAssociator(c)
+	if err != nil {
+		return err
+	}
+
+	switch c.Command.Name {
+	case commandAppAddName:
+		err = associator.AssociateApplications(flags.distinguishedName, flags.applications, flags.pushToApplications)
+	case commandAppRemoveName:
+		err = associator.DissociateApplications(flags.distinguishedName, flags.applications)
+	}
+	if err != nil {
+		return err
+	}
+
+	report := &applicationsReport{ID: flags.distinguishedName}
+	report.Applications, err = associator.GetCertificateApplications(report.ID)
+	if err != nil {
+		return err
+	}
+	if flags.credFormat == "json" {
+		return outputJSON(report)
+	}
+	report.print()
+	return nil
+}
+
+func doCommandSign(c *cli.Context) error {
+	err := validateSignFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	csr, err := readCSR(stdin)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return err
+	}
+
+	req := &certificate.Request{
+		CsrOrigin:   certificate.UserProvidedCSR,
+		ChainOption: certificate.ChainOptionFromString(flags.chainOption),
+	}
+	for _, f := range flags.customFields {
+		k, v, err := parseCustomField(f)
+		if err != nil {
+			return err
+		}
+		req.CustomFields = append(req.CustomFields, certificate.CustomField{Name: k, Value: v})
+	}
+	err = req.SetCSR(csr)
+	if err != nil {
+		return err
+	}
+	err = applyCSRAttributes(req, &flags)
+	if err != nil {
+		return err
+	}
+	pcc, err := signCSR(connector, req, req.GetCSR(), time.Duration(flags.timeout)*time.Second)
+	if err != nil {
+		return err
+	}
+	_, err = lintCertificate(pcc)
+	if err != nil {
+		return err
+	}
+	return writeSignedCertificate(os.Stdout, pcc, req.ChainOption)
+}
+
+func doCommandRun(c *cli.Context) error {
+	err := validateRunFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+
+	if flags.daemon {
+		d := &playbook.Daemon{
+			Path:     flags.playbookFile,
+			Interval: time.Duration(flags.interval) * time.Minute,
+			Log:      logf,
+		}
+		if flags.stateStore != "" {
+			d.State, err = state.Open(flags.stateStore, flags.kubeconfig)
+			if err != nil {
+				return err
+			}
+		}
+		// the Windows service manager stops the service instead of sending signals
+		if isService, err := runService(d); isService {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+		go func() {
+			<-stop
+			cancel()
+		}()
+		return d.Run(ctx)
+	}
+
+	pb, err := playbook.Load(flags.playbookFile)
+	if err != nil {
+		return err
+	}
+	runner := playbook.NewRunner(pb)
+	runner.Log = logf
+	if flags.check {
+		drifts, err := runner.Check(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, d := range drifts {
+			logf("drift: %s", d)
+		}
+		if len(drifts) > 0 {
+			return fmt.Errorf("%d drift(s) found between the playbook and the installed certificates", len(drifts))
+		}
+		logf("installed certificates match the playbook")
+		return nil
+	}
+	if flags.checkpointFile != "" {
+		runner.Checkpoint, err = loadRunCheckpoint()
+		if err != nil {
+			return err
+		}
+	}
+
+	// the certificate in progress is finished on SIGINT or SIGTERM, the remaining ones are checkpointed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		select {
+		case s := <-stop:
+			logf("received %s, finishing the certificate in progress", s)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err = runner.RunOnce(ctx)
+	if runner.Checkpoint != nil {
+		if cpErr := saveRunCheckpoint(runner.Checkpoint); cpErr != nil {
+			return cpErr
+		}
+	}
+	if err != nil || flags.manifestFile == "" {
+		return err
+	}
+	return writeManifest(pb)
+}
+
+func loadRunCheckpoint() (*playbook.Checkpoint, error) {
+	if !flags.resume {
+		if _, err := os.Stat(flags.checkpointFile); err == nil {
+			return nil, fmt.Errorf("checkpoint %s exists, use --resume to continue the previous run", flags.checkpointFile)
+		}
+		return &playbook.Checkpoint{}, nil
+	}
+	return playbook.LoadCheckpoint(flags.checkpointFile)
+}
+
+func saveRunCheckpoint(cp *playbook.Checkpoint) error {
+	if cp.Empty() {
+		err := os.Remove(flags.checkpointFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove checkpoint: %s", err)
+		}
+		return nil
+	}
+	err := cp.WriteFile(flags.checkpointFile)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %s", err)
+	}
+	logf("wrote checkpoint %s, use --resume to continue", flags.checkpointFile)
+	return nil
+}
+
+func writeManifest(pb *playbook.Playbook) error {
+	m, err := playbook.BuildManifest(pb, time.Now())
+	if err != nil {
+		return err
+	}
+	if flags.manifestKeyFile != "" {
+		data, err := ioutil.ReadFile(flags.manifestKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read manifest signing key: %s", err)
+		}
+		key, err := playbook.ParseSigningKey(data)
+		if err != nil {
+			return err
+		}
+		err = m.Sign(key)
+		if err != nil {
+			return err
+		}
+	}
+	err = m.WriteFile(flags.manifestFile)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %s", err)
+	}
+	logf("wrote manifest of %d certificates to %s", len(m.Certificates), flags.manifestFile)
+	return nil
+}
+
+func doCommandOfflineRequest(c *cli.Context) error {
+	err := validateOfflineRequestFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	key, csr, err := generateCsrForCommandGenCsr(&flags, []byte(flags.keyPassword))
+	if err != nil {
+		return err
+	}
+	req := fillCertificateRequest(&certificate.Request{}, &flags)
+	err = req.SetCSR(csr)
+	if err != nil {
+		return err
+	}
+	offlineReq, err := offline.NewRequest(req, flags.zone)
+	if err != nil {
+		return err
+	}
+	// the key is written first, a request without its key would be of no use. The CSR is in the request, it's
+	// only written out when asked for.
+	if flags.csrFile == "" {
+		csr = nil
+	}
+	err = writeOutKeyAndCsr(c.Command.Name, &flags, key, csr)
+	if err != nil {
+		return err
+	}
+	err = offlineReq.WriteFile(flags.offlineRequestFile)
+	if err != nil {
+		return fmt.Errorf("failed to write request file: %s", err)
+	}
+	logf("Offline request %s written to %s", offlineReq.ID, flags.offlineRequestFile)
+	return nil
+}
+
+func doCommandOfflineSubmit(c *cli.Context) error {
+	err := validateOfflineSubmitFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	offlineReq, err := offline.ReadRequest(flags.offlineRequestFile)
+	if err != nil {
+		return err
+	}
+	if flags.zone == "" {
+		flags.zone = offlineReq.Zone
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return err
+	}
+	resp, err := offlineReq.Submit(connector, time.Duration(flags.timeout)*time.Second)
+	if err != nil {
+		return err
+	}
+	err = resp.WriteFile(flags.offlineResponseFile)
+	if err != nil {
+		return fmt.Errorf("failed to write response file: %s", err)
+	}
+	logf("Certificate of offline request %s written to %s", offlineReq.ID, flags.offlineResponseFile)
+	return nil
+}
+
+func doCommandOfflineImport(c *cli.Context) error {
+	err := validateOfflineImportFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	offlineReq, err := offline.ReadRequest(flags.offlineRequestFile)
+	if err != nil {
+		return err
+	}
+	resp, err := offline.ReadResponse(flags.offlineResponseFile)
+	if err != nil {
+		return err
+	}
+	pcc, err := resp.Import(offlineReq)
+	if err != nil {
+		return err
+	}
+	result := &Result{
+		Pcc:      pcc,
+		PickupId: resp.PickupID,
+		Config: &Config{
+			Command:     c.Command.Name,
+			Format:      "pem",
+			ChainOption: certificate.ChainOptionFromString(flags.chainOption),
+			CertFile:    flags.certFile,
+			ChainFile:   flags.chainFile,
+		},
+	}
+	return result.Flush()
+}
+
+func doCommandValidateConfig(c *cli.Context) error {
+	err := validateValidateConfigFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	if flags.config != "" {
+		err = vcert.ValidateConfigFile(flags.config)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %s", verror.UserDataError, flags.config, err)
+		}
+		logf("%s is valid", flags.config)
+	}
+	if flags.playbookFile != "" {
+		_, err = playbook.Load(flags.playbookFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", flags.playbookFile, err)
+		}
+		logf("%s is valid", flags.playbookFile)
+	}
+	return nil
+}
+
+func doCommandExport(c *cli.Context) error {
+	err := validateExportFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return err
+	}
+	if flags.cursorFile != "" {
+		return exportChanges(connector)
+	}
+	exporter := &inventory.Exporter{
+		Connector:  connector,
+		Filter:     endpoint.Filter{WithExpired: flags.withExpired},
+		Checkpoint: flags.checkpointFile,
+		Sort:       flags.sortBy,
+	}
+	if flags.expiringWithin != "" {
+		exporter.ExpiringWithin, err = inventory.ParseDuration(flags.expiringWithin)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := exporter.ExportFile(flags.exportFile, flags.exportFormat)
+	if err != nil {
+		if flags.checkpointFile != "" && flags.exportFormat != inventory.FormatParquet {
+			logf("Exported %d certificates, run the same command again to resume", n)
+		}
+		return err
+	}
+	logf("Successfully exported %d certificates to %s", n, flags.exportFile)
+	return nil
+}
+
+// exportChanges writes the changes since the cursor to the export file, the cursor is saved last so that a failed
+// export is run again from the same point
+func exportChanges(connector endpoint.Connector) error {
+	cursor, err := inventory.ReadCursor(flags.cursorFile)
+	if err != nil {
+		return err
+	}
+	changes, next, err := inventory.Delta(connector, cursor)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(flags.exportFile)
+	if err != nil {
+		return err
+	}
+	err = inventory.WriteChanges(f, changes)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	err = next.Save(flags.cursorFile)
+	if err != nil {
+		return err
+	}
+	logf("Successfully exported %d changes to %s", len(changes), flags.exportFile)
+	return nil
+}
+
+func doCommandMetrics(c *cli.Context) error {
+	err := validateMetricsFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	e := &exporter.Exporter{
+		Endpoints:      flags.metricsEndpoints,
+		Filter:         endpoint.Filter{WithExpired: flags.withExpired},
+		Interval:       time.Duration(flags.interval) * time.Minute,
+		ExpiringWithin: time.Duration(flags.expiringDays) * 24 * time.Hour,
+		Log:            logf,
+	}
+	if flags.zone != "" || flags.config != "" || flags.testMode {
+		err = setTLSConfig()
+		if err != nil {
+			return err
+		}
+		cfg, err := buildConfig(c, &flags)
+		if err != nil {
+			return fmt.Errorf("Failed to build vcert config: %w", err)
+		}
+		e.Connector, err = vcert.NewClient(&cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	server := &http.Server{Addr: flags.listenAddress, Handler: mux}
+	go func() {
+		<-stop
+		cancel()
+		_ = server.Close()
+	}()
+	go func() {
+		_ = e.Run(ctx)
+	}()
+	logf("Serving metrics on %s/metrics", flags.listenAddress)
+	err = server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func doCommandGenCSR1(c *cli.Context) error {
+	err := validateGenerateFlags1(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	key, csr, err := generateCsrForCommandGenCsr(&flags, []byte(flags.keyPassword))
+	if err != nil {
+		return err
+	}
+	err = writeOutKeyAndCsr(c.Command.Name, &flags, key, csr)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func doCommandPickup1(c *cli.Context) error {
+
+	isServiceGen := IsCSRServiceVaaSGenerated(c.Command.Name)
+	wasPasswordEmpty := false
+	if flags.noPrompt && flags.keyPassword == "" && flags.format != "pkcs12" && flags.format != "jks" && (isServiceGen || isTppConnector(c.Command.Name)) {
+		flags.keyPassword = fmt.Sprintf("t%d-%s.tem.pwd", time.Now().Unix(), randRunes(4))
+		wasPasswordEmpty = true
+	}
+
+	err := validatePickupFlags1(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	validateOverWritingEnviromentVariables()
+
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+
+	connector, err := vcert.NewClient(&cfg) // Everything else requires an endpoint connection
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
+	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
+
+	if flags.pickupIDFile != "" {
+		bytes, err := ioutil.ReadFile(flags.pickupIDFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read Pickup ID value: %s", err)
+		}
+		flags.pickupID = strings.TrimSpace(string(bytes))
+	}
+	var req = &certificate.Request{
+		PickupID:    flags.pickupID,
+		ChainOption: certificate.ChainOptionFromString(flags.chainOption),
+	}
+	setChainSelection(req)
+	if flags.keyPassword != "" {
+		// key password is provided, which means will be requesting private key
+		req.KeyPassword = flags.keyPassword
+		req.FetchPrivateKey = true
+	}
+	var pcc *certificate.PEMCollection
+	pcc, err = retrieveCertificate(connector, req, time.Duration(flags.timeout)*time.Second)
+	if err != nil {
+		errStr := err.Error()
+		sliceString := strings.Split(errStr, ":")
+		size := len(sliceString)
+		errToValidate := sliceString[size-1]
+		if strings.TrimSpace(errToValidate) == "Failed to lookup private key vault id" && wasPasswordEmpty {
+			req.KeyPassword = ""
+			req.FetchPrivateKey = false
+			pcc, err = retrieveCertificate(connector, req, time.Duration(flags.timeout)*time.Second)
+
+			if err != nil {
+				return fmt.Errorf("Failed to retrieve certificate: %w", err)
+			}
+
+		} else {
+			return fmt.Errorf("Failed to retrieve certificate: %w", err)
+		}
+	}
+	logf("Successfully retrieved request for %s", flags.pickupID)
+
+	if pcc.PrivateKey != "" && (flags.format == Pkcs12 || flags.format == JKSFormat || flags.format == util.LegacyPem) || (flags.noPrompt && wasPasswordEmpty && pcc.PrivateKey != "") {
+		privKey, err := util.DecryptPkcs8PrivateKey(pcc.PrivateKey, flags.keyPassword)
+		if err != nil {
+			if err.Error() == "pkcs8: only PBES2 supported" && connector.GetType() == endpoint.ConnectorTypeTPP {
+				return fmt.Errorf("ERROR: To continue, you must select either the SHA1 3DES or SHA256 AES256 private key PBE algorithm. In a web browser, log in to TLS Protect and go to Configuration > Folders, select your zone, then click Certificate Policy and expand Show Advanced Options to make the change.")
+			}
+			return err
+		}
+		pcc.PrivateKey = privKey
+	}
+
+	if pcc.PrivateKey != "" && flags.format == util.LegacyPem && !wasPasswordEmpty {
+		pcc.PrivateKey, err = util.EncryptPkcs1PrivateKey(pcc.PrivateKey, flags.keyPassword)
+		if err != nil {
+			return err
+		}
+	}
+
+	if wasPasswordEmpty {
+		flags.keyPassword = ""
+	}
+	err = verifyPossession(pcc)
+	if err != nil {
+		return err
+	}
+	err = verifyIssuer(&cfg, pcc)
+	if err != nil {
+		return err
+	}
+	validity, err := lintCertificate(pcc)
+	if err != nil {
+		return err
+	}
+
+	logWarnings(req)
+	result := &Result{
+		Pcc:      pcc,
+		PickupId: flags.pickupID,
+		Validity: validity,
+		Warnings: req.Warnings,
+		Config: &Config{
+			Command:            c.Command.Name,
+			Format:             flags.format,
+			JKSAlias:           flags.jksAlias,
+			JKSPassword:        flags.jksPassword,
+			ChainOption:        certificate.ChainOptionFromString(flags.chainOption),
+			AllFile:            flags.file,
+			KeyFile:            flags.keyFile,
+			CertFile:           flags.certFile,
+			ChainFile:          flags.chainFile,
+			PickupIdFile:       flags.pickupIDFile,
+			KeyPassword:        flags.keyPassword,
+			KeyPasswordFile:    flags.keyPasswordFile,
+			KeyPasswordCommand: flags.keyPasswordCommand,
+		},
+	}
+	err = result.Flush()
+
+	if err != nil {
+		return fmt.Errorf("Failed to output the results: %s", err)
+	}
+	return nil
+}
+
+func doCommandRevoke1(c *cli.Context) error {
+	err := validateRevokeFlags1(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	validateOverWritingEnviromentVariables()
+
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+
+	connector, err := vcert.NewClient(&cfg) // Everything else requires an endpoint connection
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
+	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
+
 	var revReq = &certificate.RevocationRequest{}
 	switch true {
 	case flags.distinguishedName != "":
@@ -1012,13 +2171,51 @@ func doCommandRevoke1(c *cli.Context) error {
 
 	err = connector.RevokeCertificate(revReq)
 	if err != nil {
-		return fmt.Errorf("Failed to revoke certificate: %s", err)
+		return fmt.Errorf("Failed to revoke certificate: %w", err)
 	}
 	logf("Successfully created revocation request for %s", requestedFor)
 
 	return nil
 }
 
+func doCommandCancel(c *cli.Context) error {
+	err := validateCancelFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	validateOverWritingEnviromentVariables()
+
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
+	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
+
+	if flags.pickupIDFile != "" {
+		bytes, err := ioutil.ReadFile(flags.pickupIDFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read Pickup ID value: %s", err)
+		}
+		flags.pickupID = strings.TrimSpace(string(bytes))
+	}
+	err = connector.CancelRequest(flags.pickupID)
+	if err != nil {
+		return fmt.Errorf("Failed to cancel certificate request: %w", err)
+	}
+	logf("Successfully cancelled the certificate request %s", flags.pickupID)
+	return nil
+}
+
 func doCommandCreatePolicy(c *cli.Context) error {
 
 	err := validateSetPolicyFlags(c.Command.Name)
@@ -1061,27 +2258,15 @@ func doCommandCreatePolicy(c *cli.Context) error {
 		}
 	}
 
-	//based on the extension call the appropriate method to feed the policySpecification
-	//structure.
-	var policySpecification policy.PolicySpecification
-	if fileExt == policy.JsonExtension {
-		err = json.Unmarshal(bytes, &policySpecification)
-		if err != nil {
-			return err
-		}
-	} else if fileExt == policy.YamlExtension {
-		err = yaml.Unmarshal(bytes, &policySpecification)
-		if err != nil {
-			return err
-		}
-	} else {
-		return fmt.Errorf("the specified file is not supported")
+	policySpecification, err := parsePolicySpecification(bytes, fileExt)
+	if err != nil {
+		return err
 	}
 
 	cfg, err := buildConfig(c, &flags)
 
 	if err != nil {
-		return fmt.Errorf("failed to build vcert config: %s", err)
+		return fmt.Errorf("failed to build vcert config: %w", err)
 	}
 	connector, err := vcert.NewClient(&cfg)
 
@@ -1089,7 +2274,7 @@ func doCommandCreatePolicy(c *cli.Context) error {
 		return err
 	}
 
-	_, err = connector.SetPolicy(policyName, &policySpecification)
+	_, err = connector.SetPolicy(policyName, policySpecification)
 
 	defer file.Close()
 
@@ -1119,7 +2304,7 @@ func doCommandGetPolicy(c *cli.Context) error {
 
 		cfg, err := buildConfig(c, &flags)
 		if err != nil {
-			return fmt.Errorf("failed to build vcert config: %s", err)
+			return fmt.Errorf("failed to build vcert config: %w", err)
 		}
 
 		connector, err := vcert.NewClient(&cfg)
@@ -1196,15 +2381,14 @@ func doCommandRenew1(c *cli.Context) error {
 	validateOverWritingEnviromentVariables()
 	cfg, err := buildConfig(c, &flags)
 	if err != nil {
-		return fmt.Errorf("Failed to build vcert config: %s", err)
+		return fmt.Errorf("Failed to build vcert config: %w", err)
 	}
 
 	connector, err := vcert.NewClient(&cfg) // Everything else requires an endpoint connection
 	if err != nil {
-		logf("Unable to connect to %s: %s", cfg.ConnectorType, err)
-	} else {
-		logf("Successfully connected to %s", cfg.ConnectorType)
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
 	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
 
 	var req = &certificate.Request{}
 	var pcc = &certificate.PEMCollection{}
@@ -1256,6 +2440,14 @@ func doCommandRenew1(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	err = checkPublicCA(req)
+	if err != nil {
+		return err
+	}
+	err = checkCAA(req)
+	if err != nil {
+		return err
+	}
 
 	requestedFor := func() string {
 		if flags.distinguishedName != "" {
@@ -1286,6 +2478,7 @@ func doCommandRenew1(c *cli.Context) error {
 	} else {
 		req.PickupID = flags.pickupID
 		req.ChainOption = certificate.ChainOptionFromString(flags.chainOption)
+		setChainSelection(req)
 		req.KeyPassword = flags.keyPassword
 
 		pcc, err = retrieveCertificate(connector, req, time.Duration(flags.timeout)*time.Second)
@@ -1315,22 +2508,39 @@ func doCommandRenew1(c *cli.Context) error {
 			}
 		}
 	}
+	err = verifyPossession(pcc)
+	if err != nil {
+		return err
+	}
+	err = verifyIssuer(&cfg, pcc)
+	if err != nil {
+		return err
+	}
+	validity, err := lintCertificate(pcc)
+	if err != nil {
+		return err
+	}
 
+	logWarnings(req)
 	result := &Result{
 		Pcc:      pcc,
 		PickupId: flags.pickupID,
+		Validity: validity,
+		Warnings: req.Warnings,
 		Config: &Config{
-			Command:      c.Command.Name,
-			Format:       flags.format,
-			JKSAlias:     flags.jksAlias,
-			JKSPassword:  flags.jksPassword,
-			ChainOption:  certificate.ChainOptionFromString(flags.chainOption),
-			AllFile:      flags.file,
-			KeyFile:      flags.keyFile,
-			CertFile:     flags.certFile,
-			ChainFile:    flags.chainFile,
-			PickupIdFile: flags.pickupIDFile,
-			KeyPassword:  flags.keyPassword,
+			Command:            c.Command.Name,
+			Format:             flags.format,
+			JKSAlias:           flags.jksAlias,
+			JKSPassword:        flags.jksPassword,
+			ChainOption:        certificate.ChainOptionFromString(flags.chainOption),
+			AllFile:            flags.file,
+			KeyFile:            flags.keyFile,
+			CertFile:           flags.certFile,
+			ChainFile:          flags.chainFile,
+			PickupIdFile:       flags.pickupIDFile,
+			KeyPassword:        flags.keyPassword,
+			KeyPasswordFile:    flags.keyPasswordFile,
+			KeyPasswordCommand: flags.keyPasswordCommand,
 		},
 	}
 	err = result.Flush()
@@ -1356,7 +2566,7 @@ func doCommandSshGetConfig(c *cli.Context) error {
 
 	cfg, err := buildConfig(c, &flags)
 	if err != nil {
-		return fmt.Errorf("failed to build vcert config: %s", err)
+		return fmt.Errorf("failed to build vcert config: %w", err)
 	}
 
 	connector, err := vcert.NewClient(&cfg)
@@ -1375,10 +2585,9 @@ func doCommandSshGetConfig(c *cli.Context) error {
 	err = connector.Ping()
 
 	if err != nil {
-		logf("Unable to connect to %s: %s", cfg.ConnectorType, err)
-	} else {
-		logf("Successfully connected to %s", cfg.ConnectorType)
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
 	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
 
 	req := &certificate.SshCaTemplateRequest{}
 	if flags.sshCertTemplate != "" {
@@ -1432,6 +2641,14 @@ func generateCsrForCommandGenCsr(cf *commandFlags, privateKeyPass []byte) (priva
 	if cf.keyCurve != certificate.EllipticCurveNotSet {
 		certReq.KeyCurve = cf.keyCurve
 	}
+	if cf.experimentalPQC != "" {
+		alg, _ := certificate.ParsePQCAlgorithm(cf.experimentalPQC)
+		logf("Warning: generating an experimental %s key, the CSR is meant for testing CA acceptance", alg)
+		certReq.PrivateKey, err = certificate.GeneratePQCPrivateKey(alg)
+		if err != nil {
+			return
+		}
+	}
 	err = certReq.GeneratePrivateKey()
 	if err != nil {
 		return
@@ -1474,15 +2691,17 @@ func writeOutKeyAndCsr(commandName string, cf *commandFlags, key []byte, csr []b
 		Pcc:      pcc,
 		PickupId: "",
 		Config: &Config{
-			Command:      commandName,
-			Format:       cf.csrFormat,
-			ChainOption:  certificate.ChainOptionFromString(cf.chainOption),
-			AllFile:      cf.file,
-			KeyFile:      cf.keyFile,
-			CSRFile:      cf.csrFile,
-			ChainFile:    "",
-			PickupIdFile: "",
-			KeyPassword:  cf.keyPassword,
+			Command:            commandName,
+			Format:             cf.csrFormat,
+			ChainOption:        certificate.ChainOptionFromString(cf.chainOption),
+			AllFile:            cf.file,
+			KeyFile:            cf.keyFile,
+			CSRFile:            cf.csrFile,
+			ChainFile:          "",
+			PickupIdFile:       "",
+			KeyPassword:        cf.keyPassword,
+			KeyPasswordFile:    cf.keyPasswordFile,
+			KeyPasswordCommand: cf.keyPasswordCommand,
 		},
 	}
 
@@ -1505,15 +2724,14 @@ func doCommandSshPickup(c *cli.Context) error {
 
 	cfg, err := buildConfig(c, &flags)
 	if err != nil {
-		return fmt.Errorf("Failed to build vcert config: %s", err)
+		return fmt.Errorf("Failed to build vcert config: %w", err)
 	}
 
 	connector, err := vcert.NewClient(&cfg) // Everything else requires an endpoint connection
 	if err != nil {
-		logf("Unable to connect to %s: %s", cfg.ConnectorType, err)
-	} else {
-		logf("Successfully connected to %s", cfg.ConnectorType)
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
 	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
 
 	var req certificate.SshCertRequest
 
@@ -1523,7 +2741,7 @@ func doCommandSshPickup(c *cli.Context) error {
 	data, err := connector.RetrieveSSHCertificate(&req)
 
 	if err != nil {
-		return fmt.Errorf("failed to retrieve certificate: %s", err)
+		return fmt.Errorf("failed to retrieve certificate: %w", err)
 	}
 	logf("Successfully retrieved request for %s", data.DN)
 
@@ -20,14 +20,56 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/dns"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/httpdump"
+	"github.com/Venafi/vcert/v4/pkg/proxy"
 )
 
+// parseHeader splits a "Name: value" header, already validated by runBeforeCommand
+func parseHeader(h string) (name, value string) {
+	i := strings.Index(h, ":")
+	return strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:])
+}
+
+// parseResolve splits a "host:address" entry of --resolve
+func parseResolve(r string) (host, address string, err error) {
+	i := strings.Index(r, ":")
+	if i <= 0 || net.ParseIP(r[i+1:]) == nil {
+		return "", "", fmt.Errorf("--resolve %q is not in the \"host:address\" format", r)
+	}
+	return strings.ToLower(r[:i]), r[i+1:], nil
+}
+
+// newDialer returns the dialer of the connections to the platform, nil when the system resolves and dials them
+func newDialer(flags *commandFlags) *dns.Dialer {
+	if len(flags.resolve) == 0 && flags.dnsServer == "" && flags.dohURL == "" && flags.ipVersion == 0 &&
+		flags.happyEyeballsDelay == 0 {
+		return nil
+	}
+	d := &dns.Dialer{
+		Server:        flags.dnsServer,
+		DoH:           flags.dohURL,
+		IPVersion:     flags.ipVersion,
+		FallbackDelay: flags.happyEyeballsDelay,
+	}
+	for _, r := range flags.resolve {
+		host, address, _ := parseResolve(r)
+		if d.Hosts == nil {
+			d.Hosts = make(map[string]string)
+		}
+		d.Hosts[host] = address
+	}
+	return d
+}
+
 func buildConfig(c *cli.Context, flags *commandFlags) (cfg vcert.Config, err error) {
 	cfg.LogVerbose = flags.verbose
 
@@ -137,16 +179,29 @@ func buildConfig(c *cli.Context, flags *commandFlags) (cfg vcert.Config, err err
 		}
 	}
 
-	// zone may be overridden by CLI flag
+	// issuer pins may be overridden by CLI flag
+	if flags.issuerPins != "" {
+		if cfg.PinnedIssuers != "" {
+			logf("Overriding issuer pins based on command line flag.")
+		}
+		data, err := ioutil.ReadFile(flags.issuerPins)
+		if err != nil {
+			return cfg, fmt.Errorf("Failed to read issuer pins: %s", err)
+		}
+		cfg.PinnedIssuers = string(data)
+	}
+
+	// zone may be overridden by CLI flag, or else by environment property: flags > env > file
+	zone := getPropertyFromEnvironment(vCertZone)
 	if flags.zone != "" {
 		if cfg.Zone != "" {
 			logf("Overriding zone based on command line flag.")
 		}
 		cfg.Zone = flags.zone
-	}
-
-	zone := getPropertyFromEnvironment(vCertZone)
-	if cfg.Zone == "" && zone != "" {
+	} else if zone != "" {
+		if cfg.Zone != "" {
+			logf("Overriding zone based on environment property")
+		}
 		cfg.Zone = zone
 	}
 
@@ -156,5 +211,31 @@ func buildConfig(c *cli.Context, flags *commandFlags) (cfg vcert.Config, err err
 		}
 	}
 
+	cfg.UserAgent = flags.userAgent
+	for _, h := range flags.headers {
+		name, value := parseHeader(h)
+		if cfg.Headers == nil {
+			cfg.Headers = make(map[string]string)
+		}
+		cfg.Headers[name] = value
+	}
+	cfg.Dialer = newDialer(flags)
+	if flags.proxyURL != "" {
+		if cfg.Proxy != nil {
+			logf("Overriding proxy based on command line flag.")
+		}
+		cfg.Proxy, err = proxy.Parse(flags.proxyURL, flags.proxyAuth)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	if flags.debugDumpDir != "" {
+		cfg.DebugDump = &httpdump.Dumper{Dir: flags.debugDumpDir, Gzip: flags.debugDumpGzip}
+		if err = cfg.DebugDump.Prepare(); err != nil {
+			return cfg, fmt.Errorf("failed to create debug dump directory: %s", err)
+		}
+	}
+
 	return cfg, nil
 }
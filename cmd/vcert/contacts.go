@@ -0,0 +1,86 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+type contactsReport struct {
+	ID       string   `json:"id,omitempty"`
+	Zone     string   `json:"zone,omitempty"`
+	Contacts []string `json:"contacts"`
+}
+
+func (r *contactsReport) print() {
+	if len(r.Contacts) == 0 {
+		fmt.Println("no contacts")
+		return
+	}
+	for _, contact := range r.Contacts {
+		fmt.Println(contact)
+	}
+}
+
+func newContactManager(c *cli.Context) (endpoint.ContactManager, error) {
+	err := setTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	manager, ok := connector.(endpoint.ContactManager)
+	if !ok {
+		return nil, fmt.Errorf("contacts are not supported by %s", connector.GetType())
+	}
+	return manager, nil
+}
+
+func getContacts(manager endpoint.ContactManager, id, zone string) ([]string, error) {
+	if id != "" {
+		return manager.GetCertificateContacts(id)
+	}
+	return manager.GetZoneContacts(zone)
+}
+
+// changeContacts adds and removes contacts, names are compared regardless of case as identity providers do
+func changeContacts(current, add, remove []string) []string {
+	contacts := []string{}
+	seen := make(map[string]bool)
+	for _, contact := range remove {
+		seen[strings.ToLower(contact)] = true
+	}
+	for _, contact := range append(append([]string(nil), current...), add...) {
+		if !seen[strings.ToLower(contact)] {
+			seen[strings.ToLower(contact)] = true
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts
+}
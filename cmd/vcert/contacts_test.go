@@ -0,0 +1,39 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangeContacts(t *testing.T) {
+	for _, c := range []struct {
+		current, add, remove, expected []string
+	}{
+		{current: []string{"Web Team", "alice"}, add: []string{"Platform Team"}, remove: []string{"web team"},
+			expected: []string{"alice", "Platform Team"}},
+		{current: []string{"alice"}, add: []string{"Alice", "bob"}, expected: []string{"alice", "bob"}},
+		{current: []string{"alice"}, remove: []string{"alice"}, expected: []string{}},
+		{add: []string{"alice"}, expected: []string{"alice"}},
+	} {
+		contacts := changeContacts(c.current, c.add, c.remove)
+		if !reflect.DeepEqual(contacts, c.expected) {
+			t.Fatalf("expected %v, got %v", c.expected, contacts)
+		}
+	}
+}
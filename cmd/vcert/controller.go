@@ -0,0 +1,108 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/kubernetes"
+)
+
+func doCommandController(c *cli.Context) error {
+	err := validateControllerFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
+	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
+
+	client, err := kubernetes.NewClient(flags.kubeconfig)
+	if err != nil {
+		return err
+	}
+	controller := &kubernetes.Controller{
+		Client:      client,
+		Connector:   connector,
+		Zone:        cfg.Zone,
+		Namespace:   flags.namespace,
+		Gateways:    flags.gateways,
+		RenewBefore: time.Duration(flags.renewBeforeDays) * 24 * time.Hour,
+		Resync:      time.Duration(flags.interval) * time.Minute,
+		Log:         logf,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		<-stop
+		cancel()
+	}()
+	if !flags.inject {
+		logf("Watching the objects annotated with %s on %s", kubernetes.AnnotationZone, client.Server)
+		return controller.Run(ctx)
+	}
+
+	injector := &kubernetes.Injector{Controller: controller}
+	server := &http.Server{Addr: flags.listenAddress, Handler: injector}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = controller.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = injector.Run(ctx)
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	logf("Watching the objects annotated with %s on %s", kubernetes.AnnotationZone, client.Server)
+	logf("Serving the admission webhook injecting the certificates of the pods annotated with %s on %s", kubernetes.AnnotationInject, flags.listenAddress)
+	err = server.ListenAndServeTLS(flags.tlsCertFile, flags.tlsKeyFile)
+	cancel()
+	wg.Wait()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"github.com/youmark/pkcs8"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/inspect"
+	"github.com/Venafi/vcert/v4/pkg/util"
+)
+
+// the output formats of convert, on top of the ones of enroll
+const (
+	convertFormatDER     = "der"
+	convertFormatPKCS7   = "pkcs7"
+	convertFormatOpenSSH = "openssh"
+)
+
+func doCommandConvert(c *cli.Context) error {
+	err := validateConvertFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	if c.Args().Len() > 1 {
+		return fmt.Errorf("only one file can be converted at a time")
+	}
+	file := c.Args().First()
+	var data []byte
+	if file == "" || file == stdinFileName {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	inPassword, err := readPasswordsFromInputFlag(flags.inPassword, 0)
+	if err != nil {
+		return err
+	}
+	index := 0
+	if flags.inPassword == flags.keyPassword {
+		index++
+	}
+	keyPassword, err := readPasswordsFromInputFlag(flags.keyPassword, index)
+	if err != nil {
+		return err
+	}
+	contents, err := inspect.Decode(data, inPassword)
+	if err != nil {
+		return err
+	}
+	for _, key := range contents.Keys {
+		if key.Key == nil {
+			return fmt.Errorf("the private key is encrypted, use --in-password to specify its password")
+		}
+	}
+	if len(contents.Keys) > 0 && keyPassword == "" && !flags.noPrompt && convertEncryptsKey(contents) {
+		keyPassword, err = promptKeyPassword()
+		if err != nil {
+			return err
+		}
+	}
+	return convert(contents, &Config{
+		Command:     c.Command.Name,
+		Format:      flags.format,
+		JKSAlias:    flags.jksAlias,
+		JKSPassword: flags.jksPassword,
+		ChainOption: certificate.ChainOptionFromString(flags.chainOption),
+		AllFile:     flags.file,
+		KeyFile:     flags.keyFile,
+		CertFile:    flags.certFile,
+		ChainFile:   flags.chainFile,
+		KeyPassword: keyPassword,
+	})
+}
+
+// convertEncryptsKey reports whether the private key of contents is written encrypted by a password
+func convertEncryptsKey(contents *inspect.Contents) bool {
+	switch flags.format {
+	case convertFormatPKCS7, convertFormatOpenSSH:
+		return false
+	case convertFormatDER:
+		// --file holds the certificate when there's one
+		return flags.keyFile != "" || len(contents.Certificates) == 0
+	}
+	return true
+}
+
+// convert writes the certificates, the first request and the first private key of contents as the format of config
+func convert(contents *inspect.Contents, config *Config) error {
+	chain := contents.Chain()
+	if config.ChainOption == certificate.ChainOptionIgnore && len(chain) > 1 {
+		chain = chain[:1]
+	}
+	var key crypto.Signer
+	if len(contents.Keys) > 0 {
+		key = contents.Keys[0].Key
+	}
+	if len(contents.Keys) > 1 {
+		logf("Only the first of the %d private keys is converted", len(contents.Keys))
+	}
+	switch config.Format {
+	case convertFormatDER:
+		return convertToDER(chain, key, config)
+	case convertFormatPKCS7:
+		if len(chain) == 0 {
+			return fmt.Errorf("PKCS#7 format requires at least one certificate")
+		}
+		if key != nil {
+			logf("The private key can't be written in PKCS#7 format and is left out")
+		}
+		der, err := inspect.MarshalPKCS7(chain)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(config.AllFile, der, 0600)
+	case convertFormatOpenSSH:
+		return convertToOpenSSH(chain, key, config)
+	}
+
+	// the keys of the PKCS#12 files and the Java keystores are read back from their legacy PEM encoding
+	keyFormat := config.Format
+	if keyFormat == Pkcs12 || keyFormat == JKSFormat {
+		keyFormat = util.LegacyPem
+	}
+	var leaf *x509.Certificate
+	if len(chain) > 0 {
+		leaf = chain[0]
+	}
+	pcc, err := certificate.NewPEMCollection(leaf, key, []byte(config.KeyPassword), keyFormat)
+	if err != nil {
+		return err
+	}
+	if len(chain) > 1 {
+		for _, cert := range chain[1:] {
+			if err = pcc.AddChainElement(cert); err != nil {
+				return err
+			}
+		}
+	}
+	if len(contents.Requests) > 0 {
+		pcc.CSR = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: contents.Requests[0].Raw}))
+	}
+	result := &Result{Pcc: pcc, Config: config}
+	err = result.Flush()
+	if err != nil {
+		return fmt.Errorf("Failed to output the results: %s", err)
+	}
+	return nil
+}
+
+// convertToDER writes the certificate, and the private key as PKCS#8, encrypted when there's a key password
+func convertToDER(chain []*x509.Certificate, key crypto.Signer, config *Config) error {
+	certFile, keyFile := config.CertFile, config.KeyFile
+	if config.AllFile != "" {
+		certFile = config.AllFile
+		if len(chain) == 0 {
+			certFile, keyFile = "", config.AllFile
+		}
+	}
+	if len(chain) > 1 {
+		logf("Only the certificate can be written in DER format, its chain of %d certificates is left out", len(chain)-1)
+	}
+	if certFile != "" {
+		if len(chain) == 0 {
+			return fmt.Errorf("there's no certificate to write in DER format")
+		}
+		if err := ioutil.WriteFile(certFile, chain[0].Raw, 0600); err != nil {
+			return err
+		}
+	}
+	if key == nil {
+		if keyFile != "" {
+			return fmt.Errorf("there's no private key to write in DER format")
+		}
+		return nil
+	}
+	if keyFile == "" {
+		logf("The private key is left out, use --key-file to write it")
+		return nil
+	}
+	var password []byte
+	if config.KeyPassword != "" {
+		password = []byte(config.KeyPassword)
+	}
+	der, err := pkcs8.MarshalPrivateKey(key, password, nil)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyFile, der, 0600)
+}
+
+// convertToOpenSSH writes the private key as ssh-keygen does, and its public key to the same file name with .pub
+func convertToOpenSSH(chain []*x509.Certificate, key crypto.Signer, config *Config) error {
+	if key == nil {
+		return fmt.Errorf("OpenSSH format requires a private key")
+	}
+	if len(chain) > 0 {
+		logf("The certificates can't be written in OpenSSH format and are left out")
+	}
+	if _, ok := key.(ed25519.PrivateKey); ok && config.KeyPassword != "" {
+		return fmt.Errorf("Ed25519 private keys can't be encrypted in OpenSSH format, omit --key-password")
+	}
+	keyFile := config.AllFile
+	if keyFile == "" {
+		keyFile = config.KeyFile
+	}
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+	data, err := util.MarshalSshPrivateKey(key, config.KeyPassword)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(keyFile, data, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyFile+sshPubKeyFileExt, ssh.MarshalAuthorizedKey(pub), 0644)
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/inspect"
+	"github.com/Venafi/vcert/v4/pkg/util"
+)
+
+func newConvertContents(t *testing.T) *inspect.Contents {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now,
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, root, root, rootKey.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		NotBefore:    now,
+		NotAfter:     now.AddDate(0, 0, 90),
+	}
+	der, err = x509.CreateCertificate(rand.Reader, leaf, root, leafKey.Public(), rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	// the root comes first to check the chain is ordered from the leaf
+	return &inspect.Contents{
+		Certificates: []*x509.Certificate{root, leaf},
+		Keys:         []*inspect.PrivateKey{{Key: leafKey}},
+	}
+}
+
+func TestConvert(t *testing.T) {
+	contents := newConvertContents(t)
+	dir, err := ioutil.TempDir("", "vcertConvert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		config   *Config
+		password string
+		format   string
+		certs    int
+		keys     int
+	}{
+		{"pem", &Config{Format: "pem", KeyPassword: "secret"}, "secret", inspect.FormatPEM, 2, 1},
+		{"legacy pem", &Config{Format: util.LegacyPem, ChainOption: certificate.ChainOptionIgnore}, "", inspect.FormatPEM, 1, 1},
+		{"pkcs12", &Config{Format: Pkcs12, KeyPassword: "secret"}, "secret", inspect.FormatPKCS12, 2, 1},
+		{"jks", &Config{Format: JKSFormat, JKSAlias: "www", KeyPassword: "secret"}, "secret", inspect.FormatJKS, 2, 1},
+		{"der", &Config{Format: convertFormatDER}, "", inspect.FormatDER, 1, 0},
+		{"pkcs7", &Config{Format: convertFormatPKCS7}, "", inspect.FormatPKCS7, 2, 0},
+		{"openssh", &Config{Format: convertFormatOpenSSH}, "", inspect.FormatPEM, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Command = commandConvertName
+			tt.config.AllFile = filepath.Join(dir, tt.name)
+			if err := convert(contents, tt.config); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(tt.config.AllFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			converted, err := inspect.Decode(data, tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if converted.Format != tt.format || len(converted.Certificates) != tt.certs || len(converted.Keys) != tt.keys {
+				t.Fatalf("unexpected %s with %d certificates and %d keys", converted.Format, len(converted.Certificates), len(converted.Keys))
+			}
+			if tt.certs > 0 && !converted.Certificates[0].Equal(contents.Certificates[1]) {
+				t.Error("expected the leaf certificate first")
+			}
+			for _, key := range converted.Keys {
+				if !key.Key.Public().(*ecdsa.PublicKey).Equal(contents.Keys[0].Key.Public()) {
+					t.Error("unexpected private key")
+				}
+				if key.Encrypted != (tt.password != "") {
+					t.Errorf("expected an encrypted key %v", tt.password != "")
+				}
+			}
+		})
+	}
+
+	pub, err := ioutil.ReadFile(filepath.Join(dir, "openssh.pub"))
+	if err != nil || !strings.HasPrefix(string(pub), "ecdsa-sha2-nistp256 ") {
+		t.Errorf("unexpected OpenSSH public key %q, %v", pub, err)
+	}
+
+	keyFile := filepath.Join(dir, "key.der")
+	err = convert(contents, &Config{Format: convertFormatDER, CertFile: filepath.Join(dir, "cert.der"), KeyFile: keyFile, KeyPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, err := inspect.Decode(data, "secret")
+	if err != nil || len(converted.Keys) != 1 || !converted.Keys[0].Encrypted {
+		t.Errorf("expected an encrypted PKCS#8 key, got %+v, %v", converted, err)
+	}
+
+	err = convert(&inspect.Contents{Keys: contents.Keys}, &Config{Format: convertFormatPKCS7, AllFile: filepath.Join(dir, "key.p7b")})
+	if err == nil {
+		t.Error("expected an error without certificates")
+	}
+}
+
+func TestValidateConvertFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags commandFlags
+		valid bool
+	}{
+		{"pem", commandFlags{format: "pem"}, true},
+		{"unknown", commandFlags{format: "p7c", file: "chain.p7c"}, false},
+		{"pkcs12 without file", commandFlags{format: Pkcs12, certFile: "cert.p12"}, false},
+		{"jks without alias", commandFlags{format: JKSFormat, file: "keystore.jks", keyPassword: "secret"}, false},
+		{"jks", commandFlags{format: JKSFormat, file: "keystore.jks", keyPassword: "secret", jksAlias: "www"}, true},
+		{"der", commandFlags{format: convertFormatDER, certFile: "cert.cer", keyFile: "key.der"}, true},
+		{"der to stdout", commandFlags{format: convertFormatDER}, false},
+		{"pkcs7 with key file", commandFlags{format: convertFormatPKCS7, file: "chain.p7b", keyFile: "key.pem"}, false},
+		{"openssh", commandFlags{format: convertFormatOpenSSH, keyFile: "id_ecdsa"}, true},
+		{"openssh without file", commandFlags{format: convertFormatOpenSSH}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags = tt.flags
+			defer func() { flags = commandFlags{} }()
+			err := validateConvertFlags(commandConvertName)
+			if (err == nil) != tt.valid {
+				t.Errorf("unexpected validation %v", err)
+			}
+		})
+	}
+}
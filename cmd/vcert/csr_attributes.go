@@ -0,0 +1,95 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/playbook"
+)
+
+// applyCSRAttributes applies --csr-attributes to the user provided CSR of req and reports what was done with each
+// of its attributes and requested extensions
+func applyCSRAttributes(req *certificate.Request, cf *commandFlags) error {
+	mode, err := certificate.CSRAttributeModeFromString(cf.csrAttributes)
+	if err != nil {
+		return err
+	}
+	policy := certificate.CSRAttributePolicy{Mode: mode, ChallengePassword: cf.csrChallengePassword}
+	for _, e := range cf.csrExtensions {
+		ext, err := parseCSRExtension(e)
+		if err != nil {
+			return err
+		}
+		policy.Extensions = append(policy.Extensions, ext)
+	}
+	var signer crypto.Signer
+	if cf.csrKeyFile != "" {
+		data, err := ioutil.ReadFile(cf.csrKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the private key of the CSR: %s", err)
+		}
+		signer, err = playbook.ParseSigningKey(data)
+		if err != nil {
+			return err
+		}
+	}
+	changes, err := req.ApplyCSRAttributePolicy(policy, signer)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		logf("CSR %s", c)
+	}
+	return nil
+}
+
+// parseCSRExtension parses a non critical extension in the 'oid=hex DER value' format
+func parseCSRExtension(s string) (pkix.Extension, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return pkix.Extension{}, fmt.Errorf("CSR extension %q is not in the 'oid=hex DER value' format", s)
+	}
+	var oid asn1.ObjectIdentifier
+	for _, n := range strings.Split(s[:i], ".") {
+		v, err := strconv.Atoi(n)
+		if err != nil || v < 0 {
+			return pkix.Extension{}, fmt.Errorf("CSR extension %q has an invalid OID", s)
+		}
+		oid = append(oid, v)
+	}
+	if len(oid) < 2 {
+		return pkix.Extension{}, fmt.Errorf("CSR extension %q has an invalid OID", s)
+	}
+	value, err := hex.DecodeString(s[i+1:])
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("CSR extension %q has an invalid value: %s", s, err)
+	}
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(value, &raw); err != nil || len(rest) > 0 {
+		return pkix.Extension{}, fmt.Errorf("CSR extension %q value is not DER", s)
+	}
+	return pkix.Extension{Id: oid, Value: value}, nil
+}
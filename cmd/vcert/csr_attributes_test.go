@@ -0,0 +1,37 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseCSRExtension(t *testing.T) {
+	ext, err := parseCSRExtension("2.5.29.15=030205a0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext.Id.String() != "2.5.29.15" || ext.Critical || !bytes.Equal(ext.Value, []byte{3, 2, 5, 160}) {
+		t.Fatalf("unexpected extension %v", ext)
+	}
+	for _, s := range []string{"030205a0", "=030205a0", "2.x.29=030205a0", "2=030205a0", "2.5.29.15=zz", "2.5.29.15=0302"} {
+		if _, err = parseCSRExtension(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
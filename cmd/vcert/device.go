@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/device"
+)
+
+func doCommandDevice(c *cli.Context) error {
+	err := validateDeviceFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
+	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
+
+	dir := flags.deviceDir
+	if dir == "" {
+		dir = device.DefaultDir()
+	}
+	enroller := &device.Enroller{
+		Connector:   connector,
+		Zone:        cfg.Zone,
+		Store:       device.SystemStore(dir),
+		RenewBefore: time.Duration(flags.renewBeforeDays) * 24 * time.Hour,
+		KeyLength:   flags.keySize,
+		KeyCurve:    flags.keyCurve,
+		Log:         logf,
+	}
+	if flags.keyType != nil {
+		enroller.KeyType = *flags.keyType
+	} else {
+		enroller.KeyType = certificate.KeyTypeRSA
+	}
+
+	if flags.daemon {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+		go func() {
+			<-stop
+			cancel()
+		}()
+		logf("Checking the device identity in %s every %d minutes", enroller.Store.Name(), flags.interval)
+		return enroller.Run(ctx, time.Duration(flags.interval)*time.Minute)
+	}
+
+	res, err := enroller.Enroll(context.Background())
+	if err != nil {
+		return err
+	}
+	if res.Kept {
+		logf("The device identity %s is good until %s", res.Certificate.Subject.CommonName, res.Certificate.NotAfter.Format(time.RFC3339))
+	} else {
+		logf("Installed the device identity %s (serial %x) in %s, valid until %s", res.Certificate.Subject.CommonName,
+			res.Certificate.SerialNumber, enroller.Store.Name(), res.Certificate.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
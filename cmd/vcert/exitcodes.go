@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"net"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Exit codes of the CLI, so scripts can branch on the kind of failure without parsing the error message
+const (
+	exitSuccess = 0
+	// exitFailure is any failure not covered by a more specific code, e.g. invalid command line options
+	exitFailure = 1
+	// exitPolicyViolation is a request that doesn't match the policy of the zone
+	exitPolicyViolation = 2
+	// exitAuthFailure is an invalid or expired credential
+	exitAuthFailure = 3
+	// exitPending is a certificate whose issuance is pending or that wasn't issued before the timeout
+	exitPending = 4
+	// exitNetwork is a Venafi platform that can't be reached or is unavailable
+	exitNetwork = 5
+	// exitUserData is a request the Venafi platform rejected because of its data
+	exitUserData = 6
+	// exitServer is an unexpected error of the Venafi platform
+	exitServer = 7
+)
+
+// exitCode returns the exit code of the CLI for err
+func exitCode(err error) int {
+	var violation endpoint.ErrPolicyViolation
+	var pending endpoint.ErrCertificatePending
+	var timeout endpoint.ErrRetrieveCertificateTimeout
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return exitSuccess
+	case errors.Is(err, verror.PolicyValidationError), errors.As(err, &violation):
+		return exitPolicyViolation
+	case errors.Is(err, verror.AuthError):
+		return exitAuthFailure
+	case errors.As(err, &pending), errors.As(err, &timeout):
+		return exitPending
+	case errors.Is(err, verror.ServerUnavailableError), errors.As(err, &netErr):
+		return exitNetwork
+	case errors.Is(err, verror.UserDataError):
+		return exitUserData
+	case errors.Is(err, verror.ServerError):
+		return exitServer
+	}
+	return exitFailure
+}
+
+// errorOutput is written to the standard output when a command with the JSON format fails, so tooling can key off the
+// stable code of the error rather than its message
+type errorOutput struct {
+	Error struct {
+		Code    string
+		Message string
+	}
+}
+
+func newErrorOutput(err error) *errorOutput {
+	out := &errorOutput{}
+	out.Error.Code = verror.CodeOf(err)
+	out.Error.Message = err.Error()
+	return out
+}
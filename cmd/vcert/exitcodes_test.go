@@ -0,0 +1,193 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{nil, exitSuccess},
+		{errors.New("a zone is required"), exitFailure},
+		{endpoint.ErrPolicyViolation{Field: "DNS SAN", Value: "*.com", Rule: "wildcards are not allowed"}, exitPolicyViolation},
+		{fmt.Errorf("%w: 401 Unauthorized", verror.AuthError), exitAuthFailure},
+		{endpoint.ErrCertificatePending{CertificateID: "id"}, exitPending},
+		{fmt.Errorf("failed to retrieve: %w", endpoint.ErrRetrieveCertificateTimeout{CertificateID: "id"}), exitPending},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, exitNetwork},
+		{fmt.Errorf("%w: 503", verror.ServerTemporaryUnavailableError), exitNetwork},
+		{fmt.Errorf("%w: unknown custom field", verror.UserDataError), exitUserData},
+		{fmt.Errorf("%w: 500", verror.ServerError), exitServer},
+	}
+	for _, c := range cases {
+		if code := exitCode(c.err); code != c.code {
+			t.Errorf("%v: expected exit code %d, got %d", c.err, c.code, code)
+		}
+	}
+}
+
+func TestNewErrorOutput(t *testing.T) {
+	cases := []struct {
+		err  error
+		code string
+	}{
+		{errors.New("a zone is required"), verror.CodeUnknown},
+		{endpoint.ErrPolicyViolation{Field: "DNS SAN", Value: "*.com", Rule: "wildcards are not allowed"}, verror.CodePolicyViolation},
+		{fmt.Errorf("failed to retrieve: %w", endpoint.ErrRetrieveCertificateTimeout{CertificateID: "id"}), verror.CodeRetrieveTimeout},
+		{fmt.Errorf("%w: 401 Unauthorized", verror.AuthError), verror.CodeAuth},
+	}
+	for _, c := range cases {
+		b, err := json.Marshal(newErrorOutput(c.err))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			Error struct {
+				Code    string
+				Message string
+			}
+		}
+		if err := json.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Error.Code != c.code || out.Error.Message != c.err.Error() {
+			t.Errorf("%v: unexpected output %s", c.err, b)
+		}
+	}
+}
+
+// newTPPStub serves the TPP API with handler over TLS and writes the trust bundle to reach it to a file, close stops
+// the server and removes the file
+func newTPPStub(t *testing.T, handler http.HandlerFunc) (url, trustBundle string, close func()) {
+	t.Helper()
+	srv := httptest.NewTLSServer(handler)
+	f, err := ioutil.TempFile("", "vcertBundle")
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	_ = pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	f.Close()
+	return srv.URL, f.Name(), func() {
+		srv.Close()
+		os.Remove(f.Name())
+	}
+}
+
+// runCommand runs the vcert command line args as main does and returns its exit status and standard output
+func runCommand(t *testing.T, args ...string) (status int, stdout string) {
+	t.Helper()
+	out, err := ioutil.TempFile("", "vcertStdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	oldArgs, oldStdout, oldExit := os.Args, os.Stdout, exit
+	defer func() {
+		os.Args, os.Stdout, exit = oldArgs, oldStdout, oldExit
+	}()
+	os.Args = append([]string{"vcert"}, args...)
+	os.Stdout = out
+	exit = func(code int) { status = code }
+	flags = commandFlags{}
+	exitStatus = exitFailure
+
+	func() {
+		defer func() { _ = recover() }()
+		main()
+	}()
+	b, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, string(b)
+}
+
+func TestCommandExitCodes(t *testing.T) {
+	url, bundle, closeStub := newTPPStub(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/authorize/"):
+			w.WriteHeader(http.StatusUnauthorized)
+		case strings.HasSuffix(r.URL.Path, "/certificates/retrieve"):
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"Stage":500,"Status":"Pending approval"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	defer closeStub()
+	tpp := []string{"-u", url, "--trust-bundle", bundle}
+	cases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"pending pickup", append([]string{"pickup", "-t", "token", "--timeout", "0", "--pickup-id", `\VED\Policy\pending`}, tpp...), exitPending},
+		{"pickup with invalid credentials", append([]string{"pickup", "--tpp-user", "user", "--tpp-password", "wrong", "--pickup-id", `\VED\Policy\pending`}, tpp...), exitAuthFailure},
+		{"cancel with invalid credentials", append([]string{"cancel", "--tpp-user", "user", "--tpp-password", "wrong", "--pickup-id", `\VED\Policy\pending`}, tpp...), exitAuthFailure},
+		{"revoke failing on the server", append([]string{"revoke", "-t", "token", "--id", `\VED\Policy\revoked`}, tpp...), exitServer},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if status, _ := runCommand(t, c.args...); status != c.code {
+				t.Errorf("expected exit code %d, got %d", c.code, status)
+			}
+		})
+	}
+}
+
+func TestCommandJSONErrorOutput(t *testing.T) {
+	url, bundle, closeStub := newTPPStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"Stage":500,"Status":"Pending approval"}`))
+	})
+	defer closeStub()
+	status, stdout := runCommand(t, "pickup", "-u", url, "--trust-bundle", bundle, "-t", "token",
+		"--timeout", "0", "--pickup-id", `\VED\Policy\pending`, "--format", "json")
+	if status != exitPending {
+		t.Errorf("expected exit code %d, got %d", exitPending, status)
+	}
+	var out struct {
+		Error struct {
+			Code    string
+			Message string
+		}
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("the output isn't JSON: %s: %s", err, stdout)
+	}
+	if out.Error.Code != verror.CodeCertificatePending || !strings.Contains(out.Error.Message, "Pending approval") {
+		t.Errorf("unexpected output %s", stdout)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/hierarchy"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func doCommandCAHierarchy(c *cli.Context) error {
+	err := validateCAHierarchyFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return err
+	}
+	h, err := hierarchy.Retrieve(connector)
+	if err != nil {
+		return err
+	}
+	if flags.credFormat == "json" {
+		err = outputJSON(h)
+		if err != nil {
+			return err
+		}
+	} else {
+		printHierarchy(h)
+	}
+	expiring := h.Expiring(time.Now(), time.Duration(flags.expiringDays)*24*time.Hour)
+	if len(expiring) > 0 {
+		subjects := make([]string, len(expiring))
+		for i, ca := range expiring {
+			subjects[i] = ca.Subject
+		}
+		return fmt.Errorf("%w: %d CAs expire within %d days: %s", verror.CertificateCheckError, len(expiring),
+			flags.expiringDays, strings.Join(subjects, "; "))
+	}
+	return nil
+}
+
+func printHierarchy(h *hierarchy.Hierarchy) {
+	for _, ca := range h.CAs {
+		kind := "intermediate"
+		if ca.Root {
+			kind = "root"
+		}
+		indent := strings.Repeat("  ", ca.Depth)
+		fmt.Printf("%s%s (%s)\n", indent, ca.Subject, kind)
+		fmt.Printf("%s  valid %s to %s, %s key, %s\n", indent, ca.NotBefore.Format(time.RFC3339),
+			ca.NotAfter.Format(time.RFC3339), ca.KeyAlgorithm, ca.SignatureAlgorithm)
+		fmt.Printf("%s  thumbprint %s\n", indent, ca.Thumbprint)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/inspect"
+)
+
+// stdinFileName names the standard input in the output of inspect
+const stdinFileName = "-"
+
+// inspectFormatOpenSSL prints the certificates and requests like openssl x509 -text and openssl req -text
+const inspectFormatOpenSSL = "openssl"
+
+// inspection holds the details of one inspected file
+type inspection struct {
+	File           string                             `json:"file"`
+	SSHCertificate *certificate.SshCertificateDetails `json:"sshCertificate,omitempty"`
+	*inspect.Report
+
+	contents *inspect.Contents
+}
+
+func doCommandInspect(c *cli.Context) error {
+	err := validateInspectFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	password, err := readPasswordsFromInputFlag(flags.keyPassword, 0)
+	if err != nil {
+		return err
+	}
+	files := c.Args().Slice()
+	if len(files) == 0 {
+		files = []string{stdinFileName}
+	}
+	var inspections []*inspection
+	for _, file := range files {
+		var data []byte
+		if file == stdinFileName {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(file)
+		}
+		if err != nil {
+			return err
+		}
+		i, err := inspectFile(file, data, password, time.Now())
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		inspections = append(inspections, i)
+	}
+	switch flags.credFormat {
+	case "json":
+		return outputJSON(inspections)
+	case inspectFormatOpenSSL:
+		for _, i := range inspections {
+			i.printOpenSSL(os.Stdout)
+		}
+	default:
+		for _, i := range inspections {
+			i.print(os.Stdout)
+		}
+	}
+	return nil
+}
+
+// inspectFile decodes the OpenSSH certificate, or the X.509 certificates, requests and keys held by data
+func inspectFile(file string, data []byte, password string, now time.Time) (*inspection, error) {
+	if certificate.IsSshCertificate(data) {
+		cert, err := certificate.ParseSshCertificate(data)
+		if err != nil {
+			return nil, err
+		}
+		return &inspection{File: file, SSHCertificate: certificate.NewSshCertificateDetails(cert)}, nil
+	}
+	contents, err := inspect.Decode(data, password)
+	if err != nil {
+		return nil, err
+	}
+	return &inspection{File: file, Report: contents.Describe(now), contents: contents}, nil
+}
+
+func (i *inspection) print(w io.Writer) {
+	if i.Report != nil {
+		fmt.Fprintf(w, "%s (%s):\n", i.File, i.Format)
+	} else {
+		fmt.Fprintf(w, "%s:\n", i.File)
+	}
+	if d := i.SSHCertificate; d != nil {
+		fmt.Fprintf(w, "\tSSH certificate:\n")
+		fmt.Fprintf(w, "\t\tCertificate Type: %s\n", d.CertificateType)
+		fmt.Fprintf(w, "\t\tPublic key: %s %s:%s\n", d.KeyType, Sha256, d.PublicKeyFingerprintSHA256)
+		fmt.Fprintf(w, "\t\tSigning CA: %s:%s\n", Sha256, d.CAFingerprintSHA256)
+		fmt.Fprintf(w, "\t\tCertificate Identifier: %s\n", d.KeyID)
+		fmt.Fprintf(w, "\t\tSerial: %s\n", d.SerialNumber)
+		fmt.Fprintf(w, "\t\tValid From: %s\n", sshValidity(d.ValidFrom))
+		fmt.Fprintf(w, "\t\tValid To: %s\n", sshValidity(d.ValidTo))
+		printList(w, "Principals", d.Principals)
+		var options []string
+		if d.ForceCommand != "" {
+			options = append(options, "Force command: "+d.ForceCommand)
+		}
+		if len(d.SourceAddresses) > 0 {
+			options = append(options, "Source addresses: "+strings.Join(d.SourceAddresses, ","))
+		}
+		names := make([]string, 0, len(d.CriticalOptions))
+		for name := range d.CriticalOptions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			options = append(options, fmt.Sprintf("%s: %s", name, d.CriticalOptions[name]))
+		}
+		printList(w, "Critical Options", options)
+		var extensions []string
+		for _, name := range certificate.SshExtensionNames(d) {
+			if v := d.Extensions[name]; v != "" {
+				extensions = append(extensions, fmt.Sprintf("%s:%v", name, v))
+			} else {
+				extensions = append(extensions, name)
+			}
+		}
+		printList(w, "Extensions", extensions)
+		return
+	}
+	r := i.Report
+	for n, c := range r.Certificates {
+		fmt.Fprintf(w, "\tCertificate #%d (%s):\n", n+1, c.Role)
+		fmt.Fprintf(w, "\t\tSubject: %s\n", c.Subject)
+		fmt.Fprintf(w, "\t\tIssuer: %s\n", c.Issuer)
+		if c.IssuedBy != nil {
+			fmt.Fprintf(w, "\t\tIssued By: certificate #%d\n", *c.IssuedBy+1)
+		}
+		fmt.Fprintf(w, "\t\tSerial Number: %s\n", c.SerialNumber)
+		fmt.Fprintf(w, "\t\tValid From: %s\n", c.NotBefore.UTC().Format(time.RFC3339))
+		if c.Expired {
+			fmt.Fprintf(w, "\t\tValid To: %s (expired)\n", c.NotAfter.UTC().Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(w, "\t\tValid To: %s (%d days remaining)\n", c.NotAfter.UTC().Format(time.RFC3339), c.DaysRemaining)
+		}
+		printSANs(w, c.SANs)
+		printValues(w, "Key Usages", c.KeyUsages)
+		printValues(w, "Extended Key Usages", c.ExtKeyUsages)
+		fmt.Fprintf(w, "\t\tPublic Key: %s\n", c.PublicKey)
+		fmt.Fprintf(w, "\t\tSignature Algorithm: %s\n", c.SignatureAlgorithm)
+		fmt.Fprintf(w, "\t\tThumbprint: %s\n", c.Thumbprint)
+		fmt.Fprintf(w, "\t\tSHA-256 Fingerprint: %s\n", c.SHA256Fingerprint)
+	}
+	for n, req := range r.Requests {
+		fmt.Fprintf(w, "\tCertificate Request #%d:\n", n+1)
+		fmt.Fprintf(w, "\t\tSubject: %s\n", req.Subject)
+		printSANs(w, req.SANs)
+		printValues(w, "Key Usages", req.KeyUsages)
+		printValues(w, "Extended Key Usages", req.ExtKeyUsages)
+		fmt.Fprintf(w, "\t\tPublic Key: %s\n", req.PublicKey)
+		fmt.Fprintf(w, "\t\tSignature Algorithm: %s\n", req.SignatureAlgorithm)
+		fmt.Fprintf(w, "\t\tSignature Valid: %t\n", req.SignatureValid)
+	}
+	for n, key := range r.Keys {
+		fmt.Fprintf(w, "\tPrivate Key #%d:\n", n+1)
+		if key.PublicKey == nil {
+			fmt.Fprintf(w, "\t\tEncrypted, use --key-password to decrypt it\n")
+			continue
+		}
+		fmt.Fprintf(w, "\t\tPublic Key: %s\n", key.PublicKey)
+		fmt.Fprintf(w, "\t\tEncrypted: %t\n", key.Encrypted)
+		if key.Certificate != nil {
+			fmt.Fprintf(w, "\t\tCertificate: #%d\n", *key.Certificate+1)
+		}
+		if key.Request != nil {
+			fmt.Fprintf(w, "\t\tCertificate Request: #%d\n", *key.Request+1)
+		}
+	}
+}
+
+// printOpenSSL prints the certificates and the requests like OpenSSL, and the private keys like openssl pkey -pubout
+// -text, without their private part
+func (i *inspection) printOpenSSL(w io.Writer) {
+	if i.contents == nil {
+		i.print(w)
+		return
+	}
+	for _, cert := range i.contents.Certificates {
+		inspect.WriteCertificateText(w, cert)
+	}
+	for _, req := range i.contents.Requests {
+		inspect.WriteRequestText(w, req)
+	}
+	for _, key := range i.contents.Keys {
+		if key.Key != nil {
+			inspect.WritePublicKeyText(w, key.Key.Public())
+		}
+	}
+}
+
+func printSANs(w io.Writer, sans inspect.SANs) {
+	printValues(w, "DNS Names", sans.DNSNames)
+	printValues(w, "IP Addresses", sans.IPAddresses)
+	printValues(w, "Email Addresses", sans.EmailAddresses)
+	printValues(w, "URIs", sans.URIs)
+}
+
+// printValues prints values on one line, nothing is printed when there's none
+func printValues(w io.Writer, name string, values []string) {
+	if len(values) > 0 {
+		fmt.Fprintf(w, "\t\t%s: %s\n", name, strings.Join(values, ", "))
+	}
+}
+
+func printList(w io.Writer, name string, values []string) {
+	fmt.Fprintf(w, "\t\t%s:\n", name)
+	if len(values) == 0 {
+		fmt.Fprintf(w, "\t\t\tNone\n")
+	}
+	for _, v := range values {
+		fmt.Fprintf(w, "\t\t\t%s\n", v)
+	}
+}
+
+// sshValidity prints a validity bound of an OpenSSH certificate, which are unbounded at 0 and at the largest value
+func sshValidity(seconds int64) string {
+	switch seconds {
+	case 0:
+		return "always"
+	case math.MaxInt64:
+		return "forever"
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestInspectSSHCertificate(t *testing.T) {
+	pub, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        ssh.HostCert,
+		KeyId:           "web01",
+		ValidPrincipals: []string{"web01.example.com"},
+		ValidAfter:      1640995200,
+		ValidBefore:     1672531200,
+	}
+	if err = cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := inspectFile("web01-cert.pub", ssh.MarshalAuthorizedKey(cert), "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	i.print(&out)
+	for _, expected := range []string{
+		"web01-cert.pub:\n",
+		"\t\tCertificate Type: Host\n",
+		"\t\tCertificate Identifier: web01\n",
+		"\t\tValid From: 2022-01-01T00:00:00Z\n",
+		"\t\tValid To: 2023-01-01T00:00:00Z\n",
+		"\t\tPrincipals:\n\t\t\tweb01.example.com\n",
+		"\t\tCritical Options:\n\t\t\tNone\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("%q not found in\n%s", expected, out.String())
+		}
+	}
+
+	_, err = inspectFile("id_ed25519.pub", ssh.MarshalAuthorizedKey(key), "", time.Now())
+	if err == nil {
+		t.Error("expected an error for a public key")
+	}
+}
+
+func TestInspectX509(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(4096),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+
+	i, err := inspectFile("www.pem", data, "", time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	i.print(&out)
+	for _, expected := range []string{
+		"www.pem (PEM):\n",
+		"\tCertificate #1 (leaf):\n",
+		"\t\tValid To: 2022-04-01T00:00:00Z (30 days remaining)\n",
+		"\t\tDNS Names: www.example.com\n",
+		"\t\tExtended Key Usages: serverAuth\n",
+		"\t\tPublic Key: ECDSA P-256\n",
+		"\tPrivate Key #1:\n\t\tPublic Key: ECDSA P-256\n\t\tEncrypted: false\n\t\tCertificate: #1\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("%q not found in\n%s", expected, out.String())
+		}
+	}
+
+	out.Reset()
+	i.printOpenSSL(&out)
+	for _, expected := range []string{
+		"Certificate:\n    Data:\n        Version: 3 (0x2)\n        Serial Number: 4096 (0x1000)\n",
+		"        Subject: CN = www.example.com\n",
+		"\nPublic-Key: (256 bit)\npub:\n    04:",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("%q not found in\n%s", expected, out.String())
+		}
+	}
+}
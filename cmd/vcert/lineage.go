@@ -0,0 +1,98 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/inventory"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// lineageOutput is the JSON output of the lineage command
+type lineageOutput struct {
+	*inventory.Genealogy
+	// ValidAncestors are the ancestors to revoke along with a compromised certificate
+	ValidAncestors []certificate.CertificateInfo
+}
+
+func doCommandLineage(c *cli.Context) error {
+	err := validateLineageFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	var renewals []inventory.Renewal
+	thumbprint := flags.thumbprint
+	if flags.distinguishedName != "" {
+		connector, err := listConnector(c)
+		if err != nil {
+			return err
+		}
+		renewals, err = inventory.VersionRenewals(connector, flags.distinguishedName)
+		if err != nil {
+			return err
+		}
+		if thumbprint == "" {
+			if len(renewals) == 0 {
+				return fmt.Errorf("%w: certificate %s has no previous versions", verror.UserDataError, flags.distinguishedName)
+			}
+			thumbprint = renewals[0].Next.Thumbprint
+		}
+	}
+	if flags.inventoryCache != "" {
+		cache, err := inventory.OpenCache(flags.inventoryCache)
+		if err != nil {
+			return err
+		}
+		defer cache.Close()
+		recorded, err := cache.Renewals(context.Background())
+		if err != nil {
+			return err
+		}
+		renewals = append(renewals, recorded...)
+	}
+	g, err := inventory.Lineage(thumbprint, renewals)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if flags.credFormat == "json" {
+		return outputJSON(lineageOutput{Genealogy: g, ValidAncestors: g.ValidAncestors(now)})
+	}
+	for i := len(g.Ancestors) - 1; i >= 0; i-- {
+		printLineageEntry("ancestor", g.Ancestors[i], now)
+	}
+	printLineageEntry("certificate", g.Certificate, now)
+	for _, info := range g.Descendants {
+		printLineageEntry("descendant", info, now)
+	}
+	return nil
+}
+
+func printLineageEntry(relation string, info certificate.CertificateInfo, now time.Time) {
+	validity := "valid"
+	if !info.ValidTo.IsZero() && !info.ValidTo.After(now) {
+		validity = "expired"
+	}
+	fmt.Printf("%-11s  %s  %s  issued %s  expires %s  %s  %s\n", relation, info.Thumbprint, info.CN,
+		info.ValidFrom.Format(time.RFC3339), info.ValidTo.Format(time.RFC3339), validity, info.ID)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/lint"
+)
+
+// lintCertificate lints the issued certificate of pcc with --lint, or only checks its validity against the local clock
+// with --clock-skew, --clock-skew-error or --max-backdate, before it's written. The findings are logged and the errors
+// among them fail the command. The validity that was checked is returned for the JSON output.
+func lintCertificate(pcc *certificate.PEMCollection) (*Validity, error) {
+	if !flags.lint && !checkClock() || pcc.Certificate == "" {
+		return nil, nil
+	}
+	ekus, err := lintExtKeyUsages()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := lint.ParsePEM([]byte(pcc.Certificate))
+	if err != nil {
+		return nil, err
+	}
+	opts := lint.Options{
+		ExtKeyUsages:   ekus,
+		Now:            time.Now(),
+		ClockSkew:      time.Duration(flags.clockSkew) * time.Second,
+		ClockSkewError: flags.clockSkewError,
+		MaxBackdate:    time.Duration(flags.maxBackdate) * time.Second,
+	}
+	var findings []lint.Finding
+	if flags.lint {
+		findings = lint.Certificate(cert, opts)
+	} else {
+		findings = lint.Clock(cert, opts)
+	}
+	for _, f := range findings {
+		logf("lint %s", f)
+	}
+	validity := &Validity{
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		LocalTime:          opts.Now.UTC().Truncate(time.Second),
+		NotBeforeOffset:    int64(cert.NotBefore.Sub(opts.Now).Round(time.Second) / time.Second),
+		ClockSkewTolerance: flags.clockSkew,
+		MaxBackdate:        flags.maxBackdate,
+	}
+	return validity, lint.Err(findings)
+}
+
+func checkClock() bool {
+	return flags.clockSkew > 0 || flags.clockSkewError || flags.maxBackdate > 0
+}
+
+func lintExtKeyUsages() ([]x509.ExtKeyUsage, error) {
+	var ekus []x509.ExtKeyUsage
+	for _, name := range flags.lintEKUs {
+		eku, err := lint.ParseExtKeyUsage(name)
+		if err != nil {
+			return nil, err
+		}
+		ekus = append(ekus, eku)
+	}
+	return ekus, nil
+}
+
+func validateLintFlags() error {
+	if flags.clockSkew < 0 || flags.maxBackdate < 0 {
+		return fmt.Errorf("--clock-skew and --max-backdate can't be negative")
+	}
+	if len(flags.lintEKUs) > 0 && !flags.lint {
+		return fmt.Errorf("--lint-eku requires --lint")
+	}
+	_, err := lintExtKeyUsages()
+	return err
+}
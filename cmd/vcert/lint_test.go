@@ -0,0 +1,60 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+func TestLintCertificateClock(t *testing.T) {
+	defer func() {
+		flags.maxBackdate = 0
+		flags.clockSkewError = false
+	}()
+	pcc := &certificate.PEMCollection{Certificate: cert}
+
+	validity, err := lintCertificate(pcc)
+	if err != nil || validity != nil {
+		t.Fatalf("expected no check without clock options, got %v, %v", validity, err)
+	}
+
+	flags.maxBackdate = 3600
+	flags.clockSkewError = true
+	validity, err = lintCertificate(pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validity == nil || validity.NotBeforeOffset >= 0 || validity.MaxBackdate != 3600 {
+		t.Fatalf("unexpected validity %+v", validity)
+	}
+
+	b, err := (&Output{Certificate: cert, Validity: validity}).Format(&Config{Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]json.RawMessage
+	if err = json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out["Validity"]), `"NotBeforeOffset":-`) {
+		t.Errorf("expected the validity in the JSON output, got %s", b)
+	}
+}
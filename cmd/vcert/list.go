@@ -0,0 +1,142 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/inventory"
+)
+
+func doCommandList(c *cli.Context) error {
+	err := validateListFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	q := inventory.Query{Name: flags.commonName, WithExpired: flags.withExpired}
+	if flags.expiringWithin != "" {
+		q.ExpiringWithin, err = inventory.ParseDuration(flags.expiringWithin)
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+
+	var infos []certificate.CertificateInfo
+	if flags.inventoryCache != "" {
+		infos, err = listCache(c, q, now)
+	} else {
+		infos, err = listPlatform(c, q, now)
+	}
+	if err != nil {
+		return err
+	}
+	if flags.sortBy != "" {
+		err = inventory.SortCertificates(infos, flags.sortBy)
+		if err != nil {
+			return err
+		}
+	}
+	if flags.credFormat == "json" {
+		if infos == nil {
+			infos = []certificate.CertificateInfo{}
+		}
+		return outputJSON(infos)
+	}
+	printCertificateInfos(infos)
+	return nil
+}
+
+// listPlatform lists the certificates of the zone selected by q
+func listPlatform(c *cli.Context, q inventory.Query, now time.Time) ([]certificate.CertificateInfo, error) {
+	connector, err := listConnector(c)
+	if err != nil {
+		return nil, err
+	}
+	all, err := connector.ListCertificates(endpoint.Filter{WithExpired: q.WithExpired})
+	if err != nil {
+		return nil, err
+	}
+	var infos []certificate.CertificateInfo
+	for _, info := range all {
+		if q.Matches(info, now) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// listCache syncs the cache with the zone, unless --local is set, and queries it
+func listCache(c *cli.Context, q inventory.Query, now time.Time) ([]certificate.CertificateInfo, error) {
+	cache, err := inventory.OpenCache(flags.inventoryCache)
+	if err != nil {
+		return nil, err
+	}
+	defer cache.Close()
+	ctx := context.Background()
+	if flags.local {
+		synced, err := cache.LastSync(ctx, inventory.SourcePlatform)
+		if err != nil {
+			return nil, err
+		}
+		if synced.IsZero() {
+			logf("The inventory was never synced to %s", flags.inventoryCache)
+		} else {
+			logf("Listing the inventory synced on %s", synced.Format(time.RFC3339))
+		}
+	} else {
+		connector, err := listConnector(c)
+		if err != nil {
+			return nil, err
+		}
+		result, err := cache.Sync(ctx, connector)
+		if err != nil {
+			return nil, err
+		}
+		logf("Synced the inventory to %s: %d added, %d updated, %d removed, %d unchanged", flags.inventoryCache,
+			result.Added, result.Updated, result.Removed, result.Unchanged)
+	}
+	return cache.Certificates(ctx, q, now)
+}
+
+func listConnector(c *cli.Context) (endpoint.Connector, error) {
+	err := setTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+	return vcert.NewClient(&cfg)
+}
+
+func printCertificateInfos(infos []certificate.CertificateInfo) {
+	for _, info := range infos {
+		names := append(append([]string(nil), info.SANS.DNS...), info.SANS.IP...)
+		fmt.Printf("%s  %s  expires %s  %s\n", info.Thumbprint, info.CN, info.ValidTo.Format(time.RFC3339),
+			strings.Join(names, ","))
+	}
+}
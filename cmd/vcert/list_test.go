@@ -0,0 +1,67 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/inventory"
+)
+
+func TestListLocalCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vcertList")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "inventory.db")
+
+	now := time.Now()
+	infos := make([]certificate.CertificateInfo, 2)
+	infos[0].ID, infos[0].CN, infos[0].Thumbprint = "cert-0", "www.example.com", "A1"
+	infos[0].ValidTo = now.Add(90 * 24 * time.Hour)
+	infos[1].ID, infos[1].CN, infos[1].Thumbprint = "cert-1", "old.example.com", "B2"
+	infos[1].ValidTo = now.Add(-24 * time.Hour)
+	cache, err := inventory.OpenCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cache.Replace(context.Background(), inventory.SourcePlatform, infos, now)
+	cache.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, stdout := runCommand(t, "list", "--cache", path, "--local", "--format", "json")
+	if status != exitSuccess {
+		t.Fatalf("expected exit code %d, got %d", exitSuccess, status)
+	}
+	var listed []certificate.CertificateInfo
+	if err := json.Unmarshal([]byte(stdout), &listed); err != nil {
+		t.Fatalf("the output isn't JSON: %s: %s", err, stdout)
+	}
+	if len(listed) != 1 || listed[0].ID != "cert-0" || listed[0].CN != "www.example.com" {
+		t.Fatalf("expected only the valid certificate, got %s", stdout)
+	}
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4/pkg/hmacauth"
+	"github.com/Venafi/vcert/v4/pkg/playbook"
+	"github.com/Venafi/vcert/v4/pkg/rbac"
+	"github.com/Venafi/vcert/v4/pkg/webhook"
+)
+
+func doCommandListen(c *cli.Context) error {
+	err := validateListenFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	secret, err := readPasswordsFromInputFlag(flags.webhookSecret, 0)
+	if err != nil {
+		return err
+	}
+	pb, err := playbook.Load(flags.playbookFile)
+	if err != nil {
+		return err
+	}
+	var policy *rbac.Policy
+	if flags.rbacFile != "" {
+		policy, err = rbac.Load(flags.rbacFile)
+		if err != nil {
+			return err
+		}
+	}
+	runner := playbook.NewRunner(pb)
+	runner.Log = logf
+	if flags.checkpointFile != "" {
+		runner.Checkpoint, err = playbook.LoadCheckpoint(flags.checkpointFile)
+		if err != nil {
+			return err
+		}
+	}
+	l := &webhook.Listener{
+		Secret: []byte(secret),
+		Action: func(ctx context.Context, n webhook.Notification) error {
+			return runNotification(ctx, runner, policy, n)
+		},
+		Log: logf,
+	}
+	if flags.replayProtection {
+		l.Verifier = &hmacauth.Verifier{Secret: []byte(secret)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", l.Health())
+	mux.Handle("/", l)
+	server := &http.Server{Addr: flags.listenAddress, Handler: mux}
+	if flags.clientCAFile != "" {
+		server.TLSConfig, err = clientAuthTLSConfig(flags.clientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+	go func() {
+		<-stop
+		cancel()
+		_ = server.Close()
+	}()
+	go l.Run(ctx)
+	if flags.tlsCertFile != "" {
+		logf("Listening for notifications on https://%s", flags.listenAddress)
+		err = server.ListenAndServeTLS(flags.tlsCertFile, flags.tlsKeyFile)
+	} else {
+		logf("Listening for notifications on http://%s", flags.listenAddress)
+		err = server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// runNotification runs the certificate task a notification is about, the checkpoint is saved afterwards so the
+// pickup IDs of the requests still pending are known to the next notifications. With a policy, the client of the
+// notification must be allowed to enroll into the zone of the task.
+func runNotification(ctx context.Context, runner *playbook.Runner, policy *rbac.Policy, n webhook.Notification) error {
+	switch n.Event {
+	case webhook.EventExpiring, webhook.EventApproved, webhook.EventIssued:
+	default:
+		return webhook.ErrIgnored
+	}
+	task := notificationTask(runner.Playbook, runner.Checkpoint, n)
+	if task == "" {
+		return webhook.ErrIgnored
+	}
+	if policy != nil {
+		err := policy.Authorize(n.ClientIdentities, taskZone(runner.Playbook, task))
+		if err != nil {
+			return err
+		}
+	}
+	err := runner.RunTask(ctx, task)
+	if runner.Checkpoint != nil {
+		if cpErr := writeListenCheckpoint(runner.Checkpoint); cpErr != nil {
+			logf("%s", cpErr)
+		}
+	}
+	return err
+}
+
+// notificationTask returns the name of the certificate task of the notification, found by its name, by the pickup ID
+// of its pending request or by the common name or a DNS name of its request. It's empty when there's none.
+func notificationTask(pb *playbook.Playbook, cp *playbook.Checkpoint, n webhook.Notification) string {
+	for _, task := range pb.CertificateTasks {
+		if n.Task != "" && task.Name == n.Task {
+			return task.Name
+		}
+	}
+	if n.PickupID != "" && cp != nil {
+		for name, pending := range cp.Pending {
+			if pending.PickupID == n.PickupID {
+				return name
+			}
+		}
+	}
+	if n.CommonName == "" {
+		return ""
+	}
+	for _, task := range pb.CertificateTasks {
+		if strings.EqualFold(task.Request.Subject.CommonName, n.CommonName) {
+			return task.Name
+		}
+		for _, dns := range task.Request.SANs.DNS {
+			if strings.EqualFold(dns, n.CommonName) {
+				return task.Name
+			}
+		}
+	}
+	return ""
+}
+
+func taskZone(pb *playbook.Playbook, name string) string {
+	for _, task := range pb.CertificateTasks {
+		if task.Name == name {
+			return task.Request.Zone
+		}
+	}
+	return ""
+}
+
+// clientAuthTLSConfig requires the clients to present a certificate issued by a CA of the PEM file path
+func clientAuthTLSConfig(path string) (*tls.Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CAs: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in client CAs file %s", path)
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
+
+func writeListenCheckpoint(cp *playbook.Checkpoint) error {
+	if cp.Empty() {
+		err := os.Remove(flags.checkpointFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove checkpoint: %s", err)
+		}
+		return nil
+	}
+	err := cp.WriteFile(flags.checkpointFile)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/playbook"
+	"github.com/Venafi/vcert/v4/pkg/rbac"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+	"github.com/Venafi/vcert/v4/pkg/webhook"
+)
+
+func TestNotificationTask(t *testing.T) {
+	pb := &playbook.Playbook{CertificateTasks: []playbook.CertificateTask{{Name: "web"}, {Name: "api"}}}
+	pb.CertificateTasks[0].Request.Subject.CommonName = "www.example.com"
+	pb.CertificateTasks[1].Request.SANs.DNS = []string{"api.example.com"}
+	cp := &playbook.Checkpoint{Pending: map[string]*playbook.PendingRequest{"api": {PickupID: `\VED\Policy\api`}}}
+
+	cases := []struct {
+		n    webhook.Notification
+		task string
+	}{
+		{webhook.Notification{Event: webhook.EventExpiring, Task: "api"}, "api"},
+		{webhook.Notification{Event: webhook.EventExpiring, Task: "unknown"}, ""},
+		{webhook.Notification{Event: webhook.EventApproved, PickupID: `\VED\Policy\api`}, "api"},
+		{webhook.Notification{Event: webhook.EventApproved, PickupID: `\VED\Policy\other`}, ""},
+		{webhook.Notification{Event: webhook.EventExpiring, CommonName: "WWW.example.com"}, "web"},
+		{webhook.Notification{Event: webhook.EventExpiring, CommonName: "api.example.com"}, "api"},
+		{webhook.Notification{Event: webhook.EventExpiring}, ""},
+	}
+	for _, c := range cases {
+		if task := notificationTask(pb, cp, c.n); task != c.task {
+			t.Errorf("expected task %q for %+v, got %q", c.task, c.n, task)
+		}
+	}
+	if task := notificationTask(pb, nil, cases[2].n); task != "" {
+		t.Errorf("expected no task without checkpoint, got %q", task)
+	}
+}
+
+func TestRunNotificationRBAC(t *testing.T) {
+	pb := &playbook.Playbook{CertificateTasks: []playbook.CertificateTask{{Name: "db"}}}
+	pb.CertificateTasks[0].Request.Zone = `DevOps\Databases`
+	policy, err := rbac.Parse([]byte("rules:\n  - identities: [web.example.com]\n    zones: [\"DevOps\\\\Web\"]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := webhook.Notification{Event: webhook.EventExpiring, Task: "db", ClientIdentities: []string{"web.example.com"}}
+	err = runNotification(context.Background(), playbook.NewRunner(pb), policy, n)
+	if !errors.Is(err, verror.AuthError) {
+		t.Fatalf("expected the client to be denied the zone, got %v", err)
+	}
+}
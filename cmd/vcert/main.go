@@ -31,6 +31,8 @@ var (
 	logger = log.New(os.Stderr, UtilityShortName+": ", log.LstdFlags)
 	logf   = logger.Printf
 	exit   = os.Exit
+	// exitStatus is the exit code used when main panics, it's set from the error of the command
+	exitStatus = exitFailure
 )
 
 // UtilityName is the full name of the command-line utility
@@ -49,8 +51,8 @@ func main() {
 			// so we use logger.Panic() and do recover() here to hide stacktrace
 			// exit() is a function to decide what to do
 
-			exit(1)  // it's os.Exit() by default, but can be overridden
-			panic(r) // so that panic() bubbling continues (it's needed when we call main() from cli_test.go)
+			exit(exitStatus) // it's os.Exit() by default, but can be overridden
+			panic(r)         // so that panic() bubbling continues (it's needed when we call main() from cli_test.go)
 
 		}
 	}()
@@ -70,11 +72,41 @@ func main() {
 			commandPickup,
 			commandRenew,
 			commandRevoke,
+			commandCancel,
 			commandCreatePolicy,
 			commandGetPolicy,
+			commandPolicy,
+			commandContacts,
+			commandApplications,
+			commandSign,
 			commandSshPickup,
 			commandSshEnroll,
 			commandSshGetConfig,
+			commandStatus,
+			commandRun,
+			commandExport,
+			commandList,
+			commandLineage,
+			commandBlastRadius,
+			commandAudit,
+			commandMetrics,
+			commandCAHierarchy,
+			commandListen,
+			commandService,
+			commandValidateConfig,
+			commandBackup,
+			commandRestore,
+			commandInspect,
+			commandConvert,
+			commandCleanup,
+			commandController,
+			commandSDS,
+			commandBootstrap,
+			commandDevice,
+			commandTimestamp,
+			commandOfflineRequest,
+			commandOfflineSubmit,
+			commandOfflineImport,
 		},
 		EnableBashCompletion: true, //todo: write BashComplete function for options
 		//HideHelp:             true,
@@ -101,13 +133,46 @@ ACTIONS:
    pickup       To retrieve a certificate
    renew        To renew a certificate
    revoke       To revoke a certificate
+   cancel       To cancel a certificate request that wasn't retrieved
+   sign         To sign a CSR read from the standard input
 
    getpolicy    To retrieve the certificate policy of a zone
    setpolicy    To apply a certificate policy specification to a zone
+   policy diff  To compare the certificate policies of two zones
+   policy apply To apply a certificate policy specification to many zones
+   contacts     To get or change the contacts owning a certificate or a zone
+   applications To list or change the applications a certificate is associated with
 
    getcred      To obtain a new TPP authentication token or register for a new VaaS user API key
    checkcred    To check the validity of a token and grant
    voidcred     To invalidate an authentication grant
+   status       To check the health of the connection to a Venafi endpoint
+   validate-config To check a config file or a playbook
+   export       To export the certificate inventory of a zone
+   list         To list the certificate inventory of a zone, or of a local copy of it
+   lineage      To show the certificates a certificate renewed and the ones that renewed it
+   blastradius  To find and revoke the certificates sharing the key or the name of a compromised certificate
+   audit        To report the weak keys and deprecated algorithms of the certificates of a zone and of TLS endpoints
+   metrics      To serve certificate expiry metrics for Prometheus
+   cahierarchy  To show the CA hierarchy of a zone and the expiry of its CAs
+   backup       To store a certificate and its private key in an encrypted local vault
+   restore      To list or restore the certificates of an encrypted local vault
+   inspect      To print the details of certificate, request and key files
+   convert      To convert certificates and keys between PEM, DER, PKCS#7, PKCS#12, JKS and OpenSSH
+
+   run          To keep the certificates of a playbook enrolled and installed
+   listen       To run the tasks of a playbook on the notifications of the platform
+   service      To install, uninstall, start or stop the renewals as a Windows service or launchd daemon
+   cleanup      To clean up the pending requests and lock files a playbook left behind
+   controller   To keep the TLS secrets of annotated Kubernetes Ingresses and Gateways issued
+   sds          To serve certificates to Envoy proxies and Istio sidecars with the Secret Discovery Service
+   bootstrap    To issue the server, peer and client certificates of an etcd or Redis cluster
+   device       To enroll, renew and install the identity certificate of a workstation for 802.1X EAP-TLS
+   timestamp    To request or verify an RFC 3161 time-stamp token of a file, e.g. a signature
+
+   offlinerequest To prepare an enrollment request on an air-gapped host
+   offlinesubmit  To submit an offline enrollment request from a connected network
+   offlineimport  To import the certificate of an offline enrollment response
 
    sshenroll    To enroll a SSH certificate
    sshpickup    To retrieve a SSH certificate
@@ -144,6 +209,10 @@ OPTIONS:
 	if err != nil {
 		//TODO: we need to make logger a global package
 		logger := log.New(os.Stderr, UtilityShortName+": ", log.LstdFlags)
+		exitStatus = exitCode(err)
+		if flags.format == "json" || flags.credFormat == "json" {
+			_ = outputJSON(newErrorOutput(err))
+		}
 		logger.Panicf("%s", err)
 	}
 }
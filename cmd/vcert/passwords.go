@@ -20,12 +20,19 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"os/exec"
 	"regexp"
+	"runtime"
 	"strings"
 
 	"github.com/howeyc/gopass"
+
+	"github.com/Venafi/vcert/v4/pkg/util"
 )
 
+// keyPasswordAuto is the --key-password value generating a random password
+const keyPasswordAuto = "auto"
+
 func readPasswordsFromInputFlags(commandName string, cf *commandFlags) error {
 	lineIndex := 0
 
@@ -60,7 +67,7 @@ func readPasswordsFromInputFlags(commandName string, cf *commandFlags) error {
 
 	cloudSerViceGenerated := IsCSRServiceVaaSGenerated(commandName)
 
-	if commandName == commandSshPickupName || commandName == commandSshEnrollName || commandName == commandEnrollName || commandName == commandGenCSRName || commandName == commandRenewName || commandName == commandPickupName && (cf.format == "pkcs12" || cf.format == JKSFormat || cloudSerViceGenerated) {
+	if commandName == commandSshPickupName || commandName == commandSshEnrollName || commandName == commandEnrollName || commandName == commandGenCSRName || commandName == commandOfflineRequestName || commandName == commandRenewName || commandName == commandPickupName && (cf.format == "pkcs12" || cf.format == JKSFormat || cloudSerViceGenerated) {
 		var keyPasswordNotNeeded = false
 
 		keyPasswordNotNeeded = keyPasswordNotNeeded || (cf.csrOption == "service" && cf.noPickup)
@@ -79,20 +86,11 @@ func readPasswordsFromInputFlags(commandName string, cf *commandFlags) error {
 
 		if !keyPasswordNotNeeded {
 			if cf.keyPassword == "" && !cf.noPrompt {
-				fmt.Printf("Enter key passphrase:")
-				input, err := gopass.GetPasswdMasked()
-				if err != nil {
-					return err
-				}
-				fmt.Printf("Verifying - Enter key passphrase:")
-				verify, err := gopass.GetPasswdMasked()
+				input, err := promptKeyPassword()
 				if err != nil {
 					return err
 				}
-				if !doValuesMatch(input, verify) {
-					return fmt.Errorf("Passphrases don't match")
-				}
-				cf.keyPassword = string(input)
+				cf.keyPassword = input
 			} else if cf.keyPassword == "" && cf.noPrompt && commandName == commandPickupName {
 				//TODO: cover with test
 				return fmt.Errorf("key password must be provided")
@@ -109,6 +107,24 @@ func readPasswordsFromInputFlags(commandName string, cf *commandFlags) error {
 	return nil
 }
 
+// promptKeyPassword asks twice for the passphrase encrypting a private key
+func promptKeyPassword() (string, error) {
+	fmt.Printf("Enter key passphrase:")
+	input, err := gopass.GetPasswdMasked()
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Verifying - Enter key passphrase:")
+	verify, err := gopass.GetPasswdMasked()
+	if err != nil {
+		return "", err
+	}
+	if !doValuesMatch(input, verify) {
+		return "", fmt.Errorf("Passphrases don't match")
+	}
+	return string(input), nil
+}
+
 func readPasswordsFromInputFlag(flagVar string, index int) (string, error) {
 	reg := regexp.MustCompile("^(?:F|f)(?:I|i)(?:L|l)(?:E|e):(?P<value>.*?$)")
 	groups := reg.SubexpNames()
@@ -152,3 +168,60 @@ func readPasswordFromFile(path string, index int) (string, error) {
 	}
 	return lines[index], nil
 }
+
+// generateKeyPassword sets a random key password, which must be saved by the password file or command as nobody
+// gets to see it
+func generateKeyPassword(commandName string, cf *commandFlags) error {
+	switch commandName {
+	case commandEnrollName, commandPickupName, commandRenewName, commandGenCSRName:
+	default:
+		return fmt.Errorf("--key-password auto is not supported by %s", commandName)
+	}
+	if cf.keyPasswordFile == "" && cf.keyPasswordCommand == "" {
+		return fmt.Errorf("--key-password auto requires --key-password-file or --key-password-command to save the password")
+	}
+	password, err := util.GeneratePassword(util.PasswordPolicy{Length: cf.keyPasswordLength, Charset: cf.keyPasswordCharset})
+	if err != nil {
+		return err
+	}
+	cf.keyPassword = password
+	return nil
+}
+
+// saveKeyPassword writes a generated key password to the password file and the password command, it's done
+// before the key is written so a key is never left without its password
+func saveKeyPassword(cfg *Config) error {
+	if cfg.KeyPasswordFile != "" {
+		f, err := os.OpenFile(cfg.KeyPasswordFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to write key password: %s", err)
+		}
+		// the file may have existed with a looser mode
+		err = f.Chmod(0600)
+		if err == nil {
+			_, err = f.WriteString(cfg.KeyPassword + "\n")
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write key password: %s", err)
+		}
+	}
+	if cfg.KeyPasswordCommand != "" {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", cfg.KeyPasswordCommand)
+		} else {
+			cmd = exec.Command("sh", "-c", cfg.KeyPasswordCommand)
+		}
+		cmd.Stdin = strings.NewReader(cfg.KeyPassword)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("key password command failed: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSaveKeyPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vcert-key-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "key.pwd")
+	err = ioutil.WriteFile(file, []byte("old password, long enough to be truncated\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cf := &commandFlags{keyPassword: keyPasswordAuto, keyPasswordFile: file}
+	err = generateKeyPassword(commandEnrollName, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cf.keyPassword == keyPasswordAuto || len(cf.keyPassword) != 24 {
+		t.Fatalf("expected a generated password, got %q", cf.keyPassword)
+	}
+	err = saveKeyPassword(&Config{KeyPassword: cf.keyPassword, KeyPasswordFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != cf.keyPassword+"\n" {
+		t.Fatalf("expected the password file to hold %q, got %q", cf.keyPassword, data)
+	}
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(file)
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("expected the password file mode to be 0600, got %v", info.Mode().Perm())
+		}
+	}
+
+	err = generateKeyPassword(commandEnrollName, &commandFlags{keyPassword: keyPasswordAuto})
+	if err == nil {
+		t.Fatal("expected an error when the password isn't saved")
+	}
+	err = generateKeyPassword(commandRevokeName, &commandFlags{keyPassword: keyPasswordAuto, keyPasswordFile: file})
+	if err == nil {
+		t.Fatal("expected an error for a command writing no key")
+	}
+}
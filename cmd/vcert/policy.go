@@ -0,0 +1,128 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/policy"
+)
+
+type policyDiffReport struct {
+	ZoneA       string              `json:"zoneA"`
+	ZoneB       string              `json:"zoneB"`
+	Differences []policy.Difference `json:"differences"`
+}
+
+func (r *policyDiffReport) print() {
+	fmt.Println("--- a:", r.ZoneA)
+	fmt.Println("+++ b:", r.ZoneB)
+	if len(r.Differences) == 0 {
+		fmt.Println("policies are identical")
+		return
+	}
+	for _, d := range r.Differences {
+		fmt.Println(d)
+	}
+}
+
+// diffZonePolicies retrieves the policies of zones a and b and compares them
+func diffZonePolicies(connector endpoint.Connector, a, b string) (*policyDiffReport, error) {
+	psA, err := connector.GetPolicy(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the policy of zone %q: %w", a, err)
+	}
+	psB, err := connector.GetPolicy(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the policy of zone %q: %w", b, err)
+	}
+	return &policyDiffReport{
+		ZoneA:       a,
+		ZoneB:       b,
+		Differences: policy.Diff(psA, psB),
+	}, nil
+}
+
+// parsePolicySpecification parses a policy specification in the format of its file extension
+func parsePolicySpecification(data []byte, fileExt string) (*policy.PolicySpecification, error) {
+	ps := &policy.PolicySpecification{}
+	var err error
+	switch fileExt {
+	case policy.JsonExtension:
+		err = json.Unmarshal(data, ps)
+	case policy.YamlExtension:
+		err = yaml.Unmarshal(data, ps)
+	default:
+		return nil, fmt.Errorf("the specified file is not supported")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// policyApplyZones returns the zones of --zone, --zones-file and --zone-pattern, without duplicates
+func policyApplyZones(connector endpoint.Connector) ([]string, error) {
+	zones := append([]string(nil), flags.policyZones...)
+	if flags.policyZonesFile != "" {
+		f, err := os.Open(flags.policyZonesFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		listed, err := policy.ReadZones(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zones file %s: %s", flags.policyZonesFile, err)
+		}
+		zones = append(zones, listed...)
+	}
+	if flags.policyZonePattern != "" {
+		matched, err := policy.MatchZones(connector, flags.policyZonePattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			logf("No zone matches %s", flags.policyZonePattern)
+		}
+		zones = append(zones, matched...)
+	}
+
+	seen := make(map[string]bool)
+	unique := zones[:0]
+	for _, zone := range zones {
+		if !seen[zone] {
+			seen[zone] = true
+			unique = append(unique, zone)
+		}
+	}
+	return unique, nil
+}
+
+func printBulkResults(results []policy.BulkResult) {
+	for _, r := range results {
+		if r.Error != "" {
+			fmt.Printf("%s: %s: %s\n", r.Zone, r.Status, r.Error)
+		} else {
+			fmt.Printf("%s: %s\n", r.Zone, r.Status)
+		}
+	}
+}
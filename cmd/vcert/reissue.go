@@ -0,0 +1,93 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/inspect"
+)
+
+// reissueRequest builds the request of enroll --reissue-from or --reissue-from-id: the subject, the SANs and the key
+// parameters of the existing certificate, with the SANs of the --san-* options added, the ones of --remove-san
+// removed, and the other options applied like for any enrollment
+func reissueRequest(connector endpoint.Connector, cf *commandFlags) (*certificate.Request, error) {
+	cert, err := loadReissuedCertificate(connector, cf)
+	if err != nil {
+		return nil, err
+	}
+	b := certificate.NewRequestBuilderFrom(cert)
+	if cf.commonName != "" {
+		b.CommonName(cf.commonName)
+	}
+	b.DNSNames(cf.dnsSans...).
+		IPAddresses(cf.ipSans...).
+		EmailAddresses(cf.emailSans...).
+		UPNs(cf.upnSans...)
+	for _, u := range cf.uriSans {
+		b.URIs(u.String())
+	}
+	b.RemoveSANs(cf.removeSans...)
+	req, err := b.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reissue %s: %w", cert.Subject, err)
+	}
+
+	// the SANs are merged already, the other options replace the values of the certificate
+	rest := *cf
+	rest.dnsSans, rest.emailSans, rest.upnSans = nil, nil, nil
+	rest.ipSans, rest.uriSans = nil, nil
+	return fillCertificateRequest(req, &rest), nil
+}
+
+// loadReissuedCertificate reads the certificate to reissue from its file, or retrieves it from the platform
+func loadReissuedCertificate(connector endpoint.Connector, cf *commandFlags) (*x509.Certificate, error) {
+	if cf.reissueFromID != "" {
+		pcc, err := connector.RetrieveCertificate(&certificate.Request{
+			PickupID:    cf.reissueFromID,
+			ChainOption: certificate.ChainOptionIgnore,
+			Timeout:     time.Duration(cf.timeout) * time.Second,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve the certificate to reissue: %s", err)
+		}
+		block, _ := pem.Decode([]byte(pcc.Certificate))
+		if block == nil {
+			return nil, fmt.Errorf("failed to decode the certificate to reissue")
+		}
+		return x509.ParseCertificate(block.Bytes)
+	}
+	data, err := ioutil.ReadFile(cf.reissueFrom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the certificate to reissue: %s", err)
+	}
+	contents, err := inspect.Decode(data, "")
+	if err != nil {
+		return nil, err
+	}
+	chain := contents.Chain()
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s holds no certificate to reissue", cf.reissueFrom)
+	}
+	return chain[0], nil
+}
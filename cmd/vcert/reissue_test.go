@@ -0,0 +1,87 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+func TestReissueRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "www.example.com", Organization: []string{"Example"}},
+		DNSNames:     []string{"www.example.com", "old.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "reissue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cert.pem")
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cf := &commandFlags{
+		reissueFrom: path,
+		org:         "Example Corp",
+		dnsSans:     stringSlice{"new.example.com"},
+		removeSans:  stringSlice{"old.example.com"},
+	}
+	req, err := reissueRequest(nil, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Subject.CommonName != "www.example.com" || req.Subject.Organization[0] != "Example Corp" {
+		t.Fatalf("unexpected subject %v", req.Subject)
+	}
+	if len(req.DNSNames) != 2 || req.DNSNames[0] != "www.example.com" || req.DNSNames[1] != "new.example.com" {
+		t.Fatalf("unexpected DNS names %v", req.DNSNames)
+	}
+	if req.KeyType != certificate.KeyTypeECDSA || req.KeyCurve != certificate.EllipticCurveP384 {
+		t.Fatalf("expected the key parameters of the certificate, got %s %s", req.KeyType.String(), req.KeyCurve.String())
+	}
+
+	cf.removeSans = stringSlice{"missing.example.com"}
+	if _, err = reissueRequest(nil, cf); err == nil {
+		t.Fatal("removing a SAN the certificate doesn't have should fail")
+	}
+}
@@ -49,20 +49,40 @@ type Config struct {
 	PickupIdFile string
 
 	KeyPassword string
+	// KeyPasswordFile and KeyPasswordCommand save a generated KeyPassword
+	KeyPasswordFile    string
+	KeyPasswordCommand string
 }
 
 type Result struct {
 	Pcc      *certificate.PEMCollection
 	PickupId string
 	Config   *Config
+	Validity *Validity
+	// Warnings are written with the JSON format
+	Warnings []certificate.Warning
 }
 
 type Output struct {
-	Certificate string   `json:",omitempty"`
-	CSR         string   `json:",omitempty"`
-	PrivateKey  string   `json:",omitempty"`
-	Chain       []string `json:",omitempty"`
-	PickupId    string   `json:",omitempty"`
+	Certificate string                `json:",omitempty"`
+	CSR         string                `json:",omitempty"`
+	PrivateKey  string                `json:",omitempty"`
+	Chain       []string              `json:",omitempty"`
+	PickupId    string                `json:",omitempty"`
+	Validity    *Validity             `json:",omitempty"`
+	Warnings    []certificate.Warning `json:",omitempty"`
+}
+
+// Validity is the validity of the issued certificate against the local clock, written with the JSON format when it's
+// checked by --lint or --clock-skew
+type Validity struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+	LocalTime time.Time
+	// NotBeforeOffset is how many seconds NotBefore is after LocalTime, negative when the certificate is backdated
+	NotBeforeOffset    int64
+	ClockSkewTolerance int
+	MaxBackdate        int `json:",omitempty"`
 }
 
 func (o *Output) AsPKCS12(c *Config) ([]byte, error) {
@@ -303,6 +323,13 @@ func (r *Result) Flush() error {
 		return fmt.Errorf("couldn't construct output: certificate collection is null")
 	}
 
+	if r.Pcc.PrivateKey != "" {
+		err = saveKeyPassword(r.Config)
+		if err != nil {
+			return err
+		}
+	}
+
 	stdOut := &Output{}
 
 	if r.Config.AllFile != "" {
@@ -311,6 +338,8 @@ func (r *Result) Flush() error {
 		allFileOutput.Certificate = r.Pcc.Certificate
 		allFileOutput.Chain = r.Pcc.Chain
 		allFileOutput.CSR = r.Pcc.CSR
+		allFileOutput.Validity = r.Validity
+		allFileOutput.Warnings = r.Warnings
 
 		var bytes []byte
 		if r.Config.Format == "pkcs12" {
@@ -384,6 +413,11 @@ func (r *Result) Flush() error {
 		}
 	}
 
+	if r.Config.AllFile == "" {
+		stdOut.Validity = r.Validity
+		stdOut.Warnings = r.Warnings
+	}
+
 	// and flush the rest to STDOUT
 	bytes, err := stdOut.Format(r.Config)
 	if err != nil {
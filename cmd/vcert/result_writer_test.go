@@ -134,7 +134,11 @@ func TestPKCS12withEncPK(t *testing.T) {
 			"",
 			"",
 			"asdf",
+			"",
+			"",
 		},
+		nil,
+		nil,
 	}
 	err := result.Flush()
 
@@ -164,7 +168,11 @@ func TestPKCS12withPlainPK(t *testing.T) {
 			"",
 			"",
 			"",
+			"",
+			"",
 		},
+		nil,
+		nil,
 	}
 	err := result.Flush()
 
@@ -194,7 +202,11 @@ func TestPKCS12withPlainEcPK(t *testing.T) {
 			"",
 			"",
 			"",
+			"",
+			"",
 		},
+		nil,
+		nil,
 	}
 	err := result.Flush()
 
@@ -224,7 +236,11 @@ func TestJKSWithEncPKWithoutJKSPass(t *testing.T) {
 			"",
 			"",
 			"password",
+			"",
+			"",
 		},
+		nil,
+		nil,
 	}
 	err := result.Flush()
 
@@ -254,7 +270,11 @@ func TestJKSWithEncPKAndJKSPass(t *testing.T) {
 			"",
 			"",
 			"password",
+			"",
+			"",
 		},
+		nil,
+		nil,
 	}
 	err := result.Flush()
 
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/sds"
+)
+
+func doCommandSDS(c *cli.Context) error {
+	err := validateSDSFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	err = setTLSConfig()
+	if err != nil {
+		return err
+	}
+	cfg, err := buildConfig(c, &flags)
+	if err != nil {
+		return fmt.Errorf("Failed to build vcert config: %w", err)
+	}
+	connector, err := vcert.NewClient(&cfg)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to %s: %w", cfg.ConnectorType, err)
+	}
+	logf("Successfully connected to %s", cfg.ConnectorType)
+
+	s := &sds.Server{
+		Connector: connector,
+		Request:   sdsRequest,
+		Log:       logf,
+	}
+	server := &http.Server{Handler: s}
+	if flags.clientCAFile != "" {
+		server.TLSConfig, err = clientAuthTLSConfig(flags.clientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+	ln, err := sdsListener(flags.listenAddress)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		<-stop
+		cancel()
+		_ = server.Close()
+	}()
+	go s.Run(ctx, sds.DefaultCheckInterval)
+
+	logf("Serving the Secret Discovery Service on %s", flags.listenAddress)
+	err = server.ServeTLS(ln, flags.tlsCertFile, flags.tlsKeyFile)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// sdsRequest returns the request of the certificate of a secret: the identity of the options for the default one,
+// the DNS name of a --secret-name for the others
+func sdsRequest(name string) (*certificate.Request, error) {
+	cf := flags
+	if name == sds.DefaultSecretName {
+		if cf.commonName == "" && len(cf.dnsSans) == 0 && len(cf.uriSans) == 0 {
+			return nil, nil
+		}
+		return fillCertificateRequest(&certificate.Request{}, &cf), nil
+	}
+	for _, secretName := range cf.sdsSecrets {
+		if secretName == name {
+			cf.commonName = name
+			cf.dnsSans = stringSlice{name}
+			cf.ipSans, cf.emailSans, cf.uriSans, cf.upnSans = nil, nil, nil, nil
+			return fillCertificateRequest(&certificate.Request{}, &cf), nil
+		}
+	}
+	return nil, nil
+}
+
+// sdsListener listens on a TCP address or, with the unix: prefix, on a Unix socket replacing the one a previous
+// server left behind
+func sdsListener(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		return net.Listen("tcp", address)
+	}
+	path := strings.TrimPrefix(address, "unix:")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
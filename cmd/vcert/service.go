@@ -0,0 +1,112 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4/pkg/playbook"
+	"github.com/Venafi/vcert/v4/pkg/service"
+)
+
+func doCommandServiceInstall(c *cli.Context) error {
+	err := validateServiceInstallFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	// the service doesn't start in the current directory
+	path, err := filepath.Abs(flags.playbookFile)
+	if err != nil {
+		return err
+	}
+	_, err = playbook.Load(path)
+	if err != nil {
+		return err
+	}
+	args := []string{commandRunName, "--daemon", "--file", path, "--interval", strconv.Itoa(flags.interval)}
+	if flags.serviceName != "" {
+		args = append(args, "--service-name", flags.serviceName)
+	}
+	err = service.Install(service.Config{
+		Name:        flags.serviceName,
+		DisplayName: "Venafi VCert renewals",
+		Description: "Keeps the certificates of the playbook " + path + " enrolled and installed",
+		Args:        args,
+	})
+	if err != nil {
+		return err
+	}
+	logf("Installed service %s running playbook %s", serviceName(), path)
+	return nil
+}
+
+func doCommandServiceUninstall(c *cli.Context) error {
+	err := service.Uninstall(flags.serviceName)
+	if err != nil {
+		return err
+	}
+	logf("Uninstalled service %s", serviceName())
+	return nil
+}
+
+func doCommandServiceStart(c *cli.Context) error {
+	err := service.Start(flags.serviceName)
+	if err != nil {
+		return err
+	}
+	logf("Started service %s", serviceName())
+	return nil
+}
+
+func doCommandServiceStop(c *cli.Context) error {
+	err := service.Stop(flags.serviceName)
+	if err != nil {
+		return err
+	}
+	logf("Stopped service %s", serviceName())
+	return nil
+}
+
+func serviceName() string {
+	if flags.serviceName == "" {
+		return service.DefaultName
+	}
+	return flags.serviceName
+}
+
+// runService runs the daemon as a Windows service when the service manager started the process, logging to the
+// event log. It returns false when the process isn't a service.
+func runService(d *playbook.Daemon) (bool, error) {
+	return service.Run(flags.serviceName, func(ctx context.Context) error {
+		w, err := service.EventLog(serviceName())
+		if err != nil {
+			logf("failed to open the event log, logging to stderr: %s", err)
+		} else {
+			logger.SetOutput(w)
+			defer w.Close()
+		}
+		err = d.Run(ctx)
+		if err != nil {
+			logf("%s", err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+// stdin is where the sign action reads the CSR from
+var stdin io.Reader = os.Stdin
+
+// readCSR reads a PEM CSR, the text around the PEM block is ignored as openssl prints it
+func readCSR(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CSR: %s", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || !strings.HasSuffix(block.Type, "CERTIFICATE REQUEST") {
+		return nil, fmt.Errorf("no PEM CSR found in the standard input")
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// signCSR requests a certificate for csr and waits up to timeout for it to be issued
+func signCSR(connector endpoint.Connector, req *certificate.Request, csr []byte, timeout time.Duration) (*certificate.PEMCollection, error) {
+	err := req.SetCSR(csr)
+	if err != nil {
+		return nil, err
+	}
+	zoneConfig, err := connector.ReadZoneConfiguration()
+	if err != nil {
+		return nil, err
+	}
+	err = connector.GenerateRequest(zoneConfig, req)
+	if err != nil {
+		return nil, err
+	}
+	req.PickupID, err = connector.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	logf("Successfully posted request, will pick up by %s", req.PickupID)
+	return retrieveCertificate(connector, req, timeout)
+}
+
+// writeSignedCertificate writes the certificate and its chain, in the order of chainOption
+func writeSignedCertificate(w io.Writer, pcc *certificate.PEMCollection, chainOption certificate.ChainOption) error {
+	certs := []string{pcc.Certificate}
+	switch chainOption {
+	case certificate.ChainOptionIgnore:
+	case certificate.ChainOptionRootFirst:
+		certs = append(append([]string(nil), pcc.Chain...), pcc.Certificate)
+	default:
+		certs = append(certs, pcc.Chain...)
+	}
+	for _, c := range certs {
+		_, err := io.WriteString(w, strings.TrimSpace(c)+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
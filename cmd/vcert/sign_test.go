@@ -0,0 +1,87 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+func TestSignCSR(t *testing.T) {
+	gen := &certificate.Request{KeyType: certificate.KeyTypeECDSA}
+	gen.Subject.CommonName = "www.example.com"
+	gen.DNSNames = []string{"www.example.com"}
+	if err := gen.GeneratePrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gen.GenerateCSR(); err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := readCSR(strings.NewReader("Certificate Request:\n    Data: ...\n" + string(gen.GetCSR())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &certificate.Request{CsrOrigin: certificate.UserProvidedCSR, ChainOption: certificate.ChainOptionRootFirst}
+	pcc, err := signCSR(fake.NewConnector(false, nil), req, csr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = writeSignedCertificate(&out, pcc, req.ChainOption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certs []*x509.Certificate
+	for rest := out.Bytes(); ; {
+		var b *pem.Block
+		b, rest = pem.Decode(rest)
+		if b == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) != len(pcc.Chain)+1 || len(pcc.Chain) == 0 {
+		t.Fatalf("expected the certificate and its chain, got %d certificates", len(certs))
+	}
+	if leaf := certs[len(certs)-1]; leaf.Subject.CommonName != "www.example.com" {
+		t.Fatalf("expected the certificate after the chain, got %s", leaf.Subject)
+	}
+
+	out.Reset()
+	_ = writeSignedCertificate(&out, pcc, certificate.ChainOptionIgnore)
+	if strings.Count(out.String(), "BEGIN CERTIFICATE") != 1 {
+		t.Fatalf("expected only the certificate, got\n%s", out.String())
+	}
+
+	_, err = readCSR(strings.NewReader("not a CSR"))
+	if err == nil {
+		t.Fatal("expected an error without a PEM CSR")
+	}
+}
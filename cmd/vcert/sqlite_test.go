@@ -0,0 +1,58 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/state"
+)
+
+func TestSQLiteStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vcertState")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spec := "sqlite:" + filepath.Join(dir, "state.db")
+
+	ctx := context.Background()
+	s, err := state.Open(spec, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Save(ctx, "checkpoint", []byte("pending"))
+	s.(*state.SQLite).DB.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the state survives a restart
+	s, err = state.Open(spec, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.(*state.SQLite).DB.Close()
+	value, err := s.Load(ctx, "checkpoint")
+	if err != nil || string(value) != "pending" {
+		t.Fatalf("expected %q, got %q, %v", "pending", value, err)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4"
+)
+
+type statusReport struct {
+	Connector     string `json:"connector"`
+	URL           string `json:"url,omitempty"`
+	Reachable     bool   `json:"reachable"`
+	TLSTrusted    bool   `json:"tlsTrusted"`
+	Authenticated bool   `json:"authenticated"`
+	LatencyMs     int64  `json:"latencyMs"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Ready reports whether every check passed
+func (r *statusReport) Ready() bool {
+	return r.Reachable && r.TLSTrusted && r.Authenticated
+}
+
+func (r *statusReport) print() {
+	fmt.Println("connector: ", r.Connector)
+	if r.URL != "" {
+		fmt.Println("url: ", r.URL)
+	}
+	fmt.Println("reachable: ", r.Reachable)
+	fmt.Println("tls_trusted: ", r.TLSTrusted)
+	fmt.Println("authenticated: ", r.Authenticated)
+	fmt.Println("latency: ", time.Duration(r.LatencyMs)*time.Millisecond)
+	if r.Error != "" {
+		fmt.Println("error: ", r.Error)
+	}
+}
+
+// checkStatus runs the health checks against the endpoint described by cfg. The first check is made without
+// credentials so that a failure can be attributed to either the network, the TLS trust or the authentication.
+func checkStatus(cfg *vcert.Config, timeout time.Duration) *statusReport {
+	report := &statusReport{Connector: cfg.ConnectorType.String(), URL: cfg.BaseUrl}
+
+	connector, err := vcert.NewClient(cfg, false)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err = connector.PingContext(ctx)
+	report.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		if isTLSTrustError(err) {
+			report.Reachable = true
+		}
+		report.Error = err.Error()
+		return report
+	}
+	report.Reachable = true
+	report.TLSTrusted = true
+
+	err = connector.Authenticate(cfg.Credentials)
+	if err == nil {
+		err = connector.PingContext(ctx)
+	}
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Authenticated = true
+	return report
+}
+
+func isTLSTrustError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return true
+	}
+	// the connectors don't always keep the transport error in the chain
+	return strings.Contains(err.Error(), "x509: ")
+}
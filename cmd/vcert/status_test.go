@@ -0,0 +1,69 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+func TestCheckStatusFake(t *testing.T) {
+	cfg := &vcert.Config{ConnectorType: endpoint.ConnectorTypeFake}
+	report := checkStatus(cfg, time.Second)
+	if !report.Ready() {
+		t.Fatalf("fake endpoint should be ready: %+v", report)
+	}
+}
+
+func TestCheckStatusTLSTrust(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer good-token" && r.URL.Path != "/vedsdk/" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	cfg := &vcert.Config{
+		ConnectorType: endpoint.ConnectorTypeTPP,
+		BaseUrl:       server.URL,
+		Credentials:   &endpoint.Authentication{AccessToken: "good-token"},
+	}
+	report := checkStatus(cfg, 5*time.Second)
+	if !report.Reachable || report.TLSTrusted || report.Ready() {
+		t.Fatalf("untrusted endpoint should be reachable but not trusted: %+v", report)
+	}
+
+	cfg.ConnectionTrust = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	report = checkStatus(cfg, 5*time.Second)
+	if !report.Ready() {
+		t.Fatalf("trusted endpoint should be ready: %+v", report)
+	}
+
+	cfg.Credentials = &endpoint.Authentication{AccessToken: "bad-token"}
+	report = checkStatus(cfg, 5*time.Second)
+	if !report.TLSTrusted || report.Authenticated {
+		t.Fatalf("bad token should not be authenticated: %+v", report)
+	}
+}
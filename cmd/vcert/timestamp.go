@@ -0,0 +1,177 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4/pkg/timestamp"
+)
+
+func doCommandTimestamp(c *cli.Context) error {
+	files := c.Args().Slice()
+	err := validateTimestampFlags(c.Command.Name, files)
+	if err != nil {
+		return err
+	}
+	hash, _ := timestamp.ParseHash(flags.tsHash)
+	if flags.tsVerify != "" {
+		return verifyTimestamp(files)
+	}
+
+	var req *timestamp.Request
+	if flags.tsDigest != "" {
+		digest, _ := hex.DecodeString(flags.tsDigest)
+		req, err = timestamp.NewDigestRequest(digest, hash)
+	} else {
+		var f *os.File
+		f, err = os.Open(files[0])
+		if err != nil {
+			return err
+		}
+		req, err = timestamp.NewRequest(f, hash)
+		f.Close()
+	}
+	if err != nil {
+		return err
+	}
+	client := &timestamp.Client{URL: flags.tsaURL}
+	token, err := client.Timestamp(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	logf("Successfully time-stamped by %s", flags.tsaURL)
+	if flags.file != "" {
+		err = ioutil.WriteFile(flags.file, token.Raw, 0644)
+		if err != nil {
+			return err
+		}
+		logf("The time-stamp token is in %s", flags.file)
+	} else {
+		_, err = os.Stdout.Write(token.Raw)
+		if err != nil {
+			return err
+		}
+	}
+	printTimestamp(token)
+	return nil
+}
+
+// verifyTimestamp checks the token of --verify is for the file or the digest and signed by a trusted TSA
+func verifyTimestamp(files []string) error {
+	data, err := ioutil.ReadFile(flags.tsVerify)
+	if err != nil {
+		return err
+	}
+	// the token is saved as is or in the reply of the TSA, e.g. by openssl ts -reply
+	token, err := timestamp.ParseToken(data)
+	if err != nil {
+		var respErr error
+		token, respErr = timestamp.ParseResponse(data)
+		if respErr != nil {
+			return fmt.Errorf("%s: %w", flags.tsVerify, err)
+		}
+	}
+
+	var digest []byte
+	if flags.tsDigest != "" {
+		digest, _ = hex.DecodeString(flags.tsDigest)
+	} else {
+		f, err := os.Open(files[0])
+		if err != nil {
+			return err
+		}
+		digest, err = timestamp.Digest(f, token.Hash)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := timestamp.VerifyOptions{Digest: digest}
+	if flags.chainFile != "" {
+		opts.Roots, opts.Certificates, err = readTimestampChain(flags.chainFile)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = token.Verify(opts)
+	if err != nil {
+		return err
+	}
+	logf("The time-stamp token %s is valid", flags.tsVerify)
+	printTimestamp(token)
+	return nil
+}
+
+// readTimestampChain returns the self-signed certificates of the PEM file as the roots and the others as the
+// certificates completing the chain. The system roots are used when the file holds no root.
+func readTimestampChain(file string) (*x509.CertPool, []*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var roots *x509.CertPool
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", file, err)
+		}
+		if bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil {
+			if roots == nil {
+				roots = x509.NewCertPool()
+			}
+			roots.AddCert(cert)
+		} else {
+			certs = append(certs, cert)
+		}
+	}
+	if roots == nil && certs == nil {
+		return nil, nil, fmt.Errorf("%s: no certificate found", file)
+	}
+	return roots, certs, nil
+}
+
+func printTimestamp(token *timestamp.Token) {
+	logf("Time: %s", token.Time.UTC().Format("2006-01-02T15:04:05.999999999Z"))
+	if token.Accuracy > 0 {
+		logf("Accuracy: %s", token.Accuracy)
+	}
+	logf("Serial number: %x", token.SerialNumber)
+	logf("Policy: %s", token.Policy)
+	if token.Signer != nil {
+		logf("Time-stamping authority: %s", token.Signer.Subject)
+	}
+}
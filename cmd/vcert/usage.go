@@ -84,4 +84,9 @@ func showvcertUsage() {
 	fmt.Printf("\tTo revoke a certificate, use the 'revoke' action.\n")
 	fmt.Printf("\tTo retrieve certificate policy, use the 'getpolicy' action.\n")
 	fmt.Printf("\tTo apply certificate policy, use the 'setpolicy' action.\n")
+	fmt.Printf("\tTo compare the certificate policies of two zones, use the 'policy diff' action.\n")
+	fmt.Printf("\tTo apply certificate policy to many zones, use the 'policy apply' action.\n")
+	fmt.Printf("\tTo sign a CSR read from the standard input, use the 'sign' action.\n")
+	fmt.Printf("\tTo get or change the contacts of a certificate or a zone, use the 'contacts' action.\n")
+	fmt.Printf("\tTo list or change the applications a certificate is associated with, use the 'applications' action.\n")
 }
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha1"
 	"crypto/x509"
 	"encoding/hex"
@@ -34,7 +35,10 @@ import (
 
 	"github.com/Venafi/vcert/v4"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/dns"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/installer"
+	"github.com/Venafi/vcert/v4/pkg/inventory"
 	"github.com/Venafi/vcert/v4/pkg/util"
 
 	"github.com/spf13/viper"
@@ -130,6 +134,8 @@ func fillCertificateRequest(req *certificate.Request, cf *commandFlags) *certifi
 		}
 
 		req.Location.TLSAddress = cf.tlsAddress
+		req.Location.IPAddress = cf.instanceIP
+		req.Location.InstallPath = cf.installPath
 		req.Location.Replace = cf.replaceInstance
 	}
 
@@ -151,6 +157,10 @@ func fillCertificateRequest(req *certificate.Request, cf *commandFlags) *certifi
 		if err != nil {
 			logger.Panicf("Failed to set CSR %s", err)
 		}
+		err = applyCSRAttributes(req, cf)
+		if err != nil {
+			logger.Panicf("Failed to apply CSR attributes: %s", err)
+		}
 		req.CsrOrigin = certificate.UserProvidedCSR
 
 	case "service" == cf.csrOption:
@@ -283,6 +293,157 @@ func readCSRfromFile(fileName string) ([]byte, error) {
 	}
 }
 
+// applyCertProfile applies --cert-profile to req. Without --key-size, an RSA key is raised to the minimum size of
+// the profile.
+func applyCertProfile(req *certificate.Request) error {
+	if flags.certProfile == "" {
+		return nil
+	}
+	profile, err := certificate.ParseProfile(flags.certProfile)
+	if err != nil {
+		return err
+	}
+	if flags.keySize == 0 && req.KeyType == certificate.KeyTypeRSA && req.KeyLength < profile.MinKeyLength() {
+		req.KeyLength = profile.MinKeyLength()
+	}
+	return profile.Apply(req)
+}
+
+// applyOutputProfile requests the serverAuth extended key usage EAP-TLS supplicants require from the certificate of
+// a RADIUS server
+func applyOutputProfile(req *certificate.Request) {
+	if flags.outputProfile == "" {
+		return
+	}
+	for _, eku := range req.ExtKeyUsages {
+		if eku == x509.ExtKeyUsageServerAuth {
+			return
+		}
+	}
+	req.ExtKeyUsages = append(req.ExtKeyUsages, x509.ExtKeyUsageServerAuth)
+}
+
+// installOutputProfile writes the files of the RADIUS server of --output-profile, the private key is decrypted
+func installOutputProfile(pcc *certificate.PEMCollection) error {
+	server, err := installer.ParseRADIUSServer(flags.outputProfile)
+	if err != nil {
+		return err
+	}
+	ri := &installer.RADIUSInstaller{Dir: flags.outputDir, Server: server, Password: flags.keyPassword, DHParams: flags.dhParams}
+	err = ri.Install(context.Background(), pcc)
+	if err != nil {
+		return err
+	}
+	logf("Successfully wrote the %s files to %s", server, flags.outputDir)
+	return nil
+}
+
+// checkCertProfile warns when the certificate was issued without the extended key usages of --cert-profile, which
+// the policy of the zone may not permit
+func checkCertProfile(pcc *certificate.PEMCollection) {
+	if flags.certProfile == "" || pcc.Certificate == "" {
+		return
+	}
+	profile, _ := certificate.ParseProfile(flags.certProfile)
+	block, _ := pem.Decode([]byte(pcc.Certificate))
+	if block == nil {
+		return
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return
+	}
+	for _, expected := range profile.ExtKeyUsages() {
+		found := false
+		for _, u := range cert.ExtKeyUsage {
+			found = found || u == expected
+		}
+		if !found {
+			logf("Warning: the certificate was issued without the extended key usage of the %s profile, check the policy of the zone", profile)
+			return
+		}
+	}
+}
+
+// verifyPossession proves that the private key written with the certificate is its own, unless --no-possession-check
+// is set. The key is still encrypted with --key-password when it's checked.
+func verifyPossession(pcc *certificate.PEMCollection) error {
+	if flags.noPossessionCheck {
+		return nil
+	}
+	return pcc.VerifyPossession([]byte(flags.keyPassword))
+}
+
+// verifyIssuer makes sure the certificate chains to one of the issuers pinned for the zone, if any, so a
+// misconfigured zone doesn't get its certificate written. There's nothing to verify with --no-pickup.
+func verifyIssuer(cfg *vcert.Config, pcc *certificate.PEMCollection) error {
+	if cfg.PinnedIssuers == "" || pcc.Certificate == "" {
+		return nil
+	}
+	pinned, err := certificate.ParsePinnedIssuers([]byte(cfg.PinnedIssuers))
+	if err != nil {
+		return err
+	}
+	return pcc.VerifyIssuer(pinned)
+}
+
+// checkPublicCA checks the request against the CA/Browser Forum baseline requirements with --public-ca, so that a
+// public CA doesn't reject it after it's submitted
+func checkPublicCA(req *certificate.Request) error {
+	if !flags.publicCA {
+		return nil
+	}
+	return req.CheckBaselineRequirements()
+}
+
+// setChainSelection sets the chain the request picks among the ones its issuers build, the flags are validated
+func setChainSelection(req *certificate.Request) {
+	req.ChainPreference, _ = certificate.ChainPreferenceFromString(flags.chainPreference)
+	req.ChainRoot = flags.chainRoot
+}
+
+// checkCAA checks with --caa-issuer that the names of the request resolve and that their CAA records let the CA
+// issue for them. The problems are logged, the first one fails the command unless --caa-warn is set.
+func checkCAA(req *certificate.Request) error {
+	if len(flags.caaIssuers) == 0 {
+		return nil
+	}
+	checker := &dns.CAAChecker{Issuers: flags.caaIssuers, Server: flags.dnsServer}
+	if d := newDialer(&flags); d != nil {
+		checker.Resolver = d.Resolver()
+	}
+	var names []string
+	if req.Subject.CommonName != "" {
+		names = append(names, req.Subject.CommonName)
+	}
+	for _, n := range req.DNSNames {
+		if !strings.EqualFold(n, req.Subject.CommonName) {
+			names = append(names, n)
+		}
+	}
+	problems, err := checker.Check(context.Background(), names)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		logf("WARNING: %s", p)
+	}
+	if len(problems) > 0 && !flags.caaWarn {
+		return problems[0]
+	}
+	return nil
+}
+
+// checkDuplicate applies the --on-duplicate policy, it returns the certificate to reuse if any
+func checkDuplicate(connector endpoint.Connector, req *certificate.Request) (*certificate.PEMCollection, error) {
+	var policy inventory.DuplicatePolicy
+	err := policy.Set(flags.onDuplicate)
+	if err != nil {
+		return nil, err
+	}
+	return inventory.CheckDuplicate(connector, req, policy)
+}
+
 func retrieveCertificate(connector endpoint.Connector, req *certificate.Request, timeout time.Duration) (certificates *certificate.PEMCollection, err error) {
 	startTime := time.Now()
 	for {
@@ -655,3 +816,10 @@ func getUserParameterProvidedForGetCred() (string, error) {
 
 	return uniqueIdentity, nil
 }
+
+// logWarnings logs the non-fatal conditions met by the request, they're also written with the JSON format
+func logWarnings(req *certificate.Request) {
+	for _, w := range req.Warnings {
+		logf("Warning: %s", w)
+	}
+}
@@ -18,14 +18,23 @@ package main
 
 import (
 	"bufio"
+	"encoding/hex"
 	"fmt"
 	"github.com/Venafi/vcert/v4/pkg/util"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
 
+	"github.com/Venafi/vcert/v4/pkg/audit"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/installer"
+	"github.com/Venafi/vcert/v4/pkg/inventory"
+	"github.com/Venafi/vcert/v4/pkg/proxy"
+	"github.com/Venafi/vcert/v4/pkg/sds"
+	"github.com/Venafi/vcert/v4/pkg/timestamp"
 )
 
 // RevocationReasonOptions is an array of strings containing reasons for certificate revocation
@@ -59,6 +68,14 @@ func readData(commandName string) error {
 		flags.keyPassword = strings.TrimSpace(string(bytes))
 	}
 	var err error
+	if flags.keyPassword == keyPasswordAuto {
+		err = generateKeyPassword(commandName, &flags)
+		if err != nil {
+			return err
+		}
+	} else if flags.keyPasswordFile != "" || flags.keyPasswordCommand != "" || flags.keyPasswordLength != 0 || flags.keyPasswordCharset != "" {
+		return fmt.Errorf("--key-password-file, --key-password-command, --key-password-length and --key-password-charset require --key-password auto")
+	}
 	if strings.HasPrefix(flags.thumbprint, "file:") {
 		certFileName := flags.thumbprint[5:]
 		flags.thumbprint, err = readThumbprintFromFile(certFileName)
@@ -80,6 +97,9 @@ func validateCommonFlags(commandName string) error {
 	if flags.file != "" && (flags.certFile != "" || flags.chainFile != "" || flags.keyFile != "") {
 		return fmt.Errorf("The '-file' option cannot be used used with any other -*-file flags. Either all data goes into one file or individual files must be specified using the appropriate flags")
 	}
+	if err := validateLintFlags(); err != nil {
+		return err
+	}
 
 	csrOptionRegex := regexp.MustCompile(`(^file:).*$|^local$|^service$|^$`)
 	if !csrOptionRegex.MatchString(flags.csrOption) {
@@ -104,17 +124,15 @@ func validateCommonFlags(commandName string) error {
 		return fmt.Errorf("unknown key type: %s", flags.keyTypeString)
 	}
 
-	switch strings.ToLower(flags.keyCurveString) {
-	case "p256":
-		flags.keyCurve = certificate.EllipticCurveP256
-	case "p384":
-		flags.keyCurve = certificate.EllipticCurveP384
-	case "p521":
-		flags.keyCurve = certificate.EllipticCurveP521
-	case "":
-	default:
-		return fmt.Errorf("unknown EC key curve: %s", flags.keyTypeString)
-
+	if flags.keyCurveString != "" {
+		curve, err := certificate.ParseEllipticCurve(flags.keyCurveString)
+		if err != nil {
+			return fmt.Errorf("unknown EC key curve: %s", flags.keyCurveString)
+		}
+		if curve.IsBrainpool() && flags.csrOption != "service" {
+			return fmt.Errorf("%s keys can't be generated locally, use --csr service", curve.String())
+		}
+		flags.keyCurve = curve
 	}
 	return nil
 }
@@ -250,19 +268,77 @@ func validateEnrollFlags(commandName string) error {
 	if err != nil {
 		return err
 	}
+	reissue := flags.reissueFrom != "" || flags.reissueFromID != ""
 	if strings.Index(flags.csrOption, "file:") == 0 {
 		if flags.commonName != "" {
 			return fmt.Errorf("The '-cn' option cannot be used in -csr file: provided mode")
 		}
+		if reissue {
+			return fmt.Errorf("--reissue-from and --reissue-from-id cannot be used in -csr file: provided mode")
+		}
 	} else {
-		if flags.commonName == "" {
+		// the common name of an S/MIME certificate defaults to its first email address
+		if flags.commonName == "" && !reissue && !(emailProtectionProfile() && len(flags.emailSans) > 0) {
 			return fmt.Errorf("A Common Name is required for enrollment")
 		}
 	}
+	if flags.reissueFrom != "" && flags.reissueFromID != "" {
+		return fmt.Errorf("Both --reissue-from and --reissue-from-id options cannot be specified at the same time")
+	}
+	if len(flags.removeSans) > 0 && !reissue {
+		return fmt.Errorf("--remove-san requires --reissue-from or --reissue-from-id")
+	}
 
 	if flags.chainOption == "ignore" && flags.chainFile != "" {
 		return fmt.Errorf("The `-chain ignore` option cannot be used with -chain-file option")
 	}
+	err = validateChainSelectionFlags()
+	if err != nil {
+		return err
+	}
+	err = validateCAAFlags()
+	if err != nil {
+		return err
+	}
+	if flags.csrAttributes != "" && strings.Index(flags.csrOption, "file:") != 0 {
+		return fmt.Errorf("--csr-attributes can only be used with --csr file:")
+	}
+	err = validateCSRAttributesFlags()
+	if err != nil {
+		return err
+	}
+	if flags.certProfile != "" {
+		if _, err = certificate.ParseProfile(flags.certProfile); err != nil {
+			return err
+		}
+		if strings.Index(flags.csrOption, "file:") == 0 {
+			return fmt.Errorf("--cert-profile cannot be used with --csr file:, the extended key usages are the ones of the CSR")
+		}
+		if emailProtectionProfile() && flags.format == Pkcs12 && flags.keyPassword == "" {
+			return fmt.Errorf("the PKCS#12 file of an S/MIME certificate must be protected by a password, use --key-password")
+		}
+	}
+	if flags.keyEscrow {
+		if !emailProtectionProfile() {
+			return fmt.Errorf("--key-escrow requires --cert-profile email-protection")
+		}
+		if flags.csrOption != "service" {
+			return fmt.Errorf("--key-escrow cannot be used with --csr %s, the platform generates the escrowed key", flags.csrOption)
+		}
+	}
+	if flags.outputProfile != "" {
+		err = validateOutputProfileFlags()
+		if err != nil {
+			return err
+		}
+	} else if flags.outputDir != "" || flags.dhParams != 0 {
+		return fmt.Errorf("--output-dir and --dh-params can only be used with --output-profile")
+	}
+
+	err = validateDuplicateFlags()
+	if err != nil {
+		return err
+	}
 
 	apiKey := flags.apiKey
 	if apiKey == "" {
@@ -342,6 +418,14 @@ func validateEnrollFlags(commandName string) error {
 		return fmt.Errorf("--tls-address cannot be used without --instance")
 	}
 
+	if (flags.instanceIP != "" || flags.installPath != "") && flags.instance == "" {
+		return fmt.Errorf("--instance-ip and --install-path cannot be used without --instance")
+	}
+
+	if flags.instanceIP != "" && net.ParseIP(flags.instanceIP) == nil {
+		return fmt.Errorf("--instance-ip %s is not a valid IP address", flags.instanceIP)
+	}
+
 	if (flags.tlsAddress != "" || flags.instance != "") && apiKey != "" {
 		return fmt.Errorf("--instance and --tls-address are not applicable to Venafi as a Service")
 	}
@@ -450,6 +534,15 @@ func validateGenerateFlags1(commandName string) error {
 		return fmt.Errorf("A Common Name (cn) or Subject Alternative Name: DNS (san-dns) value is required")
 	}
 
+	if flags.experimentalPQC != "" {
+		if flags.keyTypeString != "" || flags.keySize > 0 || flags.keyCurveString != "" {
+			return fmt.Errorf("--experimental-pqc cannot be used with --key-type, --key-size or --key-curve")
+		}
+		if _, err = certificate.ParsePQCAlgorithm(flags.experimentalPQC); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -477,6 +570,14 @@ func validateRenewFlags1(commandName string) error {
 	if flags.chainOption == "ignore" && flags.chainFile != "" {
 		return fmt.Errorf("The `-chain ignore` option cannot be used with -chain-file option")
 	}
+	err = validateChainSelectionFlags()
+	if err != nil {
+		return err
+	}
+	err = validateCAAFlags()
+	if err != nil {
+		return err
+	}
 
 	if flags.csrOption == "service" {
 		if !(flags.noPickup) && flags.noPrompt && len(flags.keyPassword) == 0 && (flags.tppUser != "" || flags.tppToken != "") {
@@ -563,6 +664,10 @@ func validatePickupFlags1(commandName string) error {
 	if flags.pickupID != "" && flags.pickupIDFile != "" {
 		return fmt.Errorf("Both -pickup-id and -pickup-id-file options cannot be specified at the same time")
 	}
+	err = validateChainSelectionFlags()
+	if err != nil {
+		return err
+	}
 
 	err = validatePKCS12Flags(commandName)
 	if err != nil {
@@ -600,16 +705,7 @@ func validateRevokeFlags1(commandName string) error {
 	}
 
 	if flags.revocationReason != "" {
-		isValidReason := func(reason string) bool {
-			for _, v := range RevocationReasonOptions {
-				if v == reason {
-					return true
-				}
-			}
-			return false
-		}(flags.revocationReason)
-
-		if !isValidReason {
+		if !isValidRevocationReason(flags.revocationReason) {
 			return fmt.Errorf("%s is not valid revocation reason. it should be one of %v", flags.revocationReason, RevocationReasonOptions)
 		}
 	}
@@ -617,6 +713,37 @@ func validateRevokeFlags1(commandName string) error {
 	return nil
 }
 
+func isValidRevocationReason(reason string) bool {
+	for _, v := range RevocationReasonOptions {
+		if v == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCancelFlags(commandName string) error {
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	err = validateCommonFlags(commandName)
+	if err != nil {
+		return err
+	}
+	err = readData(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.pickupID == "" && flags.pickupIDFile == "" {
+		return fmt.Errorf("A Pickup ID is required to cancel a certificate request provided by -pickup-id OR -pickup-id-file options")
+	}
+	if flags.pickupID != "" && flags.pickupIDFile != "" {
+		return fmt.Errorf("Both -pickup-id and -pickup-id-file options cannot be specified at the same time")
+	}
+	return nil
+}
+
 func validateOverWritingEnviromentVariables() {
 
 	colorYellow := "\033[33m"
@@ -766,6 +893,614 @@ func validateSshRetrieveFlags(commandName string) error {
 	return nil
 }
 
+func validateStatusFlags(commandName string) error {
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	if flags.timeout <= 0 {
+		return fmt.Errorf("timeout must be greater than zero")
+	}
+	return nil
+}
+
+func validateCAHierarchyFlags(commandName string) error {
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.zone == "" {
+		return fmt.Errorf("a zone is required, use -z to specify it")
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	if flags.expiringDays < 0 {
+		return fmt.Errorf("--expiring-days can't be negative")
+	}
+	return nil
+}
+
+func validatePolicyDiffFlags(commandName string) error {
+	if len(flags.policyZones) != 2 {
+		return fmt.Errorf("two zones are required, use --zone twice to specify them")
+	}
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validatePolicyApplyFlags(commandName string) error {
+	if flags.policySpecLocation == "" {
+		return fmt.Errorf("a policy specification is required, use --file to specify it")
+	}
+	if len(flags.policyZones) == 0 && flags.policyZonesFile == "" && flags.policyZonePattern == "" {
+		return fmt.Errorf("zones are required, use --zone, --zones-file or --zone-pattern to specify them")
+	}
+	if flags.policyConcurrency <= 0 {
+		return fmt.Errorf("concurrency must be greater than zero")
+	}
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateContactsFlags(commandName string) error {
+	if (flags.distinguishedName == "") == (flags.policyName == "") {
+		return fmt.Errorf("either a certificate --id or a zone -z is required")
+	}
+	if commandName == commandContactsSetName &&
+		len(flags.contacts) == 0 && len(flags.addContacts) == 0 && len(flags.removeContacts) == 0 {
+		return fmt.Errorf("contacts are required, use --contact, --add or --remove to specify them")
+	}
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateApplicationsFlags(commandName string) error {
+	if flags.distinguishedName == "" {
+		return fmt.Errorf("a certificate --id is required")
+	}
+	if commandName != commandAppListName && len(flags.applications) == 0 {
+		return fmt.Errorf("applications are required, use --app to specify them")
+	}
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateSignFlags(commandName string) error {
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.zone == "" && getPropertyFromEnvironment(vCertZone) == "" && flags.config == "" && !flags.testMode {
+		return fmt.Errorf("a zone is required, use -z to specify it")
+	}
+	switch flags.chainOption {
+	case "", "ignore", "root-first", "root-last":
+	default:
+		return fmt.Errorf("unexpected chain option: %s", flags.chainOption)
+	}
+	err = validateLintFlags()
+	if err != nil {
+		return err
+	}
+	return validateCSRAttributesFlags()
+}
+
+func validateDuplicateFlags() error {
+	var policy inventory.DuplicatePolicy
+	if err := policy.Set(flags.onDuplicate); err != nil {
+		return err
+	}
+	// the key of a local CSR is generated for this enrollment, no existing certificate can have it
+	if policy == inventory.DuplicateReuse && flags.csrOption != "service" && strings.Index(flags.csrOption, "file:") != 0 {
+		return fmt.Errorf("--on-duplicate reuse requires --csr service or --csr file:")
+	}
+	return nil
+}
+
+func validateCAAFlags() error {
+	if flags.caaWarn && len(flags.caaIssuers) == 0 {
+		return fmt.Errorf("--caa-warn requires --caa-issuer")
+	}
+	for _, issuer := range flags.caaIssuers {
+		if issuer == "" || strings.ContainsAny(issuer, " ;/:") {
+			return fmt.Errorf("--caa-issuer must be the domain of the CA, e.g. digicert.com: %q", issuer)
+		}
+	}
+	return nil
+}
+
+func validateChainSelectionFlags() error {
+	if _, err := certificate.ChainPreferenceFromString(flags.chainPreference); err != nil {
+		return err
+	}
+	if flags.chainOption == "ignore" && (flags.chainPreference != "" || flags.chainRoot != "") {
+		return fmt.Errorf("--chain-preference and --chain-root cannot be used with --chain ignore")
+	}
+	if flags.chainRoot != "" {
+		fingerprint, err := hex.DecodeString(strings.Replace(flags.chainRoot, ":", "", -1))
+		if err != nil || len(fingerprint) != 20 && len(fingerprint) != 32 {
+			return fmt.Errorf("--chain-root must be the SHA-1 or SHA-256 fingerprint of the root in hex: %s", flags.chainRoot)
+		}
+	}
+	return nil
+}
+
+func validateCSRAttributesFlags() error {
+	mode, err := certificate.CSRAttributeModeFromString(flags.csrAttributes)
+	if err != nil {
+		return err
+	}
+	if mode != certificate.CSRAttributesOverride && (flags.csrChallengePassword != "" || len(flags.csrExtensions) > 0) {
+		return fmt.Errorf("--csr-challenge-password and --csr-extension require --csr-attributes override")
+	}
+	if mode == certificate.CSRAttributesOverride && flags.csrChallengePassword == "" && len(flags.csrExtensions) == 0 {
+		return fmt.Errorf("--csr-attributes override requires --csr-challenge-password or --csr-extension")
+	}
+	if mode != certificate.CSRAttributesPreserve && flags.csrKeyFile == "" {
+		return fmt.Errorf("--csr-attributes %s requires --csr-key-file to sign the CSR again", flags.csrAttributes)
+	}
+	for _, e := range flags.csrExtensions {
+		if _, err = parseCSRExtension(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateRunFlags(commandName string) error {
+	if flags.playbookFile == "" {
+		return fmt.Errorf("a playbook file is required, use --file to specify it")
+	}
+	if flags.daemon && flags.interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+	if flags.check && (flags.daemon || flags.manifestFile != "") {
+		return fmt.Errorf("--check can't be used with --daemon or --manifest")
+	}
+	if flags.manifestFile != "" && flags.daemon {
+		return fmt.Errorf("--manifest can't be used with --daemon")
+	}
+	if flags.manifestKeyFile != "" && flags.manifestFile == "" {
+		return fmt.Errorf("--manifest-key requires --manifest")
+	}
+	if flags.checkpointFile != "" && (flags.daemon || flags.check) {
+		return fmt.Errorf("--checkpoint can't be used with --daemon or --check")
+	}
+	if flags.resume && flags.checkpointFile == "" {
+		return fmt.Errorf("--resume requires --checkpoint")
+	}
+	if flags.stateStore != "" && !flags.daemon {
+		return fmt.Errorf("--state requires --daemon")
+	}
+	return nil
+}
+
+func validateCleanupFlags(commandName string) error {
+	if flags.playbookFile == "" {
+		return fmt.Errorf("a playbook file is required, use --file to specify it")
+	}
+	if flags.olderThan < 0 {
+		return fmt.Errorf("--older-than can't be negative")
+	}
+	if flags.cancelRequests && flags.checkpointFile == "" {
+		return fmt.Errorf("--cancel requires --checkpoint")
+	}
+	switch flags.credFormat {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateValidateConfigFlags(commandName string) error {
+	if flags.config == "" && flags.playbookFile == "" {
+		return fmt.Errorf("a config file or a playbook is required, use --config or --file to specify them")
+	}
+	return nil
+}
+
+func validateServiceInstallFlags(commandName string) error {
+	if flags.playbookFile == "" {
+		return fmt.Errorf("a playbook file is required, use --file to specify it")
+	}
+	if flags.interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+	return nil
+}
+
+func validateBackupFlags(commandName string) error {
+	if flags.vaultDir == "" {
+		return fmt.Errorf("a vault directory is required, use --vault to specify it")
+	}
+	if flags.file == "" && flags.certFile == "" {
+		return fmt.Errorf("a certificate is required, use --file or --cert-file to specify it")
+	}
+	if flags.file != "" && (flags.certFile != "" || flags.keyFile != "" || flags.chainFile != "") {
+		return fmt.Errorf("--file can't be used with --cert-file, --key-file or --chain-file")
+	}
+	return nil
+}
+
+func validateRestoreFlags(commandName string) error {
+	if flags.vaultDir == "" {
+		return fmt.Errorf("a vault directory is required, use --vault to specify it")
+	}
+	if flags.commonName != "" && flags.thumbprint != "" {
+		return fmt.Errorf("--cn and --thumbprint can't be used together")
+	}
+	if !flags.vaultList && flags.commonName == "" && flags.thumbprint == "" {
+		return fmt.Errorf("the certificate to restore is required, use --cn or --thumbprint to specify it, or --list to list them")
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateInspectFlags(commandName string) error {
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" && flags.credFormat != inspectFormatOpenSSL {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateConvertFlags(commandName string) error {
+	switch flags.format {
+	case "", "pem", util.LegacyPem, "json", Pkcs12, JKSFormat:
+	case convertFormatDER:
+		if flags.file == "" && flags.certFile == "" && flags.keyFile == "" {
+			return fmt.Errorf("DER format requires the certificate or the private key to be written to a file; specify using --file, --cert-file or --key-file")
+		}
+		if flags.file != "" && (flags.certFile != "" || flags.keyFile != "") {
+			return fmt.Errorf(`The --file parameter may not be combined with the --cert-file or --key-file parameters when --format is "der"`)
+		}
+	case convertFormatPKCS7:
+		if flags.file == "" {
+			return fmt.Errorf("PKCS#7 format requires the certificates to be written to a single file; specify using --file")
+		}
+		if flags.certFile != "" || flags.chainFile != "" || flags.keyFile != "" {
+			return fmt.Errorf(`The --file parameter may not be combined with the --cert-file, --key-file, or --chain-file parameters when --format is "pkcs7"`)
+		}
+	case convertFormatOpenSSH:
+		if flags.file == "" && flags.keyFile == "" {
+			return fmt.Errorf("OpenSSH format requires the private key to be written to a file; specify using --file or --key-file")
+		}
+	default:
+		return fmt.Errorf("unexpected output format: %s", flags.format)
+	}
+	if flags.chainFile != "" && flags.file != "" {
+		return fmt.Errorf("The --file parameter may not be combined with the --chain-file parameter")
+	}
+	err := validatePKCS12Flags(commandName)
+	if err != nil {
+		return err
+	}
+	return validateJKSFlags(commandName)
+}
+
+func validateListenFlags(commandName string) error {
+	if flags.playbookFile == "" {
+		return fmt.Errorf("a playbook file is required, use --file to specify it")
+	}
+	if flags.webhookSecret == "" {
+		return fmt.Errorf("a secret is required to verify the notifications, use --secret to specify it")
+	}
+	if (flags.tlsCertFile == "") != (flags.tlsKeyFile == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be used together")
+	}
+	if flags.clientCAFile != "" && flags.tlsCertFile == "" {
+		return fmt.Errorf("--client-ca requires --tls-cert")
+	}
+	if flags.rbacFile != "" && flags.clientCAFile == "" {
+		return fmt.Errorf("--rbac requires --client-ca to authenticate the clients")
+	}
+	return nil
+}
+
+func validateControllerFlags(commandName string) error {
+	if flags.renewBeforeDays <= 0 {
+		return fmt.Errorf("renew before must be greater than zero")
+	}
+	if flags.interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+	if flags.inject && (flags.tlsCertFile == "" || flags.tlsKeyFile == "") {
+		return fmt.Errorf("admission webhooks are served over TLS: --inject requires --tls-cert and --tls-key")
+	}
+	if !flags.inject && (flags.tlsCertFile != "" || flags.tlsKeyFile != "") {
+		return fmt.Errorf("--tls-cert and --tls-key are only used with --inject")
+	}
+	return validateConnectionFlags(commandName)
+}
+
+func validateDeviceFlags(commandName string) error {
+	if flags.renewBeforeDays <= 0 {
+		return fmt.Errorf("renew before must be greater than zero")
+	}
+	if flags.daemon && flags.interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+	err := validateCommonFlags(commandName)
+	if err != nil {
+		return err
+	}
+	return validateConnectionFlags(commandName)
+}
+
+func validateBootstrapFlags(commandName string) error {
+	if flags.clusterFile == "" {
+		return fmt.Errorf("a cluster definition file is required, use --file")
+	}
+	if flags.renewBeforeDays < 0 {
+		return fmt.Errorf("renew before can't be negative")
+	}
+	return validateConnectionFlags(commandName)
+}
+
+// emailProtectionProfile tells whether --cert-profile requests an S/MIME certificate
+func emailProtectionProfile() bool {
+	profile, err := certificate.ParseProfile(flags.certProfile)
+	return err == nil && profile == certificate.ProfileEmailProtection
+}
+
+func validateTimestampFlags(commandName string, files []string) error {
+	if _, err := timestamp.ParseHash(flags.tsHash); err != nil {
+		return err
+	}
+	if flags.tsVerify != "" {
+		if flags.tsaURL != "" || flags.file != "" {
+			return fmt.Errorf("--verify can't be combined with --tsa-url or --file")
+		}
+	} else if flags.tsaURL == "" {
+		return fmt.Errorf("a time-stamping authority is required, use --tsa-url")
+	}
+	if flags.tsDigest != "" {
+		if len(files) > 0 {
+			return fmt.Errorf("--digest can't be combined with a file to time-stamp")
+		}
+		if _, err := hex.DecodeString(flags.tsDigest); err != nil {
+			return fmt.Errorf("--digest isn't hexadecimal: %s", err)
+		}
+	} else if len(files) != 1 {
+		return fmt.Errorf("one file to time-stamp is required, or use --digest")
+	}
+	return nil
+}
+
+func validateMetricsFlags(commandName string) error {
+	if flags.zone == "" && flags.config == "" && !flags.testMode && len(flags.metricsEndpoints) == 0 {
+		return fmt.Errorf("a zone or an endpoint to watch is required")
+	}
+	for _, e := range flags.metricsEndpoints {
+		if _, _, err := net.SplitHostPort(e); err != nil {
+			return fmt.Errorf("invalid endpoint %s: %s", e, err)
+		}
+	}
+	if flags.interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+	if flags.expiringDays < 0 {
+		return fmt.Errorf("expiring days can't be negative")
+	}
+	if flags.zone != "" || flags.config != "" || flags.testMode {
+		return validateConnectionFlags(commandName)
+	}
+	return nil
+}
+
+func validateListFlags(commandName string) error {
+	if flags.local {
+		if flags.inventoryCache == "" {
+			return fmt.Errorf("--local requires --cache")
+		}
+	} else {
+		err := validateConnectionFlags(commandName)
+		if err != nil {
+			return err
+		}
+	}
+	if flags.expiringWithin != "" {
+		if _, err := inventory.ParseDuration(flags.expiringWithin); err != nil {
+			return err
+		}
+	}
+	if flags.sortBy != "" {
+		if err := inventory.SortCertificates(nil, flags.sortBy); err != nil {
+			return err
+		}
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateAuditFlags(commandName string) error {
+	if flags.zone == "" && flags.config == "" && !flags.testMode && len(flags.metricsEndpoints) == 0 {
+		return fmt.Errorf("a zone or an endpoint to audit is required")
+	}
+	for _, e := range flags.metricsEndpoints {
+		if _, _, err := net.SplitHostPort(e); err != nil {
+			return fmt.Errorf("invalid endpoint %s: %s", e, err)
+		}
+	}
+	if _, err := audit.ParseSeverity(flags.auditSeverity); err != nil {
+		return err
+	}
+	switch flags.credFormat {
+	case "", "text", "json", "csv":
+	default:
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	if flags.zone != "" || flags.config != "" || flags.testMode {
+		return validateConnectionFlags(commandName)
+	}
+	return nil
+}
+
+func validateBlastRadiusFlags(commandName string) error {
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	err = readData(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.thumbprint == "" && flags.keyFile == "" && flags.commonName == "" {
+		return fmt.Errorf("the compromised certificate or key is required, use --thumbprint, --key-file or --cn to specify it")
+	}
+	if flags.thumbprint != "" && flags.keyFile != "" {
+		return fmt.Errorf("--thumbprint and --key-file can't be used together")
+	}
+	if !flags.revokeAll && (flags.revocationReason != "" || flags.assumeYes) {
+		return fmt.Errorf("--reason and --yes require --revoke")
+	}
+	if flags.revocationReason != "" && !isValidRevocationReason(flags.revocationReason) {
+		return fmt.Errorf("%s is not valid revocation reason. it should be one of %v", flags.revocationReason, RevocationReasonOptions)
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateLineageFlags(commandName string) error {
+	err := readData(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.distinguishedName == "" && flags.inventoryCache == "" {
+		return fmt.Errorf("the renewals are read from the platform with --id or from a local inventory with --cache")
+	}
+	if flags.distinguishedName == "" && flags.thumbprint == "" {
+		return fmt.Errorf("the certificate is required, use --thumbprint or --id to specify it")
+	}
+	if flags.distinguishedName != "" {
+		err = validateConnectionFlags(commandName)
+		if err != nil {
+			return err
+		}
+	}
+	if flags.credFormat != "" && flags.credFormat != "text" && flags.credFormat != "json" {
+		return fmt.Errorf("unexpected output format: %s", flags.credFormat)
+	}
+	return nil
+}
+
+func validateExportFlags(commandName string) error {
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.exportFile == "" {
+		return fmt.Errorf("an output file is required, use --file to specify it")
+	}
+	if flags.cursorFile != "" {
+		if flags.exportFormat != inventory.FormatJSONL {
+			return fmt.Errorf("--cursor needs the jsonl format")
+		}
+		if flags.checkpointFile != "" {
+			return fmt.Errorf("--cursor and --checkpoint can't be used together")
+		}
+		if flags.expiringWithin != "" || flags.sortBy != "" {
+			return fmt.Errorf("--cursor can't be used with --expiring-within or --sort")
+		}
+	}
+	if flags.expiringWithin != "" {
+		if _, err := inventory.ParseDuration(flags.expiringWithin); err != nil {
+			return err
+		}
+	}
+	if flags.sortBy != "" {
+		if err := inventory.SortCertificates(nil, flags.sortBy); err != nil {
+			return err
+		}
+		if flags.checkpointFile != "" {
+			return fmt.Errorf("a sorted export can't be resumed, --sort can't be used with --checkpoint")
+		}
+	}
+	switch flags.exportFormat {
+	case inventory.FormatCSV, inventory.FormatJSONL:
+	case inventory.FormatParquet:
+		if flags.checkpointFile != "" {
+			return fmt.Errorf("a parquet export can't be resumed, --checkpoint needs the csv or jsonl format")
+		}
+	default:
+		return fmt.Errorf("unexpected export format: %s", flags.exportFormat)
+	}
+	return nil
+}
+
+func validateOfflineRequestFlags(commandName string) error {
+	err := validateGenerateFlags1(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.zone == "" {
+		return fmt.Errorf("a zone is required, use -z to specify it")
+	}
+	if flags.offlineRequestFile == "" {
+		return fmt.Errorf("a request file is required, use --request to specify it")
+	}
+	// the days are checked as for enroll, which submits the same value
+	if flags.validDays != "" && !validateValidDaysFlag(commandEnrollName) {
+		return fmt.Errorf("-valid-days is not valid: %s", flags.validDays)
+	}
+	return nil
+}
+
+func validateOfflineSubmitFlags(commandName string) error {
+	err := validateConnectionFlags(commandName)
+	if err != nil {
+		return err
+	}
+	if flags.offlineRequestFile == "" || flags.offlineResponseFile == "" {
+		return fmt.Errorf("the request and response files are required, use --request and --response to specify them")
+	}
+	return nil
+}
+
+func validateOfflineImportFlags(commandName string) error {
+	if flags.offlineRequestFile == "" || flags.offlineResponseFile == "" {
+		return fmt.Errorf("the request and response files are required, use --request and --response to specify them")
+	}
+	if flags.chainOption == "ignore" && flags.chainFile != "" {
+		return fmt.Errorf("The `-chain ignore` option cannot be used with -chain-file option")
+	}
+	return nil
+}
+
 func validateExistingFile(f string) error {
 	fileNames, err := getExistingSshFiles(f)
 
@@ -792,3 +1527,89 @@ func validateExistingFile(f string) error {
 	}
 	return nil
 }
+
+// validateOutputProfileFlags checks an enrollment writing the files of a RADIUS server, which replace the ones of
+// --file, --cert-file, --key-file and --chain-file
+func validateOutputProfileFlags() error {
+	server, err := installer.ParseRADIUSServer(flags.outputProfile)
+	if err != nil {
+		return err
+	}
+	if flags.outputDir == "" {
+		return fmt.Errorf("--output-dir is required with --output-profile")
+	}
+	if flags.file != "" || flags.certFile != "" || flags.keyFile != "" || flags.chainFile != "" || flags.format != "pem" {
+		return fmt.Errorf("--output-profile writes its own files, it cannot be used with --file, --cert-file, --key-file, --chain-file or --format")
+	}
+	if flags.certProfile != "" {
+		return fmt.Errorf("--output-profile cannot be used with --cert-profile, a RADIUS server certificate is for server authentication")
+	}
+	if flags.noPickup || flags.csrOption == "file" || strings.Index(flags.csrOption, "file:") == 0 {
+		return fmt.Errorf("--output-profile needs the certificate and its private key, it cannot be used with --no-pickup or --csr file")
+	}
+	switch flags.dhParams {
+	case 0, 2048, 3072, 4096:
+	default:
+		return fmt.Errorf("--dh-params must be 2048, 3072 or 4096")
+	}
+	if flags.dhParams != 0 && server != installer.RADIUSFreeRADIUS {
+		return fmt.Errorf("--dh-params can only be used with --output-profile freeradius")
+	}
+	if server == installer.RADIUSNPS && flags.keyPassword == "" {
+		return fmt.Errorf("the PKCS#12 file of NPS must be protected by a password, use --key-password")
+	}
+	return nil
+}
+
+func validateSDSFlags(commandName string) error {
+	if flags.tlsCertFile == "" || flags.tlsKeyFile == "" {
+		return fmt.Errorf("gRPC needs HTTP/2, which is served over TLS: --tls-cert and --tls-key are required")
+	}
+	if flags.commonName == "" && len(flags.dnsSans) == 0 && len(flags.uriSans) == 0 && len(flags.sdsSecrets) == 0 {
+		return fmt.Errorf("no certificate to serve, use --cn or --san-* for the default secret, or --secret-name")
+	}
+	for _, name := range flags.sdsSecrets {
+		if name == sds.DefaultSecretName || name == sds.RootSecretName {
+			return fmt.Errorf("--secret-name %s is reserved, the default secret is the identity of --cn and the --san-* options", name)
+		}
+	}
+	if flags.listenAddress == "unix:" {
+		return fmt.Errorf("--listen unix: needs the path of the socket")
+	}
+	err := validateCommonFlags(commandName)
+	if err != nil {
+		return err
+	}
+	return validateConnectionFlags(commandName)
+}
+
+// validateDialFlags checks the options replacing the name resolution, the dialing behavior and the proxy of the system
+func validateDialFlags() error {
+	for _, r := range flags.resolve {
+		if _, _, err := parseResolve(r); err != nil {
+			return err
+		}
+	}
+	if flags.dnsServer != "" && flags.dohURL != "" {
+		return fmt.Errorf("--dns-server and --dns-over-https cannot be used together")
+	}
+	if flags.dohURL != "" {
+		u, err := url.Parse(flags.dohURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("--dns-over-https must be the https URL of a DNS over HTTPS server")
+		}
+	}
+	switch flags.ipVersion {
+	case 0, 4, 6:
+	default:
+		return fmt.Errorf("--ip-version must be 4 or 6")
+	}
+	if flags.proxyURL != "" {
+		if _, err := proxy.Parse(flags.proxyURL, flags.proxyAuth); err != nil {
+			return err
+		}
+	} else if flags.proxyAuth != "" {
+		return fmt.Errorf("--proxy-auth requires --proxy")
+	}
+	return nil
+}
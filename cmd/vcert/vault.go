@@ -0,0 +1,202 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/Venafi/vcert/v4/pkg/age"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/vault"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func doCommandBackup(c *cli.Context) error {
+	err := validateBackupFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	recipients, err := vaultRecipients()
+	if err != nil {
+		return err
+	}
+	pcc, err := readBackup(flags.file, flags.certFile, flags.chainFile, flags.keyFile)
+	if err != nil {
+		return err
+	}
+	v, err := vault.Open(flags.vaultDir)
+	if err != nil {
+		return err
+	}
+	entry, err := v.Store(pcc, recipients...)
+	if err != nil {
+		return err
+	}
+	withKey := "without its private key"
+	if entry.PrivateKey {
+		withKey = "with its private key"
+	}
+	logf("Stored certificate %s (%s) %s in %s", entry.CommonName, entry.Thumbprint, withKey, flags.vaultDir)
+	return nil
+}
+
+func doCommandRestore(c *cli.Context) error {
+	err := validateRestoreFlags(c.Command.Name)
+	if err != nil {
+		return err
+	}
+	v, err := vault.Open(flags.vaultDir)
+	if err != nil {
+		return err
+	}
+	entries := v.Entries()
+	if flags.commonName != "" {
+		entries = v.Find(flags.commonName)
+	} else if flags.thumbprint != "" {
+		entries = v.Find(flags.thumbprint)
+	}
+	if flags.vaultList {
+		if flags.credFormat == "json" {
+			return outputJSON(entries)
+		}
+		printVaultEntries(entries)
+		return nil
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: no certificate matching %s%s in the vault", verror.UserDataError, flags.commonName, flags.thumbprint)
+	}
+	identities, err := vaultIdentities()
+	if err != nil {
+		return err
+	}
+	pcc, err := v.Restore(entries[0].Thumbprint, identities...)
+	if err != nil {
+		return err
+	}
+	logf("Restoring certificate %s (%s) stored on %s", entries[0].CommonName, entries[0].Thumbprint, entries[0].StoredAt.Format(time.RFC3339))
+	result := &Result{
+		Pcc: pcc,
+		Config: &Config{
+			Command:     c.Command.Name,
+			ChainOption: certificate.ChainOptionRootLast,
+			AllFile:     flags.file,
+			KeyFile:     flags.keyFile,
+			CertFile:    flags.certFile,
+			ChainFile:   flags.chainFile,
+		},
+	}
+	err = result.Flush()
+	if err != nil {
+		return fmt.Errorf("Failed to output the results: %s", err)
+	}
+	return nil
+}
+
+func printVaultEntries(entries []vault.Entry) {
+	for _, e := range entries {
+		key := "no key"
+		if e.PrivateKey {
+			key = "key"
+		}
+		fmt.Printf("%s  %s  expires %s  stored %s  %s\n", e.Thumbprint, e.CommonName, e.NotAfter.Format(time.RFC3339),
+			e.StoredAt.Format(time.RFC3339), key)
+	}
+}
+
+// vaultRecipients returns the recipients of --recipient, or the ones of the age identities of the environment
+func vaultRecipients() ([]*age.Recipient, error) {
+	var recipients []*age.Recipient
+	for _, s := range flags.vaultRecipients {
+		r, err := age.ParseRecipient(s)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	if len(recipients) > 0 {
+		return recipients, nil
+	}
+	identities, err := age.IdentitiesFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("%w: no recipient, use --recipient to specify one", err)
+	}
+	for _, id := range identities {
+		recipients = append(recipients, id.Recipient())
+	}
+	return recipients, nil
+}
+
+// vaultIdentities returns the identities of --identity, or the age identities of the environment
+func vaultIdentities() ([]*age.Identity, error) {
+	if flags.identityFile == "" {
+		return age.IdentitiesFromEnv()
+	}
+	f, err := os.Open(flags.identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read age identities: %s", verror.UserDataError, err)
+	}
+	defer f.Close()
+	return age.ParseIdentities(f)
+}
+
+// readBackup reads the certificate, its chain and its private key from PEM files. The first certificate is the one
+// backed up, the next ones are its chain.
+func readBackup(paths ...string) (*certificate.PEMCollection, error) {
+	var certs []byte
+	var key string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", verror.UserDataError, err)
+		}
+		for {
+			var b *pem.Block
+			b, data = pem.Decode(data)
+			if b == nil {
+				break
+			}
+			switch {
+			case b.Type == "CERTIFICATE":
+				certs = append(certs, pem.EncodeToMemory(b)...)
+			case strings.HasSuffix(b.Type, "PRIVATE KEY"):
+				if key != "" {
+					return nil, fmt.Errorf("%w: more than one private key found", verror.UserDataError)
+				}
+				key = string(pem.EncodeToMemory(b))
+			}
+		}
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w: no certificate found", verror.UserDataError)
+	}
+	pcc, err := certificate.PEMCollectionFromBytes(certs, certificate.ChainOptionRootLast)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", verror.UserDataError, err)
+	}
+	pcc.PrivateKey = key
+	return pcc, nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vcert-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundle := filepath.Join(dir, "bundle.pem")
+	if err := ioutil.WriteFile(bundle, []byte(cert+"\n"+PK+"\n"+caCert), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pcc, err := readBackup(bundle, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(pcc.Certificate) != strings.TrimSpace(cert) {
+		t.Errorf("unexpected certificate %s", pcc.Certificate)
+	}
+	if len(pcc.Chain) != 1 || strings.TrimSpace(pcc.Chain[0]) != strings.TrimSpace(caCert) {
+		t.Errorf("unexpected chain %v", pcc.Chain)
+	}
+	if strings.TrimSpace(pcc.PrivateKey) != strings.TrimSpace(PK) {
+		t.Errorf("unexpected private key %s", pcc.PrivateKey)
+	}
+
+	key := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(key, []byte(PK), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBackup(bundle, "", "", key); err == nil {
+		t.Error("expected an error for two private keys")
+	}
+	if _, err := readBackup(key); err == nil {
+		t.Error("expected an error without certificate")
+	}
+}
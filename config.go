@@ -17,14 +17,24 @@
 package vcert
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os/user"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/Venafi/vcert/v4/pkg/age"
+	"github.com/Venafi/vcert/v4/pkg/dns"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/httpdump"
+	"github.com/Venafi/vcert/v4/pkg/proxy"
+	"github.com/Venafi/vcert/v4/pkg/util"
 	"gopkg.in/ini.v1"
 )
 
@@ -43,6 +53,24 @@ type Config struct {
 	LogVerbose      bool
 	// http.Client to use durring construction
 	Client *http.Client
+	// DebugDump writes the HTTP exchanges of the connector to files, with the secrets redacted
+	DebugDump *httpdump.Dumper
+	// UserAgent is appended to the vcert User-Agent of the requests, e.g. "cert-rotation/1.2", so the platform logs
+	// attribute the requests to the automation making them
+	UserAgent string
+	// Headers are added to every request made to the platform, e.g. a correlation ID. They don't replace the
+	// headers set by the connector.
+	Headers map[string]string
+	// Dialer dials the connections to the platform, with its own name resolution, when the connector doesn't use
+	// the resolver and dialing behavior of the system. It's ignored when Client has a transport that isn't an
+	// *http.Transport.
+	Dialer *dns.Dialer
+	// Proxy is the proxy the connections to the platform go through instead of the one of the environment, e.g.
+	// socks5h://jump.example.com:1080 where the platform is only reachable from a jump host
+	Proxy *proxy.Proxy
+	// PinnedIssuers is the PEM of the CAs the certificates of the zone are expected to chain to, the ones retrieved
+	// are checked with certificate.PEMCollection.VerifyIssuer before they're written. The connector doesn't use it.
+	PinnedIssuers string
 }
 
 // LoadConfigFromFile is deprecated. In the future will be rewrited.
@@ -54,17 +82,12 @@ func LoadConfigFromFile(path, section string) (cfg Config, err error) {
 	}
 	log.Printf("Loading configuration from %s section %s", path, section)
 
-	fname, err := expand(path)
-	if err != nil {
-		return cfg, fmt.Errorf("failed to load config: %s", err)
-	}
-
-	iniFile, err := ini.Load(fname)
+	data, iniFile, err := readConfigFile(path)
 	if err != nil {
 		return cfg, fmt.Errorf("failed to load config: %s", err)
 	}
 
-	err = validateFile(iniFile)
+	err = validateFile(iniFile, data)
 	if err != nil {
 		return cfg, fmt.Errorf("failed to load config: %s", err)
 	}
@@ -81,7 +104,10 @@ func LoadConfigFromFile(path, section string) (cfg Config, err error) {
 		return cfg, fmt.Errorf("section %s has not been found in %s", section, path)
 	}
 
-	var m dict = iniFile.Section(section).KeysHash()
+	m, err := expandSection(iniFile.Section(section))
+	if err != nil {
+		return cfg, fmt.Errorf("failed to load config: %s", err)
+	}
 
 	var connectorType endpoint.ConnectorType
 	var baseUrl string
@@ -131,6 +157,29 @@ func LoadConfigFromFile(path, section string) (cfg Config, err error) {
 		cfg.ConnectionTrust = string(data)
 	}
 
+	if m.has("issuer_pins") {
+		fname, err := expand(m["issuer_pins"])
+		if err != nil {
+			return cfg, fmt.Errorf("failed to load issuer pins: %s", err)
+		}
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to load issuer pins: %s", err)
+		}
+		cfg.PinnedIssuers = string(data)
+	}
+
+	if m.has("proxy") {
+		cfg.Proxy, err = proxy.Parse(m["proxy"], m["proxy_auth"])
+		if err != nil {
+			return cfg, fmt.Errorf("failed to load config: %s", err)
+		}
+		if m.has("proxy_user") {
+			cfg.Proxy.Username = m["proxy_user"]
+			cfg.Proxy.Password = m["proxy_password"]
+		}
+	}
+
 	cfg.ConnectorType = connectorType
 	cfg.Credentials = auth
 	cfg.BaseUrl = baseUrl
@@ -138,6 +187,44 @@ func LoadConfigFromFile(path, section string) (cfg Config, err error) {
 	return
 }
 
+// ValidateConfigFile checks all the sections of the config file at path without connecting. The errors tell the
+// line of the problem and the key meant when an unknown key is close to a known one. The environment variables
+// referenced only have to be set when their section is loaded.
+func ValidateConfigFile(path string) error {
+	data, iniFile, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	return validateFile(iniFile, data)
+}
+
+func readConfigFile(path string) ([]byte, *ini.File, error) {
+	fname, err := expand(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, nil, err
+	}
+	// a config file encrypted with age is decrypted with the identities of $SOPS_AGE_KEY or $SOPS_AGE_KEY_FILE
+	if age.IsEncrypted(data) {
+		ids, err := age.IdentitiesFromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err = age.Decrypt(data, ids...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	iniFile, err := ini.Load(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, iniFile, nil
+}
+
 func expand(path string) (string, error) {
 	if len(path) == 0 || path[0] != '~' {
 		return path, nil
@@ -167,7 +254,72 @@ func (d set) has(key string) bool {
 	return false
 }
 
-func validateSection(s *ini.Section) error {
+func (d set) keys() []string {
+	keys := make([]string, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keyError is an error about key in section s, with the line of the key in data when it's found
+func keyError(data []byte, s *ini.Section, key string, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if line := keyLine(data, s.Name(), key); line > 0 {
+		msg = fmt.Sprintf("line %d: %s", line, msg)
+	}
+	return errors.New(msg)
+}
+
+// illegalKey is the error of a key not allowed in a section, suggesting the valid key closest to it
+func illegalKey(data []byte, s *ini.Section, key, kind string, valid set) error {
+	msg := fmt.Sprintf("illegal key '%s' in %s section %s", key, kind, s.Name())
+	if suggestion := util.Suggest(key, valid.keys()); suggestion != "" {
+		msg += fmt.Sprintf(", did you mean '%s'?", suggestion)
+	}
+	return keyError(data, s, key, "%s", msg)
+}
+
+// keyLine returns the line number of key in section, 0 when it's not found
+func keyLine(data []byte, section, key string) int {
+	// nolint:staticcheck
+	current := ini.DEFAULT_SECTION
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if i := strings.IndexAny(line, "=:"); i > 0 && strings.TrimSpace(line[:i]) == key {
+			return n
+		}
+	}
+	return 0
+}
+
+// expandSection returns the values of the keys of s with the ${NAME} and ${NAME:-default} references to environment
+// variables expanded, so a file can be promoted across environments unchanged
+func expandSection(s *ini.Section) (dict, error) {
+	m := make(dict)
+	for k, v := range s.KeysHash() {
+		expanded, err := util.ExpandEnv(v)
+		if err != nil {
+			return nil, fmt.Errorf("key '%s' in section %s: %s", k, s.Name(), err)
+		}
+		m[k] = expanded
+	}
+	return m, nil
+}
+
+func validateSection(s *ini.Section, data []byte) error {
 	var TPPValidKeys set = map[string]bool{
 		"url":          true,
 		"access_token": true,
@@ -176,6 +328,7 @@ func validateSection(s *ini.Section) error {
 		"tpp_password": true,
 		"tpp_zone":     true,
 		"trust_bundle": true,
+		"issuer_pins":  true,
 	}
 	var CloudValidKeys set = map[string]bool{
 		"url":          true,
@@ -183,23 +336,41 @@ func validateSection(s *ini.Section) error {
 		"cloud_url":    true,
 		"cloud_apikey": true,
 		"cloud_zone":   true,
+		"issuer_pins":  true,
+	}
+	// both platforms can be reached through a proxy
+	for _, k := range proxyKeys {
+		TPPValidKeys[k] = true
+		CloudValidKeys[k] = true
 	}
 
 	log.Printf("Validating configuration section %s", s.Name())
 	var m dict = s.KeysHash()
+	keys := s.KeyStrings()
+
+	// the variables only have to be set for the section that is loaded
+	for _, k := range keys {
+		if err := util.CheckEnv(m[k]); err != nil {
+			return keyError(data, s, k, "key '%s' in section %s: %s", k, s.Name(), err)
+		}
+	}
+
+	if err := validateProxyKeys(s, data, m); err != nil {
+		return err
+	}
 
 	if m.has("access_token") && m.has("cloud_apikey") {
-		return fmt.Errorf("configuration issue in section %s: could not set both TPP token and cloud api key", s.Name())
+		return keyError(data, s, "cloud_apikey", "configuration issue in section %s: could not set both TPP token and cloud api key", s.Name())
 	}
 	if m.has("tpp_user") || m.has("access_token") || m.has("tpp_password") {
 		// looks like TPP config section
-		for k := range m {
+		for _, k := range keys {
 			if !TPPValidKeys.has(k) {
-				return fmt.Errorf("illegal key '%s' in TPP section %s", k, s.Name())
+				return illegalKey(data, s, k, "TPP", TPPValidKeys)
 			}
 		}
 		if m.has("tpp_user") && m.has("access_token") {
-			return fmt.Errorf("configuration issue in section %s: could not have both TPP user and access token", s.Name())
+			return keyError(data, s, "access_token", "configuration issue in section %s: could not have both TPP user and access token", s.Name())
 		}
 		if !m.has("tpp_user") && !m.has("access_token") {
 			return fmt.Errorf("configuration issue in section %s: missing TPP user", s.Name())
@@ -209,14 +380,16 @@ func validateSection(s *ini.Section) error {
 		}
 	} else if m.has("cloud_apikey") {
 		// looks like Cloud config section
-		for k := range m {
+		for _, k := range keys {
 			if !CloudValidKeys.has(k) {
-				return fmt.Errorf("illegal key '%s' in Cloud section %s", k, s.Name())
+				return illegalKey(data, s, k, "Cloud", CloudValidKeys)
 			}
 		}
 	} else if m.has("test_mode") {
 		// it's ok
 
+	} else if k, suggestion := misspelledKey(keys, TPPValidKeys, CloudValidKeys); k != "" {
+		return keyError(data, s, k, "unknown key '%s' in section %s, did you mean '%s'?", k, s.Name(), suggestion)
 	} else if m.has("url") {
 		return fmt.Errorf("could not determine connection endpoint with only url information in section %s", s.Name())
 	} else {
@@ -225,7 +398,56 @@ func validateSection(s *ini.Section) error {
 	return nil
 }
 
-func validateFile(f *ini.File) error {
+var proxyKeys = []string{"proxy", "proxy_auth", "proxy_user", "proxy_password"}
+
+// validateProxyKeys checks the proxy of a section, whose credentials are either in the URL or in their own keys
+func validateProxyKeys(s *ini.Section, data []byte, m dict) error {
+	if !m.has("proxy") {
+		for _, k := range proxyKeys[1:] {
+			if m.has(k) {
+				return keyError(data, s, k, "configuration issue in section %s: %s requires proxy", s.Name(), k)
+			}
+		}
+		return nil
+	}
+	// the URL can only be checked when its variables are set, the other sections aren't loaded and may not need them
+	rawurl, urlErr := util.ExpandEnv(m["proxy"])
+	auth, authErr := util.ExpandEnv(m["proxy_auth"])
+	if urlErr == nil && authErr == nil {
+		p, err := proxy.Parse(rawurl, auth)
+		if err != nil {
+			return keyError(data, s, "proxy", "configuration issue in section %s: %s", s.Name(), err)
+		}
+		if p.Username != "" && m.has("proxy_user") {
+			return keyError(data, s, "proxy_user", "configuration issue in section %s: the proxy user is both in the URL and in proxy_user", s.Name())
+		}
+	}
+	if m.has("proxy_password") && !m.has("proxy_user") {
+		return keyError(data, s, "proxy_password", "configuration issue in section %s: proxy_password requires proxy_user", s.Name())
+	}
+	return nil
+}
+
+// misspelledKey returns the first key that isn't valid but is close to a valid one, and that valid key
+func misspelledKey(keys []string, valid ...set) (string, string) {
+	all := set{"test_mode": true}
+	for _, v := range valid {
+		for k := range v {
+			all[k] = true
+		}
+	}
+	for _, k := range keys {
+		if all.has(k) {
+			continue
+		}
+		if suggestion := util.Suggest(k, all.keys()); suggestion != "" {
+			return k, suggestion
+		}
+	}
+	return "", ""
+}
+
+func validateFile(f *ini.File, data []byte) error {
 
 	for _, section := range f.Sections() {
 		if len(section.Keys()) == 0 {
@@ -235,7 +457,7 @@ func validateFile(f *ini.File) error {
 				continue
 			}
 		}
-		err := validateSection(section)
+		err := validateSection(section, data)
 		if err != nil {
 			return err
 		}
@@ -20,6 +20,9 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/age"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
 )
 
 const validTestModeConfig = `
@@ -116,3 +119,186 @@ func TestLoadFromFile(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadEncryptedFromFile(t *testing.T) {
+	id, err := age.GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := age.Encrypt([]byte(validCloudConfig), true, id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpfile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	err = ioutil.WriteFile(tmpfile.Name(), encrypted, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(age.KeyEnv, id.String())
+	defer os.Unsetenv(age.KeyEnv)
+	cfg, err := LoadConfigFromFile(tmpfile.Name(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Credentials.APIKey != "xxxxxxxx-b256-4c43-a4d4-15372ce2d548" {
+		t.Fatalf("unexpected API key %q", cfg.Credentials.APIKey)
+	}
+
+	other, _ := age.GenerateIdentity()
+	os.Setenv(age.KeyEnv, other.String())
+	_, err = LoadConfigFromFile(tmpfile.Name(), "")
+	if err == nil {
+		t.Fatal("config should not be decrypted with another identity")
+	}
+}
+
+func TestLoadFromFileExpandsEnv(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	content := "url = ${VCERT_TEST_URL:-https://tpp.example.com}\naccess_token = ${VCERT_TEST_TOKEN}\ntpp_zone = ${VCERT_TEST_ZONE:-devops}\n"
+	err = ioutil.WriteFile(tmpfile.Name(), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadConfigFromFile(tmpfile.Name(), "")
+	if err == nil {
+		t.Fatal("config should not be loaded without VCERT_TEST_TOKEN")
+	}
+
+	os.Setenv("VCERT_TEST_TOKEN", "ns1dofUPmsdxTLQS2hM1gQ==")
+	os.Setenv("VCERT_TEST_ZONE", `prod\vcert`)
+	defer os.Unsetenv("VCERT_TEST_TOKEN")
+	defer os.Unsetenv("VCERT_TEST_ZONE")
+	cfg, err := LoadConfigFromFile(tmpfile.Name(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BaseUrl != "https://tpp.example.com" {
+		t.Errorf("unexpected URL %q", cfg.BaseUrl)
+	}
+	if cfg.Credentials.AccessToken != "ns1dofUPmsdxTLQS2hM1gQ==" {
+		t.Errorf("unexpected access token %q", cfg.Credentials.AccessToken)
+	}
+	if cfg.Zone != `prod\vcert` {
+		t.Errorf("unexpected zone %q", cfg.Zone)
+	}
+}
+
+func TestLoadFromFileUnsetEnvInOtherSection(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	content := "[dev]\ntest_mode = true\n\n[prod]\nurl = https://tpp.example.com\ntpp_user = admin\ntpp_password = ${VCERT_TEST_PROD_PW}\nproxy = http://${VCERT_TEST_PROXY}:3128\n"
+	err = ioutil.WriteFile(tmpfile.Name(), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigFromFile(tmpfile.Name(), "dev")
+	if err != nil {
+		t.Fatalf("unset variables of another section should not matter: %s", err)
+	}
+	if cfg.ConnectorType != endpoint.ConnectorTypeFake {
+		t.Errorf("unexpected connector type %s", cfg.ConnectorType)
+	}
+	if _, err = LoadConfigFromFile(tmpfile.Name(), "prod"); err == nil {
+		t.Fatal("config should not be loaded without VCERT_TEST_PROD_PW")
+	}
+}
+
+func TestLoadFromFileProxy(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	content := validTPPConfig + "\nproxy = http://proxy.example.com:3128\nproxy_auth = ntlm\nproxy_user = CORP\\jump\nproxy_password = secret\n"
+	err = ioutil.WriteFile(tmpfile.Name(), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigFromFile(tmpfile.Name(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Proxy == nil || cfg.Proxy.URL.Host != "proxy.example.com:3128" || !cfg.Proxy.NTLM ||
+		cfg.Proxy.Username != `CORP\jump` || cfg.Proxy.Password != "secret" {
+		t.Fatalf("unexpected proxy %+v", cfg.Proxy)
+	}
+}
+
+func TestLoadFromFileIssuerPins(t *testing.T) {
+	pins, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(pins.Name())
+	err = ioutil.WriteFile(pins.Name(), []byte("-----BEGIN CERTIFICATE-----\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpfile, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	err = ioutil.WriteFile(tmpfile.Name(), []byte(validTPPConfig+"\nissuer_pins = "+pins.Name()+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigFromFile(tmpfile.Name(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PinnedIssuers != "-----BEGIN CERTIFICATE-----\n" {
+		t.Fatalf("unexpected pinned issuers %q", cfg.PinnedIssuers)
+	}
+}
+
+func TestValidateConfigFile(t *testing.T) {
+	cases := []struct {
+		content, want string
+	}{
+		{validTPPConfig, ""},
+		{"[tpp]\nurl = https://tpp.example.com\naccess_token = token\ntpp_zne = devops\n", "line 4: illegal key 'tpp_zne' in TPP section tpp, did you mean 'tpp_zone'?"},
+		{"cloud_apikye = key\n", "line 1: unknown key 'cloud_apikye' in section DEFAULT, did you mean 'cloud_apikey'?"},
+		{"tpp_user = admin\ntpp_password = secret\n\naccess_token = token\n", "line 4: configuration issue in section DEFAULT: could not have both TPP user and access token"},
+		{"[tpp]\ntpp_url = ${VCERT_TEST_URL:-https://tpp.example.com}\naccess_token = ${VCERT_TEST_TOKEN}\n", ""},
+		{"[tpp]\ntpp_url = ${VCERT_TEST_URL:-https://tpp.example.com}\naccess_token = ${VCERT_TEST_TOKEN\n", "line 3: key 'access_token' in section tpp: unterminated variable reference \"${VCERT_TEST_TOKEN\""},
+		{"[vaas]\ncloud_apikey = key\nproxy = socks5h://jump.example.com\nproxy_user = jump\nproxy_password = secret\n", ""},
+		{"[tpp]\nurl = https://tpp.example.com\naccess_token = token\nproxy = ftp://jump.example.com\n", "line 4: configuration issue in section tpp: vcert error: your data contains problems: proxy URL \"ftp://jump.example.com\" must be http://, https://, socks5:// or socks5h://"},
+		{"[tpp]\nurl = https://tpp.example.com\naccess_token = token\nproxy_auth = ntlm\n", "line 4: configuration issue in section tpp: proxy_auth requires proxy"},
+	}
+	for _, c := range cases {
+		tmpfile, err := ioutil.TempFile("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tmpfile.Name())
+		err = ioutil.WriteFile(tmpfile.Name(), []byte(c.content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ValidateConfigFile(tmpfile.Name())
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("unexpected error %s for:\n%s", err, c.content)
+			}
+		} else if err == nil || err.Error() != c.want {
+			t.Errorf("expected error %q, got %v", c.want, err)
+		}
+	}
+}
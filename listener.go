@@ -102,7 +102,7 @@ func getSimpleCertificate(conn endpoint.Connector, cn string) (tls.Certificate,
 	}
 	certCollection.PrivateKey = privKey
 
-	return certCollection.ToTLSCertificate(), err
+	return certCollection.ToServerTLSCertificate()
 }
 
 type listener struct {
@@ -0,0 +1,458 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package age encrypts and decrypts files in the age format (https://age-encryption.org/v1) with X25519 keys, so
+// secrets such as API keys and keystore passwords can be kept encrypted in files committed to git. Keys are
+// compatible with age-keygen, and with SOPS which reads them from $SOPS_AGE_KEY_FILE.
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	intro      = "age-encryption.org/v1\n"
+	armorType  = "AGE ENCRYPTED FILE"
+	x25519Info = "age-encryption.org/v1/X25519"
+
+	identityHRP  = "age-secret-key-"
+	recipientHRP = "age"
+
+	fileKeySize   = 16
+	nonceSize     = 16
+	chunkSize     = 64 * 1024
+	columnsPerRow = 64
+
+	// KeyEnv holds identities, one per line, as in $SOPS_AGE_KEY
+	KeyEnv = "SOPS_AGE_KEY"
+	// KeyFileEnv is the path of an identity file, as in $SOPS_AGE_KEY_FILE
+	KeyFileEnv = "SOPS_AGE_KEY_FILE"
+)
+
+// ErrNoIdentity is returned by Decrypt when none of the identities can decrypt the file
+var ErrNoIdentity = fmt.Errorf("%w: no identity matched any of the file's recipients", verror.UserDataError)
+
+var b64 = base64.RawStdEncoding.Strict()
+
+// Identity is an X25519 private key, encoded as "AGE-SECRET-KEY-1..."
+type Identity struct {
+	secret    []byte
+	recipient *Recipient
+}
+
+// Recipient is an X25519 public key, encoded as "age1..."
+type Recipient struct {
+	publicKey []byte
+}
+
+// GenerateIdentity returns a new random identity
+func GenerateIdentity() (*Identity, error) {
+	secret := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return newIdentity(secret)
+}
+
+// ParseIdentity parses an "AGE-SECRET-KEY-1..." identity
+func ParseIdentity(s string) (*Identity, error) {
+	hrp, secret, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed age identity: %s", verror.UserDataError, err)
+	}
+	if hrp != identityHRP || len(secret) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("%w: malformed age identity", verror.UserDataError)
+	}
+	return newIdentity(secret)
+}
+
+func newIdentity(secret []byte) (*Identity, error) {
+	pub, err := curve25519.X25519(secret, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{secret: secret, recipient: &Recipient{publicKey: pub}}, nil
+}
+
+// Recipient returns the public key files are encrypted to for the identity
+func (i *Identity) Recipient() *Recipient {
+	return i.recipient
+}
+
+func (i *Identity) String() string {
+	s, _ := bech32Encode(identityHRP, i.secret)
+	return strings.ToUpper(s)
+}
+
+// ParseRecipient parses an "age1..." recipient
+func ParseRecipient(s string) (*Recipient, error) {
+	hrp, pub, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed age recipient: %s", verror.UserDataError, err)
+	}
+	if hrp != recipientHRP || len(pub) != curve25519.PointSize {
+		return nil, fmt.Errorf("%w: malformed age recipient", verror.UserDataError)
+	}
+	return &Recipient{publicKey: pub}, nil
+}
+
+func (r *Recipient) String() string {
+	s, _ := bech32Encode(recipientHRP, r.publicKey)
+	return s
+}
+
+// ParseIdentities reads an identity file as written by age-keygen: one identity per line, with empty lines and
+// lines starting with "#" ignored
+func ParseIdentities(r io.Reader) ([]*Identity, error) {
+	var ids []*Identity
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := ParseIdentity(line)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: no age identity found", verror.UserDataError)
+	}
+	return ids, nil
+}
+
+// IdentitiesFromEnv returns the identities of $SOPS_AGE_KEY, or of the file at $SOPS_AGE_KEY_FILE, or of the
+// default SOPS key file in the user configuration directory
+func IdentitiesFromEnv() ([]*Identity, error) {
+	if keys := os.Getenv(KeyEnv); keys != "" {
+		return ParseIdentities(strings.NewReader(keys))
+	}
+	path := os.Getenv(KeyFileEnv)
+	if path == "" {
+		dir, err := userConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("%w: no age identity, set $%s or $%s", verror.UserDataError, KeyEnv, KeyFileEnv)
+		}
+		path = filepath.Join(dir, "sops", "age", "keys.txt")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read age identities: %s", verror.UserDataError, err)
+	}
+	defer f.Close()
+	return ParseIdentities(f)
+}
+
+// userConfigDir is os.UserConfigDir, which SOPS uses, except that $XDG_CONFIG_HOME is honored on every platform
+func userConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir, nil
+	}
+	return os.UserConfigDir()
+}
+
+// IsEncrypted tells whether data is an age file, binary or armored
+func IsEncrypted(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return bytes.HasPrefix(data, []byte(intro)) || bytes.HasPrefix(data, []byte("-----BEGIN "+armorType+"-----"))
+}
+
+// Encrypt encrypts plaintext to the recipients. The result is armored with PEM-like markers when armor is true,
+// which is convenient to embed it in a text file.
+func Encrypt(plaintext []byte, armor bool, recipients ...*Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: no age recipient", verror.UserDataError)
+	}
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	var header bytes.Buffer
+	header.WriteString(intro)
+	for _, r := range recipients {
+		share, body, err := r.wrap(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		header.WriteString("-> X25519 " + b64.EncodeToString(share) + "\n")
+		writeWrapped(&header, b64.EncodeToString(body))
+	}
+	header.WriteString("---")
+	mac := headerMAC(fileKey, header.Bytes())
+	header.WriteString(" " + b64.EncodeToString(mac) + "\n")
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(header.Bytes(), nonce...)
+	payload, err := sealPayload(payloadKey(fileKey, nonce), plaintext)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, payload...)
+	if armor {
+		return pem.EncodeToMemory(&pem.Block{Type: armorType, Bytes: out}), nil
+	}
+	return out, nil
+}
+
+// Decrypt decrypts an age file, binary or armored, with the first identity that is one of its recipients
+func Decrypt(data []byte, identities ...*Identity) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN "+armorType+"-----")) {
+		b, rest := pem.Decode(trimmed)
+		if b == nil || b.Type != armorType || len(bytes.TrimSpace(rest)) > 0 {
+			return nil, fmt.Errorf("%w: malformed age armor", verror.UserDataError)
+		}
+		data = b.Bytes
+	}
+	if !bytes.HasPrefix(data, []byte(intro)) {
+		return nil, fmt.Errorf("%w: not an age file", verror.UserDataError)
+	}
+	stanzas, headerLen, mac, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	var fileKey []byte
+	for _, s := range stanzas {
+		if len(s.args) != 2 || s.args[0] != "X25519" {
+			continue
+		}
+		for _, id := range identities {
+			if fileKey, err = id.unwrap(s); err == nil {
+				break
+			}
+		}
+		if fileKey != nil {
+			break
+		}
+	}
+	if fileKey == nil {
+		return nil, ErrNoIdentity
+	}
+	if !hmac.Equal(mac, headerMAC(fileKey, data[:headerLen])) {
+		return nil, fmt.Errorf("%w: age header MAC mismatch", verror.UserDataError)
+	}
+	rest := data[headerLen:]
+	// skip the MAC and its line feed
+	rest = rest[bytes.IndexByte(rest, '\n')+1:]
+	if len(rest) < nonceSize {
+		return nil, fmt.Errorf("%w: age payload is truncated", verror.UserDataError)
+	}
+	return openPayload(payloadKey(fileKey, rest[:nonceSize]), rest[nonceSize:])
+}
+
+type stanza struct {
+	args []string
+	body []byte
+}
+
+// parseHeader returns the recipient stanzas, the length of the header up to and including "---" which is
+// covered by the MAC, and the MAC
+func parseHeader(data []byte) (stanzas []stanza, headerLen int, mac []byte, err error) {
+	malformed := func(reason string) error {
+		return fmt.Errorf("%w: malformed age header: %s", verror.UserDataError, reason)
+	}
+	pos := len(intro)
+	readLine := func() (string, bool) {
+		i := bytes.IndexByte(data[pos:], '\n')
+		if i < 0 {
+			return "", false
+		}
+		line := string(data[pos : pos+i])
+		pos += i + 1
+		return line, true
+	}
+	for {
+		line, ok := readLine()
+		if !ok {
+			return nil, 0, nil, malformed("unexpected end of header")
+		}
+		if strings.HasPrefix(line, "--- ") {
+			headerLen = pos - len(line) - 1 + len("---")
+			mac, err = b64.DecodeString(line[len("--- "):])
+			if err != nil {
+				return nil, 0, nil, malformed("invalid MAC")
+			}
+			return stanzas, headerLen, mac, nil
+		}
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, 0, nil, malformed("expected a stanza")
+		}
+		s := stanza{args: strings.Split(line[len("-> "):], " ")}
+		for {
+			bodyLine, ok := readLine()
+			if !ok {
+				return nil, 0, nil, malformed("unexpected end of stanza")
+			}
+			chunk, err := b64.DecodeString(bodyLine)
+			if err != nil || len(bodyLine) > columnsPerRow {
+				return nil, 0, nil, malformed("invalid stanza body")
+			}
+			s.body = append(s.body, chunk...)
+			if len(bodyLine) < columnsPerRow {
+				break
+			}
+		}
+		stanzas = append(stanzas, s)
+	}
+}
+
+func writeWrapped(w *bytes.Buffer, s string) {
+	for len(s) >= columnsPerRow {
+		w.WriteString(s[:columnsPerRow] + "\n")
+		s = s[columnsPerRow:]
+	}
+	w.WriteString(s + "\n")
+}
+
+func (r *Recipient) wrap(fileKey []byte) (share, body []byte, err error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err = rand.Read(ephemeral); err != nil {
+		return nil, nil, err
+	}
+	share, err = curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := curve25519.X25519(ephemeral, r.publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := chacha20poly1305.New(hkdfKey(shared, append(append([]byte(nil), share...), r.publicKey...), x25519Info))
+	if err != nil {
+		return nil, nil, err
+	}
+	return share, aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil), nil
+}
+
+func (i *Identity) unwrap(s stanza) ([]byte, error) {
+	share, err := b64.DecodeString(s.args[1])
+	if err != nil || len(share) != curve25519.PointSize {
+		return nil, fmt.Errorf("invalid X25519 share")
+	}
+	// X25519 rejects the low order points which would give an all zero shared secret
+	shared, err := curve25519.X25519(i.secret, share)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(hkdfKey(shared, append(append([]byte(nil), share...), i.recipient.publicKey...), x25519Info))
+	if err != nil {
+		return nil, err
+	}
+	if len(s.body) != fileKeySize+chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("invalid X25519 stanza body")
+	}
+	return aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), s.body, nil)
+}
+
+func hkdfKey(secret, salt []byte, info string) []byte {
+	key := make([]byte, chacha20poly1305.KeySize)
+	_, _ = io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key)
+	return key
+}
+
+func headerMAC(fileKey, header []byte) []byte {
+	h := hmac.New(sha256.New, hkdfKey(fileKey, nil, "header"))
+	h.Write(header)
+	return h.Sum(nil)
+}
+
+func payloadKey(fileKey, nonce []byte) []byte {
+	return hkdfKey(fileKey, nonce, "payload")
+}
+
+// sealPayload encrypts plaintext in chunks of 64 KiB with the STREAM construction: each chunk's nonce is its
+// index followed by a flag marking the last chunk
+func sealPayload(key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for counter := uint64(0); ; counter++ {
+		n := len(plaintext)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		last := n == len(plaintext)
+		out = aead.Seal(out, chunkNonce(counter, last), plaintext[:n], nil)
+		plaintext = plaintext[n:]
+		if last {
+			return out, nil
+		}
+	}
+}
+
+func openPayload(key, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for counter := uint64(0); ; counter++ {
+		n := len(ciphertext)
+		if n > chunkSize+aead.Overhead() {
+			n = chunkSize + aead.Overhead()
+		}
+		last := n == len(ciphertext)
+		out, err = aead.Open(out, chunkNonce(counter, last), ciphertext[:n], nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decrypt age payload", verror.UserDataError)
+		}
+		// only the last chunk may be shorter than a full chunk, and only an empty file has an empty chunk
+		if last && n == aead.Overhead() && counter > 0 {
+			return nil, fmt.Errorf("%w: age payload has an empty last chunk", verror.UserDataError)
+		}
+		ciphertext = ciphertext[n:]
+		if last {
+			return out, nil
+		}
+	}
+}
+
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package age
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestBech32(t *testing.T) {
+	for _, s := range []string{"A12UEL5L", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"} {
+		hrp, data, err := bech32Decode(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		encoded, err := bech32Encode(hrp, data)
+		if err != nil || encoded != strings.ToLower(s) {
+			t.Fatalf("%s: re-encoded as %s, %v", s, encoded, err)
+		}
+	}
+	for _, s := range []string{"A12UEL5M", "aBcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", "1pzry9x8gf2tvdw0s3jn54khce6mua7l"} {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+	r, err := ParseRecipient("age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p")
+	if err != nil || len(r.publicKey) != 32 {
+		t.Fatalf("unexpected recipient %v, %v", r, err)
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := GenerateIdentity()
+	parsed, err := ParseIdentity(id.String())
+	if err != nil || parsed.Recipient().String() != id.Recipient().String() {
+		t.Fatalf("identity doesn't round trip: %v", err)
+	}
+	if !strings.HasPrefix(id.String(), "AGE-SECRET-KEY-1") || !strings.HasPrefix(id.Recipient().String(), "age1") {
+		t.Fatalf("unexpected encoding %s %s", id, id.Recipient())
+	}
+
+	big := make([]byte, 2*chunkSize+100)
+	_, _ = rand.Read(big)
+	for _, plaintext := range [][]byte{{}, []byte("s3cr3t"), big[:chunkSize], big} {
+		for _, armor := range []bool{false, true} {
+			encrypted, err := Encrypt(plaintext, armor, other.Recipient(), id.Recipient())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncrypted(encrypted) {
+				t.Fatal("encrypted data isn't recognized")
+			}
+			decrypted, err := Decrypt(encrypted, id)
+			if err != nil {
+				t.Fatalf("%d bytes, armor %v: %s", len(plaintext), armor, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("%d bytes, armor %v: decrypted data differs", len(plaintext), armor)
+			}
+		}
+	}
+
+	encrypted, _ := Encrypt([]byte("s3cr3t"), false, other.Recipient())
+	_, err = Decrypt(encrypted, id)
+	if !errors.Is(err, ErrNoIdentity) {
+		t.Fatalf("expected no identity error, got %v", err)
+	}
+	encrypted, _ = Encrypt([]byte("s3cr3t"), false, id.Recipient())
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = Decrypt(tampered, id)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected payload error, got %v", err)
+	}
+	_, err = Decrypt([]byte("plain text"), id)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected format error, got %v", err)
+	}
+}
+
+func TestIdentitiesFromEnv(t *testing.T) {
+	id, _ := GenerateIdentity()
+	keys := "# created: 2022-06-01T10:00:00Z\n# public key: " + id.Recipient().String() + "\n" + id.String() + "\n"
+	os.Setenv(KeyEnv, keys)
+	defer os.Unsetenv(KeyEnv)
+	ids, err := IdentitiesFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0].String() != id.String() {
+		t.Fatalf("unexpected identities %v", ids)
+	}
+	os.Setenv(KeyEnv, "AGE-SECRET-KEY-1INVALID")
+	_, err = IdentitiesFromEnv()
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected user data error, got %v", err)
+	}
+}
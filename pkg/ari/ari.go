@@ -0,0 +1,129 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ari retrieves ACME Renewal Information, the renewal windows suggested by ACME certificate authorities.
+package ari
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Client queries the renewalInfo resource of an ACME server. It implements endpoint.RenewalInfoRetriever.
+type Client struct {
+	// URL is the renewalInfo URL from the ACME directory
+	URL        string
+	HTTPClient *http.Client
+}
+
+type renewalInfoResponse struct {
+	SuggestedWindow struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	} `json:"suggestedWindow"`
+	ExplanationURL string `json:"explanationURL,omitempty"`
+}
+
+var oidAuthorityKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 35}
+
+// CertID returns the ARI identifier of cert: the base64url encoded key identifier of its authority key identifier
+// extension and its serial number, joined by a dot
+func CertID(cert *x509.Certificate) (string, error) {
+	aki := cert.AuthorityKeyId
+	if len(aki) == 0 {
+		aki = authorityKeyID(cert.Extensions)
+	}
+	if len(aki) == 0 {
+		return "", fmt.Errorf("%w: certificate has no authority key identifier", verror.UserDataError)
+	}
+	serial, err := asn1.Marshal(cert.SerialNumber)
+	if err != nil {
+		return "", err
+	}
+	var raw asn1.RawValue
+	_, err = asn1.Unmarshal(serial, &raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aki) + "." + base64.RawURLEncoding.EncodeToString(raw.Bytes), nil
+}
+
+func authorityKeyID(exts []pkix.Extension) []byte {
+	for _, e := range exts {
+		if e.Id.Equal(oidAuthorityKeyIdentifier) {
+			var aki struct {
+				ID []byte `asn1:"optional,tag:0"`
+			}
+			if _, err := asn1.Unmarshal(e.Value, &aki); err == nil {
+				return aki.ID
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) RetrieveRenewalInfo(cert *x509.Certificate) (*endpoint.RenewalInfo, error) {
+	id, err := CertID(cert)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Get(strings.TrimSuffix(c.URL, "/") + "/" + id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: no renewal information for certificate %s", verror.ServerError, id)
+	default:
+		return nil, fmt.Errorf("%w: unexpected status code on renewal information retrieval: %s", verror.ServerError, resp.Status)
+	}
+	var r renewalInfoResponse
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse renewal information: %s", verror.ServerError, err)
+	}
+	if r.SuggestedWindow.Start.IsZero() || r.SuggestedWindow.End.Before(r.SuggestedWindow.Start) {
+		return nil, fmt.Errorf("%w: invalid suggested window in renewal information", verror.ServerError)
+	}
+	info := &endpoint.RenewalInfo{
+		SuggestedWindowStart: r.SuggestedWindow.Start,
+		SuggestedWindowEnd:   r.SuggestedWindow.End,
+		ExplanationURL:       r.ExplanationURL,
+	}
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if seconds, err := strconv.Atoi(s); err == nil {
+			info.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+	return info, nil
+}
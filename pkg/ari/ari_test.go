@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ari
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func testCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(0x87654321),
+		Subject:        pkix.Name{CommonName: "example.com"},
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(24 * time.Hour),
+		AuthorityKeyId: []byte{0x69, 0x88, 0x5b, 0x6b, 0x87, 0x46, 0x40, 0x41, 0xe1, 0xb3, 0x7b, 0x84, 0x7b, 0xa0, 0xae, 0x2c, 0xde, 0x01, 0xc8, 0xd4},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCertID(t *testing.T) {
+	id, err := CertID(testCertificate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// example from the ARI specification
+	if id != "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE" {
+		t.Fatalf("unexpected cert ID %s", id)
+	}
+}
+
+func TestRetrieveRenewalInfo(t *testing.T) {
+	cert := testCertificate(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/renewal-info/aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Retry-After", "21600")
+		_, _ = w.Write([]byte(`{"suggestedWindow":{"start":"2025-01-02T04:00:00Z","end":"2025-01-03T04:00:00Z"},"explanationURL":"https://acme.example.com/docs/ari"}`))
+	}))
+	defer server.Close()
+
+	info, err := (&Client{URL: server.URL + "/renewal-info/"}).RetrieveRenewalInfo(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SuggestedWindowStart.Format(time.RFC3339) != "2025-01-02T04:00:00Z" || info.RetryAfter != 6*time.Hour {
+		t.Fatalf("unexpected renewal info %+v", info)
+	}
+	at := info.RenewalTime()
+	if at.Before(info.SuggestedWindowStart) || !at.Before(info.SuggestedWindowEnd) {
+		t.Fatalf("renewal time %s is outside of the window", at)
+	}
+
+	_, err = (&Client{URL: server.URL}).RetrieveRenewalInfo(cert)
+	if !errors.Is(err, verror.ServerError) {
+		t.Fatalf("expected server error, got %v", err)
+	}
+}
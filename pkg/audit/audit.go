@@ -0,0 +1,322 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package audit looks for the weak keys, the deprecated signature algorithms, the expired intermediates and the
+// validities beyond the CA/Browser Forum rules among the certificates of the inventory of a zone and the ones served
+// by TLS endpoints.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const defaultDialTimeout = 10 * time.Second
+
+// Severity ranks the findings, from Low to Critical
+type Severity int
+
+const (
+	Low Severity = iota
+	Medium
+	High
+	Critical
+)
+
+var severityNames = []string{"low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if s < Low || s > Critical {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalText writes the severity by name in the JSON output
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ParseSeverity returns the severity named name: low, medium, high or critical
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return Severity(i), nil
+		}
+	}
+	return Low, fmt.Errorf("%w: unknown severity %q, it should be one of %s", verror.UserDataError, name,
+		strings.Join(severityNames, ", "))
+}
+
+// Finding is a problem found in a certificate. Source is the ID of the certificate in the inventory or the address
+// of the endpoint that serves it, the other fields describe the certificate at fault, which is an intermediate of
+// the chain for some findings.
+type Finding struct {
+	Source     string
+	CN         string
+	Serial     string
+	Thumbprint string
+	Code       string
+	Severity   Severity
+	Message    string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s, %s)", f.Severity, f.Code, f.Message, f.CN, f.Source)
+}
+
+// Auditor audits the inventory of a zone and TLS endpoints. The zero value only needs a Connector or Endpoints.
+type Auditor struct {
+	// Connector lists the inventory of its zone, it may be nil to only audit endpoints
+	Connector endpoint.Connector
+	Filter    endpoint.Filter
+	// Endpoints are host:port addresses of TLS servers whose chain is audited
+	Endpoints   []string
+	DialTimeout time.Duration
+	// Now is replaced in tests
+	Now func() time.Time
+}
+
+// Audit returns the findings of every certificate of the inventory and of every endpoint. A certificate or an
+// endpoint that can't be retrieved doesn't stop the audit, the failures are returned together with the findings
+// of the others.
+func (a *Auditor) Audit(ctx context.Context) ([]Finding, error) {
+	now := time.Now()
+	if a.Now != nil {
+		now = a.Now()
+	}
+	var findings []Finding
+	var failed []string
+	if a.Connector != nil {
+		infos, err := a.Connector.ListCertificates(a.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("could not list the inventory: %w", err)
+		}
+		for _, info := range infos {
+			// an expired certificate is no longer served, its key and signature don't matter anymore
+			if !info.ValidTo.IsZero() && !info.ValidTo.After(now) {
+				continue
+			}
+			chain, err := a.retrieve(info)
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %s", info.ID, err))
+				continue
+			}
+			findings = append(findings, Chain(info.ID, chain, now)...)
+		}
+	}
+	for _, addr := range a.Endpoints {
+		chain, err := a.fetch(ctx, addr)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", addr, err))
+			continue
+		}
+		findings = append(findings, Chain(addr, chain, now)...)
+	}
+	if len(failed) > 0 {
+		return findings, fmt.Errorf("%w: could not audit %d certificate(s) or endpoint(s): %s", verror.VcertError,
+			len(failed), strings.Join(failed, "; "))
+	}
+	return findings, nil
+}
+
+// retrieve returns the certificate of info with its chain
+func (a *Auditor) retrieve(info certificate.CertificateInfo) ([]*x509.Certificate, error) {
+	pcc, err := a.Connector.RetrieveCertificate(&certificate.Request{Thumbprint: info.Thumbprint,
+		ChainOption: certificate.ChainOptionRootLast})
+	if err != nil {
+		return nil, err
+	}
+	var chain []*x509.Certificate
+	for _, p := range append([]string{pcc.Certificate}, pcc.Chain...) {
+		block, _ := pem.Decode([]byte(p))
+		if block == nil {
+			return nil, fmt.Errorf("%w: failed to decode the certificate", verror.ServerBadDataResponce)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse the certificate: %s", verror.ServerBadDataResponce, err)
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// fetch returns the chain served by the endpoint addr
+func (a *Auditor) fetch(ctx context.Context, addr string) ([]*x509.Certificate, error) {
+	timeout := a.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer raw.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = raw.SetDeadline(deadline)
+	}
+	// an untrusted chain is audited too, it's likely to have more to report
+	conn := tls.Client(raw, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	err = conn.Handshake()
+	if err != nil {
+		return nil, err
+	}
+	peers := conn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no certificate")
+	}
+	return peers, nil
+}
+
+// Chain audits the certificates of chain, the leaf first. The keys and the signatures of every certificate are
+// checked but the signature of a self-signed root, which isn't verified by the clients. The expiry is checked for the
+// intermediates, and the validity for the leaf.
+func Chain(source string, chain []*x509.Certificate, now time.Time) []Finding {
+	var findings []Finding
+	add := func(cert *x509.Certificate, severity Severity, code, format string, args ...interface{}) {
+		findings = append(findings, Finding{
+			Source:     source,
+			CN:         cert.Subject.CommonName,
+			Serial:     fmt.Sprintf("%X", cert.SerialNumber),
+			Thumbprint: fmt.Sprintf("%X", sha1.Sum(cert.Raw)),
+			Code:       code,
+			Severity:   severity,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+	for i, cert := range chain {
+		switch pub := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			switch bits := pub.N.BitLen(); {
+			case bits < 1024:
+				add(cert, Critical, "weak_rsa_key", "the RSA key is %d bits", bits)
+			case bits < 2048:
+				add(cert, High, "weak_rsa_key", "the RSA key is %d bits, 2048 is the minimum", bits)
+			}
+		case *ecdsa.PublicKey:
+			switch pub.Curve {
+			case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			default:
+				add(cert, High, "weak_ec_curve", "the ECDSA key is on curve %s", pub.Curve.Params().Name)
+			}
+		case *dsa.PublicKey:
+			add(cert, High, "deprecated_dsa_key", "the key is a DSA key, which the browsers no longer accept")
+		}
+		if !isSelfSigned(cert) {
+			switch cert.SignatureAlgorithm {
+			case x509.MD2WithRSA, x509.MD5WithRSA:
+				add(cert, Critical, "weak_signature_algorithm", "the certificate is signed with %s", cert.SignatureAlgorithm)
+			case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+				add(cert, High, "weak_signature_algorithm", "the certificate is signed with %s", cert.SignatureAlgorithm)
+			}
+		}
+		switch {
+		case i == 0 && !cert.IsCA:
+			if limit, rule, ok := maxNotAfter(cert.NotBefore); ok && cert.NotAfter.After(limit) {
+				add(cert, Medium, "validity_exceeds_cabf_limit",
+					"the certificate issued on %s is valid %d days, the CA/Browser Forum allows %s",
+					cert.NotBefore.Format("2006-01-02"), int(cert.NotAfter.Sub(cert.NotBefore).Hours()/24), rule)
+			}
+		case i > 0 && !isSelfSigned(cert) && now.After(cert.NotAfter):
+			add(cert, High, "expired_intermediate", "the intermediate expired on %s", cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return findings
+}
+
+// cabfLimits are the longest validities of the CA/Browser Forum baseline requirements, by the date they apply from
+var cabfLimits = []struct {
+	since        time.Time
+	months, days int
+	rule         string
+}{
+	{time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC), 0, 398, "398 days"},
+	{time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC), 0, 825, "825 days"},
+	{time.Date(2015, 4, 1, 0, 0, 0, 0, time.UTC), 39, 0, "39 months"},
+	{time.Date(2012, 7, 1, 0, 0, 0, 0, time.UTC), 60, 0, "60 months"},
+}
+
+// maxNotAfter returns the latest expiry allowed for a certificate valid from notBefore, and false before the
+// baseline requirements took effect
+func maxNotAfter(notBefore time.Time) (time.Time, string, bool) {
+	for _, l := range cabfLimits {
+		if !notBefore.Before(l.since) {
+			return notBefore.AddDate(0, l.months, l.days), l.rule, true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// isSelfSigned compares the names and the key IDs rather than verifying the signature, which fails for the SHA-1
+// signatures of the old roots
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		(len(cert.AuthorityKeyId) == 0 || bytes.Equal(cert.AuthorityKeyId, cert.SubjectKeyId))
+}
+
+// Filter returns the findings of at least severity min
+func Filter(findings []Finding, min Severity) []Finding {
+	var filtered []Finding
+	for _, f := range findings {
+		if f.Severity >= min {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// WriteCSV writes the findings to w as CSV with a header row
+func WriteCSV(w io.Writer, findings []Finding) error {
+	c := csv.NewWriter(w)
+	err := c.Write([]string{"source", "cn", "serial", "thumbprint", "severity", "code", "message"})
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		err = c.Write([]string{f.Source, f.CN, f.Serial, f.Thumbprint, f.Severity.String(), f.Code, f.Message})
+		if err != nil {
+			return err
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+type inventoryConnector struct {
+	*fake.Connector
+	infos []certificate.CertificateInfo
+	pems  map[string]string
+}
+
+func (c *inventoryConnector) ListCertificates(endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	return c.infos, nil
+}
+
+func (c *inventoryConnector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	return &certificate.PEMCollection{Certificate: c.pems[req.Thumbprint]}, nil
+}
+
+func codes(findings []Finding) map[string]Severity {
+	m := map[string]Severity{}
+	for _, f := range findings {
+		m[f.CN+" "+f.Code] = f.Severity
+	}
+	return m
+}
+
+func TestChain(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	rsaKey := func(bits int) *rsa.PublicKey {
+		return &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), uint(bits-1)), E: 65537}
+	}
+	root := &x509.Certificate{
+		Subject:            pkix.Name{CommonName: "Root"},
+		RawSubject:         []byte("root"),
+		RawIssuer:          []byte("root"),
+		IsCA:               true,
+		PublicKey:          rsaKey(2048),
+		SignatureAlgorithm: x509.SHA1WithRSA,
+		NotAfter:           now.AddDate(10, 0, 0),
+		SerialNumber:       big.NewInt(1),
+	}
+	intermediate := &x509.Certificate{
+		Subject:            pkix.Name{CommonName: "Intermediate"},
+		RawSubject:         []byte("intermediate"),
+		RawIssuer:          []byte("root"),
+		IsCA:               true,
+		PublicKey:          rsaKey(2048),
+		SignatureAlgorithm: x509.SHA256WithRSA,
+		NotAfter:           now.AddDate(0, -1, 0),
+		SerialNumber:       big.NewInt(2),
+	}
+	leaf := &x509.Certificate{
+		Subject:            pkix.Name{CommonName: "www.example.com"},
+		RawSubject:         []byte("leaf"),
+		RawIssuer:          []byte("intermediate"),
+		PublicKey:          rsaKey(1024),
+		SignatureAlgorithm: x509.SHA1WithRSA,
+		NotBefore:          time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:           time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		SerialNumber:       big.NewInt(3),
+	}
+
+	found := codes(Chain("1", []*x509.Certificate{leaf, intermediate, root}, now))
+	expected := map[string]Severity{
+		"www.example.com weak_rsa_key":                High,
+		"www.example.com weak_signature_algorithm":    High,
+		"www.example.com validity_exceeds_cabf_limit": Medium,
+		"Intermediate expired_intermediate":           High,
+	}
+	if len(found) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, found)
+	}
+	for code, severity := range expected {
+		if s, ok := found[code]; !ok || s != severity {
+			t.Errorf("expected %s %s, got %v", severity, code, found)
+		}
+	}
+
+	// the rules of 2018 allowed 825 days
+	leaf.PublicKey = rsaKey(2048)
+	leaf.SignatureAlgorithm = x509.SHA256WithRSA
+	leaf.NotBefore = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	leaf.NotAfter = leaf.NotBefore.AddDate(0, 0, 800)
+	intermediate.NotAfter = now.AddDate(1, 0, 0)
+	if findings := Chain("1", []*x509.Certificate{leaf, intermediate, root}, now); len(findings) != 0 {
+		t.Fatalf("unexpected findings %v", findings)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(10),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	conn := &inventoryConnector{
+		Connector: fake.NewConnector(false, nil),
+		infos: []certificate.CertificateInfo{
+			{ID: "1", CN: "127.0.0.1", Thumbprint: "A1", ValidTo: template.NotAfter},
+			{ID: "2", CN: "expired.example.com", Thumbprint: "B2", ValidTo: now.Add(-time.Hour)},
+		},
+		pems: map[string]string{"A1": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))},
+	}
+	a := &Auditor{Connector: conn, Endpoints: []string{addr, "127.0.0.1:1"}, DialTimeout: time.Second,
+		Now: func() time.Time { return now }}
+	findings, err := a.Audit(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Fatalf("the unreachable endpoint should be reported, got %v", err)
+	}
+	var sources []string
+	for _, f := range findings {
+		if f.Code != "validity_exceeds_cabf_limit" {
+			t.Errorf("unexpected finding %s", f)
+		}
+		sources = append(sources, f.Source)
+	}
+	if strings.Join(sources, ",") != "1,"+addr {
+		t.Fatalf("expected the findings of the certificate 1 and of %s, got %v", addr, findings)
+	}
+
+	var b bytes.Buffer
+	err = WriteCSV(&b, Filter(findings, Medium))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 3 ||
+		!strings.HasSuffix(lines[1], `,medium,validity_exceeds_cabf_limit,"the certificate issued on 2022-01-01 is valid 730 days, the CA/Browser Forum allows 398 days"`) {
+		t.Fatalf("unexpected CSV\n%s", b.String())
+	}
+	if len(Filter(findings, High)) != 0 {
+		t.Fatal("no finding is high")
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	s, err := ParseSeverity("HIGH")
+	if err != nil || s != High {
+		t.Fatalf("expected high, got %s %v", s, err)
+	}
+	if _, err = ParseSeverity("urgent"); err == nil {
+		t.Fatal("urgent isn't a severity")
+	}
+}
@@ -0,0 +1,265 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bootstrap
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/installer"
+)
+
+const retrieveTimeout = 180 * time.Second
+
+// Options change how Run treats the certificates already in the bundles
+type Options struct {
+	// Force requests every certificate, even the ones that are still good
+	Force bool
+	// RenewBefore requests the certificates that expire within it again, the others are kept when they still
+	// have the names of the plan
+	RenewBefore time.Duration
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+}
+
+// Result is what Run did with a certificate of the plan
+type Result struct {
+	Spec
+	// CertFile is the issued certificate, Serial its serial number
+	CertFile string
+	Serial   string
+	// Kept tells the certificate in the bundle was good and wasn't requested
+	Kept bool
+}
+
+// Run requests the certificates of the plan of the cluster that are missing, expiring or have other names, and
+// writes them with their keys and chain to the bundles, followed by the configuration snippet of each node. The
+// results are returned in the order of the plan, with the ones done before an error.
+func Run(ctx context.Context, connector endpoint.Connector, c *Cluster, opts Options) ([]Result, error) {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+	if c.Zone != "" {
+		connector.SetZone(c.Zone)
+	}
+	var results []Result
+	for _, spec := range c.Plan() {
+		res := Result{Spec: spec, CertFile: filepath.Join(spec.Dir, spec.File+".crt")}
+		if !opts.Force {
+			cert, err := readCertificate(res.CertFile)
+			if err == nil && cert.NotAfter.Sub(now()) > opts.RenewBefore && sameNames(cert, spec) {
+				res.Kept = true
+				res.Serial = strings.ToUpper(cert.SerialNumber.Text(16))
+				results = append(results, res)
+				continue
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		pcc, err := enroll(connector, c, spec)
+		if err != nil {
+			return results, fmt.Errorf("failed to request the %s certificate of %s: %w", spec.Role, spec.Owner, err)
+		}
+		err = os.MkdirAll(spec.Dir, 0755)
+		if err != nil {
+			return results, err
+		}
+		fi := &installer.FileInstaller{
+			CertFile:  res.CertFile,
+			ChainFile: filepath.Join(spec.Dir, "ca.crt"),
+			KeyFile:   filepath.Join(spec.Dir, spec.File+".key"),
+		}
+		err = fi.Install(ctx, pcc)
+		if err != nil {
+			return results, fmt.Errorf("failed to write the %s certificate of %s: %w", spec.Role, spec.Owner, err)
+		}
+		cert, err := readCertificate(res.CertFile)
+		if err != nil {
+			return results, err
+		}
+		res.Serial = strings.ToUpper(cert.SerialNumber.Text(16))
+		results = append(results, res)
+	}
+	for _, n := range c.Nodes {
+		err := writeConfig(c, n)
+		if err != nil {
+			return results, fmt.Errorf("failed to write the configuration of %s: %w", n.Name, err)
+		}
+	}
+	return results, nil
+}
+
+func enroll(connector endpoint.Connector, c *Cluster, spec Spec) (*certificate.PEMCollection, error) {
+	kt, err := c.keyType()
+	if err != nil {
+		return nil, err
+	}
+	b := certificate.NewRequestBuilder().
+		CommonName(spec.CommonName).
+		DNSNames(spec.DNSNames...).
+		IPAddresses(spec.IPAddresses...).
+		ExtKeyUsages(spec.ExtKeyUsages...).
+		KeyType(kt).
+		ValidityHours(c.ValidDays * 24).
+		ChainOption(certificate.ChainOptionRootLast)
+	if c.KeySize != 0 {
+		b.KeyLength(c.KeySize)
+	}
+	if c.KeyCurve != "" {
+		curve, err := certificate.ParseEllipticCurve(c.KeyCurve)
+		if err != nil {
+			return nil, err
+		}
+		b.KeyCurve(curve)
+	}
+	req, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	err = connector.GenerateRequest(nil, req)
+	if err != nil {
+		return nil, err
+	}
+	req.PickupID, err = connector.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	req.Timeout = retrieveTimeout
+	pcc, err := connector.RetrieveCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	err = pcc.AddPrivateKey(req.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pcc, nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%s is not a PEM certificate", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// sameNames tells whether cert has the common name and exactly the SANs of spec
+func sameNames(cert *x509.Certificate, spec Spec) bool {
+	if cert.Subject.CommonName != spec.CommonName {
+		return false
+	}
+	dns := map[string]bool{}
+	for _, n := range cert.DNSNames {
+		dns[strings.ToLower(n)] = true
+	}
+	expected := map[string]bool{}
+	for _, n := range spec.DNSNames {
+		expected[strings.ToLower(n)] = true
+	}
+	// the common name is added to the DNS names when it looks like one
+	if !expected[strings.ToLower(spec.CommonName)] {
+		delete(dns, strings.ToLower(spec.CommonName))
+	}
+	if len(dns) != len(expected) {
+		return false
+	}
+	for n := range expected {
+		if !dns[n] {
+			return false
+		}
+	}
+	if len(cert.IPAddresses) != len(spec.IPAddresses) {
+		return false
+	}
+	for _, ip := range spec.IPAddresses {
+		if !containsIP(cert.IPAddresses, ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConfig writes the TLS settings of a node using its bundle: etcd.env with the etcd environment variables,
+// or tls.conf to include in redis.conf
+func writeConfig(c *Cluster, n Node) error {
+	dir := filepath.Join(c.OutputDir, n.Name)
+	installDir := dir
+	if c.InstallDir != "" {
+		installDir = filepath.Join(c.InstallDir, n.Name)
+	} else if abs, err := filepath.Abs(dir); err == nil {
+		installDir = abs
+	}
+	path := func(file string) string {
+		return filepath.ToSlash(filepath.Join(installDir, file))
+	}
+	var name string
+	var lines []string
+	switch c.Kind {
+	case KindEtcd:
+		name = "etcd.env"
+		lines = []string{
+			"ETCD_NAME=" + n.Name,
+			"ETCD_CERT_FILE=" + path("server.crt"),
+			"ETCD_KEY_FILE=" + path("server.key"),
+			"ETCD_TRUSTED_CA_FILE=" + path("ca.crt"),
+			"ETCD_CLIENT_CERT_AUTH=true",
+			"ETCD_PEER_CERT_FILE=" + path("peer.crt"),
+			"ETCD_PEER_KEY_FILE=" + path("peer.key"),
+			"ETCD_PEER_TRUSTED_CA_FILE=" + path("ca.crt"),
+			"ETCD_PEER_CLIENT_CERT_AUTH=true",
+		}
+	case KindRedis:
+		name = "tls.conf"
+		lines = []string{
+			"port 0",
+			"tls-port 6379",
+			"tls-cert-file " + path("redis.crt"),
+			"tls-key-file " + path("redis.key"),
+			"tls-ca-cert-file " + path("ca.crt"),
+			"tls-auth-clients yes",
+			"tls-replication yes",
+			"tls-cluster yes",
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
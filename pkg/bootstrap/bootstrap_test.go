@@ -0,0 +1,180 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bootstrap
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const etcdCluster = `
+kind: etcd
+outputDir: certs
+installDir: /etc/etcd/pki
+keyType: ecdsa
+nodes:
+  - name: etcd-1
+    hosts: [etcd-1.example.com, 10.0.0.11]
+  - name: etcd-2
+    hosts: [etcd-2.example.com, 10.0.0.12]
+clients: [apiserver]
+`
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(etcdCluster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := c.Plan()
+	if len(specs) != 5 {
+		t.Fatalf("expected 5 certificates, got %d", len(specs))
+	}
+	server, peer := specs[0], specs[1]
+	if server.Role != RoleServer || len(server.DNSNames) != 2 || len(server.IPAddresses) != 3 {
+		t.Fatalf("unexpected server certificate %+v", server)
+	}
+	if peer.Role != RolePeer || len(peer.DNSNames) != 1 || len(peer.IPAddresses) != 1 || len(peer.ExtKeyUsages) != 2 {
+		t.Fatalf("unexpected peer certificate %+v", peer)
+	}
+	if client := specs[4]; client.Role != RoleClient || client.CommonName != "apiserver" || client.Dir != filepath.Join("certs", "clients", "apiserver") {
+		t.Fatalf("unexpected client certificate %+v", client)
+	}
+
+	invalid := []string{
+		"kind: consul\nnodes: [{name: a, hosts: [a]}]",
+		"kind: etcd",
+		"kind: etcd\nnodes: [{name: a, hosts: [a]}, {name: a, hosts: [b]}]",
+		"kind: etcd\nnodes: [{name: ../a, hosts: [a]}]",
+		"kind: etcd\nnodes: [{name: clients, hosts: [a]}]",
+		"kind: redis\nnodes: [{name: a}]",
+		"kind: redis\nnodes: [{name: a, hosts: [a]}]\nkeyType: dsa",
+		"kind: redis\nnodes: [{name: a, hosts: [a]}]\nunknown: true",
+	}
+	for _, data := range invalid {
+		if _, err := Parse([]byte(data)); !errors.Is(err, verror.UserDataError) {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := Parse([]byte(etcdCluster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.OutputDir = dir
+
+	results, err := Run(context.Background(), fake.NewConnector(false, nil), c, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("expected 5 results, got %d", len(results))
+	}
+	for _, file := range []string{"server.crt", "server.key", "peer.crt", "peer.key", "ca.crt", "etcd.env"} {
+		if _, err := os.Stat(filepath.Join(dir, "etcd-2", file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	peer, err := readCertificate(filepath.Join(dir, "etcd-1", "peer.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasExtKeyUsage(peer, x509.ExtKeyUsageServerAuth) || !hasExtKeyUsage(peer, x509.ExtKeyUsageClientAuth) {
+		t.Fatalf("peer certificate has extended key usages %v", peer.ExtKeyUsage)
+	}
+	client, err := readCertificate(filepath.Join(dir, "clients", "apiserver", "client.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasExtKeyUsage(client, x509.ExtKeyUsageServerAuth) || !hasExtKeyUsage(client, x509.ExtKeyUsageClientAuth) {
+		t.Fatalf("client certificate has extended key usages %v", client.ExtKeyUsage)
+	}
+	env, err := ioutil.ReadFile(filepath.Join(dir, "etcd-1", "etcd.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(env), "ETCD_PEER_CERT_FILE=/etc/etcd/pki/etcd-1/peer.crt\n") {
+		t.Fatalf("unexpected etcd configuration:\n%s", env)
+	}
+
+	// certificates with the names of the plan are kept, a node with a new host gets new ones
+	c.Nodes[1].Hosts = append(c.Nodes[1].Hosts, "etcd-2.internal")
+	results, err = Run(context.Background(), fake.NewConnector(false, nil), c, Options{RenewBefore: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Kept != (r.Owner != "etcd-2") {
+			t.Errorf("%s certificate of %s: kept is %v", r.Role, r.Owner, r.Kept)
+		}
+	}
+}
+
+func TestRunRedis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootstrap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := Parse([]byte("kind: redis\nnodes: [{name: redis-1, hosts: [redis-1.example.com]}]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.OutputDir = dir
+	if _, err = Run(context.Background(), fake.NewConnector(false, nil), c, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := readCertificate(filepath.Join(dir, "redis-1", "redis.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth) || !hasExtKeyUsage(cert, x509.ExtKeyUsageClientAuth) {
+		t.Fatalf("redis certificate has extended key usages %v", cert.ExtKeyUsage)
+	}
+	conf, err := ioutil.ReadFile(filepath.Join(dir, "redis-1", "tls.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(conf), "tls-replication yes") {
+		t.Fatalf("unexpected redis configuration:\n%s", conf)
+	}
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bootstrap issues the certificates of an etcd or Redis cluster from a cluster definition: the server,
+// peer and client certificates of every node with the names and extended key usages the cluster needs, written as
+// one bundle per node.
+package bootstrap
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Kind is the software of a cluster
+type Kind string
+
+const (
+	KindEtcd  Kind = "etcd"
+	KindRedis Kind = "redis"
+)
+
+// Cluster is a cluster definition file:
+//
+//	kind: etcd
+//	zone: DevOps\etcd
+//	outputDir: ./etcd-certs
+//	nodes:
+//	  - name: etcd-1
+//	    hosts: [etcd-1.example.com, 10.0.0.11]
+//	clients: [apiserver, backup]
+type Cluster struct {
+	Kind Kind   `yaml:"kind"`
+	Zone string `yaml:"zone,omitempty"`
+	// OutputDir is where the bundles are written, relative to the definition file. It's the current directory
+	// when empty.
+	OutputDir string `yaml:"outputDir,omitempty"`
+	// InstallDir is where the bundles are copied on the nodes, the paths of the configuration snippets are in it.
+	// They are the paths of the written files when it's empty.
+	InstallDir string   `yaml:"installDir,omitempty"`
+	KeyType    string   `yaml:"keyType,omitempty"`
+	KeySize    int      `yaml:"keySize,omitempty"`
+	KeyCurve   string   `yaml:"keyCurve,omitempty"`
+	ValidDays  int      `yaml:"validDays,omitempty"`
+	Nodes      []Node   `yaml:"nodes"`
+	Clients    []string `yaml:"clients,omitempty"`
+}
+
+// Node is a member of the cluster, its certificates are valid for the DNS names and IP addresses of Hosts
+type Node struct {
+	Name  string   `yaml:"name"`
+	Hosts []string `yaml:"hosts"`
+}
+
+// Role is what a certificate is used for in the cluster
+type Role string
+
+const (
+	// RoleServer certificates are presented to the clients of a node
+	RoleServer Role = "server"
+	// RolePeer certificates authenticate the etcd members to each other
+	RolePeer Role = "peer"
+	// RoleClient certificates authenticate the clients of the cluster
+	RoleClient Role = "client"
+)
+
+// Spec is a certificate of the cluster
+type Spec struct {
+	Role Role
+	// Owner is the node or the client the certificate belongs to
+	Owner        string
+	CommonName   string
+	DNSNames     []string
+	IPAddresses  []net.IP
+	ExtKeyUsages []x509.ExtKeyUsage
+	// Dir is the bundle the certificate is written to, File the base name of its certificate and key files
+	Dir  string
+	File string
+}
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Load reads and validates the cluster definition at path, a relative output directory is resolved from the
+// directory of the file
+func Load(path string) (*Cluster, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read cluster definition: %s", verror.UserDataError, err)
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(c.OutputDir) {
+		c.OutputDir = filepath.Join(filepath.Dir(path), c.OutputDir)
+	}
+	return c, nil
+}
+
+// Parse parses and validates a cluster definition, unknown keys are errors
+func Parse(data []byte) (*Cluster, error) {
+	c := &Cluster{}
+	err := yaml.UnmarshalStrict(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse cluster definition: %s", verror.UserDataError, err)
+	}
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate checks that the certificates of the cluster can be requested
+func (c *Cluster) Validate() error {
+	if c.Kind != KindEtcd && c.Kind != KindRedis {
+		return fmt.Errorf("%w: unknown cluster kind %q, use %s or %s", verror.UserDataError, c.Kind, KindEtcd, KindRedis)
+	}
+	if len(c.Nodes) == 0 {
+		return fmt.Errorf("%w: cluster has no nodes", verror.UserDataError)
+	}
+	if _, err := c.keyType(); err != nil {
+		return err
+	}
+	if c.KeyCurve != "" {
+		if _, err := certificate.ParseEllipticCurve(c.KeyCurve); err != nil {
+			return err
+		}
+	}
+	if c.ValidDays < 0 {
+		return fmt.Errorf("%w: validDays can't be negative", verror.UserDataError)
+	}
+	// node and client names are directory names of the bundles
+	names := map[string]bool{"clients": true}
+	for i, n := range c.Nodes {
+		if !nameRegexp.MatchString(n.Name) {
+			return fmt.Errorf("%w: node #%d: invalid name %q", verror.UserDataError, i+1, n.Name)
+		}
+		if names[n.Name] {
+			return fmt.Errorf("%w: node %q is defined twice or uses a reserved name", verror.UserDataError, n.Name)
+		}
+		names[n.Name] = true
+		if len(n.Hosts) == 0 {
+			return fmt.Errorf("%w: node %q has no hosts", verror.UserDataError, n.Name)
+		}
+	}
+	clients := map[string]bool{}
+	for _, name := range c.Clients {
+		if !nameRegexp.MatchString(name) {
+			return fmt.Errorf("%w: invalid client name %q", verror.UserDataError, name)
+		}
+		if clients[name] {
+			return fmt.Errorf("%w: client %q is defined twice", verror.UserDataError, name)
+		}
+		clients[name] = true
+	}
+	return nil
+}
+
+func (c *Cluster) keyType() (certificate.KeyType, error) {
+	var kt certificate.KeyType
+	if c.KeyType == "" {
+		return certificate.KeyTypeRSA, nil
+	}
+	if err := kt.Set(c.KeyType); err != nil {
+		return kt, fmt.Errorf("%w: unknown key type %q", verror.UserDataError, c.KeyType)
+	}
+	return kt, nil
+}
+
+// Plan returns the certificates of the cluster:
+//
+//   - etcd members get a server certificate for their hosts and the loopback addresses, and a peer certificate
+//     for their hosts that is also a client certificate, since members dial each other
+//   - Redis nodes get one certificate for their hosts and the loopback addresses that is both a server and a client
+//     certificate, used for the clients, the replication and the cluster bus
+//   - clients get a client certificate with their name as the common name
+func (c *Cluster) Plan() []Spec {
+	var specs []Spec
+	both := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, n := range c.Nodes {
+		dir := filepath.Join(c.OutputDir, n.Name)
+		dns, ips := splitHosts(n.Hosts)
+		local := Spec{
+			Role:         RoleServer,
+			Owner:        n.Name,
+			CommonName:   n.Name,
+			DNSNames:     appendName(dns, "localhost"),
+			IPAddresses:  appendIP(appendIP(ips, net.IPv4(127, 0, 0, 1)), net.IPv6loopback),
+			ExtKeyUsages: both,
+			Dir:          dir,
+		}
+		switch c.Kind {
+		case KindEtcd:
+			local.ExtKeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+			local.File = "server"
+			specs = append(specs, local, Spec{
+				Role:         RolePeer,
+				Owner:        n.Name,
+				CommonName:   n.Name,
+				DNSNames:     dns,
+				IPAddresses:  ips,
+				ExtKeyUsages: both,
+				Dir:          dir,
+				File:         "peer",
+			})
+		case KindRedis:
+			local.File = "redis"
+			specs = append(specs, local)
+		}
+	}
+	for _, name := range c.Clients {
+		specs = append(specs, Spec{
+			Role:         RoleClient,
+			Owner:        name,
+			CommonName:   name,
+			ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			Dir:          filepath.Join(c.OutputDir, "clients", name),
+			File:         "client",
+		})
+	}
+	return specs
+}
+
+func splitHosts(hosts []string) (dns []string, ips []net.IP) {
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			ips = appendIP(ips, ip)
+		} else {
+			dns = appendName(dns, h)
+		}
+	}
+	return dns, ips
+}
+
+func appendName(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(append([]string(nil), names...), name)
+}
+
+func appendIP(ips []net.IP, ip net.IP) []net.IP {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return ips
+		}
+	}
+	return append(append([]net.IP(nil), ips...), ip)
+}
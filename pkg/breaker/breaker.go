@@ -0,0 +1,208 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package breaker stops calling a platform endpoint that keeps failing. After Threshold consecutive failures the
+// circuit opens and calls fail right away with ErrCircuitOpen; once Cooldown has passed a single probe call is let
+// through (half-open) and its result closes the circuit again or reopens it.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	DefaultThreshold = 5
+	DefaultCooldown  = 30 * time.Second
+)
+
+// State of a circuit
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("unknown state %d", int(s))
+	}
+}
+
+// ErrCircuitOpen is returned instead of calling the endpoint while the circuit is open
+type ErrCircuitOpen struct {
+	// RetryAt is when the next probe call will be allowed
+	RetryAt time.Time
+}
+
+func (err ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("endpoint is failing, calls are suspended until %s", err.RetryAt.Format(time.RFC3339))
+}
+
+func (err ErrCircuitOpen) Unwrap() error {
+	return verror.ServerUnavailableError
+}
+
+func (err ErrCircuitOpen) Code() string {
+	return verror.CodeCircuitOpen
+}
+
+// Breaker is a circuit breaker, safe for concurrent use. The zero value uses the default threshold and cooldown.
+type Breaker struct {
+	// Threshold is the number of consecutive failures that opens the circuit
+	Threshold int
+	// Cooldown is how long the circuit stays open before a probe call is allowed
+	Cooldown time.Duration
+	// IsFailure tells which errors count as failures, it defaults to IsServerFailure
+	IsFailure func(err error) bool
+	// OnStateChange is called when the circuit changes state, when it's set. It must not call the Breaker.
+	OnStateChange func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// IsServerFailure reports errors that mean the endpoint itself is failing: responses with a 5xx status, an
+// unavailable server and network errors. Errors caused by the request, like a 4xx status, invalid data or a rejected
+// policy, don't count, and neither does rate limiting since the server is busy rather than failing.
+func IsServerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rateLimited endpoint.ErrRateLimited
+	if errors.As(err, &rateLimited) {
+		return false
+	}
+	var statusErr verror.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.Is(err, verror.ServerUnavailableError) || errors.As(err, &netErr)
+}
+
+// State returns the current state of the circuit
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !b.clock().Before(b.openedAt.Add(b.cooldown())) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Do calls fn unless the circuit is open, and records its result
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		retryAt := b.openedAt.Add(b.cooldown())
+		if b.clock().Before(retryAt) {
+			return ErrCircuitOpen{RetryAt: retryAt}
+		}
+		b.setState(HalfOpen)
+		b.probing = true
+		return nil
+	case HalfOpen:
+		if b.probing {
+			return ErrCircuitOpen{RetryAt: b.clock().Add(b.cooldown())}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(err error) {
+	isFailure := b.IsFailure
+	if isFailure == nil {
+		isFailure = IsServerFailure
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !isFailure(err) {
+		b.failures = 0
+		b.setState(Closed)
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold() {
+		b.openedAt = b.clock()
+		b.setState(Open)
+	}
+}
+
+func (b *Breaker) setState(s State) {
+	if b.state == s {
+		return
+	}
+	from := b.state
+	b.state = s
+	if b.OnStateChange != nil {
+		b.OnStateChange(from, s)
+	}
+}
+
+func (b *Breaker) threshold() int {
+	if b.Threshold <= 0 {
+		return DefaultThreshold
+	}
+	return b.Threshold
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return DefaultCooldown
+	}
+	return b.Cooldown
+}
+
+func (b *Breaker) clock() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
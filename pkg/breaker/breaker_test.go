@@ -0,0 +1,123 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+var errDown = fmt.Errorf("%w: connection refused", verror.ServerUnavailableError)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	var transitions []string
+	b := &Breaker{Threshold: 2, Cooldown: time.Minute, now: func() time.Time { return now },
+		OnStateChange: func(from, to State) { transitions = append(transitions, from.String()+">"+to.String()) }}
+	calls := 0
+	fail := func() error { calls++; return errDown }
+	succeed := func() error { calls++; return nil }
+
+	// request errors don't count as failures
+	_ = b.Do(func() error { return verror.UserDataError })
+	_ = b.Do(fail)
+	if b.State() != Closed {
+		t.Fatal("circuit should stay closed under the threshold")
+	}
+	_ = b.Do(fail)
+	if b.State() != Open {
+		t.Fatal("circuit should open at the threshold")
+	}
+	err := b.Do(succeed)
+	var open ErrCircuitOpen
+	if !errors.As(err, &open) || !errors.Is(err, verror.ServerUnavailableError) || calls != 2 {
+		t.Fatalf("open circuit should fail fast, got %v after %d calls", err, calls)
+	}
+
+	now = now.Add(time.Minute)
+	if b.State() != HalfOpen {
+		t.Fatal("circuit should be half-open after the cooldown")
+	}
+	_ = b.Do(fail)
+	if b.State() != Open {
+		t.Fatal("failed probe should reopen the circuit")
+	}
+
+	now = now.Add(time.Minute)
+	err = b.Do(succeed)
+	if err != nil || b.State() != Closed {
+		t.Fatalf("successful probe should close the circuit, got %v, %s", err, b.State())
+	}
+	expected := "closed>open open>half-open half-open>open open>half-open half-open>closed"
+	if fmt.Sprint(transitions) != "["+expected+"]" {
+		t.Fatalf("unexpected transitions %v", transitions)
+	}
+}
+
+func TestIsServerFailure(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		failure bool
+	}{
+		{"success", nil, false},
+		{"user data", fmt.Errorf("%w: bad zone", verror.UserDataError), false},
+		{"bad request", fmt.Errorf("%w: can't import", verror.ServerBadDataResponce), false},
+		{"rejected request", verror.NewStatusError(400, fmt.Errorf("%w: invalid CSR", verror.ServerError)), false},
+		{"forbidden", verror.NewStatusError(403, errors.New("unexpected status code on TPP Authorize")), false},
+		{"rate limited", endpoint.ErrRateLimited{RetryAfter: time.Second}, false},
+		{"undecodable response", fmt.Errorf("%w: invalid character", verror.ServerError), false},
+		{"internal server error", verror.NewStatusError(500, errors.New("Unexpected status code on TPP Certificate Request")), true},
+		{"bad gateway", verror.NewStatusError(502, fmt.Errorf("%w: zone read", verror.ServerError)), true},
+		{"unavailable", errDown, true},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+	}
+	for _, c := range cases {
+		if failure := IsServerFailure(c.err); failure != c.failure {
+			t.Errorf("%s: expected failure %v, got %v for %v", c.name, c.failure, failure, c.err)
+		}
+	}
+}
+
+type downConnector struct {
+	*fake.Connector
+}
+
+func (c downConnector) Ping() error {
+	return errDown
+}
+
+func TestConnector(t *testing.T) {
+	c := NewConnector(downConnector{fake.NewConnector(false, nil)}, &Breaker{Threshold: 1, Cooldown: time.Hour})
+	if err := c.Ping(); err != errDown {
+		t.Fatalf("expected endpoint error, got %v", err)
+	}
+	var open ErrCircuitOpen
+	if err := c.Ping(); !errors.As(err, &open) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if _, err := c.ReadZoneConfiguration(); !errors.As(err, &open) {
+		t.Fatalf("circuit should be shared by all calls, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package breaker
+
+import (
+	"context"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/policy"
+)
+
+// Connector guards the calls a connector makes to the platform with a Breaker. Calls that don't reach the platform
+// are passed through.
+type Connector struct {
+	endpoint.Connector
+	Breaker *Breaker
+}
+
+// NewConnector wraps c with b. Connectors sharing an endpoint should share the Breaker.
+func NewConnector(c endpoint.Connector, b *Breaker) *Connector {
+	return &Connector{Connector: c, Breaker: b}
+}
+
+func (c *Connector) GetZonesByParent(parent string) (zones []string, err error) {
+	err = c.Breaker.Do(func() error {
+		zones, err = c.Connector.GetZonesByParent(parent)
+		return err
+	})
+	return
+}
+
+func (c *Connector) Ping() error {
+	return c.Breaker.Do(c.Connector.Ping)
+}
+
+func (c *Connector) PingContext(ctx context.Context) error {
+	return c.Breaker.Do(func() error {
+		return c.Connector.PingContext(ctx)
+	})
+}
+
+func (c *Connector) Authenticate(auth *endpoint.Authentication) error {
+	return c.Breaker.Do(func() error {
+		return c.Connector.Authenticate(auth)
+	})
+}
+
+func (c *Connector) ReadPolicyConfiguration() (p *endpoint.Policy, err error) {
+	err = c.Breaker.Do(func() error {
+		p, err = c.Connector.ReadPolicyConfiguration()
+		return err
+	})
+	return
+}
+
+func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration, err error) {
+	err = c.Breaker.Do(func() error {
+		config, err = c.Connector.ReadZoneConfiguration()
+		return err
+	})
+	return
+}
+
+func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) error {
+	return c.Breaker.Do(func() error {
+		return c.Connector.GenerateRequest(config, req)
+	})
+}
+
+func (c *Connector) RequestCertificate(req *certificate.Request) (requestID string, err error) {
+	err = c.Breaker.Do(func() error {
+		requestID, err = c.Connector.RequestCertificate(req)
+		return err
+	})
+	return
+}
+
+func (c *Connector) RetrieveCertificate(req *certificate.Request) (pcc *certificate.PEMCollection, err error) {
+	err = c.Breaker.Do(func() error {
+		pcc, err = c.Connector.RetrieveCertificate(req)
+		return err
+	})
+	return
+}
+
+func (c *Connector) IsCSRServiceGenerated(req *certificate.Request) (generated bool, err error) {
+	err = c.Breaker.Do(func() error {
+		generated, err = c.Connector.IsCSRServiceGenerated(req)
+		return err
+	})
+	return
+}
+
+func (c *Connector) CancelRequest(pickupID string) error {
+	return c.Breaker.Do(func() error {
+		return c.Connector.CancelRequest(pickupID)
+	})
+}
+
+func (c *Connector) RevokeCertificate(req *certificate.RevocationRequest) error {
+	return c.Breaker.Do(func() error {
+		return c.Connector.RevokeCertificate(req)
+	})
+}
+
+func (c *Connector) RenewCertificate(req *certificate.RenewalRequest) (requestID string, err error) {
+	err = c.Breaker.Do(func() error {
+		requestID, err = c.Connector.RenewCertificate(req)
+		return err
+	})
+	return
+}
+
+func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (resp *certificate.ImportResponse, err error) {
+	err = c.Breaker.Do(func() error {
+		resp, err = c.Connector.ImportCertificate(req)
+		return err
+	})
+	return
+}
+
+func (c *Connector) ListCertificates(filter endpoint.Filter) (infos []certificate.CertificateInfo, err error) {
+	err = c.Breaker.Do(func() error {
+		infos, err = c.Connector.ListCertificates(filter)
+		return err
+	})
+	return
+}
+
+func (c *Connector) SetPolicy(name string, ps *policy.PolicySpecification) (status string, err error) {
+	err = c.Breaker.Do(func() error {
+		status, err = c.Connector.SetPolicy(name, ps)
+		return err
+	})
+	return
+}
+
+func (c *Connector) GetPolicy(name string) (ps *policy.PolicySpecification, err error) {
+	err = c.Breaker.Do(func() error {
+		ps, err = c.Connector.GetPolicy(name)
+		return err
+	})
+	return
+}
+
+func (c *Connector) RequestSSHCertificate(req *certificate.SshCertRequest) (resp *certificate.SshCertificateObject, err error) {
+	err = c.Breaker.Do(func() error {
+		resp, err = c.Connector.RequestSSHCertificate(req)
+		return err
+	})
+	return
+}
+
+func (c *Connector) RetrieveSSHCertificate(req *certificate.SshCertRequest) (resp *certificate.SshCertificateObject, err error) {
+	err = c.Breaker.Do(func() error {
+		resp, err = c.Connector.RetrieveSSHCertificate(req)
+		return err
+	})
+	return
+}
+
+func (c *Connector) RetrieveSshConfig(ca *certificate.SshCaTemplateRequest) (config *certificate.SshConfig, err error) {
+	err = c.Breaker.Do(func() error {
+		config, err = c.Connector.RetrieveSshConfig(ca)
+		return err
+	})
+	return
+}
+
+func (c *Connector) SearchCertificates(req *certificate.SearchRequest) (resp *certificate.CertSearchResponse, err error) {
+	err = c.Breaker.Do(func() error {
+		resp, err = c.Connector.SearchCertificates(req)
+		return err
+	})
+	return
+}
+
+func (c *Connector) RetrieveAvailableSSHTemplates() (templates []certificate.SshAvaliableTemplate, err error) {
+	err = c.Breaker.Do(func() error {
+		templates, err = c.Connector.RetrieveAvailableSSHTemplates()
+		return err
+	})
+	return
+}
+
+func (c *Connector) RetrieveCertificateMetaData(dn string) (data *certificate.CertificateMetaData, err error) {
+	err = c.Breaker.Do(func() error {
+		data, err = c.Connector.RetrieveCertificateMetaData(dn)
+		return err
+	})
+	return
+}
@@ -0,0 +1,519 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// RequestBuilder builds a Request, validating and normalizing the values as they are set:
+//
+//	req, err := certificate.NewRequestBuilder().
+//		CommonName("www.example.com").
+//		DNSNames("example.com").
+//		KeyType(certificate.KeyTypeECDSA).
+//		KeyCurve(certificate.EllipticCurveP256).
+//		Build()
+//
+// DNS names are lowercased and converted to A-labels, duplicated SANs are dropped and a common name that is a DNS
+// name is added to the DNS SANs. The first invalid value is reported by Build.
+type RequestBuilder struct {
+	req     Request
+	profile Profile
+	err     error
+}
+
+// NewRequestBuilder returns a builder for a locally generated RSA 2048 request
+func NewRequestBuilder() *RequestBuilder {
+	b := &RequestBuilder{}
+	b.req.KeyType = KeyTypeRSA
+	b.req.KeyLength = defaultRSAlength
+	return b
+}
+
+// NewRequestBuilderFrom returns a builder for a locally generated request reissuing cert: it starts with the subject,
+// the SANs and the key parameters of cert, which the other methods add to or change, and RemoveSANs drops the SANs
+// the new certificate shouldn't have
+func NewRequestBuilderFrom(cert *x509.Certificate) *RequestBuilder {
+	b := NewRequestBuilder()
+	if cert.Subject.CommonName != "" {
+		b.CommonName(cert.Subject.CommonName)
+	}
+	b.Organization(cert.Subject.Organization...).
+		OrganizationalUnits(cert.Subject.OrganizationalUnit...).
+		Locality(cert.Subject.Locality...).
+		Province(cert.Subject.Province...).
+		Country(cert.Subject.Country...).
+		DNSNames(cert.DNSNames...).
+		IPAddresses(cert.IPAddresses...).
+		EmailAddresses(cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		b.URIs(u.String())
+	}
+	upns, err := getUserPrincipalNameSANs(cert)
+	if err != nil {
+		return b.fail("failed to read the user principal names of the certificate: %s", err)
+	}
+	b.UPNs(upns...)
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		// the size is kept even when it's not one of AllSupportedKeySizes, the platform decides whether it's allowed
+		b.req.KeyType = KeyTypeRSA
+		b.req.KeyLength = pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		curve := ellipticCurveOf(pub)
+		if curve == EllipticCurveNotSet {
+			return b.fail("unsupported elliptic curve %s of the certificate", pub.Curve.Params().Name)
+		}
+		b.KeyType(KeyTypeECDSA).KeyCurve(curve)
+	default:
+		return b.fail("unsupported %T key of the certificate", cert.PublicKey)
+	}
+	return b
+}
+
+func (b *RequestBuilder) fail(format string, args ...interface{}) *RequestBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("%w: "+format, append([]interface{}{verror.UserDataError}, args...)...)
+	}
+	return b
+}
+
+func (b *RequestBuilder) CommonName(cn string) *RequestBuilder {
+	cn = strings.TrimSpace(cn)
+	if cn == "" {
+		return b.fail("common name is empty")
+	}
+	if looksLikeDNSName(cn) {
+		n, err := normalizeDNSName(cn)
+		if err != nil {
+			b.err = firstErr(b.err, err)
+			return b
+		}
+		// an internationalized name is converted by Build, depending on KeepUnicodeCommonName
+		if isASCII(cn) {
+			cn = n
+		}
+	}
+	b.req.Subject.CommonName = cn
+	return b
+}
+
+// KeepUnicodeCommonName keeps an internationalized common name in Unicode in the subject, its A-label is used
+// in the DNS SANs
+func (b *RequestBuilder) KeepUnicodeCommonName(keep bool) *RequestBuilder {
+	b.req.KeepUnicodeCommonName = keep
+	return b
+}
+
+func (b *RequestBuilder) Organization(org ...string) *RequestBuilder {
+	b.req.Subject.Organization = appendNonEmpty(b.req.Subject.Organization, org)
+	return b
+}
+
+func (b *RequestBuilder) OrganizationalUnits(ou ...string) *RequestBuilder {
+	b.req.Subject.OrganizationalUnit = appendNonEmpty(b.req.Subject.OrganizationalUnit, ou)
+	return b
+}
+
+func (b *RequestBuilder) Locality(l ...string) *RequestBuilder {
+	b.req.Subject.Locality = appendNonEmpty(b.req.Subject.Locality, l)
+	return b
+}
+
+func (b *RequestBuilder) Province(p ...string) *RequestBuilder {
+	b.req.Subject.Province = appendNonEmpty(b.req.Subject.Province, p)
+	return b
+}
+
+func (b *RequestBuilder) Country(c ...string) *RequestBuilder {
+	for _, country := range c {
+		if len(country) != 2 {
+			return b.fail("country %q is not a two letter code", country)
+		}
+		b.req.Subject.Country = append(b.req.Subject.Country, strings.ToUpper(country))
+	}
+	return b
+}
+
+func (b *RequestBuilder) DNSNames(names ...string) *RequestBuilder {
+	for _, name := range names {
+		n, err := normalizeDNSName(name)
+		if err != nil {
+			b.err = firstErr(b.err, err)
+			return b
+		}
+		if containsString(b.req.DNSNames, n) {
+			b.req.Warn(WarningSANDeduplicated, "DNS name %s is requested more than once", n)
+		} else {
+			b.req.DNSNames = append(b.req.DNSNames, n)
+		}
+	}
+	return b
+}
+
+func (b *RequestBuilder) IPAddresses(ips ...net.IP) *RequestBuilder {
+	for _, ip := range ips {
+		if ip == nil || ip.IsUnspecified() {
+			return b.fail("invalid IP address %q", ip)
+		}
+		duplicate := false
+		for _, existing := range b.req.IPAddresses {
+			if existing.Equal(ip) {
+				duplicate = true
+			}
+		}
+		if duplicate {
+			b.req.Warn(WarningSANDeduplicated, "IP address %s is requested more than once", ip)
+		} else {
+			b.req.IPAddresses = append(b.req.IPAddresses, ip)
+		}
+	}
+	return b
+}
+
+func (b *RequestBuilder) EmailAddresses(emails ...string) *RequestBuilder {
+	for _, email := range emails {
+		at := strings.LastIndex(email, "@")
+		if at <= 0 || at == len(email)-1 {
+			return b.fail("invalid email address %q", email)
+		}
+		domain, err := normalizeDNSName(email[at+1:])
+		if err != nil {
+			b.err = firstErr(b.err, err)
+			return b
+		}
+		email = email[:at+1] + domain
+		if containsString(b.req.EmailAddresses, email) {
+			b.req.Warn(WarningSANDeduplicated, "email address %s is requested more than once", email)
+		} else {
+			b.req.EmailAddresses = append(b.req.EmailAddresses, email)
+		}
+	}
+	return b
+}
+
+func (b *RequestBuilder) URIs(uris ...string) *RequestBuilder {
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" {
+			return b.fail("invalid URI %q", s)
+		}
+		duplicate := false
+		for _, existing := range b.req.URIs {
+			if existing.String() == u.String() {
+				duplicate = true
+			}
+		}
+		if duplicate {
+			b.req.Warn(WarningSANDeduplicated, "URI %s is requested more than once", u)
+		} else {
+			b.req.URIs = append(b.req.URIs, u)
+		}
+	}
+	return b
+}
+
+func (b *RequestBuilder) UPNs(upns ...string) *RequestBuilder {
+	for _, upn := range upns {
+		if !strings.Contains(upn, "@") {
+			return b.fail("invalid user principal name %q", upn)
+		}
+		if containsString(b.req.UPNs, upn) {
+			b.req.Warn(WarningSANDeduplicated, "user principal name %s is requested more than once", upn)
+		} else {
+			b.req.UPNs = append(b.req.UPNs, upn)
+		}
+	}
+	return b
+}
+
+// RemoveSANs removes the SANs of any type equal to one of values. A value that isn't a SAN of the request is an
+// error, it's likely misspelled. A DNS name equal to the common name is still added by Build.
+func (b *RequestBuilder) RemoveSANs(values ...string) *RequestBuilder {
+	for _, value := range values {
+		removed := false
+		keep := func(matches bool) bool {
+			removed = removed || matches
+			return !matches
+		}
+		dnsName, err := normalizeDNSName(value)
+		if err != nil {
+			dnsName = value
+		}
+		ip := net.ParseIP(value)
+		dnsNames := b.req.DNSNames[:0]
+		for _, n := range b.req.DNSNames {
+			if keep(n == dnsName) {
+				dnsNames = append(dnsNames, n)
+			}
+		}
+		b.req.DNSNames = dnsNames
+		ips := b.req.IPAddresses[:0]
+		for _, existing := range b.req.IPAddresses {
+			if keep(ip != nil && existing.Equal(ip)) {
+				ips = append(ips, existing)
+			}
+		}
+		b.req.IPAddresses = ips
+		emails := b.req.EmailAddresses[:0]
+		for _, email := range b.req.EmailAddresses {
+			if keep(strings.EqualFold(email, value)) {
+				emails = append(emails, email)
+			}
+		}
+		b.req.EmailAddresses = emails
+		uris := b.req.URIs[:0]
+		for _, u := range b.req.URIs {
+			if keep(u.String() == value) {
+				uris = append(uris, u)
+			}
+		}
+		b.req.URIs = uris
+		upns := b.req.UPNs[:0]
+		for _, upn := range b.req.UPNs {
+			if keep(upn == value) {
+				upns = append(upns, upn)
+			}
+		}
+		b.req.UPNs = upns
+		if !removed {
+			return b.fail("%q is not a subject alternative name of the request", value)
+		}
+	}
+	return b
+}
+
+func (b *RequestBuilder) KeyType(kt KeyType) *RequestBuilder {
+	switch kt {
+	case KeyTypeRSA:
+		if b.req.KeyLength == 0 {
+			b.req.KeyLength = defaultRSAlength
+		}
+	case KeyTypeECDSA:
+		if b.req.KeyCurve == EllipticCurveNotSet {
+			b.req.KeyCurve = EllipticCurveDefault
+		}
+	default:
+		return b.fail("unknown key type %d", kt)
+	}
+	b.req.KeyType = kt
+	return b
+}
+
+func (b *RequestBuilder) KeyLength(length int) *RequestBuilder {
+	for _, size := range AllSupportedKeySizes() {
+		if size == length {
+			b.req.KeyLength = length
+			return b
+		}
+	}
+	return b.fail("unsupported key size %d, expected one of %v", length, AllSupportedKeySizes())
+}
+
+// KeyCurve sets the curve of an ECDSA key. Brainpool curves need a service generated CSR.
+func (b *RequestBuilder) KeyCurve(curve EllipticCurve) *RequestBuilder {
+	for _, c := range append(AllSupportedCurves(), BrainpoolCurves()...) {
+		if c == curve {
+			b.req.KeyCurve = curve
+			return b
+		}
+	}
+	return b.fail("unsupported elliptic curve %d", curve)
+}
+
+func (b *RequestBuilder) KeyPassword(password string) *RequestBuilder {
+	b.req.KeyPassword = password
+	return b
+}
+
+func (b *RequestBuilder) CsrOrigin(origin CSrOriginOption) *RequestBuilder {
+	if origin == UserProvidedCSR {
+		return b.fail("user provided CSRs can't be built, use Request.SetCSR")
+	}
+	b.req.CsrOrigin = origin
+	return b
+}
+
+func (b *RequestBuilder) ChainOption(option ChainOption) *RequestBuilder {
+	b.req.ChainOption = option
+	return b
+}
+
+func (b *RequestBuilder) ChainPreference(preference ChainPreference) *RequestBuilder {
+	b.req.ChainPreference = preference
+	return b
+}
+
+// ChainRoot pins the root of the chain by its SHA-1 or SHA-256 fingerprint, in hex with optional colons
+func (b *RequestBuilder) ChainRoot(fingerprint string) *RequestBuilder {
+	if normalizeFingerprint(fingerprint) == "" {
+		return b.fail("%q is not a SHA-1 or SHA-256 fingerprint", fingerprint)
+	}
+	b.req.ChainRoot = fingerprint
+	return b
+}
+
+func (b *RequestBuilder) ValidityHours(hours int) *RequestBuilder {
+	if hours < 0 {
+		return b.fail("validity can't be negative")
+	}
+	b.req.ValidityHours = hours
+	return b
+}
+
+func (b *RequestBuilder) FriendlyName(name string) *RequestBuilder {
+	b.req.FriendlyName = name
+	return b
+}
+
+func (b *RequestBuilder) ExtKeyUsages(usages ...x509.ExtKeyUsage) *RequestBuilder {
+	for _, u := range usages {
+		if _, ok := extKeyUsageOIDs[u]; !ok {
+			return b.fail("unsupported extended key usage %d", u)
+		}
+		if !containsExtKeyUsage(b.req.ExtKeyUsages, u) {
+			b.req.ExtKeyUsages = append(b.req.ExtKeyUsages, u)
+		}
+	}
+	return b
+}
+
+// Profile makes the request one of a certificate that isn't for TLS, checked by Profile.Apply in Build. The common
+// name isn't added to the DNS names then, and the RSA key size is raised to the minimum of the profile.
+func (b *RequestBuilder) Profile(p Profile) *RequestBuilder {
+	if p.ExtKeyUsages() == nil {
+		return b.fail("unknown certificate profile %q", string(p))
+	}
+	b.profile = p
+	if b.req.KeyType == KeyTypeRSA && b.req.KeyLength < p.MinKeyLength() {
+		b.req.KeyLength = p.MinKeyLength()
+	}
+	return b
+}
+
+func (b *RequestBuilder) CustomField(name, value string) *RequestBuilder {
+	if name == "" {
+		return b.fail("custom field name is empty")
+	}
+	b.req.CustomFields = append(b.req.CustomFields, CustomField{Name: name, Value: value})
+	return b
+}
+
+// Build returns the Request, or the first validation error. Each call returns a new Request that shares nothing
+// with the builder, so changing the builder afterwards doesn't change requests already built.
+func (b *RequestBuilder) Build() (*Request, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	cn := b.req.Subject.CommonName
+	if cn == "" && len(b.req.DNSNames) == 0 && len(b.req.IPAddresses) == 0 && len(b.req.EmailAddresses) == 0 &&
+		len(b.req.URIs) == 0 && len(b.req.UPNs) == 0 {
+		return nil, fmt.Errorf("%w: request needs a common name or a subject alternative name", verror.UserDataError)
+	}
+	if b.req.KeyType == KeyTypeECDSA && b.req.KeyCurve.IsBrainpool() && b.req.CsrOrigin != ServiceGeneratedCSR {
+		return nil, fmt.Errorf("%w: %s keys can't be generated locally, use a service generated CSR", verror.UserDataError, b.req.KeyCurve.String())
+	}
+	req := b.req
+	req.DNSNames = append([]string(nil), b.req.DNSNames...)
+	if b.profile == "" && looksLikeDNSName(cn) {
+		if !isASCII(cn) {
+			// already validated by CommonName
+			cn, _ = normalizeDNSName(cn)
+			if !req.KeepUnicodeCommonName {
+				req.Subject.CommonName = cn
+			}
+		}
+		if !containsString(req.DNSNames, cn) {
+			req.DNSNames = append([]string{cn}, req.DNSNames...)
+		}
+	}
+	req.Subject.Organization = append([]string(nil), b.req.Subject.Organization...)
+	req.Subject.OrganizationalUnit = append([]string(nil), b.req.Subject.OrganizationalUnit...)
+	req.Subject.Locality = append([]string(nil), b.req.Subject.Locality...)
+	req.Subject.Province = append([]string(nil), b.req.Subject.Province...)
+	req.Subject.Country = append([]string(nil), b.req.Subject.Country...)
+	req.EmailAddresses = append([]string(nil), b.req.EmailAddresses...)
+	req.UPNs = append([]string(nil), b.req.UPNs...)
+	req.CustomFields = append([]CustomField(nil), b.req.CustomFields...)
+	req.ExtKeyUsages = append([]x509.ExtKeyUsage(nil), b.req.ExtKeyUsages...)
+	req.Warnings = append([]Warning(nil), b.req.Warnings...)
+	req.IPAddresses = nil
+	for _, ip := range b.req.IPAddresses {
+		req.IPAddresses = append(req.IPAddresses, append(net.IP(nil), ip...))
+	}
+	req.URIs = nil
+	for _, u := range b.req.URIs {
+		c := *u
+		req.URIs = append(req.URIs, &c)
+	}
+	if b.profile != "" {
+		err := b.profile.Apply(&req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &req, nil
+}
+
+// looksLikeDNSName tells whether a common name is meant as a host name: it has a dot and no space, and isn't an
+// IP address
+func looksLikeDNSName(cn string) bool {
+	return strings.Contains(cn, ".") && !strings.ContainsAny(cn, " @/") && net.ParseIP(cn) == nil
+}
+
+func appendNonEmpty(values []string, add []string) []string {
+	for _, v := range add {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsExtKeyUsage(values []x509.ExtKeyUsage, u x509.ExtKeyUsage) bool {
+	for _, v := range values {
+		if v == u {
+			return true
+		}
+	}
+	return false
+}
+
+func firstErr(current, err error) error {
+	if current != nil {
+		return current
+	}
+	return err
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestPunycodeEncode(t *testing.T) {
+	cases := map[string]string{
+		"bücher":            "bcher-kva",
+		"münchen":           "mnchen-3ya",
+		"他们为什么不说中文":         "ihqwcrb4cv8a8dqg056pqjye",
+		"ليهمابتكلموشعربي؟": "egbpdaj6bu4bxfgehfvwxn",
+	}
+	for in, expected := range cases {
+		if out := punycodeEncode(in); out != expected {
+			t.Errorf("punycodeEncode(%q) = %q, expected %q", in, out, expected)
+		}
+	}
+}
+
+func TestRequestBuilder(t *testing.T) {
+	b := NewRequestBuilder().
+		CommonName("WWW.Example.com").
+		DNSNames("example.com", "EXAMPLE.com.", "bücher.example.com", "*.example.com").
+		IPAddresses(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.1")).
+		EmailAddresses("admin@Example.com").
+		KeyType(KeyTypeECDSA)
+	req, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"www.example.com", "example.com", "xn--bcher-kva.example.com", "*.example.com"}
+	if len(req.DNSNames) != len(expected) {
+		t.Fatalf("unexpected DNS names %v", req.DNSNames)
+	}
+	for i := range expected {
+		if req.DNSNames[i] != expected[i] {
+			t.Fatalf("unexpected DNS names %v", req.DNSNames)
+		}
+	}
+	if len(req.IPAddresses) != 1 || req.EmailAddresses[0] != "admin@example.com" {
+		t.Fatalf("unexpected SANs %v %v", req.IPAddresses, req.EmailAddresses)
+	}
+	if req.KeyType != KeyTypeECDSA || req.KeyCurve != EllipticCurveDefault {
+		t.Fatalf("unexpected key parameters %s %s", req.KeyType.String(), req.KeyCurve.String())
+	}
+
+	// requests already built don't change with the builder
+	b.DNSNames("later.example.com")
+	if len(req.DNSNames) != len(expected) {
+		t.Fatal("built request was modified by the builder")
+	}
+
+	invalid := []*RequestBuilder{
+		NewRequestBuilder(),
+		NewRequestBuilder().CommonName("bad..example.com"),
+		NewRequestBuilder().CommonName("example.com").DNSNames("-bad.example.com"),
+		NewRequestBuilder().CommonName("example.com").KeyLength(1000),
+		NewRequestBuilder().CommonName("example.com").Country("USA"),
+		NewRequestBuilder().CommonName("example.com").EmailAddresses("nobody"),
+		NewRequestBuilder().CommonName("example.com").URIs("not a uri"),
+		NewRequestBuilder().CommonName("example.com").KeyType(KeyTypeECDSA).KeyCurve(EllipticCurveBrainpoolP256r1),
+	}
+	for i, b := range invalid {
+		if _, err := b.Build(); !errors.Is(err, verror.UserDataError) {
+			t.Errorf("builder #%d: expected user data error, got %v", i, err)
+		}
+	}
+
+	req, err = NewRequestBuilder().CommonName("example.com").KeyType(KeyTypeECDSA).KeyCurve(EllipticCurveBrainpoolP384r1).
+		CsrOrigin(ServiceGeneratedCSR).Build()
+	if err != nil || req.KeyCurve != EllipticCurveBrainpoolP384r1 {
+		t.Fatalf("expected a brainpoolP384r1 request, got %v", err)
+	}
+}
+
+func TestRequestBuilderExtKeyUsages(t *testing.T) {
+	req, err := NewRequestBuilder().CommonName("etcd-1").KeyType(KeyTypeECDSA).
+		ExtKeyUsages(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ExtKeyUsages) != 2 {
+		t.Fatalf("unexpected extended key usages %v", req.ExtKeyUsages)
+	}
+	if err = req.GeneratePrivateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err = req.GenerateCSR(); err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(req.GetCSR())
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, ext := range csr.Extensions {
+		if ext.Id.Equal(oidExtensionExtKeyUsage) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("extended key usage extension isn't requested in the CSR")
+	}
+
+	if _, err = NewRequestBuilder().CommonName("etcd-1").ExtKeyUsages(x509.ExtKeyUsage(100)).Build(); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected user data error, got %v", err)
+	}
+}
+
+func TestRequestBuilderProfile(t *testing.T) {
+	req, err := NewRequestBuilder().CommonName("Example Software Inc.").Organization("Example Software Inc.").
+		Profile(ProfileCodeSigning).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.DNSNames) != 0 || req.KeyLength != 3072 || !containsExtKeyUsage(req.ExtKeyUsages, x509.ExtKeyUsageCodeSigning) {
+		t.Fatalf("unexpected code signing request: names %v, key size %d, usages %v", req.DNSNames, req.KeyLength, req.ExtKeyUsages)
+	}
+
+	req, err = NewRequestBuilder().EmailAddresses("alice@example.com").Profile(ProfileEmailProtection).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Subject.CommonName != "alice@example.com" || !containsExtKeyUsage(req.ExtKeyUsages, x509.ExtKeyUsageEmailProtection) {
+		t.Fatalf("unexpected email protection request: %s, usages %v", req.Subject.CommonName, req.ExtKeyUsages)
+	}
+
+	invalid := map[string]*RequestBuilder{
+		"no organization": NewRequestBuilder().CommonName("Example").Profile(ProfileCodeSigning),
+		"small key":       NewRequestBuilder().CommonName("Example").Organization("Example").Profile(ProfileCodeSigning).KeyLength(2048),
+		"DNS name":        NewRequestBuilder().CommonName("Example").Organization("Example").DNSNames("example.com").Profile(ProfileCodeSigning),
+		"no email":        NewRequestBuilder().CommonName("Alice").Profile(ProfileEmailProtection),
+		"other email":     NewRequestBuilder().CommonName("bob@example.com").EmailAddresses("alice@example.com").Profile(ProfileEmailProtection),
+		"local domain":    NewRequestBuilder().EmailAddresses("alice@localhost").Profile(ProfileEmailProtection),
+		"unknown":         NewRequestBuilder().CommonName("Alice").Profile(Profile("tls")),
+	}
+	for name, b := range invalid {
+		if _, err = b.Build(); !errors.Is(err, verror.UserDataError) {
+			t.Errorf("%s: expected user data error, got %v", name, err)
+		}
+	}
+	for _, email := range []string{"Alice <alice@example.com>", "alice.example.com", "alice@[192.0.2.1]", "allée@example.com"} {
+		err = ProfileEmailProtection.Apply(&Request{EmailAddresses: []string{email}})
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("%s: expected user data error, got %v", email, err)
+		}
+	}
+	if p, err := ParseProfile("smime"); err != nil || p != ProfileEmailProtection {
+		t.Fatalf("unexpected profile %q: %v", p, err)
+	}
+}
+
+func TestRequestBuilderFrom(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse("spiffe://example.com/web")
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "www.example.com", Organization: []string{"Example"}, Country: []string{"US"}},
+		DNSNames:       []string{"www.example.com", "old.example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses: []string{"admin@example.com"},
+		URIs:           []*url.URL{uri},
+		NotBefore:      time.Now(),
+		NotAfter:       time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := NewRequestBuilderFrom(cert).
+		DNSNames("new.example.com").
+		RemoveSANs("OLD.example.com", "10.0.0.1").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Subject.CommonName != "www.example.com" || req.Subject.Organization[0] != "Example" || req.Subject.Country[0] != "US" {
+		t.Fatalf("unexpected subject %v", req.Subject)
+	}
+	expected := []string{"www.example.com", "new.example.com"}
+	if len(req.DNSNames) != len(expected) || req.DNSNames[0] != expected[0] || req.DNSNames[1] != expected[1] {
+		t.Fatalf("expected DNS names %v, got %v", expected, req.DNSNames)
+	}
+	if len(req.IPAddresses) != 0 || len(req.EmailAddresses) != 1 || len(req.URIs) != 1 {
+		t.Fatalf("unexpected SANs %v %v %v", req.IPAddresses, req.EmailAddresses, req.URIs)
+	}
+	if req.KeyType != KeyTypeECDSA || req.KeyCurve != EllipticCurveP384 {
+		t.Fatalf("unexpected key parameters %s %s", req.KeyType.String(), req.KeyCurve.String())
+	}
+
+	_, err = NewRequestBuilderFrom(cert).RemoveSANs("missing.example.com").Build()
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected user data error removing a missing SAN, got %v", err)
+	}
+}
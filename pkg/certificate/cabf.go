@@ -0,0 +1,148 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// MaxPublicValidityDays is the longest validity the CA/Browser Forum baseline requirements allow for a TLS
+// certificate issued by a public CA
+const MaxPublicValidityDays = 398
+
+// internalSuffixes are top-level domains and special-use domains that aren't delegated in the public DNS, so a
+// public CA can't validate the names under them
+var internalSuffixes = []string{
+	"local", "localhost", "localdomain", "internal", "intranet", "lan", "corp", "home", "private",
+	"test", "example", "invalid", "home.arpa",
+}
+
+// reservedNetworks are the private, loopback, link-local and other reserved ranges a public CA can't issue for
+var reservedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+		"192.0.0.0/24", "192.0.2.0/24", "192.168.0.0/16", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24",
+		"240.0.0.0/4", "::/128", "::1/128", "fc00::/7", "fe80::/10", "2001:db8::/32",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		networks = append(networks, n)
+	}
+	return networks
+}()
+
+// CheckBaselineRequirements checks that a public CA can issue req under the CA/Browser Forum baseline requirements:
+// a validity of 398 days at most, no internal name or reserved IP address, and a common name that is one of the
+// SANs. The names of a user provided CSR are checked from the CSR. Every problem is reported in the error, so they
+// can all be fixed before the request is submitted.
+func (request *Request) CheckBaselineRequirements() error {
+	cn, dnsNames, ips := request.Subject.CommonName, request.DNSNames, request.IPAddresses
+	if request.CsrOrigin == UserProvidedCSR && len(request.csr) > 0 {
+		block, _ := pem.Decode(request.csr)
+		if block == nil {
+			return fmt.Errorf("%w: failed to decode the CSR", verror.UserDataError)
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("%w: failed to parse the CSR: %s", verror.UserDataError, err)
+		}
+		cn, dnsNames, ips = csr.Subject.CommonName, csr.DNSNames, csr.IPAddresses
+	}
+
+	var problems []string
+	if request.ValidityHours > MaxPublicValidityDays*24 {
+		problems = append(problems, fmt.Sprintf("the validity of %d days exceeds the %d days allowed",
+			request.ValidityHours/24, MaxPublicValidityDays))
+	}
+	for _, name := range dnsNames {
+		if reason := internalName(name); reason != "" {
+			problems = append(problems, fmt.Sprintf("the DNS name %s is %s", name, reason))
+		}
+	}
+	for _, ip := range ips {
+		if reservedIP(ip) {
+			problems = append(problems, fmt.Sprintf("the IP address %s is private or reserved", ip))
+		}
+	}
+	if cn != "" && !isSAN(cn, dnsNames, ips) {
+		problems = append(problems, fmt.Sprintf("the common name %s isn't one of the DNS names or IP addresses", cn))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: the request doesn't meet the CA/Browser Forum baseline requirements: %s",
+			verror.UserDataError, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// internalName tells why name can't be validated in the public DNS, it's empty when it can
+func internalName(name string) string {
+	n := strings.ToLower(strings.TrimSuffix(name, "."))
+	if net.ParseIP(n) != nil {
+		return "an IP address, which belongs in the IP address SANs"
+	}
+	if strings.Contains(n, "_") {
+		return "not a valid host name, it contains an underscore"
+	}
+	if !strings.Contains(strings.TrimPrefix(n, "*."), ".") {
+		return "an internal name without a public domain"
+	}
+	for _, suffix := range internalSuffixes {
+		if n == suffix || strings.HasSuffix(n, "."+suffix) {
+			return fmt.Sprintf("an internal name, .%s isn't a public domain", suffix)
+		}
+	}
+	return ""
+}
+
+func reservedIP(ip net.IP) bool {
+	for _, n := range reservedNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSAN compares cn to the DNS names case insensitively and in their ASCII form, or to the IP addresses
+func isSAN(cn string, dnsNames []string, ips []net.IP) bool {
+	if ip := net.ParseIP(cn); ip != nil {
+		for _, a := range ips {
+			if a.Equal(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	if ascii, err := ToASCII(cn); err == nil {
+		cn = ascii
+	}
+	for _, n := range dnsNames {
+		if ascii, err := ToASCII(n); err == nil {
+			n = ascii
+		}
+		if strings.EqualFold(strings.TrimSuffix(n, "."), strings.TrimSuffix(cn, ".")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestCheckBaselineRequirements(t *testing.T) {
+	valid := &Request{
+		Subject:       pkix.Name{CommonName: "bücher.example.com"},
+		DNSNames:      []string{"xn--bcher-kva.example.com", "*.example.com"},
+		IPAddresses:   []net.IP{net.ParseIP("8.8.8.8")},
+		ValidityHours: 398 * 24,
+	}
+	if err := valid.CheckBaselineRequirements(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		req      Request
+		expected string
+	}{
+		{Request{DNSNames: []string{"www.example.com"}, ValidityHours: 730 * 24}, "the validity of 730 days exceeds the 398 days allowed"},
+		{Request{DNSNames: []string{"intranet"}}, "the DNS name intranet is an internal name without a public domain"},
+		{Request{DNSNames: []string{"db.corp"}}, "the DNS name db.corp is an internal name, .corp isn't a public domain"},
+		{Request{DNSNames: []string{"printer.home.arpa"}}, ".home.arpa isn't a public domain"},
+		{Request{DNSNames: []string{"my_host.example.com"}}, "contains an underscore"},
+		{Request{DNSNames: []string{"10.1.2.3"}}, "the DNS name 10.1.2.3 is an IP address"},
+		{Request{IPAddresses: []net.IP{net.ParseIP("192.168.1.10")}}, "the IP address 192.168.1.10 is private or reserved"},
+		{Request{IPAddresses: []net.IP{net.ParseIP("fd00::12")}}, "the IP address fd00::12 is private or reserved"},
+		{Request{Subject: pkix.Name{CommonName: "www.example.com"}, DNSNames: []string{"example.com"}},
+			"the common name www.example.com isn't one of the DNS names or IP addresses"},
+		{Request{Subject: pkix.Name{CommonName: "8.8.4.4"}, IPAddresses: []net.IP{net.ParseIP("8.8.8.8")}},
+			"the common name 8.8.4.4 isn't one of the DNS names or IP addresses"},
+	}
+	for _, c := range cases {
+		err := c.req.CheckBaselineRequirements()
+		if !errors.Is(err, verror.UserDataError) || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("expected %q, got %v", c.expected, err)
+		}
+	}
+}
+
+func TestCheckBaselineRequirementsCSR(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "server.local"},
+		DNSNames: []string{"server.local"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &Request{CsrOrigin: UserProvidedCSR, DNSNames: []string{"www.example.com"}}
+	err = req.SetCSR(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = req.CheckBaselineRequirements()
+	if err == nil || !strings.Contains(err.Error(), "the DNS name server.local is an internal name") {
+		t.Fatalf("the names of the CSR should be checked, got %v", err)
+	}
+}
@@ -47,25 +47,54 @@ func (ec *EllipticCurve) String() string {
 		return "P384"
 	case EllipticCurveP256:
 		return "P256"
+	case EllipticCurveBrainpoolP256r1:
+		return "brainpoolP256r1"
+	case EllipticCurveBrainpoolP384r1:
+		return "brainpoolP384r1"
+	case EllipticCurveBrainpoolP512r1:
+		return "brainpoolP512r1"
 	default:
 		return ""
 	}
 }
 
-// Set EllipticCurve value via a string
+// Set EllipticCurve value via a string. An unknown curve is set to the default curve, use ParseEllipticCurve to
+// reject it.
 func (ec *EllipticCurve) Set(value string) error {
+	curve, err := ParseEllipticCurve(value)
+	if err != nil {
+		curve = EllipticCurveDefault
+	}
+	*ec = curve
+	return nil
+}
+
+// ParseEllipticCurve returns the curve named value, e.g. "p384" or "brainpoolP256r1". An empty value is the
+// default curve.
+func ParseEllipticCurve(value string) (EllipticCurve, error) {
 	switch strings.ToLower(value) {
 	case "p521", "p-521":
-		*ec = EllipticCurveP521
+		return EllipticCurveP521, nil
 	case "p384", "p-384":
-		*ec = EllipticCurveP384
+		return EllipticCurveP384, nil
 	case "p256", "p-256":
-		*ec = EllipticCurveP256
-	default:
-		*ec = EllipticCurveDefault
+		return EllipticCurveP256, nil
+	case "brainpoolp256r1":
+		return EllipticCurveBrainpoolP256r1, nil
+	case "brainpoolp384r1":
+		return EllipticCurveBrainpoolP384r1, nil
+	case "brainpoolp512r1":
+		return EllipticCurveBrainpoolP512r1, nil
+	case "":
+		return EllipticCurveDefault, nil
 	}
+	return EllipticCurveNotSet, fmt.Errorf("%w: unknown elliptic curve %q", verror.UserDataError, value)
+}
 
-	return nil
+// IsBrainpool tells whether the curve is a Brainpool curve. Their keys can't be generated locally, the platform
+// has to generate them with the CSR.
+func (ec EllipticCurve) IsBrainpool() bool {
+	return ec == EllipticCurveBrainpoolP256r1 || ec == EllipticCurveBrainpoolP384r1 || ec == EllipticCurveBrainpoolP512r1
 }
 
 const (
@@ -76,14 +105,26 @@ const (
 	EllipticCurveP256
 	// EllipticCurveP384 represents the P384 curve
 	EllipticCurveP384
+	// EllipticCurveBrainpoolP256r1 represents the brainpoolP256r1 curve (RFC 5639)
+	EllipticCurveBrainpoolP256r1
+	// EllipticCurveBrainpoolP384r1 represents the brainpoolP384r1 curve (RFC 5639)
+	EllipticCurveBrainpoolP384r1
+	// EllipticCurveBrainpoolP512r1 represents the brainpoolP512r1 curve (RFC 5639)
+	EllipticCurveBrainpoolP512r1
 	EllipticCurveDefault = EllipticCurveP256
 
 	defaultRSAlength int = 2048
 )
 
+// AllSupportedCurves returns the NIST curves, supported by every platform and by local key generation
 func AllSupportedCurves() []EllipticCurve {
 	return []EllipticCurve{EllipticCurveP521, EllipticCurveP256, EllipticCurveP384}
 }
+
+// BrainpoolCurves returns the Brainpool curves, for the platforms that generate such keys
+func BrainpoolCurves() []EllipticCurve {
+	return []EllipticCurve{EllipticCurveBrainpoolP256r1, EllipticCurveBrainpoolP384r1, EllipticCurveBrainpoolP512r1}
+}
 func AllSupportedKeySizes() []int {
 	return []int{1024, 2048, 4096, 8192}
 }
@@ -153,10 +194,11 @@ const (
 // CustomField can be used for adding additional information to certificate. For example: custom fields or Origin.
 // By default it's custom field. For adding Origin set Type: CustomFieldOrigin
 // For adding custom field with one name and few values give to request:
-//  request.CustomFields = []CustomField{
-//    {Name: "name1", Value: "value1"}
-//    {Name: "name1", Value: "value2"}
-//  }
+//
+//	request.CustomFields = []CustomField{
+//	  {Name: "name1", Value: "value1"}
+//	  {Name: "name1", Value: "value2"}
+//	}
 type CustomField struct {
 	Type  CustomFieldType
 	Name  string
@@ -165,7 +207,10 @@ type CustomField struct {
 
 type Location struct {
 	Instance, Workload, TLSAddress string
-	Replace                        bool
+	// IPAddress is the address of the instance and InstallPath where the certificate is installed on it, they're
+	// recorded by the platform's installation tracking
+	IPAddress, InstallPath string
+	Replace                bool
 }
 
 // Request contains data needed to generate a certificate request
@@ -190,8 +235,12 @@ type Request struct {
 	CsrOrigin          CSrOriginOption
 	PickupID           string
 	//Cloud Certificate ID
-	CertID          string
-	ChainOption     ChainOption
+	CertID      string
+	ChainOption ChainOption
+	// ChainPreference picks the chain when several lead to a root, see SelectChain
+	ChainPreference ChainPreference
+	// ChainRoot pins the root the chain must end with by its SHA-1 or SHA-256 fingerprint
+	ChainRoot       string
 	KeyPassword     string
 	FetchPrivateKey bool
 	/*	Thumbprint is here because *Request is used in RetrieveCertificate().
@@ -202,12 +251,20 @@ type Request struct {
 	Location      *Location
 	ValidityHours int
 	IssuerHint    string
+	// KeepUnicodeCommonName keeps an internationalized common name in Unicode in the subject, see NormalizeIDN
+	KeepUnicodeCommonName bool
+	// ExtKeyUsages are requested in the CSR, the zone decides whether the certificate gets them
+	ExtKeyUsages []x509.ExtKeyUsage
+	// Warnings are the non-fatal conditions met while the request was built, completed by the zone and issued
+	Warnings []Warning
+	// OnWarning is called with each warning as it's recorded when it's set
+	OnWarning func(Warning) `json:"-"`
 }
 
 //SSH Certificate structures
 
 // SshCertRequest This request is a standard one, it will hold data for tpp request
-//and in the future it will hold VaS data.
+// and in the future it will hold VaS data.
 type SshCertRequest struct {
 	Template             string
 	PolicyDN             string
@@ -303,6 +360,8 @@ type SshCertificateDetails struct {
 	SourceAddresses              []string               `json:"SourceAddresses,omitempty"`
 	PublicKeyFingerprintSHA256   string                 `json:"PublicKeyFingerprintSHA256,omitempty"`
 	Extensions                   map[string]interface{} `json:"Extensions,omitempty"`
+	// CriticalOptions holds the critical options other than the force command and the source addresses
+	CriticalOptions map[string]string `json:"CriticalOptions,omitempty"`
 }
 
 type ProcessingDetails struct {
@@ -352,6 +411,11 @@ type CertificateInfo struct {
 	Thumbprint string
 	ValidFrom  time.Time
 	ValidTo    time.Time
+	// Issuer, KeyAlgorithm, KeySize and CustomFields are filled when the platform returns them in listings
+	Issuer       string
+	KeyAlgorithm string
+	KeySize      int
+	CustomFields map[string][]string
 }
 
 type SearchRequest []string
@@ -475,11 +539,19 @@ func GenerateRequest(request *Request, privateKey crypto.Signer) error {
 
 // GenerateCSR creates CSR for sending to server based on data from Request fields. It rewrites CSR field if it`s already filled.
 func (request *Request) GenerateCSR() error {
+	err := request.NormalizeIDN()
+	if err != nil {
+		return err
+	}
 	certificateRequest := x509.CertificateRequest{}
 	certificateRequest.Subject = request.Subject
 	if !request.OmitSANs {
 		addSubjectAltNames(&certificateRequest, request.DNSNames, request.EmailAddresses, request.IPAddresses, request.URIs, request.UPNs)
 	}
+	err = addExtKeyUsages(&certificateRequest, request.ExtKeyUsages)
+	if err != nil {
+		return err
+	}
 	certificateRequest.Attributes = request.Attributes
 
 	csr, err := x509.CreateCertificateRequest(rand.Reader, &certificateRequest, request.PrivateKey)
@@ -523,10 +595,11 @@ func (request *Request) CheckCertificate(certPEM string) error {
 	if pemBlock.Type != "CERTIFICATE" {
 		return fmt.Errorf("%w: invalid pem type %s (expect CERTIFICATE)", verror.CertificateCheckError, pemBlock.Type)
 	}
-	cert, err := x509.ParseCertificate(pemBlock.Bytes)
+	cert, err := ParseCertificate(pemBlock.Bytes)
 	if err != nil {
 		return err
 	}
+	request.checkKeyStrength(cert)
 	if request.PrivateKey != nil {
 		if request.KeyType.X509Type() != cert.PublicKeyAlgorithm {
 			return fmt.Errorf("%w: unmatched key type: %s, %s", verror.CertificateCheckError, request.KeyType.X509Type(), cert.PublicKeyAlgorithm)
@@ -627,6 +700,12 @@ func GetPrivateKeyPEMBock(key crypto.Signer, format ...string) (*pem.Block, erro
 			return &pem.Block{Type: "PRIVATE KEY", Bytes: dataBytes}, err
 		}
 	default:
+		// the other keys, e.g. the experimental post-quantum keys, only have a PKCS#8 encoding
+		if currentFormat != "legacy-pem" {
+			if dataBytes, err := pkcs8.MarshalPrivateKey(key, nil, nil); err == nil {
+				return &pem.Block{Type: "PRIVATE KEY", Bytes: dataBytes}, nil
+			}
+		}
 		return nil, fmt.Errorf("%w: unable to format Key", verror.VcertError)
 	}
 }
@@ -663,6 +742,11 @@ func GetEncryptedPrivateKeyPEMBock(key crypto.Signer, password []byte, format ..
 			return &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: dataBytes}, err
 		}
 	default:
+		if currentFormat != "legacy-pem" {
+			if dataBytes, err := pkcs8.MarshalPrivateKey(key, password, nil); err == nil {
+				return &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: dataBytes}, nil
+			}
+		}
 		return nil, fmt.Errorf("%w: unable to format Key", verror.VcertError)
 	}
 }
@@ -692,6 +776,11 @@ func GenerateECDSAPrivateKey(curve EllipticCurve) (*ecdsa.PrivateKey, error) {
 		c = elliptic.P384()
 	case EllipticCurveP256:
 		c = elliptic.P256()
+	default:
+		if curve.IsBrainpool() {
+			return nil, fmt.Errorf("%w: %s keys can't be generated locally, the CSR must be generated by the platform", verror.UserDataError, curve.String())
+		}
+		return nil, fmt.Errorf("%w: unknown elliptic curve %d", verror.UserDataError, curve)
 	}
 
 	priv, err = ecdsa.GenerateKey(c, rand.Reader)
@@ -702,6 +791,19 @@ func GenerateECDSAPrivateKey(curve EllipticCurve) (*ecdsa.PrivateKey, error) {
 	return priv, nil
 }
 
+// ellipticCurveOf returns the curve of an ECDSA key, EllipticCurveNotSet when it's not one of the NIST curves
+func ellipticCurveOf(pub *ecdsa.PublicKey) EllipticCurve {
+	switch pub.Curve.Params().Name {
+	case "P-256":
+		return EllipticCurveP256
+	case "P-384":
+		return EllipticCurveP384
+	case "P-521":
+		return EllipticCurveP521
+	}
+	return EllipticCurveNotSet
+}
+
 // GenerateRSAPrivateKey generates a new rsa private key using the size specified
 func GenerateRSAPrivateKey(size int) (*rsa.PrivateKey, error) {
 	priv, err := rsa.GenerateKey(rand.Reader, size)
@@ -732,7 +834,7 @@ func NewRequest(cert *x509.Certificate) *Request {
 	case *ecdsa.PublicKey:
 		req.KeyType = KeyTypeECDSA
 		req.KeyLength = pub.Curve.Params().BitSize
-		// TODO: req.KeyCurve = pub.Curve.Params().Name ...
+		req.KeyCurve = ellipticCurveOf(pub)
 	default: // case *dsa.PublicKey
 		// vcert only works with RSA & ECDSA
 	}
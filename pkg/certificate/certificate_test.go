@@ -22,7 +22,9 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"github.com/Venafi/vcert/v4/pkg/util"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 	"math/big"
 	"net"
 	"os"
@@ -238,6 +240,26 @@ func TestEllipticCurveSetByString(t *testing.T) {
 	}
 }
 
+func TestParseEllipticCurve(t *testing.T) {
+	for _, curve := range append(AllSupportedCurves(), BrainpoolCurves()...) {
+		parsed, err := ParseEllipticCurve(curve.String())
+		if err != nil || parsed != curve {
+			t.Errorf("%s was parsed as %s: %v", curve.String(), parsed.String(), err)
+		}
+	}
+	if curve, _ := ParseEllipticCurve("BrainpoolP512R1"); curve != EllipticCurveBrainpoolP512r1 {
+		t.Errorf("unexpected curve %s", curve.String())
+	}
+	if _, err := ParseEllipticCurve("secp256k1"); !errors.Is(err, verror.UserDataError) {
+		t.Errorf("expected user data error, got %v", err)
+	}
+	for _, curve := range BrainpoolCurves() {
+		if _, err := GenerateECDSAPrivateKey(curve); !errors.Is(err, verror.UserDataError) {
+			t.Errorf("%s: expected user data error, got %v", curve.String(), err)
+		}
+	}
+}
+
 func TestKeyTypeString(t *testing.T) {
 	keyType := KeyTypeECDSA
 	s := keyType.String()
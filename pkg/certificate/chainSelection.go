@@ -0,0 +1,201 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// ChainPreference picks the chain of a certificate when its issuers are cross-signed and several chains lead from
+// it to a root
+type ChainPreference int
+
+const (
+	// ChainPreferenceDefault keeps the chain as returned by the CA
+	ChainPreferenceDefault ChainPreference = iota
+	// ChainPreferenceShortest picks the chain with the fewest certificates
+	ChainPreferenceShortest
+	// ChainPreferenceLongestValidity picks the chain whose root expires last
+	ChainPreferenceLongestValidity
+)
+
+// ChainPreferenceFromString converts the string to the corresponding ChainPreference
+func ChainPreferenceFromString(preference string) (ChainPreference, error) {
+	switch strings.ToLower(preference) {
+	case "", "default":
+		return ChainPreferenceDefault, nil
+	case "shortest":
+		return ChainPreferenceShortest, nil
+	case "longest-validity":
+		return ChainPreferenceLongestValidity, nil
+	}
+	return ChainPreferenceDefault, fmt.Errorf("%w: unknown chain preference %q, options are default, shortest and longest-validity", verror.UserDataError, preference)
+}
+
+// SelectChain replaces the chain of pcc with the one preferred by the request among the chains its certificates
+// build: the one ending with the pinned ChainRoot if any, else the one of ChainPreference. The chains holding an
+// expired certificate, like an expired cross-sign, are only picked when no other one is left. The chain is kept as
+// is without a preference, and an error is returned when no chain ends with the pinned root.
+func (request *Request) SelectChain(pcc *PEMCollection) error {
+	if pcc == nil || len(pcc.Chain) == 0 || request.ChainOption == ChainOptionIgnore ||
+		request.ChainPreference == ChainPreferenceDefault && request.ChainRoot == "" {
+		return nil
+	}
+	leaf, err := parseCertificatePEM(pcc.Certificate)
+	if err != nil {
+		return err
+	}
+	pool := make([]*x509.Certificate, 0, len(pcc.Chain))
+	for _, p := range pcc.Chain {
+		cert, err := parseCertificatePEM(p)
+		if err != nil {
+			return err
+		}
+		pool = append(pool, cert)
+	}
+
+	chains := buildChains(leaf, pool, nil)
+	if request.ChainRoot != "" {
+		chains = pinnedChains(chains, request.ChainRoot)
+		if len(chains) == 0 {
+			return fmt.Errorf("%w: no chain of %s ends with the pinned root %s", verror.CertificateCheckError, leaf.Subject, request.ChainRoot)
+		}
+	}
+	if len(chains) == 0 {
+		return nil
+	}
+	var valid [][]*x509.Certificate
+	now := time.Now()
+	for _, chain := range chains {
+		if !expiredIn(chain, now) {
+			valid = append(valid, chain)
+		}
+	}
+	if len(valid) > 0 {
+		chains = valid
+	}
+
+	best := chains[0]
+	for _, chain := range chains[1:] {
+		if request.preferredChain(chain, best) {
+			best = chain
+		}
+	}
+	pcc.Chain = make([]string, 0, len(best))
+	for _, cert := range best {
+		pcc.Chain = append(pcc.Chain, string(pem.EncodeToMemory(GetCertificatePEMBlock(cert.Raw))))
+	}
+	if request.ChainOption == ChainOptionRootFirst {
+		for i, j := 0, len(pcc.Chain)-1; i < j; i, j = i+1, j-1 {
+			pcc.Chain[i], pcc.Chain[j] = pcc.Chain[j], pcc.Chain[i]
+		}
+	}
+	return nil
+}
+
+// preferredChain tells whether chain is preferred to best, the other criterion breaks the ties
+func (request *Request) preferredChain(chain, best []*x509.Certificate) bool {
+	shorter := len(chain) < len(best)
+	sameLength := len(chain) == len(best)
+	rootExpiry, bestRootExpiry := chain[len(chain)-1].NotAfter, best[len(best)-1].NotAfter
+	if request.ChainPreference == ChainPreferenceLongestValidity {
+		return rootExpiry.After(bestRootExpiry) || rootExpiry.Equal(bestRootExpiry) && shorter
+	}
+	return shorter || sameLength && rootExpiry.After(bestRootExpiry)
+}
+
+// buildChains returns every chain of issuers of cert found in pool, root last. A chain ends with a self-signed
+// certificate or with the last issuer found.
+func buildChains(cert *x509.Certificate, pool, path []*x509.Certificate) [][]*x509.Certificate {
+	if len(path) > 0 && bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+		return [][]*x509.Certificate{path}
+	}
+	var chains [][]*x509.Certificate
+	for _, issuer := range pool {
+		if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) || inChain(issuer, path) || cert.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		next := append(append([]*x509.Certificate{}, path...), issuer)
+		chains = append(chains, buildChains(issuer, pool, next)...)
+	}
+	if len(chains) == 0 && len(path) > 0 {
+		return [][]*x509.Certificate{path}
+	}
+	return chains
+}
+
+// pinnedChains returns the chains holding the root pinned by its fingerprint, cut after it
+func pinnedChains(chains [][]*x509.Certificate, pin string) [][]*x509.Certificate {
+	pin = normalizeFingerprint(pin)
+	var pinned [][]*x509.Certificate
+	for _, chain := range chains {
+		for i, cert := range chain {
+			sha1Sum, sha256Sum := sha1.Sum(cert.Raw), sha256.Sum256(cert.Raw)
+			if pin == hex.EncodeToString(sha1Sum[:]) || pin == hex.EncodeToString(sha256Sum[:]) {
+				pinned = append(pinned, chain[:i+1])
+				break
+			}
+		}
+	}
+	return pinned
+}
+
+// normalizeFingerprint returns the fingerprint in lowercase hex without colons, or "" when it's neither SHA-1 nor
+// SHA-256
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+	if _, err := hex.DecodeString(fingerprint); err != nil || len(fingerprint) != 2*sha1.Size && len(fingerprint) != 2*sha256.Size {
+		return ""
+	}
+	return fingerprint
+}
+
+func inChain(cert *x509.Certificate, chain []*x509.Certificate) bool {
+	for _, c := range chain {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+func expiredIn(chain []*x509.Certificate, now time.Time) bool {
+	for _, cert := range chain {
+		if now.After(cert.NotAfter) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCertificatePEM(p string) (*x509.Certificate, error) {
+	b, _ := pem.Decode([]byte(p))
+	if b == nil {
+		return nil, fmt.Errorf("%w: the chain holds an invalid PEM block", verror.UserDataError)
+	}
+	return x509.ParseCertificate(b.Bytes)
+}
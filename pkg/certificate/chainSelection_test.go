@@ -0,0 +1,171 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// crossSigned returns the PEM collection of a leaf whose intermediate is issued by a new root, which is cross-signed
+// by an old root, the chain holds both the new root and its cross-sign
+func crossSigned(t *testing.T, crossSignExpiry time.Time) (pcc *PEMCollection, names map[string]*x509.Certificate) {
+	names = map[string]*x509.Certificate{}
+	issue := func(name string, key crypto.Signer, parent string, parentKey crypto.Signer, notAfter time.Time, ca bool) {
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(int64(len(names) + 1)),
+			Subject:               pkix.Name{CommonName: strings.TrimSuffix(name, " cross-sign")},
+			NotBefore:             time.Now().AddDate(-1, 0, 0),
+			NotAfter:              notAfter,
+			IsCA:                  ca,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		}
+		issuer := template
+		if parent != "" {
+			issuer = names[parent]
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names[name], err = x509.ParseCertificate(der); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := make([]crypto.Signer, 4)
+	for i := range keys {
+		key, err := GenerateECDSAPrivateKey(EllipticCurveP256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	issue("old root", keys[0], "", keys[0], time.Now().AddDate(20, 0, 0), true)
+	issue("new root", keys[1], "", keys[1], time.Now().AddDate(10, 0, 0), true)
+	issue("new root cross-sign", keys[1], "old root", keys[0], crossSignExpiry, true)
+	issue("intermediate", keys[2], "new root", keys[1], time.Now().AddDate(5, 0, 0), true)
+	issue("leaf", keys[3], "intermediate", keys[2], time.Now().AddDate(0, 0, 90), false)
+
+	pcc, err := NewPEMCollection(names["leaf"], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"intermediate", "new root cross-sign", "old root", "new root"} {
+		if err = pcc.AddChainElement(names[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pcc, names
+}
+
+func chainNames(t *testing.T, pcc *PEMCollection, names map[string]*x509.Certificate) []string {
+	var chain []string
+	for _, p := range pcc.Chain {
+		b, _ := pem.Decode([]byte(p))
+		for name, cert := range names {
+			if b != nil && string(cert.Raw) == string(b.Bytes) {
+				chain = append(chain, name)
+			}
+		}
+	}
+	return chain
+}
+
+func TestSelectChain(t *testing.T) {
+	valid, expired := time.Now().AddDate(1, 0, 0), time.Now().Add(-time.Hour)
+	// pin returns the SHA-256 fingerprint of cert in the colon separated form of openssl
+	pin := func(cert *x509.Certificate) string {
+		var hex []string
+		for _, b := range sha256.Sum256(cert.Raw) {
+			hex = append(hex, fmt.Sprintf("%02X", b))
+		}
+		return strings.Join(hex, ":")
+	}
+
+	cases := []struct {
+		name            string
+		crossSignExpiry time.Time
+		request         Request
+		pinOldRoot      bool
+		expected        []string
+	}{
+		{"default", valid, Request{}, false,
+			[]string{"intermediate", "new root cross-sign", "old root", "new root"}},
+		{"shortest", valid, Request{ChainPreference: ChainPreferenceShortest}, false,
+			[]string{"intermediate", "new root"}},
+		{"longest validity", valid, Request{ChainPreference: ChainPreferenceLongestValidity}, false,
+			[]string{"intermediate", "new root cross-sign", "old root"}},
+		{"expired cross-sign", expired, Request{ChainPreference: ChainPreferenceLongestValidity}, false,
+			[]string{"intermediate", "new root"}},
+		{"root first", valid, Request{ChainPreference: ChainPreferenceShortest, ChainOption: ChainOptionRootFirst}, false,
+			[]string{"new root", "intermediate"}},
+		{"pinned root", expired, Request{ChainPreference: ChainPreferenceShortest}, true,
+			[]string{"intermediate", "new root cross-sign", "old root"}},
+	}
+	for _, c := range cases {
+		pcc, names := crossSigned(t, c.crossSignExpiry)
+		if c.pinOldRoot {
+			c.request.ChainRoot = pin(names["old root"])
+		}
+		if err := c.request.SelectChain(pcc); err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if chain := chainNames(t, pcc, names); !reflect.DeepEqual(chain, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, chain)
+		}
+	}
+
+	pcc, _ := crossSigned(t, valid)
+	_, others := crossSigned(t, valid)
+	request := Request{ChainRoot: pin(others["old root"])}
+	if err := request.SelectChain(pcc); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("a root missing from the chain should fail, got %v", err)
+	}
+}
+
+func TestChainPreferenceFromString(t *testing.T) {
+	for s, expected := range map[string]ChainPreference{
+		"":                 ChainPreferenceDefault,
+		"Shortest":         ChainPreferenceShortest,
+		"longest-validity": ChainPreferenceLongestValidity,
+	} {
+		if preference, err := ChainPreferenceFromString(s); err != nil || preference != expected {
+			t.Errorf("%q: expected %d, got %d %v", s, expected, preference, err)
+		}
+	}
+	if _, err := ChainPreferenceFromString("longest"); !errors.Is(err, verror.UserDataError) {
+		t.Errorf("an unknown preference should fail, got %v", err)
+	}
+	if _, err := NewRequestBuilder().ChainRoot("not a fingerprint").CommonName("vcert.test.vfidev.com").Build(); err == nil {
+		t.Error("an invalid root fingerprint should fail")
+	}
+}
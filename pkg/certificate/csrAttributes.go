@@ -0,0 +1,337 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// CSRAttributeMode tells what is done with the attributes and the requested extensions of a user provided CSR
+// before it's submitted
+type CSRAttributeMode int
+
+const (
+	// CSRAttributesPreserve submits the CSR as it is
+	CSRAttributesPreserve CSRAttributeMode = iota
+	// CSRAttributesStrip removes the attributes and the requested extensions, but the subject alternative names and
+	// the ones of CSRAttributePolicy.Keep
+	CSRAttributesStrip
+	// CSRAttributesOverride sets the challenge password and the extensions of CSRAttributePolicy, the others are kept
+	CSRAttributesOverride
+)
+
+// CSRAttributeModeFromString returns the mode named "preserve", "strip" or "override"
+func CSRAttributeModeFromString(mode string) (CSRAttributeMode, error) {
+	switch strings.ToLower(mode) {
+	case "", "preserve":
+		return CSRAttributesPreserve, nil
+	case "strip":
+		return CSRAttributesStrip, nil
+	case "override":
+		return CSRAttributesOverride, nil
+	}
+	return CSRAttributesPreserve, fmt.Errorf("%w: unknown CSR attribute mode %q, use preserve, strip or override", verror.UserDataError, mode)
+}
+
+// CSRAttributePolicy is applied to a user provided CSR by Request.ApplyCSRAttributePolicy
+type CSRAttributePolicy struct {
+	Mode CSRAttributeMode
+	// Keep lists the attributes and extensions stripping leaves in the CSR
+	Keep []asn1.ObjectIdentifier
+	// ChallengePassword, when not empty, and Extensions replace the ones of the CSR or are added to it by override
+	ChallengePassword string
+	Extensions        []pkix.Extension
+}
+
+// CSRAttributeAction is what was done with an attribute or a requested extension of a CSR
+type CSRAttributeAction string
+
+const (
+	CSRAttributeKept     CSRAttributeAction = "kept"
+	CSRAttributeRemoved  CSRAttributeAction = "removed"
+	CSRAttributeReplaced CSRAttributeAction = "replaced"
+	CSRAttributeAdded    CSRAttributeAction = "added"
+)
+
+// CSRAttributeChange reports what was done with an attribute, or with an extension of the extension request
+type CSRAttributeChange struct {
+	OID       asn1.ObjectIdentifier
+	Extension bool
+	Action    CSRAttributeAction
+}
+
+func (c CSRAttributeChange) String() string {
+	kind := "attribute"
+	if c.Extension {
+		kind = "extension"
+	}
+	if name, ok := csrAttributeNames[c.OID.String()]; ok {
+		return fmt.Sprintf("%s %s (%s) %s", kind, name, c.OID, c.Action)
+	}
+	return fmt.Sprintf("%s %s %s", kind, c.OID, c.Action)
+}
+
+var (
+	oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+	oidExtensionRequest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+)
+
+var csrAttributeNames = map[string]string{
+	"1.2.840.113549.1.9.2":   "unstructuredName",
+	"1.2.840.113549.1.9.7":   "challengePassword",
+	"1.2.840.113549.1.9.14":  "extensionRequest",
+	"1.3.6.1.4.1.311.13.2.2": "enrollmentCSP",
+	"1.3.6.1.4.1.311.13.2.3": "osVersion",
+	"1.3.6.1.4.1.311.21.20":  "clientInformation",
+	"1.3.6.1.4.1.311.20.2":   "certificateTemplateName",
+	"1.3.6.1.4.1.311.21.7":   "certificateTemplate",
+	"1.3.6.1.5.5.7.1.24":     "tlsFeature",
+	"2.5.29.14":              "subjectKeyIdentifier",
+	"2.5.29.15":              "keyUsage",
+	"2.5.29.17":              "subjectAltName",
+	"2.5.29.19":              "basicConstraints",
+	"2.5.29.30":              "nameConstraints",
+	"2.5.29.32":              "certificatePolicies",
+	"2.5.29.37":              "extKeyUsage",
+}
+
+type rawCertificateRequest struct {
+	TBSCertificateRequest asn1.RawValue
+	SignatureAlgorithm    pkix.AlgorithmIdentifier
+	SignatureValue        asn1.BitString
+}
+
+type tbsCertificateRequest struct {
+	Version    int
+	Subject    asn1.RawValue
+	PublicKey  asn1.RawValue
+	Attributes []csrAttribute `asn1:"tag:0"`
+}
+
+type csrAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// ApplyCSRAttributePolicy applies policy to the attributes and the requested extensions of the request's CSR and
+// reports what was done with each of them. Changing them invalidates the signature of the CSR, so signer, the key
+// the CSR was made with, is required to sign it again unless the CSR is kept as it is.
+func (request *Request) ApplyCSRAttributePolicy(policy CSRAttributePolicy, signer crypto.Signer) ([]CSRAttributeChange, error) {
+	block, _ := pem.Decode(request.csr)
+	if block == nil {
+		return nil, fmt.Errorf("%w: the request has no CSR", verror.UserDataError)
+	}
+	var raw rawCertificateRequest
+	if _, err := asn1.Unmarshal(block.Bytes, &raw); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse CSR: %s", verror.UserDataError, err)
+	}
+	var tbs tbsCertificateRequest
+	if _, err := asn1.Unmarshal(raw.TBSCertificateRequest.FullBytes, &tbs); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse CSR: %s", verror.UserDataError, err)
+	}
+
+	var changes []CSRAttributeChange
+	changed := false
+	report := func(oid asn1.ObjectIdentifier, extension bool, action CSRAttributeAction) {
+		changes = append(changes, CSRAttributeChange{OID: oid, Extension: extension, Action: action})
+		changed = changed || action != CSRAttributeKept
+	}
+
+	var attributes []csrAttribute
+	hasPassword := false
+	for _, a := range tbs.Attributes {
+		switch {
+		case a.Type.Equal(oidExtensionRequest):
+			// rebuilt below from the extensions left
+		case policy.Mode == CSRAttributesStrip && !containsOID(policy.Keep, a.Type):
+			report(a.Type, false, CSRAttributeRemoved)
+		case policy.Mode == CSRAttributesOverride && a.Type.Equal(oidChallengePassword) && policy.ChallengePassword != "":
+			hasPassword = true
+			pwd, err := challengePasswordAttribute(policy.ChallengePassword)
+			if err != nil {
+				return nil, err
+			}
+			attributes = append(attributes, pwd)
+			report(a.Type, false, CSRAttributeReplaced)
+		default:
+			attributes = append(attributes, a)
+			report(a.Type, false, CSRAttributeKept)
+		}
+	}
+	if policy.Mode == CSRAttributesOverride && policy.ChallengePassword != "" && !hasPassword {
+		pwd, err := challengePasswordAttribute(policy.ChallengePassword)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, pwd)
+		report(oidChallengePassword, false, CSRAttributeAdded)
+	}
+
+	requested, err := requestedExtensions(tbs.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	var extensions []pkix.Extension
+	for _, e := range requested {
+		switch {
+		case policy.Mode == CSRAttributesStrip && !e.Id.Equal(oidExtensionSubjectAltName) && !containsOID(policy.Keep, e.Id):
+			report(e.Id, true, CSRAttributeRemoved)
+		case policy.Mode == CSRAttributesOverride && findExtension(policy.Extensions, e.Id) != nil:
+			extensions = append(extensions, *findExtension(policy.Extensions, e.Id))
+			report(e.Id, true, CSRAttributeReplaced)
+		default:
+			extensions = append(extensions, e)
+			report(e.Id, true, CSRAttributeKept)
+		}
+	}
+	if policy.Mode == CSRAttributesOverride {
+		for _, e := range policy.Extensions {
+			if findExtension(requested, e.Id) == nil {
+				extensions = append(extensions, e)
+				report(e.Id, true, CSRAttributeAdded)
+			}
+		}
+	}
+
+	if !changed {
+		return changes, nil
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("%w: the private key of the CSR is required to change its attributes", verror.UserDataError)
+	}
+	if len(extensions) > 0 {
+		value, err := asn1.Marshal(extensions)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, csrAttribute{Type: oidExtensionRequest, Values: []asn1.RawValue{{FullBytes: value}}})
+	}
+	tbs.Attributes = attributes
+	der, err := signCertificateRequest(tbs, raw.SignatureAlgorithm, signer)
+	if err != nil {
+		return nil, err
+	}
+	request.csr = pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der})
+	return changes, nil
+}
+
+// signCertificateRequest signs tbs again with the algorithm of the original CSR
+func signCertificateRequest(tbs tbsCertificateRequest, alg pkix.AlgorithmIdentifier, signer crypto.Signer) ([]byte, error) {
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil || !bytes.Equal(pub, tbs.PublicKey.FullBytes) {
+		return nil, fmt.Errorf("%w: the private key doesn't match the CSR", verror.UserDataError)
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, err
+	}
+	var opts crypto.SignerOpts
+	if alg.Algorithm.Equal(oidRSASSAPSS) {
+		_, opts, err = pssOptions(alg.Parameters.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		opts, err = csrSignatureHash(alg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	digest := tbsDER
+	if hash := opts.HashFunc(); hash != 0 {
+		h := hash.New()
+		h.Write(tbsDER)
+		digest = h.Sum(nil)
+	}
+	signature, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign CSR: %s", err)
+	}
+	return asn1.Marshal(rawCertificateRequest{
+		TBSCertificateRequest: asn1.RawValue{FullBytes: tbsDER},
+		SignatureAlgorithm:    alg,
+		SignatureValue:        asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+}
+
+// csrSignatureHash returns the hash of the RSA PKCS#1 v1.5, ECDSA and Ed25519 signatures, SHA-1 isn't used to sign
+func csrSignatureHash(alg pkix.AlgorithmIdentifier) (crypto.Hash, error) {
+	switch alg.Algorithm.String() {
+	case "1.2.840.113549.1.1.11", "1.2.840.10045.4.3.2":
+		return crypto.SHA256, nil
+	case "1.2.840.113549.1.1.12", "1.2.840.10045.4.3.3":
+		return crypto.SHA384, nil
+	case "1.2.840.113549.1.1.13", "1.2.840.10045.4.3.4":
+		return crypto.SHA512, nil
+	case "1.3.101.112":
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%w: CSRs signed with %s can't be signed again", verror.UserDataError, alg.Algorithm)
+}
+
+func challengePasswordAttribute(password string) (csrAttribute, error) {
+	value, err := asn1.Marshal(password)
+	if err != nil {
+		return csrAttribute{}, err
+	}
+	return csrAttribute{Type: oidChallengePassword, Values: []asn1.RawValue{{FullBytes: value}}}, nil
+}
+
+func requestedExtensions(attributes []csrAttribute) ([]pkix.Extension, error) {
+	var extensions []pkix.Extension
+	for _, a := range attributes {
+		if !a.Type.Equal(oidExtensionRequest) {
+			continue
+		}
+		for _, v := range a.Values {
+			var exts []pkix.Extension
+			if _, err := asn1.Unmarshal(v.FullBytes, &exts); err != nil {
+				return nil, fmt.Errorf("%w: failed to parse the extension request of the CSR: %s", verror.UserDataError, err)
+			}
+			extensions = append(extensions, exts...)
+		}
+	}
+	return extensions, nil
+}
+
+func findExtension(extensions []pkix.Extension, oid asn1.ObjectIdentifier) *pkix.Extension {
+	for i := range extensions {
+		if extensions[i].Id.Equal(oid) {
+			return &extensions[i]
+		}
+	}
+	return nil
+}
+
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+var oidKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 15}
+
+func csrWithKeyUsage(t *testing.T, key crypto.Signer) *Request {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "csr.venafi.example"},
+		DNSNames:        []string{"csr.venafi.example"},
+		ExtraExtensions: []pkix.Extension{{Id: oidKeyUsage, Critical: true, Value: []byte{3, 2, 5, 160}}},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &Request{CsrOrigin: UserProvidedCSR}
+	err = req.SetCSR(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func parseRequestCSR(t *testing.T, req *Request) (*x509.CertificateRequest, []csrAttribute) {
+	block, _ := pem.Decode(req.GetCSR())
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = csr.CheckSignature()
+	if err != nil {
+		t.Fatalf("CSR signature isn't valid: %s", err)
+	}
+	var tbs tbsCertificateRequest
+	if _, err = asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		t.Fatal(err)
+	}
+	return csr, tbs.Attributes
+}
+
+func reportString(changes []CSRAttributeChange) []string {
+	var s []string
+	for _, c := range changes {
+		s = append(s, c.String())
+	}
+	return s
+}
+
+func checkReport(t *testing.T, changes []CSRAttributeChange, expected ...string) {
+	got := reportString(changes)
+	if len(got) != len(expected) {
+		t.Fatalf("expected report %q, got %q", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("expected report %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestApplyCSRAttributePolicy(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := GenerateRSAPrivateKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, key := range map[string]crypto.Signer{"ECDSA": ecKey, "RSA": rsaKey, "Ed25519": edKey} {
+		t.Run(name, func(t *testing.T) {
+			req := csrWithKeyUsage(t, key)
+			original := req.GetCSR()
+
+			changes, err := req.ApplyCSRAttributePolicy(CSRAttributePolicy{Mode: CSRAttributesPreserve}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkReport(t, changes, "extension subjectAltName (2.5.29.17) kept", "extension keyUsage (2.5.29.15) kept")
+			if !bytes.Equal(original, req.GetCSR()) {
+				t.Fatal("preserving the attributes changed the CSR")
+			}
+
+			override := CSRAttributePolicy{
+				Mode:              CSRAttributesOverride,
+				ChallengePassword: "secret",
+				Extensions:        []pkix.Extension{{Id: oidKeyUsage, Critical: true, Value: []byte{3, 2, 7, 128}}},
+			}
+			_, err = req.ApplyCSRAttributePolicy(override, nil)
+			if !errors.Is(err, verror.UserDataError) {
+				t.Fatalf("expected an error without the key, got %v", err)
+			}
+			changes, err = req.ApplyCSRAttributePolicy(override, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkReport(t, changes, "attribute challengePassword (1.2.840.113549.1.9.7) added",
+				"extension subjectAltName (2.5.29.17) kept", "extension keyUsage (2.5.29.15) replaced")
+			csr, attributes := parseRequestCSR(t, req)
+			if len(attributes) != 2 || !attributes[0].Type.Equal(oidChallengePassword) {
+				t.Fatalf("expected a challenge password and the extension request, got %v", attributes)
+			}
+			var password string
+			if _, err = asn1.Unmarshal(attributes[0].Values[0].FullBytes, &password); err != nil || password != "secret" {
+				t.Fatalf("expected challenge password secret, got %q (%v)", password, err)
+			}
+			if len(csr.DNSNames) != 1 || csr.Subject.CommonName != "csr.venafi.example" {
+				t.Fatalf("the names of the CSR were changed: %v %v", csr.Subject, csr.DNSNames)
+			}
+			if ku := findExtension(csr.Extensions, oidKeyUsage); ku == nil || !bytes.Equal(ku.Value, []byte{3, 2, 7, 128}) {
+				t.Fatalf("key usage wasn't replaced: %v", ku)
+			}
+
+			changes, err = req.ApplyCSRAttributePolicy(CSRAttributePolicy{Mode: CSRAttributesStrip}, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkReport(t, changes, "attribute challengePassword (1.2.840.113549.1.9.7) removed",
+				"extension subjectAltName (2.5.29.17) kept", "extension keyUsage (2.5.29.15) removed")
+			csr, attributes = parseRequestCSR(t, req)
+			if len(attributes) != 1 || len(csr.Extensions) != 1 || len(csr.DNSNames) != 1 {
+				t.Fatalf("expected the subject alternative names only, got %v", csr.Extensions)
+			}
+		})
+	}
+}
+
+func TestApplyCSRAttributePolicyWrongKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	req := csrWithKeyUsage(t, key)
+	_, err := req.ApplyCSRAttributePolicy(CSRAttributePolicy{Mode: CSRAttributesStrip}, other)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a key mismatch error, got %v", err)
+	}
+	changes, err := req.ApplyCSRAttributePolicy(CSRAttributePolicy{Mode: CSRAttributesStrip, Keep: []asn1.ObjectIdentifier{oidKeyUsage}}, nil)
+	if err != nil {
+		t.Fatalf("stripping nothing shouldn't need the key: %s", err)
+	}
+	checkReport(t, changes, "extension subjectAltName (2.5.29.17) kept", "extension keyUsage (2.5.29.15) kept")
+}
+
+func TestCSRAttributeModeFromString(t *testing.T) {
+	for s, expected := range map[string]CSRAttributeMode{"": CSRAttributesPreserve, "Strip": CSRAttributesStrip, "override": CSRAttributesOverride} {
+		mode, err := CSRAttributeModeFromString(s)
+		if err != nil || mode != expected {
+			t.Fatalf("%q: expected %v, got %v (%v)", s, expected, mode, err)
+		}
+	}
+	if _, err := CSRAttributeModeFromString("drop"); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+var oidExtensionExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:             {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageTimeStamping:    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+}
+
+// addExtKeyUsages requests the extended key usages in the CSR. Whether the certificate gets them is up to the zone:
+// TPP honors them when the policy allows it, VaaS issuing templates set their own.
+func addExtKeyUsages(req *x509.CertificateRequest, usages []x509.ExtKeyUsage) error {
+	if len(usages) == 0 {
+		return nil
+	}
+	oids := make([]asn1.ObjectIdentifier, 0, len(usages))
+	for _, u := range usages {
+		oid, ok := extKeyUsageOIDs[u]
+		if !ok {
+			return fmt.Errorf("%w: unsupported extended key usage %d", verror.UserDataError, u)
+		}
+		oids = append(oids, oid)
+	}
+	value, err := asn1.Marshal(oids)
+	if err != nil {
+		return err
+	}
+	req.ExtraExtensions = append(req.ExtraExtensions, pkix.Extension{Id: oidExtensionExtKeyUsage, Value: value})
+	return nil
+}
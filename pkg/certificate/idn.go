@@ -0,0 +1,184 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// labelSeparators are the full stops that IDNA treats like "."
+var labelSeparators = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCII converts a domain name to its ASCII form: Unicode labels (U-labels) are converted to A-labels
+// ("xn--..."), everything is lowercased and the result is checked against the host name syntax.
+func ToASCII(name string) (string, error) {
+	return normalizeDNSName(name)
+}
+
+// ToUnicode converts the A-labels of a domain name back to Unicode, e.g. for display
+func ToUnicode(name string) (string, error) {
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if !hasACEPrefix(label) {
+			continue
+		}
+		u, err := punycodeDecode(label[len(acePrefix):])
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid A-label %q: %s", verror.UserDataError, label, err)
+		}
+		labels[i] = u
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// NormalizeIDN converts the internationalized domain names of the request to A-labels, as certificates require
+// for DNS SANs. ASCII names are left untouched, except for A-labels which are checked. The common name is converted
+// too, unless KeepUnicodeCommonName is set: the U-label then stays in the subject for display and its A-label is
+// added to the DNS SANs. It is called when a CSR is generated and by the connectors, calling it again is harmless.
+func (request *Request) NormalizeIDN() error {
+	for i, name := range request.DNSNames {
+		if !isIDN(name) {
+			continue
+		}
+		a, err := normalizeDNSName(name)
+		if err != nil {
+			return err
+		}
+		request.DNSNames[i] = a
+	}
+	for i, email := range request.EmailAddresses {
+		at := strings.LastIndex(email, "@")
+		if at < 0 || !isIDN(email[at+1:]) {
+			continue
+		}
+		domain, err := normalizeDNSName(email[at+1:])
+		if err != nil {
+			return err
+		}
+		request.EmailAddresses[i] = email[:at+1] + domain
+	}
+
+	cn := request.Subject.CommonName
+	if !isIDN(cn) || !looksLikeDNSName(labelSeparators.Replace(cn)) {
+		return nil
+	}
+	a, err := normalizeDNSName(cn)
+	if err != nil {
+		return err
+	}
+	if !request.KeepUnicodeCommonName || isASCII(cn) {
+		request.Subject.CommonName = a
+		return nil
+	}
+	if !containsString(request.DNSNames, a) {
+		request.DNSNames = append([]string{a}, request.DNSNames...)
+	}
+	return nil
+}
+
+// isIDN tells whether name has Unicode or A-labels
+func isIDN(name string) bool {
+	if !isASCII(name) {
+		return true
+	}
+	for _, label := range strings.Split(name, ".") {
+		if hasACEPrefix(label) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasACEPrefix(label string) bool {
+	return len(label) >= len(acePrefix) && strings.EqualFold(label[:len(acePrefix)], acePrefix)
+}
+
+// checkULabel rejects the characters that can't be part of a host name: only letters, marks, digits and hyphens
+// are allowed
+func checkULabel(label string) error {
+	for _, r := range label {
+		if !(unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == '-') {
+			return fmt.Errorf("label %q contains %q", label, r)
+		}
+	}
+	return nil
+}
+
+// punycodeDecode decodes a Punycode encoded label, without the ACE prefix
+func punycodeDecode(encoded string) (string, error) {
+	var output []rune
+	pos := 0
+	if i := strings.LastIndex(encoded, "-"); i >= 0 {
+		for _, c := range encoded[:i] {
+			if c >= 0x80 {
+				return "", fmt.Errorf("non-ASCII basic code point")
+			}
+			output = append(output, c)
+		}
+		pos = i + 1
+	}
+	n, i, bias := punyInitialN, 0, punyInitialBias
+	for pos < len(encoded) {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(encoded) {
+				return "", fmt.Errorf("truncated input")
+			}
+			digit, ok := punyDigitValue(encoded[pos])
+			if !ok {
+				return "", fmt.Errorf("invalid character %q", encoded[pos])
+			}
+			pos++
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+			if i > 0x10ffff*punyBase || w > 0x10ffff*punyBase {
+				return "", fmt.Errorf("overflow")
+			}
+		}
+		bias = punyAdapt(i-oldi, len(output)+1, oldi == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n > unicode.MaxRune {
+			return "", fmt.Errorf("invalid code point")
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return string(output), nil
+}
+
+func punyDigitValue(c byte) (int, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	}
+	return 0, false
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestToASCIIToUnicode(t *testing.T) {
+	cases := map[string]string{
+		"bücher.example.com": "xn--bcher-kva.example.com",
+		"MÜNCHEN.de":         "xn--mnchen-3ya.de",
+		"*.他们为什么不说中文.cn":     "*.xn--ihqwcrb4cv8a8dqg056pqjye.cn",
+		"bücher。example．com": "xn--bcher-kva.example.com",
+		"www.example.com":    "www.example.com",
+	}
+	for in, expected := range cases {
+		a, err := ToASCII(in)
+		if err != nil {
+			t.Fatalf("ToASCII(%q): %s", in, err)
+		}
+		if a != expected {
+			t.Errorf("ToASCII(%q) = %q, expected %q", in, a, expected)
+		}
+		u, err := ToUnicode(a)
+		if err != nil {
+			t.Fatalf("ToUnicode(%q): %s", a, err)
+		}
+		if back, _ := ToASCII(u); back != a {
+			t.Errorf("ToUnicode(%q) = %q doesn't round trip", a, u)
+		}
+	}
+	if u, _ := ToUnicode("xn--bcher-kva.example.com"); u != "bücher.example.com" {
+		t.Errorf("unexpected U-label %q", u)
+	}
+
+	for _, bad := range []string{"xn--bcher-kv!.example.com", "xn--a.example.com", "bü cher.example.com", "bü_cher.example.com"} {
+		_, err := ToASCII(bad)
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("ToASCII(%q) should fail, got %v", bad, err)
+		}
+	}
+}
+
+func TestNormalizeIDN(t *testing.T) {
+	req := Request{DNSNames: []string{"bücher.example.com", "Example.com"}, EmailAddresses: []string{"info@bücher.example.com"}}
+	req.Subject.CommonName = "www.bücher.example.com"
+	err := req.NormalizeIDN()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Subject.CommonName != "www.xn--bcher-kva.example.com" {
+		t.Errorf("unexpected common name %q", req.Subject.CommonName)
+	}
+	if len(req.DNSNames) != 2 || req.DNSNames[0] != "xn--bcher-kva.example.com" || req.DNSNames[1] != "Example.com" {
+		t.Errorf("unexpected DNS names %v", req.DNSNames)
+	}
+	if req.EmailAddresses[0] != "info@xn--bcher-kva.example.com" {
+		t.Errorf("unexpected email %q", req.EmailAddresses[0])
+	}
+
+	req = Request{KeepUnicodeCommonName: true, KeyType: KeyTypeECDSA}
+	req.Subject.CommonName = "bücher.example.com"
+	err = req.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = req.GenerateCSR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(req.GetCSR())
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.Subject.CommonName != "bücher.example.com" {
+		t.Errorf("unexpected common name %q", csr.Subject.CommonName)
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "xn--bcher-kva.example.com" {
+		t.Errorf("unexpected DNS names %v", csr.DNSNames)
+	}
+
+	req = Request{DNSNames: []string{"xn--a.example.com"}}
+	if err = req.NormalizeIDN(); !errors.Is(err, verror.UserDataError) {
+		t.Errorf("invalid A-label should fail, got %v", err)
+	}
+}
+
+func TestRequestBuilderKeepUnicodeCommonName(t *testing.T) {
+	req, err := NewRequestBuilder().CommonName("bücher.example.com").KeepUnicodeCommonName(true).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Subject.CommonName != "bücher.example.com" || len(req.DNSNames) != 1 || req.DNSNames[0] != "xn--bcher-kva.example.com" {
+		t.Errorf("unexpected request %q %v", req.Subject.CommonName, req.DNSNames)
+	}
+	req, err = NewRequestBuilder().CommonName("bücher.example.com").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Subject.CommonName != "xn--bcher-kva.example.com" {
+		t.Errorf("unexpected common name %q", req.Subject.CommonName)
+	}
+}
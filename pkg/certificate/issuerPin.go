@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// ParsePinnedIssuers returns the CA certificates of a PEM bundle, the issuers the certificates of a zone are
+// expected to chain to
+func ParsePinnedIssuers(bundle []byte) ([]*x509.Certificate, error) {
+	var pinned []*x509.Certificate
+	for {
+		var b *pem.Block
+		b, bundle = pem.Decode(bundle)
+		if b == nil {
+			break
+		}
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse a pinned issuer: %s", verror.UserDataError, err)
+		}
+		if !cert.IsCA {
+			return nil, fmt.Errorf("%w: the pinned issuer %s isn't a CA", verror.UserDataError, cert.Subject)
+		}
+		pinned = append(pinned, cert)
+	}
+	if len(pinned) == 0 {
+		return nil, fmt.Errorf("%w: no pinned issuer certificate found", verror.UserDataError)
+	}
+	return pinned, nil
+}
+
+// VerifyIssuer makes sure the certificate of the collection chains to one of the pinned CAs through the chain of
+// the collection, so a certificate issued by another CA, from a misconfigured zone, isn't installed. A pinned CA
+// can be a root or an intermediate. The chain is verified at the time the certificate was issued, its expiration
+// is checked apart.
+func (col *PEMCollection) VerifyIssuer(pinned []*x509.Certificate) error {
+	leaf, err := parseCertificatePEM(col.Certificate)
+	if err != nil {
+		return err
+	}
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   leaf.NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, cert := range pinned {
+		opts.Roots.AddCert(cert)
+	}
+	for _, p := range col.Chain {
+		cert, err := parseCertificatePEM(p)
+		if err != nil {
+			return err
+		}
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err = leaf.Verify(opts); err != nil {
+		return fmt.Errorf("%w: the certificate %s issued by %s doesn't chain to a pinned issuer: %s", verror.CertificateCheckError, leaf.Subject, leaf.Issuer, err)
+	}
+	return nil
+}
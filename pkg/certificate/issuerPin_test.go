@@ -0,0 +1,65 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestVerifyIssuer(t *testing.T) {
+	pcc, names := crossSigned(t, time.Now().AddDate(1, 0, 0))
+	_, others := crossSigned(t, time.Now().AddDate(1, 0, 0))
+
+	for _, pinned := range []string{"new root", "old root", "intermediate"} {
+		if err := pcc.VerifyIssuer([]*x509.Certificate{others["new root"], names[pinned]}); err != nil {
+			t.Errorf("%s: %s", pinned, err)
+		}
+	}
+	if err := pcc.VerifyIssuer([]*x509.Certificate{others["new root"], others["old root"]}); !errors.Is(err, verror.CertificateCheckError) {
+		t.Errorf("a certificate of another CA should fail, got %v", err)
+	}
+	noChain := &PEMCollection{Certificate: pcc.Certificate}
+	if err := noChain.VerifyIssuer([]*x509.Certificate{names["new root"]}); !errors.Is(err, verror.CertificateCheckError) {
+		t.Errorf("a certificate without its intermediate should fail, got %v", err)
+	}
+}
+
+func TestParsePinnedIssuers(t *testing.T) {
+	_, names := crossSigned(t, time.Now().AddDate(1, 0, 0))
+	bundle := append(pem.EncodeToMemory(GetCertificatePEMBlock(names["new root"].Raw)), "# comment\n"...)
+	bundle = append(bundle, pem.EncodeToMemory(GetCertificatePEMBlock(names["intermediate"].Raw))...)
+	pinned, err := ParsePinnedIssuers(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinned) != 2 || !pinned[0].Equal(names["new root"]) || !pinned[1].Equal(names["intermediate"]) {
+		t.Fatalf("expected the root and the intermediate, got %d certificates", len(pinned))
+	}
+
+	if _, err = ParsePinnedIssuers(pem.EncodeToMemory(GetCertificatePEMBlock(names["leaf"].Raw))); !errors.Is(err, verror.UserDataError) {
+		t.Errorf("a leaf certificate should fail, got %v", err)
+	}
+	if _, err = ParsePinnedIssuers([]byte("no certificate")); !errors.Is(err, verror.UserDataError) {
+		t.Errorf("an empty bundle should fail, got %v", err)
+	}
+}
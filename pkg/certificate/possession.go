@@ -0,0 +1,172 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/youmark/pkcs8"
+
+	"github.com/Venafi/vcert/v4/pkg/util"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// VerifyPossession proves that the private key of the collection belongs to its certificate: a random nonce is
+// signed with the private key and the signature is verified with the public key of the certificate. It catches a
+// certificate paired with the key of another one before they are installed. A collection without a private key
+// has nothing to prove and passes. An encrypted private key is decrypted with password.
+func (col *PEMCollection) VerifyPossession(password []byte) error {
+	if col.PrivateKey == "" {
+		return nil
+	}
+	b, _ := pem.Decode([]byte(col.Certificate))
+	if b == nil {
+		return fmt.Errorf("%w: failed to decode the certificate", verror.UserDataError)
+	}
+	cert, err := ParseCertificate(b.Bytes)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse the certificate: %s", verror.UserDataError, err)
+	}
+	key, err := parsePrivateKeyPEM([]byte(col.PrivateKey), password)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 32)
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+	err = proveKey(key, cert.PublicKey, nonce)
+	if err != nil {
+		return fmt.Errorf("%w: the private key doesn't belong to the certificate %s: %s", verror.CertificateCheckError,
+			cert.Subject.CommonName, err)
+	}
+	return nil
+}
+
+// DecryptPrivateKey replaces the encrypted private key of the collection with its decrypted PEM, which tls.Certificate
+// needs. A private key that isn't encrypted is left as is.
+func (col *PEMCollection) DecryptPrivateKey(password []byte) error {
+	b, _ := pem.Decode([]byte(col.PrivateKey))
+	if b == nil || b.Type != "ENCRYPTED PRIVATE KEY" && b.Headers["DEK-Info"] == "" {
+		return nil
+	}
+	key, err := parsePrivateKeyPEM([]byte(col.PrivateKey), password)
+	if err != nil {
+		return err
+	}
+	col.PrivateKey = ""
+	return col.AddPrivateKey(key, nil)
+}
+
+// proveKey signs nonce with key and verifies the signature with pub
+func proveKey(key crypto.Signer, pub crypto.PublicKey, nonce []byte) error {
+	digest := sha256.Sum256(nonce)
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		// an RSASSA-PSS key signs with PSS whatever the options, so both are verified
+		sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return err
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+		return rsa.VerifyPSS(pub, crypto.SHA256, digest[:], sig, nil)
+	case *ecdsa.PublicKey:
+		sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return err
+		}
+		var rs struct{ R, S *big.Int }
+		if _, err = asn1.Unmarshal(sig, &rs); err != nil {
+			return err
+		}
+		if !ecdsa.Verify(pub, digest[:], rs.R, rs.S) {
+			return fmt.Errorf("the ECDSA signature of the nonce doesn't verify")
+		}
+		return nil
+	case ed25519.PublicKey:
+		sig, err := key.Sign(rand.Reader, nonce, crypto.Hash(0))
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(pub, nonce, sig) {
+			return fmt.Errorf("the Ed25519 signature of the nonce doesn't verify")
+		}
+		return nil
+	}
+	// the keys crypto/x509 can't verify with, e.g. ML-DSA, are compared instead
+	if k, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); ok {
+		if k.Equal(pub) {
+			return nil
+		}
+		return fmt.Errorf("the public keys differ")
+	}
+	return fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// parsePrivateKeyPEM parses a private key in PEM, encrypted as PKCS#8 or with the legacy PEM encryption when
+// password is set
+func parsePrivateKeyPEM(data, password []byte) (crypto.Signer, error) {
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("%w: failed to decode the private key", verror.UserDataError)
+	}
+	der := b.Bytes
+	switch {
+	case b.Type == "ENCRYPTED PRIVATE KEY":
+		key, err := pkcs8.ParsePKCS8PrivateKey(der, password)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decrypt the private key: %s", verror.UserDataError, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported private key type %T", verror.UserDataError, key)
+		}
+		return signer, nil
+	case b.Headers["DEK-Info"] != "":
+		var err error
+		der, err = util.X509DecryptPEMBlock(b, password)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decrypt the private key: %s", verror.UserDataError, err)
+		}
+	}
+	var key crypto.Signer
+	var err error
+	switch b.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(der)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(der)
+	default:
+		key, err = ParsePKCS8PrivateKey(der)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse the private key: %s", verror.UserDataError, err)
+	}
+	return key, nil
+}
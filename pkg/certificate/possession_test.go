@@ -0,0 +1,93 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/util"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestVerifyPossession(t *testing.T) {
+	rsaKey, err := GenerateRSAPrivateKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenerateECDSAPrivateKey(EllipticCurveP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection := func(key crypto.Signer, password string, format ...string) *PEMCollection {
+		der, err := generateSelfSigned(getCertificateRequestForTest(), x509.KeyUsageDigitalSignature, nil, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcc, err := NewPEMCollection(cert, key, []byte(password), format...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pcc
+	}
+
+	for name, pcc := range map[string]*PEMCollection{
+		"rsa":              collection(rsaKey, ""),
+		"ecdsa":            collection(ecKey, ""),
+		"ed25519":          collection(edKey, ""),
+		"encrypted pkcs#8": collection(ecKey, "secret"),
+		"encrypted legacy": collection(rsaKey, "secret", util.LegacyPem),
+	} {
+		if err := pcc.VerifyPossession([]byte("secret")); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	if err := (&PEMCollection{Certificate: collection(rsaKey, "").Certificate}).VerifyPossession(nil); err != nil {
+		t.Fatalf("a collection without a private key should pass, got %s", err)
+	}
+
+	mixed := collection(rsaKey, "")
+	mixed.PrivateKey = collection(ecKey, "").PrivateKey
+	if err := mixed.VerifyPossession(nil); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("the key of another certificate should fail, got %v", err)
+	}
+	other, err := GenerateRSAPrivateKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixed = collection(rsaKey, "")
+	mixed.PrivateKey = collection(other, "").PrivateKey
+	if err := mixed.VerifyPossession(nil); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("another RSA key should fail, got %v", err)
+	}
+	if err := collection(ecKey, "secret").VerifyPossession([]byte("wrong")); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("a wrong password should fail, got %v", err)
+	}
+}
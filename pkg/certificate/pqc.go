@@ -0,0 +1,54 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// PQCAlgorithm is an experimental post-quantum signature algorithm for the keys of CSRs. It's meant for testing
+// which CAs accept such requests, the keys are generated with crypto/mldsa and need vcert to be built with Go 1.27
+// or later.
+type PQCAlgorithm string
+
+const (
+	PQCAlgorithmMLDSA44 PQCAlgorithm = "ML-DSA-44"
+	PQCAlgorithmMLDSA65 PQCAlgorithm = "ML-DSA-65"
+	PQCAlgorithmMLDSA87 PQCAlgorithm = "ML-DSA-87"
+)
+
+// ErrPQCUnsupported is returned for the post-quantum algorithms this build can't generate keys for
+var ErrPQCUnsupported = fmt.Errorf("%w: post-quantum keys are not supported", verror.UserDataError)
+
+// ParsePQCAlgorithm returns the algorithm named s, e.g. "ml-dsa-65". Hybrid (composite) signatures and ML-KEM are
+// rejected: crypto/x509 can't create composite CSRs, and a KEM key can't sign the CSR that proves its possession.
+func ParsePQCAlgorithm(s string) (PQCAlgorithm, error) {
+	switch n := strings.ToUpper(strings.Replace(s, "_", "-", -1)); {
+	case n == string(PQCAlgorithmMLDSA44), n == string(PQCAlgorithmMLDSA65), n == string(PQCAlgorithmMLDSA87):
+		return PQCAlgorithm(n), nil
+	case strings.HasPrefix(n, "ML-KEM"):
+		return "", fmt.Errorf("%w: %s keys can't sign a CSR, use ML-DSA", ErrPQCUnsupported, s)
+	case strings.Contains(n, "ML-DSA") && (strings.Contains(n, "RSA") || strings.Contains(n, "ECDSA") ||
+		strings.Contains(n, "ED25519") || strings.Contains(n, "P256") || strings.Contains(n, "P384")):
+		return "", fmt.Errorf("%w: hybrid %s keys can't be encoded in CSRs yet, use ML-DSA", ErrPQCUnsupported, s)
+	}
+	return "", fmt.Errorf("%w: unknown post-quantum algorithm %q, expected one of %s, %s or %s", verror.UserDataError,
+		s, PQCAlgorithmMLDSA44, PQCAlgorithmMLDSA65, PQCAlgorithmMLDSA87)
+}
@@ -0,0 +1,61 @@
+//go:build go1.27
+// +build go1.27
+
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestGeneratePQCPrivateKey(t *testing.T) {
+	key, err := GeneratePQCPrivateKey(PQCAlgorithmMLDSA65)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &Request{PrivateKey: key}
+	req.Subject.CommonName = "pq.example.com"
+	req.DNSNames = []string{"pq.example.com"}
+	err = req.GenerateCSR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(req.GetCSR())
+	if block == nil {
+		t.Fatal("CSR isn't PEM encoded")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.SignatureAlgorithm != x509.MLDSA65 {
+		t.Fatalf("expected an ML-DSA-65 signature, got %s", csr.SignatureAlgorithm)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	keyBlock, err := GetPrivateKeyPEMBock(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyBlock.Type != "PRIVATE KEY" {
+		t.Fatalf("expected a PKCS#8 key, got %s", keyBlock.Type)
+	}
+}
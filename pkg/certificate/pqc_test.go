@@ -0,0 +1,57 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestParsePQCAlgorithm(t *testing.T) {
+	for _, c := range []struct {
+		in          string
+		expected    PQCAlgorithm
+		unsupported bool
+	}{
+		{in: "ml-dsa-44", expected: PQCAlgorithmMLDSA44},
+		{in: "ML-DSA-65", expected: PQCAlgorithmMLDSA65},
+		{in: "ml_dsa_87", expected: PQCAlgorithmMLDSA87},
+		{in: "ml-kem-768", unsupported: true},
+		{in: "ml-dsa-65-ecdsa-p256", unsupported: true},
+		{in: "ml-dsa-44-rsa2048", unsupported: true},
+		{in: "sphincs"},
+	} {
+		alg, err := ParsePQCAlgorithm(c.in)
+		if c.expected != "" {
+			if err != nil || alg != c.expected {
+				t.Fatalf("%s: expected %s, got %s %v", c.in, c.expected, alg, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%s: expected an error", c.in)
+		}
+		if !errors.Is(err, verror.UserDataError) {
+			t.Fatalf("%s: expected a user data error, got %v", c.in, err)
+		}
+		if errors.Is(err, ErrPQCUnsupported) != c.unsupported {
+			t.Fatalf("%s: unexpected error %v", c.in, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !go1.27
+// +build !go1.27
+
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto"
+	"fmt"
+)
+
+// GeneratePQCPrivateKey generates an experimental post-quantum key, the CSRs it signs use the same algorithm
+func GeneratePQCPrivateKey(alg PQCAlgorithm) (crypto.Signer, error) {
+	return nil, fmt.Errorf("%w: vcert must be built with Go 1.27 or later for %s keys", ErrPQCUnsupported, alg)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Profile is the kind of a certificate that isn't for TLS. It requests the extended key usages of the kind, raises
+// the RSA key size to its minimum and checks the request names what the certificate needs. The zone still decides:
+// TPP issues the extended key usages when its policy permits them, VaaS issuing templates set their own.
+type Profile string
+
+const (
+	// ProfileCodeSigning signs code. Its subject names the publisher, with a common name and an organization, and it
+	// has no DNS names or IP addresses. The code signing baseline requirements ask for RSA keys of 3072 bits.
+	ProfileCodeSigning Profile = "code-signing"
+	// ProfileEmailProtection signs and encrypts mail with S/MIME, and signs documents in Acrobat and Office. It needs
+	// an email address, a bare mailbox address as rfc822Name SANs hold it, and has no DNS names or IP addresses. A
+	// common name that is an email address must be one of them, mail clients match either against the sender.
+	ProfileEmailProtection Profile = "email-protection"
+)
+
+// ParseProfile returns the profile named name, "smime" and "document-signing" are email-protection
+func ParseProfile(name string) (Profile, error) {
+	switch strings.ToLower(name) {
+	case "code-signing", "codesigning":
+		return ProfileCodeSigning, nil
+	case "email-protection", "smime", "document-signing":
+		return ProfileEmailProtection, nil
+	}
+	return "", fmt.Errorf("%w: unknown certificate profile %q, use code-signing or email-protection", verror.UserDataError, name)
+}
+
+// ExtKeyUsages returns the extended key usages of the profile
+func (p Profile) ExtKeyUsages() []x509.ExtKeyUsage {
+	switch p {
+	case ProfileCodeSigning:
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	case ProfileEmailProtection:
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+	}
+	return nil
+}
+
+// MinKeyLength returns the smallest RSA key size of the profile
+func (p Profile) MinKeyLength() int {
+	if p == ProfileCodeSigning {
+		return 3072
+	}
+	return defaultRSAlength
+}
+
+// Apply adds the extended key usages of the profile to req and checks its names and key. The common name of an
+// email-protection request defaults to its first email address, and an unset RSA key size to the minimum.
+func (p Profile) Apply(req *Request) error {
+	usages := p.ExtKeyUsages()
+	if usages == nil {
+		return fmt.Errorf("%w: unknown certificate profile %q", verror.UserDataError, string(p))
+	}
+	for _, u := range usages {
+		if !containsExtKeyUsage(req.ExtKeyUsages, u) {
+			req.ExtKeyUsages = append(req.ExtKeyUsages, u)
+		}
+	}
+	if len(req.DNSNames) > 0 || len(req.IPAddresses) > 0 {
+		return fmt.Errorf("%w: %s certificates can't have DNS names or IP addresses", verror.UserDataError, p)
+	}
+	switch p {
+	case ProfileCodeSigning:
+		if req.Subject.CommonName == "" || len(req.Subject.Organization) == 0 {
+			return fmt.Errorf("%w: code-signing certificates need a common name and an organization naming the publisher", verror.UserDataError)
+		}
+	case ProfileEmailProtection:
+		if len(req.EmailAddresses) == 0 {
+			return fmt.Errorf("%w: email-protection certificates need an email address", verror.UserDataError)
+		}
+		for _, email := range req.EmailAddresses {
+			if err := checkEmailAddress(email); err != nil {
+				return err
+			}
+		}
+		if req.Subject.CommonName == "" {
+			req.Subject.CommonName = req.EmailAddresses[0]
+		} else if strings.Contains(req.Subject.CommonName, "@") && !containsFold(req.EmailAddresses, req.Subject.CommonName) {
+			return fmt.Errorf("%w: the common name %s isn't one of the email addresses of the certificate", verror.UserDataError, req.Subject.CommonName)
+		}
+	}
+	if req.KeyType == KeyTypeRSA && req.KeyLength == 0 {
+		req.KeyLength = p.MinKeyLength()
+	}
+	if req.KeyType == KeyTypeRSA && req.CsrOrigin != UserProvidedCSR && req.KeyLength < p.MinKeyLength() {
+		return fmt.Errorf("%w: %s certificates need RSA keys of %d bits at least", verror.UserDataError, p, p.MinKeyLength())
+	}
+	return nil
+}
+
+// checkEmailAddress checks addr is a mailbox address an rfc822Name SAN can hold: local-part@domain without a display
+// name or angle brackets, in ASCII since internationalized addresses need the SmtpUTF8Mailbox SAN, and with a fully
+// qualified domain
+func checkEmailAddress(addr string) error {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return fmt.Errorf("%w: invalid email address %q: %s", verror.UserDataError, addr, err)
+	}
+	if a.Name != "" || a.Address != addr {
+		return fmt.Errorf("%w: invalid email address %q, use the bare address %s", verror.UserDataError, addr, a.Address)
+	}
+	if !isASCII(addr) {
+		return fmt.Errorf("%w: internationalized email address %q isn't supported", verror.UserDataError, addr)
+	}
+	domain := addr[strings.LastIndex(addr, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") {
+		return fmt.Errorf("%w: the domain of email address %q isn't a fully qualified domain name", verror.UserDataError, addr)
+	}
+	return nil
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
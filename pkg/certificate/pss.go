@@ -0,0 +1,205 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	// the hashes of the RSA-PSS signatures
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// RSA-PSS is handled partially by crypto/x509: it verifies the signatures whose salt is as long as the hash only,
+// and doesn't parse RSASSA-PSS public and private keys. The functions below fill the gaps, CAs signing with other
+// salt lengths (e.g. the OpenSSL default) or holding a PSS key being common.
+
+var (
+	oidRSASSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA1      = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// pssParameters is RSASSA-PSS-params of RFC 4055
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0,optional"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1,optional"`
+	SaltLength   int                      `asn1:"explicit,tag:2,optional,default:20"`
+	TrailerField int                      `asn1:"explicit,tag:3,optional,default:1"`
+}
+
+type rawCertificate struct {
+	TBSCertificate     asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// ParseCertificate parses a DER certificate like x509.ParseCertificate, and also parses an RSASSA-PSS public key
+// as an RSA key so the certificate can be matched with its private key and verify the certificates it signed
+func ParseCertificate(der []byte) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if cert.PublicKey == nil {
+		pub, err := parsePSSPublicKey(cert.RawSubjectPublicKeyInfo)
+		if err != nil {
+			return nil, err
+		}
+		if pub != nil {
+			cert.PublicKey = pub
+			cert.PublicKeyAlgorithm = x509.RSA
+		}
+	}
+	return cert, nil
+}
+
+func parsePSSPublicKey(spkiDER []byte) (*rsa.PublicKey, error) {
+	var spki subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(spkiDER, &spki); err != nil {
+		return nil, err
+	}
+	if !spki.Algorithm.Algorithm.Equal(oidRSASSAPSS) {
+		return nil, nil
+	}
+	return x509.ParsePKCS1PublicKey(spki.PublicKey.RightAlign())
+}
+
+// ParsePKCS8PrivateKey parses a PKCS#8 private key like x509.ParsePKCS8PrivateKey, RSASSA-PSS keys included
+func ParsePKCS8PrivateKey(der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		var p pkcs8PrivateKey
+		if _, perr := asn1.Unmarshal(der, &p); perr != nil || !p.Algorithm.Algorithm.Equal(oidRSASSAPSS) {
+			return nil, err
+		}
+		return x509.ParsePKCS1PrivateKey(p.PrivateKey)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported private key type %T", verror.UserDataError, key)
+	}
+	return signer, nil
+}
+
+// CheckSignatureFrom verifies that cert was signed by parent, like cert.CheckSignatureFrom, and supports RSA-PSS
+// signatures with any salt length and PSS keys. It's meant for chain building and checks, not as a replacement of
+// x509.Certificate.Verify.
+func CheckSignatureFrom(cert, parent *x509.Certificate) error {
+	err := cert.CheckSignatureFrom(parent)
+	if err == nil {
+		return nil
+	}
+	var raw rawCertificate
+	if _, rerr := asn1.Unmarshal(cert.Raw, &raw); rerr != nil || !raw.SignatureAlgorithm.Algorithm.Equal(oidRSASSAPSS) {
+		return err
+	}
+	if parent.Version == 3 && (!parent.BasicConstraintsValid || !parent.IsCA) {
+		return x509.ConstraintViolationError{}
+	}
+	if parent.KeyUsage != 0 && parent.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return x509.ConstraintViolationError{}
+	}
+	pub, ok := parent.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		if pub, err = parsePSSPublicKey(parent.RawSubjectPublicKeyInfo); err != nil || pub == nil {
+			return fmt.Errorf("%w: issuer %q has no RSA key to verify an RSA-PSS signature", verror.CertificateCheckError, parent.Subject.CommonName)
+		}
+	}
+	hash, opts, err := pssOptions(raw.SignatureAlgorithm.Parameters.FullBytes)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(cert.RawTBSCertificate)
+	err = rsa.VerifyPSS(pub, hash, h.Sum(nil), cert.Signature, opts)
+	if err != nil {
+		return fmt.Errorf("%w: invalid RSA-PSS signature: %s", verror.CertificateCheckError, err)
+	}
+	return nil
+}
+
+func pssOptions(params []byte) (crypto.Hash, *rsa.PSSOptions, error) {
+	p := pssParameters{SaltLength: 20, TrailerField: 1}
+	if len(params) > 0 {
+		rest, err := asn1.Unmarshal(params, &p)
+		if err != nil || len(rest) > 0 {
+			return 0, nil, fmt.Errorf("%w: invalid RSA-PSS parameters", verror.CertificateCheckError)
+		}
+	}
+	hash, err := pssHash(p.Hash.Algorithm)
+	if err != nil {
+		return 0, nil, err
+	}
+	// MGF1 with the same hash is the only mask generation rsa.VerifyPSS supports
+	mgfHash := crypto.SHA1
+	if len(p.MGF.Algorithm) > 0 {
+		if !p.MGF.Algorithm.Equal(oidMGF1) {
+			return 0, nil, fmt.Errorf("%w: unsupported RSA-PSS mask generation function %s", verror.CertificateCheckError, p.MGF.Algorithm)
+		}
+		var mgfAlg pkix.AlgorithmIdentifier
+		if _, err = asn1.Unmarshal(p.MGF.Parameters.FullBytes, &mgfAlg); err != nil {
+			return 0, nil, fmt.Errorf("%w: invalid RSA-PSS mask generation parameters", verror.CertificateCheckError)
+		}
+		if mgfHash, err = pssHash(mgfAlg.Algorithm); err != nil {
+			return 0, nil, err
+		}
+	}
+	if mgfHash != hash {
+		return 0, nil, fmt.Errorf("%w: RSA-PSS mask generation hash differs from the signature hash", verror.CertificateCheckError)
+	}
+	if p.TrailerField != 1 || p.SaltLength < 0 {
+		return 0, nil, fmt.Errorf("%w: invalid RSA-PSS parameters", verror.CertificateCheckError)
+	}
+	return hash, &rsa.PSSOptions{SaltLength: p.SaltLength, Hash: hash}, nil
+}
+
+func pssHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case len(oid) == 0, oid.Equal(oidSHA1):
+		// SHA-1 is the default hash of the parameters
+		return 0, fmt.Errorf("%w: SHA-1 RSA-PSS signatures are not supported", verror.CertificateCheckError)
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("%w: unsupported RSA-PSS hash %s", verror.CertificateCheckError, oid)
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Punycode parameters from RFC 3492
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+
+	acePrefix = "xn--"
+
+	maxLabelLength = 63
+	maxNameLength  = 253
+)
+
+// punycodeEncode encodes a Unicode label with the Punycode algorithm, without the ACE prefix
+func punycodeEncode(label string) string {
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < 0x80 {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for handled < len(runes) {
+		m := int(^uint(0) >> 1)
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+func punyThreshold(k, bias int) int {
+	t := k - bias
+	if t < punyTMin {
+		return punyTMin
+	}
+	if t > punyTMax {
+		return punyTMax
+	}
+	return t
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+// normalizeDNSName lowercases name, converts its Unicode labels to A-labels and checks the hostname syntax. A
+// wildcard is accepted as the leftmost label.
+func normalizeDNSName(name string) (string, error) {
+	name = strings.TrimSuffix(strings.ToLower(labelSeparators.Replace(strings.TrimSpace(name))), ".")
+	if name == "" {
+		return "", fmt.Errorf("%w: empty DNS name", verror.UserDataError)
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 && len(labels) > 1 {
+			continue
+		}
+		if !isASCII(label) {
+			if err := checkULabel(label); err != nil {
+				return "", fmt.Errorf("%w: invalid DNS name %q: %s", verror.UserDataError, name, err)
+			}
+			label = acePrefix + punycodeEncode(label)
+			labels[i] = label
+		} else if hasACEPrefix(label) {
+			u, err := punycodeDecode(label[len(acePrefix):])
+			if err != nil || isASCII(u) || checkULabel(u) != nil || acePrefix+punycodeEncode(u) != label {
+				return "", fmt.Errorf("%w: invalid DNS name %q: label %q is not a valid A-label", verror.UserDataError, name, label)
+			}
+		}
+		if err := checkLabel(label); err != nil {
+			return "", fmt.Errorf("%w: invalid DNS name %q: %s", verror.UserDataError, name, err)
+		}
+	}
+	name = strings.Join(labels, ".")
+	if len(name) > maxNameLength {
+		return "", fmt.Errorf("%w: DNS name %q is longer than %d characters", verror.UserDataError, name, maxNameLength)
+	}
+	return name, nil
+}
+
+func checkLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("empty label")
+	}
+	if len(label) > maxLabelLength {
+		return fmt.Errorf("label %q is longer than %d characters", label, maxLabelLength)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q starts or ends with a hyphen", label)
+	}
+	for _, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("label %q contains %q", label, c)
+		}
+	}
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
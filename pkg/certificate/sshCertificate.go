@@ -0,0 +1,127 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	SshCertificateTypeUser = "User"
+	SshCertificateTypeHost = "Host"
+
+	sshOptionForceCommand   = "force-command"
+	sshOptionSourceAddress  = "source-address"
+	sshCertificateAlgSuffix = "-cert-v01@openssh.com"
+)
+
+// IsSshCertificate reports whether data holds an OpenSSH certificate in the authorized_keys format of the -cert.pub
+// files
+func IsSshCertificate(data []byte) bool {
+	fields := bytes.Fields(bytes.TrimSpace(data))
+	return len(fields) > 1 && strings.HasSuffix(string(fields[0]), sshCertificateAlgSuffix)
+}
+
+// ParseSshCertificate reads an OpenSSH certificate in the authorized_keys format of the -cert.pub files
+func ParseSshCertificate(data []byte) (*ssh.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		return nil, fmt.Errorf("%w: found a PEM %s instead of an OpenSSH certificate", verror.UserDataError, block.Type)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read the OpenSSH certificate: %s", verror.UserDataError, err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%w: found an OpenSSH %s public key instead of a certificate", verror.UserDataError, key.Type())
+	}
+	return cert, nil
+}
+
+// NewSshCertificateDetails describes cert the way the details of an issued SSH certificate are returned by TPP, so
+// a certificate read from a file prints like one that was just enrolled
+func NewSshCertificateDetails(cert *ssh.Certificate) *SshCertificateDetails {
+	details := &SshCertificateDetails{
+		KeyType:                      cert.Key.Type(),
+		CertificateType:              SshCertificateTypeUser,
+		CertificateFingerprintSHA256: sshFingerprint(cert),
+		CAFingerprintSHA256:          sshFingerprint(cert.SignatureKey),
+		KeyID:                        cert.KeyId,
+		SerialNumber:                 strconv.FormatUint(cert.Serial, 10),
+		Principals:                   cert.ValidPrincipals,
+		ValidFrom:                    sshTime(cert.ValidAfter),
+		ValidTo:                      sshTime(cert.ValidBefore),
+		PublicKeyFingerprintSHA256:   sshFingerprint(cert.Key),
+	}
+	if cert.CertType == ssh.HostCert {
+		details.CertificateType = SshCertificateTypeHost
+	}
+	for name, value := range cert.CriticalOptions {
+		switch name {
+		case sshOptionForceCommand:
+			details.ForceCommand = value
+		case sshOptionSourceAddress:
+			for _, address := range strings.Split(value, ",") {
+				details.SourceAddresses = append(details.SourceAddresses, strings.TrimSpace(address))
+			}
+		default:
+			if details.CriticalOptions == nil {
+				details.CriticalOptions = make(map[string]string)
+			}
+			details.CriticalOptions[name] = value
+		}
+	}
+	if len(cert.Extensions) > 0 {
+		details.Extensions = make(map[string]interface{}, len(cert.Extensions))
+		for name, value := range cert.Extensions {
+			details.Extensions[name] = value
+		}
+	}
+	return details
+}
+
+// SshExtensionNames returns the names of the extensions of details in order
+func SshExtensionNames(details *SshCertificateDetails) []string {
+	names := make([]string, 0, len(details.Extensions))
+	for name := range details.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sshFingerprint is the SHA256 fingerprint without the SHA256: prefix, as TPP returns it
+func sshFingerprint(key ssh.PublicKey) string {
+	return strings.TrimPrefix(ssh.FingerprintSHA256(key), "SHA256:")
+}
+
+// sshTime converts an OpenSSH validity bound to Unix seconds, keeping the "forever" bound as the largest value
+func sshTime(t uint64) int64 {
+	if t > uint64(ssh.CertTimeInfinity>>1) {
+		return int64(ssh.CertTimeInfinity >> 1)
+	}
+	return int64(t)
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestSshCertificate(t *testing.T) *ssh.Certificate {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          42,
+		CertType:        ssh.UserCert,
+		KeyId:           "alice@example.com",
+		ValidPrincipals: []string{"alice", "admin"},
+		ValidAfter:      1640995200,
+		ValidBefore:     ssh.CertTimeInfinity,
+		Permissions: ssh.Permissions{
+			CriticalOptions: map[string]string{
+				"force-command":   "/usr/bin/backup",
+				"source-address":  "10.0.0.0/8, 192.168.1.1",
+				"verify-required": "",
+			},
+			Extensions: map[string]string{"permit-pty": "", "permit-X11-forwarding": ""},
+		},
+	}
+	err = cert.SignCert(rand.Reader, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestParseSshCertificate(t *testing.T) {
+	cert := newTestSshCertificate(t)
+	data := ssh.MarshalAuthorizedKey(cert)
+	if !IsSshCertificate(data) {
+		t.Fatalf("%s isn't recognized as a certificate", data)
+	}
+	parsed, err := ParseSshCertificate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewSshCertificateDetails(parsed)
+	if d.CertificateType != SshCertificateTypeUser || d.KeyID != "alice@example.com" || d.SerialNumber != "42" || d.KeyType != ssh.KeyAlgoED25519 {
+		t.Errorf("unexpected details %+v", d)
+	}
+	if d.ValidFrom != 1640995200 || d.ValidTo != math.MaxInt64 {
+		t.Errorf("unexpected validity %d - %d", d.ValidFrom, d.ValidTo)
+	}
+	if d.ForceCommand != "/usr/bin/backup" || !reflect.DeepEqual(d.SourceAddresses, []string{"10.0.0.0/8", "192.168.1.1"}) {
+		t.Errorf("unexpected critical options %q %q", d.ForceCommand, d.SourceAddresses)
+	}
+	if !reflect.DeepEqual(d.CriticalOptions, map[string]string{"verify-required": ""}) {
+		t.Errorf("unexpected critical options %v", d.CriticalOptions)
+	}
+	if names := SshExtensionNames(d); !reflect.DeepEqual(names, []string{"permit-X11-forwarding", "permit-pty"}) {
+		t.Errorf("unexpected extensions %v", names)
+	}
+	if d.CAFingerprintSHA256 == "" || d.PublicKeyFingerprintSHA256 == d.CAFingerprintSHA256 {
+		t.Errorf("unexpected fingerprints %+v", d)
+	}
+
+	for _, data := range [][]byte{ssh.MarshalAuthorizedKey(cert.Key), []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n")} {
+		if IsSshCertificate(data) {
+			t.Errorf("%s is recognized as a certificate", data)
+		}
+		if _, err = ParseSshCertificate(data); err == nil {
+			t.Errorf("expected an error for %s", data)
+		}
+	}
+}
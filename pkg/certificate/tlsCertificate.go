@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+// ToServerTLSCertificate returns the certificate, its chain and its private key as a tls.Certificate for a TLS
+// server. The leaf must allow the serverAuth extended key usage, and its key usage must allow the TLS handshake
+// signatures: digitalSignature, or keyEncipherment for the RSA key exchange of TLS 1.2. A leaf without the extensions
+// is accepted, like TLS clients do. The private key must be decrypted.
+func (col *PEMCollection) ToServerTLSCertificate() (tls.Certificate, error) {
+	return col.toTLSCertificate("server", x509.ExtKeyUsageServerAuth)
+}
+
+// ToClientTLSCertificate returns the certificate, its chain and its private key as a tls.Certificate for a TLS
+// client. The leaf must allow the clientAuth extended key usage and the digitalSignature key usage, which signs the
+// CertificateVerify message of the handshake. A leaf without the extensions is accepted, like TLS servers do. The
+// private key must be decrypted.
+func (col *PEMCollection) ToClientTLSCertificate() (tls.Certificate, error) {
+	return col.toTLSCertificate("client", x509.ExtKeyUsageClientAuth)
+}
+
+func (col *PEMCollection) toTLSCertificate(role string, usage x509.ExtKeyUsage) (tls.Certificate, error) {
+	if col.PrivateKey == "" {
+		return tls.Certificate{}, fmt.Errorf("%w: a TLS %s certificate needs its private key", verror.UserDataError, role)
+	}
+	// X509KeyPair also checks that the private key matches the certificate
+	cert, err := tls.X509KeyPair([]byte(col.Certificate+strings.Join(col.Chain, "")), []byte(col.PrivateKey))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%w: %s", verror.UserDataError, err)
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%w: failed to parse the certificate: %s", verror.UserDataError, err)
+	}
+	err = checkTLSRole(cert.Leaf, role, usage)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return cert, nil
+}
+
+// checkTLSRole checks that leaf can authenticate the TLS role with the extended key usage usage
+func checkTLSRole(leaf *x509.Certificate, role string, usage x509.ExtKeyUsage) error {
+	if len(leaf.ExtKeyUsage) > 0 || len(leaf.UnknownExtKeyUsage) > 0 {
+		var names []string
+		found := false
+		for _, u := range leaf.ExtKeyUsage {
+			found = found || u == usage || u == x509.ExtKeyUsageAny
+			if name, ok := extKeyUsageNames[u]; ok {
+				names = append(names, name)
+			} else {
+				names = append(names, fmt.Sprintf("%d", u))
+			}
+		}
+		for _, oid := range leaf.UnknownExtKeyUsage {
+			names = append(names, oid.String())
+		}
+		if !found {
+			return fmt.Errorf("%w: the certificate %s can't authenticate a TLS %s: its extended key usages are %s, %s is missing",
+				verror.CertificateCheckError, leaf.Subject.CommonName, role, strings.Join(names, ", "), extKeyUsageNames[usage])
+		}
+	}
+	if leaf.KeyUsage == 0 || leaf.KeyUsage&x509.KeyUsageDigitalSignature != 0 {
+		return nil
+	}
+	if _, isRSA := leaf.PublicKey.(*rsa.PublicKey); isRSA && role == "server" && leaf.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: the certificate %s can't authenticate a TLS %s: its key usage lacks digitalSignature",
+		verror.CertificateCheckError, leaf.Subject.CommonName, role)
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestToRoleTLSCertificate(t *testing.T) {
+	rsaKey, err := GenerateRSAPrivateKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenerateECDSAPrivateKey(EllipticCurveP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection := func(key crypto.Signer, ku x509.KeyUsage, eku ...x509.ExtKeyUsage) *PEMCollection {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "vcert.test.vfidev.com"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().AddDate(0, 0, 90),
+			KeyUsage:     ku,
+			ExtKeyUsage:  eku,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pcc, err := NewPEMCollection(cert, key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pcc
+	}
+
+	cases := []struct {
+		name           string
+		pcc            *PEMCollection
+		server, client string
+	}{
+		{"server and client", collection(ecKey, x509.KeyUsageDigitalSignature, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth), "", ""},
+		{"no extensions", collection(ecKey, 0), "", ""},
+		{"any", collection(ecKey, x509.KeyUsageDigitalSignature, x509.ExtKeyUsageAny), "", ""},
+		{"server only", collection(ecKey, x509.KeyUsageDigitalSignature, x509.ExtKeyUsageServerAuth), "",
+			"can't authenticate a TLS client: its extended key usages are serverAuth, clientAuth is missing"},
+		{"client only", collection(ecKey, x509.KeyUsageDigitalSignature, x509.ExtKeyUsageClientAuth),
+			"can't authenticate a TLS server: its extended key usages are clientAuth, serverAuth is missing", ""},
+		{"rsa key exchange", collection(rsaKey, x509.KeyUsageKeyEncipherment, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth), "",
+			"can't authenticate a TLS client: its key usage lacks digitalSignature"},
+		{"ecdsa key encipherment", collection(ecKey, x509.KeyUsageKeyEncipherment, x509.ExtKeyUsageServerAuth),
+			"can't authenticate a TLS server: its key usage lacks digitalSignature", "clientAuth is missing"},
+	}
+	for _, c := range cases {
+		for role, expected := range map[string]string{"server": c.server, "client": c.client} {
+			convert := c.pcc.ToServerTLSCertificate
+			if role == "client" {
+				convert = c.pcc.ToClientTLSCertificate
+			}
+			cert, err := convert()
+			switch {
+			case expected == "" && err != nil:
+				t.Errorf("%s: %s: %s", c.name, role, err)
+			case expected == "" && cert.Leaf == nil:
+				t.Errorf("%s: %s: the leaf should be set", c.name, role)
+			case expected != "" && (!errors.Is(err, verror.CertificateCheckError) || !strings.Contains(err.Error(), expected)):
+				t.Errorf("%s: %s: expected %q, got %v", c.name, role, expected, err)
+			}
+		}
+	}
+
+	mixed := collection(ecKey, 0)
+	mixed.PrivateKey = collection(rsaKey, 0).PrivateKey
+	if _, err = mixed.ToServerTLSCertificate(); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("the key of another certificate should fail, got %v", err)
+	}
+	if _, err = (&PEMCollection{Certificate: mixed.Certificate}).ToClientTLSCertificate(); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("a collection without a private key should fail, got %v", err)
+	}
+}
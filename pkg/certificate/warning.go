@@ -0,0 +1,106 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// The codes of the warnings
+const (
+	// WarningPolicyDefault reports a value of the request set by the policy of the zone
+	WarningPolicyDefault = "policy_default"
+	// WarningSANDeduplicated reports a SAN dropped because it was already requested
+	WarningSANDeduplicated = "san_deduplicated"
+	// WarningWeakKey reports a key accepted although it's weaker than recommended
+	WarningWeakKey = "weak_key"
+	// WarningChainIncomplete reports a chain that doesn't link the certificate to its issuers
+	WarningChainIncomplete = "chain_incomplete"
+)
+
+// minStrongRSALength is the length of the RSA keys below which they're reported as weak
+const minStrongRSALength = 2048
+
+// Warning is a non-fatal condition met while a request is built, completed or issued. It doesn't fail the request,
+// automation logs it, keying off its code.
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	return w.Code + ": " + w.Message
+}
+
+// Warn records a warning in the Warnings of the request and passes it to OnWarning when it's set
+func (request *Request) Warn(code, format string, args ...interface{}) {
+	w := Warning{Code: code, Message: fmt.Sprintf(format, args...)}
+	request.Warnings = append(request.Warnings, w)
+	if request.OnWarning != nil {
+		request.OnWarning(w)
+	}
+}
+
+// CheckChain warns when the chain of certificates doesn't link the certificate to its issuers: when an issuer is
+// missing or when it's empty although it was requested
+func (request *Request) CheckChain(pcc *PEMCollection) {
+	if pcc == nil || request.ChainOption == ChainOptionIgnore {
+		return
+	}
+	var certs []*x509.Certificate
+	for _, p := range append([]string{pcc.Certificate}, pcc.Chain...) {
+		b, _ := pem.Decode([]byte(p))
+		if b == nil {
+			return
+		}
+		cert, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return
+		}
+		certs = append(certs, cert)
+	}
+	if request.ChainOption == ChainOptionRootFirst {
+		// the leaf stays first, its chain is root first
+		for i, j := 1, len(certs)-1; i < j; i, j = i+1, j-1 {
+			certs[i], certs[j] = certs[j], certs[i]
+		}
+	}
+	leaf := certs[0]
+	if len(certs) == 1 {
+		if !bytes.Equal(leaf.RawIssuer, leaf.RawSubject) {
+			request.Warn(WarningChainIncomplete, "no chain was returned for the certificate issued by %s", leaf.Issuer)
+		}
+		return
+	}
+	for i := 0; i < len(certs)-1; i++ {
+		if !bytes.Equal(certs[i].RawIssuer, certs[i+1].RawSubject) {
+			request.Warn(WarningChainIncomplete, "the chain lacks the issuer %s of %s", certs[i].Issuer, certs[i].Subject)
+			return
+		}
+	}
+}
+
+// checkKeyStrength warns when the key of the issued certificate is weaker than recommended
+func (request *Request) checkKeyStrength(cert *x509.Certificate) {
+	if pub, ok := cert.PublicKey.(*rsa.PublicKey); ok && pub.N.BitLen() < minStrongRSALength {
+		request.Warn(WarningWeakKey, "the RSA key of %d bits is weaker than the %d bits recommended", pub.N.BitLen(), minStrongRSALength)
+	}
+}
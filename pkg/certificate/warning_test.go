@@ -0,0 +1,129 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestBuilderWarnings(t *testing.T) {
+	var seen []Warning
+	b := NewRequestBuilder().CommonName("www.example.com").DNSNames("www.example.com", "WWW.example.com", "api.example.com")
+	req, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Warnings) != 1 || req.Warnings[0].Code != WarningSANDeduplicated {
+		t.Fatalf("expected a deduplicated SAN warning, got %v", req.Warnings)
+	}
+
+	req = &Request{OnWarning: func(w Warning) { seen = append(seen, w) }}
+	req.Warn(WarningPolicyDefault, "key size set to %d by the zone", 2048)
+	if len(seen) != 1 || seen[0].String() != "policy_default: key size set to 2048 by the zone" || len(req.Warnings) != 1 {
+		t.Fatalf("unexpected warnings %v", seen)
+	}
+}
+
+func issueTestCertificate(t *testing.T, cn string, pub interface{}, parent *x509.Certificate, key interface{}) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func toPEM(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+func TestCheckChain(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	root := issueTestCertificate(t, "Root", caKey.Public(), nil, caKey)
+	interKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	inter := issueTestCertificate(t, "Intermediate", interKey.Public(), root, caKey)
+	leafKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf := issueTestCertificate(t, "www.example.com", leafKey.Public(), inter, interKey)
+
+	for _, tt := range []struct {
+		name     string
+		option   ChainOption
+		chain    []*x509.Certificate
+		complete bool
+	}{
+		{"root last", ChainOptionRootLast, []*x509.Certificate{inter, root}, true},
+		{"root first", ChainOptionRootFirst, []*x509.Certificate{root, inter}, true},
+		{"no root", ChainOptionRootLast, []*x509.Certificate{inter}, true},
+		{"missing intermediate", ChainOptionRootLast, []*x509.Certificate{root}, false},
+		{"no chain", ChainOptionRootLast, nil, false},
+		{"ignored", ChainOptionIgnore, nil, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pcc := &PEMCollection{Certificate: toPEM(leaf)}
+			for _, c := range tt.chain {
+				pcc.Chain = append(pcc.Chain, toPEM(c))
+			}
+			req := &Request{ChainOption: tt.option}
+			req.CheckChain(pcc)
+			if tt.complete != (len(req.Warnings) == 0) {
+				t.Fatalf("unexpected warnings %v", req.Warnings)
+			}
+			if !tt.complete && req.Warnings[0].Code != WarningChainIncomplete {
+				t.Fatalf("unexpected warning %v", req.Warnings[0])
+			}
+		})
+	}
+}
+
+func TestCheckCertificateWeakKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := issueTestCertificate(t, "legacy.example.com", key.Public(), nil, key)
+	req := &Request{}
+	if err = req.CheckCertificate(toPEM(cert)); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Warnings) != 1 || req.Warnings[0].Code != WarningWeakKey {
+		t.Fatalf("expected a weak key warning, got %v", req.Warnings)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package coalesce merges identical certificate enrollments made at the same time into a single one. In a service
+// mesh many workloads often ask for the same certificate at once, e.g. when a deployment scales out, and only the
+// first request needs to reach the platform.
+package coalesce
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+// Enroller enrolls certificates with Connector. Concurrent calls for the same zone, subject, SANs, custom fields,
+// key parameters and, when the caller brings its own, the same key or CSR share one enrollment and receive copies
+// of the same PEMCollection, private key included. An Enroller is created by NewEnroller.
+type Enroller struct {
+	// Connector is set to the zone by NewEnroller, the enrollments use it concurrently
+	Connector endpoint.Connector
+
+	// zone is the zone the certificates are requested in
+	zone string
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	wg  sync.WaitGroup
+	pcc *certificate.PEMCollection
+	err error
+	// shared counts the callers that waited for this call
+	shared int
+}
+
+// NewEnroller returns an Enroller for zone, which it sets on connector
+func NewEnroller(connector endpoint.Connector, zone string) *Enroller {
+	connector.SetZone(zone)
+	return &Enroller{Connector: connector, zone: zone}
+}
+
+// Enroll requests and retrieves a certificate for req, or waits for an identical enrollment in flight. The shared
+// result tells whether the PEMCollection was also handed to other callers. Only the request of the caller that
+// actually enrolled is updated with the pickup ID and the private key.
+func (e *Enroller) Enroll(req *certificate.Request) (pcc *certificate.PEMCollection, shared bool, err error) {
+	key := e.key(req)
+	e.mu.Lock()
+	if e.calls == nil {
+		e.calls = make(map[string]*call)
+	}
+	if c, ok := e.calls[key]; ok {
+		c.shared++
+		e.mu.Unlock()
+		c.wg.Wait()
+		return copyPEMCollection(c.pcc), true, c.err
+	}
+	c := &call{}
+	c.wg.Add(1)
+	e.calls[key] = c
+	e.mu.Unlock()
+
+	c.pcc, c.err = e.enroll(req)
+
+	e.mu.Lock()
+	delete(e.calls, key)
+	shared = c.shared > 0
+	e.mu.Unlock()
+	c.wg.Done()
+	return copyPEMCollection(c.pcc), shared, c.err
+}
+
+func (e *Enroller) enroll(req *certificate.Request) (*certificate.PEMCollection, error) {
+	err := e.Connector.GenerateRequest(nil, req)
+	if err != nil {
+		return nil, err
+	}
+	req.PickupID, err = e.Connector.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	pcc, err := e.Connector.RetrieveCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.CsrOrigin != certificate.ServiceGeneratedCSR && req.PrivateKey != nil {
+		err = pcc.AddPrivateKey(req.PrivateKey, []byte(req.KeyPassword))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pcc, nil
+}
+
+// key identifies the certificates that are interchangeable. The key password is part of it since the private key
+// is returned encrypted with it. A private key or CSR supplied by the caller is part of it as well, so callers only
+// share a certificate issued for their own key.
+func (e *Enroller) key(req *certificate.Request) string {
+	var ips, uris, fields []string
+	for _, ip := range req.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	for _, u := range req.URIs {
+		uris = append(uris, u.String())
+	}
+	for _, f := range req.CustomFields {
+		fields = append(fields, fmt.Sprintf("%d:%s=%s", f.Type, f.Name, f.Value))
+	}
+	sort.Strings(fields)
+	var ownKey []byte
+	if req.PrivateKey != nil {
+		ownKey, _ = x509.MarshalPKIXPublicKey(req.PrivateKey.Public())
+	}
+	csr := sha256.Sum256(req.GetCSR())
+	parts := []string{
+		e.zone,
+		req.Subject.String(),
+		sorted(req.DNSNames),
+		sorted(req.EmailAddresses),
+		sorted(ips),
+		sorted(uris),
+		sorted(req.UPNs),
+		req.KeyType.String(),
+		req.KeyCurve.String(),
+		req.KeyPassword,
+		fmt.Sprintf("%d/%d/%d/%d", req.KeyLength, req.ChainOption, req.CsrOrigin, req.ValidityHours),
+		strings.Join(fields, "\x00"),
+		hex.EncodeToString(ownKey),
+		hex.EncodeToString(csr[:]),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func sorted(values []string) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strings.ToLower(v)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+func copyPEMCollection(pcc *certificate.PEMCollection) *certificate.PEMCollection {
+	if pcc == nil {
+		return nil
+	}
+	c := *pcc
+	c.Chain = append([]string(nil), pcc.Chain...)
+	return &c
+}
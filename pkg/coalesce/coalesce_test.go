@@ -0,0 +1,185 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package coalesce
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+type countingConnector struct {
+	*fake.Connector
+	requests int32
+}
+
+func (c *countingConnector) RequestCertificate(req *certificate.Request) (string, error) {
+	atomic.AddInt32(&c.requests, 1)
+	// keep the enrollment in flight long enough for the other callers to join it
+	time.Sleep(100 * time.Millisecond)
+	return c.Connector.RequestCertificate(req)
+}
+
+// barrierConnector fails the requests that aren't in flight at the same time as the others
+type barrierConnector struct {
+	*fake.Connector
+	wg sync.WaitGroup
+}
+
+func (c *barrierConnector) RequestCertificate(req *certificate.Request) (string, error) {
+	c.wg.Done()
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		return "", fmt.Errorf("enrollment of %s wasn't concurrent with the others", req.Subject.CommonName)
+	}
+	return c.Connector.RequestCertificate(req)
+}
+
+func newRequest(cn string, sans ...string) *certificate.Request {
+	req := &certificate.Request{DNSNames: sans}
+	req.Subject.CommonName = cn
+	return req
+}
+
+func TestEnrollCoalescesIdenticalRequests(t *testing.T) {
+	conn := &countingConnector{Connector: fake.NewConnector(false, nil)}
+	e := NewEnroller(conn, "Default")
+
+	const callers = 10
+	results := make([]*certificate.PEMCollection, callers)
+	var sharedCount int32
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// same SANs in a different order and case
+			sans := []string{"mesh.example.com", "Svc.example.com"}
+			if i%2 == 1 {
+				sans = []string{"svc.example.com", "mesh.example.com"}
+			}
+			pcc, shared, err := e.Enroll(newRequest("mesh.example.com", sans...))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+			results[i] = pcc
+		}(i)
+	}
+	wg.Wait()
+
+	if conn.requests != 1 {
+		t.Fatalf("expected a single enrollment, got %d", conn.requests)
+	}
+	if sharedCount != callers {
+		t.Fatalf("expected every caller to get a shared result, got %d", sharedCount)
+	}
+	for _, pcc := range results[1:] {
+		if pcc == nil || pcc.Certificate != results[0].Certificate || pcc.PrivateKey != results[0].PrivateKey {
+			t.Fatal("callers should receive the same certificate and key")
+		}
+		if pcc == results[0] {
+			t.Fatal("callers should receive their own copy")
+		}
+	}
+
+	_, shared, err := e.Enroll(newRequest("other.example.com"))
+	if err != nil || shared || conn.requests != 2 {
+		t.Fatalf("different request should be enrolled on its own, got %v, %v, %d", err, shared, conn.requests)
+	}
+}
+
+func TestEnrollDifferentRequestsConcurrently(t *testing.T) {
+	conn := &barrierConnector{Connector: fake.NewConnector(false, nil)}
+	e := NewEnroller(conn, "Default")
+
+	names := []string{"a.example.com", "b.example.com", "c.example.com"}
+	conn.wg.Add(len(names))
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if _, _, err := e.Enroll(newRequest(name)); err != nil {
+				t.Error(err)
+			}
+		}(name)
+	}
+	wg.Wait()
+}
+
+func TestKeyDistinguishesOwnKeyAndCustomFields(t *testing.T) {
+	e := NewEnroller(fake.NewConnector(false, nil), "Default")
+	base := e.key(newRequest("mesh.example.com"))
+
+	withFields := newRequest("mesh.example.com")
+	withFields.CustomFields = []certificate.CustomField{{Name: "Cost Center", Value: "42"}}
+	if e.key(withFields) == base {
+		t.Fatal("custom fields should be part of the key")
+	}
+
+	withKey := func() *certificate.Request {
+		req := newRequest("mesh.example.com")
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.PrivateKey = k
+		return req
+	}
+	first, second := withKey(), withKey()
+	if e.key(first) == base || e.key(first) == e.key(second) {
+		t.Fatal("requests with their own private key should not share a certificate")
+	}
+
+	withCSR := newRequest("mesh.example.com")
+	withCSR.CsrOrigin = certificate.UserProvidedCSR
+	if err := first.GenerateCSR(); err != nil {
+		t.Fatal(err)
+	}
+	if err := withCSR.SetCSR(first.GetCSR()); err != nil {
+		t.Fatal(err)
+	}
+	otherCSR := newRequest("mesh.example.com")
+	otherCSR.CsrOrigin = certificate.UserProvidedCSR
+	if err := second.GenerateCSR(); err != nil {
+		t.Fatal(err)
+	}
+	if err := otherCSR.SetCSR(second.GetCSR()); err != nil {
+		t.Fatal(err)
+	}
+	if e.key(withCSR) == e.key(otherCSR) {
+		t.Fatal("requests with their own CSR should not share a certificate")
+	}
+}
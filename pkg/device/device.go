@@ -0,0 +1,299 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package device enrolls the identity certificate of a workstation, which authenticates it to the network with
+// 802.1X EAP-TLS. The certificate names the machine by its host name and by the serial number of its hardware, read
+// from the DMI tables, and has the clientAuth extended key usage. It is renewed before it expires or once the machine
+// is renamed, and installed in the certificate store of the system.
+package device
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	DefaultRenewBefore = 30 * 24 * time.Hour
+	DefaultInterval    = 12 * time.Hour
+
+	retrieveTimeout = 3 * time.Minute
+)
+
+// Attributes identify the machine
+type Attributes struct {
+	// Hostname is the name of the machine, fully qualified when the system knows its domain
+	Hostname string
+	// SerialNumber is the serial number of the hardware, empty when the firmware doesn't set one or it can't be read,
+	// e.g. without root privileges on Linux
+	SerialNumber string
+	Manufacturer string
+	Model        string
+}
+
+// ReadAttributes returns the attributes of the running machine
+func ReadAttributes() (Attributes, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return Attributes{}, fmt.Errorf("failed to read the host name: %s", err)
+	}
+	attrs := readHardware()
+	attrs.Hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	attrs.SerialNumber = cleanSerial(attrs.SerialNumber)
+	return attrs, nil
+}
+
+// Store keeps the identity of the machine
+type Store interface {
+	// Name identifies the store in logs and errors
+	Name() string
+	// Current returns the certificate of the installed identity, nil when there is none
+	Current() (*x509.Certificate, error)
+	// Install replaces the identity with the certificate, its chain and its private key
+	Install(ctx context.Context, pcc *certificate.PEMCollection) error
+}
+
+// Result is the outcome of a check of the identity
+type Result struct {
+	Certificate *x509.Certificate
+	// Kept is set when the installed certificate is still good and nothing was requested
+	Kept bool
+}
+
+// Enroller keeps the identity certificate of the machine enrolled
+type Enroller struct {
+	Connector endpoint.Connector
+	// Zone is the zone of the certificate, the one of the connector when empty
+	Zone string
+	// Store is where the identity is installed
+	Store Store
+	// RenewBefore is how long before its expiry the certificate is renewed, it defaults to DefaultRenewBefore
+	RenewBefore time.Duration
+	KeyType     certificate.KeyType
+	KeyLength   int
+	KeyCurve    certificate.EllipticCurve
+	// Attributes returns the attributes of the machine, ReadAttributes by default
+	Attributes func() (Attributes, error)
+	// Log receives progress messages when it's set
+	Log func(format string, args ...interface{})
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+}
+
+// Enroll requests the identity certificate when the store has none, when it expires within RenewBefore or when it
+// names another machine, and installs it
+func (e *Enroller) Enroll(ctx context.Context) (*Result, error) {
+	if e.Store == nil {
+		return nil, fmt.Errorf("%w: a store is required to install the device identity", verror.UserDataError)
+	}
+	readAttributes := e.Attributes
+	if readAttributes == nil {
+		readAttributes = ReadAttributes
+	}
+	attrs, err := readAttributes()
+	if err != nil {
+		return nil, err
+	}
+	if attrs.Hostname == "" {
+		return nil, fmt.Errorf("%w: the machine has no host name", verror.UserDataError)
+	}
+	current, err := e.Store.Current()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the identity of %s: %w", e.Store.Name(), err)
+	}
+	reason := e.renewal(current, attrs)
+	if reason == "" {
+		return &Result{Certificate: current, Kept: true}, nil
+	}
+	e.logf("Requesting the identity of %s: %s", attrs.Hostname, reason)
+
+	req, err := e.request(attrs)
+	if err != nil {
+		return nil, err
+	}
+	if e.Zone != "" {
+		e.Connector.SetZone(e.Zone)
+	}
+	zc, err := e.Connector.ReadZoneConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read zone configuration: %w", err)
+	}
+	err = e.Connector.GenerateRequest(zc, req)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req.PickupID, err = e.Connector.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	req.Timeout = retrieveTimeout
+	pcc, err := e.Connector.RetrieveCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := checkCertificate(pcc.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	err = pcc.AddPrivateKey(req.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = e.Store.Install(ctx, pcc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to install the identity in %s: %w", e.Store.Name(), err)
+	}
+	return &Result{Certificate: cert}, nil
+}
+
+// Run checks the identity every interval until ctx is done. A failed check is logged and tried again at the next
+// one, the network may not be reachable before the machine is authenticated.
+func (e *Enroller) Run(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	for {
+		res, err := e.Enroll(ctx)
+		if err != nil {
+			e.logf("Failed to enroll the device identity: %s", err)
+		} else if !res.Kept {
+			e.logf("Installed the device identity %s (serial %x), valid until %s", res.Certificate.Subject.CommonName,
+				res.Certificate.SerialNumber, res.Certificate.NotAfter.Format(time.RFC3339))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// renewal returns why the certificate must be requested, empty when it's still good
+func (e *Enroller) renewal(cert *x509.Certificate, attrs Attributes) string {
+	if cert == nil {
+		return "no identity installed"
+	}
+	if !strings.EqualFold(cert.Subject.CommonName, attrs.Hostname) {
+		return fmt.Sprintf("the identity names %s", cert.Subject.CommonName)
+	}
+	if cert.Subject.SerialNumber != attrs.SerialNumber {
+		return "the serial number of the hardware changed"
+	}
+	renewBefore := e.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = DefaultRenewBefore
+	}
+	now := time.Now
+	if e.Now != nil {
+		now = e.Now
+	}
+	if cert.NotAfter.Sub(now()) < renewBefore {
+		return fmt.Sprintf("the identity expires on %s", cert.NotAfter.Format("2006-01-02"))
+	}
+	return ""
+}
+
+func (e *Enroller) request(attrs Attributes) (*certificate.Request, error) {
+	b := certificate.NewRequestBuilder().
+		CommonName(attrs.Hostname).
+		// network access servers map the DNS name to the computer account, e.g. NPS to Active Directory
+		DNSNames(attrs.Hostname).
+		ExtKeyUsages(x509.ExtKeyUsageClientAuth).
+		KeyType(e.KeyType).
+		ChainOption(certificate.ChainOptionRootLast)
+	if e.KeyLength != 0 {
+		b.KeyLength(e.KeyLength)
+	}
+	if e.KeyCurve != certificate.EllipticCurveNotSet {
+		b.KeyCurve(e.KeyCurve)
+	}
+	req, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	// the serial number keeps the identity to the hardware, a renamed or reinstalled machine is still recognized
+	req.Subject.SerialNumber = attrs.SerialNumber
+	return req, nil
+}
+
+func (e *Enroller) logf(format string, args ...interface{}) {
+	if e.Log != nil {
+		e.Log(format, args...)
+	}
+}
+
+// checkCertificate parses the issued certificate and checks a network access server accepts it for EAP-TLS
+func checkCertificate(certPEM string) (*x509.Certificate, error) {
+	cert, err := parseCertificate([]byte(certPEM))
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("%w: failed to decode the issued certificate", verror.ServerError)
+	}
+	if len(cert.ExtKeyUsage) == 0 {
+		return cert, nil
+	}
+	for _, u := range cert.ExtKeyUsage {
+		if u == x509.ExtKeyUsageClientAuth || u == x509.ExtKeyUsageAny {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: the certificate was issued without the clientAuth extended key usage, check the policy of the zone", verror.CertificateCheckError)
+}
+
+// cleanSerial drops the placeholders firmwares set instead of a serial number
+func cleanSerial(serial string) string {
+	serial = strings.TrimSpace(serial)
+	switch strings.ToLower(serial) {
+	case "", "0", "none", "n/a", "default string", "system serial number", "to be filled by o.e.m.", "not specified",
+		"not applicable", "0123456789":
+		return ""
+	}
+	return serial
+}
+
+// parseIoreg returns the attributes of the output of ioreg -rd1 -c IOPlatformExpertDevice, whose lines are like
+// "IOPlatformSerialNumber" = "C02XL0GJJGH5" or "model" = <"MacBookPro18,1">
+func parseIoreg(out string) Attributes {
+	var attrs Attributes
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), " = ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(strings.TrimSuffix(strings.TrimPrefix(parts[1], "<"), ">"), `"`)
+		switch strings.Trim(parts[0], `"`) {
+		case "IOPlatformSerialNumber":
+			attrs.SerialNumber = value
+		case "manufacturer":
+			attrs.Manufacturer = strings.TrimRight(value, "\x00")
+		case "model":
+			attrs.Model = strings.TrimRight(value, "\x00")
+		}
+	}
+	return attrs
+}
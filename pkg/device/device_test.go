@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+func TestEnroll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	attrs := Attributes{Hostname: "ws-042.corp.example.com", SerialNumber: "5CG1234XYZ"}
+	now := time.Now()
+	e := &Enroller{
+		Connector:  fake.NewConnector(false, nil),
+		Store:      &FileStore{Dir: dir},
+		KeyType:    certificate.KeyTypeECDSA,
+		Attributes: func() (Attributes, error) { return attrs, nil },
+		Now:        func() time.Time { return now },
+	}
+	res, err := e.Enroll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Kept || res.Certificate.Subject.CommonName != attrs.Hostname || res.Certificate.Subject.SerialNumber != attrs.SerialNumber ||
+		len(res.Certificate.DNSNames) != 1 || res.Certificate.DNSNames[0] != attrs.Hostname {
+		t.Fatalf("unexpected identity %s, kept %v", res.Certificate.Subject, res.Kept)
+	}
+	for _, name := range []string{CertFileName, KeyFileName, ChainFileName} {
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, _ := os.Stat(filepath.Join(dir, KeyFileName)); info.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected permissions of the private key %v", info.Mode().Perm())
+	}
+	serial := res.Certificate.SerialNumber
+
+	res, err = e.Enroll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Kept || res.Certificate.SerialNumber.Cmp(serial) != 0 {
+		t.Fatal("expected the identity to be kept")
+	}
+
+	for name, change := range map[string]func(){
+		"renamed": func() { attrs.Hostname = "ws-043.corp.example.com" },
+		"expiring": func() {
+			now = res.Certificate.NotAfter.Add(-24 * time.Hour)
+		},
+	} {
+		change()
+		res, err = e.Enroll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Kept || res.Certificate.Subject.CommonName != attrs.Hostname {
+			t.Fatalf("%s: expected a new identity, got %s, kept %v", name, res.Certificate.Subject, res.Kept)
+		}
+	}
+}
+
+func TestParseIoreg(t *testing.T) {
+	out := `+-o J314sAP  <class IOPlatformExpertDevice, id 0x100000209, registered, matched, active, busy 0 (2380 ms), retain 36>
+    {
+      "IOPlatformUUID" = "3A1C6C1E-6B0B-5B6C-9E3F-1B2C3D4E5F60"
+      "manufacturer" = <"Apple Inc.">
+      "model" = <"MacBookPro18,1">
+      "IOPlatformSerialNumber" = "C02XL0GJJGH5"
+    }`
+	attrs := parseIoreg(out)
+	if attrs.SerialNumber != "C02XL0GJJGH5" || attrs.Manufacturer != "Apple Inc." || attrs.Model != "MacBookPro18,1" {
+		t.Fatalf("unexpected attributes %+v", attrs)
+	}
+}
+
+func TestCleanSerial(t *testing.T) {
+	for serial, expected := range map[string]string{
+		" 5CG1234XYZ\n":          "5CG1234XYZ",
+		"To Be Filled By O.E.M.": "",
+		"System Serial Number":   "",
+		"0":                      "",
+	} {
+		if cleaned := cleanSerial(serial); cleaned != expected {
+			t.Errorf("%q: expected %q, got %q", serial, expected, cleaned)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/installer"
+)
+
+// The files of a FileStore
+const (
+	CertFileName  = "device.crt"
+	KeyFileName   = "device.key"
+	ChainFileName = "ca.crt"
+)
+
+// FileStore keeps the identity in PEM files of Dir: the certificate, its private key readable by its owner only and
+// the CA chain, which wpa_supplicant and NetworkManager reference as client_cert, private_key and ca_cert
+type FileStore struct {
+	Dir string
+}
+
+func (s *FileStore) Name() string {
+	return "files:" + s.Dir
+}
+
+func (s *FileStore) Current() (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, CertFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseCertificate(data)
+}
+
+func (s *FileStore) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	err := os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	fi := &installer.FileInstaller{
+		CertFile:  filepath.Join(s.Dir, CertFileName),
+		ChainFile: filepath.Join(s.Dir, ChainFileName),
+		KeyFile:   filepath.Join(s.Dir, KeyFileName),
+	}
+	return fi.Install(ctx, pcc)
+}
+
+// parseCertificate returns the first certificate of the PEM data, nil when there is none
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, nil
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// writePKCS12 writes the identity to a temporary PKCS#12 file the certificate stores of Windows and macOS import,
+// encrypted with a random password. The caller removes the file.
+func writePKCS12(pcc *certificate.PEMCollection) (file string, password string, err error) {
+	key, err := parsePrivateKey(pcc.PrivateKey)
+	if err != nil {
+		return "", "", err
+	}
+	cert, err := parseCertificate([]byte(pcc.Certificate))
+	if err != nil || cert == nil {
+		return "", "", fmt.Errorf("failed to parse the certificate: %v", err)
+	}
+	var chain []*x509.Certificate
+	for _, c := range pcc.Chain {
+		ca, err := parseCertificate([]byte(c))
+		if err != nil || ca == nil {
+			return "", "", fmt.Errorf("failed to parse the chain: %v", err)
+		}
+		chain = append(chain, ca)
+	}
+	random := make([]byte, 16)
+	if _, err = rand.Read(random); err != nil {
+		return "", "", err
+	}
+	password = hex.EncodeToString(random)
+	data, err := pkcs12.Encode(rand.Reader, key, cert, chain, password)
+	if err != nil {
+		return "", "", err
+	}
+	tmp, err := ioutil.TempFile("", "vcert-device-*.p12")
+	if err != nil {
+		return "", "", err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", err
+	}
+	return tmp.Name(), password, nil
+}
+
+func parsePrivateKey(keyPEM string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("no private key found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	return certificate.ParsePKCS8PrivateKey(block.Bytes)
+}
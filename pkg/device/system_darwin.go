@@ -0,0 +1,89 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+const (
+	systemKeychain = "/Library/Keychains/System.keychain"
+	// eapolclient authenticates the machine to the network, it is allowed to use the private key without a prompt
+	eapolclient = "/System/Library/SystemConfiguration/EAPOLController.bundle/Contents/Resources/eapolclient"
+)
+
+// DefaultDir returns where the identity is kept when no directory is given
+func DefaultDir() string {
+	return "/Library/Application Support/Venafi/vcert/device"
+}
+
+// SystemStore returns the store keeping the identity in the files of dir and in the System keychain, which the
+// 802.1X profiles of the machine use
+func SystemStore(dir string) Store {
+	return &keychainStore{FileStore{Dir: dir}}
+}
+
+type keychainStore struct {
+	FileStore
+}
+
+func (s *keychainStore) Name() string {
+	return "keychain:" + systemKeychain
+}
+
+func (s *keychainStore) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	previous, err := s.FileStore.Current()
+	if err != nil {
+		return err
+	}
+	file, password, err := writePKCS12(pcc)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+	out, err := exec.CommandContext(ctx, "security", "import", file, "-k", systemKeychain, "-f", "pkcs12",
+		"-P", password, "-T", eapolclient).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("security import failed: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	err = s.FileStore.Install(ctx, pcc)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		// the renewed identity replaces the previous one, which the profiles could pick otherwise
+		hash := fmt.Sprintf("%X", sha1.Sum(previous.Raw))
+		_ = exec.CommandContext(ctx, "security", "delete-identity", "-Z", hash, systemKeychain).Run()
+	}
+	return nil
+}
+
+// readHardware reads the platform expert device of the I/O registry
+func readHardware() Attributes {
+	out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+	if err != nil {
+		return Attributes{}
+	}
+	return parseIoreg(string(out))
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// DefaultDir returns where the identity is kept when no directory is given
+func DefaultDir() string {
+	return "/etc/vcert/device"
+}
+
+// SystemStore returns the files of dir, Linux has no certificate store the supplicants use
+func SystemStore(dir string) Store {
+	return &FileStore{Dir: dir}
+}
+
+// readHardware reads the DMI tables the kernel exposes. Only root can read the serial number.
+func readHardware() Attributes {
+	read := func(name string) string {
+		data, err := ioutil.ReadFile("/sys/class/dmi/id/" + name)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	return Attributes{
+		SerialNumber: read("product_serial"),
+		Manufacturer: read("sys_vendor"),
+		Model:        read("product_name"),
+	}
+}
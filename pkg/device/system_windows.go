@@ -0,0 +1,90 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+// DefaultDir returns where the identity is kept when no directory is given
+func DefaultDir() string {
+	return filepath.Join(os.Getenv("ProgramData"), "Venafi", "vcert", "device")
+}
+
+// SystemStore returns the store keeping the identity in the files of dir and in the personal store of the local
+// machine, which the Windows supplicant uses for computer authentication
+func SystemStore(dir string) Store {
+	return &machineStore{FileStore{Dir: dir}}
+}
+
+type machineStore struct {
+	FileStore
+}
+
+func (s *machineStore) Name() string {
+	return `cert:\LocalMachine\My`
+}
+
+func (s *machineStore) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	previous, err := s.FileStore.Current()
+	if err != nil {
+		return err
+	}
+	file, password, err := writePKCS12(pcc)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+	out, err := exec.CommandContext(ctx, "certutil", "-f", "-p", password, "-importPFX", "My", file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("certutil -importPFX failed: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	err = s.FileStore.Install(ctx, pcc)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		// the renewed identity replaces the previous one, which the supplicant could pick otherwise
+		_ = exec.CommandContext(ctx, "certutil", "-delstore", "My", fmt.Sprintf("%x", previous.SerialNumber)).Run()
+	}
+	return nil
+}
+
+// readHardware reads the BIOS and the computer system of WMI
+func readHardware() Attributes {
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command",
+		"(Get-CimInstance Win32_BIOS).SerialNumber; $cs = Get-CimInstance Win32_ComputerSystem; $cs.Manufacturer; $cs.Model").Output()
+	if err != nil {
+		return Attributes{}
+	}
+	lines := strings.Split(strings.ReplaceAll(string(out), "\r", ""), "\n")
+	for len(lines) < 3 {
+		lines = append(lines, "")
+	}
+	return Attributes{
+		SerialNumber: strings.TrimSpace(lines[0]),
+		Manufacturer: strings.TrimSpace(lines[1]),
+		Model:        strings.TrimSpace(lines[2]),
+	}
+}
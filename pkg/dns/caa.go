@@ -0,0 +1,378 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	typeCAA = 257
+	typeOPT = 41
+
+	caaFlagCritical = 0x80
+
+	defaultCAATimeout = 10 * time.Second
+	resolvConf        = "/etc/resolv.conf"
+)
+
+// knownCAATags are the properties of CAA records a CA understands, a critical property of another tag forbids the
+// issuance (RFC 8659 4.1)
+var knownCAATags = map[string]bool{"issue": true, "issuewild": true, "iodef": true, "contactemail": true,
+	"contactphone": true, "issuemail": true, "issuevmc": true}
+
+// ErrCAAForbidden is returned by CAAChecker for a name the CAA records of its domain don't let the CA issue for
+type ErrCAAForbidden struct {
+	Name string
+	// Domain is the domain holding the relevant CAA records, Name or one of its parents
+	Domain string
+	// Allowed are the issuers the records allow, none when they forbid any issuance
+	Allowed []string
+	// Critical is the unknown critical property forbidding the issuance, if any
+	Critical string
+}
+
+func (e ErrCAAForbidden) Error() string {
+	switch {
+	case e.Critical != "":
+		return fmt.Sprintf("the CAA records of %s forbid issuing for %s with the unknown critical property %s", e.Domain, e.Name, e.Critical)
+	case len(e.Allowed) == 0:
+		return fmt.Sprintf("the CAA records of %s forbid issuing for %s", e.Domain, e.Name)
+	}
+	return fmt.Sprintf("the CAA records of %s only let %s issue for %s", e.Domain, strings.Join(e.Allowed, ", "), e.Name)
+}
+
+func (e ErrCAAForbidden) Unwrap() error {
+	return verror.UserDataError
+}
+
+func (e ErrCAAForbidden) Code() string {
+	return verror.CodeCAAForbidden
+}
+
+// CAA is a property of a Certification Authority Authorization record
+type CAA struct {
+	Critical bool
+	Tag      string
+	Value    string
+}
+
+// CAAChecker checks the names of a request before it's submitted to a public CA: each name must resolve, and the CAA
+// records of its domain (RFC 8659) must let the CA issue for it. A request the CA would refuse is caught before it
+// goes through approvals.
+type CAAChecker struct {
+	// Issuers are the domains identifying the CA in the CAA records, e.g. digicert.com
+	Issuers []string
+	// Server is the DNS server the CAA records are queried from, "host:port" or a host queried on port 53. The
+	// first name server of /etc/resolv.conf is used when it's empty.
+	Server string
+	// Resolver resolves the names, net.DefaultResolver when it's nil
+	Resolver *net.Resolver
+	// Timeout bounds each query, 10 seconds when it's zero
+	Timeout time.Duration
+}
+
+// Check returns the problems of the names, an ErrUnexpectedAddress for a name that doesn't resolve and an
+// ErrCAAForbidden for a name the CA can't issue for. A wildcard name isn't resolved, the CAA records of its parent
+// domain are checked. IP addresses and single labels, which have no public records, are skipped. The error is
+// returned when the DNS can't be queried.
+func (c *CAAChecker) Check(ctx context.Context, names []string) ([]error, error) {
+	if len(c.Issuers) == 0 {
+		return nil, fmt.Errorf("%w: the issuer domains of the CA are required to check CAA records", verror.UserDataError)
+	}
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	var problems []error
+	for _, name := range names {
+		name = strings.ToLower(unFqdn(name))
+		if net.ParseIP(name) != nil || !strings.Contains(name, ".") {
+			continue
+		}
+		wildcard := strings.HasPrefix(name, "*.")
+		if !wildcard {
+			_, err := resolver.LookupIPAddr(ctx, name)
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				problems = append(problems, ErrUnexpectedAddress{Name: name})
+			} else if err != nil {
+				return problems, fmt.Errorf("%w: failed to resolve %s: %s", verror.ServerUnavailableError, name, err)
+			}
+		}
+		domain, records, err := c.relevantCAA(ctx, strings.TrimPrefix(name, "*."))
+		if err != nil {
+			return problems, err
+		}
+		if err := c.authorize(name, domain, records, wildcard); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return problems, nil
+}
+
+// relevantCAA returns the first CAA records found climbing from name to its top-level domain (RFC 8659 3)
+func (c *CAAChecker) relevantCAA(ctx context.Context, name string) (string, []CAA, error) {
+	for domain := name; strings.Contains(domain, "."); domain = domain[strings.Index(domain, ".")+1:] {
+		records, err := c.LookupCAA(ctx, domain)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(records) > 0 {
+			return domain, records, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// authorize applies the issue or, for a wildcard name, the issuewild properties of the records to the issuers
+func (c *CAAChecker) authorize(name, domain string, records []CAA, wildcard bool) error {
+	tag := "issue"
+	if wildcard {
+		for _, r := range records {
+			if r.Tag == "issuewild" {
+				tag = "issuewild"
+			}
+		}
+	}
+	var allowed []string
+	restricted := false
+	for _, r := range records {
+		if r.Critical && !knownCAATags[r.Tag] {
+			return ErrCAAForbidden{Name: name, Domain: domain, Critical: r.Tag}
+		}
+		if r.Tag != tag {
+			continue
+		}
+		restricted = true
+		issuer := strings.ToLower(strings.TrimSpace(strings.SplitN(r.Value, ";", 2)[0]))
+		if issuer == "" {
+			continue
+		}
+		for _, i := range c.Issuers {
+			if strings.EqualFold(issuer, i) {
+				return nil
+			}
+		}
+		allowed = append(allowed, issuer)
+	}
+	if !restricted {
+		return nil
+	}
+	return ErrCAAForbidden{Name: name, Domain: domain, Allowed: allowed}
+}
+
+// LookupCAA returns the CAA records of name itself, none when it has none or doesn't exist. The query is sent over
+// UDP, and again over TCP when the response is truncated.
+func (c *CAAChecker) LookupCAA(ctx context.Context, name string) ([]CAA, error) {
+	server, err := c.server()
+	if err != nil {
+		return nil, err
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCAATimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query, err := caaQuery(name)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := exchange(ctx, "udp", server, query)
+	if err == nil && len(resp) > 2 && resp[2]&0x02 != 0 {
+		resp, err = exchange(ctx, "tcp", server, query)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: CAA query of %s failed: %s", verror.ServerUnavailableError, name, err)
+	}
+	return parseCAAResponse(name, query, resp)
+}
+
+func (c *CAAChecker) server() (string, error) {
+	server := c.Server
+	if server == "" {
+		var err error
+		server, err = systemNameServer(resolvConf)
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return server, nil
+}
+
+// systemNameServer returns the first name server of the resolv.conf file at path
+func systemNameServer(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: no DNS server to query the CAA records: %s", verror.UserDataError, err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("%w: no DNS server to query the CAA records in %s", verror.UserDataError, path)
+}
+
+// caaQuery encodes a recursive query of the CAA records of name, advertising a UDP payload of 4096 bytes with EDNS0
+func caaQuery(name string) ([]byte, error) {
+	id := make([]byte, 2)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	msg := append(id, 0x01, 0x00) // recursion desired
+	msg = appendUint16(msg, 1)    // QDCOUNT
+	msg = appendUint16(msg, 0)    // ANCOUNT
+	msg = appendUint16(msg, 0)    // NSCOUNT
+	msg = appendUint16(msg, 1)    // ARCOUNT
+	msg = appendName(msg, name)
+	msg = appendUint16(msg, typeCAA)
+	msg = appendUint16(msg, classIN)
+	// OPT pseudo-record: root name, UDP payload size as the class, no extended flags nor options
+	msg = append(msg, 0)
+	msg = appendUint16(msg, typeOPT)
+	msg = appendUint16(msg, 4096)
+	msg = appendUint32(msg, 0)
+	return appendUint16(msg, 0), nil
+}
+
+// exchange sends query to server and returns its response, prefixed with their length over TCP
+func exchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if network == "udp" {
+		if _, err = conn.Write(query); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, 4096)
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, err
+		}
+		return resp[:n], nil
+	}
+	if _, err = conn.Write(append(appendUint16(nil, uint16(len(query))), query...)); err != nil {
+		return nil, err
+	}
+	length := make([]byte, 2)
+	if _, err = io.ReadFull(conn, length); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length))
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// parseCAAResponse returns the CAA records of the answer section of resp. The answer may hold the CNAME records
+// leading to them, which are skipped.
+func parseCAAResponse(name string, query, resp []byte) ([]CAA, error) {
+	invalid := fmt.Errorf("%w: invalid response to the CAA query of %s", verror.ServerBadDataResponce, name)
+	if len(resp) < 12 || binary.BigEndian.Uint16(resp) != binary.BigEndian.Uint16(query) {
+		return nil, invalid
+	}
+	switch rcode := int(resp[3] & 0x0f); rcode {
+	case 0:
+	case 3: // NXDOMAIN
+		return nil, nil
+	default:
+		rcodeName, ok := rcodes[rcode]
+		if !ok {
+			rcodeName = fmt.Sprintf("rcode %d", rcode)
+		}
+		return nil, fmt.Errorf("%w: CAA query of %s failed: %s", verror.ServerError, name, rcodeName)
+	}
+	qdcount, ancount := binary.BigEndian.Uint16(resp[4:]), binary.BigEndian.Uint16(resp[6:])
+	offset := 12
+	var ok bool
+	for i := 0; i < int(qdcount); i++ {
+		if offset, ok = skipName(resp, offset); !ok || offset+4 > len(resp) {
+			return nil, invalid
+		}
+		offset += 4
+	}
+	var records []CAA
+	for i := 0; i < int(ancount); i++ {
+		if offset, ok = skipName(resp, offset); !ok || offset+10 > len(resp) {
+			return nil, invalid
+		}
+		rrType := binary.BigEndian.Uint16(resp[offset:])
+		length := int(binary.BigEndian.Uint16(resp[offset+8:]))
+		offset += 10
+		if offset+length > len(resp) {
+			return nil, invalid
+		}
+		rdata := resp[offset : offset+length]
+		offset += length
+		if rrType != typeCAA {
+			continue
+		}
+		if len(rdata) < 2 || 2+int(rdata[1]) > len(rdata) {
+			return nil, invalid
+		}
+		tagEnd := 2 + int(rdata[1])
+		records = append(records, CAA{
+			Critical: rdata[0]&caaFlagCritical != 0,
+			Tag:      strings.ToLower(string(rdata[2:tagEnd])),
+			Value:    string(rdata[tagEnd:]),
+		})
+	}
+	return records, nil
+}
+
+// skipName returns the offset following the possibly compressed name at offset
+func skipName(msg []byte, offset int) (int, bool) {
+	for offset < len(msg) {
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			return offset + 1, true
+		case length&0xc0 == 0xc0:
+			return offset + 2, offset+2 <= len(msg)
+		}
+		offset += 1 + length
+	}
+	return 0, false
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// caaServer answers over UDP and TCP, on the same port, the A queries of the names it knows with 127.0.0.1 and
+// their CAA queries with their records. The names it doesn't know don't exist, the answers of truncated are only
+// sent over TCP.
+type caaServer struct {
+	records   map[string][]CAA
+	names     map[string]bool
+	truncated map[string]bool
+}
+
+func (s *caaServer) answer(query []byte, tcp bool) []byte {
+	var labels []string
+	off := 12
+	for off < len(query) && query[off] != 0 {
+		labels = append(labels, string(query[off+1:off+1+int(query[off])]))
+		off += int(query[off]) + 1
+	}
+	if off+5 > len(query) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, "."))
+	qtype := binary.BigEndian.Uint16(query[off+1:])
+	flags := uint16(0x8180)
+	var answers [][]byte
+	switch {
+	case !s.names[name]:
+		flags |= 3
+	case s.truncated[name] && !tcp:
+		flags |= 0x0200
+	case qtype == 1:
+		answers = append(answers, []byte{127, 0, 0, 1})
+	case qtype == typeCAA:
+		for _, r := range s.records[name] {
+			rdata := []byte{0, byte(len(r.Tag))}
+			if r.Critical {
+				rdata[0] = caaFlagCritical
+			}
+			answers = append(answers, append(append(rdata, r.Tag...), r.Value...))
+		}
+	}
+	msg := append([]byte{}, query[:2]...)
+	msg = appendUint16(msg, flags)
+	msg = appendUint16(msg, 1)
+	msg = appendUint16(msg, uint16(len(answers)))
+	msg = appendUint16(msg, 0)
+	msg = appendUint16(msg, 0)
+	msg = append(msg, query[12:off+5]...)
+	for _, rdata := range answers {
+		msg = append(msg, 0xc0, 12)
+		msg = appendUint16(msg, qtype)
+		msg = appendUint16(msg, classIN)
+		msg = appendUint32(msg, 60)
+		msg = appendUint16(msg, uint16(len(rdata)))
+		msg = append(msg, rdata...)
+	}
+	return msg
+}
+
+// listen serves the answers on a port of the loopback and returns its address
+func (s *caaServer) listen(t *testing.T) (string, func()) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := net.ListenPacket("udp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		b := make([]byte, 4096)
+		for {
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(s.answer(b[:n], false), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			length := make([]byte, 2)
+			if _, err = io.ReadFull(conn, length); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(length))
+				if _, err = io.ReadFull(conn, query); err == nil {
+					resp := s.answer(query, true)
+					_, _ = conn.Write(append(appendUint16(nil, uint16(len(resp))), resp...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), func() { l.Close(); pc.Close() }
+}
+
+func TestCAAChecker(t *testing.T) {
+	s := &caaServer{
+		records: map[string][]CAA{
+			"example.com":   {{Tag: "issue", Value: "DigiCert.com; account=42"}, {Tag: "issuewild", Value: ";"}},
+			"other.test":    {{Tag: "issue", Value: "letsencrypt.org"}, {Tag: "issue", Value: ";"}},
+			"critical.test": {{Critical: true, Tag: "tbs", Value: "unknown"}, {Tag: "issue", Value: "digicert.com"}},
+			"iodef.test":    {{Tag: "iodef", Value: "mailto:security@iodef.test"}},
+			"big.test":      {{Tag: "issue", Value: "digicert.com"}},
+		},
+		names:     map[string]bool{"example.com": true, "www.example.com": true, "other.test": true, "critical.test": true, "iodef.test": true, "big.test": true},
+		truncated: map[string]bool{"big.test": true},
+	}
+	server, stop := s.listen(t)
+	defer stop()
+
+	d := &Dialer{Server: server}
+	c := &CAAChecker{Issuers: []string{"digicert.com"}, Server: server, Resolver: d.Resolver()}
+	problems, err := c.Check(context.Background(), []string{"www.example.com", "missing.example.com", "*.example.com",
+		"other.test", "critical.test", "iodef.test", "big.test", "10.0.0.1", "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []error{
+		ErrUnexpectedAddress{Name: "missing.example.com"},
+		ErrCAAForbidden{Name: "*.example.com", Domain: "example.com"},
+		ErrCAAForbidden{Name: "other.test", Domain: "other.test", Allowed: []string{"letsencrypt.org"}},
+		ErrCAAForbidden{Name: "critical.test", Domain: "critical.test", Critical: "tbs"},
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("expected %v, got %v", expected, problems)
+	}
+	for _, p := range problems[1:] {
+		if !errors.Is(p, verror.UserDataError) || verror.CodeOf(p) != verror.CodeCAAForbidden {
+			t.Errorf("%s: unexpected error chain, code %s", p, verror.CodeOf(p))
+		}
+	}
+
+	if _, err = (&CAAChecker{Server: server}).Check(context.Background(), []string{"example.com"}); !errors.Is(err, verror.UserDataError) {
+		t.Errorf("a checker without issuers should fail, got %v", err)
+	}
+	unreachable := &CAAChecker{Issuers: []string{"digicert.com"}, Server: "127.0.0.1:1", Resolver: d.Resolver()}
+	if _, err = unreachable.LookupCAA(context.Background(), "example.com"); !errors.Is(err, verror.ServerUnavailableError) {
+		t.Errorf("an unreachable server should fail, got %v", err)
+	}
+}
+
+func TestSystemNameServer(t *testing.T) {
+	f, err := ioutil.TempFile("", "resolv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# generated\nsearch example.com\nnameserver 192.0.2.53\nnameserver 192.0.2.54\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := systemNameServer(f.Name())
+	if err != nil || server != "192.0.2.53" {
+		t.Fatalf("expected the first name server, got %q %v", server, err)
+	}
+	if _, err = systemNameServer(f.Name() + ".missing"); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("a missing resolv.conf should fail, got %v", err)
+	}
+}
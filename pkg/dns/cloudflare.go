@@ -0,0 +1,171 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const cloudflareBaseURL = "https://api.cloudflare.com/client/v4"
+
+// Cloudflare manages records with the Cloudflare API v4
+type Cloudflare struct {
+	// APIToken needs the Zone:Read and DNS:Edit permissions
+	APIToken string
+	// ZoneID is looked up from the record name when it's empty
+	ZoneID string
+	// BaseURL defaults to the public Cloudflare API
+	BaseURL string
+	TTL     int
+	Client  *http.Client
+}
+
+type cloudflareResponse struct {
+	Success bool              `json:"success"`
+	Errors  []cloudflareError `json:"errors"`
+	Result  json.RawMessage   `json:"result"`
+}
+
+type cloudflareError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl,omitempty"`
+}
+
+func (c *Cloudflare) Present(ctx context.Context, fqdn, value string) error {
+	zoneID, err := c.zoneID(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	ttl := c.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	record := cloudflareRecord{Type: "TXT", Name: unFqdn(fqdn), Content: value, TTL: ttl}
+	return c.request(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", record, nil)
+}
+
+func (c *Cloudflare) CleanUp(ctx context.Context, fqdn, value string) error {
+	zoneID, err := c.zoneID(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	query := url.Values{"type": {"TXT"}, "name": {unFqdn(fqdn)}, "content": {value}}
+	var records []cloudflareRecord
+	err = c.request(ctx, http.MethodGet, "/zones/"+zoneID+"/dns_records?"+query.Encode(), nil, &records)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		err = c.request(ctx, http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+r.ID, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zoneID finds the zone of fqdn by trying its parent domains, from the longest to the shortest
+func (c *Cloudflare) zoneID(ctx context.Context, fqdn string) (string, error) {
+	if c.ZoneID != "" {
+		return c.ZoneID, nil
+	}
+	labels := strings.Split(unFqdn(fqdn), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		name := strings.Join(labels[i:], ".")
+		err := c.request(ctx, http.MethodGet, "/zones?"+url.Values{"name": {name}}.Encode(), nil, &zones)
+		if err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no Cloudflare zone found for %s", verror.UserDataError, fqdn)
+}
+
+func (c *Cloudflare) request(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = cloudflareBaseURL
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient(c.Client).Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer resp.Body.Close()
+
+	var r cloudflareResponse
+	err = json.NewDecoder(resp.Body).Decode(&r)
+	if err != nil {
+		return fmt.Errorf("%w: unexpected Cloudflare response, status %s: %s", verror.ServerError, resp.Status, err)
+	}
+	if !r.Success {
+		var msgs []string
+		for _, e := range r.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d: %s", e.Code, e.Message))
+		}
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%w: Cloudflare: %s", verror.AuthError, strings.Join(msgs, "; "))
+		}
+		return fmt.Errorf("%w: Cloudflare: %s", verror.ServerError, strings.Join(msgs, "; "))
+	}
+	if result != nil {
+		return json.Unmarshal(r.Result, result)
+	}
+	return nil
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
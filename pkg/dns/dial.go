@@ -0,0 +1,190 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Dialer dials the connections of the HTTP clients of the connectors with a name resolution of its own, e.g. for a
+// platform whose hostname resolves differently inside the management network than for the system resolver
+type Dialer struct {
+	// Hosts maps host names to the addresses they're dialed at without any resolution, like /etc/hosts does
+	Hosts map[string]string
+	// Server is the DNS server the names are resolved with instead of the ones of the system, "host:port" or a host
+	// queried on port 53
+	Server string
+	// DoH is the URL of a DNS over HTTPS server (RFC 8484) the names are resolved with, e.g.
+	// https://1.1.1.1/dns-query. It takes precedence over Server. Its own host is resolved by the system.
+	DoH string
+	// DoHClient sends the DNS over HTTPS queries, http.DefaultClient is used when it's nil
+	DoHClient *http.Client
+	// IPVersion restricts the addresses dialed to IPv4 when it's 4, and to IPv6 when it's 6
+	IPVersion int
+	// FallbackDelay is how long an IPv6 connection is attempted before an IPv4 one is raced against it (happy
+	// eyeballs, RFC 6555), 300ms when it's zero. When it's negative, the addresses are tried one after the other.
+	FallbackDelay time.Duration
+	// Timeout bounds each connection attempt, 30 seconds when it's zero
+	Timeout time.Duration
+	// KeepAlive is the interval of the TCP keep-alive probes, 30 seconds when it's zero
+	KeepAlive time.Duration
+}
+
+// DialContext has the signature of http.Transport.DialContext
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := d.Hosts[strings.ToLower(strings.TrimSuffix(host, "."))]; ok {
+		address = net.JoinHostPort(a, port)
+	}
+	if network == "tcp" {
+		switch d.IPVersion {
+		case 4:
+			network = "tcp4"
+		case 6:
+			network = "tcp6"
+		}
+	}
+	nd := &net.Dialer{
+		Timeout:       d.Timeout,
+		KeepAlive:     d.KeepAlive,
+		FallbackDelay: d.FallbackDelay,
+		Resolver:      d.Resolver(),
+	}
+	if nd.Timeout == 0 {
+		nd.Timeout = 30 * time.Second
+	}
+	if nd.KeepAlive == 0 {
+		nd.KeepAlive = 30 * time.Second
+	}
+	return nd.DialContext(ctx, network, address)
+}
+
+// Resolver returns the resolver of the names dialed, net.DefaultResolver when neither Server nor DoH is set
+func (d *Dialer) Resolver() *net.Resolver {
+	if d.Server == "" && d.DoH == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{PreferGo: true, Dial: d.dialServer}
+}
+
+// dialServer replaces the name servers of the system with Server or DoH
+func (d *Dialer) dialServer(ctx context.Context, network, _ string) (net.Conn, error) {
+	if d.DoH != "" {
+		client := d.DoHClient
+		if client == nil {
+			client = http.DefaultClient
+		}
+		return &dohConn{ctx: ctx, url: d.DoH, client: client}, nil
+	}
+	server := d.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	var nd net.Dialer
+	return nd.DialContext(ctx, network, server)
+}
+
+// dohConn is a stream connection to a name server for the resolver: each query it's written, prefixed by its
+// length, is sent to the DNS over HTTPS server when its response is read
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	client   *http.Client
+	deadline time.Time
+	query    bytes.Buffer
+	response *bytes.Reader
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	if c.response != nil && c.response.Len() == 0 {
+		// the previous exchange was read entirely, this is a new query
+		c.response = nil
+		c.query.Reset()
+	}
+	return c.query.Write(b)
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.response == nil {
+		if err := c.exchange(); err != nil {
+			return 0, err
+		}
+	}
+	return c.response.Read(b)
+}
+
+func (c *dohConn) exchange() error {
+	q := c.query.Bytes()
+	if len(q) < 2 || len(q) < 2+int(binary.BigEndian.Uint16(q)) {
+		return fmt.Errorf("DNS over HTTPS: incomplete query")
+	}
+	msg := q[2 : 2+int(binary.BigEndian.Uint16(q))]
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DNS over HTTPS: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 65535+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > 65535 {
+		return fmt.Errorf("DNS over HTTPS: response too large")
+	}
+	c.response = bytes.NewReader(append(appendUint16(nil, uint16(len(body))), body...))
+	return nil
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.url) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.url) }
+func (c *dohConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { c.deadline = t; return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// answerA answers the A queries of query with ip, and the other ones with no record
+func answerA(query []byte, ip net.IP) []byte {
+	off := 12
+	for off < len(query) && query[off] != 0 {
+		off += int(query[off]) + 1
+	}
+	if off+5 > len(query) {
+		return nil
+	}
+	question := query[12 : off+5]
+	qtype := binary.BigEndian.Uint16(query[off+1:])
+	msg := append([]byte{}, query[:2]...)
+	msg = appendUint16(msg, 0x8180)
+	msg = appendUint16(msg, 1)
+	if qtype == 1 {
+		msg = appendUint16(msg, 1)
+	} else {
+		msg = appendUint16(msg, 0)
+	}
+	msg = appendUint16(msg, 0)
+	msg = appendUint16(msg, 0)
+	msg = append(msg, question...)
+	if qtype == 1 {
+		msg = append(msg, 0xc0, 12)
+		msg = appendUint16(msg, 1)
+		msg = appendUint16(msg, 1)
+		msg = appendUint32(msg, 60)
+		msg = appendUint16(msg, 4)
+		msg = append(msg, ip.To4()...)
+	}
+	return msg
+}
+
+// listen returns a listener accepting the connections of the test
+func listen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l
+}
+
+func TestDialerHosts(t *testing.T) {
+	l := listen(t)
+	defer l.Close()
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	d := &Dialer{Hosts: map[string]string{"tpp.venafi.example": "127.0.0.1"}, IPVersion: 4}
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("TPP.venafi.example", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestDialerDoH(t *testing.T) {
+	l := listen(t)
+	defer l.Close()
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	var queries int32
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		query, _ := ioutil.ReadAll(r.Body)
+		atomic.AddInt32(&queries, 1)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answerA(query, net.IPv4(127, 0, 0, 1)))
+	}))
+	defer doh.Close()
+
+	d := &Dialer{DoH: doh.URL, IPVersion: 4}
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("tpp.management.example", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if atomic.LoadInt32(&queries) == 0 {
+		t.Fatal("the name wasn't resolved with the DNS over HTTPS server")
+	}
+}
+
+func TestDialerServer(t *testing.T) {
+	l := listen(t)
+	defer l.Close()
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		b := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(answerA(b[:n], net.IPv4(127, 0, 0, 1)), addr)
+		}
+	}()
+
+	d := &Dialer{Server: pc.LocalAddr().String(), IPVersion: 4}
+	addrs, err := d.Resolver().LookupHost(context.Background(), "tpp.management.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Fatalf("unexpected addresses %v", addrs)
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("tpp.management.example", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
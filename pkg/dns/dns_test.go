@@ -0,0 +1,268 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestChallengeRecord(t *testing.T) {
+	fqdn, value := ChallengeRecord("*.example.com", "token.thumbprint")
+	if fqdn != "_acme-challenge.example.com." {
+		t.Fatalf("unexpected name %s", fqdn)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) != 32 {
+		t.Fatalf("value isn't a base64url SHA-256 digest: %s", value)
+	}
+}
+
+func TestCloudflare(t *testing.T) {
+	var created, deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/zones":
+			if r.URL.Query().Get("name") == "example.com" {
+				_, _ = w.Write([]byte(`{"success":true,"result":[{"id":"zone1"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"success":true,"result":[]}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/zones/zone1/dns_records":
+			var rec cloudflareRecord
+			_ = json.NewDecoder(r.Body).Decode(&rec)
+			created = append(created, rec.Name+"="+rec.Content)
+			_, _ = w.Write([]byte(`{"success":true,"result":{"id":"rec1"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/zones/zone1/dns_records":
+			_, _ = w.Write([]byte(`{"success":true,"result":[{"id":"rec1"}]}`))
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+			_, _ = w.Write([]byte(`{"success":true,"result":{"id":"rec1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"success":false,"errors":[{"code":7003,"message":"not found"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	cf := &Cloudflare{APIToken: "token", BaseURL: server.URL}
+	ctx := context.Background()
+	err := cf.Present(ctx, "_acme-challenge.www.example.com.", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cf.CleanUp(ctx, "_acme-challenge.www.example.com.", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0] != "_acme-challenge.www.example.com=value" {
+		t.Fatalf("unexpected records created: %v", created)
+	}
+	if len(deleted) != 1 || deleted[0] != "/zones/zone1/dns_records/rec1" {
+		t.Fatalf("unexpected records deleted: %v", deleted)
+	}
+
+	cf.APIToken = "bad"
+	err = cf.Present(ctx, "_acme-challenge.www.example.com.", "value")
+	if !errors.Is(err, verror.AuthError) {
+		t.Fatalf("expected auth error, got %v", err)
+	}
+}
+
+func TestRoute53(t *testing.T) {
+	var body, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body, auth = string(data), r.Header.Get("Authorization")
+		if r.URL.Path != "/2013-04-01/hostedzone/Z123/rrset/" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<ErrorResponse><Error><Code>NoSuchHostedZone</Code></Error></ErrorResponse>`))
+			return
+		}
+		_, _ = w.Write([]byte(`<ChangeResourceRecordSetsResponse/>`))
+	}))
+	defer server.Close()
+
+	r53 := &Route53{AccessKeyID: "AKID", SecretAccessKey: "secret", HostedZoneID: "/hostedzone/Z123", Endpoint: server.URL}
+	err := r53.Present(context.Background(), "_acme-challenge.example.com.", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "<Action>UPSERT</Action>") || !strings.Contains(body, "<Value>&#34;value&#34;</Value>") {
+		t.Fatalf("unexpected change batch: %s", body)
+	}
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-east-1/route53/aws4_request") {
+		t.Fatalf("unexpected authorization: %s", auth)
+	}
+
+	r53.HostedZoneID = "nope"
+	err = r53.CleanUp(context.Background(), "_acme-challenge.example.com.", "value")
+	if err == nil || !strings.Contains(err.Error(), "NoSuchHostedZone") {
+		t.Fatalf("expected hosted zone error, got %v", err)
+	}
+}
+
+func TestRFC2136(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	requests := make(chan []byte, 2)
+	rcodes := make(chan byte, 2)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte{}, buf[:n]...)
+			requests <- req
+			resp := append([]byte{}, req[:12]...)
+			resp[2] |= 0x80
+			resp[3] = <-rcodes
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+
+	p := &RFC2136{Server: conn.LocalAddr().String(), Zone: "example.com", TSIGKeyName: "update-key",
+		TSIGSecret: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))}
+	rcodes <- 0
+	err = p.Present(context.Background(), "_acme-challenge.example.com.", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if opcode := (req[2] >> 3) & 0x0f; opcode != opcodeUpdate {
+		t.Fatalf("unexpected opcode %d", opcode)
+	}
+	if req[11] != 1 {
+		t.Fatal("update should carry a TSIG record")
+	}
+	for _, s := range []string{"\x05value", "\x0aupdate-key", "\x0bhmac-sha256"} {
+		if !strings.Contains(string(req), s) {
+			t.Fatalf("update doesn't contain %q", s)
+		}
+	}
+
+	rcodes <- 5
+	err = p.CleanUp(context.Background(), "_acme-challenge.example.com.", "value")
+	if !errors.Is(err, verror.AuthError) {
+		t.Fatalf("expected refused update, got %v", err)
+	}
+}
+
+func TestPreValidate(t *testing.T) {
+	ctx := context.Background()
+	err := PreValidate(ctx, nil, []string{"localhost"}, []string{"127.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PreValidate(ctx, nil, []string{"localhost"}, []string{"192.0.2.1"})
+	var unexpected ErrUnexpectedAddress
+	if !errors.As(err, &unexpected) || !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected unexpected address error, got %v", err)
+	}
+	err = PreValidate(ctx, nil, []string{"localhost"}, []string{"not-an-ip"})
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected invalid address error, got %v", err)
+	}
+}
+
+func TestZoneTransfer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	rcode := make(chan byte, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			_, _ = io.ReadFull(conn, length[:])
+			query := make([]byte, binary.BigEndian.Uint16(length[:]))
+			_, _ = io.ReadFull(conn, query)
+			rr := func(msg []byte, name string, rrtype uint16, rdata []byte) []byte {
+				msg = appendName(msg, name)
+				msg = appendUint16(msg, rrtype)
+				msg = appendUint16(msg, classIN)
+				msg = appendUint32(msg, 300)
+				msg = appendUint16(msg, uint16(len(rdata)))
+				return append(msg, rdata...)
+			}
+			header := func(answers uint16) []byte {
+				h := append([]byte{}, query[:2]...)
+				h = append(h, 0x84, <-rcode, 0, 0)
+				return append(appendUint16(h, answers), 0, 0, 0, 0)
+			}
+			first := header(4)
+			first = rr(first, "example.com", typeSOA, []byte{0})
+			first = rr(first, "WWW.example.com", typeA, []byte{10, 0, 0, 1})
+			// a compressed owner name pointing to example.com, right after the header
+			first = append(first, 3, 'a', 'p', 'i', 0xc0, 12)
+			first = append(appendUint16(appendUint16(first, typeCNAME), classIN), 0, 0, 1, 44, 0, 2, 0xc0, 12)
+			first = rr(first, "example.com", typeTXT, txtData("v=spf1 -all"))
+			rcode <- 0
+			second := header(2)
+			second = rr(second, "v6.example.com", typeAAAA, make([]byte, 16))
+			second = rr(second, "example.com", typeSOA, []byte{0})
+			for _, msg := range [][]byte{first, second} {
+				_, _ = conn.Write(append(appendUint16(nil, uint16(len(msg))), msg...))
+			}
+			conn.Close()
+		}
+	}()
+
+	z := &ZoneTransfer{Server: l.Addr().String(), Zone: "example.com."}
+	rcode <- 0
+	names, err := z.Names(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"api.example.com", "v6.example.com", "www.example.com"}
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+
+	rcode <- 5
+	_, err = z.Names(context.Background())
+	if !errors.Is(err, verror.AuthError) {
+		t.Fatalf("expected refused transfer, got %v", err)
+	}
+}
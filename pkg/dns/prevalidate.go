@@ -0,0 +1,105 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// ErrUnexpectedAddress is returned by PreValidate for a name that doesn't resolve to one of the expected addresses
+type ErrUnexpectedAddress struct {
+	Name      string
+	Addresses []string
+}
+
+func (e ErrUnexpectedAddress) Error() string {
+	if len(e.Addresses) == 0 {
+		return fmt.Sprintf("%s doesn't resolve", e.Name)
+	}
+	return fmt.Sprintf("%s resolves to %s which is not an expected address", e.Name, strings.Join(e.Addresses, ", "))
+}
+
+func (e ErrUnexpectedAddress) Unwrap() error {
+	return verror.UserDataError
+}
+
+func (e ErrUnexpectedAddress) Code() string {
+	return verror.CodeUnexpectedAddress
+}
+
+// PreValidate checks that every name resolves to at least one of expected, which holds IP addresses or CIDR
+// ranges. It's a sanity check to run before requesting a certificate, so a typo in a SAN or a name pointing to
+// another host is caught before issuance. For wildcard names the parent domain is checked.
+func PreValidate(ctx context.Context, resolver *net.Resolver, names []string, expected []string) error {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	var networks []*net.IPNet
+	for _, e := range expected {
+		n, err := parseNetwork(e)
+		if err != nil {
+			return err
+		}
+		networks = append(networks, n)
+	}
+	for _, name := range names {
+		host := strings.TrimPrefix(name, "*.")
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var resolved []string
+		matched := false
+		for _, a := range addrs {
+			resolved = append(resolved, a.IP.String())
+			for _, n := range networks {
+				if n.Contains(a.IP) {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return ErrUnexpectedAddress{Name: name, Addresses: resolved}
+		}
+	}
+	return nil
+}
+
+func parseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid address range %q", verror.UserDataError, s)
+		}
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: invalid address %q", verror.UserDataError, s)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
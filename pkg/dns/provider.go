@@ -0,0 +1,123 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dns manages DNS records to prove control of domains (ACME DNS-01 challenges), checks where requested
+// names resolve before a certificate is issued for them, enumerates the names of a zone to request them, and
+// resolves the hostnames the connectors dial with a DNS server of their own.
+package dns
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	challengeLabel = "_acme-challenge."
+
+	defaultTTL                = 60
+	defaultPropagationTimeout = 2 * time.Minute
+	defaultPollInterval       = 5 * time.Second
+)
+
+// Provider creates and removes TXT records in a DNS zone
+type Provider interface {
+	// Present creates a TXT record named fqdn holding value
+	Present(ctx context.Context, fqdn, value string) error
+	// CleanUp removes the TXT record created by Present
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// ChallengeRecord returns the name and value of the TXT record answering a DNS-01 challenge for domain
+func ChallengeRecord(domain, keyAuthorization string) (fqdn, value string) {
+	domain = strings.TrimPrefix(domain, "*.")
+	sum := sha256.Sum256([]byte(keyAuthorization))
+	return challengeLabel + toFqdn(domain), base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Solver fulfils DNS-01 challenges with a Provider
+type Solver struct {
+	Provider Provider
+	// PropagationTimeout is how long Present waits for the record to be visible, it defaults to 2 minutes
+	PropagationTimeout time.Duration
+	// PollInterval is the delay between two lookups of the record, it defaults to 5 seconds
+	PollInterval time.Duration
+	// Resolver checks the propagation, net.DefaultResolver is used when it's nil
+	Resolver *net.Resolver
+}
+
+// Present creates the challenge record for domain and waits until it can be resolved
+func (s *Solver) Present(ctx context.Context, domain, keyAuthorization string) error {
+	fqdn, value := ChallengeRecord(domain, keyAuthorization)
+	err := s.Provider.Present(ctx, fqdn, value)
+	if err != nil {
+		return fmt.Errorf("failed to create challenge record for %s: %w", domain, err)
+	}
+	return s.waitForRecord(ctx, fqdn, value)
+}
+
+// CleanUp removes the challenge record for domain
+func (s *Solver) CleanUp(ctx context.Context, domain, keyAuthorization string) error {
+	fqdn, value := ChallengeRecord(domain, keyAuthorization)
+	return s.Provider.CleanUp(ctx, fqdn, value)
+}
+
+func (s *Solver) waitForRecord(ctx context.Context, fqdn, value string) error {
+	timeout := s.PropagationTimeout
+	if timeout <= 0 {
+		timeout = defaultPropagationTimeout
+	}
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	resolver := s.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		records, _ := resolver.LookupTXT(ctx, fqdn)
+		for _, r := range records {
+			if r == value {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: challenge record %s didn't propagate within %s", verror.ServerError, fqdn, timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+func toFqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func unFqdn(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
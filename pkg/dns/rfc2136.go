@@ -0,0 +1,234 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	opcodeUpdate = 5
+
+	typeSOA  = 6
+	typeTXT  = 16
+	typeTSIG = 250
+
+	classIN   = 1
+	classNONE = 254
+	classANY  = 255
+
+	tsigAlgorithmSHA256 = "hmac-sha256."
+	tsigFudge           = 300
+
+	defaultRFC2136Timeout = 10 * time.Second
+)
+
+var rcodes = map[int]string{1: "FORMERR", 2: "SERVFAIL", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED", 6: "YXDOMAIN",
+	7: "YXRRSET", 8: "NXRRSET", 9: "NOTAUTH", 10: "NOTZONE"}
+
+// RFC2136 manages records with DNS dynamic updates, as supported by BIND, Knot, PowerDNS and others. Updates are
+// authenticated with TSIG (HMAC-SHA256) when a key is set.
+type RFC2136 struct {
+	// Server is the host:port of the primary name server
+	Server string
+	// Zone is the zone the records belong to
+	Zone        string
+	TSIGKeyName string
+	// TSIGSecret is the base64 encoded TSIG key
+	TSIGSecret string
+	TTL        int
+	Timeout    time.Duration
+}
+
+func (r *RFC2136) Present(ctx context.Context, fqdn, value string) error {
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	return r.update(ctx, fqdn, value, classIN, uint32(ttl))
+}
+
+func (r *RFC2136) CleanUp(ctx context.Context, fqdn, value string) error {
+	// class NONE deletes the RR matching the data from the RRset (RFC 2136 2.5.4)
+	return r.update(ctx, fqdn, value, classNONE, 0)
+}
+
+func (r *RFC2136) update(ctx context.Context, fqdn, value string, class uint16, ttl uint32) error {
+	if r.Zone == "" {
+		return fmt.Errorf("%w: RFC 2136 zone is not set", verror.UserDataError)
+	}
+	msg, err := r.buildUpdate(fqdn, value, class, ttl, time.Now())
+	if err != nil {
+		return err
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultRFC2136Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", r.Server)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	_, err = conn.Write(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	resp := make([]byte, 4096)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	if n < 12 || binary.BigEndian.Uint16(resp) != binary.BigEndian.Uint16(msg) {
+		return fmt.Errorf("%w: invalid response to DNS update", verror.ServerError)
+	}
+	if rcode := int(resp[3] & 0x0f); rcode != 0 {
+		name, ok := rcodes[rcode]
+		if !ok {
+			name = fmt.Sprintf("rcode %d", rcode)
+		}
+		if rcode == 5 || rcode == 9 {
+			return fmt.Errorf("%w: DNS update of %s refused: %s", verror.AuthError, fqdn, name)
+		}
+		return fmt.Errorf("%w: DNS update of %s failed: %s", verror.ServerError, fqdn, name)
+	}
+	return nil
+}
+
+// buildUpdate encodes an UPDATE message with a single TXT change, signed when a TSIG key is set
+func (r *RFC2136) buildUpdate(fqdn, value string, class uint16, ttl uint32, now time.Time) ([]byte, error) {
+	id := make([]byte, 2)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	// header: ID, flags, ZOCOUNT, PRCOUNT, UPCOUNT, ADCOUNT
+	msg := append(id, opcodeUpdate<<3, 0, 0, 1, 0, 0, 0, 1, 0, 0)
+	msg = appendName(msg, r.Zone)
+	msg = appendUint16(msg, typeSOA)
+	msg = appendUint16(msg, classIN)
+
+	msg = appendName(msg, fqdn)
+	msg = appendUint16(msg, typeTXT)
+	msg = appendUint16(msg, class)
+	msg = appendUint32(msg, ttl)
+	rdata := txtData(value)
+	msg = appendUint16(msg, uint16(len(rdata)))
+	msg = append(msg, rdata...)
+
+	if r.TSIGKeyName == "" {
+		return msg, nil
+	}
+	return signTSIG(msg, r.TSIGKeyName, r.TSIGSecret, now)
+}
+
+// signTSIG appends a TSIG record (RFC 8945) to msg
+func signTSIG(msg []byte, keyName, encodedSecret string, now time.Time) ([]byte, error) {
+	secret, err := base64.StdEncoding.DecodeString(encodedSecret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid TSIG secret: %s", verror.UserDataError, err)
+	}
+	keyName = strings.ToLower(toFqdn(keyName))
+	signed := uint64(now.Unix())
+
+	// TSIG variables: key name, class, TTL, algorithm, time signed, fudge, error, other len
+	vars := appendName(nil, keyName)
+	vars = appendUint16(vars, classANY)
+	vars = appendUint32(vars, 0)
+	vars = appendName(vars, tsigAlgorithmSHA256)
+	vars = appendUint48(vars, signed)
+	vars = appendUint16(vars, tsigFudge)
+	vars = appendUint16(vars, 0)
+	vars = appendUint16(vars, 0)
+
+	h := hmac.New(sha256.New, secret)
+	h.Write(msg)
+	h.Write(vars)
+	mac := h.Sum(nil)
+
+	rdata := appendName(nil, tsigAlgorithmSHA256)
+	rdata = appendUint48(rdata, signed)
+	rdata = appendUint16(rdata, tsigFudge)
+	rdata = appendUint16(rdata, uint16(len(mac)))
+	rdata = append(rdata, mac...)
+	rdata = append(rdata, msg[0], msg[1])
+	rdata = appendUint16(rdata, 0)
+	rdata = appendUint16(rdata, 0)
+
+	out := append([]byte{}, msg...)
+	out = appendName(out, keyName)
+	out = appendUint16(out, typeTSIG)
+	out = appendUint16(out, classANY)
+	out = appendUint32(out, 0)
+	out = appendUint16(out, uint16(len(rdata)))
+	out = append(out, rdata...)
+	binary.BigEndian.PutUint16(out[10:], 1)
+	return out, nil
+}
+
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(unFqdn(name), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// txtData splits value in character strings of up to 255 bytes
+func txtData(value string) []byte {
+	var b []byte
+	for len(value) > 255 {
+		b = append(b, 255)
+		b = append(b, value[:255]...)
+		value = value[255:]
+	}
+	b = append(b, byte(len(value)))
+	return append(b, value...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint48(b []byte, v uint64) []byte {
+	return append(b, byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
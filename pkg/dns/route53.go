@@ -0,0 +1,181 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	route53Endpoint = "https://route53.amazonaws.com"
+	route53Region   = "us-east-1"
+	route53Service  = "route53"
+)
+
+// Route53 manages records of an AWS Route 53 hosted zone. Requests are signed with AWS Signature Version 4.
+// Present replaces the TXT values of the record, so challenges for the same name must be solved one at a time.
+type Route53 struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set when temporary credentials are used
+	SessionToken string
+	HostedZoneID string
+	// Endpoint defaults to the public Route 53 API
+	Endpoint string
+	TTL      int
+	Client   *http.Client
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"ChangeResourceRecordSetsRequest"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type route53Change struct {
+	Action string `xml:"Action"`
+	Name   string `xml:"ResourceRecordSet>Name"`
+	Type   string `xml:"ResourceRecordSet>Type"`
+	TTL    int    `xml:"ResourceRecordSet>TTL"`
+	Value  string `xml:"ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+}
+
+type route53Error struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+func (r *Route53) Present(ctx context.Context, fqdn, value string) error {
+	return r.change(ctx, "UPSERT", fqdn, value)
+}
+
+func (r *Route53) CleanUp(ctx context.Context, fqdn, value string) error {
+	return r.change(ctx, "DELETE", fqdn, value)
+}
+
+func (r *Route53) change(ctx context.Context, action, fqdn, value string) error {
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	body, err := xml.Marshal(route53ChangeRequest{
+		Xmlns:   "https://route53.amazonaws.com/doc/2013-04-01/",
+		Changes: []route53Change{{Action: action, Name: toFqdn(fqdn), Type: "TXT", TTL: ttl, Value: `"` + value + `"`}},
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = route53Endpoint
+	}
+	zoneID := strings.TrimPrefix(r.HostedZoneID, "/hostedzone/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(endpoint, "/")+"/2013-04-01/hostedzone/"+zoneID+"/rrset/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	r.sign(req, body)
+
+	resp, err := httpClient(r.Client).Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	var e route53Error
+	_ = xml.Unmarshal(data, &e)
+	if resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: Route 53: %s: %s", verror.AuthError, e.Code, e.Message)
+	}
+	return fmt.Errorf("%w: Route 53: %s: %s: %s", verror.ServerError, resp.Status, e.Code, e.Message)
+}
+
+// sign adds the AWS Signature Version 4 headers to req
+func (r *Route53) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if r.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", r.SessionToken)
+	}
+	signedHeaders := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if r.SessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(req.Header.Get(h)) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + route53Region + "/" + route53Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+r.SecretAccessKey), date)
+	key = hmacSHA256(key, route53Region)
+	key = hmacSHA256(key, route53Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		r.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
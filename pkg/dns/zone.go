@@ -0,0 +1,226 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	typeA     = 1
+	typeCNAME = 5
+	typeAAAA  = 28
+	typeAXFR  = 252
+
+	defaultZoneTransferTimeout = 30 * time.Second
+)
+
+// ZoneTransfer enumerates the names of a zone with a zone transfer (AXFR, RFC 5936). The name server must allow
+// transfers to this host, or to the TSIG key when one is set.
+type ZoneTransfer struct {
+	// Server is the host:port of a name server of the zone, the port defaults to 53
+	Server string
+	Zone   string
+	// TSIGKeyName and TSIGSecret, the base64 encoded HMAC-SHA256 key, sign the transfer request
+	TSIGKeyName string
+	TSIGSecret  string
+	Timeout     time.Duration
+}
+
+// Names returns the names of the zone that have an address or are an alias, that is the owners of its A, AAAA and
+// CNAME records. They're lowercased, without the trailing dot, and sorted.
+func (z *ZoneTransfer) Names(ctx context.Context) ([]string, error) {
+	if z.Zone == "" {
+		return nil, fmt.Errorf("%w: zone to transfer is not set", verror.UserDataError)
+	}
+	server := z.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	query, err := z.buildQuery(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	timeout := z.Timeout
+	if timeout <= 0 {
+		timeout = defaultZoneTransferTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// messages over TCP are prefixed with their length
+	_, err = conn.Write(append(appendUint16(nil, uint16(len(query))), query...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+
+	zone := strings.ToLower(unFqdn(z.Zone))
+	names := make(map[string]bool)
+	soas := 0
+	for soas < 2 {
+		var length [2]byte
+		_, err = io.ReadFull(conn, length[:])
+		if err == nil {
+			msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+			_, err = io.ReadFull(conn, msg)
+			if err == nil {
+				err = readTransferMessage(msg, query, zone, names, &soas)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: transfer of zone %s ended early", verror.ServerError, zone)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []string
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// buildQuery encodes the AXFR query of the zone, signed when a TSIG key is set
+func (z *ZoneTransfer) buildQuery(now time.Time) ([]byte, error) {
+	id := make([]byte, 2)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	// header: ID, flags, QDCOUNT, ANCOUNT, NSCOUNT, ARCOUNT
+	msg := append(id, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0)
+	msg = appendName(msg, z.Zone)
+	msg = appendUint16(msg, typeAXFR)
+	msg = appendUint16(msg, classIN)
+	if z.TSIGKeyName == "" {
+		return msg, nil
+	}
+	return signTSIG(msg, z.TSIGKeyName, z.TSIGSecret, now)
+}
+
+// readTransferMessage adds the names of the address and alias records of a message of the transfer to names, and
+// counts the SOA records, which start and end the transfer
+func readTransferMessage(msg, query []byte, zone string, names map[string]bool, soas *int) error {
+	invalid := fmt.Errorf("%w: invalid zone transfer message", verror.ServerError)
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != binary.BigEndian.Uint16(query) {
+		return invalid
+	}
+	if rcode := int(msg[3] & 0x0f); rcode != 0 {
+		name, ok := rcodes[rcode]
+		if !ok {
+			name = fmt.Sprintf("rcode %d", rcode)
+		}
+		if rcode == 5 || rcode == 9 {
+			return fmt.Errorf("%w: transfer of zone %s refused: %s", verror.AuthError, zone, name)
+		}
+		return fmt.Errorf("%w: transfer of zone %s failed: %s", verror.ServerError, zone, name)
+	}
+	off := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:])); i++ {
+		var err error
+		_, off, err = readName(msg, off)
+		if err != nil {
+			return invalid
+		}
+		off += 4
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[6:])); i++ {
+		name, next, err := readName(msg, off)
+		if err != nil || next+10 > len(msg) {
+			return invalid
+		}
+		rrtype := binary.BigEndian.Uint16(msg[next:])
+		off = next + 10 + int(binary.BigEndian.Uint16(msg[next+8:]))
+		if off > len(msg) {
+			return invalid
+		}
+		if *soas == 0 && rrtype != typeSOA {
+			return invalid
+		}
+		name = strings.ToLower(name)
+		switch rrtype {
+		case typeSOA:
+			*soas++
+			if *soas == 2 {
+				return nil
+			}
+		case typeA, typeAAAA, typeCNAME:
+			if name == zone || strings.HasSuffix(name, "."+zone) {
+				names[name] = true
+			}
+		}
+	}
+	return nil
+}
+
+// readName decodes the possibly compressed name at off, and returns it with the offset following it
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	// bounding the pointers followed stops loops
+	for pointers := 0; pointers < 64; {
+		if off >= len(msg) {
+			break
+		}
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case l&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, fmt.Errorf("truncated name")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			pointers++
+		default:
+			if off+1+l > len(msg) {
+				return "", 0, fmt.Errorf("truncated name")
+			}
+			labels = append(labels, string(msg[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+	return "", 0, fmt.Errorf("invalid name")
+}
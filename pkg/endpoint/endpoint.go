@@ -17,6 +17,7 @@
 package endpoint
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
@@ -26,10 +27,12 @@ import (
 	"net"
 	"net/http"
 	"regexp"
+	"strings"
 
 	"github.com/Venafi/vcert/v4/pkg/policy"
 
 	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 )
 
 const SDKName = "Venafi VCert-Go"
@@ -69,7 +72,12 @@ func (t ConnectorType) String() string {
 	}
 }
 
-// Connector provides a common interface for external communications with TPP or Venafi Cloud
+// Connector provides a common interface for external communications with TPP or Venafi Cloud.
+//
+// Once configured with SetZone, SetHTTPClient and Authenticate, a connector is safe for concurrent use: its other
+// methods only keep per-call state and share a pooled http.Client, so a single instance serves any number of
+// concurrent enrollments. The configuration methods mustn't be called while other calls are in progress, use a
+// connector per zone when requests for several zones are concurrent.
 type Connector interface {
 	// GetType returns a connector type (cloud/TPP/fake). Can be useful because some features are not supported by a Cloud connection.
 	GetType() ConnectorType
@@ -78,6 +86,9 @@ type Connector interface {
 	// GetZonesByParent returns a list of valid zones specified by parent
 	GetZonesByParent(parent string) ([]string, error)
 	Ping() (err error)
+	// PingContext is a cheap health check bounded by ctx. When the connector is authenticated the check is made
+	// with its credentials, so an error also means that the credentials are no longer valid.
+	PingContext(ctx context.Context) (err error)
 	// Authenticate is usually called by NewClient and it is not required that you manually call it.
 	Authenticate(auth *Authentication) (err error)
 	// ReadPolicyConfiguration returns information about zone policies. It can be used for checking request compatibility with policies.
@@ -91,6 +102,9 @@ type Connector interface {
 	// RetrieveCertificate immediately returns an enrolled certificate. Otherwise, RetrieveCertificate waits and retries during req.Timeout.
 	RetrieveCertificate(req *certificate.Request) (certificates *certificate.PEMCollection, err error)
 	IsCSRServiceGenerated(req *certificate.Request) (bool, error)
+	// CancelRequest aborts the request with pickupID that wasn't retrieved, e.g. one waiting for an approval that will
+	// never come or failed on the server, so it doesn't stay pending on the platform.
+	CancelRequest(pickupID string) error
 	RevokeCertificate(req *certificate.RevocationRequest) error
 	RenewCertificate(req *certificate.RenewalRequest) (requestID string, err error)
 	// ImportCertificate adds an existing certificate to Venafi Platform even if the certificate was not issued by Venafi Cloud or Venafi Platform. For information purposes.
@@ -112,6 +126,43 @@ type Connector interface {
 type Filter struct {
 	Limit       *int
 	WithExpired bool
+	// CommonName only lists the certificates issued for this common name
+	CommonName string
+}
+
+// CertificatePager is implemented by the connectors that can list certificates one page at a time, so a large
+// inventory can be streamed. Pages are numbered from 0, a page shorter than pageSize is the last one.
+type CertificatePager interface {
+	ListCertificatesPage(filter Filter, page, pageSize int) ([]certificate.CertificateInfo, error)
+}
+
+// ContactManager is implemented by the connectors that can read and change the contacts of certificates and zones,
+// i.e. the users and groups that own them, e.g. to reassign the ownership after a re-organization. Contacts are
+// referenced by their user or group names, and Set replaces all the contacts of the object.
+type ContactManager interface {
+	GetCertificateContacts(certificateID string) ([]string, error)
+	SetCertificateContacts(certificateID string, contacts []string) error
+	GetZoneContacts(zone string) ([]string, error)
+	SetZoneContacts(zone string, contacts []string) error
+}
+
+// ApplicationAssociator is implemented by the connectors that can associate certificates with the application objects
+// they are installed on, so the installations tracked by the platform stay in sync with the deployments. Applications
+// are referenced by their DN or ID.
+type ApplicationAssociator interface {
+	GetCertificateApplications(certificateID string) ([]string, error)
+	// AssociateApplications associates the applications with the certificate, push requests the certificate to
+	// be provisioned to the applications
+	AssociateApplications(certificateID string, applications []string, push bool) error
+	DissociateApplications(certificateID string, applications []string) error
+}
+
+// CertificateHistoryRetriever is implemented by the connectors that keep the previous versions of a certificate when
+// it's renewed in place, i.e. under the same ID
+type CertificateHistoryRetriever interface {
+	// RetrieveCertificateVersions returns the current version of the certificate first, then the versions it
+	// renewed, the latest first
+	RetrieveCertificateVersions(certificateID string) ([]certificate.CertificateInfo, error)
 }
 
 // Authentication provides a struct for authentication data. Either specify User and Password for Trust Platform or specify an APIKey for Cloud.
@@ -136,6 +187,10 @@ func (err ErrRetrieveCertificateTimeout) Error() string {
 	return fmt.Sprintf("Operation timed out. You may try retrieving the certificate later using Pickup ID: %s", err.CertificateID)
 }
 
+func (err ErrRetrieveCertificateTimeout) Code() string {
+	return verror.CodeRetrieveTimeout
+}
+
 //todo: replace with verror
 // ErrCertificatePending provides a common error structure for a timeout while retrieving a certificate
 type ErrCertificatePending struct {
@@ -150,6 +205,10 @@ func (err ErrCertificatePending) Error() string {
 	return fmt.Sprintf("Issuance is pending. You may try retrieving the certificate later using Pickup ID: %s\n\tStatus: %s", err.CertificateID, err.Status)
 }
 
+func (err ErrCertificatePending) Code() string {
+	return verror.CodeCertificatePending
+}
+
 type ErrCertificateRejected struct {
 	CertificateID string
 	Status        string
@@ -162,6 +221,10 @@ func (err ErrCertificateRejected) Error() string {
 	return fmt.Sprintf("Status: %s", err.Status)
 }
 
+func (err ErrCertificateRejected) Code() string {
+	return verror.CodeCertificateRejected
+}
+
 // Policy is struct that contains restrictions for certificates. Most of the fields contains list of regular expression.
 // For satisfying policies, all values in the certificate field must match AT LEAST ONE regular expression in corresponding policy field.
 type Policy struct {
@@ -340,6 +403,9 @@ func (p *Policy) SimpleValidateCertificateRequest(request certificate.Request) e
 		if !checkStringByRegexp(parsedCSR.Subject.CommonName, p.SubjectCNRegexes) {
 			return fmt.Errorf(cnError, parsedCSR.Subject.CommonName, p.SubjectCNRegexes)
 		}
+		if err := p.ValidateDNSNames(parsedCSR.DNSNames); err != nil {
+			return err
+		}
 		if !isComponentValid(parsedCSR.DNSNames, p.DnsSanRegExs, true) {
 			return fmt.Errorf(SANsError, parsedCSR.DNSNames, p.DnsSanRegExs)
 		}
@@ -347,6 +413,9 @@ func (p *Policy) SimpleValidateCertificateRequest(request certificate.Request) e
 		if !checkStringByRegexp(request.Subject.CommonName, p.SubjectCNRegexes) {
 			return fmt.Errorf(cnError, request.Subject.CommonName, p.SubjectCNRegexes)
 		}
+		if err := p.ValidateDNSNames(request.DNSNames); err != nil {
+			return err
+		}
 		if !isComponentValid(request.DNSNames, p.DnsSanRegExs, true) {
 			return fmt.Errorf(SANsError, request.DNSNames, p.DnsSanRegExs)
 		}
@@ -421,22 +490,27 @@ func isComponentValid(ss []string, regexs []string, optional bool) bool {
 func (z *ZoneConfiguration) UpdateCertificateRequest(request *certificate.Request) {
 	if len(request.Subject.Organization) == 0 && z.Organization != "" {
 		request.Subject.Organization = []string{z.Organization}
+		request.Warn(certificate.WarningPolicyDefault, "organization set to %s by the zone", z.Organization)
 	}
 
 	if len(request.Subject.OrganizationalUnit) == 0 && z.OrganizationalUnit != nil {
 		request.Subject.OrganizationalUnit = z.OrganizationalUnit
+		request.Warn(certificate.WarningPolicyDefault, "organizational unit set to %s by the zone", strings.Join(z.OrganizationalUnit, ", "))
 	}
 
 	if len(request.Subject.Country) == 0 && z.Country != "" {
 		request.Subject.Country = []string{z.Country}
+		request.Warn(certificate.WarningPolicyDefault, "country set to %s by the zone", z.Country)
 	}
 
 	if len(request.Subject.Province) == 0 && z.Province != "" {
 		request.Subject.Province = []string{z.Province}
+		request.Warn(certificate.WarningPolicyDefault, "state set to %s by the zone", z.Province)
 	}
 
 	if len(request.Subject.Locality) == 0 && z.Locality != "" {
 		request.Subject.Locality = []string{z.Locality}
+		request.Warn(certificate.WarningPolicyDefault, "locality set to %s by the zone", z.Locality)
 	}
 
 	if z.HashAlgorithm != x509.UnknownSignatureAlgorithm {
@@ -448,15 +522,18 @@ func (z *ZoneConfiguration) UpdateCertificateRequest(request *certificate.Reques
 	if z.KeyConfiguration != nil {
 		if request.KeyType.String() == "" {
 			request.KeyType = z.KeyConfiguration.KeyType
+			request.Warn(certificate.WarningPolicyDefault, "key type set to %s by the zone", request.KeyType.String())
 		}
 		if request.KeyType == certificate.KeyTypeRSA {
 			if len(z.KeyConfiguration.KeySizes) != 0 && request.KeyLength == 0 {
 				request.KeyLength = z.KeyConfiguration.KeySizes[0]
+				request.Warn(certificate.WarningPolicyDefault, "key size set to %d by the zone", request.KeyLength)
 			}
 		}
 		if request.KeyType == certificate.KeyTypeECDSA {
 			if len(z.KeyConfiguration.KeyCurves) != 0 && request.KeyCurve == certificate.EllipticCurveNotSet {
 				request.KeyCurve = z.KeyConfiguration.KeyCurves[0]
+				request.Warn(certificate.WarningPolicyDefault, "key curve set to %s by the zone", request.KeyCurve.String())
 			}
 		}
 	} else {
@@ -18,7 +18,9 @@ package endpoint
 
 import (
 	"crypto/x509"
+	"errors"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 	"sort"
 	"strings"
 	"testing"
@@ -103,6 +105,14 @@ func TestUpdateRequestSubjectMostlyEmpty(t *testing.T) {
 	if !strings.EqualFold(req.Subject.Locality[0], z.Locality) {
 		t.Fatalf("Updated request did not contain the expected Locality: %s -- Actual Locality %s", z.Locality, req.Subject.Locality[0])
 	}
+	for _, w := range req.Warnings {
+		if w.Code != certificate.WarningPolicyDefault {
+			t.Fatalf("unexpected warning %s", w)
+		}
+	}
+	if len(req.Warnings) < 5 {
+		t.Fatalf("the subject defaults of the zone should be reported as warnings: %v", req.Warnings)
+	}
 
 	sort.Strings(req.Subject.OrganizationalUnit)
 	for _, val := range z.OrganizationalUnit {
@@ -272,3 +282,41 @@ func getBaseZoneConfiguration() *ZoneConfiguration {
 	z.HashAlgorithm = x509.SHA512WithRSA
 	return &z
 }
+
+func TestValidateDNSNames(t *testing.T) {
+	p := Policy{DnsSanRegExs: []string{`^[\p{L}\p{N}-*]+\.example\.com$`}, AllowWildcards: true}
+	if err := p.ValidateDNSNames([]string{"www.example.com", "*.example.com"}); err != nil {
+		t.Fatalf("%s", err)
+	}
+	cases := map[string]string{
+		"a.b.example.com":   `"a.b.example.com" is not allowed by the zone policy: it has 1 subdomain level(s) too many, names like a.example.com are allowed`,
+		"*.x.y.example.com": "2 subdomain level(s) too many, names like *.example.com",
+		"www.example.org":   "doesn't match any of",
+		"www.*.example.com": "a wildcard must be the whole leftmost label",
+		"w*.example.com":    "a wildcard must be the whole leftmost label",
+		"*.com":             "a wildcard must be followed by at least two labels",
+	}
+	for name, expected := range cases {
+		err := p.ValidateDNSNames([]string{"www.example.com", name})
+		var v ErrPolicyViolation
+		if !errors.As(err, &v) || v.Value != name || !strings.Contains(err.Error(), expected) {
+			t.Errorf("unexpected error for %s: %v", name, err)
+		}
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("%v should be a user data error", err)
+		}
+	}
+
+	p.AllowWildcards = false
+	if err := p.ValidateDNSNames([]string{"*.example.com"}); err == nil || !strings.Contains(err.Error(), "wildcards are not allowed") {
+		t.Errorf("unexpected error %v", err)
+	}
+	p.DnsSanRegExs = []string{}
+	if err := p.ValidateDNSNames([]string{"www.example.com"}); err == nil || !strings.Contains(err.Error(), "DNS SANs are not allowed") {
+		t.Errorf("unexpected error %v", err)
+	}
+	p.DnsSanRegExs = nil
+	if err := p.ValidateDNSNames([]string{"www.anything.org"}); err != nil {
+		t.Errorf("a policy without DNS rules should only check wildcards: %s", err)
+	}
+}
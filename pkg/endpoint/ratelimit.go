@@ -0,0 +1,99 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const defaultRateLimitWait = time.Second
+
+// ErrRateLimited is returned when the platform rejected a request with HTTP 429 Too Many Requests
+type ErrRateLimited struct {
+	// RetryAfter is how long the platform asked to wait before the next request, zero when it didn't tell
+	RetryAfter time.Duration
+}
+
+func (err ErrRateLimited) Error() string {
+	if err.RetryAfter <= 0 {
+		return "request was rate limited by the server"
+	}
+	return fmt.Sprintf("request was rate limited by the server, retry after %s", err.RetryAfter)
+}
+
+func (err ErrRateLimited) Unwrap() error {
+	return verror.ServerTemporaryUnavailableError
+}
+
+func (err ErrRateLimited) Code() string {
+	return verror.CodeRateLimited
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, either a number of seconds or an HTTP date
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// RetryOnRateLimit calls fn until it returns something else than ErrRateLimited, pausing for the delay asked by
+// the server in between (or an exponential backoff when it didn't ask for one). Batch operations use it to pause
+// and resume rather than fail the whole job. The pauses add up to at most maxWait, after which the last
+// ErrRateLimited is returned.
+func RetryOnRateLimit(ctx context.Context, maxWait time.Duration, fn func() error) error {
+	deadline := time.Now().Add(maxWait)
+	backoff := defaultRateLimitWait
+	for {
+		err := fn()
+		var rateLimited ErrRateLimited
+		if !errors.As(err, &rateLimited) {
+			return err
+		}
+		wait := rateLimited.RetryAfter
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
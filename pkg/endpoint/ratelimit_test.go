@@ -0,0 +1,65 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"Tue, 01 Mar 2022 12:00:30 GMT": 30 * time.Second,
+		"Tue, 01 Mar 2022 11:00:00 GMT": 0,
+		"soon":                          0,
+	}
+	for value, expected := range cases {
+		if d := ParseRetryAfter(value, now); d != expected {
+			t.Errorf("ParseRetryAfter(%q) = %s, expected %s", value, d, expected)
+		}
+	}
+}
+
+func TestRetryOnRateLimit(t *testing.T) {
+	calls := 0
+	err := RetryOnRateLimit(context.Background(), time.Second, func() error {
+		calls++
+		if calls < 3 {
+			return ErrRateLimited{RetryAfter: 10 * time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("expected success after 3 calls, got %v after %d calls", err, calls)
+	}
+
+	err = RetryOnRateLimit(context.Background(), 50*time.Millisecond, func() error {
+		return ErrRateLimited{RetryAfter: time.Minute}
+	})
+	var rateLimited ErrRateLimited
+	if !errors.As(err, &rateLimited) || !errors.Is(err, verror.ServerTemporaryUnavailableError) {
+		t.Fatalf("expected rate limited error once the wait exceeds the limit, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"crypto/x509"
+	"math/rand"
+	"time"
+)
+
+// RenewalInfo is the window in which the issuer suggests to renew a certificate, e.g. from ACME Renewal
+// Information (ARI). The issuer can move the window earlier when the certificate has to be replaced before it
+// expires, for instance ahead of a mass revocation.
+type RenewalInfo struct {
+	SuggestedWindowStart time.Time
+	SuggestedWindowEnd   time.Time
+	// ExplanationURL points to a page describing why the window was moved, when the issuer provides one
+	ExplanationURL string
+	// RetryAfter is how long the issuer asks clients to wait before checking the window again
+	RetryAfter time.Duration
+}
+
+// RenewalTime picks a random time in the suggested window so that clients don't all renew at the same time.
+// It returns the start of the window when the window is empty or inverted.
+func (ri *RenewalInfo) RenewalTime() time.Time {
+	d := ri.SuggestedWindowEnd.Sub(ri.SuggestedWindowStart)
+	if d <= 0 {
+		return ri.SuggestedWindowStart
+	}
+	return ri.SuggestedWindowStart.Add(time.Duration(rand.Int63n(int64(d))))
+}
+
+// RenewalInfoRetriever is implemented by connectors whose backend provides renewal recommendations. It's not part
+// of Connector since most backends don't, check for it with a type assertion.
+type RenewalInfoRetriever interface {
+	RetrieveRenewalInfo(cert *x509.Certificate) (*RenewalInfo, error)
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// ErrPolicyViolation is returned when a value of the request breaks a rule of the zone policy
+type ErrPolicyViolation struct {
+	// Field is the kind of value, e.g. "DNS SAN"
+	Field string
+	Value string
+	Rule  string
+}
+
+func (e ErrPolicyViolation) Error() string {
+	return fmt.Sprintf("%s %q is not allowed by the zone policy: %s", e.Field, e.Value, e.Rule)
+}
+
+func (e ErrPolicyViolation) Unwrap() error {
+	return verror.UserDataError
+}
+
+func (e ErrPolicyViolation) Code() string {
+	return verror.CodePolicyViolation
+}
+
+// ValidateDNSNames checks the DNS SANs of a request against the policy, locally, so a rejected name is reported
+// with the rule it breaks instead of the generic error of the server: wildcards must be a whole leftmost label
+// followed by at least two labels and be allowed by the policy, and every name must match one of DnsSanRegExs.
+// When a name doesn't match because it has too many subdomain levels, the error says so. A nil DnsSanRegExs
+// means the policy wasn't read from a server and only the wildcard rules are checked.
+func (p *Policy) ValidateDNSNames(names []string) error {
+	const field = "DNS SAN"
+	for _, name := range names {
+		labels := strings.Split(name, ".")
+		wildcard := labels[0] == "*"
+		for i, l := range labels {
+			if strings.Contains(l, "*") && (i > 0 || l != "*") {
+				return ErrPolicyViolation{field, name, "a wildcard must be the whole leftmost label, like *.example.com"}
+			}
+		}
+		if wildcard && len(labels) < 3 {
+			return ErrPolicyViolation{field, name, "a wildcard must be followed by at least two labels"}
+		}
+		if p.DnsSanRegExs == nil {
+			continue
+		}
+		if !checkStringByRegexp(name, p.DnsSanRegExs) {
+			if len(p.DnsSanRegExs) == 0 {
+				return ErrPolicyViolation{field, name, "DNS SANs are not allowed"}
+			}
+			// dropping the labels after the leftmost one tells whether only the depth is wrong
+			for k := 2; k < len(labels)-1; k++ {
+				shallower := labels[0] + "." + strings.Join(labels[k:], ".")
+				if checkStringByRegexp(shallower, p.DnsSanRegExs) {
+					return ErrPolicyViolation{field, name, fmt.Sprintf(
+						"it has %d subdomain level(s) too many, names like %s are allowed", k-1, shallower)}
+				}
+			}
+			return ErrPolicyViolation{field, name, fmt.Sprintf("it doesn't match any of %v", p.DnsSanRegExs)}
+		}
+		if wildcard && !p.AllowWildcards {
+			return ErrPolicyViolation{field, name, "wildcards are not allowed"}
+		}
+	}
+	return nil
+}
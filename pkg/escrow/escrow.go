@@ -0,0 +1,153 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package escrow retrieves the private keys archived by the Venafi platform for the certificates whose keys it
+// generated, where the policy of the platform allows their export, e.g. to restore a host after a disaster.
+package escrow
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/youmark/pkcs8"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/util"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// ErrNoPrivateKey is returned when the platform has no private key archived for the certificate, because it was
+// generated locally, or when its policy doesn't allow exporting it
+var ErrNoPrivateKey = fmt.Errorf("%w: no private key is available for the certificate", verror.UserDataError)
+
+// Request identifies the certificate whose private key is retrieved, by its pickup ID or by its thumbprint
+type Request struct {
+	PickupID   string
+	Thumbprint string
+	// Password protects the private key while the platform sends it. It must satisfy the password policy of the
+	// platform.
+	Password    string
+	ChainOption certificate.ChainOption
+}
+
+// RetrievePrivateKey returns the certificate, its chain and its archived private key, decrypted with the password of
+// req. The private key is checked to match the certificate.
+func RetrievePrivateKey(conn endpoint.Connector, req *Request) (*certificate.PEMCollection, error) {
+	if req.PickupID == "" && req.Thumbprint == "" {
+		return nil, fmt.Errorf("%w: a pickup ID or a thumbprint is required to retrieve a private key", verror.UserDataError)
+	}
+	if req.Password == "" {
+		return nil, fmt.Errorf("%w: a password is required to retrieve a private key", verror.UserDataError)
+	}
+	pcc, err := conn.RetrieveCertificate(&certificate.Request{
+		PickupID:        req.PickupID,
+		Thumbprint:      req.Thumbprint,
+		ChainOption:     req.ChainOption,
+		KeyType:         certificate.KeyTypeRSA,
+		KeyPassword:     req.Password,
+		FetchPrivateKey: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pcc.PrivateKey == "" {
+		return nil, ErrNoPrivateKey
+	}
+	key, err := decryptPrivateKey(pcc.PrivateKey, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := pem.Decode([]byte(pcc.Certificate))
+	if b == nil {
+		return nil, fmt.Errorf("%w: no PEM data found in the certificate", verror.ServerBadDataResponce)
+	}
+	cert, err := certificate.ParseCertificate(b.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse the certificate: %s", verror.ServerBadDataResponce, err)
+	}
+	if !samePublicKey(cert.PublicKey, key.Public()) {
+		return nil, fmt.Errorf("%w: the private key doesn't match the certificate", verror.ServerBadDataResponce)
+	}
+	pcc.PrivateKey = ""
+	err = pcc.AddPrivateKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pcc, nil
+}
+
+// decryptPrivateKey decrypts a private key encrypted as PKCS#8, or with the legacy PEM encryption
+func decryptPrivateKey(data, password string) (crypto.Signer, error) {
+	b, _ := pem.Decode([]byte(data))
+	if b == nil {
+		return nil, fmt.Errorf("%w: no PEM data found in the private key", verror.ServerBadDataResponce)
+	}
+	var key interface{}
+	var err error
+	switch {
+	case b.Type == "ENCRYPTED PRIVATE KEY":
+		key, err = pkcs8.ParsePKCS8PrivateKey(b.Bytes, []byte(password))
+	case b.Headers["DEK-Info"] != "":
+		var der []byte
+		der, err = util.X509DecryptPEMBlock(b, []byte(password))
+		if err == nil {
+			key, err = parseKey(b.Type, der)
+		}
+	default:
+		key, err = parseKey(b.Type, b.Bytes)
+	}
+	if err != nil {
+		if err.Error() == "pkcs8: only PBES2 supported" {
+			return nil, fmt.Errorf("%w: the private key is encrypted with an unsupported algorithm, the zone must use the SHA1 3DES or SHA256 AES256 private key PBE algorithm", verror.UserDataError)
+		}
+		return nil, fmt.Errorf("%w: failed to decrypt the private key: %s", verror.UserDataError, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported private key type %T", verror.UserDataError, key)
+	}
+	return signer, nil
+}
+
+func parseKey(pemType string, der []byte) (interface{}, error) {
+	switch pemType {
+	case "RSA PRIVATE KEY":
+		if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+			return key, nil
+		}
+	case "EC PRIVATE KEY":
+		if key, err := x509.ParseECPrivateKey(der); err == nil {
+			return key, nil
+		}
+	}
+	return certificate.ParsePKCS8PrivateKey(der)
+}
+
+func samePublicKey(a, b crypto.PublicKey) bool {
+	derA, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	derB, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(derA, derB)
+}
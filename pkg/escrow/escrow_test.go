@@ -0,0 +1,127 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package escrow
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// keylessConnector returns the certificates without their private key
+type keylessConnector struct {
+	*fake.Connector
+}
+
+func (c keylessConnector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	pcc, err := c.Connector.RetrieveCertificate(req)
+	if pcc != nil {
+		pcc.PrivateKey = ""
+	}
+	return pcc, err
+}
+
+func requestServiceGenerated(t *testing.T, conn *fake.Connector) string {
+	req := &certificate.Request{CsrOrigin: certificate.ServiceGeneratedCSR, KeyType: certificate.KeyTypeRSA, KeyLength: 2048}
+	req.Subject.CommonName = "escrow.example.com"
+	err := conn.GenerateRequest(nil, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pickupID, err := conn.RequestCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pickupID
+}
+
+func TestRetrievePrivateKey(t *testing.T) {
+	conn := fake.NewConnector(true, nil)
+	pickupID := requestServiceGenerated(t, conn)
+
+	pcc, err := RetrievePrivateKey(conn, &Request{PickupID: pickupID, Password: "Passw0rd!"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := pem.Decode([]byte(pcc.PrivateKey))
+	if b == nil || x509.IsEncryptedPEMBlock(b) || b.Type == "ENCRYPTED PRIVATE KEY" {
+		t.Fatalf("expected a decrypted private key, got:\n%s", pcc.PrivateKey)
+	}
+	key, err := decryptPrivateKey(pcc.PrivateKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, _ := pem.Decode([]byte(pcc.Certificate))
+	cert, err := x509.ParseCertificate(cb.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePublicKey(cert.PublicKey, key.Public()) {
+		t.Fatal("the private key doesn't match the certificate")
+	}
+	if len(pcc.Chain) == 0 {
+		t.Fatal("expected the chain of the certificate")
+	}
+
+	_, err = RetrievePrivateKey(keylessConnector{conn}, &Request{PickupID: pickupID, Password: "Passw0rd!"})
+	if !errors.Is(err, ErrNoPrivateKey) {
+		t.Fatalf("expected ErrNoPrivateKey, got %v", err)
+	}
+}
+
+func TestRetrievePrivateKeyInvalid(t *testing.T) {
+	conn := fake.NewConnector(true, nil)
+	for _, req := range []*Request{
+		{Password: "Passw0rd!"},
+		{PickupID: "\\VED\\Policy\\escrow.example.com"},
+	} {
+		_, err := RetrievePrivateKey(conn, req)
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("expected a user data error for %+v, got %v", req, err)
+		}
+	}
+}
+
+func TestDecryptPrivateKey(t *testing.T) {
+	key, err := certificate.GenerateECDSAPrivateKey(certificate.EllipticCurveP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"", "legacy-pem"} {
+		b, err := certificate.GetEncryptedPrivateKeyPEMBock(key, []byte("Passw0rd!"), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := string(pem.EncodeToMemory(b))
+		decrypted, err := decryptPrivateKey(data, "Passw0rd!")
+		if err != nil {
+			t.Fatalf("%q: %s", format, err)
+		}
+		if !samePublicKey(key.Public(), decrypted.Public()) {
+			t.Fatalf("%q: unexpected private key", format)
+		}
+		_, err = decryptPrivateKey(data, "wrong")
+		if !errors.Is(err, verror.UserDataError) {
+			t.Fatalf("%q: expected a user data error, got %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package exporter exposes the expiry of certificates as Prometheus metrics, for the certificates of the inventory
+// of a zone and for the ones served by TLS endpoints.
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+const (
+	DefaultInterval       = 5 * time.Minute
+	DefaultExpiringWithin = 30 * 24 * time.Hour
+	defaultDialTimeout    = 10 * time.Second
+)
+
+// Certificate statuses
+const (
+	StatusValid    = "valid"
+	StatusExpiring = "expiring"
+	StatusExpired  = "expired"
+)
+
+var statuses = []string{StatusValid, StatusExpiring, StatusExpired}
+
+// Exporter collects the certificates periodically and serves the metrics of the last collection. The zero value
+// only needs a Connector or Endpoints.
+type Exporter struct {
+	// Connector lists the inventory of its zone, it may be nil to only watch endpoints
+	Connector endpoint.Connector
+	Filter    endpoint.Filter
+	// Endpoints are host:port addresses of TLS servers whose certificate is watched
+	Endpoints []string
+	// ExpiringWithin is how long before the expiry a certificate is reported as expiring, 30 days by default
+	ExpiringWithin time.Duration
+	// Interval between two collections, 5 minutes by default
+	Interval    time.Duration
+	DialTimeout time.Duration
+	Log         func(format string, args ...interface{})
+	// Now is replaced in tests
+	Now func() time.Time
+
+	mu      sync.RWMutex
+	metrics []byte
+}
+
+type certMetric struct {
+	labels [][2]string
+	expiry time.Time
+}
+
+// Run collects the certificates every Interval until ctx is done
+func (e *Exporter) Run(ctx context.Context) error {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := e.Collect(ctx)
+		if err != nil {
+			e.logf("collection failed: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect lists the certificates and renders their metrics. The metrics of the endpoints are still updated when
+// the inventory can't be listed, and the error is returned.
+func (e *Exporter) Collect(ctx context.Context) error {
+	now := time.Now()
+	if e.Now != nil {
+		now = e.Now()
+	}
+	var certs []certMetric
+	var inventoryErr error
+	if e.Connector != nil {
+		infos, err := e.Connector.ListCertificates(e.Filter)
+		if err != nil {
+			inventoryErr = fmt.Errorf("could not list the inventory: %w", err)
+		}
+		for _, info := range infos {
+			certs = append(certs, certMetric{
+				labels: [][2]string{{"source", "inventory"}, {"id", info.ID}, {"cn", info.CN}, {"serial", info.Serial},
+					{"thumbprint", info.Thumbprint}},
+				expiry: info.ValidTo,
+			})
+		}
+	}
+	up := make(map[string]bool)
+	for _, addr := range e.Endpoints {
+		cert, err := e.fetch(ctx, addr)
+		if err != nil {
+			e.logf("could not get the certificate of %s: %s", addr, err)
+			continue
+		}
+		up[addr] = true
+		certs = append(certs, cert)
+	}
+	e.render(now, certs, up, inventoryErr == nil)
+	return inventoryErr
+}
+
+func (e *Exporter) fetch(ctx context.Context, addr string) (certMetric, error) {
+	timeout := e.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return certMetric{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return certMetric{}, err
+	}
+	defer raw.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = raw.SetDeadline(deadline)
+	}
+	// the certificate is reported even when it isn't trusted, an untrusted certificate is still going to expire
+	conn := tls.Client(raw, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	err = conn.Handshake()
+	if err != nil {
+		return certMetric{}, err
+	}
+	peers := conn.ConnectionState().PeerCertificates
+	if len(peers) == 0 {
+		return certMetric{}, fmt.Errorf("no certificate")
+	}
+	leaf := peers[0]
+	return certMetric{
+		labels: [][2]string{{"source", "endpoint"}, {"endpoint", addr}, {"cn", leaf.Subject.CommonName},
+			{"serial", fmt.Sprintf("%X", leaf.SerialNumber)}},
+		expiry: leaf.NotAfter,
+	}, nil
+}
+
+func (e *Exporter) render(now time.Time, certs []certMetric, up map[string]bool, inventoryOK bool) {
+	expiring := e.ExpiringWithin
+	if expiring <= 0 {
+		expiring = DefaultExpiringWithin
+	}
+	var lines []string
+	for _, c := range certs {
+		lines = append(lines, metricLine("vcert_certificate_expiry_timestamp_seconds", c.labels, float64(c.expiry.Unix())))
+	}
+	sort.Strings(lines)
+	var b bytes.Buffer
+	writeFamily(&b, "vcert_certificate_expiry_timestamp_seconds", "Time the certificate expires, in seconds since the epoch.", lines)
+
+	lines = nil
+	for _, c := range certs {
+		status := StatusValid
+		if !c.expiry.After(now) {
+			status = StatusExpired
+		} else if c.expiry.Sub(now) <= expiring {
+			status = StatusExpiring
+		}
+		for _, s := range statuses {
+			v := 0.0
+			if s == status {
+				v = 1
+			}
+			lines = append(lines, metricLine("vcert_certificate_status", append(c.labels, [2]string{"status", s}), v))
+		}
+	}
+	sort.Strings(lines)
+	writeFamily(&b, "vcert_certificate_status", "Status of the certificate: valid, expiring or expired.", lines)
+
+	lines = nil
+	for _, addr := range e.Endpoints {
+		v := 0.0
+		if up[addr] {
+			v = 1
+		}
+		lines = append(lines, metricLine("vcert_endpoint_up", [][2]string{{"endpoint", addr}}, v))
+	}
+	sort.Strings(lines)
+	writeFamily(&b, "vcert_endpoint_up", "Whether the certificate of the TLS endpoint could be read.", lines)
+
+	if e.Connector != nil {
+		v := 0.0
+		if inventoryOK {
+			v = 1
+		}
+		writeFamily(&b, "vcert_inventory_up", "Whether the inventory could be listed.",
+			[]string{metricLine("vcert_inventory_up", nil, v)})
+	}
+	writeFamily(&b, "vcert_exporter_last_collection_timestamp_seconds", "Time of the last collection.",
+		[]string{metricLine("vcert_exporter_last_collection_timestamp_seconds", nil, float64(now.Unix()))})
+
+	e.mu.Lock()
+	e.metrics = b.Bytes()
+	e.mu.Unlock()
+}
+
+// ServeHTTP serves the metrics of the last collection in the Prometheus text format
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.RLock()
+	metrics := e.metrics
+	e.mu.RUnlock()
+	if metrics == nil {
+		http.Error(w, "no collection yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(metrics)
+}
+
+func (e *Exporter) logf(format string, args ...interface{}) {
+	if e.Log != nil {
+		e.Log(format, args...)
+	}
+}
+
+func writeFamily(b *bytes.Buffer, name, help string, lines []string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func metricLine(name string, labels [][2]string, value float64) string {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, l[0], labelEscaper.Replace(l[1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	return b.String()
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+type inventoryConnector struct {
+	*fake.Connector
+	infos []certificate.CertificateInfo
+	err   error
+}
+
+func (c *inventoryConnector) ListCertificates(endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	return c.infos, c.err
+}
+
+func TestCollect(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	tlsAddr := strings.TrimPrefix(tlsServer.URL, "https://")
+
+	conn := &inventoryConnector{Connector: fake.NewConnector(false, nil), infos: []certificate.CertificateInfo{
+		{ID: "1", CN: "valid.example.com", Serial: "01", ValidTo: now.Add(90 * 24 * time.Hour)},
+		{ID: "2", CN: "soon.example.com", Serial: "02", ValidTo: now.Add(10 * 24 * time.Hour)},
+		{ID: "3", CN: `"odd".example.com`, Serial: "03", ValidTo: now.Add(-time.Hour)},
+	}}
+	e := &Exporter{Connector: conn, Endpoints: []string{tlsAddr, "127.0.0.1:1"}, Now: func() time.Time { return now },
+		DialTimeout: time.Second}
+
+	server := httptest.NewServer(e)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("no metrics should be served before the first collection, got %s", resp.Status)
+	}
+
+	err = e.Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	metrics := string(body)
+	expected := []string{
+		"# TYPE vcert_certificate_expiry_timestamp_seconds gauge",
+		fmt.Sprintf(`vcert_certificate_expiry_timestamp_seconds{source="inventory",id="1",cn="valid.example.com",serial="01",thumbprint=""} %d`,
+			now.Add(90*24*time.Hour).Unix()),
+		`vcert_certificate_status{source="inventory",id="1",cn="valid.example.com",serial="01",thumbprint="",status="valid"} 1`,
+		`vcert_certificate_status{source="inventory",id="2",cn="soon.example.com",serial="02",thumbprint="",status="expiring"} 1`,
+		`vcert_certificate_status{source="inventory",id="2",cn="soon.example.com",serial="02",thumbprint="",status="valid"} 0`,
+		`vcert_certificate_status{source="inventory",id="3",cn="\"odd\".example.com",serial="03",thumbprint="",status="expired"} 1`,
+		fmt.Sprintf(`vcert_certificate_expiry_timestamp_seconds{source="endpoint",endpoint="%s"`, tlsAddr),
+		fmt.Sprintf(`vcert_endpoint_up{endpoint="%s"} 1`, tlsAddr),
+		`vcert_endpoint_up{endpoint="127.0.0.1:1"} 0`,
+		"vcert_inventory_up 1",
+	}
+	for _, s := range expected {
+		if !strings.Contains(metrics, s) {
+			t.Errorf("missing %s in\n%s", s, metrics)
+		}
+	}
+
+	conn.err = fmt.Errorf("unavailable")
+	if err = e.Collect(context.Background()); err == nil {
+		t.Fatal("the inventory error should be returned")
+	}
+	if m := string(e.metrics); !strings.Contains(m, "vcert_inventory_up 0") || !strings.Contains(m, "vcert_endpoint_up{endpoint=\""+tlsAddr+"\"} 1") {
+		t.Fatalf("unexpected metrics\n%s", m)
+	}
+}
@@ -0,0 +1,343 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package failover sends the calls of a connector to a secondary platform while the primary one is unreachable,
+// e.g. to a second TPP cluster or to VaaS. Once the primary answers its health checks again, calls switch back to
+// it.
+package failover
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/breaker"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/policy"
+)
+
+// DefaultHealthCheckInterval is how often the primary is checked while calls go to the secondary
+const DefaultHealthCheckInterval = time.Minute
+
+// Connector is a composite connector. Enrollment calls (zone and policy reads, request generation and submission)
+// fail over to Secondary when Primary is unreachable. A certificate is picked up from the platform it was
+// requested from; when that platform becomes unreachable before the pickup, the request is submitted again to the
+// other one. Other calls, which refer to objects of a single platform like a certificate DN, go to the active
+// connector without failing over.
+type Connector struct {
+	Primary   endpoint.Connector
+	Secondary endpoint.Connector
+	// PrimaryAuth authenticates Primary again when calls switch back to it, if it's set
+	PrimaryAuth *endpoint.Authentication
+	// SecondaryZone is the zone used on Secondary when it differs from the zone of Primary, e.g. a VaaS
+	// application and issuing template for a TPP policy folder
+	SecondaryZone string
+	// HealthCheckInterval is the time between two checks of Primary while calls go to Secondary, it defaults to
+	// DefaultHealthCheckInterval
+	HealthCheckInterval time.Duration
+	// IsUnreachable tells which errors mean the platform can't be used, it defaults to breaker.IsServerFailure
+	IsUnreachable func(err error) bool
+	// OnSwitch is called when calls switch from a connector to the other, when it's set
+	OnSwitch func(toSecondary bool, cause error)
+
+	mu          sync.Mutex
+	onSecondary bool
+	nextCheck   time.Time
+	// pickups remembers which connector each pickup ID was issued by
+	pickups map[string]endpoint.Connector
+	now     func() time.Time
+}
+
+// NewConnector returns a Connector that prefers primary
+func NewConnector(primary, secondary endpoint.Connector) *Connector {
+	return &Connector{Primary: primary, Secondary: secondary}
+}
+
+// OnSecondary tells whether calls currently go to Secondary
+func (c *Connector) OnSecondary() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.onSecondary
+}
+
+// FailOver makes calls go to Secondary until Primary is healthy again, e.g. when Primary couldn't be authenticated
+func (c *Connector) FailOver(cause error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.switchTo(true, cause)
+}
+
+// active returns the connector calls should go to, checking whether Primary is back when it's time
+func (c *Connector) active() endpoint.Connector {
+	c.mu.Lock()
+	if !c.onSecondary {
+		c.mu.Unlock()
+		return c.Primary
+	}
+	if c.clock().Before(c.nextCheck) {
+		c.mu.Unlock()
+		return c.Secondary
+	}
+	c.nextCheck = c.clock().Add(c.healthCheckInterval())
+	c.mu.Unlock()
+
+	// the health check is made without the lock, concurrent calls keep using Secondary meanwhile
+	err := c.Primary.Ping()
+	if err == nil && c.PrimaryAuth != nil {
+		err = c.Primary.Authenticate(c.PrimaryAuth)
+	}
+	if err != nil {
+		return c.Secondary
+	}
+	c.mu.Lock()
+	c.switchTo(false, nil)
+	c.mu.Unlock()
+	return c.Primary
+}
+
+func (c *Connector) switchTo(secondary bool, cause error) {
+	if c.onSecondary == secondary {
+		return
+	}
+	c.onSecondary = secondary
+	if secondary {
+		c.nextCheck = c.clock().Add(c.healthCheckInterval())
+	}
+	if c.OnSwitch != nil {
+		c.OnSwitch(secondary, cause)
+	}
+}
+
+func (c *Connector) unreachable(err error) bool {
+	if c.IsUnreachable != nil {
+		return c.IsUnreachable(err)
+	}
+	return breaker.IsServerFailure(err)
+}
+
+// do calls fn with the active connector, and with Secondary when Primary turns out to be unreachable
+func (c *Connector) do(fn func(conn endpoint.Connector) error) error {
+	conn := c.active()
+	err := fn(conn)
+	if conn == c.Primary && c.unreachable(err) {
+		c.FailOver(err)
+		return fn(c.Secondary)
+	}
+	return err
+}
+
+func (c *Connector) other(conn endpoint.Connector) endpoint.Connector {
+	if conn == c.Primary {
+		return c.Secondary
+	}
+	return c.Primary
+}
+
+func (c *Connector) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *Connector) healthCheckInterval() time.Duration {
+	if c.HealthCheckInterval <= 0 {
+		return DefaultHealthCheckInterval
+	}
+	return c.HealthCheckInterval
+}
+
+func (c *Connector) GetType() endpoint.ConnectorType {
+	return c.active().GetType()
+}
+
+func (c *Connector) SetZone(z string) {
+	c.Primary.SetZone(z)
+	if c.SecondaryZone != "" {
+		z = c.SecondaryZone
+	}
+	c.Secondary.SetZone(z)
+}
+
+func (c *Connector) SetHTTPClient(client *http.Client) {
+	c.Primary.SetHTTPClient(client)
+	c.Secondary.SetHTTPClient(client)
+}
+
+func (c *Connector) Ping() error {
+	return c.do(func(conn endpoint.Connector) error {
+		return conn.Ping()
+	})
+}
+
+func (c *Connector) PingContext(ctx context.Context) error {
+	return c.do(func(conn endpoint.Connector) error {
+		return conn.PingContext(ctx)
+	})
+}
+
+func (c *Connector) Authenticate(auth *endpoint.Authentication) error {
+	return c.active().Authenticate(auth)
+}
+
+func (c *Connector) GetZonesByParent(parent string) ([]string, error) {
+	return c.active().GetZonesByParent(parent)
+}
+
+func (c *Connector) ReadPolicyConfiguration() (p *endpoint.Policy, err error) {
+	err = c.do(func(conn endpoint.Connector) error {
+		p, err = conn.ReadPolicyConfiguration()
+		return err
+	})
+	return
+}
+
+func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration, err error) {
+	err = c.do(func(conn endpoint.Connector) error {
+		config, err = conn.ReadZoneConfiguration()
+		return err
+	})
+	return
+}
+
+func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) error {
+	return c.do(func(conn endpoint.Connector) error {
+		return conn.GenerateRequest(config, req)
+	})
+}
+
+func (c *Connector) RequestCertificate(req *certificate.Request) (requestID string, err error) {
+	var issuer endpoint.Connector
+	err = c.do(func(conn endpoint.Connector) error {
+		issuer = conn
+		requestID, err = conn.RequestCertificate(req)
+		return err
+	})
+	if err == nil {
+		c.mu.Lock()
+		if c.pickups == nil {
+			c.pickups = make(map[string]endpoint.Connector)
+		}
+		c.pickups[requestID] = issuer
+		c.mu.Unlock()
+	}
+	return
+}
+
+// RetrieveCertificate picks up the certificate from the platform it was requested from. When that platform is
+// unreachable, the request is submitted to the other platform and the certificate is picked up there.
+func (c *Connector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	c.mu.Lock()
+	issuer, ok := c.pickups[req.PickupID]
+	c.mu.Unlock()
+	if !ok {
+		issuer = c.active()
+	}
+	pcc, err := issuer.RetrieveCertificate(req)
+	resubmit := len(req.GetCSR()) > 0 || req.CsrOrigin == certificate.ServiceGeneratedCSR
+	if ok && c.unreachable(err) && resubmit {
+		if issuer == c.Primary {
+			c.FailOver(err)
+		}
+		issuer = c.other(issuer)
+		pickupID, err := issuer.RequestCertificate(req)
+		if err != nil {
+			return nil, err
+		}
+		c.forget(req.PickupID)
+		req.PickupID = pickupID
+		return issuer.RetrieveCertificate(req)
+	}
+	if err == nil {
+		c.forget(req.PickupID)
+	}
+	return pcc, err
+}
+
+func (c *Connector) forget(pickupID string) {
+	c.mu.Lock()
+	delete(c.pickups, pickupID)
+	c.mu.Unlock()
+}
+
+func (c *Connector) IsCSRServiceGenerated(req *certificate.Request) (bool, error) {
+	return c.active().IsCSRServiceGenerated(req)
+}
+
+// CancelRequest cancels the request on the platform it was requested from
+func (c *Connector) CancelRequest(pickupID string) error {
+	c.mu.Lock()
+	issuer, ok := c.pickups[pickupID]
+	c.mu.Unlock()
+	if !ok {
+		issuer = c.active()
+	}
+	err := issuer.CancelRequest(pickupID)
+	if err == nil {
+		c.forget(pickupID)
+	}
+	return err
+}
+
+func (c *Connector) RevokeCertificate(req *certificate.RevocationRequest) error {
+	return c.active().RevokeCertificate(req)
+}
+
+func (c *Connector) RenewCertificate(req *certificate.RenewalRequest) (string, error) {
+	return c.active().RenewCertificate(req)
+}
+
+func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certificate.ImportResponse, error) {
+	return c.active().ImportCertificate(req)
+}
+
+func (c *Connector) ListCertificates(filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	return c.active().ListCertificates(filter)
+}
+
+func (c *Connector) SetPolicy(name string, ps *policy.PolicySpecification) (string, error) {
+	return c.active().SetPolicy(name, ps)
+}
+
+func (c *Connector) GetPolicy(name string) (*policy.PolicySpecification, error) {
+	return c.active().GetPolicy(name)
+}
+
+func (c *Connector) RequestSSHCertificate(req *certificate.SshCertRequest) (*certificate.SshCertificateObject, error) {
+	return c.active().RequestSSHCertificate(req)
+}
+
+func (c *Connector) RetrieveSSHCertificate(req *certificate.SshCertRequest) (*certificate.SshCertificateObject, error) {
+	return c.active().RetrieveSSHCertificate(req)
+}
+
+func (c *Connector) RetrieveSshConfig(ca *certificate.SshCaTemplateRequest) (*certificate.SshConfig, error) {
+	return c.active().RetrieveSshConfig(ca)
+}
+
+func (c *Connector) SearchCertificates(req *certificate.SearchRequest) (*certificate.CertSearchResponse, error) {
+	return c.active().SearchCertificates(req)
+}
+
+func (c *Connector) RetrieveAvailableSSHTemplates() ([]certificate.SshAvaliableTemplate, error) {
+	return c.active().RetrieveAvailableSSHTemplates()
+}
+
+func (c *Connector) RetrieveCertificateMetaData(dn string) (*certificate.CertificateMetaData, error) {
+	return c.active().RetrieveCertificateMetaData(dn)
+}
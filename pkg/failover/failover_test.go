@@ -0,0 +1,133 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package failover
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// platform is a fake platform that can be taken down, it counts the certificates it issued
+type platform struct {
+	*fake.Connector
+	down   bool
+	issued int
+}
+
+func (p *platform) err() error {
+	if p.down {
+		return fmt.Errorf("%w: platform is down", verror.ServerUnavailableError)
+	}
+	return nil
+}
+
+func (p *platform) Ping() error {
+	return p.err()
+}
+
+func (p *platform) RequestCertificate(req *certificate.Request) (string, error) {
+	if err := p.err(); err != nil {
+		return "", err
+	}
+	return p.Connector.RequestCertificate(req)
+}
+
+func (p *platform) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	p.issued++
+	return p.Connector.RetrieveCertificate(req)
+}
+
+func newRequest(t *testing.T, c *Connector) *certificate.Request {
+	req := &certificate.Request{}
+	req.Subject.CommonName = "www.example.com"
+	err := c.GenerateRequest(nil, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestFailover(t *testing.T) {
+	primary := &platform{Connector: fake.NewConnector(false, nil)}
+	secondary := &platform{Connector: fake.NewConnector(false, nil)}
+	now := time.Now()
+	var switches []bool
+	c := NewConnector(primary, secondary)
+	c.now = func() time.Time { return now }
+	c.OnSwitch = func(toSecondary bool, cause error) { switches = append(switches, toSecondary) }
+
+	enroll := func() {
+		req := newRequest(t, c)
+		var err error
+		req.PickupID, err = c.RequestCertificate(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.RetrieveCertificate(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	enroll()
+	if primary.issued != 1 || secondary.issued != 0 || c.OnSecondary() {
+		t.Fatalf("primary should issue while it's up: %d/%d", primary.issued, secondary.issued)
+	}
+
+	primary.down = true
+	enroll()
+	if primary.issued != 1 || secondary.issued != 1 || !c.OnSecondary() {
+		t.Fatalf("secondary should issue while primary is down: %d/%d", primary.issued, secondary.issued)
+	}
+
+	primary.down = false
+	enroll()
+	if secondary.issued != 2 {
+		t.Fatal("primary shouldn't be checked before the health check interval")
+	}
+	now = now.Add(DefaultHealthCheckInterval)
+	enroll()
+	if primary.issued != 2 || c.OnSecondary() {
+		t.Fatalf("calls should switch back to the healthy primary: %d/%d", primary.issued, secondary.issued)
+	}
+
+	// the primary becomes unreachable between the request and the pickup
+	req := newRequest(t, c)
+	pickupID, err := c.RequestCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PickupID = pickupID
+	primary.down = true
+	_, err = c.RetrieveCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondary.issued != 3 || len(c.pickups) != 0 {
+		t.Fatalf("request should be submitted again to the secondary: %d/%d", primary.issued, secondary.issued)
+	}
+	if fmt.Sprint(switches) != "[true false true]" {
+		t.Fatalf("unexpected switches %v", switches)
+	}
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package hierarchy models the CA hierarchy issuing the certificates of a zone: the roots, the intermediates, their
+// validity and their keys. Capacity planning tools can then alert when an intermediate is about to expire, which
+// makes every certificate it issued unusable as well.
+package hierarchy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// CA is a certificate authority of the hierarchy
+type CA struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serialNumber"`
+	Thumbprint         string    `json:"thumbprint"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	KeyAlgorithm       string    `json:"keyAlgorithm"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	// Root is set for the self-signed CAs
+	Root bool `json:"root"`
+	// MaxPathLen is the path length constraint of the CA, -1 when there's none
+	MaxPathLen int `json:"maxPathLen"`
+	// Parent is the thumbprint of the issuing CA, it's empty for the roots and when the issuer isn't known
+	Parent string `json:"parent,omitempty"`
+	// Depth is 0 for the roots and the CAs whose issuer isn't known, 1 for the CAs they issued and so on
+	Depth int `json:"depth"`
+
+	Certificate *x509.Certificate `json:"-"`
+}
+
+// ExpiresWithin tells whether the CA expires before now+d
+func (ca *CA) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return ca.NotAfter.Before(now.Add(d))
+}
+
+// Hierarchy is the CAs of a zone, from the roots down
+type Hierarchy struct {
+	CAs []*CA `json:"cas"`
+}
+
+// New builds the hierarchy of certs, the certificates that aren't CAs are ignored and duplicates are merged
+func New(certs []*x509.Certificate) *Hierarchy {
+	h := &Hierarchy{}
+	byThumbprint := map[string]*CA{}
+	for _, c := range certs {
+		if !c.BasicConstraintsValid || !c.IsCA {
+			continue
+		}
+		ca := newCA(c)
+		if _, ok := byThumbprint[ca.Thumbprint]; ok {
+			continue
+		}
+		byThumbprint[ca.Thumbprint] = ca
+		h.CAs = append(h.CAs, ca)
+	}
+	for _, ca := range h.CAs {
+		for _, parent := range h.CAs {
+			if parent == ca || !bytes.Equal(ca.Certificate.RawIssuer, parent.Certificate.RawSubject) {
+				continue
+			}
+			if certificate.CheckSignatureFrom(ca.Certificate, parent.Certificate) == nil {
+				ca.Parent = parent.Thumbprint
+				break
+			}
+		}
+	}
+	for _, ca := range h.CAs {
+		// the number of CAs bounds the depth in case of a cross-signing loop
+		for p := byThumbprint[ca.Parent]; p != nil && ca.Depth < len(h.CAs); p = byThumbprint[p.Parent] {
+			ca.Depth++
+		}
+	}
+	sort.SliceStable(h.CAs, func(i, j int) bool {
+		if h.CAs[i].Depth != h.CAs[j].Depth {
+			return h.CAs[i].Depth < h.CAs[j].Depth
+		}
+		return h.CAs[i].Subject < h.CAs[j].Subject
+	})
+	return h
+}
+
+func newCA(c *x509.Certificate) *CA {
+	sum := sha1.Sum(c.Raw)
+	ca := &CA{
+		Subject:            c.Subject.String(),
+		Issuer:             c.Issuer.String(),
+		SerialNumber:       strings.ToUpper(c.SerialNumber.Text(16)),
+		Thumbprint:         strings.ToUpper(hex.EncodeToString(sum[:])),
+		NotBefore:          c.NotBefore,
+		NotAfter:           c.NotAfter,
+		KeyAlgorithm:       keyAlgorithm(c),
+		SignatureAlgorithm: c.SignatureAlgorithm.String(),
+		MaxPathLen:         -1,
+		Certificate:        c,
+	}
+	if c.MaxPathLen > 0 || c.MaxPathLenZero {
+		ca.MaxPathLen = c.MaxPathLen
+	}
+	ca.Root = bytes.Equal(c.RawIssuer, c.RawSubject) && certificate.CheckSignatureFrom(c, c) == nil
+	return ca
+}
+
+func keyAlgorithm(c *x509.Certificate) string {
+	switch pub := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + pub.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return c.PublicKeyAlgorithm.String()
+}
+
+// Expiring returns the CAs expiring before now+d
+func (h *Hierarchy) Expiring(now time.Time, d time.Duration) []*CA {
+	var expiring []*CA
+	for _, ca := range h.CAs {
+		if ca.ExpiresWithin(now, d) {
+			expiring = append(expiring, ca)
+		}
+	}
+	return expiring
+}
+
+// Retrieve builds the hierarchy of the CAs issuing the certificates of the connector's zone from their chains. The
+// chain of the latest valid certificate of each issuer is retrieved, so all the intermediates of a zone issuing
+// from several of them are found, as long as the platform tells the issuers in its listings.
+func Retrieve(conn endpoint.Connector) (*Hierarchy, error) {
+	infos, err := conn.ListCertificates(endpoint.Filter{})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	latest := map[string]certificate.CertificateInfo{}
+	for _, info := range infos {
+		if info.Thumbprint == "" || !info.ValidTo.IsZero() && info.ValidTo.Before(now) {
+			continue
+		}
+		if l, ok := latest[info.Issuer]; !ok || info.ValidFrom.After(l.ValidFrom) {
+			latest[info.Issuer] = info
+		}
+	}
+	if len(latest) == 0 {
+		return nil, fmt.Errorf("%w: the zone has no valid certificate to read the CA chain from", verror.UserDataError)
+	}
+	var certs []*x509.Certificate
+	for _, info := range latest {
+		pcc, err := conn.RetrieveCertificate(&certificate.Request{Thumbprint: info.Thumbprint, ChainOption: certificate.ChainOptionRootLast})
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve certificate %s: %w", info.ID, err)
+		}
+		for _, p := range pcc.Chain {
+			c, err := parsePEM(p)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse the chain of certificate %s: %w", info.ID, err)
+			}
+			certs = append(certs, c...)
+		}
+	}
+	return New(certs), nil
+}
+
+func parsePEM(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := certificate.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+}
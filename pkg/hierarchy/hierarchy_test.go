@@ -0,0 +1,171 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hierarchy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+type issued struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func issue(t *testing.T, cn string, ca bool, key crypto.Signer, notAfter time.Time, parent *issued) *issued {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+	}
+	if ca {
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		template.DNSNames = []string{cn}
+	}
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &issued{cert: cert, key: key}
+}
+
+func ecKey(t *testing.T) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func toPEM(c *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+}
+
+func TestNew(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := issue(t, "Root CA", true, rsaKey, time.Now().Add(10*365*24*time.Hour), nil)
+	intermediate := issue(t, "Issuing CA", true, ecKey(t), time.Now().Add(20*24*time.Hour), root)
+	leaf := issue(t, "leaf.example.com", false, ecKey(t), time.Now().Add(10*24*time.Hour), intermediate)
+
+	h := New([]*x509.Certificate{leaf.cert, intermediate.cert, root.cert, intermediate.cert})
+	if len(h.CAs) != 2 {
+		t.Fatalf("expected 2 CAs, got %d", len(h.CAs))
+	}
+	r, i := h.CAs[0], h.CAs[1]
+	if r.Subject != "CN=Root CA" || !r.Root || r.Depth != 0 || r.Parent != "" || r.KeyAlgorithm != "RSA 2048" {
+		t.Errorf("unexpected root %+v", r)
+	}
+	if i.Subject != "CN=Issuing CA" || i.Root || i.Depth != 1 || i.Parent != r.Thumbprint || i.KeyAlgorithm != "ECDSA P-384" {
+		t.Errorf("unexpected intermediate %+v", i)
+	}
+	if i.MaxPathLen != -1 {
+		t.Errorf("expected no path length constraint, got %d", i.MaxPathLen)
+	}
+
+	expiring := h.Expiring(time.Now(), 30*24*time.Hour)
+	if len(expiring) != 1 || expiring[0] != i {
+		t.Errorf("expected the intermediate to expire within 30 days, got %v", expiring)
+	}
+	if expiring := h.Expiring(time.Now(), 24*time.Hour); len(expiring) != 0 {
+		t.Errorf("expected no CA to expire within a day, got %v", expiring)
+	}
+}
+
+func TestNewUnknownIssuer(t *testing.T) {
+	root := issue(t, "Root CA", true, ecKey(t), time.Now().Add(time.Hour), nil)
+	intermediate := issue(t, "Issuing CA", true, ecKey(t), time.Now().Add(time.Hour), root)
+	h := New([]*x509.Certificate{intermediate.cert})
+	if len(h.CAs) != 1 || h.CAs[0].Root || h.CAs[0].Parent != "" || h.CAs[0].Depth != 0 {
+		t.Errorf("unexpected hierarchy %+v", h.CAs)
+	}
+}
+
+// chainConnector lists certificates whose chains it returns
+type chainConnector struct {
+	*fake.Connector
+	infos  []certificate.CertificateInfo
+	chains map[string][]string
+}
+
+func (c *chainConnector) ListCertificates(endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	return c.infos, nil
+}
+
+func (c *chainConnector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	return &certificate.PEMCollection{Chain: c.chains[req.Thumbprint]}, nil
+}
+
+func TestRetrieve(t *testing.T) {
+	root := issue(t, "Root CA", true, ecKey(t), time.Now().Add(time.Hour), nil)
+	first := issue(t, "First CA", true, ecKey(t), time.Now().Add(time.Hour), root)
+	second := issue(t, "Second CA", true, ecKey(t), time.Now().Add(time.Hour), root)
+	conn := &chainConnector{
+		Connector: fake.NewConnector(true, nil),
+		infos: []certificate.CertificateInfo{
+			{ID: "1", Thumbprint: "T1", Issuer: "CN=First CA", ValidFrom: time.Now().Add(-time.Hour), ValidTo: time.Now().Add(time.Hour)},
+			{ID: "2", Thumbprint: "T2", Issuer: "CN=Second CA", ValidFrom: time.Now().Add(-time.Hour), ValidTo: time.Now().Add(time.Hour)},
+			{ID: "3", Thumbprint: "T3", Issuer: "CN=Gone CA", ValidTo: time.Now().Add(-time.Hour)},
+		},
+		chains: map[string][]string{
+			"T1": {toPEM(first.cert), toPEM(root.cert)},
+			"T2": {toPEM(second.cert), toPEM(root.cert)},
+		},
+	}
+	h, err := Retrieve(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.CAs) != 3 || h.CAs[0].Subject != "CN=Root CA" || h.CAs[1].Subject != "CN=First CA" || h.CAs[2].Subject != "CN=Second CA" {
+		t.Fatalf("unexpected hierarchy %+v", h.CAs)
+	}
+
+	conn.infos = conn.infos[2:]
+	if _, err := Retrieve(conn); !errors.Is(err, verror.UserDataError) {
+		t.Errorf("expected a user data error without valid certificates, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package hmacauth authenticates HTTP requests with an HMAC-SHA256 signature of their method, URI, timestamp, nonce
+// and body, keyed with a secret shared by the sender and the receiver. It's meant for the internal consumers of the
+// notifications and signals of vcert where mutual TLS can't be deployed. A request is accepted once: its timestamp
+// must be recent, and its nonce is remembered until the timestamp would be too old anyway.
+package hmacauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// The headers of a signed request. The signature is "sha256=<hex>".
+const (
+	TimestampHeader = "X-Vcert-Timestamp"
+	NonceHeader     = "X-Vcert-Nonce"
+	SignatureHeader = "X-Vcert-Signature"
+)
+
+const (
+	// DefaultMaxSkew is how far the timestamp of a request may be from the clock of the receiver
+	DefaultMaxSkew = 5 * time.Minute
+	// DefaultMaxNonces bounds the nonces remembered by a Verifier
+	DefaultMaxNonces = 100000
+
+	signaturePrefix = "sha256="
+	nonceSize       = 16
+	maxNonceLength  = 128
+	maxBodySize     = 1 << 20
+)
+
+// Sign sets the headers authenticating req with secret, body is the body of req
+func Sign(req *http.Request, body, secret []byte) error {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	n := hex.EncodeToString(nonce)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(NonceHeader, n)
+	req.Header.Set(SignatureHeader, signature(secret, req.Method, req.URL.RequestURI(), timestamp, n, body))
+	return nil
+}
+
+// signature is the HMAC of the lines of the method, the URI, the timestamp, the nonce and the SHA-256 of the body
+func signature(secret []byte, method, uri, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%x", method, uri, timestamp, nonce, sum)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Transport signs the requests it sends with Secret
+type Transport struct {
+	Secret []byte
+	// Base sends the requests, http.DefaultTransport does when it's nil
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// a RoundTripper must not modify the request it's given
+	r := req.Clone(req.Context())
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if err := Sign(r, body, t.Secret); err != nil {
+		return nil, err
+	}
+	return base.RoundTrip(r)
+}
+
+// Verifier checks the signed requests and rejects the replayed ones. It's safe for concurrent use.
+type Verifier struct {
+	Secret []byte
+	// MaxSkew is how far the timestamp of a request may be from the clock, DefaultMaxSkew when it's zero
+	MaxSkew time.Duration
+	// MaxNonces bounds the nonces remembered, DefaultMaxNonces when it's zero. The requests are refused while it's
+	// reached, until the oldest nonces expire.
+	MaxNonces int
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	now    func() time.Time
+}
+
+// Verify checks the signature of req, whose body is body, and that it isn't a replay
+func (v *Verifier) Verify(req *http.Request, body []byte) error {
+	if len(v.Secret) == 0 {
+		return fmt.Errorf("%w: no secret to verify signatures", verror.AuthError)
+	}
+	timestamp, nonce := req.Header.Get(TimestampHeader), req.Header.Get(NonceHeader)
+	if timestamp == "" || nonce == "" || len(nonce) > maxNonceLength {
+		return fmt.Errorf("%w: missing or invalid timestamp and nonce", verror.AuthError)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", verror.AuthError, timestamp)
+	}
+	now := v.clock()
+	skew := v.maxSkew()
+	t := time.Unix(seconds, 0)
+	if t.Before(now.Add(-skew)) || t.After(now.Add(skew)) {
+		return fmt.Errorf("%w: timestamp %s is more than %s away from the clock", verror.AuthError, t.UTC().Format(time.RFC3339), skew)
+	}
+	expected := signature(v.Secret, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get(SignatureHeader))) {
+		return fmt.Errorf("%w: bad signature", verror.AuthError)
+	}
+	// the nonces are only remembered for the requests signed with the secret, which the senders can't flood
+	return v.remember(nonce, t.Add(skew), now)
+}
+
+// remember records nonce until expiry, it fails when the nonce was already seen
+func (v *Verifier) remember(nonce string, expiry, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.nonces == nil {
+		v.nonces = make(map[string]time.Time)
+	}
+	if e, ok := v.nonces[nonce]; ok && e.After(now) {
+		return fmt.Errorf("%w: replayed request, nonce %s was already used", verror.AuthError, nonce)
+	}
+	max := v.MaxNonces
+	if max <= 0 {
+		max = DefaultMaxNonces
+	}
+	if len(v.nonces) >= max {
+		for n, e := range v.nonces {
+			if !e.After(now) {
+				delete(v.nonces, n)
+			}
+		}
+		if len(v.nonces) >= max {
+			return fmt.Errorf("%w: too many recent requests to detect the replays", verror.ServerTemporaryUnavailableError)
+		}
+	}
+	v.nonces[nonce] = expiry
+	return nil
+}
+
+func (v *Verifier) maxSkew() time.Duration {
+	if v.MaxSkew > 0 {
+		return v.MaxSkew
+	}
+	return DefaultMaxSkew
+}
+
+func (v *Verifier) clock() time.Time {
+	if v.now != nil {
+		return v.now()
+	}
+	return time.Now()
+}
+
+// Handler serves the requests verified by v with next, the other ones are answered with 401 Unauthorized, or 503
+// Service Unavailable when the nonces can't be remembered. The body given to next is the one verified.
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		err = v.Verify(r, body)
+		switch {
+		case err == nil:
+		case errors.Is(err, verror.ServerTemporaryUnavailableError):
+			http.Error(w, "too many requests", http.StatusServiceUnavailable)
+			return
+		default:
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
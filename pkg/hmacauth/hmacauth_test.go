@@ -0,0 +1,128 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hmacauth
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func signedRequest(t *testing.T, secret []byte, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/hooks/renewed?env=prod", bytes.NewBufferString(body))
+	if err := Sign(req, []byte(body), secret); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestVerify(t *testing.T) {
+	secret, body := []byte("secret"), `{"event":"certificate.issued"}`
+	v := &Verifier{Secret: secret}
+	req := signedRequest(t, secret, body)
+	if err := v.Verify(req, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(req, []byte(body)); !errors.Is(err, verror.AuthError) {
+		t.Fatalf("expected the replay to be rejected, got %v", err)
+	}
+
+	cases := map[string]func(r *http.Request) []byte{
+		"tampered body": func(r *http.Request) []byte { return []byte(`{"event":"certificate.expiring"}`) },
+		"other secret": func(r *http.Request) []byte {
+			*r = *signedRequest(t, []byte("other"), body)
+			return []byte(body)
+		},
+		"other path": func(r *http.Request) []byte {
+			r.URL.Path = "/hooks/revoked"
+			return []byte(body)
+		},
+		"old timestamp": func(r *http.Request) []byte {
+			r.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+			return []byte(body)
+		},
+		"no nonce": func(r *http.Request) []byte {
+			r.Header.Del(NonceHeader)
+			return []byte(body)
+		},
+	}
+	for name, tamper := range cases {
+		req := signedRequest(t, secret, body)
+		b := tamper(req)
+		if err := v.Verify(req, b); !errors.Is(err, verror.AuthError) {
+			t.Errorf("%s: expected an authentication error, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifierNonces(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	v := &Verifier{Secret: secret, MaxNonces: 2, MaxSkew: time.Minute, now: func() time.Time { return now }}
+	for i := 0; i < 2; i++ {
+		if err := v.Verify(signedRequest(t, secret, ""), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.Verify(signedRequest(t, secret, ""), nil); !errors.Is(err, verror.ServerTemporaryUnavailableError) {
+		t.Fatalf("expected the request to be refused while the nonces are remembered, got %v", err)
+	}
+	// the nonces are forgotten once their timestamps are too old to be accepted
+	now = now.Add(2 * time.Minute)
+	req := signedRequest(t, secret, "")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, signature(secret, req.Method, req.URL.RequestURI(), req.Header.Get(TimestampHeader), req.Header.Get(NonceHeader), nil))
+	if err := v.Verify(req, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransportAndHandler(t *testing.T) {
+	secret := []byte("secret")
+	var received string
+	srv := httptest.NewServer((&Verifier{Secret: secret}).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received = string(b)
+	})))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Secret: secret}}
+	resp, err := client.Post(srv.URL+"/signal", "application/json", bytes.NewBufferString(`{"task":"web"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || received != `{"task":"web"}` {
+		t.Fatalf("unexpected status %s with body %q", resp.Status, received)
+	}
+
+	resp, err = http.Post(srv.URL+"/signal", "application/json", bytes.NewBufferString(`{"task":"web"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an unsigned request to be rejected, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package httpdump writes the HTTP exchanges of a connector to files, for supportability when diagnosing failures
+// on the platform side. Credentials, passwords and private keys are redacted before anything is written.
+package httpdump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted replaces the sensitive values
+const Redacted = "[REDACTED]"
+
+// sensitiveHeaders are the headers holding credentials, in canonical form
+var sensitiveHeaders = map[string]bool{
+	"Authorization":    true,
+	"Cookie":           true,
+	"Set-Cookie":       true,
+	"Tppl-Api-Key":     true,
+	"X-Venafi-Api-Key": true,
+}
+
+// sensitiveNames are parts of the JSON keys and query parameters whose values are redacted, compared in lower case
+// without separators
+var sensitiveNames = []string{"password", "passphrase", "token", "secret", "apikey", "privatekey", "keystore", "pkcs12"}
+
+var privateKeyPEM = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+
+// Dumper writes each exchange as a JSON file in Dir. The files are named after the time of the request and a
+// sequence number so they sort in the order the requests were made.
+type Dumper struct {
+	Dir string
+	// Gzip compresses the files
+	Gzip bool
+
+	seq uint64
+	now func() time.Time
+}
+
+// Exchange is the content of a dump file
+type Exchange struct {
+	Time     time.Time `json:"time"`
+	Duration string    `json:"duration"`
+	Request  Message   `json:"request"`
+	Response *Message  `json:"response,omitempty"`
+	// Error is set when no response was received
+	Error string `json:"error,omitempty"`
+}
+
+// Message is a request or a response. Body is a string for text content, and is base64 encoded otherwise.
+type Message struct {
+	Method  string              `json:"method,omitempty"`
+	URL     string              `json:"url,omitempty"`
+	Status  string              `json:"status,omitempty"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    interface{}         `json:"body,omitempty"`
+}
+
+// Wrap returns a RoundTripper that dumps the exchanges going through rt, http.DefaultTransport when rt is nil
+func (d *Dumper) Wrap(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{base: rt, dumper: d}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	dumper *Dumper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := t.dumper.clock()
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := t.base.RoundTrip(req)
+	x := &Exchange{
+		Time: start.UTC(),
+		Request: Message{
+			Method:  req.Method,
+			URL:     redactURL(req.URL),
+			Headers: redactHeaders(req.Header),
+			Body:    redactBody(req.Header.Get("Content-Type"), reqBody),
+		},
+	}
+	if err != nil {
+		x.Error = err.Error()
+	} else {
+		var respBody []byte
+		respBody, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+		if err != nil {
+			return nil, err
+		}
+		x.Response = &Message{
+			Status:  resp.Status,
+			Headers: redactHeaders(resp.Header),
+			Body:    redactBody(resp.Header.Get("Content-Type"), respBody),
+		}
+	}
+	x.Duration = t.dumper.clock().Sub(start).String()
+	// a dump that can't be written must not fail the call it describes
+	_ = t.dumper.write(x)
+	return resp, err
+}
+
+func (d *Dumper) write(x *Exchange) error {
+	seq := atomic.AddUint64(&d.seq, 1)
+	name := fmt.Sprintf("%s-%04d-%s.json", x.Time.Format("20060102T150405.000000Z"), seq, strings.ToLower(x.Request.Method))
+	data, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	if d.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Name = name
+		if _, err = zw.Write(data); err != nil {
+			return err
+		}
+		if err = zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+		name += ".gz"
+	}
+	return ioutil.WriteFile(filepath.Join(d.Dir, name), data, 0600)
+}
+
+func (d *Dumper) clock() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+// Prepare creates Dir when it doesn't exist
+func (d *Dumper) Prepare() error {
+	return os.MkdirAll(d.Dir, 0700)
+}
+
+func isSensitive(name string) bool {
+	n := strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(name))
+	for _, s := range sensitiveNames {
+		if strings.Contains(n, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeaders(h http.Header) map[string][]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = []string{Redacted}
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func redactURL(u *url.URL) string {
+	c := *u
+	c.User = nil
+	q := c.Query()
+	redacted := false
+	for k := range q {
+		if isSensitive(k) {
+			q.Set(k, Redacted)
+			redacted = true
+		}
+	}
+	if redacted {
+		c.RawQuery = q.Encode()
+	}
+	return c.String()
+}
+
+func redactBody(contentType string, body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	if strings.Contains(contentType, "json") || json.Valid(body) {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err == nil {
+			return redactJSON(v)
+		}
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if q, err := url.ParseQuery(string(body)); err == nil {
+			for k := range q {
+				if isSensitive(k) {
+					q.Set(k, Redacted)
+				}
+			}
+			return q.Encode()
+		}
+	}
+	if !utf8.Valid(body) {
+		// binary content, e.g. a PKCS#12 keystore, is left out entirely
+		return fmt.Sprintf("%s %d bytes of binary content", Redacted, len(body))
+	}
+	return privateKeyPEM.ReplaceAllString(string(body), Redacted)
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if isSensitive(k) && child != nil {
+				if _, isObject := child.(map[string]interface{}); !isObject {
+					t[k] = Redacted
+					continue
+				}
+			}
+			t[k] = redactJSON(child)
+		}
+		return t
+	case []interface{}:
+		for i, child := range t {
+			t[i] = redactJSON(child)
+		}
+		return t
+	case string:
+		return privateKeyPEM.ReplaceAllString(t, Redacted)
+	}
+	return v
+}
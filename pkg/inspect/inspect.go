@@ -0,0 +1,552 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package inspect decodes the certificates, certificate requests and private keys of a file, whether it's PEM, DER,
+// PKCS#7, PKCS#12 or a Java keystore, and describes them: subject, SANs, key usages, key, validity and how the certificates of the
+// file chain to each other. The descriptions are printed by vcert inspect, and the certificates and requests can also
+// be printed like openssl x509 -text and openssl req -text do.
+package inspect
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/youmark/pkcs8"
+	"golang.org/x/crypto/ssh"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// The formats of the decoded files
+const (
+	FormatPEM    = "PEM"
+	FormatDER    = "DER"
+	FormatPKCS7  = "PKCS#7"
+	FormatPKCS12 = "PKCS#12"
+	FormatJKS    = "JKS"
+)
+
+// The roles of a certificate in its chain
+const (
+	RoleLeaf         = "leaf"
+	RoleIntermediate = "intermediate"
+	RoleRoot         = "root"
+)
+
+// Contents are the objects decoded from a file
+type Contents struct {
+	Format       string
+	Certificates []*x509.Certificate
+	Requests     []*x509.CertificateRequest
+	Keys         []*PrivateKey
+}
+
+// PrivateKey is a decoded private key. The key of an encrypted private key that wasn't decrypted is nil.
+type PrivateKey struct {
+	Key       crypto.Signer
+	Encrypted bool
+}
+
+// Decode decodes the certificates, certificate requests and private keys of data. The encrypted private keys, the
+// PKCS#12 files and the Java keystores are decrypted with password.
+func Decode(data []byte, password string) (*Contents, error) {
+	var c *Contents
+	var err error
+	switch {
+	case bytes.HasPrefix(data, jksMagic):
+		c, err = decodeJKS(data, password)
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		c, err = decodePEM(data, password)
+	default:
+		c, err = decodeDER(data, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Certificates) == 0 && len(c.Requests) == 0 && len(c.Keys) == 0 {
+		return nil, fmt.Errorf("%w: no certificate, certificate request or private key found", verror.UserDataError)
+	}
+	return c, nil
+}
+
+func decodePEM(data []byte, password string) (*Contents, error) {
+	c := &Contents{Format: FormatPEM}
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	return c, c.addBlocks(blocks, password)
+}
+
+func (c *Contents) addBlocks(blocks []*pem.Block, password string) error {
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("%w: can't read the certificate: %s", verror.UserDataError, err)
+			}
+			c.Certificates = append(c.Certificates, cert)
+		case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+			req, err := x509.ParseCertificateRequest(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("%w: can't read the certificate request: %s", verror.UserDataError, err)
+			}
+			c.Requests = append(c.Requests, req)
+		case "PKCS7":
+			certs, err := ParsePKCS7(block.Bytes)
+			if err != nil {
+				return err
+			}
+			c.Certificates = append(c.Certificates, certs...)
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+			key, err := decodePrivateKey(block, password)
+			if err != nil {
+				return err
+			}
+			c.Keys = append(c.Keys, key)
+		case "OPENSSH PRIVATE KEY":
+			key, err := decodeOpenSSHPrivateKey(block, password)
+			if err != nil {
+				return err
+			}
+			c.Keys = append(c.Keys, key)
+		}
+	}
+	return nil
+}
+
+func decodeDER(data []byte, password string) (*Contents, error) {
+	if certs, err := x509.ParseCertificates(data); err == nil && len(certs) > 0 {
+		return &Contents{Format: FormatDER, Certificates: certs}, nil
+	}
+	if req, err := x509.ParseCertificateRequest(data); err == nil {
+		return &Contents{Format: FormatDER, Requests: []*x509.CertificateRequest{req}}, nil
+	}
+	if certs, err := ParsePKCS7(data); err == nil {
+		return &Contents{Format: FormatPKCS7, Certificates: certs}, nil
+	}
+	if key, err := parsePrivateKey(data); err == nil {
+		return &Contents{Format: FormatDER, Keys: []*PrivateKey{{Key: key}}}, nil
+	}
+	blocks, err := pkcs12.ToPEM(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, fmt.Errorf("%w: wrong password for the PKCS#12 file", verror.UserDataError)
+	}
+	if err != nil && password != "" {
+		// an encrypted PKCS#8 private key
+		if key, err := decodePrivateKey(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: data}, password); err == nil {
+			return &Contents{Format: FormatDER, Keys: []*PrivateKey{key}}, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown format, expected PEM, DER, PKCS#7 or PKCS#12", verror.UserDataError)
+	}
+	c := &Contents{Format: FormatPKCS12}
+	err = c.addBlocks(blocks, password)
+	// the keys of a PKCS#12 file are encrypted by its password
+	for _, key := range c.Keys {
+		key.Encrypted = true
+	}
+	return c, err
+}
+
+// decodePrivateKey decodes the private key of block, decrypting it with password. An encrypted private key is
+// returned without its key when there's no password.
+func decodePrivateKey(block *pem.Block, password string) (*PrivateKey, error) {
+	// nolint:staticcheck // the legacy encryption of OpenSSL is still found in the wild
+	legacy := x509.IsEncryptedPEMBlock(block)
+	if block.Type != "ENCRYPTED PRIVATE KEY" && !legacy {
+		key, err := parsePrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &PrivateKey{Key: key}, nil
+	}
+	if password == "" {
+		return &PrivateKey{Encrypted: true}, nil
+	}
+	var key interface{}
+	var err error
+	if legacy {
+		var der []byte
+		// nolint:staticcheck
+		der, err = x509.DecryptPEMBlock(block, []byte(password))
+		if err == nil {
+			key, err = parsePrivateKey(der)
+		}
+	} else {
+		key, err = pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't decrypt the private key: %s", verror.UserDataError, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported private key %T", verror.UserDataError, key)
+	}
+	return &PrivateKey{Key: signer, Encrypted: true}, nil
+}
+
+// decodeOpenSSHPrivateKey decodes a private key written by ssh-keygen, decrypting it with password. An encrypted
+// private key is returned without its key when there's no password.
+func decodeOpenSSHPrivateKey(block *pem.Block, password string) (*PrivateKey, error) {
+	data := pem.EncodeToMemory(block)
+	key, err := ssh.ParseRawPrivateKey(data)
+	encrypted := false
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if password == "" {
+			return &PrivateKey{Encrypted: true}, nil
+		}
+		encrypted = true
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, []byte(password))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read the OpenSSH private key: %s", verror.UserDataError, err)
+	}
+	// the Ed25519 keys are returned by reference
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		key = *k
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported private key %T", verror.UserDataError, key)
+	}
+	return &PrivateKey{Key: signer, Encrypted: encrypted}, nil
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("%w: unsupported private key %T", verror.UserDataError, key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: can't read the private key", verror.UserDataError)
+}
+
+// Chain returns the certificates from the leaf up to its root. The leaf is the certificate of the first private key
+// with one, or else the first certificate that issued none of the others. The certificates outside of the chain of the
+// leaf follow it.
+func (c *Contents) Chain() []*x509.Certificate {
+	if len(c.Certificates) == 0 {
+		return nil
+	}
+	leaf := -1
+	for _, key := range c.Keys {
+		for i, cert := range c.Certificates {
+			if leaf < 0 && key.Key != nil && samePublicKey(key.Key.Public(), cert.PublicKey) {
+				leaf = i
+			}
+		}
+	}
+	for i := 0; leaf < 0 && i < len(c.Certificates); i++ {
+		issuer := false
+		for j, cert := range c.Certificates {
+			issuer = issuer || i != j && issuedBy(cert, c.Certificates[i])
+		}
+		if !issuer {
+			leaf = i
+		}
+	}
+	if leaf < 0 {
+		leaf = 0
+	}
+	used := make([]bool, len(c.Certificates))
+	used[leaf] = true
+	chain := []*x509.Certificate{c.Certificates[leaf]}
+	for next := true; next; {
+		next = false
+		last := chain[len(chain)-1]
+		for i, cert := range c.Certificates {
+			if !used[i] && issuedBy(last, cert) {
+				used[i], next = true, true
+				chain = append(chain, cert)
+				break
+			}
+		}
+	}
+	for i, cert := range c.Certificates {
+		if !used[i] {
+			chain = append(chain, cert)
+		}
+	}
+	return chain
+}
+
+// issuedBy reports whether cert was signed by issuer
+func issuedBy(cert, issuer *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, issuer.RawSubject) && certificate.CheckSignatureFrom(cert, issuer) == nil
+}
+
+// Report describes the contents of a file
+type Report struct {
+	Format       string         `json:"format"`
+	Certificates []*Certificate `json:"certificates,omitempty"`
+	Requests     []*Request     `json:"requests,omitempty"`
+	Keys         []*Key         `json:"keys,omitempty"`
+}
+
+// PublicKey describes a public key
+type PublicKey struct {
+	Algorithm string `json:"algorithm"`
+	Size      int    `json:"size,omitempty"`
+	Curve     string `json:"curve,omitempty"`
+}
+
+func (k PublicKey) String() string {
+	switch {
+	case k.Curve != "":
+		return k.Algorithm + " " + k.Curve
+	case k.Size > 0:
+		return fmt.Sprintf("%s %d", k.Algorithm, k.Size)
+	}
+	return k.Algorithm
+}
+
+// SANs are the subject alternative names of a certificate or a request
+type SANs struct {
+	DNSNames       []string `json:"dnsNames,omitempty"`
+	IPAddresses    []string `json:"ipAddresses,omitempty"`
+	EmailAddresses []string `json:"emailAddresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+}
+
+// Certificate describes a certificate
+type Certificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	// DaysRemaining is the number of days until the certificate expires, negative once it's expired
+	DaysRemaining int  `json:"daysRemaining"`
+	Expired       bool `json:"expired"`
+	SANs
+	KeyUsages          []string  `json:"keyUsages,omitempty"`
+	ExtKeyUsages       []string  `json:"extKeyUsages,omitempty"`
+	IsCA               bool      `json:"isCA"`
+	PublicKey          PublicKey `json:"publicKey"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	SubjectKeyID       string    `json:"subjectKeyId,omitempty"`
+	AuthorityKeyID     string    `json:"authorityKeyId,omitempty"`
+	Thumbprint         string    `json:"thumbprint"`
+	SHA256Fingerprint  string    `json:"sha256Fingerprint"`
+	// Role is leaf, intermediate or root
+	Role string `json:"role"`
+	// IssuedBy is the index in the file of the certificate that signed this one, it's nil for the roots and when the
+	// issuer isn't in the file
+	IssuedBy *int `json:"issuedBy,omitempty"`
+}
+
+// Request describes a certificate request
+type Request struct {
+	Subject string `json:"subject"`
+	SANs
+	KeyUsages          []string  `json:"keyUsages,omitempty"`
+	ExtKeyUsages       []string  `json:"extKeyUsages,omitempty"`
+	PublicKey          PublicKey `json:"publicKey"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	// SignatureValid is set when the request is signed by the private key of its public key
+	SignatureValid bool `json:"signatureValid"`
+}
+
+// Key describes a private key
+type Key struct {
+	Encrypted bool       `json:"encrypted"`
+	PublicKey *PublicKey `json:"publicKey,omitempty"`
+	// Certificate is the index in the file of the first certificate of the key
+	Certificate *int `json:"certificate,omitempty"`
+	// Request is the index in the file of the first certificate request of the key
+	Request *int `json:"request,omitempty"`
+}
+
+// Describe describes the contents of the file at now
+func (c *Contents) Describe(now time.Time) *Report {
+	r := &Report{Format: c.Format}
+	for _, cert := range c.Certificates {
+		r.Certificates = append(r.Certificates, c.describeCertificate(cert, now))
+	}
+	for _, req := range c.Requests {
+		r.Requests = append(r.Requests, describeRequest(req))
+	}
+	for _, key := range c.Keys {
+		r.Keys = append(r.Keys, c.describeKey(key))
+	}
+	return r
+}
+
+func (c *Contents) describeCertificate(cert *x509.Certificate, now time.Time) *Certificate {
+	sha1Sum := sha1.Sum(cert.Raw)
+	sha256Sum := sha256.Sum256(cert.Raw)
+	d := &Certificate{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       colonHex(cert.SerialNumber.Bytes()),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DaysRemaining:      int(cert.NotAfter.Sub(now).Hours() / 24),
+		Expired:            now.After(cert.NotAfter),
+		SANs:               describeSANs(cert.DNSNames, cert.IPAddresses, cert.EmailAddresses, cert.URIs),
+		KeyUsages:          keyUsageNames(cert.KeyUsage),
+		IsCA:               cert.BasicConstraintsValid && cert.IsCA,
+		PublicKey:          describePublicKey(cert.PublicKey),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SubjectKeyID:       colonHex(cert.SubjectKeyId),
+		AuthorityKeyID:     colonHex(cert.AuthorityKeyId),
+		Thumbprint:         strings.ToUpper(hex.EncodeToString(sha1Sum[:])),
+		SHA256Fingerprint:  strings.ToUpper(hex.EncodeToString(sha256Sum[:])),
+		Role:               RoleLeaf,
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		d.ExtKeyUsages = append(d.ExtKeyUsages, extKeyUsageName(eku))
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		d.ExtKeyUsages = append(d.ExtKeyUsages, oid.String())
+	}
+	if d.IsCA {
+		d.Role = RoleIntermediate
+	}
+	if issuedBy(cert, cert) {
+		d.Role = RoleRoot
+		return d
+	}
+	for i, issuer := range c.Certificates {
+		if issuer != cert && issuedBy(cert, issuer) {
+			i := i
+			d.IssuedBy = &i
+			break
+		}
+	}
+	return d
+}
+
+func describeRequest(req *x509.CertificateRequest) *Request {
+	d := &Request{
+		Subject:            req.Subject.String(),
+		SANs:               describeSANs(req.DNSNames, req.IPAddresses, req.EmailAddresses, req.URIs),
+		PublicKey:          describePublicKey(req.PublicKey),
+		SignatureAlgorithm: req.SignatureAlgorithm.String(),
+		SignatureValid:     req.CheckSignature() == nil,
+	}
+	for _, ext := range req.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			if usage, err := parseKeyUsage(ext.Value); err == nil {
+				d.KeyUsages = keyUsageNames(usage)
+			}
+		case ext.Id.Equal(oidExtensionExtKeyUsage):
+			if oids, err := parseExtKeyUsage(ext.Value); err == nil {
+				for _, oid := range oids {
+					d.ExtKeyUsages = append(d.ExtKeyUsages, extKeyUsageOIDName(oid, false))
+				}
+			}
+		}
+	}
+	return d
+}
+
+func (c *Contents) describeKey(key *PrivateKey) *Key {
+	d := &Key{Encrypted: key.Encrypted}
+	if key.Key == nil {
+		return d
+	}
+	pub := describePublicKey(key.Key.Public())
+	d.PublicKey = &pub
+	for i, cert := range c.Certificates {
+		if samePublicKey(key.Key.Public(), cert.PublicKey) {
+			i := i
+			d.Certificate = &i
+			break
+		}
+	}
+	for i, req := range c.Requests {
+		if samePublicKey(key.Key.Public(), req.PublicKey) {
+			i := i
+			d.Request = &i
+			break
+		}
+	}
+	return d
+}
+
+func samePublicKey(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+func describePublicKey(pub crypto.PublicKey) PublicKey {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return PublicKey{Algorithm: "RSA", Size: pub.N.BitLen()}
+	case *ecdsa.PublicKey:
+		return PublicKey{Algorithm: "ECDSA", Size: pub.Curve.Params().BitSize, Curve: pub.Curve.Params().Name}
+	case ed25519.PublicKey:
+		return PublicKey{Algorithm: "Ed25519"}
+	}
+	return PublicKey{Algorithm: fmt.Sprintf("%T", pub)}
+}
+
+func describeSANs(dnsNames []string, ips []net.IP, emails []string, uris []*url.URL) SANs {
+	s := SANs{DNSNames: dnsNames, EmailAddresses: emails}
+	for _, ip := range ips {
+		s.IPAddresses = append(s.IPAddresses, ip.String())
+	}
+	for _, uri := range uris {
+		s.URIs = append(s.URIs, uri.String())
+	}
+	return s
+}
+
+// colonHex prints b like OpenSSL prints serial numbers and key identifiers
+func colonHex(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	s := make([]string, len(b))
+	for i, v := range b {
+		s[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(s, ":")
+}
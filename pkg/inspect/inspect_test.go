@@ -0,0 +1,351 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavel-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/util"
+)
+
+type testChain struct {
+	root, leaf       *x509.Certificate
+	rootKey, leafKey *ecdsa.PrivateKey
+}
+
+func newTestChain(t *testing.T) *testChain {
+	c := &testChain{}
+	var err error
+	c.rootKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.leafKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root", Organization: []string{"Acme"}},
+		NotBefore:             now,
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, root, root, c.rootKey.Public(), c.rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.root, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: new(big.Int).Lsh(big.NewInt(1), 100),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		NotBefore:    now,
+		NotAfter:     now.AddDate(0, 0, 90),
+		DNSNames:     []string{"www.example.com", "example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err = x509.CreateCertificate(rand.Reader, leaf, c.root, c.leafKey.Public(), c.rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDecode(t *testing.T) {
+	c := newTestChain(t)
+	keyDER, err := x509.MarshalECPrivateKey(c.leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.leaf.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.root.Raw})...)
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	p7, err := MarshalPKCS7([]*x509.Certificate{c.leaf, c.root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12, err := pkcs12.Encode(rand.Reader, c.leafKey, c.leaf, []*x509.Certificate{c.root}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8DER, err := x509.MarshalPKCS8PrivateKey(c.leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := keystore.New()
+	err = ks.SetPrivateKeyEntry("leaf", keystore.PrivateKeyEntry{
+		CreationTime: time.Now(),
+		PrivateKey:   pkcs8DER,
+		CertificateChain: []keystore.Certificate{
+			{Type: "X509", Content: c.leaf.Raw},
+			{Type: "X509", Content: c.root.Raw},
+		},
+	}, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jks bytes.Buffer
+	if err = ks.Store(&jks, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	// nolint:staticcheck
+	encrypted, err := x509.EncryptPEMBlock(rand.Reader, "EC PRIVATE KEY", keyDER, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		password string
+		format   string
+		certs    int
+		keys     int
+	}{
+		{"pem", bundle, "", FormatPEM, 2, 1},
+		{"der", c.leaf.Raw, "", FormatDER, 1, 0},
+		{"pkcs7", p7, "", FormatPKCS7, 2, 0},
+		{"pkcs7 pem", pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: p7}), "", FormatPEM, 2, 0},
+		{"pkcs12", p12, "secret", FormatPKCS12, 2, 1},
+		{"jks", jks.Bytes(), "secret", FormatJKS, 2, 1},
+		{"key der", keyDER, "", FormatDER, 0, 1},
+		{"encrypted key", pem.EncodeToMemory(encrypted), "secret", FormatPEM, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := Decode(tt.data, tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contents.Format != tt.format || len(contents.Certificates) != tt.certs || len(contents.Keys) != tt.keys {
+				t.Fatalf("unexpected contents %s with %d certificates and %d keys", contents.Format, len(contents.Certificates), len(contents.Keys))
+			}
+			for _, key := range contents.Keys {
+				if key.Key == nil || !key.Key.Public().(*ecdsa.PublicKey).Equal(c.leafKey.Public()) {
+					t.Error("unexpected private key")
+				}
+			}
+		})
+	}
+
+	if _, err = Decode(p12, "wrong"); err == nil || !strings.Contains(err.Error(), "wrong password") {
+		t.Errorf("expected a wrong password error, got %v", err)
+	}
+	if _, err = Decode(jks.Bytes(), "wrong"); err == nil || !strings.Contains(err.Error(), "check its password") {
+		t.Errorf("expected a wrong password error, got %v", err)
+	}
+	contents, err := Decode(pem.EncodeToMemory(encrypted), "")
+	if err != nil || !contents.Keys[0].Encrypted || contents.Keys[0].Key != nil {
+		t.Errorf("expected an encrypted key without a password, got %+v, %v", contents, err)
+	}
+	if _, err = Decode([]byte("not a certificate"), ""); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestDecodeOpenSSHPrivateKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := util.MarshalSshPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := Decode(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents.Keys) != 1 || contents.Keys[0].Encrypted || !key.Equal(contents.Keys[0].Key) {
+		t.Errorf("unexpected keys %+v", contents.Keys)
+	}
+}
+
+func TestChain(t *testing.T) {
+	c := newTestChain(t)
+	tests := []struct {
+		name     string
+		contents *Contents
+	}{
+		{"leaf first", &Contents{Certificates: []*x509.Certificate{c.leaf, c.root}}},
+		{"root first", &Contents{Certificates: []*x509.Certificate{c.root, c.leaf}}},
+		{"key", &Contents{Certificates: []*x509.Certificate{c.root, c.leaf}, Keys: []*PrivateKey{{Key: c.leafKey}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := tt.contents.Chain()
+			if len(chain) != 2 || chain[0] != c.leaf || chain[1] != c.root {
+				t.Errorf("unexpected chain %v", chain)
+			}
+		})
+	}
+	chain := (&Contents{Certificates: []*x509.Certificate{c.root}, Keys: []*PrivateKey{{Key: c.leafKey}}}).Chain()
+	if len(chain) != 1 || chain[0] != c.root {
+		t.Errorf("unexpected chain %v", chain)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	c := newTestChain(t)
+	contents := &Contents{
+		Format:       FormatPEM,
+		Certificates: []*x509.Certificate{c.leaf, c.root},
+		Keys:         []*PrivateKey{{Key: c.leafKey}},
+	}
+	r := contents.Describe(time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC))
+
+	leaf, root := r.Certificates[0], r.Certificates[1]
+	if leaf.Role != RoleLeaf || leaf.IssuedBy == nil || *leaf.IssuedBy != 1 {
+		t.Errorf("unexpected leaf %+v", leaf)
+	}
+	if root.Role != RoleRoot || root.IssuedBy != nil || !root.IsCA {
+		t.Errorf("unexpected root %+v", root)
+	}
+	if leaf.Subject != "CN=www.example.com" || leaf.DaysRemaining != 30 || leaf.Expired {
+		t.Errorf("unexpected leaf %+v", leaf)
+	}
+	if !reflect.DeepEqual(leaf.DNSNames, []string{"www.example.com", "example.com"}) || !reflect.DeepEqual(leaf.IPAddresses, []string{"10.0.0.1"}) {
+		t.Errorf("unexpected SANs %+v", leaf.SANs)
+	}
+	if !reflect.DeepEqual(leaf.KeyUsages, []string{"Digital Signature"}) || !reflect.DeepEqual(leaf.ExtKeyUsages, []string{"serverAuth", "clientAuth"}) {
+		t.Errorf("unexpected usages %v %v", leaf.KeyUsages, leaf.ExtKeyUsages)
+	}
+	if leaf.PublicKey.String() != "ECDSA P-384" || root.PublicKey.String() != "ECDSA P-256" {
+		t.Errorf("unexpected keys %s %s", leaf.PublicKey, root.PublicKey)
+	}
+	if key := r.Keys[0]; key.Certificate == nil || *key.Certificate != 0 {
+		t.Errorf("the key doesn't match the leaf: %+v", key)
+	}
+}
+
+func TestDescribeRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"www.example.com"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionKeyUsage, Critical: true, Value: []byte{0x03, 0x02, 0x05, 0xa0}},
+			{Id: oidExtensionExtKeyUsage, Value: []byte{0x30, 0x0a, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x05, 0x05, 0x07, 0x03, 0x01}},
+		},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := Decode(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := contents.Describe(time.Now()).Requests[0]
+	if !r.SignatureValid || r.PublicKey.String() != "RSA 2048" || !reflect.DeepEqual(r.DNSNames, []string{"www.example.com"}) {
+		t.Errorf("unexpected request %+v", r)
+	}
+	if !reflect.DeepEqual(r.KeyUsages, []string{"Digital Signature", "Key Encipherment"}) || !reflect.DeepEqual(r.ExtKeyUsages, []string{"serverAuth"}) {
+		t.Errorf("unexpected usages %v %v", r.KeyUsages, r.ExtKeyUsages)
+	}
+
+	var out bytes.Buffer
+	WriteRequestText(&out, contents.Requests[0])
+	for _, expected := range []string{
+		"        Version: 1 (0x0)\n",
+		"        Subject: CN = www.example.com\n",
+		"                Public-Key: (2048 bit)\n",
+		"                X509v3 Key Usage: critical\n                    Digital Signature, Key Encipherment\n",
+		"                X509v3 Extended Key Usage: \n                    TLS Web Server Authentication\n",
+		"                X509v3 Subject Alternative Name: \n                    DNS:www.example.com\n",
+		"    Signature Algorithm: sha256WithRSAEncryption\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("%q not found in\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestWriteCertificateText(t *testing.T) {
+	c := newTestChain(t)
+	var out bytes.Buffer
+	WriteCertificateText(&out, c.leaf)
+	for _, expected := range []string{
+		"        Version: 3 (0x2)\n",
+		"        Serial Number:\n            10:00:00:00:00:00:00:00:00:00:00:00:00\n",
+		"        Signature Algorithm: ecdsa-with-SHA256\n",
+		"        Issuer: O = Acme, CN = Test Root\n",
+		"            Not Before: Jan  1 00:00:00 2022 GMT\n",
+		"            Not After : Apr  1 00:00:00 2022 GMT\n",
+		"            Public Key Algorithm: id-ecPublicKey\n                Public-Key: (384 bit)\n",
+		"                ASN1 OID: secp384r1\n                NIST CURVE: P-384\n",
+		"            X509v3 Extended Key Usage: \n                TLS Web Server Authentication, TLS Web Client Authentication\n",
+		"            X509v3 Subject Alternative Name: \n                DNS:www.example.com, DNS:example.com, IP Address:10.0.0.1\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("%q not found in\n%s", expected, out.String())
+		}
+	}
+	out.Reset()
+	WriteCertificateText(&out, c.root)
+	if !strings.Contains(out.String(), "        Serial Number: 1 (0x1)\n") || !strings.Contains(out.String(), "            X509v3 Basic Constraints: critical\n                CA:TRUE\n") {
+		t.Errorf("unexpected root\n%s", out.String())
+	}
+}
+
+func TestPKCS7(t *testing.T) {
+	c := newTestChain(t)
+	der, err := MarshalPKCS7([]*x509.Certificate{c.leaf, c.root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := ParsePKCS7(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(c.leaf) || !certs[1].Equal(c.root) {
+		t.Errorf("unexpected certificates %v", certs)
+	}
+	if _, err = ParsePKCS7(c.leaf.Raw); err == nil {
+		t.Error("expected an error for a certificate")
+	}
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import "bytes"
+
+// jksMagic starts the Java keystores
+var jksMagic = []byte{0xfe, 0xed, 0xfe, 0xed}
+
+// decodeJKS decodes the entries of a Java keystore, whose keys are protected by the password of the store
+func decodeJKS(data []byte, password string) (*Contents, error) {
+	c := &Contents{Format: FormatJKS}
+	err := walkJKS(bytes.NewReader(data), password, func(e *Entry) error {
+		if e.Key != nil {
+			c.Keys = append(c.Keys, e.Key)
+		}
+		c.Certificates = append(c.Certificates, e.Certificates...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
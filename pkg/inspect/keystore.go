@@ -0,0 +1,338 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"unicode/utf16"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Entry is an entry of a keystore: a private key with its certificate chain, or a trusted certificate
+type Entry struct {
+	// Alias is the alias of a Java keystore entry, the friendly name of a PKCS#12 bag
+	Alias string
+	// Key is nil for a trusted certificate
+	Key          *PrivateKey
+	Certificates []*x509.Certificate
+}
+
+// ErrStopWalk stops WalkKeystore without error when it's returned by its callback
+var ErrStopWalk = errors.New("stop walking the keystore")
+
+// WalkKeystore calls fn with the entries of the Java keystore or PKCS#12 file read from r, one at a time, so that
+// the memory used while importing the thousands of entries of an appliance export doesn't grow with their number.
+// The entries are decrypted with password.
+//
+// A Java keystore is read as it's walked and its integrity is checked once all its entries are read: they're only
+// trusted when WalkKeystore returns nil. The bags of a PKCS#12 file are encrypted together so the file is read at
+// once, its entries are still parsed one at a time.
+func WalkKeystore(r io.Reader, password string, fn func(*Entry) error) error {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(jksMagic))
+	var err error
+	if bytes.Equal(magic, jksMagic) {
+		err = walkJKS(br, password, fn)
+	} else {
+		err = walkPKCS12(br, password, fn)
+	}
+	if err == ErrStopWalk {
+		return nil
+	}
+	return err
+}
+
+const (
+	jksPrivateKeyTag  = 1
+	jksTrustedCertTag = 2
+	// jksMaxLength bounds the size of the fields of a Java keystore, so that a corrupted length isn't allocated
+	jksMaxLength = 16 << 20
+)
+
+// jksKeyProtectorOID is the algorithm of the private keys of the Java keystores
+var jksKeyProtectorOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// jksReader reads the fields of a Java keystore, hashing them for its integrity check
+type jksReader struct {
+	r       io.Reader
+	digest  hash.Hash
+	version uint32
+}
+
+func (jr *jksReader) read(n uint32) ([]byte, error) {
+	if n > jksMaxLength {
+		return nil, fmt.Errorf("%w: invalid Java keystore, field of %d bytes", verror.UserDataError, n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(jr.r, b); err != nil {
+		return nil, fmt.Errorf("%w: truncated Java keystore: %s", verror.UserDataError, err)
+	}
+	jr.digest.Write(b)
+	return b, nil
+}
+
+func (jr *jksReader) uint32() (uint32, error) {
+	b, err := jr.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (jr *jksReader) string() (string, error) {
+	b, err := jr.read(2)
+	if err != nil {
+		return "", err
+	}
+	b, err = jr.read(uint32(binary.BigEndian.Uint16(b)))
+	return string(b), err
+}
+
+func (jr *jksReader) certificate(alias string) (*x509.Certificate, error) {
+	if jr.version == 2 {
+		// the type of the certificate, always X.509
+		if _, err := jr.string(); err != nil {
+			return nil, err
+		}
+	}
+	n, err := jr.uint32()
+	if err != nil {
+		return nil, err
+	}
+	der, err := jr.read(n)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read the certificate %s of the Java keystore: %s", verror.UserDataError, alias, err)
+	}
+	return cert, nil
+}
+
+func walkJKS(r io.Reader, password string, fn func(*Entry) error) error {
+	jr := &jksReader{r: r, digest: sha1.New()}
+	jr.digest.Write(jksPassword(password))
+	jr.digest.Write([]byte("Mighty Aphrodite"))
+	header, err := jr.read(12)
+	if err != nil {
+		return err
+	}
+	jr.version = binary.BigEndian.Uint32(header[4:])
+	if jr.version != 1 && jr.version != 2 {
+		return fmt.Errorf("%w: unsupported Java keystore version %d", verror.UserDataError, jr.version)
+	}
+	count := binary.BigEndian.Uint32(header[8:])
+	for i := uint32(0); i < count; i++ {
+		entry, err := jr.entry(password)
+		if err != nil {
+			return err
+		}
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+	sum := jr.digest.Sum(nil)
+	stored := make([]byte, len(sum))
+	if _, err = io.ReadFull(r, stored); err != nil {
+		return fmt.Errorf("%w: truncated Java keystore: %s", verror.UserDataError, err)
+	}
+	if !bytes.Equal(sum, stored) {
+		return fmt.Errorf("%w: can't read the Java keystore, check its password: invalid digest", verror.UserDataError)
+	}
+	return nil
+}
+
+func (jr *jksReader) entry(password string) (*Entry, error) {
+	tag, err := jr.uint32()
+	if err != nil {
+		return nil, err
+	}
+	alias, err := jr.string()
+	if err != nil {
+		return nil, err
+	}
+	// the creation time
+	if _, err = jr.read(8); err != nil {
+		return nil, err
+	}
+	entry := &Entry{Alias: alias}
+	switch tag {
+	case jksPrivateKeyTag:
+		n, err := jr.uint32()
+		if err != nil {
+			return nil, err
+		}
+		encrypted, err := jr.read(n)
+		if err != nil {
+			return nil, err
+		}
+		der, err := jksDecryptKey(encrypted, password)
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't decrypt the private key %s of the Java keystore, check its password: %s", verror.UserDataError, alias, err)
+		}
+		key, err := parsePrivateKey(der)
+		if err != nil {
+			return nil, err
+		}
+		entry.Key = &PrivateKey{Key: key, Encrypted: true}
+		n, err = jr.uint32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < n; i++ {
+			cert, err := jr.certificate(alias)
+			if err != nil {
+				return nil, err
+			}
+			entry.Certificates = append(entry.Certificates, cert)
+		}
+	case jksTrustedCertTag:
+		cert, err := jr.certificate(alias)
+		if err != nil {
+			return nil, err
+		}
+		entry.Certificates = []*x509.Certificate{cert}
+	default:
+		return nil, fmt.Errorf("%w: unsupported entry %s of type %d in the Java keystore", verror.UserDataError, alias, tag)
+	}
+	return entry, nil
+}
+
+// jksDecryptKey decrypts a private key protected by the key protector of the Java keystores: a SHA-1 keystream
+// seeded by a salt, and a SHA-1 check of the key
+func jksDecryptKey(data []byte, password string) ([]byte, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Data      []byte
+	}
+	if _, err := asn1.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(jksKeyProtectorOID) {
+		return nil, fmt.Errorf("unsupported key protection %s", info.Algorithm.Algorithm)
+	}
+	const saltLen = sha1.Size
+	if len(info.Data) < saltLen+sha1.Size {
+		return nil, fmt.Errorf("truncated private key")
+	}
+	pass := jksPassword(password)
+	encrypted := info.Data[saltLen : len(info.Data)-sha1.Size]
+	key := make([]byte, len(encrypted))
+	stream := info.Data[:saltLen]
+	for i := 0; i < len(key); i += sha1.Size {
+		sum := sha1.Sum(append(append([]byte(nil), pass...), stream...))
+		stream = sum[:]
+		for j := 0; j < sha1.Size && i+j < len(key); j++ {
+			key[i+j] = encrypted[i+j] ^ stream[j]
+		}
+	}
+	check := sha1.Sum(append(append([]byte(nil), pass...), key...))
+	if !bytes.Equal(check[:], info.Data[len(info.Data)-sha1.Size:]) {
+		return nil, fmt.Errorf("invalid digest")
+	}
+	return key, nil
+}
+
+// jksPassword encodes password as the UTF-16 characters Java hashes
+func jksPassword(password string) []byte {
+	chars := utf16.Encode([]rune(password))
+	b := make([]byte, 2*len(chars))
+	for i, c := range chars {
+		binary.BigEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+func walkPKCS12(r io.Reader, password string, fn func(*Entry) error) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	blocks, err := pkcs12.ToPEM(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return fmt.Errorf("%w: wrong password for the PKCS#12 file", verror.UserDataError)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: can't read the PKCS#12 file: %s", verror.UserDataError, err)
+	}
+	// the key of an entry and its certificate share a local key ID
+	keys := make(map[string]*pem.Block)
+	for _, b := range blocks {
+		if b.Type != "CERTIFICATE" && b.Headers["localKeyId"] != "" {
+			keys[b.Headers["localKeyId"]] = b
+		}
+	}
+	used := make(map[string]bool)
+	for _, b := range blocks {
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return fmt.Errorf("%w: can't read the certificate %s of the PKCS#12 file: %s", verror.UserDataError, b.Headers["friendlyName"], err)
+		}
+		entry := &Entry{Alias: b.Headers["friendlyName"], Certificates: []*x509.Certificate{cert}}
+		id := b.Headers["localKeyId"]
+		if kb, ok := keys[id]; ok && !used[id] {
+			used[id] = true
+			if entry.Key, err = pkcs12EntryKey(kb); err != nil {
+				return err
+			}
+		}
+		if err = fn(entry); err != nil {
+			return err
+		}
+	}
+	for _, b := range blocks {
+		if id := b.Headers["localKeyId"]; b.Type == "CERTIFICATE" || (id != "" && used[id]) {
+			continue
+		}
+		key, err := pkcs12EntryKey(b)
+		if err != nil {
+			return err
+		}
+		if err = fn(&Entry{Alias: b.Headers["friendlyName"], Key: key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pkcs12EntryKey parses a private key of a PKCS#12 file, which is encrypted by its password
+func pkcs12EntryKey(b *pem.Block) (*PrivateKey, error) {
+	key, err := parsePrivateKey(b.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{Key: key, Encrypted: true}, nil
+}
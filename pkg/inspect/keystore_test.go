@@ -0,0 +1,120 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavel-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestWalkKeystore(t *testing.T) {
+	c := newTestChain(t)
+	pkcs8DER, err := x509.MarshalPKCS8PrivateKey(c.leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const trusted = 500
+	ks := keystore.New()
+	for i := 0; i < trusted; i++ {
+		err = ks.SetTrustedCertificateEntry(fmt.Sprintf("ca-%03d", i), keystore.TrustedCertificateEntry{
+			CreationTime: time.Now(),
+			Certificate:  keystore.Certificate{Type: "X509", Content: c.root.Raw},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ks.SetPrivateKeyEntry("leaf", keystore.PrivateKeyEntry{
+		CreationTime:     time.Now(),
+		PrivateKey:       pkcs8DER,
+		CertificateChain: []keystore.Certificate{{Type: "X509", Content: c.leaf.Raw}, {Type: "X509", Content: c.root.Raw}},
+	}, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jks bytes.Buffer
+	if err = ks.Store(&jks, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries, keys int
+	err = WalkKeystore(bytes.NewReader(jks.Bytes()), "secret", func(e *Entry) error {
+		entries++
+		if e.Key != nil {
+			keys++
+			if e.Alias != "leaf" || len(e.Certificates) != 2 || !e.Certificates[0].Equal(c.leaf) || !samePublicKey(e.Key.Key.Public(), c.leafKey.Public()) {
+				t.Errorf("unexpected key entry %+v", e)
+			}
+		} else if len(e.Certificates) != 1 || !strings.HasPrefix(e.Alias, "ca-") {
+			t.Errorf("unexpected trusted entry %+v", e)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != trusted+1 || keys != 1 {
+		t.Fatalf("walked %d entries with %d keys", entries, keys)
+	}
+
+	entries = 0
+	err = WalkKeystore(bytes.NewReader(jks.Bytes()), "secret", func(e *Entry) error {
+		entries++
+		return ErrStopWalk
+	})
+	if err != nil || entries != 1 {
+		t.Fatalf("walk should have stopped after the first entry: %d entries, %v", entries, err)
+	}
+
+	err = WalkKeystore(bytes.NewReader(jks.Bytes()), "wrong", func(*Entry) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "check its password") {
+		t.Fatalf("expected a password error, got %v", err)
+	}
+	err = WalkKeystore(bytes.NewReader(jks.Bytes()[:jks.Len()-10]), "secret", func(*Entry) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Fatalf("expected a truncated keystore error, got %v", err)
+	}
+
+	p12, err := pkcs12.Encode(rand.Reader, c.leafKey, c.leaf, []*x509.Certificate{c.root}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walked []*Entry
+	err = WalkKeystore(bytes.NewReader(p12), "secret", func(e *Entry) error {
+		walked = append(walked, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != 2 || walked[0].Key == nil || !walked[0].Certificates[0].Equal(c.leaf) ||
+		walked[1].Key != nil || !walked[1].Certificates[0].Equal(c.root) {
+		t.Fatalf("unexpected PKCS#12 entries %+v", walked)
+	}
+	err = WalkKeystore(bytes.NewReader(p12), "wrong", func(*Entry) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "wrong password") {
+		t.Fatalf("expected a password error, got %v", err)
+	}
+}
@@ -0,0 +1,421 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+)
+
+// opensslTimeLayout is the layout of the validity printed by OpenSSL
+const opensslTimeLayout = "Jan _2 15:04:05 2006 GMT"
+
+var (
+	oidExtensionSubjectKeyID          = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtensionSubjectAltName        = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionBasicConstraints      = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionNameConstraints       = asn1.ObjectIdentifier{2, 5, 29, 30}
+	oidExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+	oidExtensionCertificatePolicies   = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidExtensionAuthorityKeyID        = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionAuthorityInfoAccess   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+	oidExtensionSCT                   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	oidAuthorityInfoAccessOCSP        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1}
+	oidAuthorityInfoAccessIssuers     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 2}
+)
+
+var extensionNames = []struct {
+	oid  asn1.ObjectIdentifier
+	name string
+}{
+	{oidExtensionSubjectKeyID, "X509v3 Subject Key Identifier"},
+	{oidExtensionKeyUsage, "X509v3 Key Usage"},
+	{oidExtensionSubjectAltName, "X509v3 Subject Alternative Name"},
+	{oidExtensionBasicConstraints, "X509v3 Basic Constraints"},
+	{oidExtensionNameConstraints, "X509v3 Name Constraints"},
+	{oidExtensionCRLDistributionPoints, "X509v3 CRL Distribution Points"},
+	{oidExtensionCertificatePolicies, "X509v3 Certificate Policies"},
+	{oidExtensionAuthorityKeyID, "X509v3 Authority Key Identifier"},
+	{oidExtensionExtKeyUsage, "X509v3 Extended Key Usage"},
+	{oidExtensionAuthorityInfoAccess, "Authority Information Access"},
+	{oidExtensionSCT, "CT Precertificate SCTs"},
+}
+
+var attributeNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "street",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.17":                   "postalCode",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+	"0.9.2342.19200300.100.1.25": "DC",
+	"0.9.2342.19200300.100.1.1":  "UID",
+}
+
+var signatureAlgorithmNames = map[x509.SignatureAlgorithm]string{
+	x509.MD5WithRSA:       "md5WithRSAEncryption",
+	x509.SHA1WithRSA:      "sha1WithRSAEncryption",
+	x509.SHA256WithRSA:    "sha256WithRSAEncryption",
+	x509.SHA384WithRSA:    "sha384WithRSAEncryption",
+	x509.SHA512WithRSA:    "sha512WithRSAEncryption",
+	x509.DSAWithSHA1:      "dsaWithSHA1",
+	x509.DSAWithSHA256:    "dsa_with_SHA256",
+	x509.ECDSAWithSHA1:    "ecdsa-with-SHA1",
+	x509.ECDSAWithSHA256:  "ecdsa-with-SHA256",
+	x509.ECDSAWithSHA384:  "ecdsa-with-SHA384",
+	x509.ECDSAWithSHA512:  "ecdsa-with-SHA512",
+	x509.SHA256WithRSAPSS: "rsassaPss",
+	x509.SHA384WithRSAPSS: "rsassaPss",
+	x509.SHA512WithRSAPSS: "rsassaPss",
+	x509.PureEd25519:      "ED25519",
+}
+
+var curveNames = map[elliptic.Curve]string{
+	elliptic.P224(): "secp224r1",
+	elliptic.P256(): "prime256v1",
+	elliptic.P384(): "secp384r1",
+	elliptic.P521(): "secp521r1",
+}
+
+// WriteCertificateText writes cert like openssl x509 -text -noout does
+func WriteCertificateText(w io.Writer, cert *x509.Certificate) {
+	fmt.Fprintf(w, "Certificate:\n    Data:\n")
+	fmt.Fprintf(w, "        Version: %d (%#x)\n", cert.Version, cert.Version-1)
+	if cert.SerialNumber.Sign() >= 0 && cert.SerialNumber.BitLen() < 64 {
+		fmt.Fprintf(w, "        Serial Number: %d (%#x)\n", cert.SerialNumber, cert.SerialNumber)
+	} else {
+		fmt.Fprintf(w, "        Serial Number:\n            %s\n", colonHex(new(big.Int).Abs(cert.SerialNumber).Bytes()))
+	}
+	fmt.Fprintf(w, "        Signature Algorithm: %s\n", signatureAlgorithmName(cert.SignatureAlgorithm))
+	fmt.Fprintf(w, "        Issuer: %s\n", opensslName(cert.Issuer))
+	fmt.Fprintf(w, "        Validity\n")
+	fmt.Fprintf(w, "            Not Before: %s\n", cert.NotBefore.UTC().Format(opensslTimeLayout))
+	fmt.Fprintf(w, "            Not After : %s\n", cert.NotAfter.UTC().Format(opensslTimeLayout))
+	fmt.Fprintf(w, "        Subject: %s\n", opensslName(cert.Subject))
+	fmt.Fprintf(w, "        Subject Public Key Info:\n")
+	writePublicKey(w, cert.PublicKey, 12)
+	if len(cert.Extensions) > 0 {
+		fmt.Fprintf(w, "        X509v3 extensions:\n")
+		writeExtensions(w, cert.Extensions, 12)
+	}
+	writeSignature(w, cert.SignatureAlgorithm, cert.Signature)
+}
+
+// WriteRequestText writes req like openssl req -text -noout does
+func WriteRequestText(w io.Writer, req *x509.CertificateRequest) {
+	fmt.Fprintf(w, "Certificate Request:\n    Data:\n")
+	fmt.Fprintf(w, "        Version: %d (%#x)\n", req.Version+1, req.Version)
+	fmt.Fprintf(w, "        Subject: %s\n", opensslName(req.Subject))
+	fmt.Fprintf(w, "        Subject Public Key Info:\n")
+	writePublicKey(w, req.PublicKey, 12)
+	fmt.Fprintf(w, "        Attributes:\n")
+	if len(req.Extensions) == 0 {
+		fmt.Fprintf(w, "            (none)\n")
+	}
+	// OpenSSL 3 announces the requested extensions even when there's none
+	fmt.Fprintf(w, "            Requested Extensions:\n")
+	writeExtensions(w, req.Extensions, 16)
+	writeSignature(w, req.SignatureAlgorithm, req.Signature)
+}
+
+// WritePublicKeyText writes pub like openssl pkey -pubin -text -noout does
+func WritePublicKeyText(w io.Writer, pub crypto.PublicKey) {
+	writePublicKey(w, pub, -4)
+}
+
+// writePublicKey writes the subject public key info of pub indented by indent spaces
+func writePublicKey(w io.Writer, pub crypto.PublicKey, indent int) {
+	pad := strings.Repeat(" ", indent+4)
+	if indent >= 0 {
+		fmt.Fprintf(w, "%sPublic Key Algorithm: %s\n", strings.Repeat(" ", indent), publicKeyAlgorithmName(pub))
+	} else {
+		pad = ""
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		fmt.Fprintf(w, "%sPublic-Key: (%d bit)\n", pad, pub.N.BitLen())
+		fmt.Fprintf(w, "%sModulus:\n", pad)
+		writeHexDump(w, append([]byte{0}, pub.N.Bytes()...)[leadingZero(pub.N):], 15, len(pad)+4)
+		fmt.Fprintf(w, "%sExponent: %d (%#x)\n", pad, pub.E, pub.E)
+	case *ecdsa.PublicKey:
+		fmt.Fprintf(w, "%sPublic-Key: (%d bit)\n", pad, pub.Curve.Params().BitSize)
+		fmt.Fprintf(w, "%spub:\n", pad)
+		// nolint:staticcheck // the uncompressed point is what OpenSSL prints
+		writeHexDump(w, elliptic.Marshal(pub.Curve, pub.X, pub.Y), 15, len(pad)+4)
+		if name, ok := curveNames[pub.Curve]; ok {
+			fmt.Fprintf(w, "%sASN1 OID: %s\n", pad, name)
+		}
+		fmt.Fprintf(w, "%sNIST CURVE: %s\n", pad, pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		fmt.Fprintf(w, "%sED25519 Public-Key:\n", pad)
+		fmt.Fprintf(w, "%spub:\n", pad)
+		writeHexDump(w, pub, 15, len(pad)+4)
+	}
+}
+
+// leadingZero returns 0 when OpenSSL prints a leading 00 byte before n to keep it positive, 1 otherwise
+func leadingZero(n *big.Int) int {
+	if n.BitLen()%8 == 0 {
+		return 0
+	}
+	return 1
+}
+
+func publicKeyAlgorithmName(pub crypto.PublicKey) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "rsaEncryption"
+	case *ecdsa.PublicKey:
+		return "id-ecPublicKey"
+	case ed25519.PublicKey:
+		return "ED25519"
+	}
+	return fmt.Sprintf("%T", pub)
+}
+
+func signatureAlgorithmName(alg x509.SignatureAlgorithm) string {
+	if name, ok := signatureAlgorithmNames[alg]; ok {
+		return name
+	}
+	return alg.String()
+}
+
+func writeSignature(w io.Writer, alg x509.SignatureAlgorithm, signature []byte) {
+	fmt.Fprintf(w, "    Signature Algorithm: %s\n", signatureAlgorithmName(alg))
+	fmt.Fprintf(w, "    Signature Value:\n")
+	writeHexDump(w, signature, 18, 8)
+}
+
+// writeHexDump writes b in lines of n bytes indented by indent spaces, each line but the last ending with a colon
+func writeHexDump(w io.Writer, b []byte, n, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for i := 0; i < len(b); i += n {
+		end := i + n
+		if end > len(b) {
+			end = len(b)
+		}
+		line := colonHex(b[i:end])
+		if end < len(b) {
+			line += ":"
+		}
+		fmt.Fprintf(w, "%s%s\n", pad, line)
+	}
+}
+
+// opensslName prints name in the order of its attributes like OpenSSL does, e.g. C = US, O = Acme, CN = www.example.com
+func opensslName(name pkix.Name) string {
+	var parts []string
+	for _, atv := range name.Names {
+		t, ok := attributeNames[atv.Type.String()]
+		if !ok {
+			t = atv.Type.String()
+		}
+		parts = append(parts, fmt.Sprintf("%s = %v", t, atv.Value))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func writeExtensions(w io.Writer, extensions []pkix.Extension, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, ext := range extensions {
+		name := ext.Id.String()
+		for _, n := range extensionNames {
+			if n.oid.Equal(ext.Id) {
+				name = n.name
+				break
+			}
+		}
+		critical := ""
+		if ext.Critical {
+			critical = "critical"
+		}
+		fmt.Fprintf(w, "%s%s: %s\n", pad, name, critical)
+		lines, err := extensionText(ext)
+		if err != nil {
+			lines = []string{colonHex(ext.Value)}
+		}
+		for _, line := range lines {
+			fmt.Fprintf(w, "%s    %s\n", pad, line)
+		}
+	}
+}
+
+// extensionText returns the lines OpenSSL prints for the value of ext, the raw value is printed for the extensions
+// it doesn't know
+func extensionText(ext pkix.Extension) ([]string, error) {
+	switch {
+	case ext.Id.Equal(oidExtensionKeyUsage):
+		usage, err := parseKeyUsage(ext.Value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{strings.Join(keyUsageNames(usage), ", ")}, nil
+	case ext.Id.Equal(oidExtensionExtKeyUsage):
+		oids, err := parseExtKeyUsage(ext.Value)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, len(oids))
+		for i, oid := range oids {
+			names[i] = extKeyUsageOIDName(oid, true)
+		}
+		return []string{strings.Join(names, ", ")}, nil
+	case ext.Id.Equal(oidExtensionBasicConstraints):
+		var bc struct {
+			IsCA       bool `asn1:"optional"`
+			MaxPathLen int  `asn1:"optional,default:-1"`
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &bc); err != nil {
+			return nil, err
+		}
+		if !bc.IsCA {
+			return []string{"CA:FALSE"}, nil
+		}
+		if bc.MaxPathLen >= 0 {
+			return []string{fmt.Sprintf("CA:TRUE, pathlen:%d", bc.MaxPathLen)}, nil
+		}
+		return []string{"CA:TRUE"}, nil
+	case ext.Id.Equal(oidExtensionSubjectKeyID):
+		var id []byte
+		if _, err := asn1.Unmarshal(ext.Value, &id); err != nil {
+			return nil, err
+		}
+		return []string{strings.ToUpper(colonHex(id))}, nil
+	case ext.Id.Equal(oidExtensionAuthorityKeyID):
+		var aki struct {
+			ID []byte `asn1:"optional,tag:0"`
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &aki); err != nil {
+			return nil, err
+		}
+		return []string{strings.ToUpper(colonHex(aki.ID))}, nil
+	case ext.Id.Equal(oidExtensionSubjectAltName):
+		var names []asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+			return nil, err
+		}
+		return []string{generalNames(names)}, nil
+	case ext.Id.Equal(oidExtensionCRLDistributionPoints):
+		var points []struct {
+			DistributionPoint struct {
+				FullName []asn1.RawValue `asn1:"optional,tag:0"`
+			} `asn1:"optional,tag:0"`
+			Reason    asn1.BitString `asn1:"optional,tag:1"`
+			CRLIssuer asn1.RawValue  `asn1:"optional,tag:2"`
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &points); err != nil {
+			return nil, err
+		}
+		var lines []string
+		for i, point := range points {
+			if i > 0 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, "Full Name:")
+			for _, name := range point.DistributionPoint.FullName {
+				lines = append(lines, "  "+generalName(name))
+			}
+		}
+		return lines, nil
+	case ext.Id.Equal(oidExtensionAuthorityInfoAccess):
+		var descriptions []struct {
+			Method   asn1.ObjectIdentifier
+			Location asn1.RawValue
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &descriptions); err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, d := range descriptions {
+			method := d.Method.String()
+			switch {
+			case d.Method.Equal(oidAuthorityInfoAccessOCSP):
+				method = "OCSP"
+			case d.Method.Equal(oidAuthorityInfoAccessIssuers):
+				method = "CA Issuers"
+			}
+			lines = append(lines, method+" - "+generalName(d.Location))
+		}
+		return lines, nil
+	case ext.Id.Equal(oidExtensionCertificatePolicies):
+		var policies []struct {
+			Policy     asn1.ObjectIdentifier
+			Qualifiers asn1.RawValue `asn1:"optional"`
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &policies); err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, p := range policies {
+			lines = append(lines, "Policy: "+p.Policy.String())
+		}
+		return lines, nil
+	}
+	return nil, fmt.Errorf("unknown extension %s", ext.Id)
+}
+
+func generalNames(names []asn1.RawValue) string {
+	s := make([]string, len(names))
+	for i, name := range names {
+		s[i] = generalName(name)
+	}
+	return strings.Join(s, ", ")
+}
+
+// generalName prints a GeneralName of RFC 5280 like OpenSSL does
+func generalName(name asn1.RawValue) string {
+	if name.Class != asn1.ClassContextSpecific {
+		return "<unsupported>"
+	}
+	switch name.Tag {
+	case 1:
+		return "email:" + string(name.Bytes)
+	case 2:
+		return "DNS:" + string(name.Bytes)
+	case 4:
+		var rdn pkix.RDNSequence
+		if _, err := asn1.Unmarshal(name.Bytes, &rdn); err == nil {
+			var n pkix.Name
+			n.FillFromRDNSequence(&rdn)
+			return "DirName:" + opensslName(n)
+		}
+	case 6:
+		return "URI:" + string(name.Bytes)
+	case 7:
+		if len(name.Bytes) == net.IPv4len || len(name.Bytes) == net.IPv6len {
+			return "IP Address:" + net.IP(name.Bytes).String()
+		}
+	case 0:
+		return "othername:<unsupported>"
+	}
+	return "<unsupported>"
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+var (
+	oidPKCS7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// pkcs7SignedData is the SignedData of RFC 2315, only its certificates are read
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// ParsePKCS7 returns the certificates of a DER PKCS#7 SignedData, as found in the .p7b and .p7c files. The signatures
+// aren't verified.
+func ParsePKCS7(der []byte) ([]*x509.Certificate, error) {
+	var info pkcs7ContentInfo
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: can't read the PKCS#7 content", verror.UserDataError)
+	}
+	if !info.ContentType.Equal(oidPKCS7SignedData) {
+		return nil, fmt.Errorf("%w: unsupported PKCS#7 content type %s", verror.UserDataError, info.ContentType)
+	}
+	var sd pkcs7SignedData
+	_, err = asn1.Unmarshal(info.Content.Bytes, &sd)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read the PKCS#7 signed data: %s", verror.UserDataError, err)
+	}
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, nil
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read the PKCS#7 certificates: %s", verror.UserDataError, err)
+	}
+	return certs, nil
+}
+
+// MarshalPKCS7 returns a DER PKCS#7 SignedData holding only certs, like openssl crl2pkcs7 -nocrl does
+func MarshalPKCS7(certs []*x509.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	sd := pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      pkcs7ContentInfo{ContentType: oidPKCS7Data},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+	}
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidPKCS7SignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+}
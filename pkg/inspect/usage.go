@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inspect
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	oidExtensionKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// keyUsages are the key usages in the order of their bits, named like OpenSSL does
+var keyUsages = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "Digital Signature"},
+	{x509.KeyUsageContentCommitment, "Non Repudiation"},
+	{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+	{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+	{x509.KeyUsageKeyAgreement, "Key Agreement"},
+	{x509.KeyUsageCertSign, "Certificate Sign"},
+	{x509.KeyUsageCRLSign, "CRL Sign"},
+	{x509.KeyUsageEncipherOnly, "Encipher Only"},
+	{x509.KeyUsageDecipherOnly, "Decipher Only"},
+}
+
+// extKeyUsages are the extended key usages with their short and long names in OpenSSL
+var extKeyUsages = []struct {
+	usage    x509.ExtKeyUsage
+	oid      asn1.ObjectIdentifier
+	name     string
+	longName string
+}{
+	{x509.ExtKeyUsageAny, asn1.ObjectIdentifier{2, 5, 29, 37, 0}, "anyExtendedKeyUsage", "Any Extended Key Usage"},
+	{x509.ExtKeyUsageServerAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}, "serverAuth", "TLS Web Server Authentication"},
+	{x509.ExtKeyUsageClientAuth, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}, "clientAuth", "TLS Web Client Authentication"},
+	{x509.ExtKeyUsageCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}, "codeSigning", "Code Signing"},
+	{x509.ExtKeyUsageEmailProtection, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}, "emailProtection", "E-mail Protection"},
+	{x509.ExtKeyUsageIPSECEndSystem, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 5}, "ipsecEndSystem", "IPSec End System"},
+	{x509.ExtKeyUsageIPSECTunnel, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 6}, "ipsecTunnel", "IPSec Tunnel"},
+	{x509.ExtKeyUsageIPSECUser, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 7}, "ipsecUser", "IPSec User"},
+	{x509.ExtKeyUsageTimeStamping, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}, "timeStamping", "Time Stamping"},
+	{x509.ExtKeyUsageOCSPSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}, "OCSPSigning", "OCSP Signing"},
+	{x509.ExtKeyUsageMicrosoftServerGatedCrypto, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 3}, "msSGC", "Microsoft Server Gated Crypto"},
+	{x509.ExtKeyUsageNetscapeServerGatedCrypto, asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 4, 1}, "nsSGC", "Netscape Server Gated Crypto"},
+	{x509.ExtKeyUsageMicrosoftCommercialCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 22}, "msCodeCom", "Microsoft Commercial Code Signing"},
+	{x509.ExtKeyUsageMicrosoftKernelCodeSigning, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 61, 1, 1}, "msKernelCodeSigning", "Microsoft Kernel Code Signing"},
+}
+
+func keyUsageNames(usage x509.KeyUsage) []string {
+	var names []string
+	for _, u := range keyUsages {
+		if usage&u.usage != 0 {
+			names = append(names, u.name)
+		}
+	}
+	return names
+}
+
+func extKeyUsageName(usage x509.ExtKeyUsage) string {
+	for _, u := range extKeyUsages {
+		if u.usage == usage {
+			return u.name
+		}
+	}
+	return fmt.Sprintf("unknown (%d)", usage)
+}
+
+// extKeyUsageOIDName names the extended key usage oid, its dotted form is returned when it's unknown. The long name
+// of OpenSSL is returned with long.
+func extKeyUsageOIDName(oid asn1.ObjectIdentifier, long bool) string {
+	for _, u := range extKeyUsages {
+		if u.oid.Equal(oid) {
+			if long {
+				return u.longName
+			}
+			return u.name
+		}
+	}
+	return oid.String()
+}
+
+func parseKeyUsage(value []byte) (x509.KeyUsage, error) {
+	var bits asn1.BitString
+	rest, err := asn1.Unmarshal(value, &bits)
+	if err != nil || len(rest) > 0 {
+		return 0, fmt.Errorf("invalid key usage extension")
+	}
+	var usage x509.KeyUsage
+	for i := 0; i < 9; i++ {
+		if bits.At(i) != 0 {
+			usage |= 1 << uint(i)
+		}
+	}
+	return usage, nil
+}
+
+func parseExtKeyUsage(value []byte) ([]asn1.ObjectIdentifier, error) {
+	var oids []asn1.ObjectIdentifier
+	rest, err := asn1.Unmarshal(value, &oids)
+	if err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("invalid extended key usage extension")
+	}
+	return oids, nil
+}
@@ -0,0 +1,403 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+// PostgreSQLInstaller writes the server certificate of a PostgreSQL server, with the intermediates, and its key,
+// sets ssl, ssl_cert_file, ssl_key_file and ssl_ca_file in ConfigFile and reloads the server with pg_ctl once the
+// written files are checked to hold a matching pair. The server keeps its current certificate until the reload, so
+// a broken pair never reaches it.
+type PostgreSQLInstaller struct {
+	CertFile string
+	KeyFile  string
+	// CAFile receives the chain when it's set, for the server to authenticate client certificates
+	CAFile string
+	// Owner is the "user" or "user:group" owning the files, the key is only readable by it. PostgreSQL refuses a
+	// key that isn't owned by its user or root.
+	Owner string
+	// ConfigFile is postgresql.conf, it's left alone when empty
+	ConfigFile string
+	// DataDir is the data directory passed to pg_ctl, $PGDATA when it's empty
+	DataDir string
+	// PgCtl is the pg_ctl command, looked up in the PATH when it's empty
+	PgCtl string
+}
+
+func (pi *PostgreSQLInstaller) Name() string {
+	return "postgresql:" + pi.CertFile
+}
+
+func (pi *PostgreSQLInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	err := writeServerFiles(ctx, pcc, pi.CertFile, pi.KeyFile, pi.CAFile, pi.Owner)
+	if err != nil {
+		return err
+	}
+	if pi.ConfigFile != "" {
+		settings := []setting{
+			{"ssl", "on"},
+			{"ssl_cert_file", pgQuote(pi.CertFile)},
+			{"ssl_key_file", pgQuote(pi.KeyFile)},
+		}
+		if pi.CAFile != "" {
+			settings = append(settings, setting{"ssl_ca_file", pgQuote(pi.CAFile)})
+		}
+		_, err = configurePostgreSQL(pi.ConfigFile, settings)
+		if err != nil {
+			return err
+		}
+	}
+	args := []string{"reload", "-s"}
+	if pi.DataDir != "" {
+		args = append(args, "-D", pi.DataDir)
+	}
+	return runReload(ctx, pi.PgCtl, "pg_ctl", args...)
+}
+
+// MySQLInstaller writes the server certificate of a MySQL or MariaDB server, with the intermediates, and its key,
+// sets ssl_cert, ssl_key and ssl_ca in the [mysqld] group of ConfigFile and reloads the TLS context of the running
+// server with the mysql client once the written files are checked to hold a matching pair. MySQL is told the paths
+// with SET GLOBAL before ALTER INSTANCE RELOAD TLS; MariaDB reloads with FLUSH SSL from the paths it started with,
+// it must be restarted once when they change.
+type MySQLInstaller struct {
+	CertFile string
+	KeyFile  string
+	// CAFile receives the chain when it's set, for the server to authenticate client certificates
+	CAFile string
+	// Owner is the "user" or "user:group" owning the files, the key is only readable by it
+	Owner string
+	// ConfigFile is the option file of the server, it's left alone when empty
+	ConfigFile string
+	// DefaultsFile is an option file with the credentials of the mysql client, passed as --defaults-extra-file
+	DefaultsFile string
+	MariaDB      bool
+	// Client is the mysql command, looked up in the PATH when it's empty
+	Client string
+}
+
+func (mi *MySQLInstaller) Name() string {
+	return "mysql:" + mi.CertFile
+}
+
+func (mi *MySQLInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	err := writeServerFiles(ctx, pcc, mi.CertFile, mi.KeyFile, mi.CAFile, mi.Owner)
+	if err != nil {
+		return err
+	}
+	settings := []setting{{"ssl_cert", mi.CertFile}, {"ssl_key", mi.KeyFile}}
+	if mi.CAFile != "" {
+		settings = append(settings, setting{"ssl_ca", mi.CAFile})
+	}
+	if mi.ConfigFile != "" {
+		_, err = configureMySQL(mi.ConfigFile, settings)
+		if err != nil {
+			return err
+		}
+	}
+	var statements []string
+	if mi.MariaDB {
+		statements = append(statements, "FLUSH SSL")
+	} else {
+		for _, s := range settings {
+			statements = append(statements, fmt.Sprintf("SET GLOBAL %s = %s", s.name, sqlQuote(s.value)))
+		}
+		statements = append(statements, "ALTER INSTANCE RELOAD TLS")
+	}
+	var args []string
+	if mi.DefaultsFile != "" {
+		// it must be the first option
+		args = append(args, "--defaults-extra-file="+mi.DefaultsFile)
+	}
+	args = append(args, "--batch", "-e", strings.Join(statements, "; "))
+	return runReload(ctx, mi.Client, "mysql", args...)
+}
+
+type setting struct {
+	name  string
+	value string
+}
+
+// writeServerFiles writes the leaf and the intermediates to certFile, the key to keyFile and the chain to caFile
+// when it's set, gives them to owner and reads them back to check they hold a matching pair
+func writeServerFiles(ctx context.Context, pcc *certificate.PEMCollection, certFile, keyFile, caFile, owner string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("certificate and key files are required")
+	}
+	if pcc.PrivateKey == "" {
+		return fmt.Errorf("certificate has no private key, a database server needs one")
+	}
+	uid, gid, err := lookupOwner(owner)
+	if err != nil {
+		return err
+	}
+	chain := strings.Join(pcc.Chain, "")
+	files := []struct {
+		name string
+		data string
+		perm os.FileMode
+	}{
+		{keyFile, pcc.PrivateKey, 0600},
+		{certFile, pcc.Certificate + strings.Join(intermediates(pcc.Chain), ""), 0644},
+		{caFile, chain, 0644},
+	}
+	for _, f := range files {
+		if f.name == "" {
+			continue
+		}
+		err = writeFileAtomic(f.name, []byte(f.data), f.perm)
+		if err != nil {
+			return err
+		}
+		if owner != "" {
+			err = os.Chown(f.name, uid, gid)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	if _, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return fmt.Errorf("installed certificate and key can't be used, the server isn't reloaded: %s", err)
+	}
+	return nil
+}
+
+// intermediates drops the self-signed root from a chain, servers send the intermediates only
+func intermediates(chain []string) []string {
+	var result []string
+	for _, c := range chain {
+		b, _ := pem.Decode([]byte(c))
+		if b != nil {
+			cert, err := x509.ParseCertificate(b.Bytes)
+			if err == nil && bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+				continue
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// lookupOwner returns the user and group ids of "user" or "user:group", the primary group of the user when the
+// group is omitted
+func lookupOwner(owner string) (int, int, error) {
+	if owner == "" {
+		return -1, -1, nil
+	}
+	if runtime.GOOS == "windows" {
+		return 0, 0, fmt.Errorf("file owners can't be set on Windows")
+	}
+	name, group := owner, ""
+	if i := strings.Index(owner, ":"); i >= 0 {
+		name, group = owner[:i], owner[i+1:]
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	gidString := u.Gid
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return 0, 0, err
+		}
+		gidString = g.Gid
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := strconv.Atoi(gidString)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uid, gid, nil
+}
+
+func runReload(ctx context.Context, command, defaultCommand string, args ...string) error {
+	if command == "" {
+		command = defaultCommand
+	}
+	out, err := exec.CommandContext(ctx, command, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to reload the server with %s: %s: %s", command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// configurePostgreSQL sets the parameters of postgresql.conf, replacing their lines or appending them. It returns
+// whether the file changed.
+func configurePostgreSQL(path string, settings []setting) (bool, error) {
+	return editConfig(path, settings, func(line string, _ string) (string, bool) {
+		return pgParameter(line), true
+	}, "", " = ")
+}
+
+// configureMySQL sets the options of the [mysqld] group of an option file, replacing their lines or adding them
+// at the end of the group, which is added when it's missing. It returns whether the file changed.
+func configureMySQL(path string, settings []setting) (bool, error) {
+	return editConfig(path, settings, func(line string, group string) (string, bool) {
+		return mysqlOption(line), group == "mysqld"
+	}, "mysqld", " = ")
+}
+
+// editConfig replaces the lines defining settings in the section of the file where parse says they apply, and
+// adds the missing ones after the last setting of that section, or at the end of the file when the file has no
+// sections. parse returns the normalized name defined by a line and whether the line is in the section.
+func editConfig(path string, settings []setting, parse func(line, group string) (string, bool), section, separator string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	var lines []string
+	group := ""
+	end := -1
+	found := map[string]bool{}
+	changed := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			group = strings.ToLower(strings.TrimSpace(trimmed[1 : len(trimmed)-1]))
+			lines = append(lines, line)
+			if section != "" && group == section {
+				end = len(lines)
+			}
+			continue
+		}
+		name, in := parse(line, group)
+		if in && name != "" && section != "" {
+			end = len(lines) + 1
+		}
+		replaced := false
+		for _, s := range settings {
+			if in && name == s.name {
+				want := s.name + separator + s.value
+				if found[s.name] {
+					// a later duplicate would win over the line just set
+					lines = append(lines, "# "+line+" # disabled by vcert")
+					changed = true
+				} else {
+					if line != want {
+						line = want
+						changed = true
+					}
+					lines = append(lines, line)
+				}
+				found[s.name] = true
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			lines = append(lines, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, err
+	}
+	var added []string
+	for _, s := range settings {
+		if !found[s.name] {
+			added = append(added, s.name+separator+s.value)
+		}
+	}
+	if len(added) > 0 {
+		added = append([]string{"# added by vcert"}, added...)
+		if end < 0 {
+			if section != "" {
+				added = append([]string{"", "[" + section + "]"}, added...)
+			}
+			end = len(lines)
+		}
+		lines = append(lines[:end], append(added, lines[end:]...)...)
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	return true, writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), fi.Mode().Perm())
+}
+
+// pgParameter returns the lower case name of the parameter of a line of postgresql.conf, which separates it from
+// the value with spaces or an equal sign
+func pgParameter(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+	if i := strings.IndexAny(line, " \t="); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ToLower(line)
+}
+
+// mysqlOption returns the name of the option of a line of an option file, with dashes changed to underscores
+// since both are accepted
+func mysqlOption(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!") {
+		return ""
+	}
+	if i := strings.Index(line, "="); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(line)), "-", "_")
+}
+
+// pgQuote quotes a value of postgresql.conf
+func pgQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// sqlQuote quotes a string literal for MySQL
+func sqlQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
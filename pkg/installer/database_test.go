@@ -0,0 +1,189 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeCommand writes a script recording its arguments to dir/args
+func fakeCommand(t *testing.T, dir string, status int) string {
+	path := filepath.Join(dir, "fake-command")
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\nexit " + strconv.Itoa(status) + "\n"
+	err := ioutil.WriteFile(path, []byte(script), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPostgreSQLInstaller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "postgresql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "postgresql.conf")
+	err = ioutil.WriteFile(conf, []byte("listen_addresses = '*'\n#ssl = off\nssl = off\nssl_cert_file = 'server.crt'\nssl_cert_file='other.crt'\n"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pi := &PostgreSQLInstaller{
+		CertFile:   filepath.Join(dir, "server.crt"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		CAFile:     filepath.Join(dir, "root.crt"),
+		Owner:      current.Username,
+		ConfigFile: conf,
+		DataDir:    "/var/lib/postgresql/data",
+		PgCtl:      fakeCommand(t, dir, 0),
+	}
+	err = pi.Install(context.Background(), issueTestCertificate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(pi.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("key is readable by others: %s", fi.Mode())
+	}
+	data, err := ioutil.ReadFile(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "listen_addresses = '*'\n#ssl = off\nssl = on\nssl_cert_file = '" + pi.CertFile + "'\n# ssl_cert_file='other.crt' # disabled by vcert\n" +
+		"# added by vcert\nssl_key_file = '" + pi.KeyFile + "'\nssl_ca_file = '" + pi.CAFile + "'\n"
+	if string(data) != expected {
+		t.Fatalf("unexpected configuration:\n%s", data)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(args)) != "reload -s -D /var/lib/postgresql/data" {
+		t.Fatalf("unexpected pg_ctl arguments %s", args)
+	}
+
+	// the configuration is left alone when it's already set
+	changed, err := configurePostgreSQL(conf, []setting{{"ssl", "on"}})
+	if err != nil || changed {
+		t.Fatalf("configuration changed again: %v", err)
+	}
+}
+
+func TestDatabaseInstallerVerifiesPair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "postgresql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pcc := issueTestCertificate(t)
+	pcc.PrivateKey = issueTestCertificate(t).PrivateKey
+	pi := &PostgreSQLInstaller{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+		PgCtl:    fakeCommand(t, dir, 0),
+	}
+	err = pi.Install(context.Background(), pcc)
+	if err == nil || !strings.Contains(err.Error(), "isn't reloaded") {
+		t.Fatalf("expected a verification error, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "args")); !os.IsNotExist(err) {
+		t.Fatal("server was reloaded with a broken pair")
+	}
+
+	pcc.PrivateKey = ""
+	if err = pi.Install(context.Background(), pcc); err == nil {
+		t.Fatal("expected an error for a certificate without a private key")
+	}
+}
+
+func TestMySQLInstaller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "my.cnf")
+	err = ioutil.WriteFile(conf, []byte("[client]\nssl-cert = client.crt\n\n[mysqld]\ndatadir = /var/lib/mysql\nssl-cert = old.crt\n\n[mysqldump]\nquick\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := &MySQLInstaller{
+		CertFile:     filepath.Join(dir, "server-cert.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ConfigFile:   conf,
+		DefaultsFile: filepath.Join(dir, "admin.cnf"),
+		Client:       fakeCommand(t, dir, 0),
+	}
+	err = mi.Install(context.Background(), issueTestCertificate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[client]\nssl-cert = client.crt\n\n[mysqld]\ndatadir = /var/lib/mysql\nssl_cert = " + mi.CertFile +
+		"\n# added by vcert\nssl_key = " + mi.KeyFile + "\n\n[mysqldump]\nquick\n"
+	if string(data) != expected {
+		t.Fatalf("unexpected configuration:\n%s", data)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(args), "--defaults-extra-file="+mi.DefaultsFile+" --batch -e SET GLOBAL ssl_cert = '") ||
+		!strings.HasSuffix(strings.TrimSpace(string(args)), "; ALTER INSTANCE RELOAD TLS") {
+		t.Fatalf("unexpected mysql arguments %s", args)
+	}
+
+	// a file without the [mysqld] group gets one, MariaDB flushes
+	err = ioutil.WriteFile(conf, []byte("[client]\nport = 3306\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi.MariaDB = true
+	mi.DefaultsFile = ""
+	mi.Client = fakeCommand(t, dir, 1)
+	err = mi.Install(context.Background(), issueTestCertificate(t))
+	if err == nil || !strings.Contains(err.Error(), "failed to reload") {
+		t.Fatalf("expected a reload error, got %v", err)
+	}
+	data, err = ioutil.ReadFile(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "\n[mysqld]\n# added by vcert\nssl_cert = "+mi.CertFile+"\nssl_key = "+mi.KeyFile+"\n") {
+		t.Fatalf("unexpected configuration:\n%s", data)
+	}
+	if args, _ = ioutil.ReadFile(filepath.Join(dir, "args")); strings.TrimSpace(string(args)) != "--batch -e FLUSH SSL" {
+		t.Fatalf("unexpected mysql arguments %s", args)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	defaultDockerHost = "unix:///var/run/docker.sock"
+	// LabelSecretName labels the Swarm secrets of a DockerSecretInstaller with its SecretName
+	LabelSecretName = "com.venafi.vcert.name"
+)
+
+// DockerSecretInstaller stores the certificate with its chain, and the private key when present, as Swarm secrets.
+// Swarm secrets can't be changed, so each certificate gets new secrets named SecretName+".crt." and
+// SecretName+".key." followed by the serial number of the certificate. The secrets of the previous certificate used
+// by Services are replaced with the new ones, which rolls the services out, and the unused ones are removed.
+type DockerSecretInstaller struct {
+	SecretName string
+	// Host is the Docker API endpoint, unix:///path or tcp://host:port. It defaults to $DOCKER_HOST, then to the
+	// local socket.
+	Host string
+	// Services are the names or IDs of the Swarm services using the secrets
+	Services []string
+	// Labels are added to the secrets
+	Labels map[string]string
+}
+
+func (d *DockerSecretInstaller) Name() string {
+	return "docker-secret:" + d.SecretName
+}
+
+func (d *DockerSecretInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	cert, err := leafCertificate(pcc)
+	if err != nil {
+		return err
+	}
+	api, err := newDockerAPI(d.Host)
+	if err != nil {
+		return err
+	}
+	serial := strings.ToLower(cert.SerialNumber.Text(16))
+	created := make(map[string]dockerSecretRef)
+	data := map[string]string{".crt.": pcc.Certificate + strings.Join(pcc.Chain, "")}
+	if pcc.PrivateKey != "" {
+		data[".key."] = pcc.PrivateKey
+	}
+	for kind, content := range data {
+		ref, err := d.createSecret(ctx, api, d.SecretName+kind+serial, content)
+		if err != nil {
+			return err
+		}
+		created[kind] = ref
+	}
+	for _, service := range d.Services {
+		err = d.updateService(ctx, api, service, created)
+		if err != nil {
+			return err
+		}
+	}
+	d.removeUnused(ctx, api, created)
+	return nil
+}
+
+type dockerSecretRef struct {
+	ID   string
+	Name string
+}
+
+func (d *DockerSecretInstaller) createSecret(ctx context.Context, api *dockerAPI, name, content string) (dockerSecretRef, error) {
+	labels := map[string]string{LabelSecretName: d.SecretName}
+	for k, v := range d.Labels {
+		labels[k] = v
+	}
+	spec := struct {
+		Name   string
+		Labels map[string]string
+		Data   []byte
+	}{name, labels, []byte(content)}
+	var created struct{ ID string }
+	err := api.do(ctx, http.MethodPost, "/secrets/create", spec, &created)
+	if e, ok := err.(dockerError); ok && e.code == http.StatusConflict {
+		// the certificate was installed before, its secret is reused
+		err = api.do(ctx, http.MethodGet, "/secrets/"+url.PathEscape(name), nil, &created)
+	}
+	if err != nil {
+		return dockerSecretRef{}, fmt.Errorf("failed to create Docker secret %s: %w", name, err)
+	}
+	return dockerSecretRef{ID: created.ID, Name: name}, nil
+}
+
+// updateService points the secret references of the service to the previous secrets to the created ones. The spec
+// is handled as a map so that the fields this package doesn't know about are kept.
+func (d *DockerSecretInstaller) updateService(ctx context.Context, api *dockerAPI, service string, created map[string]dockerSecretRef) error {
+	var inspect struct {
+		ID      string
+		Version struct{ Index uint64 }
+		Spec    map[string]interface{}
+	}
+	err := api.do(ctx, http.MethodGet, "/services/"+url.PathEscape(service), nil, &inspect)
+	if err != nil {
+		return fmt.Errorf("failed to read Docker service %s: %w", service, err)
+	}
+	template, _ := inspect.Spec["TaskTemplate"].(map[string]interface{})
+	container, _ := template["ContainerSpec"].(map[string]interface{})
+	secrets, _ := container["Secrets"].([]interface{})
+	changed := false
+	for _, s := range secrets {
+		secret, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := secret["SecretName"].(string)
+		for kind, ref := range created {
+			if strings.HasPrefix(name, d.SecretName+kind) && name != ref.Name {
+				secret["SecretName"], secret["SecretID"] = ref.Name, ref.ID
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	path := fmt.Sprintf("/services/%s/update?version=%d", url.PathEscape(inspect.ID), inspect.Version.Index)
+	err = api.do(ctx, http.MethodPost, path, inspect.Spec, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update Docker service %s: %w", service, err)
+	}
+	return nil
+}
+
+// removeUnused removes the secrets of the previous certificates, the ones still used by a service are kept
+func (d *DockerSecretInstaller) removeUnused(ctx context.Context, api *dockerAPI, created map[string]dockerSecretRef) {
+	filters, _ := json.Marshal(map[string][]string{"label": {LabelSecretName + "=" + d.SecretName}})
+	var secrets []struct {
+		ID   string
+		Spec struct{ Name string }
+	}
+	if api.do(ctx, http.MethodGet, "/secrets?filters="+url.QueryEscape(string(filters)), nil, &secrets) != nil {
+		return
+	}
+	for _, s := range secrets {
+		keep := false
+		for _, ref := range created {
+			keep = keep || s.ID == ref.ID
+		}
+		if !keep {
+			// a secret in use can't be removed, it's removed with the next certificate
+			_ = api.do(ctx, http.MethodDelete, "/secrets/"+url.PathEscape(s.ID), nil, nil)
+		}
+	}
+}
+
+// dockerAPI sends requests to the Docker Engine API
+type dockerAPI struct {
+	client *http.Client
+	base   string
+}
+
+type dockerError struct {
+	code    int
+	message string
+}
+
+func (e dockerError) Error() string {
+	return fmt.Sprintf("Docker API: %d %s", e.code, e.message)
+}
+
+func (e dockerError) Unwrap() error {
+	return verror.ServerError
+}
+
+func newDockerAPI(host string) (*dockerAPI, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid Docker host %q", verror.UserDataError, host)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &dockerAPI{client: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		return &dockerAPI{client: http.DefaultClient, base: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported Docker host %q, use unix:// or tcp://", verror.UserDataError, host)
+	}
+}
+
+func (api *dockerAPI) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, api.base+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		var msg struct{ Message string }
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = http.StatusText(resp.StatusCode)
+		}
+		return dockerError{code: resp.StatusCode, message: msg.Message}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
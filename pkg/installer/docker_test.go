@@ -0,0 +1,145 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSwarm stores the secrets and services of a Docker API
+type fakeSwarm struct {
+	mu       sync.Mutex
+	secrets  map[string]string // name by ID
+	inUse    map[string]bool
+	service  map[string]interface{}
+	version  uint64
+	lastSpec map[string]interface{}
+}
+
+func (s *fakeSwarm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/secrets/create":
+		var spec struct {
+			Name   string
+			Labels map[string]string
+			Data   []byte
+		}
+		_ = json.NewDecoder(r.Body).Decode(&spec)
+		for _, name := range s.secrets {
+			if name == spec.Name {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		id := "id-" + spec.Name
+		s.secrets[id] = spec.Name
+		_ = json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case r.Method == http.MethodGet && r.URL.Path == "/secrets":
+		var list []interface{}
+		for id, name := range s.secrets {
+			list = append(list, map[string]interface{}{"ID": id, "Spec": map[string]string{"Name": name}})
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/secrets/"):
+		ref := strings.TrimPrefix(r.URL.Path, "/secrets/")
+		for id, name := range s.secrets {
+			if id == ref || name == ref {
+				_ = json.NewEncoder(w).Encode(map[string]string{"ID": id})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/secrets/"):
+		id := strings.TrimPrefix(r.URL.Path, "/secrets/")
+		if s.inUse[id] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(s.secrets, id)
+	case r.Method == http.MethodGet && r.URL.Path == "/services/web":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"ID": "svc1", "Version": map[string]uint64{"Index": s.version}, "Spec": s.service})
+	case r.Method == http.MethodPost && r.URL.Path == "/services/svc1/update":
+		if r.URL.Query().Get("version") != "7" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&s.lastSpec)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestDockerSecretInstaller(t *testing.T) {
+	swarm := &fakeSwarm{
+		secrets: map[string]string{"old-crt": "web.crt.01", "old-key": "web.key.01", "other": "db.crt.01"},
+		inUse:   map[string]bool{"old-crt": true},
+		version: 7,
+	}
+	err := json.Unmarshal([]byte(`{"Name":"web","Mode":{"Replicated":{"Replicas":2}},"TaskTemplate":{"ContainerSpec":{
+		"Image":"nginx","Secrets":[
+			{"File":{"Name":"/run/secrets/tls.crt"},"SecretID":"old-crt","SecretName":"web.crt.01"},
+			{"File":{"Name":"/run/secrets/tls.key"},"SecretID":"old-key","SecretName":"web.key.01"},
+			{"File":{"Name":"/run/secrets/db"},"SecretID":"other","SecretName":"db.crt.01"}]}}}`), &swarm.service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(swarm)
+	defer server.Close()
+
+	pcc := issueTestCertificate(t)
+	cert, err := leafCertificate(pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := strings.ToLower(cert.SerialNumber.Text(16))
+	d := &DockerSecretInstaller{SecretName: "web", Host: "tcp://" + server.Listener.Addr().String(), Services: []string{"web"}}
+	err = d.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swarm.secrets["id-web.crt."+serial] == "" || swarm.secrets["id-web.key."+serial] == "" {
+		t.Fatalf("secrets of the certificate weren't created: %v", swarm.secrets)
+	}
+	if _, ok := swarm.secrets["old-key"]; ok {
+		t.Fatal("unused secret of the previous certificate should be removed")
+	}
+	if _, ok := swarm.secrets["old-crt"]; !ok {
+		t.Fatal("secret in use shouldn't be removed")
+	}
+
+	data, _ := json.Marshal(swarm.lastSpec)
+	spec := string(data)
+	for _, s := range []string{`"SecretName":"web.crt.` + serial, `"SecretID":"id-web.key.` + serial, `"SecretName":"db.crt.01"`, `"Replicas":2`} {
+		if !strings.Contains(spec, s) {
+			t.Fatalf("updated service spec lacks %s: %s", s, spec)
+		}
+	}
+
+	// installing the same certificate again reuses its secrets
+	err = d.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	defaultConsulAddress = "http://127.0.0.1:8500"
+	defaultVaultAddress  = "https://127.0.0.1:8200"
+	defaultNomadAddress  = "http://127.0.0.1:4646"
+	defaultVaultMount    = "secret"
+	hashicorpTimeout     = 30 * time.Second
+	// NomadMetaKey is the job meta changed by NomadJob.Update, which makes Nomad deploy the job again
+	NomadMetaKey = "vcert_certificate"
+)
+
+// ConsulKVInstaller writes the certificate, its chain and its private key, when present, to the keys cert.pem,
+// chain.pem and key.pem under Prefix in a single transaction, so consul-template renders them together.
+type ConsulKVInstaller struct {
+	// Address is the Consul HTTP API, $CONSUL_HTTP_ADDR or http://127.0.0.1:8500 by default
+	Address string
+	// Token is the ACL token, $CONSUL_HTTP_TOKEN by default
+	Token  string
+	Prefix string
+	// Datacenter is the datacenter of the keys, the one of the agent by default
+	Datacenter string
+	HTTPClient *http.Client
+}
+
+func (c *ConsulKVInstaller) Name() string {
+	return "consul-kv:" + c.Prefix
+}
+
+func (c *ConsulKVInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	values := map[string]string{"cert.pem": pcc.Certificate, "chain.pem": strings.Join(pcc.Chain, "")}
+	if pcc.PrivateKey != "" {
+		values["key.pem"] = pcc.PrivateKey
+	}
+	type kvOp struct {
+		Verb  string
+		Key   string
+		Value []byte
+	}
+	var ops []map[string]kvOp
+	for _, name := range []string{"cert.pem", "chain.pem", "key.pem"} {
+		if v, ok := values[name]; ok {
+			ops = append(ops, map[string]kvOp{"KV": {Verb: "set", Key: strings.Trim(c.Prefix, "/") + "/" + name, Value: []byte(v)}})
+		}
+	}
+	address := firstNonEmpty(c.Address, os.Getenv("CONSUL_HTTP_ADDR"), defaultConsulAddress)
+	target := withScheme(address, "http") + "/v1/txn"
+	if c.Datacenter != "" {
+		target += "?dc=" + url.QueryEscape(c.Datacenter)
+	}
+	headers := map[string]string{"X-Consul-Token": firstNonEmpty(c.Token, os.Getenv("CONSUL_HTTP_TOKEN"))}
+	err := sendJSON(ctx, c.HTTPClient, http.MethodPut, target, headers, ops, nil)
+	if err != nil {
+		return fmt.Errorf("failed to write Consul keys %s: %w", c.Prefix, err)
+	}
+	return nil
+}
+
+// VaultKVInstaller writes the certificate, its chain and its private key, when present, as the fields certificate,
+// ca_chain and private_key of a secret of a Vault KV secrets engine, like the PKI secrets engine returns them
+type VaultKVInstaller struct {
+	// Address is the Vault API, $VAULT_ADDR or https://127.0.0.1:8200 by default
+	Address string
+	// Token is the Vault token, $VAULT_TOKEN by default
+	Token string
+	// Namespace is the Vault Enterprise namespace, $VAULT_NAMESPACE by default
+	Namespace string
+	// Mount is the path of the KV secrets engine, secret by default
+	Mount string
+	Path  string
+	// Version is the version of the KV secrets engine, 2 by default
+	Version    int
+	HTTPClient *http.Client
+}
+
+func (v *VaultKVInstaller) Name() string {
+	return "vault-kv:" + v.mount() + "/" + strings.Trim(v.Path, "/")
+}
+
+func (v *VaultKVInstaller) mount() string {
+	return strings.Trim(firstNonEmpty(v.Mount, defaultVaultMount), "/")
+}
+
+func (v *VaultKVInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	cert, err := leafCertificate(pcc)
+	if err != nil {
+		return err
+	}
+	data := map[string]interface{}{
+		"certificate":   pcc.Certificate,
+		"ca_chain":      strings.Join(pcc.Chain, ""),
+		"serial_number": strings.ToUpper(cert.SerialNumber.Text(16)),
+		"expiration":    cert.NotAfter.Unix(),
+	}
+	if pcc.PrivateKey != "" {
+		data["private_key"] = pcc.PrivateKey
+	}
+	address := firstNonEmpty(v.Address, os.Getenv("VAULT_ADDR"), defaultVaultAddress)
+	target := withScheme(address, "https") + "/v1/" + v.mount() + "/"
+	var body interface{} = data
+	if v.Version == 1 {
+		target += strings.Trim(v.Path, "/")
+	} else {
+		target += "data/" + strings.Trim(v.Path, "/")
+		body = map[string]interface{}{"data": data}
+	}
+	headers := map[string]string{
+		"X-Vault-Token":     firstNonEmpty(v.Token, os.Getenv("VAULT_TOKEN")),
+		"X-Vault-Namespace": firstNonEmpty(v.Namespace, os.Getenv("VAULT_NAMESPACE")),
+	}
+	err = sendJSON(ctx, v.HTTPClient, http.MethodPost, target, headers, body, nil)
+	if err != nil {
+		return fmt.Errorf("failed to write Vault secret %s: %w", v.Path, err)
+	}
+	return nil
+}
+
+// NomadJob deploys a Nomad job again once its certificate is installed, so that the templates of its tasks read the
+// new certificate from Consul or Vault. The job meta NomadMetaKey is set to the serial number of the certificate,
+// the allocations are then replaced following the update strategy of the job.
+type NomadJob struct {
+	// Address is the Nomad HTTP API, $NOMAD_ADDR or http://127.0.0.1:4646 by default
+	Address string
+	// Token is the ACL token, $NOMAD_TOKEN by default
+	Token string
+	// Namespace is the namespace of the job, $NOMAD_NAMESPACE or the default namespace by default
+	Namespace  string
+	Job        string
+	HTTPClient *http.Client
+}
+
+// Update registers the job again with its meta changed, it does nothing when the job already uses the certificate
+func (n *NomadJob) Update(ctx context.Context, pcc *certificate.PEMCollection) error {
+	cert, err := leafCertificate(pcc)
+	if err != nil {
+		return err
+	}
+	address := firstNonEmpty(n.Address, os.Getenv("NOMAD_ADDR"), defaultNomadAddress)
+	target := withScheme(address, "http") + "/v1/job/" + url.PathEscape(n.Job)
+	if ns := firstNonEmpty(n.Namespace, os.Getenv("NOMAD_NAMESPACE")); ns != "" {
+		target += "?namespace=" + url.QueryEscape(ns)
+	}
+	headers := map[string]string{"X-Nomad-Token": firstNonEmpty(n.Token, os.Getenv("NOMAD_TOKEN"))}
+
+	// the job is handled as a map so that the fields this package doesn't know about are kept
+	var job map[string]interface{}
+	err = sendJSON(ctx, n.HTTPClient, http.MethodGet, target, headers, nil, &job)
+	if err != nil {
+		return fmt.Errorf("failed to read Nomad job %s: %w", n.Job, err)
+	}
+	serial := strings.ToUpper(cert.SerialNumber.Text(16))
+	meta, _ := job["Meta"].(map[string]interface{})
+	if meta == nil {
+		meta = make(map[string]interface{})
+	}
+	if meta[NomadMetaKey] == serial {
+		return nil
+	}
+	meta[NomadMetaKey] = serial
+	job["Meta"] = meta
+	err = sendJSON(ctx, n.HTTPClient, http.MethodPost, target, headers, map[string]interface{}{"Job": job}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update Nomad job %s: %w", n.Job, err)
+	}
+	return nil
+}
+
+// sendJSON sends in as JSON with the non-empty headers and decodes the response into out when it's set
+func sendJSON(ctx context.Context, client *http.Client, method, target string, headers map[string]string, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, hashicorpTimeout)
+	defer cancel()
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s: %s", verror.AuthError, resp.Status, strings.TrimSpace(string(data)))
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("%w: %s: %s", verror.ServerError, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(data, out)
+	if err != nil {
+		return fmt.Errorf("%w: invalid response: %s", verror.ServerError, err)
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// withScheme adds scheme to an address without one, e.g. consul.example.com:8500, and removes the trailing slash
+func withScheme(address, scheme string) string {
+	if !strings.Contains(address, "://") {
+		address = scheme + "://" + address
+	}
+	return strings.TrimSuffix(address, "/")
+}
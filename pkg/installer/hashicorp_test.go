@@ -0,0 +1,147 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestConsulKVInstaller(t *testing.T) {
+	var ops []struct {
+		KV struct {
+			Verb  string
+			Key   string
+			Value []byte
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v1/txn" || r.URL.Query().Get("dc") != "dc2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("X-Consul-Token") != "acl" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&ops)
+	}))
+	defer server.Close()
+
+	pcc := issueTestCertificate(t)
+	c := &ConsulKVInstaller{Address: server.URL, Token: "acl", Prefix: "/certs/web/", Datacenter: "dc2"}
+	err := c.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 || ops[0].KV.Key != "certs/web/cert.pem" || string(ops[0].KV.Value) != pcc.Certificate ||
+		ops[2].KV.Key != "certs/web/key.pem" || string(ops[2].KV.Value) != pcc.PrivateKey || ops[1].KV.Verb != "set" {
+		t.Fatalf("unexpected transaction %+v", ops)
+	}
+	c.Token = "wrong"
+	err = c.Install(context.Background(), pcc)
+	if !errors.Is(err, verror.AuthError) {
+		t.Fatalf("expected an auth error, got %v", err)
+	}
+}
+
+func TestVaultKVInstaller(t *testing.T) {
+	secrets := make(map[string]map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		secrets[r.URL.Path] = body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	pcc := issueTestCertificate(t)
+	v := &VaultKVInstaller{Address: server.URL, Token: "s.token", Namespace: "team", Path: "web/tls"}
+	err := v.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := secrets["/v1/secret/data/web/tls"]["data"].(map[string]interface{})
+	if data["certificate"] != pcc.Certificate || data["private_key"] != pcc.PrivateKey || data["serial_number"] == "" {
+		t.Fatalf("unexpected KV v2 secret %v", secrets)
+	}
+
+	v.Mount, v.Version = "kv/", 1
+	err = v.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secrets["/v1/kv/web/tls"]["certificate"] != pcc.Certificate {
+		t.Fatalf("unexpected KV v1 secret %v", secrets)
+	}
+}
+
+func TestNomadJobUpdate(t *testing.T) {
+	job := `{"ID":"web","Type":"service","Meta":{"owner":"web-team"},"TaskGroups":[{"Name":"web","Count":3}]}`
+	var registered []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/job/web" || r.URL.Query().Get("namespace") != "prod" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(job))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var update struct{ Job json.RawMessage }
+		_ = json.Unmarshal(body, &update)
+		job = string(update.Job)
+		registered = append(registered, job)
+		_, _ = w.Write([]byte(`{"EvalID":"e1"}`))
+	}))
+	defer server.Close()
+
+	pcc := issueTestCertificate(t)
+	cert, err := leafCertificate(pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &NomadJob{Address: server.URL, Namespace: "prod", Job: "web"}
+	err = n.Update(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) != 1 || !strings.Contains(registered[0], `"vcert_certificate":"`+strings.ToUpper(cert.SerialNumber.Text(16))+`"`) ||
+		!strings.Contains(registered[0], `"owner":"web-team"`) || !strings.Contains(registered[0], `"Count":3`) {
+		t.Fatalf("unexpected job update %v", registered)
+	}
+	err = n.Update(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registered) != 1 {
+		t.Fatal("job already using the certificate shouldn't be deployed again")
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package installer delivers issued certificates to the places that use them and checks that they are served.
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+// Installer puts a certificate on a single target
+type Installer interface {
+	// Name identifies the target in logs and errors
+	Name() string
+	// Install delivers the certificate, its chain and its private key (when present) to the target
+	Install(ctx context.Context, pcc *certificate.PEMCollection) error
+}
+
+// FileInstaller writes the certificate, chain and private key as PEM files. Empty paths are skipped and when
+// ChainFile is empty the chain is appended to CertFile.
+type FileInstaller struct {
+	CertFile  string
+	ChainFile string
+	KeyFile   string
+}
+
+func (fi *FileInstaller) Name() string {
+	return "file:" + fi.CertFile
+}
+
+func (fi *FileInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cert := pcc.Certificate
+	if fi.ChainFile == "" {
+		cert += strings.Join(pcc.Chain, "")
+	} else {
+		err := writeFileAtomic(fi.ChainFile, []byte(strings.Join(pcc.Chain, "")), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	if fi.KeyFile != "" && pcc.PrivateKey != "" {
+		err := writeFileAtomic(fi.KeyFile, []byte(pcc.PrivateKey), 0600)
+		if err != nil {
+			return err
+		}
+	}
+	if fi.CertFile == "" {
+		return fmt.Errorf("certificate file is not specified")
+	}
+	return writeFileAtomic(fi.CertFile, []byte(cert), 0644)
+}
+
+// writeFileAtomic replaces name with data through a rename, so a reader never sees a partially written file
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Media types of the artifacts pushed by an OCIInstaller
+const (
+	OCIArtifactType       = "application/vnd.venafi.certificate.v1"
+	OCICertificateType    = "application/x-pem-file"
+	OCIPrivateKeyType     = "application/vnd.venafi.private-key.v1+pem"
+	ociManifestType       = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyConfigType    = "application/vnd.oci.empty.v1+json"
+	ociTitleAnnotation    = "org.opencontainers.image.title"
+	ociCreatedAnnotation  = "org.opencontainers.image.created"
+	defaultOCITag         = "latest"
+	ociCertificateFile    = "cert.pem"
+	ociPrivateKeyFile     = "key.pem"
+	ociEmptyConfigContent = "{}"
+)
+
+// OCIInstaller pushes the certificate with its chain to an OCI registry as an artifact, the way ORAS does, so that
+// "oras pull" writes it to cert.pem. The private key is only pushed, as key.pem, when IncludeKey is set: anyone who
+// can pull the artifact gets it.
+type OCIInstaller struct {
+	// Reference is the repository and tag of the artifact, e.g. registry.example.com/certs/web:v1, the tag
+	// defaults to latest
+	Reference  string
+	Username   string
+	Password   string
+	IncludeKey bool
+	// PlainHTTP connects to the registry without TLS, e.g. to a local test registry
+	PlainHTTP bool
+	// HTTPClient sends the requests, http.DefaultClient by default
+	HTTPClient *http.Client
+}
+
+func (o *OCIInstaller) Name() string {
+	return "oci:" + o.Reference
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int               `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func (o *OCIInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	cert, err := leafCertificate(pcc)
+	if err != nil {
+		return err
+	}
+	reg, err := o.registry()
+	if err != nil {
+		return err
+	}
+	files := []struct{ name, mediaType, content string }{
+		{ociCertificateFile, OCICertificateType, pcc.Certificate + strings.Join(pcc.Chain, "")},
+	}
+	if o.IncludeKey && pcc.PrivateKey != "" {
+		files = append(files, struct{ name, mediaType, content string }{ociPrivateKeyFile, OCIPrivateKeyType, pcc.PrivateKey})
+	}
+	config, err := reg.pushBlob(ctx, ociEmptyConfigType, []byte(ociEmptyConfigContent))
+	if err != nil {
+		return err
+	}
+	manifest := struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType"`
+		ArtifactType  string            `json:"artifactType"`
+		Config        ociDescriptor     `json:"config"`
+		Layers        []ociDescriptor   `json:"layers"`
+		Annotations   map[string]string `json:"annotations"`
+	}{
+		SchemaVersion: 2,
+		MediaType:     ociManifestType,
+		ArtifactType:  OCIArtifactType,
+		Config:        config,
+		Annotations:   map[string]string{ociCreatedAnnotation: cert.NotBefore.UTC().Format("2006-01-02T15:04:05Z")},
+	}
+	for _, f := range files {
+		layer, err := reg.pushBlob(ctx, f.mediaType, []byte(f.content))
+		if err != nil {
+			return err
+		}
+		layer.Annotations = map[string]string{ociTitleAnnotation: f.name}
+		manifest.Layers = append(manifest.Layers, layer)
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	resp, err := reg.send(ctx, http.MethodPut, "/manifests/"+reg.tag, ociManifestType, data)
+	if err != nil {
+		return fmt.Errorf("failed to push the manifest of %s: %w", o.Reference, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ociRegistry sends the requests of a repository, authenticating with basic credentials or with a bearer token
+// obtained from the token service the registry points to
+type ociRegistry struct {
+	installer  *OCIInstaller
+	base       string
+	repository string
+	tag        string
+	token      string
+	basic      bool
+}
+
+func (o *OCIInstaller) registry() (*ociRegistry, error) {
+	ref := o.Reference
+	i := strings.Index(ref, "/")
+	if i <= 0 || strings.Contains(ref, "@") {
+		return nil, fmt.Errorf("%w: invalid OCI reference %q, expected registry/repository[:tag]", verror.UserDataError, ref)
+	}
+	host, repository := ref[:i], ref[i+1:]
+	tag := defaultOCITag
+	if j := strings.LastIndex(repository, ":"); j > 0 {
+		repository, tag = repository[:j], repository[j+1:]
+	}
+	if repository == "" || tag == "" {
+		return nil, fmt.Errorf("%w: invalid OCI reference %q, expected registry/repository[:tag]", verror.UserDataError, ref)
+	}
+	scheme := "https"
+	if o.PlainHTTP {
+		scheme = "http"
+	}
+	return &ociRegistry{installer: o, base: scheme + "://" + host + "/v2/" + repository, repository: repository, tag: tag}, nil
+}
+
+// pushBlob uploads content in a single request unless the registry already has it
+func (r *ociRegistry) pushBlob(ctx context.Context, mediaType string, content []byte) (ociDescriptor, error) {
+	sum := sha256.Sum256(content)
+	desc := ociDescriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: len(content)}
+	resp, err := r.send(ctx, http.MethodHead, "/blobs/"+desc.Digest, "", nil)
+	if err == nil {
+		resp.Body.Close()
+		return desc, nil
+	}
+	resp, err = r.send(ctx, http.MethodPost, "/blobs/uploads/", "", nil)
+	if err != nil {
+		return desc, fmt.Errorf("failed to start the upload of %s: %w", desc.Digest, err)
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		return desc, fmt.Errorf("%w: registry didn't return an upload location", verror.ServerError)
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+	resp, err = r.send(ctx, http.MethodPut, location.String(), "application/octet-stream", content)
+	if err != nil {
+		return desc, fmt.Errorf("failed to upload %s: %w", desc.Digest, err)
+	}
+	resp.Body.Close()
+	return desc, nil
+}
+
+// send sends a request to path, relative to the repository, or to an absolute URL. When the registry asks for
+// credentials, they're sent and the request is retried once. The response is returned when its status is 2xx.
+func (r *ociRegistry) send(ctx context.Context, method, path, contentType string, body []byte) (*http.Response, error) {
+	target := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		target = r.base + path
+	}
+	client := r.installer.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		} else if r.basic {
+			req.SetBasicAuth(r.installer.Username, r.installer.Password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+				err = r.authenticate(ctx, challenge)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				r.basic = r.installer.Username != ""
+			}
+			continue
+		}
+		if resp.StatusCode/100 != 2 {
+			data, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+				return nil, fmt.Errorf("%w: registry refused the credentials: %s", verror.AuthError, strings.TrimSpace(string(data)))
+			}
+			return nil, fmt.Errorf("%w: registry returned %s: %s", verror.ServerError, resp.Status, strings.TrimSpace(string(data)))
+		}
+		return resp, nil
+	}
+}
+
+// authenticate gets a token for the repository from the token service of a bearer challenge
+func (r *ociRegistry) authenticate(ctx context.Context, challenge string) error {
+	params := make(map[string]string)
+	for _, p := range strings.Split(challenge[len("bearer "):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("%w: invalid registry authentication challenge %q", verror.ServerError, challenge)
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", "repository:"+r.repository+":pull,push")
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if r.installer.Username != "" {
+		req.SetBasicAuth(r.installer.Username, r.installer.Password)
+	}
+	client := r.installer.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: registry token service returned %s", verror.AuthError, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return fmt.Errorf("%w: invalid registry token: %s", verror.ServerError, err)
+	}
+	r.token = token.Token
+	if r.token == "" {
+		r.token = token.AccessToken
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// fakeRegistry is an OCI registry asking for a bearer token from its token service at /token
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func (reg *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if r.URL.Path == "/token" {
+		user, password, _ := r.BasicAuth()
+		if user != "robot" || password != "secret" || r.URL.Query().Get("scope") != "repository:certs/web:pull,push" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"t0ken"}`))
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer t0ken" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+r.Host+`/token",service="registry.test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	const repo = "/v2/certs/web"
+	switch {
+	case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, repo+"/blobs/"):
+		if _, ok := reg.blobs[strings.TrimPrefix(r.URL.Path, repo+"/blobs/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost && r.URL.Path == repo+"/blobs/uploads/":
+		w.Header().Set("Location", repo+"/blobs/uploads/session1?state=abc")
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodPut && r.URL.Path == repo+"/blobs/uploads/session1":
+		data, _ := ioutil.ReadAll(r.Body)
+		sum := sha256.Sum256(data)
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		if r.URL.Query().Get("digest") != digest || r.URL.Query().Get("state") != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.blobs[digest] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, repo+"/manifests/"):
+		data, _ := ioutil.ReadAll(r.Body)
+		reg.manifests[strings.TrimPrefix(r.URL.Path, repo+"/manifests/")] = data
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestOCIInstaller(t *testing.T) {
+	reg := &fakeRegistry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+	server := httptest.NewServer(reg)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	pcc := issueTestCertificate(t)
+	o := &OCIInstaller{Reference: host + "/certs/web:v1", Username: "robot", Password: "secret", PlainHTTP: true}
+	err := o.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		ArtifactType string
+		Layers       []ociDescriptor
+	}
+	err = json.Unmarshal(reg.manifests["v1"], &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.ArtifactType != OCIArtifactType || len(manifest.Layers) != 1 {
+		t.Fatalf("unexpected manifest %s", reg.manifests["v1"])
+	}
+	layer := manifest.Layers[0]
+	if layer.Annotations[ociTitleAnnotation] != ociCertificateFile || !strings.HasPrefix(string(reg.blobs[layer.Digest]), pcc.Certificate) {
+		t.Fatalf("unexpected certificate layer %+v", layer)
+	}
+
+	o.Reference, o.IncludeKey = host+"/certs/web", true
+	err = o.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(reg.manifests["latest"], &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Layers) != 2 || string(reg.blobs[manifest.Layers[1].Digest]) != pcc.PrivateKey {
+		t.Fatalf("private key wasn't pushed: %s", reg.manifests["latest"])
+	}
+
+	o.Password = "wrong"
+	err = o.Install(context.Background(), pcc)
+	if !errors.Is(err, verror.AuthError) {
+		t.Fatalf("expected an auth error, got %v", err)
+	}
+	o.Reference = "web:v1"
+	err = o.Install(context.Background(), pcc)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error for an invalid reference, got %v", err)
+	}
+}
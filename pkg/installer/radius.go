@@ -0,0 +1,224 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// RADIUSServer is the RADIUS server whose EAP-TLS files a RADIUSInstaller writes
+type RADIUSServer string
+
+const (
+	// RADIUSFreeRADIUS writes server.pem, with the intermediates, server.key, ca.pem and the optional dh file the
+	// eap module of FreeRADIUS points at
+	RADIUSFreeRADIUS RADIUSServer = "freeradius"
+	// RADIUSNPS writes server.pfx, the PKCS#12 imported in the machine store for the Network Policy Server, and
+	// ca.cer, the chain its clients must trust
+	RADIUSNPS RADIUSServer = "nps"
+)
+
+// ParseRADIUSServer returns the RADIUS server named s, freeradius when s is empty
+func ParseRADIUSServer(s string) (RADIUSServer, error) {
+	switch RADIUSServer(strings.ToLower(s)) {
+	case "", RADIUSFreeRADIUS:
+		return RADIUSFreeRADIUS, nil
+	case RADIUSNPS:
+		return RADIUSNPS, nil
+	}
+	return "", fmt.Errorf("%w: unknown RADIUS server %q, it's freeradius or nps", verror.UserDataError, s)
+}
+
+// RADIUSInstaller writes the EAP-TLS server files of a RADIUS server to Dir. The certificate is checked to be valid
+// for server authentication before anything is written: supplicants, Windows ones first, refuse a RADIUS server
+// certificate without the serverAuth extended key usage.
+type RADIUSInstaller struct {
+	Dir    string
+	Server RADIUSServer
+	// Owner is the "user" or "user:group" owning the FreeRADIUS files, usually freerad or radiusd
+	Owner string
+	// Password protects the PKCS#12 of NPS, it's required
+	Password string
+	// DHParams writes the RFC 7919 ffdhe group of 2048, 3072 or 4096 bits to the dh file of FreeRADIUS when it's set
+	DHParams int
+}
+
+func (ri *RADIUSInstaller) Name() string {
+	return "radius:" + string(ri.Server) + ":" + ri.Dir
+}
+
+func (ri *RADIUSInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ri.Dir == "" {
+		return fmt.Errorf("%w: the directory of the RADIUS files is required", verror.UserDataError)
+	}
+	if pcc.PrivateKey == "" {
+		return fmt.Errorf("%w: certificate has no private key, a RADIUS server needs one", verror.UserDataError)
+	}
+	cert, err := checkRADIUSCertificate(pcc.Certificate)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(ri.Dir, 0755); err != nil {
+		return err
+	}
+	switch ri.Server {
+	case "", RADIUSFreeRADIUS:
+		var dh string
+		if ri.DHParams != 0 {
+			if dh = ffdheParams[ri.DHParams]; dh == "" {
+				return fmt.Errorf("%w: unsupported DH parameters size %d, it's 2048, 3072 or 4096", verror.UserDataError, ri.DHParams)
+			}
+		}
+		err = writeServerFiles(ctx, pcc, filepath.Join(ri.Dir, "server.pem"), filepath.Join(ri.Dir, "server.key"), filepath.Join(ri.Dir, "ca.pem"), ri.Owner)
+		if err != nil || dh == "" {
+			return err
+		}
+		name := filepath.Join(ri.Dir, "dh")
+		if err = writeFileAtomic(name, []byte(dh), 0644); err != nil {
+			return err
+		}
+		if ri.Owner != "" {
+			uid, gid, err := lookupOwner(ri.Owner)
+			if err != nil {
+				return err
+			}
+			return os.Chown(name, uid, gid)
+		}
+		return nil
+	case RADIUSNPS:
+		if ri.Password == "" {
+			return fmt.Errorf("%w: a password is required to protect the PKCS#12 of NPS", verror.UserDataError)
+		}
+		key, err := parseRADIUSKey(pcc.PrivateKey)
+		if err != nil {
+			return err
+		}
+		var chain []*x509.Certificate
+		for _, c := range pcc.Chain {
+			b, _ := pem.Decode([]byte(c))
+			if b == nil {
+				return fmt.Errorf("%w: failed to decode chain certificate PEM", verror.UserDataError)
+			}
+			ca, err := x509.ParseCertificate(b.Bytes)
+			if err != nil {
+				return err
+			}
+			chain = append(chain, ca)
+		}
+		pfx, err := pkcs12.Encode(rand.Reader, key, cert, chain, ri.Password)
+		if err != nil {
+			return err
+		}
+		if err = writeFileAtomic(filepath.Join(ri.Dir, "server.pfx"), pfx, 0600); err != nil {
+			return err
+		}
+		return writeFileAtomic(filepath.Join(ri.Dir, "ca.cer"), []byte(strings.Join(pcc.Chain, "")), 0644)
+	}
+	return fmt.Errorf("%w: unknown RADIUS server %q", verror.UserDataError, ri.Server)
+}
+
+// checkRADIUSCertificate parses the certificate and checks it names serverAuth among its extended key usages
+func checkRADIUSCertificate(certPEM string) (*x509.Certificate, error) {
+	b, _ := pem.Decode([]byte(certPEM))
+	if b == nil {
+		return nil, fmt.Errorf("%w: failed to decode certificate PEM", verror.UserDataError)
+	}
+	cert, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageServerAuth {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: certificate %q lacks the serverAuth extended key usage EAP-TLS supplicants require", verror.CertificateCheckError, cert.Subject.CommonName)
+}
+
+func parseRADIUSKey(keyPEM string) (crypto.Signer, error) {
+	b, _ := pem.Decode([]byte(keyPEM))
+	if b == nil {
+		return nil, fmt.Errorf("%w: failed to decode private key PEM", verror.UserDataError)
+	}
+	if x509.IsEncryptedPEMBlock(b) || b.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, fmt.Errorf("%w: the private key is encrypted, it must be decrypted for the PKCS#12", verror.UserDataError)
+	}
+	// the keys decrypted by vcert keep the PKCS#8 encoding under the RSA and EC labels
+	if key, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(b.Bytes); err == nil {
+		return key, nil
+	}
+	return certificate.ParsePKCS8PrivateKey(b.Bytes)
+}
+
+// ffdheParams are the RFC 7919 finite field groups, well known primes which, unlike generated ones, can't hide a
+// weakness and take no time to produce
+var ffdheParams = map[int]string{
+	2048: `-----BEGIN DH PARAMETERS-----
+MIIBCAKCAQEA//////////+t+FRYortKmq/cViAnPTzx2LnFg84tNpWp4TZBFGQz
++8yTnc4kmz75fS/jY2MMddj2gbICrsRhetPfHtXV/WVhJDP1H18GbtCFY2VVPe0a
+87VXE15/V8k1mE8McODmi3fipona8+/och3xWKE2rec1MKzKT0g6eXq8CrGCsyT7
+YdEIqUuyyOP7uWrat2DX9GgdT0Kj3jlN9K5W7edjcrsZCwenyO4KbXCeAvzhzffi
+7MA0BM0oNC9hkXL+nOmFg/+OTxIy7vKBg8P+OxtMb61zO7X8vC7CIAXFjvGDfRaD
+ssbzSibBsu/6iGtCOGEoXJf//////////wIBAg==
+-----END DH PARAMETERS-----
+`,
+	3072: `-----BEGIN DH PARAMETERS-----
+MIIBiAKCAYEA//////////+t+FRYortKmq/cViAnPTzx2LnFg84tNpWp4TZBFGQz
++8yTnc4kmz75fS/jY2MMddj2gbICrsRhetPfHtXV/WVhJDP1H18GbtCFY2VVPe0a
+87VXE15/V8k1mE8McODmi3fipona8+/och3xWKE2rec1MKzKT0g6eXq8CrGCsyT7
+YdEIqUuyyOP7uWrat2DX9GgdT0Kj3jlN9K5W7edjcrsZCwenyO4KbXCeAvzhzffi
+7MA0BM0oNC9hkXL+nOmFg/+OTxIy7vKBg8P+OxtMb61zO7X8vC7CIAXFjvGDfRaD
+ssbzSibBsu/6iGtCOGEfz9zeNVs7ZRkDW7w09N75nAI4YbRvydbmyQd62R0mkff3
+7lmMsPrBhtkcrv4TCYUTknC0EwyTvEN5RPT9RFLi103TZPLiHnH1S/9croKrnJ32
+nuhtK8UiNjoNq8Uhl5sN6todv5pC1cRITgq80Gv6U93vPBsg7j/VnXwl5B0rZsYu
+N///////////AgEC
+-----END DH PARAMETERS-----
+`,
+	4096: `-----BEGIN DH PARAMETERS-----
+MIICCAKCAgEA//////////+t+FRYortKmq/cViAnPTzx2LnFg84tNpWp4TZBFGQz
++8yTnc4kmz75fS/jY2MMddj2gbICrsRhetPfHtXV/WVhJDP1H18GbtCFY2VVPe0a
+87VXE15/V8k1mE8McODmi3fipona8+/och3xWKE2rec1MKzKT0g6eXq8CrGCsyT7
+YdEIqUuyyOP7uWrat2DX9GgdT0Kj3jlN9K5W7edjcrsZCwenyO4KbXCeAvzhzffi
+7MA0BM0oNC9hkXL+nOmFg/+OTxIy7vKBg8P+OxtMb61zO7X8vC7CIAXFjvGDfRaD
+ssbzSibBsu/6iGtCOGEfz9zeNVs7ZRkDW7w09N75nAI4YbRvydbmyQd62R0mkff3
+7lmMsPrBhtkcrv4TCYUTknC0EwyTvEN5RPT9RFLi103TZPLiHnH1S/9croKrnJ32
+nuhtK8UiNjoNq8Uhl5sN6todv5pC1cRITgq80Gv6U93vPBsg7j/VnXwl5B0rZp4e
+8W5vUsMWTfT7eTDp5OWIV7asfV9C1p9tGHdjzx1VA0AEh/VbpX4xzHpxNciG77Qx
+iu1qHgEtnmgyqQdgCpGBMMRtx3j5ca0AOAkpmaMzy4t6Gh25PXFAADwqTs6p+Y0K
+zAqCkc3OyX3Pjsm1Wn+IpGtNtahR9EGC4caKAH5eZV9q//////////8CAQI=
+-----END DH PARAMETERS-----
+`,
+}
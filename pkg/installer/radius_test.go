@@ -0,0 +1,117 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestRADIUSInstaller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radius")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pcc := issueTestCertificate(t)
+
+	ri := &RADIUSInstaller{Dir: filepath.Join(dir, "freeradius"), Server: RADIUSFreeRADIUS, DHParams: 2048}
+	err = ri.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"server.pem", "server.key", "ca.pem", "dh"} {
+		if _, err = os.Stat(filepath.Join(ri.Dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dh, err := ioutil.ReadFile(filepath.Join(ri.Dir, "dh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := pem.Decode(dh); b == nil || b.Type != "DH PARAMETERS" {
+		t.Fatalf("unexpected DH parameters %s", dh)
+	}
+	ri.DHParams = 1024
+	if err = ri.Install(context.Background(), pcc); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error for weak DH parameters, got %v", err)
+	}
+
+	ri = &RADIUSInstaller{Dir: filepath.Join(dir, "nps"), Server: RADIUSNPS}
+	if err = ri.Install(context.Background(), pcc); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error without a password, got %v", err)
+	}
+	ri.Password = "secret"
+	if err = ri.Install(context.Background(), pcc); err != nil {
+		t.Fatal(err)
+	}
+	pfx, err := ioutil.ReadFile(filepath.Join(ri.Dir, "server.pfx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := pkcs12.ToPEM(pfx, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the key, the certificate and its chain
+	if len(blocks) != 2+len(pcc.Chain) {
+		t.Fatalf("unexpected PKCS#12 with %d entries", len(blocks))
+	}
+}
+
+func TestRADIUSInstallerChecksUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "radius")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conn := fake.NewConnector(false, nil)
+	req := &certificate.Request{ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	req.Subject.CommonName = "radius.example.com"
+	if err = conn.GenerateRequest(nil, req); err != nil {
+		t.Fatal(err)
+	}
+	if req.PickupID, err = conn.RequestCertificate(req); err != nil {
+		t.Fatal(err)
+	}
+	pcc, err := conn.RetrieveCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pcc.AddPrivateKey(req.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	ri := &RADIUSInstaller{Dir: dir, Server: RADIUSFreeRADIUS}
+	if err = ri.Install(context.Background(), pcc); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected a certificate check error, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "server.key")); !os.IsNotExist(err) {
+		t.Fatal("files were written for a client certificate")
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Target is a member of a pool that serves the same certificate, e.g. a node behind a load balancer
+type Target struct {
+	Installer Installer
+	// Address is the host:port where the target serves TLS. The target isn't probed when it's empty.
+	Address string
+	// ServerName is sent as SNI when probing. The host part of Address is used when it's empty.
+	ServerName string
+}
+
+// VerifyFunc checks that target serves cert
+type VerifyFunc func(ctx context.Context, target Target, cert *x509.Certificate) error
+
+// RolloutOptions controls how a certificate is spread over a pool of targets
+type RolloutOptions struct {
+	// BatchSize is the number of targets installed at each step. It defaults to 1, i.e. one target at a time.
+	BatchSize int
+	// Percentage is an alternative to BatchSize: the share of the pool installed at each step, rounded up.
+	Percentage int
+	// Verify is called for every target after its installation. It defaults to VerifyServed on Target.Address.
+	Verify VerifyFunc
+	// VerifyOptions is passed to VerifyServed when Verify isn't set
+	VerifyOptions VerifyOptions
+	// Log receives progress messages when it's set
+	Log func(format string, args ...interface{})
+	// KeyPassword decrypts the private key of the certificate to prove it belongs to the certificate before any
+	// target is installed
+	KeyPassword string
+	// SkipPossessionCheck installs the targets without that proof
+	SkipPossessionCheck bool
+}
+
+// RolloutResult lists the targets that received the certificate
+type RolloutResult struct {
+	Installed []string
+	// Failed is the target that stopped the rollout, if any
+	Failed string
+}
+
+// Rollout installs pcc on targets in batches. Each batch is verified before the next one is started, so the first
+// target that fails to install or to serve the new certificate aborts the rollout and the rest of the pool keeps
+// the certificate it had.
+func Rollout(ctx context.Context, targets []Target, pcc *certificate.PEMCollection, opts RolloutOptions) (*RolloutResult, error) {
+	cert, err := leafCertificate(pcc)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.SkipPossessionCheck {
+		err = pcc.VerifyPossession([]byte(opts.KeyPassword))
+		if err != nil {
+			return nil, err
+		}
+	}
+	verify := opts.Verify
+	if verify == nil {
+		verify = func(ctx context.Context, target Target, cert *x509.Certificate) error {
+			verifyOpts := opts.VerifyOptions
+			verifyOpts.ServerName = target.ServerName
+			return VerifyServed(ctx, target.Address, cert, verifyOpts)
+		}
+	}
+	logf := opts.Log
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+
+	batch := batchSize(len(targets), opts)
+	result := &RolloutResult{}
+	for start := 0; start < len(targets); start += batch {
+		end := start + batch
+		if end > len(targets) {
+			end = len(targets)
+		}
+		for _, target := range targets[start:end] {
+			name := target.Installer.Name()
+			if err = ctx.Err(); err != nil {
+				return result, err
+			}
+			logf("installing certificate to %s", name)
+			err = target.Installer.Install(ctx, pcc)
+			if err != nil {
+				result.Failed = name
+				return result, fmt.Errorf("rollout aborted, failed to install certificate to %s: %w", name, err)
+			}
+			result.Installed = append(result.Installed, name)
+		}
+		for _, target := range targets[start:end] {
+			if target.Address == "" {
+				continue
+			}
+			name := target.Installer.Name()
+			err = verify(ctx, target, cert)
+			if err != nil {
+				result.Failed = name
+				return result, fmt.Errorf("rollout aborted, %s doesn't serve the new certificate: %w", name, err)
+			}
+			logf("%s serves the new certificate", name)
+		}
+	}
+	return result, nil
+}
+
+func batchSize(total int, opts RolloutOptions) int {
+	size := opts.BatchSize
+	if opts.Percentage > 0 {
+		size = (total*opts.Percentage + 99) / 100
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+func leafCertificate(pcc *certificate.PEMCollection) (*x509.Certificate, error) {
+	b, _ := pem.Decode([]byte(pcc.Certificate))
+	if b == nil {
+		return nil, fmt.Errorf("%w: failed to decode certificate PEM", verror.UserDataError)
+	}
+	return x509.ParseCertificate(b.Bytes)
+}
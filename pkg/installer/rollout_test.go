@@ -0,0 +1,158 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// tlsTarget is a TLS server whose certificate is replaced by Install, unless it's broken
+type tlsTarget struct {
+	name    string
+	broken  bool
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	server  *httptest.Server
+	install int
+}
+
+func newTLSTarget(name string, broken bool) *tlsTarget {
+	tt := &tlsTarget{name: name, broken: broken}
+	tt.server = httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	tt.server.TLS = &tls.Config{GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		tt.mu.Lock()
+		defer tt.mu.Unlock()
+		if tt.cert != nil {
+			return tt.cert, nil
+		}
+		return &tt.server.TLS.Certificates[0], nil
+	}}
+	tt.server.StartTLS()
+	return tt
+}
+
+func (tt *tlsTarget) Name() string {
+	return tt.name
+}
+
+func (tt *tlsTarget) Install(_ context.Context, pcc *certificate.PEMCollection) error {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.install++
+	if tt.broken {
+		return nil
+	}
+	cert, err := tls.X509KeyPair([]byte(pcc.Certificate), []byte(pcc.PrivateKey))
+	if err != nil {
+		return err
+	}
+	tt.cert = &cert
+	return nil
+}
+
+func issueTestCertificate(t *testing.T) *certificate.PEMCollection {
+	conn := fake.NewConnector(false, nil)
+	req := &certificate.Request{}
+	req.Subject.CommonName = "pool.example.com"
+	err := conn.GenerateRequest(nil, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PickupID, err = conn.RequestCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcc, err := conn.RetrieveCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pcc.AddPrivateKey(req.PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pcc
+}
+
+func TestRolloutAbortsOnFirstBadTarget(t *testing.T) {
+	pcc := issueTestCertificate(t)
+	pool := []*tlsTarget{newTLSTarget("a", false), newTLSTarget("b", true), newTLSTarget("c", false)}
+	var targets []Target
+	for _, tt := range pool {
+		defer tt.server.Close()
+		targets = append(targets, Target{Installer: tt, Address: tt.server.Listener.Addr().String(), ServerName: "pool.example.com"})
+	}
+
+	opts := RolloutOptions{VerifyOptions: VerifyOptions{Deadline: 200 * time.Millisecond, Interval: 50 * time.Millisecond}}
+	result, err := Rollout(context.Background(), targets, pcc, opts)
+	if err == nil {
+		t.Fatal("rollout should fail on the broken target")
+	}
+	if result.Failed != "b" || len(result.Installed) != 2 {
+		t.Fatalf("unexpected rollout result: %+v", result)
+	}
+	if pool[2].install != 0 {
+		t.Fatal("rollout should stop before the last target")
+	}
+}
+
+func TestRolloutPercentage(t *testing.T) {
+	pcc := issueTestCertificate(t)
+	var targets []Target
+	for _, name := range []string{"a", "b", "c", "d"} {
+		tt := newTLSTarget(name, false)
+		defer tt.server.Close()
+		targets = append(targets, Target{Installer: tt, Address: tt.server.Listener.Addr().String(), ServerName: "pool.example.com"})
+	}
+
+	result, err := Rollout(context.Background(), targets, pcc, RolloutOptions{Percentage: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Installed) != 4 {
+		t.Fatalf("unexpected rollout result: %+v", result)
+	}
+	if batchSize(4, RolloutOptions{Percentage: 50}) != 2 || batchSize(3, RolloutOptions{Percentage: 10}) != 1 {
+		t.Fatal("unexpected batch size")
+	}
+}
+
+func TestRolloutMixedUpKey(t *testing.T) {
+	pcc := issueTestCertificate(t)
+	pcc.PrivateKey = issueTestCertificate(t).PrivateKey
+	tt := newTLSTarget("a", false)
+	defer tt.server.Close()
+	targets := []Target{{Installer: tt, Address: tt.server.Listener.Addr().String(), ServerName: "pool.example.com"}}
+
+	_, err := Rollout(context.Background(), targets, pcc, RolloutOptions{})
+	if !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("the key of another certificate should stop the rollout, got %v", err)
+	}
+	if tt.install != 0 {
+		t.Fatal("no target should be installed")
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHostKeys are the host keys sshd loads when its configuration has no HostKey line
+var defaultHostKeys = []string{
+	"/etc/ssh/ssh_host_rsa_key",
+	"/etc/ssh/ssh_host_ecdsa_key",
+	"/etc/ssh/ssh_host_ed25519_key",
+}
+
+// SSHHostInstaller writes an SSH host key and its certificate the way sshd expects them: the private key in KeyFile,
+// the public key in KeyFile.pub and the certificate in KeyFile-cert.pub. When SSHDConfig is set, the HostKey and
+// HostCertificate lines sshd needs to present the certificate are added to it.
+type SSHHostInstaller struct {
+	KeyFile    string
+	SSHDConfig string
+}
+
+func (si *SSHHostInstaller) Name() string {
+	return "sshd:" + si.KeyFile
+}
+
+// PublicKeyFile is where the public key of the host key is written
+func (si *SSHHostInstaller) PublicKeyFile() string {
+	return si.KeyFile + ".pub"
+}
+
+// CertificateFile is where the certificate of the host key is written
+func (si *SSHHostInstaller) CertificateFile() string {
+	return si.KeyFile + "-cert.pub"
+}
+
+// Install writes the host key files, the private key only when privateKey is set so a key that's kept isn't
+// rewritten. The certificate is written last, sshd only sees a consistent set once it's reloaded. It returns whether
+// the sshd configuration changed.
+func (si *SSHHostInstaller) Install(ctx context.Context, privateKey, publicKey, cert []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if len(privateKey) > 0 {
+		err := writeFileAtomic(si.KeyFile, privateKey, 0600)
+		if err != nil {
+			return false, err
+		}
+		err = writeFileAtomic(si.PublicKeyFile(), publicKey, 0644)
+		if err != nil {
+			return false, err
+		}
+	}
+	err := writeFileAtomic(si.CertificateFile(), cert, 0644)
+	if err != nil {
+		return false, err
+	}
+	if si.SSHDConfig == "" {
+		return false, nil
+	}
+	return ConfigureSSHD(si.SSHDConfig, si.KeyFile, si.CertificateFile())
+}
+
+// ConfigureSSHD adds the HostKey and HostCertificate lines of keyFile and certFile to the global section of the sshd
+// configuration at path, when they're missing. The HostKey line is only added when the configuration lists its host
+// keys or when keyFile isn't one of the keys sshd loads by default, since the first HostKey line replaces the
+// defaults. It returns whether the file changed.
+func ConfigureSSHD(path, keyFile, certFile string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	var lines []string
+	global := -1
+	var hostKeys, hostCerts []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		keyword, value := sshdDirective(line)
+		switch {
+		case global >= 0:
+		case keyword == "match":
+			global = len(lines)
+		case keyword == "hostkey":
+			hostKeys = append(hostKeys, value)
+		case keyword == "hostcertificate":
+			hostCerts = append(hostCerts, value)
+		}
+		lines = append(lines, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return false, err
+	}
+	if global < 0 {
+		global = len(lines)
+	}
+
+	var added []string
+	if !containsPath(hostKeys, keyFile) && (len(hostKeys) > 0 || !containsPath(defaultHostKeys, keyFile)) {
+		added = append(added, "HostKey "+keyFile)
+	}
+	if !containsPath(hostCerts, certFile) {
+		added = append(added, "HostCertificate "+certFile)
+	}
+	if len(added) == 0 {
+		return false, nil
+	}
+	added = append([]string{"# added by vcert"}, added...)
+	if global < len(lines) {
+		added = append(added, "")
+	}
+	lines = append(lines[:global], append(added, lines[global:]...)...)
+	return true, writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), fi.Mode().Perm())
+}
+
+// sshdDirective returns the lower case keyword and the value of a line of sshd_config, which separates them with
+// spaces or an equal sign
+func sshdDirective(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	value := strings.TrimLeft(line[i:], " \t=")
+	return strings.ToLower(line[:i]), strings.Trim(value, `"`)
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
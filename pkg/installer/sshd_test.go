@@ -0,0 +1,101 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigureSSHD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "sshd_config")
+
+	cases := []struct {
+		config   string
+		keyFile  string
+		expected string
+	}{
+		{
+			// the default keys stay loaded
+			"PermitRootLogin no\n",
+			"/etc/ssh/ssh_host_ed25519_key",
+			"PermitRootLogin no\n# added by vcert\nHostCertificate /etc/ssh/ssh_host_ed25519_key-cert.pub\n",
+		},
+		{
+			"PermitRootLogin no\nMatch User git\n  AllowTcpForwarding no\n",
+			"/etc/ssh/vcert_host_key",
+			"PermitRootLogin no\n# added by vcert\nHostKey /etc/ssh/vcert_host_key\nHostCertificate /etc/ssh/vcert_host_key-cert.pub\n\nMatch User git\n  AllowTcpForwarding no\n",
+		},
+		{
+			"HostKey /etc/ssh/ssh_host_rsa_key\nHostCertificate=\"/etc/ssh/ssh_host_ed25519_key-cert.pub\"\n",
+			"/etc/ssh/ssh_host_ed25519_key",
+			"HostKey /etc/ssh/ssh_host_rsa_key\nHostCertificate=\"/etc/ssh/ssh_host_ed25519_key-cert.pub\"\n# added by vcert\nHostKey /etc/ssh/ssh_host_ed25519_key\n",
+		},
+	}
+	for i, c := range cases {
+		if err = ioutil.WriteFile(config, []byte(c.config), 0640); err != nil {
+			t.Fatal(err)
+		}
+		changed, err := ConfigureSSHD(config, c.keyFile, c.keyFile+"-cert.pub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadFile(config)
+		if !changed || string(data) != c.expected {
+			t.Errorf("case %d: unexpected configuration, changed %t:\n%s", i, changed, data)
+		}
+		changed, err = ConfigureSSHD(config, c.keyFile, c.keyFile+"-cert.pub")
+		if err != nil || changed {
+			t.Errorf("case %d: expected no change the second time, got %t %v", i, changed, err)
+		}
+	}
+	if fi, _ := os.Stat(config); fi.Mode().Perm() != 0640 {
+		t.Errorf("expected the mode to be kept, got %s", fi.Mode())
+	}
+}
+
+func TestSSHHostInstaller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	si := &SSHHostInstaller{KeyFile: filepath.Join(dir, "ssh_host_ed25519_key")}
+	if _, err = si.Install(context.Background(), []byte("private"), []byte("public"), []byte("cert")); err != nil {
+		t.Fatal(err)
+	}
+	// keeping the key only replaces the certificate
+	if _, err = si.Install(context.Background(), nil, nil, []byte("cert 2")); err != nil {
+		t.Fatal(err)
+	}
+	for path, expected := range map[string]string{si.KeyFile: "private", si.PublicKeyFile(): "public", si.CertificateFile(): "cert 2"} {
+		if data, _ := ioutil.ReadFile(path); string(data) != expected {
+			t.Errorf("expected %s in %s, got %s", expected, path, data)
+		}
+	}
+	if fi, _ := os.Stat(si.KeyFile); fi.Mode().Perm() != 0600 {
+		t.Errorf("expected the private key to be private, got %s", fi.Mode())
+	}
+}
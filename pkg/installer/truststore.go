@@ -0,0 +1,113 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/truststore"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// TruststoreInstaller adds the CA certificates of the chain to a Java truststore, a JKS or PKCS#12 file such as the
+// cacerts of a JDK, which is created in Format when it doesn't exist. The certificate and its key aren't stored, and
+// the file isn't written again when it already trusts the chain.
+type TruststoreInstaller struct {
+	File string
+	// Format is the format of a new truststore, PKCS#12 by default. An existing one keeps its format.
+	Format truststore.Format
+	// Password protects the truststore, changeit by default like the truststores of the JDK
+	Password string
+	// AliasPrefix starts the aliases of the certificates, vcert- by default
+	AliasPrefix string
+}
+
+func (ti *TruststoreInstaller) Name() string {
+	return "truststore:" + ti.File
+}
+
+func (ti *TruststoreInstaller) Install(ctx context.Context, pcc *certificate.PEMCollection) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var chain []*x509.Certificate
+	for _, c := range pcc.Chain {
+		b, _ := pem.Decode([]byte(c))
+		if b == nil {
+			return fmt.Errorf("%w: failed to decode chain certificate PEM", verror.UserDataError)
+		}
+		cert, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: the certificate was issued without its chain, there's nothing to trust", verror.UserDataError)
+	}
+	password := ti.Password
+	if password == "" {
+		password = truststore.DefaultPassword
+	}
+	prefix := ti.AliasPrefix
+	if prefix == "" {
+		prefix = truststore.DefaultAliasPrefix
+	}
+
+	perm := os.FileMode(0644)
+	var store *truststore.Store
+	data, err := ioutil.ReadFile(ti.File)
+	switch {
+	case err == nil:
+		store, err = truststore.Load(data, password)
+		if err != nil {
+			return fmt.Errorf("failed to read truststore %s: %w", ti.File, err)
+		}
+		if fi, err := os.Stat(ti.File); err == nil {
+			perm = fi.Mode().Perm()
+		}
+	case os.IsNotExist(err):
+		format := ti.Format
+		if format == "" {
+			format = truststore.FormatPKCS12
+		}
+		store, err = truststore.New(format)
+		if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	result, err := store.Add(chain, prefix)
+	if err != nil {
+		return err
+	}
+	if !result.Changed() {
+		return nil
+	}
+	data, err = store.Encode(password)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(ti.File, data, perm)
+}
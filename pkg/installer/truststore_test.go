@@ -0,0 +1,82 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/truststore"
+)
+
+func TestTruststoreInstaller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "truststore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pcc := issueTestCertificate(t)
+	if len(pcc.Chain) == 0 {
+		t.Skip("the fake CA returned no chain")
+	}
+	ti := &TruststoreInstaller{File: filepath.Join(dir, "cacerts"), Format: truststore.FormatJKS}
+	err = ti.Install(context.Background(), pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(ti.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := truststore.Load(data, truststore.DefaultPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := store.Certificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Format() != truststore.FormatJKS || len(certs) == 0 {
+		t.Fatalf("unexpected %s truststore with %d certificates", store.Format(), len(certs))
+	}
+
+	// a truststore that already trusts the chain isn't written again
+	old := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(ti.File, old, old); err != nil {
+		t.Fatal(err)
+	}
+	err = ti.Install(context.Background(), issueTestCertificate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(ti.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(old) {
+		t.Fatal("truststore was written again")
+	}
+
+	ti.Password = "wrong"
+	if err = ti.Install(context.Background(), pcc); err == nil {
+		t.Fatal("expected a password error")
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	defaultVerifyDeadline = time.Minute
+	defaultVerifyInterval = 2 * time.Second
+)
+
+// VerifyOptions controls VerifyServed
+type VerifyOptions struct {
+	// ServerName is sent as SNI. The host part of the address is used when it's empty.
+	ServerName string
+	// Deadline bounds all the attempts together. It defaults to one minute.
+	Deadline time.Duration
+	// Interval is the pause between two attempts. It defaults to two seconds.
+	Interval time.Duration
+	// Once makes a single attempt, to find out what the endpoint serves right now rather than wait for a rollout
+	Once bool
+}
+
+// ErrNotServed is returned by VerifyServed when the endpoint keeps serving another certificate until the deadline
+type ErrNotServed struct {
+	Address            string
+	ExpectedSerial     string
+	ExpectedThumbprint string
+	ServedSerial       string
+	ServedThumbprint   string
+	// LastError is the error of the last attempt when the endpoint couldn't be probed at all
+	LastError error
+}
+
+func (err ErrNotServed) Error() string {
+	if err.ServedThumbprint == "" {
+		return fmt.Sprintf("%s doesn't serve certificate %s (serial %s): %v", err.Address, err.ExpectedThumbprint, err.ExpectedSerial, err.LastError)
+	}
+	return fmt.Sprintf("%s serves certificate %s (serial %s) instead of %s (serial %s)", err.Address,
+		err.ServedThumbprint, err.ServedSerial, err.ExpectedThumbprint, err.ExpectedSerial)
+}
+
+func (err ErrNotServed) Code() string {
+	return verror.CodeNotServed
+}
+
+// VerifyServed dials address with SNI until the leaf it serves is expected, retrying until the deadline. Trust
+// isn't checked, the point is only to find out which certificate the endpoint serves.
+func VerifyServed(ctx context.Context, address string, expected *x509.Certificate, opts VerifyOptions) error {
+	deadline := opts.Deadline
+	if deadline <= 0 {
+		deadline = defaultVerifyDeadline
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultVerifyInterval
+	}
+	serverName := opts.ServerName
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		serverName = host
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	notServed := ErrNotServed{
+		Address:            address,
+		ExpectedSerial:     expected.SerialNumber.String(),
+		ExpectedThumbprint: thumbprint(expected),
+	}
+	for {
+		served, err := servedCertificate(ctx, address, serverName)
+		if err == nil && bytes.Equal(served.Raw, expected.Raw) {
+			return nil
+		}
+		if err == nil {
+			notServed.ServedSerial = served.SerialNumber.String()
+			notServed.ServedThumbprint = thumbprint(served)
+			notServed.LastError = nil
+		} else {
+			notServed.LastError = err
+		}
+		if opts.Once {
+			return notServed
+		}
+
+		select {
+		case <-ctx.Done():
+			return notServed
+		case <-time.After(interval):
+		}
+	}
+}
+
+func servedCertificate(ctx context.Context, address string, serverName string) (*x509.Certificate, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	rawConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer rawConn.Close()
+	/* #nosec */
+	conn := tls.Client(rawConn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	err = conn.Handshake()
+	if err != nil {
+		return nil, err
+	}
+	served := conn.ConnectionState().PeerCertificates
+	if len(served) == 0 {
+		return nil, fmt.Errorf("%s didn't present a certificate", address)
+	}
+	return served[0], nil
+}
+
+func thumbprint(cert *x509.Certificate) string {
+	h := sha1.Sum(cert.Raw)
+	return strings.ToUpper(fmt.Sprintf("%x", h))
+}
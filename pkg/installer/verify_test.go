@@ -0,0 +1,55 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package installer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyServedRetriesUntilServed(t *testing.T) {
+	pcc := issueTestCertificate(t)
+	cert, err := leafCertificate(pcc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := newTLSTarget("late", false)
+	defer tt.server.Close()
+	address := tt.server.Listener.Addr().String()
+	opts := VerifyOptions{ServerName: "pool.example.com", Deadline: 300 * time.Millisecond, Interval: 20 * time.Millisecond}
+
+	err = VerifyServed(context.Background(), address, cert, opts)
+	var notServed ErrNotServed
+	if !errors.As(err, &notServed) {
+		t.Fatalf("expected ErrNotServed, got %v", err)
+	}
+	if notServed.ServedThumbprint == "" || notServed.ServedThumbprint == notServed.ExpectedThumbprint {
+		t.Fatalf("unexpected served thumbprint: %+v", notServed)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = tt.Install(context.Background(), pcc)
+	}()
+	opts.Deadline = 5 * time.Second
+	err = VerifyServed(context.Background(), address, cert, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
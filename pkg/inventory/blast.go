@@ -0,0 +1,93 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"crypto"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Affected is a valid certificate sharing the public key or the common name of a compromised key or certificate
+type Affected struct {
+	certificate.CertificateInfo
+	SameKey bool
+	SameCN  bool
+}
+
+// BlastRadius lists the valid certificates of the inventory that have the public key pub or the common name cn,
+// either can be left empty. Comparing the keys retrieves every valid certificate of the inventory.
+func BlastRadius(conn endpoint.Connector, pub crypto.PublicKey, cn string) ([]Affected, error) {
+	if pub == nil && cn == "" {
+		return nil, fmt.Errorf("%w: a public key or a common name is required", verror.UserDataError)
+	}
+	infos, err := listAll(conn, endpoint.Filter{})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var affected []Affected
+	for _, info := range infos {
+		if !info.ValidTo.IsZero() && !info.ValidTo.After(now) {
+			continue
+		}
+		a := Affected{CertificateInfo: info, SameCN: cn != "" && strings.EqualFold(info.CN, cn)}
+		if pub != nil && info.Thumbprint != "" {
+			pcc, err := conn.RetrieveCertificate(&certificate.Request{Thumbprint: info.Thumbprint,
+				ChainOption: certificate.ChainOptionIgnore})
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve certificate %s: %w", info.ID, err)
+			}
+			a.SameKey, err = hasPublicKey(pcc.Certificate, pub)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if a.SameKey || a.SameCN {
+			affected = append(affected, a)
+		}
+	}
+	return affected, nil
+}
+
+// RevokeAll revokes the affected certificates by thumbprint with reason. Every certificate is attempted even when
+// a previous one fails, it returns how many were revoked and the failures together.
+func RevokeAll(conn endpoint.Connector, affected []Affected, reason string) (int, error) {
+	revoked := 0
+	var failed []string
+	for _, a := range affected {
+		err := conn.RevokeCertificate(&certificate.RevocationRequest{
+			Thumbprint: a.Thumbprint,
+			Reason:     reason,
+			Comments:   "blast radius revocation from command line utility",
+		})
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", a.Thumbprint, err))
+			continue
+		}
+		revoked++
+	}
+	if len(failed) > 0 {
+		return revoked, fmt.Errorf("%w: %d revocation(s) failed: %s", verror.VcertError, len(failed), strings.Join(failed, "; "))
+	}
+	return revoked, nil
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// revokingConnector records the revoked thumbprints, the revocation of fail fails
+type revokingConnector struct {
+	*inventoryConnector
+	revoked []string
+	fail    string
+}
+
+func (c *revokingConnector) RevokeCertificate(req *certificate.RevocationRequest) error {
+	if req.Thumbprint == c.fail {
+		return errors.New("revocation refused")
+	}
+	c.revoked = append(c.revoked, req.Thumbprint)
+	return nil
+}
+
+func TestBlastRadius(t *testing.T) {
+	conn := &inventoryConnector{Connector: fake.NewConnector(false, nil), certs: map[string]*certificate.PEMCollection{}}
+	compromised := newRequest("app.example.com", "app.example.com")
+	conn.enroll(t, compromised)
+	conn.enroll(t, newRequest("APP.example.com"))
+	conn.enroll(t, newRequest("other.example.com"))
+	// the key is reused by a certificate with other names
+	reused := newRequest("api.example.com")
+	reused.PrivateKey = compromised.PrivateKey
+	conn.enroll(t, reused)
+
+	affected, err := BlastRadius(conn, compromised.PrivateKey.Public(), "app.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(affected) != 3 || !affected[0].SameKey || !affected[0].SameCN || affected[1].SameKey || !affected[1].SameCN ||
+		!affected[2].SameKey || affected[2].SameCN {
+		t.Fatalf("unexpected blast radius %+v", affected)
+	}
+
+	affected, err = BlastRadius(conn, nil, "other.example.com")
+	if err != nil || len(affected) != 1 || affected[0].Thumbprint != "T2" {
+		t.Fatalf("expected the certificate with the CN, got %+v, %v", affected, err)
+	}
+	_, err = BlastRadius(conn, nil, "")
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error, got %v", err)
+	}
+
+	revoker := &revokingConnector{inventoryConnector: conn, fail: "T1"}
+	n, err := RevokeAll(revoker, []Affected{{CertificateInfo: conn.infos[0]}, {CertificateInfo: conn.infos[1]}, {CertificateInfo: conn.infos[3]}}, "key-compromise")
+	if n != 2 || err == nil || len(revoker.revoked) != 2 {
+		t.Fatalf("expected every revocation to be attempted, got %d %v %v", n, revoker.revoked, err)
+	}
+}
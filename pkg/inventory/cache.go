@@ -0,0 +1,356 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/state"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// SourcePlatform is the source of the certificates synced from the Venafi platform
+const SourcePlatform = "platform"
+
+// Cache is a local copy of the inventory in a SQLite database, so it can be queried without reaching the platform,
+// e.g. on an air-gapped host the database is copied to. Besides the platform, it holds the certificates found by
+// other sources, e.g. discovery scans, each source being synced on its own.
+type Cache struct {
+	DB *sql.DB
+}
+
+// SyncResult counts the certificates of a sync
+type SyncResult struct {
+	Added, Updated, Removed, Unchanged int
+}
+
+// Query selects the certificates of a cache. The zero Query selects the valid certificates of all the sources.
+type Query struct {
+	// Name selects the certificates whose common name or SANs contain it, ignoring case
+	Name string
+	// ExpiringWithin selects the certificates expiring within it, the expired ones included with WithExpired
+	ExpiringWithin time.Duration
+	WithExpired    bool
+	// Source selects the certificates of a source, e.g. SourcePlatform
+	Source string
+}
+
+// OpenCache opens the cache in the SQLite database at path, and creates its tables when they don't exist
+func OpenCache(path string) (*Cache, error) {
+	db, err := state.OpenSQLiteDB(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{DB: db}
+	err = c.Init(context.Background())
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Init creates the tables of the cache when they don't exist
+func (c *Cache) Init(ctx context.Context) error {
+	for _, stmt := range []string{
+		"CREATE TABLE IF NOT EXISTS certificates (source TEXT NOT NULL, id TEXT NOT NULL, names TEXT NOT NULL, " +
+			"thumbprint TEXT NOT NULL, valid_to INTEGER, info TEXT NOT NULL, PRIMARY KEY (source, id))",
+		"CREATE INDEX IF NOT EXISTS certificates_valid_to ON certificates (valid_to)",
+		"CREATE TABLE IF NOT EXISTS syncs (source TEXT PRIMARY KEY, synced_at INTEGER NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS renewals (source TEXT NOT NULL, previous TEXT NOT NULL, next TEXT NOT NULL, " +
+			"previous_info TEXT NOT NULL, next_info TEXT NOT NULL, found_at INTEGER NOT NULL, PRIMARY KEY (previous, next))",
+	} {
+		_, err := c.DB.ExecContext(ctx, stmt)
+		if err != nil {
+			return fmt.Errorf("%w: failed to create the inventory cache: %s", verror.UserDataError, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (c *Cache) Close() error {
+	return c.DB.Close()
+}
+
+// Sync lists the whole inventory of conn, expired certificates included, and replaces the certificates of
+// SourcePlatform with it
+func (c *Cache) Sync(ctx context.Context, conn endpoint.Connector) (SyncResult, error) {
+	infos, err := listAll(conn, endpoint.Filter{WithExpired: true})
+	if err != nil {
+		return SyncResult{}, err
+	}
+	return c.Replace(ctx, SourcePlatform, infos, time.Now())
+}
+
+// Replace makes infos the certificates of source, synced at now. Only the certificates added, renewed or removed
+// since the last sync are written, in a single transaction so a failed sync leaves the previous one. The renewals
+// found are recorded, they are kept after the certificates are removed, see Renewals.
+func (c *Cache) Replace(ctx context.Context, source string, infos []certificate.CertificateInfo, now time.Time) (SyncResult, error) {
+	var result SyncResult
+	known, err := c.known(ctx, source)
+	if err != nil {
+		return result, err
+	}
+	renewals := findRenewals(known, infos)
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("%w: failed to write the inventory cache: %s", verror.UserDataError, err)
+	}
+	err = func() error {
+		for _, info := range infos {
+			previous, ok := known[info.ID]
+			delete(known, info.ID)
+			switch {
+			case ok && previous.Thumbprint == info.Thumbprint:
+				result.Unchanged++
+				continue
+			case ok:
+				result.Updated++
+			default:
+				result.Added++
+			}
+			data, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "INSERT OR REPLACE INTO certificates (source, id, names, thumbprint, valid_to, info) "+
+				"VALUES (?, ?, ?, ?, ?, ?)", source, info.ID, searchNames(info), info.Thumbprint, unixOrNull(info.ValidTo), string(data))
+			if err != nil {
+				return err
+			}
+		}
+		for id := range known {
+			_, err := tx.ExecContext(ctx, "DELETE FROM certificates WHERE source = ? AND id = ?", source, id)
+			if err != nil {
+				return err
+			}
+			result.Removed++
+		}
+		for _, r := range renewals {
+			previous, err := json.Marshal(r.Previous)
+			if err != nil {
+				return err
+			}
+			next, err := json.Marshal(r.Next)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "INSERT OR REPLACE INTO renewals (source, previous, next, previous_info, next_info, found_at) "+
+				"VALUES (?, ?, ?, ?, ?, ?)", source, normalizeThumbprint(r.Previous.Thumbprint),
+				normalizeThumbprint(r.Next.Thumbprint), string(previous), string(next), now.Unix())
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO syncs (source, synced_at) VALUES (?, ?)", source, now.Unix())
+		return err
+	}()
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		_ = tx.Rollback()
+	}
+	if err != nil {
+		return SyncResult{}, fmt.Errorf("%w: failed to write the inventory cache: %s", verror.UserDataError, err)
+	}
+	return result, nil
+}
+
+// LastSync returns when source was last synced, the zero time when it never was
+func (c *Cache) LastSync(ctx context.Context, source string) (time.Time, error) {
+	var at int64
+	err := c.DB.QueryRowContext(ctx, "SELECT synced_at FROM syncs WHERE source = ?", source).Scan(&at)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: failed to read the inventory cache: %s", verror.UserDataError, err)
+	}
+	return time.Unix(at, 0), nil
+}
+
+// Certificates returns the certificates of the cache selected by q at now
+func (c *Cache) Certificates(ctx context.Context, q Query, now time.Time) ([]certificate.CertificateInfo, error) {
+	where, args := q.where(now)
+	rows, err := c.DB.QueryContext(ctx, "SELECT info FROM certificates"+where+" ORDER BY source, id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read the inventory cache: %s", verror.UserDataError, err)
+	}
+	defer rows.Close()
+	var infos []certificate.CertificateInfo
+	for rows.Next() {
+		var data string
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read the inventory cache: %s", verror.UserDataError, err)
+		}
+		var info certificate.CertificateInfo
+		err = json.Unmarshal([]byte(data), &info)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad certificate in the inventory cache: %s", verror.UserDataError, err)
+		}
+		infos = append(infos, info)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to read the inventory cache: %s", verror.UserDataError, err)
+	}
+	return infos, nil
+}
+
+// Renewals returns the renewals found by the syncs of all the sources
+func (c *Cache) Renewals(ctx context.Context) ([]Renewal, error) {
+	rows, err := c.DB.QueryContext(ctx, "SELECT previous_info, next_info FROM renewals ORDER BY found_at")
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read the inventory cache: %s", verror.UserDataError, err)
+	}
+	defer rows.Close()
+	var renewals []Renewal
+	for rows.Next() {
+		var previous, next string
+		err = rows.Scan(&previous, &next)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read the inventory cache: %s", verror.UserDataError, err)
+		}
+		var r Renewal
+		err = json.Unmarshal([]byte(previous), &r.Previous)
+		if err == nil {
+			err = json.Unmarshal([]byte(next), &r.Next)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad renewal in the inventory cache: %s", verror.UserDataError, err)
+		}
+		renewals = append(renewals, r)
+	}
+	return renewals, rows.Err()
+}
+
+// known returns the certificates of source by ID
+func (c *Cache) known(ctx context.Context, source string) (map[string]certificate.CertificateInfo, error) {
+	rows, err := c.DB.QueryContext(ctx, "SELECT info FROM certificates WHERE source = ?", source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read the inventory cache: %s", verror.UserDataError, err)
+	}
+	defer rows.Close()
+	known := make(map[string]certificate.CertificateInfo)
+	for rows.Next() {
+		var data string
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read the inventory cache: %s", verror.UserDataError, err)
+		}
+		var info certificate.CertificateInfo
+		err = json.Unmarshal([]byte(data), &info)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad certificate in the inventory cache: %s", verror.UserDataError, err)
+		}
+		known[info.ID] = info
+	}
+	return known, rows.Err()
+}
+
+// findRenewals returns the certificates of infos that renewed a known certificate: the ones whose ID was known with
+// another thumbprint, and the new ones with the names of a known certificate issued before them, as the platforms
+// that give a renewed certificate a new ID do
+func findRenewals(known map[string]certificate.CertificateInfo, infos []certificate.CertificateInfo) []Renewal {
+	latest := make(map[string]certificate.CertificateInfo)
+	for _, info := range known {
+		names := newCursorEntry(info).Names
+		if l, ok := latest[names]; !ok || info.ValidFrom.After(l.ValidFrom) {
+			latest[names] = info
+		}
+	}
+	var renewals []Renewal
+	for _, info := range infos {
+		previous, ok := known[info.ID]
+		if !ok {
+			previous, ok = latest[newCursorEntry(info).Names]
+			ok = ok && previous.ValidFrom.Before(info.ValidFrom)
+		}
+		if ok && previous.Thumbprint != info.Thumbprint {
+			renewals = append(renewals, Renewal{Previous: previous, Next: info})
+		}
+	}
+	return renewals
+}
+
+// Matches tells whether q selects info at now, as Cache.Certificates does
+func (q Query) Matches(info certificate.CertificateInfo, now time.Time) bool {
+	if q.Name != "" && !strings.Contains(searchNames(info), strings.ToLower(q.Name)) {
+		return false
+	}
+	if !q.WithExpired && !info.ValidTo.IsZero() && !info.ValidTo.After(now) {
+		return false
+	}
+	if q.ExpiringWithin > 0 && TimeToExpiry(info, now) > q.ExpiringWithin {
+		return false
+	}
+	return true
+}
+
+// where returns the SQL condition selecting the rows of q at now, and its arguments
+func (q Query) where(now time.Time) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if q.Source != "" {
+		conds = append(conds, "source = ?")
+		args = append(args, q.Source)
+	}
+	if q.Name != "" {
+		conds = append(conds, `names LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(strings.ToLower(q.Name))+"%")
+	}
+	if !q.WithExpired {
+		conds = append(conds, "(valid_to IS NULL OR valid_to > ?)")
+		args = append(args, now.Unix())
+	}
+	if q.ExpiringWithin > 0 {
+		conds = append(conds, "(valid_to IS NULL OR valid_to <= ?)")
+		args = append(args, now.Add(q.ExpiringWithin).Unix())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// searchNames is the lower case common name and SANs of info, one per line, that Query.Name is searched in
+func searchNames(info certificate.CertificateInfo) string {
+	names := []string{info.CN}
+	for _, sans := range [][]string{info.SANS.DNS, info.SANS.IP, info.SANS.Email, info.SANS.URI, info.SANS.UPN} {
+		names = append(names, sans...)
+	}
+	return strings.ToLower(strings.Join(names, "\n"))
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func unixOrNull(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Unix()
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+func TestQueryMatches(t *testing.T) {
+	now := time.Now()
+	infos := expiryInfos(now)
+	infos[2].SANS.DNS = []string{"api.Example.org"}
+	cases := []struct {
+		q    Query
+		want string
+	}{
+		{Query{}, "cert-0 cert-2 cert-3 cert-4"},
+		{Query{WithExpired: true}, "cert-0 cert-1 cert-2 cert-3 cert-4"},
+		{Query{ExpiringWithin: 30 * 24 * time.Hour}, "cert-2 cert-4"},
+		{Query{ExpiringWithin: 30 * 24 * time.Hour, WithExpired: true}, "cert-1 cert-2 cert-4"},
+		{Query{Name: "HOST4"}, "cert-0"},
+		{Query{Name: "example.org"}, "cert-2"},
+	}
+	for _, c := range cases {
+		var matched []certificate.CertificateInfo
+		for _, info := range infos {
+			if c.q.Matches(info, now) {
+				matched = append(matched, info)
+			}
+		}
+		if got := ids(matched); got != c.want {
+			t.Errorf("%+v: expected %s, got %s", c.q, c.want, got)
+		}
+	}
+}
+
+func TestQueryWhere(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	where, args := Query{WithExpired: true}.where(now)
+	if where != "" || args != nil {
+		t.Fatalf("expected no condition, got %q %v", where, args)
+	}
+	where, args = Query{Name: "50%_Off", ExpiringWithin: time.Hour, Source: SourcePlatform}.where(now)
+	for _, cond := range []string{"source = ?", "names LIKE ?", "valid_to > ?", "valid_to <= ?"} {
+		if !strings.Contains(where, cond) {
+			t.Errorf("expected %q in %q", cond, where)
+		}
+	}
+	want := []interface{}{SourcePlatform, `%50\%\_off%`, int64(1700000000), int64(1700003600)}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("expected %v, got %v", want, args)
+	}
+}
+
+func TestSearchNames(t *testing.T) {
+	var info certificate.CertificateInfo
+	info.CN = "WWW.example.com"
+	info.SANS.DNS = []string{"example.com"}
+	info.SANS.IP = []string{"10.0.0.1"}
+	if got := searchNames(info); got != "www.example.com\nexample.com\n10.0.0.1" {
+		t.Fatalf("unexpected names %q", got)
+	}
+	if _, err := OpenCache("inventory.db"); err == nil || !strings.Contains(err.Error(), "no SQLite driver") {
+		t.Fatalf("expected a missing driver error, got %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Kinds of inventory changes
+const (
+	ChangeIssued  = "issued"
+	ChangeRenewed = "renewed"
+	ChangeExpired = "expired"
+	// ChangeRevoked is a certificate that left the inventory before its expiry. The listings don't tell a revoked
+	// certificate from a deleted one, both are reported as revoked.
+	ChangeRevoked = "revoked"
+)
+
+// Change is a certificate issued, renewed, expired or revoked since the cursor
+type Change struct {
+	Kind        string
+	Certificate certificate.CertificateInfo
+	// Previous is the thumbprint of the certificate a renewed certificate replaces
+	Previous string
+}
+
+// Cursor is the state of the inventory when the last delta was computed
+type Cursor struct {
+	Time time.Time `json:"time"`
+	// Certificates are the certificates of the inventory by ID
+	Certificates map[string]CursorEntry `json:"certificates"`
+}
+
+// CursorEntry is what a cursor keeps of a certificate
+type CursorEntry struct {
+	CN         string    `json:"cn"`
+	Serial     string    `json:"serial"`
+	Thumbprint string    `json:"thumbprint"`
+	ValidTo    time.Time `json:"validTo"`
+	// Names identifies the certificates of the same common name and SANs, to tell a renewal from an issuance
+	// when the platform gives the renewed certificate a new ID
+	Names string `json:"names"`
+}
+
+// ReadCursor reads the cursor saved to path, it returns nil when the file doesn't exist
+func ReadCursor(path string) (*Cursor, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c Cursor
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad cursor %s: %s", verror.UserDataError, path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cursor to path, replacing the previous one only once it's completely written
+func (c *Cursor) Save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Delta lists the whole inventory, expired certificates included, and returns the changes since cursor along with
+// the cursor of the next delta. Without a cursor, every valid certificate is reported as issued.
+func Delta(conn endpoint.Connector, cursor *Cursor) ([]Change, *Cursor, error) {
+	infos, err := listAll(conn, endpoint.Filter{WithExpired: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	changes, next := delta(infos, cursor, time.Now())
+	return changes, next, nil
+}
+
+func listAll(conn endpoint.Connector, filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	pager, ok := conn.(endpoint.CertificatePager)
+	if !ok {
+		return conn.ListCertificates(filter)
+	}
+	var all []certificate.CertificateInfo
+	for page := 0; ; page++ {
+		infos, err := pager.ListCertificatesPage(filter, page, defaultPageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, infos...)
+		if len(infos) < defaultPageSize {
+			return all, nil
+		}
+	}
+}
+
+func delta(infos []certificate.CertificateInfo, cursor *Cursor, now time.Time) ([]Change, *Cursor) {
+	next := &Cursor{Time: now, Certificates: make(map[string]CursorEntry, len(infos))}
+	infos = append([]certificate.CertificateInfo(nil), infos...)
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].ValidFrom.Before(infos[j].ValidFrom)
+	})
+	var since time.Time
+	previous := map[string]CursorEntry{}
+	if cursor != nil {
+		since = cursor.Time
+		// the latest certificate of each set of names is the one a new certificate renews
+		for _, e := range cursor.Certificates {
+			if p, ok := previous[e.Names]; !ok || e.ValidTo.After(p.ValidTo) {
+				previous[e.Names] = e
+			}
+		}
+	}
+	expired := func(validTo time.Time) bool {
+		return !validTo.IsZero() && validTo.After(since) && !validTo.After(now)
+	}
+
+	var changes []Change
+	renewed := map[string]bool{}
+	for _, info := range infos {
+		entry := newCursorEntry(info)
+		next.Certificates[info.ID] = entry
+		if cursor == nil {
+			if info.ValidTo.IsZero() || info.ValidTo.After(now) {
+				changes = append(changes, Change{Kind: ChangeIssued, Certificate: info})
+			}
+			continue
+		}
+		known, ok := cursor.Certificates[info.ID]
+		switch {
+		case ok && known.Thumbprint != info.Thumbprint:
+			changes = append(changes, Change{Kind: ChangeRenewed, Certificate: info, Previous: known.Thumbprint})
+			renewed[known.Thumbprint] = true
+		case ok:
+		case !info.ValidTo.IsZero() && info.ValidTo.Before(since):
+			// an old certificate, e.g. imported, that was already expired at the last delta
+			continue
+		case previous[entry.Names].Thumbprint != "" && previous[entry.Names].Thumbprint != info.Thumbprint:
+			p := previous[entry.Names].Thumbprint
+			changes = append(changes, Change{Kind: ChangeRenewed, Certificate: info, Previous: p})
+			renewed[p] = true
+		default:
+			changes = append(changes, Change{Kind: ChangeIssued, Certificate: info})
+		}
+		if expired(info.ValidTo) {
+			changes = append(changes, Change{Kind: ChangeExpired, Certificate: info})
+		}
+	}
+	if cursor == nil {
+		return changes, next
+	}
+
+	var gone []string
+	for id := range cursor.Certificates {
+		if _, ok := next.Certificates[id]; !ok {
+			gone = append(gone, id)
+		}
+	}
+	sort.Strings(gone)
+	for _, id := range gone {
+		e := cursor.Certificates[id]
+		info := certificate.CertificateInfo{ID: id, CN: e.CN, Serial: e.Serial, Thumbprint: e.Thumbprint, ValidTo: e.ValidTo}
+		switch {
+		case renewed[e.Thumbprint]:
+		case expired(e.ValidTo):
+			changes = append(changes, Change{Kind: ChangeExpired, Certificate: info})
+		case e.ValidTo.IsZero() || e.ValidTo.After(now):
+			changes = append(changes, Change{Kind: ChangeRevoked, Certificate: info})
+		}
+	}
+	return changes, next
+}
+
+func newCursorEntry(info certificate.CertificateInfo) CursorEntry {
+	names := []string{strings.ToLower(info.CN)}
+	for _, sans := range [][]string{info.SANS.DNS, info.SANS.IP, info.SANS.Email, info.SANS.URI, info.SANS.UPN} {
+		names = append(names, strings.Join(normalizeSet(sans), ","))
+	}
+	return CursorEntry{CN: info.CN, Serial: info.Serial, Thumbprint: info.Thumbprint, ValidTo: info.ValidTo,
+		Names: strings.Join(names, "|")}
+}
+
+type changeRecord struct {
+	Change   string `json:"change"`
+	Previous string `json:"previous,omitempty"`
+	jsonlRecord
+}
+
+// WriteChanges writes the changes to w as JSON lines, with the fields of the jsonl export format and the kind of
+// change
+func WriteChanges(w io.Writer, changes []Change) error {
+	enc := json.NewEncoder(w)
+	for _, c := range changes {
+		err := enc.Encode(changeRecord{c.Kind, c.Previous, newJSONLRecord(c.Certificate)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
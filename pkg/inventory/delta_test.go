@@ -0,0 +1,145 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+func deltaInfo(id, cn, thumbprint string, validFrom, validTo time.Time) certificate.CertificateInfo {
+	info := certificate.CertificateInfo{ID: id, CN: cn, Thumbprint: thumbprint, ValidFrom: validFrom, ValidTo: validTo}
+	info.SANS.DNS = []string{cn}
+	return info
+}
+
+func changeKinds(changes []Change) []string {
+	var kinds []string
+	for _, c := range changes {
+		kinds = append(kinds, c.Kind+" "+c.Certificate.ID+" "+c.Previous)
+	}
+	return kinds
+}
+
+func TestDelta(t *testing.T) {
+	t0 := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	first := []certificate.CertificateInfo{
+		deltaInfo("a", "a.example.com", "A1", t0.Add(-10*day), t0.Add(100*day)),
+		deltaInfo("b", "b.example.com", "B1", t0.Add(-10*day), t0.Add(day)),
+		deltaInfo("c", "c.example.com", "C1", t0.Add(-10*day), t0.Add(100*day)),
+		deltaInfo("d", "d.example.com", "D1", t0.Add(-10*day), t0.Add(100*day)),
+		deltaInfo("old", "old.example.com", "O1", t0.Add(-100*day), t0.Add(-day)),
+	}
+	changes, cursor := delta(first, nil, t0)
+	if got, want := changeKinds(changes), []string{"issued a ", "issued b ", "issued c ", "issued d "}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected first delta %q, expected %q", got, want)
+	}
+
+	t1 := t0.Add(2 * day)
+	second := []certificate.CertificateInfo{
+		// renewed in place, with the same ID
+		deltaInfo("a", "a.example.com", "A2", t0.Add(day), t0.Add(200*day)),
+		// expired
+		first[1],
+		// renewed with a new ID, the previous certificate is gone
+		deltaInfo("c2", "c.example.com", "C2", t0.Add(day), t0.Add(200*day)),
+		// new
+		deltaInfo("e", "e.example.com", "E1", t0.Add(day), t0.Add(100*day)),
+		// imported, already expired at the last delta
+		deltaInfo("f", "f.example.com", "F1", t0.Add(-100*day), t0.Add(-day)),
+		first[4],
+	}
+	// d is revoked
+	changes, cursor = delta(second, cursor, t1)
+	want := []string{"expired b ", "renewed a A1", "renewed c2 C1", "issued e ", "revoked d "}
+	if got := changeKinds(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected second delta %q, expected %q", got, want)
+	}
+	if cursor.Time != t1 || len(cursor.Certificates) != len(second) {
+		t.Errorf("unexpected cursor %+v", cursor)
+	}
+
+	changes, _ = delta(second, cursor, t1.Add(day))
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %q", changeKinds(changes))
+	}
+}
+
+func TestDeltaCursorFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cursor.json")
+
+	cursor, err := ReadCursor(path)
+	if err != nil || cursor != nil {
+		t.Fatalf("expected no cursor, got %v, %v", cursor, err)
+	}
+	conn := &inventoryConnector{Connector: fake.NewConnector(true, nil), certs: map[string]*certificate.PEMCollection{}}
+	conn.enroll(t, newRequest("www.example.com", "www.example.com"))
+	changes, cursor, err := Delta(conn, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Kind != ChangeIssued {
+		t.Fatalf("unexpected changes %q", changeKinds(changes))
+	}
+	err = cursor.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ReadCursor(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(cursor)
+	if got, _ := json.Marshal(saved); !bytes.Equal(got, want) {
+		t.Errorf("saved cursor %+v differs from %+v", saved, cursor)
+	}
+
+	conn.enroll(t, newRequest("api.example.com", "api.example.com"))
+	changes, _, err = Delta(conn, saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = WriteChanges(&buf, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buf.String(), "\n") != 1 || record["change"] != ChangeIssued || record["cn"] != "api.example.com" {
+		t.Errorf("unexpected changes %s", buf.String())
+	}
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package inventory works on the certificates known to the platform, as listed by the connectors.
+package inventory
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// DuplicatePolicy tells what to do when the certificate requested already exists
+type DuplicatePolicy int
+
+const (
+	// DuplicateAllow enrolls a new certificate anyway, which is the default behaviour
+	DuplicateAllow DuplicatePolicy = iota
+	// DuplicateReuse returns the existing certificate when it has the public key of the request, or when the key
+	// is generated by the service and can be retrieved with the certificate. The request must therefore carry its
+	// CSR or private key already: once a new key is generated locally, no existing certificate can match it.
+	DuplicateReuse
+	// DuplicateError fails with ErrDuplicateCertificate when a certificate with the same names exists, to enforce
+	// one certificate per identity
+	DuplicateError
+)
+
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateAllow:
+		return "allow"
+	case DuplicateReuse:
+		return "reuse"
+	case DuplicateError:
+		return "error"
+	default:
+		return fmt.Sprintf("DuplicatePolicy(%d)", int(p))
+	}
+}
+
+// Set parses a duplicate policy name: allow, reuse or error
+func (p *DuplicatePolicy) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "", "allow":
+		*p = DuplicateAllow
+	case "reuse":
+		*p = DuplicateReuse
+	case "error":
+		*p = DuplicateError
+	default:
+		return fmt.Errorf("%w: unknown duplicate policy %q, expected allow, reuse or error", verror.UserDataError, value)
+	}
+	return nil
+}
+
+// Duplicate is an active certificate of the inventory with the common name and the SANs of a request
+type Duplicate struct {
+	certificate.CertificateInfo
+	// SameKey tells whether the certificate has the public key of the request. It's always false when the
+	// request has no key yet.
+	SameKey bool
+}
+
+// ErrDuplicateCertificate is returned by CheckDuplicate with the DuplicateError policy
+type ErrDuplicateCertificate struct {
+	Existing certificate.CertificateInfo
+}
+
+func (e ErrDuplicateCertificate) Error() string {
+	return fmt.Sprintf("certificate %s (serial %s, valid until %s) already exists for %s", e.Existing.ID,
+		e.Existing.Serial, e.Existing.ValidTo.Format(time.RFC3339), e.Existing.CN)
+}
+
+func (e ErrDuplicateCertificate) Unwrap() error {
+	return verror.UserDataError
+}
+
+func (e ErrDuplicateCertificate) Code() string {
+	return verror.CodeDuplicateCertificate
+}
+
+// FindDuplicates lists the active certificates of the inventory that have the same common name and SANs as req.
+// Only the certificates with the common name of req are listed. When req has a private key or a CSR, the candidates
+// are retrieved to compare their public key.
+func FindDuplicates(conn endpoint.Connector, req *certificate.Request) ([]Duplicate, error) {
+	infos, err := conn.ListCertificates(endpoint.Filter{CommonName: req.Subject.CommonName})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := requestPublicKey(req)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var duplicates []Duplicate
+	for _, info := range infos {
+		if !info.ValidTo.IsZero() && info.ValidTo.Before(now) || !sameNames(info, req) {
+			continue
+		}
+		d := Duplicate{CertificateInfo: info}
+		if pub != nil && info.Thumbprint != "" {
+			pcc, err := conn.RetrieveCertificate(&certificate.Request{Thumbprint: info.Thumbprint,
+				ChainOption: certificate.ChainOptionIgnore})
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve certificate %s: %w", info.ID, err)
+			}
+			d.SameKey, err = hasPublicKey(pcc.Certificate, pub)
+			if err != nil {
+				return nil, err
+			}
+		}
+		duplicates = append(duplicates, d)
+	}
+	return duplicates, nil
+}
+
+// CheckDuplicate applies policy before req is enrolled. It returns the existing certificate with the DuplicateReuse
+// policy, and nil when a new certificate has to be enrolled.
+func CheckDuplicate(conn endpoint.Connector, req *certificate.Request, policy DuplicatePolicy) (*certificate.PEMCollection, error) {
+	if policy == DuplicateAllow {
+		return nil, nil
+	}
+	duplicates, err := FindDuplicates(conn, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range duplicates {
+		switch policy {
+		case DuplicateError:
+			return nil, ErrDuplicateCertificate{Existing: d.CertificateInfo}
+		case DuplicateReuse:
+			serviceKey := req.CsrOrigin == certificate.ServiceGeneratedCSR
+			if !d.SameKey && !serviceKey {
+				continue
+			}
+			return conn.RetrieveCertificate(&certificate.Request{
+				Thumbprint:      d.Thumbprint,
+				ChainOption:     req.ChainOption,
+				CsrOrigin:       req.CsrOrigin,
+				KeyType:         req.KeyType,
+				KeyPassword:     req.KeyPassword,
+				FetchPrivateKey: serviceKey,
+			})
+		}
+	}
+	return nil, nil
+}
+
+func sameNames(info certificate.CertificateInfo, req *certificate.Request) bool {
+	if !strings.EqualFold(info.CN, req.Subject.CommonName) {
+		return false
+	}
+	var ips, uris []string
+	for _, ip := range req.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	for _, u := range req.URIs {
+		uris = append(uris, u.String())
+	}
+	var infoIPs []string
+	for _, s := range info.SANS.IP {
+		if ip := net.ParseIP(s); ip != nil {
+			s = ip.String()
+		}
+		infoIPs = append(infoIPs, s)
+	}
+	return sameSet(info.SANS.DNS, req.DNSNames) && sameSet(info.SANS.Email, req.EmailAddresses) &&
+		sameSet(infoIPs, ips) && sameSet(info.SANS.URI, uris) && sameSet(info.SANS.UPN, req.UPNs)
+}
+
+// sameSet compares case insensitively and ignores the order and repetitions
+func sameSet(a, b []string) bool {
+	na, nb := normalizeSet(a), normalizeSet(b)
+	if len(na) != len(nb) {
+		return false
+	}
+	for i := range na {
+		if na[i] != nb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeSet(values []string) []string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strings.ToLower(v)
+	}
+	sort.Strings(s)
+	var out []string
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func requestPublicKey(req *certificate.Request) (crypto.PublicKey, error) {
+	if req.PrivateKey != nil {
+		return req.PrivateKey.Public(), nil
+	}
+	csr := req.GetCSR()
+	if len(csr) == 0 {
+		return nil, nil
+	}
+	block, _ := pem.Decode(csr)
+	if block == nil {
+		return nil, fmt.Errorf("%w: bad CSR", verror.UserDataError)
+	}
+	parsed, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad CSR: %s", verror.UserDataError, err)
+	}
+	return parsed.PublicKey, nil
+}
+
+func hasPublicKey(certPEM string, pub crypto.PublicKey) (bool, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return false, fmt.Errorf("%w: bad certificate", verror.ServerError)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, fmt.Errorf("%w: bad certificate: %s", verror.ServerError, err)
+	}
+	want, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return false, err
+	}
+	have, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(want, have), nil
+}
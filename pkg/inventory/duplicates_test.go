@@ -0,0 +1,162 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// inventoryConnector lists the certificates it enrolled
+type inventoryConnector struct {
+	*fake.Connector
+	infos []certificate.CertificateInfo
+	certs map[string]*certificate.PEMCollection
+	// filter is the one of the last listing
+	filter endpoint.Filter
+}
+
+func (c *inventoryConnector) ListCertificates(filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	c.filter = filter
+	if filter.CommonName == "" {
+		return c.infos, nil
+	}
+	var infos []certificate.CertificateInfo
+	for _, info := range c.infos {
+		if strings.EqualFold(info.CN, filter.CommonName) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+func (c *inventoryConnector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	if req.Thumbprint != "" {
+		pcc, ok := c.certs[req.Thumbprint]
+		if !ok {
+			return nil, fmt.Errorf("no certificate %s", req.Thumbprint)
+		}
+		return pcc, nil
+	}
+	return c.Connector.RetrieveCertificate(req)
+}
+
+func (c *inventoryConnector) enroll(t *testing.T, req *certificate.Request) {
+	err := c.GenerateRequest(nil, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PickupID, err = c.RequestCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcc, err := c.RetrieveCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbprint := fmt.Sprintf("T%d", len(c.infos))
+	info := certificate.CertificateInfo{ID: thumbprint, CN: req.Subject.CommonName, Thumbprint: thumbprint,
+		ValidTo: time.Now().Add(time.Hour)}
+	info.SANS.DNS = req.DNSNames
+	c.infos = append(c.infos, info)
+	c.certs[thumbprint] = pcc
+}
+
+func newRequest(cn string, sans ...string) *certificate.Request {
+	req := &certificate.Request{DNSNames: sans, KeyType: certificate.KeyTypeECDSA}
+	req.Subject.CommonName = cn
+	return req
+}
+
+func TestCheckDuplicate(t *testing.T) {
+	conn := &inventoryConnector{Connector: fake.NewConnector(false, nil), certs: map[string]*certificate.PEMCollection{}}
+	existing := newRequest("app.example.com", "app.example.com", "api.example.com")
+	conn.enroll(t, existing)
+
+	// same names, new key
+	req := newRequest("APP.example.com", "api.example.com", "app.example.com")
+	err := conn.GenerateRequest(nil, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicates, err := FindDuplicates(conn, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(duplicates) != 1 || duplicates[0].SameKey {
+		t.Fatalf("unexpected duplicates %+v", duplicates)
+	}
+	if conn.filter.CommonName != req.Subject.CommonName {
+		t.Fatalf("the inventory should be searched by common name, got %+v", conn.filter)
+	}
+	pcc, err := CheckDuplicate(conn, req, DuplicateReuse)
+	if err != nil || pcc != nil {
+		t.Fatalf("a certificate with another key should not be reused: %v %v", pcc, err)
+	}
+	_, err = CheckDuplicate(conn, req, DuplicateError)
+	var dup ErrDuplicateCertificate
+	if !errors.As(err, &dup) || dup.Existing.ID != "T0" || !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// same names, same key
+	req = newRequest("app.example.com", "app.example.com", "api.example.com")
+	req.PrivateKey = existing.PrivateKey
+	pcc, err = CheckDuplicate(conn, req, DuplicateReuse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcc == nil || pcc.Certificate != conn.certs["T0"].Certificate {
+		t.Fatalf("the existing certificate should be reused")
+	}
+
+	// other names
+	req = newRequest("app.example.com", "app.example.com")
+	if _, err = CheckDuplicate(conn, req, DuplicateError); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// expired
+	conn.infos[0].ValidTo = time.Now().Add(-time.Minute)
+	req = newRequest("app.example.com", "app.example.com", "api.example.com")
+	if _, err = CheckDuplicate(conn, req, DuplicateError); err != nil {
+		t.Fatalf("an expired certificate is not a duplicate: %v", err)
+	}
+}
+
+func TestDuplicatePolicySet(t *testing.T) {
+	var p DuplicatePolicy
+	for _, s := range []string{"allow", "Reuse", "error"} {
+		if err := p.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p != DuplicateError {
+		t.Fatalf("unexpected policy %s", p)
+	}
+	if err := p.Set("ignore"); err == nil {
+		t.Fatal("unknown policy should fail")
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Sort orders of SortCertificates
+const (
+	// SortExpiry puts the certificates expiring first first
+	SortExpiry = "expiry"
+	// SortIssued puts the certificates issued last first
+	SortIssued = "issued"
+	// SortCommonName orders the certificates by common name
+	SortCommonName = "cn"
+)
+
+// ParseDuration extends time.ParseDuration with days and weeks, e.g. "30d" or "2w"
+func ParseDuration(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid duration %q", verror.UserDataError, s)
+		}
+		return d, nil
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid duration %q", verror.UserDataError, s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// TimeToExpiry returns how long the certificate is valid after now, negative once it's expired
+func TimeToExpiry(info certificate.CertificateInfo, now time.Time) time.Duration {
+	return info.ValidTo.Sub(now)
+}
+
+// ExpiringWithin returns the certificates of infos expiring within d after now, the expired ones included
+func ExpiringWithin(infos []certificate.CertificateInfo, d time.Duration, now time.Time) []certificate.CertificateInfo {
+	var expiring []certificate.CertificateInfo
+	for _, info := range infos {
+		if TimeToExpiry(info, now) <= d {
+			expiring = append(expiring, info)
+		}
+	}
+	return expiring
+}
+
+// SortCertificates sorts infos in place by SortExpiry, SortIssued or SortCommonName. Ties keep their order.
+func SortCertificates(infos []certificate.CertificateInfo, by string) error {
+	var less func(a, b certificate.CertificateInfo) bool
+	switch strings.ToLower(by) {
+	case SortExpiry:
+		less = func(a, b certificate.CertificateInfo) bool { return a.ValidTo.Before(b.ValidTo) }
+	case SortIssued:
+		less = func(a, b certificate.CertificateInfo) bool { return a.ValidFrom.After(b.ValidFrom) }
+	case SortCommonName:
+		less = func(a, b certificate.CertificateInfo) bool { return strings.ToLower(a.CN) < strings.ToLower(b.CN) }
+	default:
+		return fmt.Errorf("%w: unknown sort order %q, expected expiry, issued or cn", verror.UserDataError, by)
+	}
+	sort.SliceStable(infos, func(i, j int) bool { return less(infos[i], infos[j]) })
+	return nil
+}
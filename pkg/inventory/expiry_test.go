@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+type listConnector struct {
+	*fake.Connector
+	infos []certificate.CertificateInfo
+}
+
+func (c *listConnector) ListCertificates(filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
+	return c.infos, nil
+}
+
+func expiryInfos(now time.Time) []certificate.CertificateInfo {
+	var infos []certificate.CertificateInfo
+	for i, days := range []int{90, -2, 10, 45, 29} {
+		infos = append(infos, certificate.CertificateInfo{
+			ID:        fmt.Sprintf("cert-%d", i),
+			CN:        fmt.Sprintf("Host%d.example.com", 4-i),
+			ValidFrom: now.Add(time.Duration(days-100) * 24 * time.Hour),
+			ValidTo:   now.Add(time.Duration(days) * 24 * time.Hour),
+		})
+	}
+	return infos
+}
+
+func ids(infos []certificate.CertificateInfo) string {
+	var s []string
+	for _, info := range infos {
+		s = append(s, info.ID)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	} {
+		d, err := ParseDuration(s)
+		if err != nil || d != expected {
+			t.Errorf("%s: expected %s, got %s, %v", s, expected, d, err)
+		}
+	}
+	for _, s := range []string{"", "d", "30 days", "xw"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestExpiringWithinAndSort(t *testing.T) {
+	now := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	infos := expiryInfos(now)
+
+	if got := ids(ExpiringWithin(infos, 30*24*time.Hour, now)); got != "cert-1 cert-2 cert-4" {
+		t.Errorf("unexpected certificates expiring within 30 days: %s", got)
+	}
+	for by, expected := range map[string]string{
+		SortExpiry:     "cert-1 cert-2 cert-4 cert-3 cert-0",
+		SortIssued:     "cert-0 cert-3 cert-4 cert-2 cert-1",
+		SortCommonName: "cert-4 cert-3 cert-2 cert-1 cert-0",
+	} {
+		sorted := append([]certificate.CertificateInfo(nil), infos...)
+		if err := SortCertificates(sorted, by); err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(sorted); got != expected {
+			t.Errorf("sorted by %s: expected %s, got %s", by, expected, got)
+		}
+	}
+	if err := SortCertificates(infos, "size"); err == nil {
+		t.Error("expected an error for an unknown sort order")
+	}
+}
+
+func TestExportExpiringSorted(t *testing.T) {
+	now := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	conn := &listConnector{Connector: fake.NewConnector(false, nil), infos: expiryInfos(now)}
+	var buf bytes.Buffer
+	w, err := NewRecordWriter(&buf, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Exporter{Connector: conn, ExpiringWithin: 30 * 24 * time.Hour, Sort: SortExpiry, Now: now}
+	n, err := e.Export(w)
+	if err != nil || n != 3 {
+		t.Fatalf("unexpected result %d %v", n, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "cert-1,") || !strings.HasPrefix(lines[3], "cert-4,") {
+		t.Fatalf("unexpected export %s", buf.String())
+	}
+
+	e = &Exporter{Connector: conn, Sort: SortExpiry, Checkpoint: "checkpoint.json"}
+	if _, err = e.ExportFile("inventory.csv", FormatCSV); err == nil {
+		t.Fatal("expected an error for a sorted export with a checkpoint")
+	}
+}
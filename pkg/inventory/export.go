@@ -0,0 +1,368 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Export formats
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+const defaultPageSize = 100
+
+// RecordWriter writes certificates in an export format
+type RecordWriter interface {
+	Write(info certificate.CertificateInfo) error
+	// Flush writes the buffered records out, it's called after every page
+	Flush() error
+	// Close flushes and ends the output. It doesn't close the underlying writer.
+	Close() error
+}
+
+// NewRecordWriter returns a RecordWriter for format: csv, jsonl or parquet
+func NewRecordWriter(w io.Writer, format string) (RecordWriter, error) {
+	return newRecordWriter(w, format, false)
+}
+
+func newRecordWriter(w io.Writer, format string, resumed bool) (RecordWriter, error) {
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w), headerDone: resumed}, nil
+	case FormatJSONL:
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	case FormatParquet:
+		if resumed {
+			return nil, fmt.Errorf("%w: a parquet export can't be resumed", verror.UserDataError)
+		}
+		return newParquetWriter(w), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown export format %q, expected csv, jsonl or parquet", verror.UserDataError, format)
+	}
+}
+
+// Exporter streams the inventory of a zone page by page
+type Exporter struct {
+	Connector endpoint.Connector
+	Filter    endpoint.Filter
+	// PageSize defaults to 100
+	PageSize int
+	// Checkpoint is the file the progress is saved to after every page. When it exists, ExportFile resumes the
+	// export after the last saved page. It's removed once the export is complete.
+	Checkpoint string
+	// ExpiringWithin, when set, only exports the certificates expiring within it, the expired ones included
+	ExpiringWithin time.Duration
+	// Sort, when set, orders the export with SortCertificates. The whole inventory is then listed before it's
+	// written, so a sorted export can't be resumed.
+	Sort string
+	// Now is when ExpiringWithin is counted from, the current time when it's zero
+	Now time.Time
+}
+
+// Checkpoint is the progress of an export
+type Checkpoint struct {
+	Format string `json:"format"`
+	// Page is the next page to export
+	Page int `json:"page"`
+	// Offset is the size of the output after the last exported page
+	Offset  int64 `json:"offset"`
+	Records int   `json:"records"`
+}
+
+// Export writes all the certificates to w, it returns the number of records written
+func (e *Exporter) Export(w RecordWriter) (int, error) {
+	n, err := e.export(w, 0, nil)
+	if err != nil {
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// ExportFile writes all the certificates to the file path in format, resuming from the checkpoint if there is one.
+// A parquet export can't be resumed: its checkpoint is ignored.
+func (e *Exporter) ExportFile(path, format string) (int, error) {
+	if e.Sort != "" && e.Checkpoint != "" {
+		return 0, fmt.Errorf("%w: a sorted export can't be resumed", verror.UserDataError)
+	}
+	var cp Checkpoint
+	resumed := false
+	if e.Checkpoint != "" && format != FormatParquet {
+		data, err := ioutil.ReadFile(e.Checkpoint)
+		if err == nil {
+			err = json.Unmarshal(data, &cp)
+			if err != nil {
+				return 0, fmt.Errorf("%w: bad checkpoint %s: %s", verror.UserDataError, e.Checkpoint, err)
+			}
+			if cp.Format != format {
+				return 0, fmt.Errorf("%w: checkpoint %s is for the %s format", verror.UserDataError, e.Checkpoint, cp.Format)
+			}
+			resumed = true
+		} else if !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+	flags := os.O_CREATE | os.O_WRONLY
+	if !resumed {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if resumed {
+		// drop what was written after the checkpoint
+		err = f.Truncate(cp.Offset)
+		if err == nil {
+			_, err = f.Seek(cp.Offset, io.SeekStart)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	w, err := newRecordWriter(f, format, resumed && cp.Offset > 0)
+	if err != nil {
+		return 0, err
+	}
+	cp.Format = format
+	n, err := e.export(w, cp.Page, func(page int, records int) error {
+		if e.Checkpoint == "" || format == FormatParquet {
+			return nil
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		cp.Page, cp.Offset, cp.Records = page, offset, cp.Records+records
+		data, _ := json.Marshal(cp)
+		return writeFileAtomic(e.Checkpoint, data)
+	})
+	if err != nil {
+		return cp.Records, err
+	}
+	err = w.Close()
+	if err != nil {
+		return cp.Records + n, err
+	}
+	if e.Checkpoint != "" {
+		_ = os.Remove(e.Checkpoint)
+	}
+	return cp.Records + n, f.Close()
+}
+
+// export writes the pages from first on, calling saved after every flushed page with the next page and the number
+// of records of the page. It returns the number of records written since the last call of saved, or all of them
+// when saved is nil.
+func (e *Exporter) export(w RecordWriter, first int, saved func(next, records int) error) (int, error) {
+	if e.Sort != "" {
+		infos, err := listAll(e.Connector, e.Filter)
+		if err != nil {
+			return 0, err
+		}
+		infos = e.selected(infos)
+		err = SortCertificates(infos, e.Sort)
+		if err != nil {
+			return 0, err
+		}
+		return writePage(w, infos)
+	}
+	pager, ok := e.Connector.(endpoint.CertificatePager)
+	if !ok {
+		if first > 0 {
+			return 0, nil
+		}
+		infos, err := e.Connector.ListCertificates(e.Filter)
+		if err != nil {
+			return 0, err
+		}
+		return writePage(w, e.selected(infos))
+	}
+	pageSize := e.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	total := 0
+	for page := first; ; page++ {
+		infos, err := pager.ListCertificatesPage(e.Filter, page, pageSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := writePage(w, e.selected(infos))
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if saved != nil {
+			err = saved(page+1, n)
+			if err != nil {
+				return total, err
+			}
+			total = 0
+		}
+		if len(infos) < pageSize {
+			return total, nil
+		}
+	}
+}
+
+// selected returns the certificates of infos expiring within e.ExpiringWithin, all of them when it's not set
+func (e *Exporter) selected(infos []certificate.CertificateInfo) []certificate.CertificateInfo {
+	if e.ExpiringWithin == 0 {
+		return infos
+	}
+	now := e.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return ExpiringWithin(infos, e.ExpiringWithin, now)
+}
+
+func writePage(w RecordWriter, infos []certificate.CertificateInfo) (int, error) {
+	for i, info := range infos {
+		err := w.Write(info)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(infos), w.Flush()
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+var csvHeader = []string{"id", "cn", "issuer", "key_algorithm", "key_size", "serial", "thumbprint", "valid_from",
+	"valid_to", "dns", "ip", "email", "uri", "upn", "custom_fields"}
+
+type csvWriter struct {
+	w          *csv.Writer
+	headerDone bool
+}
+
+func (c *csvWriter) Write(info certificate.CertificateInfo) error {
+	if !c.headerDone {
+		c.headerDone = true
+		err := c.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+	}
+	var fields []string
+	for _, name := range sortedKeys(info.CustomFields) {
+		for _, v := range info.CustomFields[name] {
+			fields = append(fields, name+"="+v)
+		}
+	}
+	return c.w.Write([]string{info.ID, info.CN, info.Issuer, info.KeyAlgorithm, keySize(info.KeySize), info.Serial,
+		info.Thumbprint, formatTime(info.ValidFrom), formatTime(info.ValidTo), strings.Join(info.SANS.DNS, ";"),
+		strings.Join(info.SANS.IP, ";"), strings.Join(info.SANS.Email, ";"), strings.Join(info.SANS.URI, ";"),
+		strings.Join(info.SANS.UPN, ";"), strings.Join(fields, ";")})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	return c.Flush()
+}
+
+type jsonlRecord struct {
+	ID           string              `json:"id"`
+	CN           string              `json:"cn"`
+	Issuer       string              `json:"issuer,omitempty"`
+	KeyAlgorithm string              `json:"key_algorithm,omitempty"`
+	KeySize      int                 `json:"key_size,omitempty"`
+	Serial       string              `json:"serial"`
+	Thumbprint   string              `json:"thumbprint"`
+	ValidFrom    string              `json:"valid_from"`
+	ValidTo      string              `json:"valid_to"`
+	DNS          []string            `json:"dns,omitempty"`
+	IP           []string            `json:"ip,omitempty"`
+	Email        []string            `json:"email,omitempty"`
+	URI          []string            `json:"uri,omitempty"`
+	UPN          []string            `json:"upn,omitempty"`
+	CustomFields map[string][]string `json:"custom_fields,omitempty"`
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (j *jsonlWriter) Write(info certificate.CertificateInfo) error {
+	return j.enc.Encode(newJSONLRecord(info))
+}
+
+func newJSONLRecord(info certificate.CertificateInfo) jsonlRecord {
+	return jsonlRecord{info.ID, info.CN, info.Issuer, info.KeyAlgorithm, info.KeySize, info.Serial,
+		info.Thumbprint, formatTime(info.ValidFrom), formatTime(info.ValidTo), info.SANS.DNS, info.SANS.IP,
+		info.SANS.Email, info.SANS.URI, info.SANS.UPN, info.CustomFields}
+}
+
+func (j *jsonlWriter) Flush() error {
+	return nil
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func keySize(size int) string {
+	if size == 0 {
+		return ""
+	}
+	return strconv.Itoa(size)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+// pagedConnector serves total certificates by pages and fails once on failPage
+type pagedConnector struct {
+	*fake.Connector
+	total    int
+	failPage int
+	requests []int
+}
+
+func (c *pagedConnector) ListCertificatesPage(filter endpoint.Filter, page, pageSize int) ([]certificate.CertificateInfo, error) {
+	c.requests = append(c.requests, page)
+	if page == c.failPage {
+		c.failPage = -1
+		return nil, fmt.Errorf("connection reset")
+	}
+	var infos []certificate.CertificateInfo
+	for i := page * pageSize; i < c.total && i < (page+1)*pageSize; i++ {
+		info := certificate.CertificateInfo{
+			ID:           fmt.Sprintf("cert-%d", i),
+			CN:           fmt.Sprintf("host%d.example.com", i),
+			Issuer:       "Example CA",
+			KeyAlgorithm: "RSA",
+			KeySize:      2048,
+			Serial:       fmt.Sprintf("%04X", i),
+			ValidTo:      time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		info.SANS.DNS = []string{info.CN, "www." + info.CN}
+		if i%2 == 0 {
+			info.CustomFields = map[string][]string{"Cost Center": {"42"}}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func TestExportResumesFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "inventory.csv")
+	conn := &pagedConnector{Connector: fake.NewConnector(false, nil), total: 25, failPage: 2}
+	e := &Exporter{Connector: conn, PageSize: 10, Checkpoint: filepath.Join(dir, "checkpoint.json")}
+
+	n, err := e.ExportFile(out, FormatCSV)
+	if err == nil {
+		t.Fatal("the export should fail on the third page")
+	}
+	if n != 20 {
+		t.Fatalf("expected 20 records before the failure, got %d", n)
+	}
+	n, err = e.ExportFile(out, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 25 {
+		t.Fatalf("expected 25 records, got %d", n)
+	}
+	if fmt.Sprint(conn.requests) != "[0 1 2 2]" {
+		t.Fatalf("unexpected pages requested %v", conn.requests)
+	}
+	if _, err = os.Stat(e.Checkpoint); !os.IsNotExist(err) {
+		t.Fatalf("the checkpoint should be removed: %v", err)
+	}
+
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 26 || records[0][0] != "id" || records[25][0] != "cert-24" {
+		t.Fatalf("unexpected CSV with %d records", len(records))
+	}
+	if records[1][9] != "host0.example.com;www.host0.example.com" || records[1][14] != "Cost Center=42" ||
+		records[1][8] != "2030-01-01T00:00:00Z" || records[1][4] != "2048" {
+		t.Fatalf("unexpected record %v", records[1])
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewRecordWriter(&buf, FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Exporter{Connector: &pagedConnector{Connector: fake.NewConnector(false, nil), total: 3, failPage: -1}}
+	n, err := e.Export(w)
+	if err != nil || n != 3 {
+		t.Fatalf("unexpected result %d %v", n, err)
+	}
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		var r jsonlRecord
+		err = json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ID != fmt.Sprintf("cert-%d", lines) || len(r.DNS) != 2 || r.ValidTo != "2030-01-01T00:00:00Z" {
+			t.Fatalf("unexpected record %+v", r)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Fatalf("expected 3 lines, got %d", lines)
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewRecordWriter(&buf, FormatParquet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Exporter{Connector: &pagedConnector{Connector: fake.NewConnector(false, nil), total: 15, failPage: -1},
+		PageSize: 10}
+	_, err = e.Export(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatal("missing parquet magic")
+	}
+	length := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-length : len(data)-8]
+	meta := readThriftStruct(t, bytes.NewReader(footer))
+	if meta[3] != int64(15) {
+		t.Fatalf("expected 15 rows, got %v", meta[3])
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != 16 || string(schema[1].(map[int16]interface{})[4].([]byte)) != "id" {
+		t.Fatalf("unexpected schema %v", schema)
+	}
+	rowGroups := meta[4].([]interface{})
+	if len(rowGroups) != 2 || rowGroups[0].(map[int16]interface{})[3] != int64(10) {
+		t.Fatalf("unexpected row groups %v", rowGroups)
+	}
+	// the data page of the first column starts right after the magic and holds the ids
+	chunk := rowGroups[0].(map[int16]interface{})[1].([]interface{})[0].(map[int16]interface{})
+	if chunk[2] != int64(4) {
+		t.Fatalf("unexpected offset %v", chunk[2])
+	}
+	page := bytes.NewReader(data[4:])
+	header := readThriftStruct(t, page)
+	pageData := make([]byte, header[3].(int64))
+	_, _ = page.Read(pageData)
+	if binary.LittleEndian.Uint32(pageData) != 6 || string(pageData[4:10]) != "cert-0" {
+		t.Fatalf("unexpected page %q", pageData)
+	}
+	if !strings.Contains(string(data), `{"Cost Center":["42"]}`) {
+		t.Fatal("missing custom fields")
+	}
+}
+
+// readThriftStruct decodes a struct of the thrift compact protocol, as far as the parquet metadata needs it
+func readThriftStruct(t *testing.T, r *bytes.Reader) map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var id int16
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b == 0 {
+			return fields
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(readZigzag(t, r))
+		}
+		fields[id] = readThriftValue(t, r, b&0x0f)
+	}
+}
+
+func readThriftValue(t *testing.T, r *bytes.Reader, typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return readZigzag(t, r)
+	case thriftBinary:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, n)
+		_, _ = r.Read(b)
+		return b
+	case thriftList:
+		b, _ := r.ReadByte()
+		size := int(b >> 4)
+		if size == 15 {
+			n, _ := binary.ReadUvarint(r)
+			size = int(n)
+		}
+		list := []interface{}{}
+		for i := 0; i < size; i++ {
+			list = append(list, readThriftValue(t, r, b&0x0f))
+		}
+		return list
+	case thriftStruct:
+		return readThriftStruct(t, r)
+	}
+	t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+func readZigzag(t *testing.T, r *bytes.Reader) int64 {
+	v, err := binary.ReadUvarint(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(v>>1) ^ -int64(v&1)
+}
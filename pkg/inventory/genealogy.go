@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Renewal links a certificate to the certificate that renewed it
+type Renewal struct {
+	Previous certificate.CertificateInfo
+	Next     certificate.CertificateInfo
+}
+
+// Genealogy is the renewal lineage of a certificate
+type Genealogy struct {
+	Certificate certificate.CertificateInfo
+	// Ancestors are the certificates it renewed, directly or not, the latest first
+	Ancestors []certificate.CertificateInfo
+	// Descendants are the certificates that renewed it, directly or not, the earliest first
+	Descendants []certificate.CertificateInfo
+}
+
+// VersionRenewals returns the renewals between the versions of the certificate certificateID kept by the platform of
+// conn, versions are linked to the version that followed them. A connector that doesn't keep the versions has none.
+func VersionRenewals(conn endpoint.Connector, certificateID string) ([]Renewal, error) {
+	retriever, ok := conn.(endpoint.CertificateHistoryRetriever)
+	if !ok {
+		return nil, nil
+	}
+	versions, err := retriever.RetrieveCertificateVersions(certificateID)
+	if err != nil {
+		return nil, err
+	}
+	var renewals []Renewal
+	for i := 1; i < len(versions); i++ {
+		renewals = append(renewals, Renewal{Previous: versions[i], Next: versions[i-1]})
+	}
+	return renewals, nil
+}
+
+// Lineage returns the genealogy of the certificate with thumbprint built from renewals, e.g. the ones of
+// VersionRenewals and of Cache.Renewals. Thumbprints are compared ignoring case and separators.
+func Lineage(thumbprint string, renewals []Renewal) (*Genealogy, error) {
+	thumbprint = normalizeThumbprint(thumbprint)
+	infos := make(map[string]certificate.CertificateInfo)
+	previous := make(map[string][]string)
+	next := make(map[string][]string)
+	for _, r := range renewals {
+		p, n := normalizeThumbprint(r.Previous.Thumbprint), normalizeThumbprint(r.Next.Thumbprint)
+		if p == "" || n == "" || p == n {
+			continue
+		}
+		infos[p], infos[n] = r.Previous, r.Next
+		previous[n] = append(previous[n], p)
+		next[p] = append(next[p], n)
+	}
+	info, ok := infos[thumbprint]
+	if !ok {
+		return nil, fmt.Errorf("%w: no renewal of certificate %s is known", verror.UserDataError, thumbprint)
+	}
+	g := &Genealogy{Certificate: info}
+	g.Ancestors = walk(thumbprint, previous, infos)
+	sort.SliceStable(g.Ancestors, func(i, j int) bool { return g.Ancestors[i].ValidFrom.After(g.Ancestors[j].ValidFrom) })
+	g.Descendants = walk(thumbprint, next, infos)
+	sort.SliceStable(g.Descendants, func(i, j int) bool { return g.Descendants[i].ValidFrom.Before(g.Descendants[j].ValidFrom) })
+	return g, nil
+}
+
+// ValidAncestors returns the ancestors still valid at now, e.g. to revoke them with a compromised certificate
+// whose key they may share
+func (g *Genealogy) ValidAncestors(now time.Time) []certificate.CertificateInfo {
+	var valid []certificate.CertificateInfo
+	for _, info := range g.Ancestors {
+		if info.ValidTo.IsZero() || info.ValidTo.After(now) {
+			valid = append(valid, info)
+		}
+	}
+	return valid
+}
+
+// walk returns the certificates reached from thumbprint through links, thumbprint excluded
+func walk(thumbprint string, links map[string][]string, infos map[string]certificate.CertificateInfo) []certificate.CertificateInfo {
+	var found []certificate.CertificateInfo
+	seen := map[string]bool{thumbprint: true}
+	queue := []string{thumbprint}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		for _, l := range links[t] {
+			if !seen[l] {
+				seen[l] = true
+				found = append(found, infos[l])
+				queue = append(queue, l)
+			}
+		}
+	}
+	return found
+}
+
+func normalizeThumbprint(thumbprint string) string {
+	return strings.ToUpper(strings.NewReplacer(":", "", ".", "", " ", "").Replace(thumbprint))
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+type versionsConnector struct {
+	*fake.Connector
+	versions []certificate.CertificateInfo
+}
+
+func (c *versionsConnector) RetrieveCertificateVersions(certificateID string) ([]certificate.CertificateInfo, error) {
+	return c.versions, nil
+}
+
+func version(id, thumbprint string, issued, expires time.Time) certificate.CertificateInfo {
+	info := certificate.CertificateInfo{ID: id, CN: "www.example.com", Thumbprint: thumbprint, ValidFrom: issued, ValidTo: expires}
+	info.SANS.DNS = []string{"www.example.com"}
+	return info
+}
+
+func TestLineage(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	a := version("cert", "AA:AA", now.Add(-200*day), now.Add(-10*day))
+	b := version("cert", "BB:BB", now.Add(-100*day), now.Add(90*day))
+	c := version("cert", "CC:CC", now.Add(-50*day), now.Add(140*day))
+	d := version("cert-2", "DD:DD", now.Add(-day), now.Add(190*day))
+
+	conn := &versionsConnector{Connector: fake.NewConnector(false, nil), versions: []certificate.CertificateInfo{c, b, a}}
+	renewals, err := VersionRenewals(conn, "cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renewals) != 2 {
+		t.Fatalf("expected 2 renewals, got %d", len(renewals))
+	}
+	// the platform gave the last renewal a new ID, the cache found it by names
+	renewals = append(renewals, findRenewals(map[string]certificate.CertificateInfo{"cert": c}, []certificate.CertificateInfo{c, d})...)
+
+	g, err := Lineage("bbbb", renewals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(g.Ancestors) + " / " + ids(g.Descendants); got != "cert / cert cert-2" {
+		t.Fatalf("unexpected lineage %s", got)
+	}
+	g, err = Lineage("DDDD", renewals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Ancestors) != 3 || g.Ancestors[0].Thumbprint != "CC:CC" || len(g.Descendants) != 0 {
+		t.Fatalf("expected the ancestors latest first, got %+v", g.Ancestors)
+	}
+	valid := g.ValidAncestors(now)
+	if len(valid) != 2 || valid[0].Thumbprint != "CC:CC" || valid[1].Thumbprint != "BB:BB" {
+		t.Fatalf("expected the valid ancestors, got %+v", valid)
+	}
+
+	_, err = Lineage("EEEE", renewals)
+	if err == nil {
+		t.Fatal("expected an error for a certificate without renewals")
+	}
+	renewals, err = VersionRenewals(fake.NewConnector(false, nil), "cert")
+	if err != nil || renewals != nil {
+		t.Fatalf("expected no renewals without versions, got %v, %v", renewals, err)
+	}
+}
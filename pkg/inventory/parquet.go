@@ -0,0 +1,433 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+// The parquet writer supports just what the export needs: a flat schema of required, optional and repeated
+// columns, PLAIN encoded and uncompressed, with one row group per page of the inventory.
+
+const parquetMagic = "PAR1"
+
+// parquet physical, repetition and converted types, and encodings
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+	parquetRepeated = 2
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+	parquetNoConversion    = -1
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+type parquetColumn struct {
+	name       string
+	typ        int32
+	repetition int32
+	converted  int32
+
+	values    []byte
+	repLevels []byte
+	defLevels []byte
+	numValues int
+}
+
+type parquetChunk struct {
+	offset    int64
+	size      int64
+	numValues int
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	size   int64
+	rows   int
+}
+
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rows      int
+	rowGroups []parquetRowGroup
+	started   bool
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	col := func(name string, typ, repetition, converted int32) *parquetColumn {
+		return &parquetColumn{name: name, typ: typ, repetition: repetition, converted: converted}
+	}
+	return &parquetWriter{w: w, columns: []*parquetColumn{
+		col("id", parquetByteArray, parquetRequired, parquetUTF8),
+		col("cn", parquetByteArray, parquetRequired, parquetUTF8),
+		col("issuer", parquetByteArray, parquetRequired, parquetUTF8),
+		col("key_algorithm", parquetByteArray, parquetRequired, parquetUTF8),
+		col("key_size", parquetInt32, parquetRequired, parquetNoConversion),
+		col("serial", parquetByteArray, parquetRequired, parquetUTF8),
+		col("thumbprint", parquetByteArray, parquetRequired, parquetUTF8),
+		col("valid_from", parquetInt64, parquetOptional, parquetTimestampMillis),
+		col("valid_to", parquetInt64, parquetOptional, parquetTimestampMillis),
+		col("dns", parquetByteArray, parquetRepeated, parquetUTF8),
+		col("ip", parquetByteArray, parquetRepeated, parquetUTF8),
+		col("email", parquetByteArray, parquetRepeated, parquetUTF8),
+		col("uri", parquetByteArray, parquetRepeated, parquetUTF8),
+		col("upn", parquetByteArray, parquetRepeated, parquetUTF8),
+		// custom fields are stored as a JSON object
+		col("custom_fields", parquetByteArray, parquetOptional, parquetUTF8),
+	}}
+}
+
+func (p *parquetWriter) Write(info certificate.CertificateInfo) error {
+	var customFields interface{}
+	if len(info.CustomFields) > 0 {
+		data, err := json.Marshal(info.CustomFields)
+		if err != nil {
+			return err
+		}
+		customFields = string(data)
+	}
+	values := []interface{}{info.ID, info.CN, info.Issuer, info.KeyAlgorithm, int32(info.KeySize), info.Serial,
+		info.Thumbprint, timestampMillis(info.ValidFrom), timestampMillis(info.ValidTo), info.SANS.DNS, info.SANS.IP,
+		info.SANS.Email, info.SANS.URI, info.SANS.UPN, customFields}
+	for i, c := range p.columns {
+		c.add(values[i])
+	}
+	p.rows++
+	return nil
+}
+
+func timestampMillis(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano() / 1e6
+}
+
+// add appends a value: a string, int32 or int64, nil for a missing optional value, or a []string for a repeated
+// column
+func (c *parquetColumn) add(v interface{}) {
+	switch c.repetition {
+	case parquetOptional:
+		if v == nil {
+			c.defLevels = append(c.defLevels, 0)
+			c.numValues++
+			return
+		}
+		c.defLevels = append(c.defLevels, 1)
+	case parquetRepeated:
+		list := v.([]string)
+		if len(list) == 0 {
+			c.repLevels = append(c.repLevels, 0)
+			c.defLevels = append(c.defLevels, 0)
+			c.numValues++
+			return
+		}
+		for i, s := range list {
+			rep := byte(1)
+			if i == 0 {
+				rep = 0
+			}
+			c.repLevels = append(c.repLevels, rep)
+			c.defLevels = append(c.defLevels, 1)
+			c.appendPlain(s)
+			c.numValues++
+		}
+		return
+	}
+	c.appendPlain(v)
+	c.numValues++
+}
+
+func (c *parquetColumn) appendPlain(v interface{}) {
+	var b [8]byte
+	switch v := v.(type) {
+	case string:
+		binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+		c.values = append(c.values, b[:4]...)
+		c.values = append(c.values, v...)
+	case int32:
+		binary.LittleEndian.PutUint32(b[:4], uint32(v))
+		c.values = append(c.values, b[:4]...)
+	case int64:
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		c.values = append(c.values, b[:]...)
+	}
+}
+
+// Flush writes the buffered rows as a row group
+func (p *parquetWriter) Flush() error {
+	err := p.start()
+	if err != nil || p.rows == 0 {
+		return err
+	}
+	rg := parquetRowGroup{rows: p.rows}
+	for _, c := range p.columns {
+		var page []byte
+		if c.repetition == parquetRepeated {
+			page = appendLevels(page, c.repLevels)
+		}
+		if c.repetition != parquetRequired {
+			page = appendLevels(page, c.defLevels)
+		}
+		page = append(page, c.values...)
+
+		t := newThriftWriter()
+		t.i32(1, 0) // DATA_PAGE
+		t.i32(2, int32(len(page)))
+		t.i32(3, int32(len(page)))
+		t.structBegin(5)
+		t.i32(1, int32(c.numValues))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+		t.structEnd()
+		header := t.end()
+
+		chunk := parquetChunk{offset: p.offset, size: int64(len(header) + len(page)), numValues: c.numValues}
+		err = p.write(header)
+		if err == nil {
+			err = p.write(page)
+		}
+		if err != nil {
+			return err
+		}
+		rg.chunks = append(rg.chunks, chunk)
+		rg.size += chunk.size
+		c.values, c.repLevels, c.defLevels, c.numValues = nil, nil, nil, 0
+	}
+	p.rowGroups = append(p.rowGroups, rg)
+	p.rows = 0
+	return nil
+}
+
+// Close writes the file footer
+func (p *parquetWriter) Close() error {
+	err := p.Flush()
+	if err != nil {
+		return err
+	}
+	t := newThriftWriter()
+	t.i32(1, 1)
+	t.listBegin(2, thriftStruct, len(p.columns)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(p.columns)))
+	t.structEnd()
+	for _, c := range p.columns {
+		t.elemBegin()
+		t.i32(1, c.typ)
+		t.i32(3, c.repetition)
+		t.binary(4, c.name)
+		if c.converted != parquetNoConversion {
+			t.i32(6, c.converted)
+		}
+		t.structEnd()
+	}
+	rows := 0
+	for _, rg := range p.rowGroups {
+		rows += rg.rows
+	}
+	t.i64(3, int64(rows))
+	t.listBegin(4, thriftStruct, len(p.rowGroups))
+	for _, rg := range p.rowGroups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			c := p.columns[i]
+			t.elemBegin()
+			t.i64(2, chunk.offset)
+			t.structBegin(3)
+			t.i32(1, c.typ)
+			if c.repetition == parquetRequired {
+				t.listBegin(2, thriftI32, 1)
+				t.listI32(parquetPlain)
+			} else {
+				t.listBegin(2, thriftI32, 2)
+				t.listI32(parquetPlain)
+				t.listI32(parquetRLE)
+			}
+			t.listBegin(3, thriftBinary, 1)
+			t.listBinary(c.name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, int64(chunk.numValues))
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, rg.size)
+		t.i64(3, int64(rg.rows))
+		t.structEnd()
+	}
+	t.binary(6, "vcert")
+	footer := t.end()
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(footer)))
+	err = p.write(footer)
+	if err == nil {
+		err = p.write(length[:])
+	}
+	if err == nil {
+		err = p.write([]byte(parquetMagic))
+	}
+	return err
+}
+
+func (p *parquetWriter) start() error {
+	if p.started {
+		return nil
+	}
+	p.started = true
+	return p.write([]byte(parquetMagic))
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+// appendLevels appends levels of bit width 1 with the RLE/bit-packing hybrid encoding, prefixed by their length
+func appendLevels(b []byte, levels []byte) []byte {
+	var runs []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		runs = appendUvarint(runs, uint64(j-i)<<1)
+		runs = append(runs, levels[i])
+		i = j
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(runs)))
+	b = append(b, length[:]...)
+	return append(b, runs...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes a struct with the thrift compact protocol, as parquet metadata is
+type thriftWriter struct {
+	buf bytes.Buffer
+	// lastIDs is the last field id of each struct being written
+	lastIDs []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{lastIDs: []int16{0}}
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.lastIDs[len(t.lastIDs)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) varint(v int64) {
+	t.buf.Write(appendUvarint(nil, uint64((v<<1)^(v>>63))))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+// elemBegin starts a struct that is an element of a list
+func (t *thriftWriter) elemBegin() {
+	t.lastIDs = append(t.lastIDs, 0)
+}
+
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	t.lastIDs = t.lastIDs[:len(t.lastIDs)-1]
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.buf.Write(appendUvarint(nil, uint64(size)))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	t.buf.Write(appendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
+
+// end ends the top level struct and returns its encoding
+func (t *thriftWriter) end() []byte {
+	t.buf.WriteByte(0)
+	return t.buf.Bytes()
+}
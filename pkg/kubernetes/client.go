@@ -0,0 +1,352 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kubernetes is a small client of the Kubernetes API, reading the objects vcert requests certificates for.
+// It connects with the service account of the pod it runs in, or with a kubeconfig file.
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	defaultTimeout    = 30 * time.Second
+)
+
+// Client sends requests to the API server at Server, authenticated with Token or with the client certificate of
+// HTTPClient. The requests other than watches time out after 30 seconds.
+type Client struct {
+	Server     string
+	Token      string
+	HTTPClient *http.Client
+	// Namespace is the namespace of the service account or of the kubeconfig context, "default" when there's none
+	Namespace string
+}
+
+// StatusError is the error of a request the API server didn't answer with a 2xx status
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("kubernetes API: %d %s", e.Code, e.Message)
+}
+
+func (e StatusError) Unwrap() error {
+	if e.Code == http.StatusUnauthorized || e.Code == http.StatusForbidden {
+		return verror.AuthError
+	}
+	return verror.ServerError
+}
+
+// IsNotFound tells whether err is the error of an object that doesn't exist
+func IsNotFound(err error) bool {
+	e, ok := err.(StatusError)
+	return ok && e.Code == http.StatusNotFound
+}
+
+// IsConflict tells whether err is the error of an update made on an outdated version of an object
+func IsConflict(err error) bool {
+	e, ok := err.(StatusError)
+	return ok && e.Code == http.StatusConflict
+}
+
+// NewClient connects with the kubeconfig file at path. When path is empty, it connects with the service account of
+// the pod when running in a cluster, and with the file of $KUBECONFIG or ~/.kube/config otherwise.
+func NewClient(path string) (*Client, error) {
+	if path == "" {
+		if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+			return InCluster()
+		}
+		path = os.Getenv("KUBECONFIG")
+		if i := strings.IndexRune(path, filepath.ListSeparator); i >= 0 {
+			path = path[:i]
+		}
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("%w: no kubeconfig: %s", verror.UserDataError, err)
+			}
+			path = filepath.Join(home, ".kube", "config")
+		}
+	}
+	return FromKubeconfig(path)
+}
+
+// InCluster connects with the service account of the pod
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("%w: not running in a Kubernetes cluster", verror.UserDataError)
+	}
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read the service account token: %s", verror.UserDataError, err)
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read the cluster CA: %s", verror.UserDataError, err)
+	}
+	tlsConfig, err := newTLSConfig(ca, nil, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	namespace, _ := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	return &Client{
+		Server:     "https://" + net.JoinHostPort(host, port),
+		Token:      strings.TrimSpace(string(token)),
+		HTTPClient: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		Namespace:  defaultNamespace(strings.TrimSpace(string(namespace))),
+	}, nil
+}
+
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// FromKubeconfig connects with the current context of the kubeconfig file at path. Users authenticated by an exec
+// or auth provider plugin aren't supported.
+func FromKubeconfig(path string) (*Client, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read kubeconfig: %s", verror.UserDataError, err)
+	}
+	var cfg kubeconfig
+	err = yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid kubeconfig %s: %s", verror.UserDataError, path, err)
+	}
+	// relative file names are relative to the kubeconfig
+	dir := filepath.Dir(path)
+	read := func(file, encoded string) ([]byte, error) {
+		if encoded != "" {
+			return base64.StdEncoding.DecodeString(encoded)
+		}
+		if file == "" {
+			return nil, nil
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		return ioutil.ReadFile(file)
+	}
+
+	c := &Client{}
+	found := false
+	for _, ctx := range cfg.Contexts {
+		if ctx.Name != cfg.CurrentContext {
+			continue
+		}
+		found = true
+		c.Namespace = defaultNamespace(ctx.Context.Namespace)
+		var ca, cert, key []byte
+		insecure := false
+		for _, cluster := range cfg.Clusters {
+			if cluster.Name == ctx.Context.Cluster {
+				c.Server = cluster.Cluster.Server
+				insecure = cluster.Cluster.InsecureSkipTLSVerify
+				ca, err = read(cluster.Cluster.CertificateAuthority, cluster.Cluster.CertificateAuthorityData)
+				if err != nil {
+					return nil, fmt.Errorf("%w: failed to read the CA of cluster %s: %s", verror.UserDataError, cluster.Name, err)
+				}
+			}
+		}
+		for _, user := range cfg.Users {
+			if user.Name != ctx.Context.User {
+				continue
+			}
+			c.Token = user.User.Token
+			if token, err := read(user.User.TokenFile, ""); err != nil {
+				return nil, fmt.Errorf("%w: failed to read the token of user %s: %s", verror.UserDataError, user.Name, err)
+			} else if token != nil {
+				c.Token = strings.TrimSpace(string(token))
+			}
+			cert, err = read(user.User.ClientCertificate, user.User.ClientCertificateData)
+			if err == nil {
+				key, err = read(user.User.ClientKey, user.User.ClientKeyData)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to read the client certificate of user %s: %s", verror.UserDataError, user.Name, err)
+			}
+		}
+		tlsConfig, err := newTLSConfig(ca, cert, key, insecure)
+		if err != nil {
+			return nil, err
+		}
+		c.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: kubeconfig %s has no context %q", verror.UserDataError, path, cfg.CurrentContext)
+	}
+	if c.Server == "" {
+		return nil, fmt.Errorf("%w: kubeconfig %s has no server for context %q", verror.UserDataError, path, cfg.CurrentContext)
+	}
+	return c, nil
+}
+
+func newTLSConfig(ca, cert, key []byte, insecure bool) (*tls.Config, error) {
+	// nolint:gosec // insecure-skip-tls-verify is set by the user
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+	if len(ca) > 0 {
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("%w: invalid cluster CA", verror.UserDataError)
+		}
+	}
+	if len(cert) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid client certificate: %s", verror.UserDataError, err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
+
+func defaultNamespace(namespace string) string {
+	if namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
+// Get reads the object at path, e.g. /api/v1/namespaces/default/services/web, into out
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, nil, out)
+}
+
+// Create creates the object in at path, the collection of the object, and reads the created object into out
+func (c *Client) Create(ctx context.Context, path string, in, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, in, out)
+}
+
+// Replace replaces the object at path with in and reads the updated object into out. The update fails with a
+// conflict when the resource version of in is set and isn't the current one.
+func (c *Client) Replace(ctx context.Context, path string, in, out interface{}) error {
+	return c.do(ctx, http.MethodPut, path, in, out)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	resp, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return fmt.Errorf("%w: invalid response of the kubernetes API: %s", verror.ServerError, err)
+	}
+	return nil
+}
+
+// send sends a request and returns the response when its status is 2xx, its body must be closed
+func (c *Client) send(ctx context.Context, method, path string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.Server, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		// the API server answers errors with a Status object
+		var status struct {
+			Message string `json:"message"`
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = http.StatusText(resp.StatusCode)
+		}
+		return nil, StatusError{Code: resp.StatusCode, Message: status.Message}
+	}
+	return resp, nil
+}
@@ -0,0 +1,430 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+const (
+	// AnnotationZone has the controller manage the TLS secrets of an ingress or a gateway. Its value is the zone of
+	// the certificates, the zone of the controller when it's empty.
+	AnnotationZone = "vcert.venafi.com/zone"
+	// AnnotationHosts is set on the secrets the controller writes, it lists the hosts of their certificate
+	AnnotationHosts = "vcert.venafi.com/hosts"
+	// LabelManagedBy is set to ManagedBy on the secrets the controller writes, the others are never overwritten
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	ManagedBy      = "vcert"
+
+	DefaultRenewBefore = 30 * 24 * time.Hour
+	DefaultResync      = time.Hour
+
+	retrieveTimeout = 3 * time.Minute
+	retryDelay      = 30 * time.Second
+)
+
+// Controller issues the certificates of the annotated ingresses and gateways and keeps them in the TLS secrets
+// they reference. The secrets are created in the namespace of the ingress or of the secret reference, owned by
+// the ingress or gateway when it's in the same namespace so that they're deleted with it.
+type Controller struct {
+	Client    *Client
+	Connector endpoint.Connector
+	// Zone is the zone of the objects annotated with an empty zone
+	Zone string
+	// Namespace is the namespace watched, all the namespaces when it's empty
+	Namespace string
+	// Gateways has the gateways of the Gateway API watched along with the ingresses
+	Gateways bool
+	// RenewBefore is how long before its expiry a certificate is renewed, it defaults to DefaultRenewBefore
+	RenewBefore time.Duration
+	// Resync is the time between two checks of all the objects, which renews the expiring certificates. It defaults
+	// to DefaultResync.
+	Resync time.Duration
+	// Log receives progress messages when it's set
+	Log func(format string, args ...interface{})
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+
+	// mu serializes the requests, connectors aren't safe for concurrent use
+	mu sync.Mutex
+}
+
+// tlsTarget is a secret holding the certificate of hosts
+type tlsTarget struct {
+	// source is the object asking for the certificate, e.g. "ingress web/site"
+	source    string
+	zone      string
+	namespace string
+	secret    string
+	hosts     []string
+	owner     *OwnerReference
+	// annotations are set on the secret along with the zone and the hosts
+	annotations map[string]string
+}
+
+// Run watches the ingresses, and the gateways when Gateways is set, until ctx is done. The failures are logged and
+// retried.
+func (c *Controller) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.watch(ctx, "ingresses", IngressesPath(c.Namespace), c.syncIngresses, c.ingressEvent)
+	}()
+	if c.Gateways {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.watch(ctx, "gateways", GatewaysPath(c.Namespace), c.syncGateways, c.gatewayEvent)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// watch lists the objects of the collection at path with sync, then watches their changes until the next resync
+func (c *Controller) watch(ctx context.Context, kind, path string, sync func(context.Context) (string, error), handle func(context.Context, WatchEvent)) {
+	resync := c.Resync
+	if resync <= 0 {
+		resync = DefaultResync
+	}
+	for ctx.Err() == nil {
+		resourceVersion, err := sync(ctx)
+		if kind == "gateways" && IsNotFound(err) {
+			c.logf("the Gateway API is not installed, gateways are not watched")
+			return
+		}
+		if err == nil {
+			watchCtx, cancel := context.WithTimeout(ctx, resync)
+			for watchCtx.Err() == nil && err == nil {
+				err = c.Client.Watch(watchCtx, path, resourceVersion, func(e WatchEvent) error {
+					var meta struct {
+						Metadata ObjectMeta `json:"metadata"`
+					}
+					if json.Unmarshal(e.Object, &meta) == nil && meta.Metadata.ResourceVersion != "" {
+						resourceVersion = meta.Metadata.ResourceVersion
+					}
+					handle(ctx, e)
+					return nil
+				})
+			}
+			// a watch interrupted by the resync isn't a failure
+			resynced := watchCtx.Err() != nil && ctx.Err() == nil
+			cancel()
+			if err == nil || resynced {
+				continue
+			}
+			if e, ok := err.(StatusError); ok && e.Code == http.StatusGone {
+				// the resource version expired, listing again gets a new one
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		c.logf("failed to watch %s, retrying in %s: %s", kind, retryDelay, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (c *Controller) syncIngresses(ctx context.Context) (string, error) {
+	list, err := c.Client.ListIngresses(ctx, c.Namespace)
+	if err != nil {
+		return "", err
+	}
+	for i := range list.Items {
+		for _, t := range ingressTargets(&list.Items[i]) {
+			c.reconcile(ctx, t)
+		}
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+func (c *Controller) ingressEvent(ctx context.Context, e WatchEvent) {
+	if e.Type != EventAdded && e.Type != EventModified {
+		return
+	}
+	var ing Ingress
+	if err := json.Unmarshal(e.Object, &ing); err != nil {
+		c.logf("invalid ingress in watch event: %s", err)
+		return
+	}
+	for _, t := range ingressTargets(&ing) {
+		c.reconcile(ctx, t)
+	}
+}
+
+func (c *Controller) syncGateways(ctx context.Context) (string, error) {
+	list, err := c.Client.ListGateways(ctx, c.Namespace)
+	if err != nil {
+		return "", err
+	}
+	for i := range list.Items {
+		for _, t := range gatewayTargets(&list.Items[i]) {
+			c.reconcile(ctx, t)
+		}
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+func (c *Controller) gatewayEvent(ctx context.Context, e WatchEvent) {
+	if e.Type != EventAdded && e.Type != EventModified {
+		return
+	}
+	var gw Gateway
+	if err := json.Unmarshal(e.Object, &gw); err != nil {
+		c.logf("invalid gateway in watch event: %s", err)
+		return
+	}
+	for _, t := range gatewayTargets(&gw) {
+		c.reconcile(ctx, t)
+	}
+}
+
+// ingressTargets returns the secrets of the TLS sections of an annotated ingress, a section without hosts is for
+// the hosts of the rules
+func ingressTargets(ing *Ingress) []tlsTarget {
+	zone, ok := ing.Metadata.Annotations[AnnotationZone]
+	if !ok {
+		return nil
+	}
+	owner := &OwnerReference{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: ing.Metadata.Name, UID: ing.Metadata.UID}
+	var targets []tlsTarget
+	for _, tls := range ing.Spec.TLS {
+		hosts := tls.Hosts
+		if len(hosts) == 0 {
+			hosts = ing.Hosts()
+		}
+		if tls.SecretName == "" || len(hosts) == 0 {
+			continue
+		}
+		targets = append(targets, tlsTarget{
+			source:    "ingress " + ing.Metadata.Namespace + "/" + ing.Metadata.Name,
+			zone:      zone,
+			namespace: ing.Metadata.Namespace,
+			secret:    tls.SecretName,
+			hosts:     hosts,
+			owner:     owner,
+		})
+	}
+	return targets
+}
+
+// gatewayTargets returns the secrets referenced by the terminating TLS listeners of an annotated gateway, with the
+// hostnames of all the listeners referencing them
+func gatewayTargets(gw *Gateway) []tlsTarget {
+	zone, ok := gw.Metadata.Annotations[AnnotationZone]
+	if !ok {
+		return nil
+	}
+	var targets []tlsTarget
+	index := make(map[string]int)
+	for _, l := range gw.Spec.Listeners {
+		if l.TLS == nil || strings.EqualFold(l.TLS.Mode, "Passthrough") || l.Hostname == "" {
+			continue
+		}
+		for _, ref := range l.TLS.CertificateRefs {
+			if ref.Group != "" || (ref.Kind != "" && ref.Kind != "Secret") {
+				continue
+			}
+			t := tlsTarget{
+				source:    "gateway " + gw.Metadata.Namespace + "/" + gw.Metadata.Name,
+				zone:      zone,
+				namespace: ref.Namespace,
+				secret:    ref.Name,
+			}
+			if t.namespace == "" || t.namespace == gw.Metadata.Namespace {
+				t.namespace = gw.Metadata.Namespace
+				t.owner = &OwnerReference{APIVersion: "gateway.networking.k8s.io/v1", Kind: "Gateway", Name: gw.Metadata.Name, UID: gw.Metadata.UID}
+			}
+			key := t.namespace + "/" + t.secret
+			i, ok := index[key]
+			if !ok {
+				i = len(targets)
+				index[key] = i
+				targets = append(targets, t)
+			}
+			if !containsFold(targets[i].hosts, l.Hostname) {
+				targets[i].hosts = append(targets[i].hosts, l.Hostname)
+			}
+		}
+	}
+	return targets
+}
+
+// reconcile issues the certificate of the target when its secret has none, when it lacks a host or when it expires
+// within RenewBefore
+func (c *Controller) reconcile(ctx context.Context, t tlsTarget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	secret, err := c.Client.GetSecret(ctx, t.namespace, t.secret)
+	if IsNotFound(err) {
+		secret, err = &Secret{Metadata: ObjectMeta{Name: t.secret, Namespace: t.namespace}}, nil
+	}
+	if err != nil {
+		c.logf("%s: failed to read secret %s/%s: %s", t.source, t.namespace, t.secret, err)
+		return
+	}
+	if secret.Metadata.ResourceVersion != "" && secret.Metadata.Labels[LabelManagedBy] != ManagedBy && len(secret.Data) > 0 {
+		c.logf("%s: secret %s/%s is not managed by vcert, leaving it", t.source, t.namespace, t.secret)
+		return
+	}
+	reason := c.renewalReason(secret, t.hosts)
+	if reason == "" {
+		return
+	}
+	zone := t.zone
+	if zone == "" {
+		zone = c.Zone
+	}
+	if zone == "" {
+		c.logf("%s: no zone to request the certificate of secret %s/%s from", t.source, t.namespace, t.secret)
+		return
+	}
+	c.logf("%s: requesting the certificate of secret %s/%s: %s", t.source, t.namespace, t.secret, reason)
+	pcc, err := c.enroll(zone, t.hosts)
+	if err != nil {
+		c.logf("%s: failed to request the certificate of secret %s/%s: %s", t.source, t.namespace, t.secret, err)
+		return
+	}
+
+	certPEM := pcc.Certificate + "\n" + strings.Join(pcc.Chain, "\n")
+	secret.Type = SecretTypeTLS
+	secret.Data = map[string][]byte{TLSCertKey: []byte(strings.TrimSpace(certPEM) + "\n"), TLSKeyKey: []byte(pcc.PrivateKey)}
+	if secret.Metadata.Labels == nil {
+		secret.Metadata.Labels = make(map[string]string)
+	}
+	secret.Metadata.Labels[LabelManagedBy] = ManagedBy
+	if secret.Metadata.Annotations == nil {
+		secret.Metadata.Annotations = make(map[string]string)
+	}
+	secret.Metadata.Annotations[AnnotationZone] = zone
+	secret.Metadata.Annotations[AnnotationHosts] = strings.Join(t.hosts, ",")
+	for k, v := range t.annotations {
+		secret.Metadata.Annotations[k] = v
+	}
+	if t.owner != nil && t.owner.UID != "" && !hasOwner(secret.Metadata.OwnerReferences, t.owner.UID) {
+		secret.Metadata.OwnerReferences = append(secret.Metadata.OwnerReferences, *t.owner)
+	}
+	err = c.Client.ApplySecret(ctx, secret)
+	if err != nil {
+		c.logf("%s: failed to write secret %s/%s: %s", t.source, t.namespace, t.secret, err)
+		return
+	}
+	c.logf("%s: wrote the certificate of %s to secret %s/%s", t.source, strings.Join(t.hosts, ", "), t.namespace, t.secret)
+}
+
+// renewalReason tells why the certificate of the secret must be issued again, it's empty when it mustn't
+func (c *Controller) renewalReason(secret *Secret, hosts []string) string {
+	data := secret.Data[TLSCertKey]
+	if len(data) == 0 {
+		return "secret has no certificate"
+	}
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return "secret has no PEM certificate"
+	}
+	cert, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		return fmt.Sprintf("certificate can't be parsed: %s", err)
+	}
+	for _, h := range hosts {
+		if !containsFold(cert.DNSNames, h) {
+			return "certificate lacks host " + h
+		}
+	}
+	renewBefore := c.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = DefaultRenewBefore
+	}
+	if !c.now().Add(renewBefore).Before(cert.NotAfter) {
+		return "certificate expires on " + cert.NotAfter.Format(time.RFC3339)
+	}
+	return ""
+}
+
+func (c *Controller) enroll(zone string, hosts []string) (*certificate.PEMCollection, error) {
+	req, err := certificate.NewRequestBuilder().CommonName(hosts[0]).DNSNames(hosts...).Build()
+	if err != nil {
+		return nil, err
+	}
+	c.Connector.SetZone(zone)
+	err = c.Connector.GenerateRequest(nil, req)
+	if err != nil {
+		return nil, err
+	}
+	req.PickupID, err = c.Connector.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	req.Timeout = retrieveTimeout
+	pcc, err := c.Connector.RetrieveCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	err = pcc.AddPrivateKey(req.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pcc, nil
+}
+
+func (c *Controller) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *Controller) logf(format string, args ...interface{}) {
+	if c.Log != nil {
+		c.Log(format, args...)
+	}
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasOwner(owners []OwnerReference, uid string) bool {
+	for _, o := range owners {
+		if o.UID == uid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+// fakeAPI serves a list of ingresses and stores the secrets written to it
+type fakeAPI struct {
+	mu        sync.Mutex
+	ingresses string
+	secrets   map[string]*Secret
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	const secrets = "/api/v1/namespaces/web/secrets"
+	switch {
+	case r.URL.Path == "/apis/networking.k8s.io/v1/ingresses":
+		_, _ = w.Write([]byte(a.ingresses))
+	case r.URL.Path == secrets && r.Method == http.MethodGet:
+		list := SecretList{Items: []Secret{}}
+		for _, s := range a.secrets {
+			if r.URL.Query().Get("labelSelector") != LabelManagedBy+"="+ManagedBy || s.Metadata.Labels[LabelManagedBy] == ManagedBy {
+				list.Items = append(list.Items, *s)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(&list)
+	case r.URL.Path == secrets && r.Method == http.MethodPost:
+		var s Secret
+		_ = json.NewDecoder(r.Body).Decode(&s)
+		s.Metadata.ResourceVersion = "1"
+		a.secrets[s.Metadata.Name] = &s
+		_ = json.NewEncoder(w).Encode(&s)
+	case strings.HasPrefix(r.URL.Path, secrets+"/"):
+		name := strings.TrimPrefix(r.URL.Path, secrets+"/")
+		s, ok := a.secrets[name]
+		if r.Method == http.MethodPut {
+			var updated Secret
+			_ = json.NewDecoder(r.Body).Decode(&updated)
+			if ok && updated.Metadata.ResourceVersion != s.Metadata.ResourceVersion {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			updated.Metadata.ResourceVersion += "1"
+			a.secrets[name] = &updated
+			s, ok = &updated, true
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(s)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestControllerIngresses(t *testing.T) {
+	api := &fakeAPI{secrets: map[string]*Secret{
+		"legacy-tls": {Metadata: ObjectMeta{Name: "legacy-tls", Namespace: "web", ResourceVersion: "1"}, Data: map[string][]byte{TLSCertKey: []byte("x")}},
+	}}
+	api.ingresses = `{"metadata":{"resourceVersion":"10"},"items":[
+		{"metadata":{"name":"site","namespace":"web","uid":"u1","annotations":{"vcert.venafi.com/zone":""}},
+		 "spec":{"tls":[{"secretName":"site-tls"}],"rules":[{"host":"www.example.com"},{"host":"example.com"}]}},
+		{"metadata":{"name":"legacy","namespace":"web","annotations":{"vcert.venafi.com/zone":"Legacy"}},
+		 "spec":{"tls":[{"secretName":"legacy-tls","hosts":["old.example.com"]}]}},
+		{"metadata":{"name":"other","namespace":"web"},
+		 "spec":{"tls":[{"secretName":"other-tls","hosts":["other.example.com"]}]}}]}`
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var logs []string
+	c := &Controller{
+		Client:    &Client{Server: server.URL},
+		Connector: fake.NewConnector(false, nil),
+		Zone:      "Default",
+		Log:       func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) },
+	}
+	version, err := c.syncIngresses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "10" {
+		t.Fatalf("unexpected resource version %q", version)
+	}
+	secret := api.secrets["site-tls"]
+	if secret == nil || secret.Type != SecretTypeTLS || len(secret.Data[TLSKeyKey]) == 0 {
+		t.Fatalf("TLS secret of the ingress wasn't written: %+v", secret)
+	}
+	if secret.Metadata.Labels[LabelManagedBy] != ManagedBy || secret.Metadata.Annotations[AnnotationZone] != "Default" ||
+		len(secret.Metadata.OwnerReferences) != 1 || secret.Metadata.OwnerReferences[0].UID != "u1" {
+		t.Fatalf("unexpected secret metadata %+v", secret.Metadata)
+	}
+	if c.renewalReason(secret, []string{"www.example.com", "example.com"}) != "" {
+		t.Fatal("certificate of the secret should cover the hosts of the rules")
+	}
+	if _, ok := api.secrets["other-tls"]; ok {
+		t.Fatal("secret of an ingress without annotation shouldn't be written")
+	}
+	if string(api.secrets["legacy-tls"].Data[TLSCertKey]) != "x" {
+		t.Fatal("secret not managed by vcert shouldn't be overwritten")
+	}
+
+	logs = nil
+	_, err = c.syncIngresses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || !strings.Contains(logs[0], "is not managed by vcert") {
+		t.Fatalf("certificate of the secret shouldn't be requested again: %v", logs)
+	}
+
+	event := WatchEvent{Type: EventModified, Object: json.RawMessage(`{"metadata":{"name":"site","namespace":"web","uid":"u1",
+		"annotations":{"vcert.venafi.com/zone":""}},"spec":{"tls":[{"secretName":"site-tls","hosts":["shop.example.com"]}]}}`)}
+	c.ingressEvent(context.Background(), event)
+	secret = api.secrets["site-tls"]
+	if reason := c.renewalReason(secret, []string{"shop.example.com"}); reason != "" {
+		t.Fatalf("certificate of the modified ingress wasn't issued: %s", reason)
+	}
+	if secret.Metadata.Annotations[AnnotationHosts] != "shop.example.com" {
+		t.Fatalf("unexpected hosts annotation %q", secret.Metadata.Annotations[AnnotationHosts])
+	}
+}
+
+func TestGatewayTargets(t *testing.T) {
+	var gw Gateway
+	err := json.Unmarshal([]byte(`{"metadata":{"name":"edge","namespace":"infra","uid":"g1","annotations":{"vcert.venafi.com/zone":"Edge"}},
+		"spec":{"listeners":[
+			{"name":"www","hostname":"www.example.com","tls":{"certificateRefs":[{"name":"web-tls"}]}},
+			{"name":"api","hostname":"api.example.com","tls":{"certificateRefs":[{"kind":"Secret","name":"web-tls"},{"name":"api-tls","namespace":"api"}]}},
+			{"name":"db","hostname":"db.example.com","tls":{"mode":"Passthrough","certificateRefs":[{"name":"db-tls"}]}},
+			{"name":"http","hostname":"www.example.com"}]}}`), &gw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := gatewayTargets(&gw)
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 secrets, got %+v", targets)
+	}
+	if targets[0].namespace != "infra" || targets[0].secret != "web-tls" || targets[0].zone != "Edge" ||
+		!reflect.DeepEqual(targets[0].hosts, []string{"www.example.com", "api.example.com"}) || targets[0].owner == nil {
+		t.Fatalf("unexpected target %+v", targets[0])
+	}
+	// a secret of another namespace can't be owned by the gateway
+	if targets[1].namespace != "api" || targets[1].secret != "api-tls" || targets[1].owner != nil {
+		t.Fatalf("unexpected target %+v", targets[1])
+	}
+	delete(gw.Metadata.Annotations, AnnotationZone)
+	if targets = gatewayTargets(&gw); len(targets) != 0 {
+		t.Fatalf("gateway without annotation shouldn't have targets: %+v", targets)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("resourceVersion") == "1" {
+			_, _ = w.Write([]byte(`{"type":"ERROR","object":{"kind":"Status","code":410,"message":"too old resource version"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"type":"ADDED","object":{"metadata":{"name":"a"}}}
+{"type":"DELETED","object":{"metadata":{"name":"b"}}}
+`))
+	}))
+	defer server.Close()
+
+	c := &Client{Server: server.URL}
+	var events []string
+	err := c.Watch(context.Background(), IngressesPath(""), "5", func(e WatchEvent) error {
+		var obj struct {
+			Metadata ObjectMeta `json:"metadata"`
+		}
+		_ = json.Unmarshal(e.Object, &obj)
+		events = append(events, e.Type+" "+obj.Metadata.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(events, []string{"ADDED a", "DELETED b"}) {
+		t.Fatalf("unexpected events %v", events)
+	}
+	err = c.Watch(context.Background(), IngressesPath(""), "1", func(WatchEvent) error { return nil })
+	if e, ok := err.(StatusError); !ok || e.Code != http.StatusGone {
+		t.Fatalf("expected a gone error, got %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AnnotationInject has the injector mount the certificate of a pod in its containers. Its value is the
+	// comma-separated DNS names of the certificate.
+	AnnotationInject = "vcert.venafi.com/inject"
+	// AnnotationMountPath is the directory the TLS secret is mounted in, DefaultMountPath when it's not set
+	AnnotationMountPath = "vcert.venafi.com/mount-path"
+
+	DefaultMountPath = "/etc/vcert/tls"
+	// InjectVolumeName is the name of the volume added to the pods
+	InjectVolumeName = "vcert-tls"
+
+	maxAdmissionReviewSize = 8 << 20
+)
+
+// AdmissionReview is an admission.k8s.io/v1 request sent to a webhook and its response
+type AdmissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *AdmissionRequest  `json:"request,omitempty"`
+	Response   *AdmissionResponse `json:"response,omitempty"`
+}
+
+// AdmissionRequest is the object of an admission review
+type AdmissionRequest struct {
+	UID  string `json:"uid"`
+	Kind struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"kind"`
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name,omitempty"`
+	Operation string          `json:"operation"`
+	Object    json.RawMessage `json:"object,omitempty"`
+}
+
+// AdmissionResponse tells whether the object is admitted, and how to patch it
+type AdmissionResponse struct {
+	UID       string         `json:"uid"`
+	Allowed   bool           `json:"allowed"`
+	Status    *StatusDetails `json:"status,omitempty"`
+	PatchType string         `json:"patchType,omitempty"`
+	Patch     []byte         `json:"patch,omitempty"`
+}
+
+// StatusDetails is the reason of a denied admission
+type StatusDetails struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Injector is a mutating admission webhook mounting a TLS secret in the containers of the pods annotated with
+// AnnotationInject. The certificate of the secret is issued by the controller in the background, the kubelet waits
+// for the secret before starting the pod. The secrets are named after their hosts so that the pods with the same
+// hosts share a certificate, they're kept renewed by Run.
+type Injector struct {
+	Controller *Controller
+
+	// pending tracks the certificates being issued
+	pending sync.WaitGroup
+}
+
+// ServeHTTP answers the admission reviews of pods, the other objects are admitted unchanged
+func (i *Injector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "admission reviews are posted", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAdmissionReviewSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var review AdmissionReview
+	err = json.Unmarshal(body, &review)
+	if err != nil || review.Request == nil {
+		http.Error(w, "invalid admission review", http.StatusBadRequest)
+		return
+	}
+	review.Response = i.admit(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&review)
+}
+
+func (i *Injector) admit(req *AdmissionRequest) *AdmissionResponse {
+	allowed := &AdmissionResponse{Allowed: true}
+	if req.Kind.Group != "" || req.Kind.Kind != "Pod" || req.Operation != "CREATE" {
+		return allowed
+	}
+	var pod Pod
+	if err := json.Unmarshal(req.Object, &pod); err != nil {
+		return deny(http.StatusBadRequest, "invalid pod: "+err.Error())
+	}
+	value, ok := pod.Metadata.Annotations[AnnotationInject]
+	if !ok {
+		return allowed
+	}
+	namespace := pod.Metadata.Namespace
+	if namespace == "" {
+		namespace = req.Namespace
+	}
+	name := pod.Metadata.Name
+	if name == "" {
+		name = pod.Metadata.GenerateName + "*"
+	}
+	t, err := i.target(namespace, name, pod.Metadata.Annotations)
+	if err != nil {
+		return deny(http.StatusUnprocessableEntity, err.Error())
+	}
+	mountPath := pod.Metadata.Annotations[AnnotationMountPath]
+	if mountPath == "" {
+		mountPath = DefaultMountPath
+	}
+	patch, err := injectPatch(&pod, t.secret, mountPath)
+	if err != nil {
+		return deny(http.StatusInternalServerError, err.Error())
+	}
+	i.Controller.logf("%s: mounting secret %s/%s with the certificate of %s", t.source, t.namespace, t.secret, value)
+	i.pending.Add(1)
+	go func() {
+		defer i.pending.Done()
+		i.Controller.reconcile(context.Background(), t)
+	}()
+	if patch == nil {
+		return allowed
+	}
+	allowed.PatchType = "JSONPatch"
+	allowed.Patch = patch
+	return allowed
+}
+
+// target returns the secret holding the certificate of the hosts of the inject annotation
+func (i *Injector) target(namespace, pod string, annotations map[string]string) (tlsTarget, error) {
+	var hosts []string
+	for _, h := range strings.Split(annotations[AnnotationInject], ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" || containsFold(hosts, h) {
+			continue
+		}
+		if !validHost(h) {
+			return tlsTarget{}, fmt.Errorf("invalid DNS name %q in annotation %s", h, AnnotationInject)
+		}
+		hosts = append(hosts, h)
+	}
+	if len(hosts) == 0 {
+		return tlsTarget{}, fmt.Errorf("annotation %s lists no DNS name", AnnotationInject)
+	}
+	zone := annotations[AnnotationZone]
+	if zone == "" && i.Controller.Zone == "" {
+		return tlsTarget{}, fmt.Errorf("annotation %s is required, the injector has no default zone", AnnotationZone)
+	}
+	return tlsTarget{
+		source:      "pod " + namespace + "/" + pod,
+		zone:        zone,
+		namespace:   namespace,
+		secret:      injectSecretName(hosts),
+		hosts:       hosts,
+		annotations: map[string]string{AnnotationInject: strings.Join(hosts, ",")},
+	}, nil
+}
+
+// Run renews the certificates of the injected secrets every Resync of the controller until ctx is done
+func (i *Injector) Run(ctx context.Context) error {
+	resync := i.Controller.Resync
+	if resync <= 0 {
+		resync = DefaultResync
+	}
+	for {
+		err := i.sync(ctx)
+		if err != nil {
+			i.Controller.logf("failed to list the injected secrets: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			i.pending.Wait()
+			return nil
+		case <-time.After(resync):
+		}
+	}
+}
+
+// sync checks the certificates of the secrets written for the pods
+func (i *Injector) sync(ctx context.Context) error {
+	list, err := i.Controller.Client.ListSecrets(ctx, i.Controller.Namespace, LabelManagedBy+"="+ManagedBy)
+	if err != nil {
+		return err
+	}
+	for _, s := range list.Items {
+		value, ok := s.Metadata.Annotations[AnnotationInject]
+		if !ok {
+			continue
+		}
+		i.Controller.reconcile(ctx, tlsTarget{
+			source:      "injected secret",
+			zone:        s.Metadata.Annotations[AnnotationZone],
+			namespace:   s.Metadata.Namespace,
+			secret:      s.Metadata.Name,
+			hosts:       strings.Split(value, ","),
+			annotations: map[string]string{AnnotationInject: value},
+		})
+	}
+	return nil
+}
+
+// injectPatch returns the JSON patch adding the secret volume to the pod and mounting it read-only in its containers,
+// it's nil when the pod already has the volume
+func injectPatch(pod *Pod, secret, mountPath string) ([]byte, error) {
+	type operation struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.Name == InjectVolumeName {
+			return nil, nil
+		}
+	}
+	volume := map[string]interface{}{"name": InjectVolumeName, "secret": map[string]string{"secretName": secret}}
+	var ops []operation
+	if len(pod.Spec.Volumes) == 0 {
+		ops = append(ops, operation{"add", "/spec/volumes", []interface{}{volume}})
+	} else {
+		ops = append(ops, operation{"add", "/spec/volumes/-", volume})
+	}
+	mount := VolumeMount{Name: InjectVolumeName, MountPath: mountPath, ReadOnly: true}
+	for _, c := range []struct {
+		field      string
+		containers []Container
+	}{{"initContainers", pod.Spec.InitContainers}, {"containers", pod.Spec.Containers}} {
+		for n, container := range c.containers {
+			path := "/spec/" + c.field + "/" + strconv.Itoa(n) + "/volumeMounts"
+			if len(container.VolumeMounts) == 0 {
+				ops = append(ops, operation{"add", path, []VolumeMount{mount}})
+			} else {
+				ops = append(ops, operation{"add", path + "/-", mount})
+			}
+		}
+	}
+	return json.Marshal(ops)
+}
+
+// injectSecretName names the secret after the first host and a digest of all of them, e.g.
+// "vcert-www-example-com-0f3a9c1d"
+func injectSecretName(hosts []string) string {
+	sorted := append([]string(nil), hosts...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+	name := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, hosts[0]), "-")
+	if len(name) > 40 {
+		name = strings.TrimRight(name[:40], "-")
+	}
+	return "vcert-" + name + "-" + hex.EncodeToString(sum[:4])
+}
+
+// validHost accepts the DNS names and the wildcards of their leftmost label
+func validHost(h string) bool {
+	h = strings.TrimPrefix(h, "*.")
+	if h == "" || len(h) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(h, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func deny(code int, message string) *AdmissionResponse {
+	return &AdmissionResponse{Allowed: false, Status: &StatusDetails{Code: code, Message: message}}
+}
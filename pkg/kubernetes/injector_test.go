@@ -0,0 +1,123 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+func review(t *testing.T, handler http.Handler, pod string) *AdmissionResponse {
+	t.Helper()
+	body := `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{"uid":"r1",
+		"kind":{"group":"","version":"v1","kind":"Pod"},"namespace":"web","operation":"CREATE","object":` + pod + `}}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	var r AdmissionReview
+	if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Response == nil || r.Response.UID != "r1" {
+		t.Fatalf("unexpected review %s", w.Body)
+	}
+	return r.Response
+}
+
+func TestInjector(t *testing.T) {
+	api := &fakeAPI{secrets: map[string]*Secret{}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	c := &Controller{
+		Client:    &Client{Server: server.URL},
+		Connector: fake.NewConnector(false, nil),
+		Zone:      "Default",
+		Namespace: "web",
+	}
+	i := &Injector{Controller: c}
+
+	resp := review(t, i, `{"metadata":{"generateName":"api-","annotations":{"vcert.venafi.com/inject":"api.example.com, API.example.com,grpc.example.com"}},
+		"spec":{"initContainers":[{"name":"init"}],"containers":[{"name":"api","volumeMounts":[{"name":"data","mountPath":"/data"}]}]}}`)
+	if !resp.Allowed || resp.PatchType != "JSONPatch" {
+		t.Fatalf("pod should be admitted with a patch: %+v", resp)
+	}
+	secret := injectSecretName([]string{"api.example.com", "grpc.example.com"})
+	expected := `[{"op":"add","path":"/spec/volumes","value":[{"name":"vcert-tls","secret":{"secretName":"` + secret + `"}}]},` +
+		`{"op":"add","path":"/spec/initContainers/0/volumeMounts","value":[{"name":"vcert-tls","mountPath":"/etc/vcert/tls","readOnly":true}]},` +
+		`{"op":"add","path":"/spec/containers/0/volumeMounts/-","value":{"name":"vcert-tls","mountPath":"/etc/vcert/tls","readOnly":true}}]`
+	if string(resp.Patch) != expected {
+		t.Fatalf("unexpected patch %s", resp.Patch)
+	}
+	i.pending.Wait()
+	s := api.secrets[secret]
+	if s == nil || s.Metadata.Annotations[AnnotationInject] != "api.example.com,grpc.example.com" {
+		t.Fatalf("secret of the pod wasn't written: %+v", s)
+	}
+	if reason := c.renewalReason(s, []string{"api.example.com", "grpc.example.com"}); reason != "" {
+		t.Fatalf("unexpected certificate of the pod: %s", reason)
+	}
+
+	if !strings.HasPrefix(secret, "vcert-api-example-com-") || injectSecretName([]string{"api.example.com"}) == secret {
+		t.Fatalf("unexpected secret name %q", secret)
+	}
+
+	resp = review(t, i, `{"metadata":{"name":"plain"},"spec":{"containers":[{"name":"app"}]}}`)
+	if !resp.Allowed || resp.Patch != nil {
+		t.Fatalf("pod without annotation should be admitted unchanged: %+v", resp)
+	}
+	resp = review(t, i, `{"metadata":{"name":"bad","annotations":{"vcert.venafi.com/inject":"not a host"}},"spec":{"containers":[{"name":"app"}]}}`)
+	if resp.Allowed || resp.Status == nil || !strings.Contains(resp.Status.Message, "invalid DNS name") {
+		t.Fatalf("pod with an invalid host should be denied: %+v", resp)
+	}
+
+	// the resync renews the injected certificates
+	c.Now = func() time.Time { return time.Now().AddDate(2, 0, 0) }
+	before := s.Data[TLSCertKey]
+	if err := i.sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(api.secrets[secret].Data[TLSCertKey], before) {
+		t.Fatal("expiring certificate of the injected secret wasn't renewed")
+	}
+}
+
+func TestValidHost(t *testing.T) {
+	for h, valid := range map[string]bool{
+		"example.com":    true,
+		"*.example.com":  true,
+		"a-b.example":    true,
+		"-a.example.com": false,
+		"a..example.com": false,
+		"a_b.example":    false,
+		"":               false,
+	} {
+		if validHost(h) != valid {
+			t.Errorf("validHost(%q) should be %v", h, valid)
+		}
+	}
+}
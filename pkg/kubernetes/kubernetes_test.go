@@ -0,0 +1,135 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestFromKubeconfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "token"), []byte("file-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config")
+	err = ioutil.WriteFile(path, []byte(`
+current-context: prod
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+    insecure-skip-tls-verify: true
+users:
+- name: admin
+  user:
+    tokenFile: token
+contexts:
+- name: dev
+  context: {cluster: dev, user: admin}
+- name: prod
+  context: {cluster: prod, user: admin, namespace: web}
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := FromKubeconfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server != "https://prod.example.com:6443" || c.Token != "file-token" || c.Namespace != "web" {
+		t.Fatalf("unexpected client %+v", c)
+	}
+
+	err = ioutil.WriteFile(path, []byte("current-context: missing\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = FromKubeconfig(path)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error, got %v", err)
+	}
+}
+
+func TestGetObjects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/web/services/frontend":
+			_, _ = w.Write([]byte(`{"metadata":{"name":"frontend","namespace":"web"},
+				"spec":{"type":"LoadBalancer","clusterIP":"10.0.0.7"},
+				"status":{"loadBalancer":{"ingress":[{"hostname":"lb.example.com"},{"ip":"203.0.113.5"}]}}}`))
+		case "/apis/networking.k8s.io/v1/namespaces/other/ingresses/site":
+			_, _ = w.Write([]byte(`{"metadata":{"name":"site","namespace":"other"},
+				"spec":{"rules":[{"host":"www.example.com"},{"host":"api.example.com"},{}],
+				"tls":[{"hosts":["www.example.com","*.example.com"]}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"kind":"Status","message":"not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{Server: server.URL, Token: "secret", Namespace: "web"}
+	svc, err := c.GetService(context.Background(), "", "frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnsNames, ips := svc.Names("")
+	expectedNames := []string{"frontend", "frontend.web", "frontend.web.svc", "frontend.web.svc.cluster.local", "lb.example.com"}
+	if !reflect.DeepEqual(dnsNames, expectedNames) || !reflect.DeepEqual(ips, []string{"203.0.113.5", "10.0.0.7"}) {
+		t.Fatalf("unexpected service names %v %v", dnsNames, ips)
+	}
+
+	ing, err := c.GetIngress(context.Background(), "other", "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := ing.Hosts(); !reflect.DeepEqual(hosts, []string{"www.example.com", "api.example.com", "*.example.com"}) {
+		t.Fatalf("unexpected ingress hosts %v", hosts)
+	}
+
+	_, err = c.GetService(context.Background(), "", "missing")
+	if !IsNotFound(err) || !errors.Is(err, verror.ServerError) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	c.Token = "wrong"
+	_, err = c.GetService(context.Background(), "", "frontend")
+	if !errors.Is(err, verror.AuthError) {
+		t.Fatalf("expected an auth error, got %v", err)
+	}
+}
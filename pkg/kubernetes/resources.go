@@ -0,0 +1,352 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// DefaultClusterDomain is the DNS domain of the services of a cluster that doesn't configure another
+const DefaultClusterDomain = "cluster.local"
+
+// ObjectMeta holds the metadata shared by all objects
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	GenerateName    string            `json:"generateName,omitempty"`
+	Namespace       string            `json:"namespace,omitempty"`
+	UID             string            `json:"uid,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	OwnerReferences []OwnerReference  `json:"ownerReferences,omitempty"`
+}
+
+// OwnerReference makes an object deleted with its owner
+type OwnerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+}
+
+// ListMeta holds the metadata of a list, its resource version is where a watch of the list starts
+type ListMeta struct {
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// LoadBalancerIngress is an address of a load balancer
+type LoadBalancerIngress struct {
+	IP       string `json:"ip,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// Service is the part of a core/v1 Service vcert needs
+type Service struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Type         string `json:"type"`
+		ClusterIP    string `json:"clusterIP"`
+		ExternalName string `json:"externalName,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		LoadBalancer struct {
+			Ingress []LoadBalancerIngress `json:"ingress,omitempty"`
+		} `json:"loadBalancer"`
+	} `json:"status"`
+}
+
+// Ingress is the part of a networking.k8s.io/v1 Ingress vcert needs
+type Ingress struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		TLS   []IngressTLS `json:"tls,omitempty"`
+		Rules []struct {
+			Host string `json:"host,omitempty"`
+		} `json:"rules,omitempty"`
+	} `json:"spec"`
+}
+
+// IngressTLS is a secret holding the certificate of hosts of an ingress
+type IngressTLS struct {
+	Hosts      []string `json:"hosts,omitempty"`
+	SecretName string   `json:"secretName,omitempty"`
+}
+
+// IngressList is a list of ingresses
+type IngressList struct {
+	Metadata ListMeta  `json:"metadata"`
+	Items    []Ingress `json:"items"`
+}
+
+// Gateway is the part of a gateway.networking.k8s.io/v1 Gateway vcert needs
+type Gateway struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Listeners []Listener `json:"listeners"`
+	} `json:"spec"`
+}
+
+// Listener is where a gateway accepts connections, the certificates of a TLS listener are in secrets
+type Listener struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname,omitempty"`
+	TLS      *struct {
+		Mode            string                  `json:"mode,omitempty"`
+		CertificateRefs []SecretObjectReference `json:"certificateRefs,omitempty"`
+	} `json:"tls,omitempty"`
+}
+
+// SecretObjectReference references a secret, in the namespace of the gateway when Namespace is empty
+type SecretObjectReference struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// GatewayList is a list of gateways
+type GatewayList struct {
+	Metadata ListMeta  `json:"metadata"`
+	Items    []Gateway `json:"items"`
+}
+
+// Secret types
+const (
+	SecretTypeOpaque = "Opaque"
+	SecretTypeTLS    = "kubernetes.io/tls"
+)
+
+// Keys of the data of a TLS secret
+const (
+	TLSCertKey = "tls.crt"
+	TLSKeyKey  = "tls.key"
+	CACertKey  = "ca.crt"
+)
+
+// Secret is a core/v1 Secret, the values of Data are base64 encoded by encoding/json
+type Secret struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   ObjectMeta        `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data,omitempty"`
+}
+
+// SecretList is a list of secrets
+type SecretList struct {
+	Metadata ListMeta `json:"metadata"`
+	Items    []Secret `json:"items"`
+}
+
+// ConfigMap is a core/v1 ConfigMap, the values of BinaryData are base64 encoded by encoding/json
+type ConfigMap struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   ObjectMeta        `json:"metadata"`
+	Data       map[string]string `json:"data,omitempty"`
+	BinaryData map[string][]byte `json:"binaryData,omitempty"`
+}
+
+// Pod is the part of a core/v1 Pod vcert needs to mount a volume in its containers
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Volumes []struct {
+			Name string `json:"name"`
+		} `json:"volumes,omitempty"`
+		InitContainers []Container `json:"initContainers,omitempty"`
+		Containers     []Container `json:"containers"`
+	} `json:"spec"`
+}
+
+// Container is a container of a pod
+type Container struct {
+	Name         string        `json:"name"`
+	VolumeMounts []VolumeMount `json:"volumeMounts,omitempty"`
+}
+
+// VolumeMount mounts a volume of a pod in a container
+type VolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+func (c *Client) namespace(namespace string) string {
+	if namespace == "" {
+		return defaultNamespace(c.Namespace)
+	}
+	return namespace
+}
+
+// GetService reads the service name of namespace, the namespace of the client when it's empty
+func (c *Client) GetService(ctx context.Context, namespace, name string) (*Service, error) {
+	var svc Service
+	path := fmt.Sprintf("/api/v1/namespaces/%s/services/%s", url.PathEscape(c.namespace(namespace)), url.PathEscape(name))
+	err := c.Get(ctx, path, &svc)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+// GetIngress reads the ingress name of namespace, the namespace of the client when it's empty
+func (c *Client) GetIngress(ctx context.Context, namespace, name string) (*Ingress, error) {
+	var ing Ingress
+	err := c.Get(ctx, IngressesPath(c.namespace(namespace))+"/"+url.PathEscape(name), &ing)
+	if err != nil {
+		return nil, err
+	}
+	return &ing, nil
+}
+
+// ListIngresses lists the ingresses of namespace, of all the namespaces when it's empty
+func (c *Client) ListIngresses(ctx context.Context, namespace string) (*IngressList, error) {
+	var list IngressList
+	err := c.Get(ctx, IngressesPath(namespace), &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ListGateways lists the gateways of namespace, of all the namespaces when it's empty. It fails with a not found
+// error when the Gateway API isn't installed.
+func (c *Client) ListGateways(ctx context.Context, namespace string) (*GatewayList, error) {
+	var list GatewayList
+	err := c.Get(ctx, GatewaysPath(namespace), &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetSecret reads the secret name of namespace, the namespace of the client when it's empty
+func (c *Client) GetSecret(ctx context.Context, namespace, name string) (*Secret, error) {
+	var secret Secret
+	err := c.Get(ctx, SecretsPath(c.namespace(namespace))+"/"+url.PathEscape(name), &secret)
+	if err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// ListSecrets lists the secrets of namespace, of all the namespaces when it's empty, with the labels of selector,
+// e.g. "app.kubernetes.io/managed-by=vcert"
+func (c *Client) ListSecrets(ctx context.Context, namespace, selector string) (*SecretList, error) {
+	var list SecretList
+	path := SecretsPath(namespace)
+	if selector != "" {
+		path += "?" + url.Values{"labelSelector": {selector}}.Encode()
+	}
+	err := c.Get(ctx, path, &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ApplySecret creates the secret, or replaces it when it exists. A secret read with GetSecret is only replaced when
+// it wasn't changed since.
+func (c *Client) ApplySecret(ctx context.Context, secret *Secret) error {
+	secret.APIVersion, secret.Kind = "v1", "Secret"
+	namespace := c.namespace(secret.Metadata.Namespace)
+	if secret.Metadata.ResourceVersion != "" {
+		return c.Replace(ctx, SecretsPath(namespace)+"/"+url.PathEscape(secret.Metadata.Name), secret, secret)
+	}
+	err := c.Create(ctx, SecretsPath(namespace), secret, secret)
+	if IsConflict(err) {
+		// it was created since it was read, the resource version of the new one is unknown
+		return c.Replace(ctx, SecretsPath(namespace)+"/"+url.PathEscape(secret.Metadata.Name), secret, secret)
+	}
+	return err
+}
+
+// IngressesPath is the path of the ingresses of namespace, of all the namespaces when it's empty
+func IngressesPath(namespace string) string {
+	return collectionPath("/apis/networking.k8s.io/v1", namespace, "ingresses")
+}
+
+// GatewaysPath is the path of the gateways of namespace, of all the namespaces when it's empty
+func GatewaysPath(namespace string) string {
+	return collectionPath("/apis/gateway.networking.k8s.io/v1", namespace, "gateways")
+}
+
+// SecretsPath is the path of the secrets of namespace, of all the namespaces when it's empty
+func SecretsPath(namespace string) string {
+	return collectionPath("/api/v1", namespace, "secrets")
+}
+
+// ConfigMapsPath is the path of the config maps of namespace, of all the namespaces when it's empty
+func ConfigMapsPath(namespace string) string {
+	return collectionPath("/api/v1", namespace, "configmaps")
+}
+
+func collectionPath(group, namespace, resource string) string {
+	if namespace == "" {
+		return group + "/" + resource
+	}
+	return group + "/namespaces/" + url.PathEscape(namespace) + "/" + resource
+}
+
+// Names returns the DNS names and IP addresses the service is reached at: its in-cluster names, its external
+// name, the addresses of its load balancer and its cluster IP
+func (s *Service) Names(clusterDomain string) (dnsNames, ips []string) {
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+	name, ns := s.Metadata.Name, s.Metadata.Namespace
+	dnsNames = []string{name, name + "." + ns, name + "." + ns + ".svc", name + "." + ns + ".svc." + clusterDomain}
+	if s.Spec.ExternalName != "" {
+		dnsNames = append(dnsNames, s.Spec.ExternalName)
+	}
+	for _, lb := range s.Status.LoadBalancer.Ingress {
+		if lb.Hostname != "" {
+			dnsNames = append(dnsNames, lb.Hostname)
+		}
+		if lb.IP != "" {
+			ips = append(ips, lb.IP)
+		}
+	}
+	if s.Spec.ClusterIP != "" && s.Spec.ClusterIP != "None" {
+		ips = append(ips, s.Spec.ClusterIP)
+	}
+	return dnsNames, ips
+}
+
+// Hosts returns the hosts of the rules and of the TLS sections of the ingress, wildcards included
+func (i *Ingress) Hosts() []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	add := func(h string) {
+		if h != "" && !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	for _, rule := range i.Spec.Rules {
+		add(rule.Host)
+	}
+	for _, tls := range i.Spec.TLS {
+		for _, h := range tls.Hosts {
+			add(h)
+		}
+	}
+	return hosts
+}
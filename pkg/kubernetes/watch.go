@@ -0,0 +1,86 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Types of the events of a watch
+const (
+	EventAdded    = "ADDED"
+	EventModified = "MODIFIED"
+	EventDeleted  = "DELETED"
+	EventBookmark = "BOOKMARK"
+	EventError    = "ERROR"
+)
+
+// WatchEvent is a change of an object of a watched collection, Object is decoded by the handler
+type WatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Watch passes the changes of the collection at path made after resourceVersion to handle. It returns when ctx is
+// done, when the API server ends the watch, which it does after a few minutes, or when handle fails. An expired
+// resource version is returned as a StatusError with the code 410, the collection must then be listed again.
+func (c *Client) Watch(ctx context.Context, path, resourceVersion string, handle func(WatchEvent) error) error {
+	query := url.Values{"watch": {"true"}}
+	if resourceVersion != "" {
+		query.Set("resourceVersion", resourceVersion)
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	resp, err := c.send(ctx, http.MethodGet, path+sep+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event WatchEvent
+		err = decoder.Decode(&event)
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: watch of %s interrupted: %s", verror.ServerUnavailableError, path, err)
+		}
+		if event.Type == EventError {
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(event.Object, &status)
+			return StatusError{Code: status.Code, Message: status.Message}
+		}
+		err = handle(event)
+		if err != nil {
+			return err
+		}
+	}
+}
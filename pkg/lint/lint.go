@@ -0,0 +1,323 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lint checks issued certificates the way zlint does, for the mistakes that make a TLS certificate
+// rejected or unsafe: missing names, weak keys, wrong extended key usages and CA constraints on a leaf. It's meant
+// to run after a certificate is issued and before it's installed.
+package lint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// maxValidity is the longest validity the browsers accept for a TLS certificate
+const maxValidity = 398 * 24 * time.Hour
+
+// Severity tells whether a finding makes the certificate unusable
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Finding is a problem found in a certificate. The codes follow the zlint naming, prefixed by e_ for errors and
+// w_ for warnings.
+type Finding struct {
+	Code     string
+	Severity Severity
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Code, f.Message)
+}
+
+// Options tunes the checks
+type Options struct {
+	// CA checks the certificate as a CA certificate instead of a leaf
+	CA bool
+	// ExtKeyUsages are the extended key usages the certificate must have, e.g. x509.ExtKeyUsageServerAuth
+	ExtKeyUsages []x509.ExtKeyUsage
+	// Now is when the validity is checked, the current time when it's zero
+	Now time.Time
+	// ClockSkew is how far in the future NotBefore may be before it's reported, to tolerate the clocks of the CA and
+	// of the host being slightly apart
+	ClockSkew time.Duration
+	// ClockSkewError reports a NotBefore in the future beyond ClockSkew as an error instead of a warning, since the
+	// certificate is rejected by the peers until their clock reaches it
+	ClockSkewError bool
+	// MaxBackdate, when set, is how far in the past NotBefore may be before it's reported
+	MaxBackdate time.Duration
+}
+
+func (o Options) now() time.Time {
+	if o.Now.IsZero() {
+		return time.Now()
+	}
+	return o.Now
+}
+
+// Certificate lints cert and returns what was found, nothing when the certificate passes all checks
+func Certificate(cert *x509.Certificate, opts Options) []Finding {
+	l := &linter{cert: cert, opts: opts}
+	l.validity()
+	l.signature()
+	l.key()
+	if opts.CA {
+		l.ca()
+	} else {
+		l.names()
+		l.extKeyUsage()
+		l.leafConstraints()
+	}
+	return l.findings
+}
+
+// Clock only checks NotBefore against the local clock: in the future beyond opts.ClockSkew, which happens when the
+// clock of the CA is ahead, or backdated more than opts.MaxBackdate
+func Clock(cert *x509.Certificate, opts Options) []Finding {
+	l := &linter{cert: cert, opts: opts}
+	l.clock(opts.now())
+	return l.findings
+}
+
+// PEM lints the first certificate of data, the other PEM blocks are the chain and are ignored
+func PEM(data []byte, opts Options) ([]Finding, error) {
+	cert, err := ParsePEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return Certificate(cert, opts), nil
+}
+
+// ParsePEM returns the first certificate of data
+func ParsePEM(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%w: no certificate to lint", verror.UserDataError)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse certificate: %s", verror.UserDataError, err)
+		}
+		return cert, nil
+	}
+}
+
+// Err returns an error listing the error findings, or nil when there are only warnings
+func Err(findings []Finding) error {
+	var errs []string
+	for _, f := range findings {
+		if f.Severity == Error {
+			errs = append(errs, f.Code)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: certificate failed lint checks: %s", verror.CertificateCheckError, strings.Join(errs, ", "))
+}
+
+type linter struct {
+	cert     *x509.Certificate
+	opts     Options
+	findings []Finding
+}
+
+func (l *linter) add(severity Severity, code, format string, args ...interface{}) {
+	l.findings = append(l.findings, Finding{Code: code, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) validity() {
+	now := l.opts.now()
+	c := l.cert
+	if now.After(c.NotAfter) {
+		l.add(Error, "e_certificate_expired", "the certificate expired on %s", c.NotAfter.Format(time.RFC3339))
+	} else {
+		l.clock(now)
+	}
+	if !l.opts.CA && c.NotAfter.Sub(c.NotBefore) > maxValidity {
+		l.add(Warning, "w_validity_over_398_days", "the certificate is valid %d days, browsers accept 398 at most",
+			int(c.NotAfter.Sub(c.NotBefore).Hours()/24))
+	}
+}
+
+func (l *linter) clock(now time.Time) {
+	c := l.cert
+	ahead := c.NotBefore.Sub(now)
+	switch {
+	case ahead > l.opts.ClockSkew && l.opts.ClockSkewError:
+		l.add(Error, "e_certificate_not_yet_valid", "the certificate is valid from %s, %s ahead of the local clock",
+			c.NotBefore.Format(time.RFC3339), ahead.Round(time.Second))
+	case ahead > l.opts.ClockSkew:
+		l.add(Warning, "w_certificate_not_yet_valid", "the certificate is valid from %s, %s ahead of the local clock",
+			c.NotBefore.Format(time.RFC3339), ahead.Round(time.Second))
+	case l.opts.MaxBackdate > 0 && -ahead > l.opts.MaxBackdate:
+		l.add(Warning, "w_not_before_backdated", "the certificate is valid from %s, backdated %s, more than %s",
+			c.NotBefore.Format(time.RFC3339), (-ahead).Round(time.Second), l.opts.MaxBackdate)
+	}
+}
+
+func (l *linter) signature() {
+	switch l.cert.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		l.add(Error, "e_signature_algorithm_weak", "the certificate is signed with %s", l.cert.SignatureAlgorithm)
+	}
+}
+
+func (l *linter) key() {
+	switch pub := l.cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			l.add(Error, "e_rsa_mod_less_than_2048_bits", "the RSA key is %d bits", pub.N.BitLen())
+		}
+		if pub.E < 65537 {
+			l.add(Warning, "w_rsa_public_exponent_too_small", "the RSA public exponent is %d", pub.E)
+		}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			l.add(Error, "e_ec_improper_curves", "the ECDSA key is on curve %s", pub.Curve.Params().Name)
+		}
+	}
+}
+
+func (l *linter) names() {
+	c := l.cert
+	if len(c.DNSNames)+len(c.IPAddresses)+len(c.EmailAddresses)+len(c.URIs) == 0 && !hasSANExtension(c) {
+		l.add(Error, "e_ext_san_missing", "the certificate has no subject alternative names, clients ignore the common name")
+		return
+	}
+	cn := c.Subject.CommonName
+	if cn == "" {
+		return
+	}
+	for _, n := range c.DNSNames {
+		if strings.EqualFold(n, cn) {
+			return
+		}
+	}
+	if ip := net.ParseIP(cn); ip != nil {
+		for _, a := range c.IPAddresses {
+			if a.Equal(ip) {
+				return
+			}
+		}
+	}
+	l.add(Warning, "w_subject_common_name_not_in_san", "the common name %s is not a subject alternative name", cn)
+}
+
+func (l *linter) extKeyUsage() {
+	c := l.cert
+	if len(c.ExtKeyUsage) == 0 && len(c.UnknownExtKeyUsage) == 0 {
+		l.add(Warning, "w_sub_cert_eku_missing", "the certificate has no extended key usage, so it can be used for any purpose")
+	}
+	for _, u := range c.ExtKeyUsage {
+		if u == x509.ExtKeyUsageAny {
+			l.add(Error, "e_sub_cert_eku_any", "the certificate has the any extended key usage")
+		}
+	}
+	for _, expected := range l.opts.ExtKeyUsages {
+		if !hasExtKeyUsage(c, expected) {
+			l.add(Error, "e_sub_cert_eku_expected_missing", "the certificate lacks the %s extended key usage", extKeyUsageNames[expected])
+		}
+	}
+}
+
+func (l *linter) leafConstraints() {
+	c := l.cert
+	if c.BasicConstraintsValid && c.IsCA {
+		l.add(Error, "e_ca_true_on_leaf", "the certificate is a CA certificate")
+	}
+	if c.BasicConstraintsValid && !c.IsCA && (c.MaxPathLen > 0 || c.MaxPathLenZero) {
+		l.add(Error, "e_path_len_constraint_improperly_included", "the certificate has a path length constraint without being a CA")
+	}
+	if c.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		l.add(Error, "e_sub_cert_key_usage_cert_sign", "the certificate can sign certificates or CRLs")
+	}
+}
+
+func (l *linter) ca() {
+	c := l.cert
+	if !c.BasicConstraintsValid || !c.IsCA {
+		l.add(Error, "e_ca_basic_constraints_missing", "the certificate isn't marked as a CA")
+	}
+	if c.KeyUsage&x509.KeyUsageCertSign == 0 {
+		l.add(Error, "e_ca_key_cert_sign_missing", "the CA certificate can't sign certificates")
+	}
+}
+
+func hasSANExtension(c *x509.Certificate) bool {
+	for _, e := range c.Extensions {
+		if e.Id.String() == "2.5.29.17" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExtKeyUsage(c *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range c.ExtKeyUsage {
+		if u == usage || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+// ParseExtKeyUsage returns the extended key usage named like in OpenSSL, e.g. serverAuth
+func ParseExtKeyUsage(name string) (x509.ExtKeyUsage, error) {
+	for u, n := range extKeyUsageNames {
+		if strings.EqualFold(n, name) {
+			return u, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown extended key usage %q", verror.UserDataError, name)
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+var now = time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+
+func issue(t *testing.T, template *x509.Certificate, pub interface{}) *x509.Certificate {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(1)
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = now.Add(-time.Hour)
+		template.NotAfter = now.Add(90 * 24 * time.Hour)
+	}
+	if pub == nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub = key.Public()
+	}
+	parent := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "Lint CA"}}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func codes(findings []Finding) map[string]Severity {
+	m := map[string]Severity{}
+	for _, f := range findings {
+		m[f.Code] = f.Severity
+	}
+	return m
+}
+
+func TestCertificateClean(t *testing.T) {
+	cert := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "www.venafi.example"},
+		DNSNames:    []string{"www.venafi.example"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, nil)
+	findings := Certificate(cert, Options{Now: now, ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	if len(findings) != 0 {
+		t.Fatalf("expected no findings, got %v", findings)
+	}
+	if Err(findings) != nil {
+		t.Fatal("expected no error")
+	}
+}
+
+func TestCertificateFindings(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "www.venafi.example"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(500 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, weak.Public())
+	found := codes(Certificate(cert, Options{Now: now, ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}))
+	for code, severity := range map[string]Severity{
+		"e_ext_san_missing":              Error,
+		"e_rsa_mod_less_than_2048_bits":  Error,
+		"e_sub_cert_eku_any":             Error,
+		"e_ca_true_on_leaf":              Error,
+		"e_sub_cert_key_usage_cert_sign": Error,
+		"w_validity_over_398_days":       Warning,
+	} {
+		if s, ok := found[code]; !ok || s != severity {
+			t.Errorf("expected %s %s, got %v", severity, code, found)
+		}
+	}
+	// the any usage covers the expected ones
+	if _, ok := found["e_sub_cert_eku_expected_missing"]; ok {
+		t.Errorf("didn't expect e_sub_cert_eku_expected_missing, got %v", found)
+	}
+
+	leaf := issue(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "www.venafi.example"},
+		DNSNames: []string{"api.venafi.example"},
+		// crypto/x509 refuses to make it: basic constraints with cA false and a path length of 1
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 19}, Value: []byte{0x30, 0x03, 0x02, 0x01, 0x01}}},
+	}, nil)
+	findings := Certificate(leaf, Options{Now: now.Add(100 * 24 * time.Hour), ExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	found = codes(findings)
+	for code, severity := range map[string]Severity{
+		"e_path_len_constraint_improperly_included": Error,
+		"w_subject_common_name_not_in_san":          Warning,
+		"w_sub_cert_eku_missing":                    Warning,
+		"e_sub_cert_eku_expected_missing":           Error,
+		"e_certificate_expired":                     Error,
+	} {
+		if s, ok := found[code]; !ok || s != severity {
+			t.Errorf("expected %s %s, got %v", severity, code, found)
+		}
+	}
+	err = Err(findings)
+	if !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected a certificate check error, got %v", err)
+	}
+}
+
+func TestCertificateCA(t *testing.T) {
+	cert := issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Issuing CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(5 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}, nil)
+	if findings := Certificate(cert, Options{Now: now, CA: true}); len(findings) != 0 {
+		t.Fatalf("expected no findings for a CA, got %v", findings)
+	}
+}
+
+func TestClock(t *testing.T) {
+	ahead := issue(t, &x509.Certificate{NotBefore: now.Add(5 * time.Minute), NotAfter: now.Add(24 * time.Hour)}, nil)
+	for _, tc := range []struct {
+		opts     Options
+		expected map[string]Severity
+	}{
+		{Options{Now: now}, map[string]Severity{"w_certificate_not_yet_valid": Warning}},
+		{Options{Now: now, ClockSkewError: true}, map[string]Severity{"e_certificate_not_yet_valid": Error}},
+		{Options{Now: now, ClockSkew: 10 * time.Minute, ClockSkewError: true}, map[string]Severity{}},
+	} {
+		found := codes(Clock(ahead, tc.opts))
+		if len(found) != len(tc.expected) {
+			t.Errorf("%+v: expected %v, got %v", tc.opts, tc.expected, found)
+		}
+		for code, severity := range tc.expected {
+			if s, ok := found[code]; !ok || s != severity {
+				t.Errorf("%+v: expected %s %s, got %v", tc.opts, severity, code, found)
+			}
+		}
+	}
+
+	backdated := issue(t, &x509.Certificate{NotBefore: now.Add(-2 * time.Hour), NotAfter: now.Add(24 * time.Hour)}, nil)
+	if found := codes(Clock(backdated, Options{Now: now})); len(found) != 0 {
+		t.Errorf("expected no findings without a maximum backdate, got %v", found)
+	}
+	if findings := Clock(backdated, Options{Now: now, MaxBackdate: time.Hour}); len(findings) != 1 || findings[0].Code != "w_not_before_backdated" {
+		t.Errorf("expected w_not_before_backdated, got %v", findings)
+	}
+	if found := codes(Clock(backdated, Options{Now: now, MaxBackdate: 3 * time.Hour})); len(found) != 0 {
+		t.Errorf("expected no findings within the maximum backdate, got %v", found)
+	}
+}
+
+func TestPEM(t *testing.T) {
+	cert := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "www.venafi.example"}, DNSNames: []string{"www.venafi.example"}}, nil)
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	findings, err := PEM(append([]byte("subject=www.venafi.example\n"), data...), Options{Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Code != "w_sub_cert_eku_missing" {
+		t.Fatalf("expected w_sub_cert_eku_missing only, got %v", findings)
+	}
+	if _, err = PEM([]byte("no certificate"), Options{}); err == nil {
+		t.Fatal("expected an error without a certificate")
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lock serializes the renewals of a certificate between processes, so vcert instances running on the same
+// host, or in the same cluster with a distributed Locker, don't renew a certificate at the same time and overwrite
+// each other's files.
+package lock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const defaultPollInterval = 200 * time.Millisecond
+
+// Locker acquires named locks. Implementations backed by a distributed store (etcd, Consul, a Kubernetes lease...)
+// serialize the renewals across hosts.
+type Locker interface {
+	// Lock blocks until the lock called name is held, or ctx is done. ctx only bounds the wait, the lock is held
+	// until the returned function is called.
+	Lock(ctx context.Context, name string) (unlock func() error, err error)
+}
+
+// ErrLocked is returned when a lock couldn't be acquired before the context was done
+type ErrLocked struct {
+	Name string
+	Err  error
+}
+
+func (err ErrLocked) Error() string {
+	return fmt.Sprintf("lock %q is held by another process: %s", err.Name, err.Err)
+}
+
+func (err ErrLocked) Unwrap() error {
+	return verror.VcertError
+}
+
+func (err ErrLocked) Code() string {
+	return verror.CodeLocked
+}
+
+// FileLocker locks files in Dir with flock, or LockFileEx on Windows. The locks are released by the system when a
+// process dies, so a crashed instance never leaves a stale lock behind.
+type FileLocker struct {
+	Dir string
+	// PollInterval is how often a held lock is tried again, it defaults to 200ms
+	PollInterval time.Duration
+}
+
+// NewFileLocker returns a FileLocker creating its lock files in dir
+func NewFileLocker(dir string) *FileLocker {
+	return &FileLocker{Dir: dir}
+}
+
+func (l *FileLocker) Lock(ctx context.Context, name string) (func() error, error) {
+	err := os.MkdirAll(l.Dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create lock directory: %s", verror.UserDataError, err)
+	}
+	path := filepath.Join(l.Dir, fileName(name))
+	// the file is never removed: removing it while another process waits on it would let a third one lock a new file
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to open lock file: %s", verror.UserDataError, err)
+	}
+	interval := l.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%w: failed to lock %s: %s", verror.VcertError, path, err)
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ErrLocked{Name: name, Err: ctx.Err()}
+		case <-time.After(interval):
+		}
+	}
+	// the PID of the holder helps finding who holds a lock for long
+	if err = f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return func() error {
+		err := unlock(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+// Stale returns the lock files of the directory no process holds that weren't locked since before. They pile up
+// as certificates are removed from the playbooks, since the lock files are never removed while in use.
+func (l *FileLocker) Stale(before time.Time) ([]string, error) {
+	files, err := ioutil.ReadDir(l.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read lock directory: %s", verror.UserDataError, err)
+	}
+	var stale []string
+	for _, fi := range files {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != ".lock" || !fi.ModTime().Before(before) {
+			continue
+		}
+		path := filepath.Join(l.Dir, fi.Name())
+		held, err := isHeld(path)
+		if err != nil {
+			return nil, err
+		}
+		if !held {
+			stale = append(stale, path)
+		}
+	}
+	return stale, nil
+}
+
+// Remove removes the lock file at path unless a process holds it. A process that opened the file just before it's
+// removed still gets its lock, so only the lock files of certificates that aren't renewed anymore should be removed.
+func (l *FileLocker) Remove(path string) error {
+	held, err := isHeld(path)
+	if err != nil {
+		return err
+	}
+	if held {
+		return ErrLocked{Name: filepath.Base(path), Err: fmt.Errorf("lock file is in use")}
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// isHeld tells whether a process holds the lock file at path
+func isHeld(path string) (bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: failed to open lock file: %s", verror.UserDataError, err)
+	}
+	defer f.Close()
+	locked, err := tryLock(f)
+	if err != nil {
+		return false, fmt.Errorf("%w: failed to lock %s: %s", verror.VcertError, path, err)
+	}
+	if locked {
+		return false, unlock(f)
+	}
+	return true, nil
+}
+
+// fileName keeps the readable characters of name, and adds a hash of it when characters had to be replaced or the
+// name is long, so distinct names never share a file
+func fileName(name string) string {
+	safe := make([]byte, 0, len(name))
+	changed := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' {
+			safe = append(safe, c)
+		} else {
+			safe = append(safe, '_')
+			changed = true
+		}
+	}
+	if len(safe) > 64 {
+		safe = safe[len(safe)-64:]
+		changed = true
+	}
+	if changed || len(safe) == 0 {
+		sum := sha256.Sum256([]byte(name))
+		safe = append(safe, '-')
+		safe = append(safe, hex.EncodeToString(sum[:8])...)
+	}
+	return string(safe) + ".lock"
+}
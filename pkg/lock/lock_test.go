@@ -0,0 +1,133 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestFileLocker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := &FileLocker{Dir: dir, PollInterval: 10 * time.Millisecond}
+
+	unlock, err := l.Lock(context.Background(), "/etc/ssl/web/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another lock is independent
+	unlockOther, err := l.Lock(context.Background(), "/etc/ssl/api/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlockOther()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = l.Lock(ctx, "/etc/ssl/web/cert.pem")
+	var locked ErrLocked
+	if !errors.As(err, &locked) || !errors.Is(err, verror.VcertError) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	released := make(chan error)
+	go func() {
+		unlock, err := l.Lock(context.Background(), "/etc/ssl/web/cert.pem")
+		if err == nil {
+			err = unlock()
+		}
+		released <- err
+	}()
+	time.Sleep(30 * time.Millisecond)
+	if err = unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-released:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock wasn't acquired once released")
+	}
+}
+
+func TestFileLockerStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := NewFileLocker(dir)
+	for _, name := range []string{"old", "held"} {
+		unlock, err := l.Lock(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "held" {
+			defer unlock()
+		} else if err = unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stale, err := l.Stale(time.Now().Add(-time.Hour)); err != nil || len(stale) != 0 {
+		t.Errorf("expected no stale lock files, got %v, %v", stale, err)
+	}
+	stale, err := l.Stale(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || filepath.Base(stale[0]) != "old.lock" {
+		t.Fatalf("expected the unheld lock file to be stale, got %v", stale)
+	}
+	if err = l.Remove(stale[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(stale[0]); !os.IsNotExist(err) {
+		t.Errorf("lock file wasn't removed: %v", err)
+	}
+	var locked ErrLocked
+	if err = l.Remove(filepath.Join(dir, "held.lock")); !errors.As(err, &locked) {
+		t.Errorf("expected ErrLocked for a held lock, got %v", err)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	if n := fileName("web.example.com"); n != "web.example.com.lock" {
+		t.Errorf("unexpected file name %s", n)
+	}
+	a, b := fileName("/etc/ssl/a_b"), fileName("/etc/ssl/a/b")
+	if a == b || !strings.HasPrefix(a, "_etc_ssl_a_b-") {
+		t.Errorf("unexpected file names %s and %s", a, b)
+	}
+	if n := fileName(strings.Repeat("x", 200)); len(n) > 100 {
+		t.Errorf("file name is too long: %s", n)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mtls issues the two certificates of a mutual TLS connection between services: the certificate of the
+// server, with the serverAuth extended key usage, and the one of its client, with clientAuth, along with the bundle of
+// the CA certificates both sides trust to verify each other.
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const retrieveTimeout = 180 * time.Second
+
+// Identity names one side of the connection. URIs are usually the SPIFFE ID of the service.
+type Identity struct {
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []string
+}
+
+func (id Identity) empty() bool {
+	return id.CommonName == "" && len(id.DNSNames) == 0 && len(id.IPAddresses) == 0 && len(id.URIs) == 0
+}
+
+// Request describes the pair. The key settings apply to both certificates, their zero values leave the defaults of
+// certificate.Request.
+type Request struct {
+	// Zone is the zone of both certificates, the one of the connector when empty
+	Zone          string
+	Server        Identity
+	Client        Identity
+	KeyType       certificate.KeyType
+	KeyLength     int
+	KeyCurve      certificate.EllipticCurve
+	ValidityHours int
+}
+
+// Pair is the issued certificates with their private keys
+type Pair struct {
+	Server *certificate.PEMCollection
+	Client *certificate.PEMCollection
+	// CABundle is the CA certificates of both chains in PEM, each once, which the server trusts to verify the client
+	// and the client to verify the server
+	CABundle []string
+}
+
+// Issue requests the server and client certificates of req. Both requests are checked against the policy of the zone
+// before either is sent, so a pair isn't left half issued, and the issued certificates are checked to have the
+// extended key usage of their side, which the CA may not have kept.
+func Issue(ctx context.Context, connector endpoint.Connector, req Request) (*Pair, error) {
+	if req.Server.empty() {
+		return nil, fmt.Errorf("%w: the server needs a common name or SANs", verror.UserDataError)
+	}
+	if req.Client.empty() {
+		return nil, fmt.Errorf("%w: the client needs a common name or SANs", verror.UserDataError)
+	}
+	if req.Zone != "" {
+		connector.SetZone(req.Zone)
+	}
+	zc, err := connector.ReadZoneConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read zone configuration: %w", err)
+	}
+	server, err := req.build(req.Server, x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, err
+	}
+	client, err := req.build(req.Client, x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range []struct {
+		side string
+		req  *certificate.Request
+	}{{"server", server}, {"client", client}} {
+		err = connector.GenerateRequest(zc, r.req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the %s request: %w", r.side, err)
+		}
+		err = zc.ValidateCertificateRequest(r.req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: the %s request doesn't match the policy of the zone: %s", verror.PolicyValidationError, r.side, err)
+		}
+	}
+
+	pair := &Pair{}
+	pair.Server, err = enroll(ctx, connector, server, x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue the server certificate: %w", err)
+	}
+	pair.Client, err = enroll(ctx, connector, client, x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue the client certificate: %w", err)
+	}
+	pair.CABundle = bundle(pair.Server.Chain, pair.Client.Chain)
+	return pair, nil
+}
+
+func (req Request) build(id Identity, usage x509.ExtKeyUsage) (*certificate.Request, error) {
+	b := certificate.NewRequestBuilder().
+		CommonName(id.CommonName).
+		DNSNames(id.DNSNames...).
+		IPAddresses(id.IPAddresses...).
+		URIs(id.URIs...).
+		ExtKeyUsages(usage).
+		KeyType(req.KeyType).
+		ChainOption(certificate.ChainOptionRootLast)
+	if req.KeyLength != 0 {
+		b.KeyLength(req.KeyLength)
+	}
+	if req.KeyCurve != certificate.EllipticCurveNotSet {
+		b.KeyCurve(req.KeyCurve)
+	}
+	if req.ValidityHours != 0 {
+		b.ValidityHours(req.ValidityHours)
+	}
+	return b.Build()
+}
+
+func enroll(ctx context.Context, connector endpoint.Connector, req *certificate.Request, usage x509.ExtKeyUsage) (*certificate.PEMCollection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var err error
+	req.PickupID, err = connector.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	req.Timeout = retrieveTimeout
+	pcc, err := connector.RetrieveCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	err = checkExtKeyUsage(pcc.Certificate, usage)
+	if err != nil {
+		return nil, err
+	}
+	err = pcc.AddPrivateKey(req.PrivateKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return pcc, nil
+}
+
+// checkExtKeyUsage checks the issued certificate can be used for usage. A certificate without extended key usages
+// can be used for any, like one with the any usage, which a peer may refuse for a mutual TLS connection.
+func checkExtKeyUsage(certPEM string, usage x509.ExtKeyUsage) error {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return fmt.Errorf("%w: failed to decode the issued certificate", verror.ServerError)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	for _, u := range cert.ExtKeyUsage {
+		if u == x509.ExtKeyUsageAny {
+			return fmt.Errorf("%w: the certificate was issued with the any extended key usage", verror.CertificateCheckError)
+		}
+	}
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return nil
+		}
+	}
+	name := "serverAuth"
+	if usage == x509.ExtKeyUsageClientAuth {
+		name = "clientAuth"
+	}
+	return fmt.Errorf("%w: the certificate was issued without the %s extended key usage, check the policy of the zone", verror.CertificateCheckError, name)
+}
+
+// bundle returns the certificates of the chains, each once, in their order
+func bundle(chains ...[]string) []string {
+	var certs []string
+	seen := map[string]bool{}
+	for _, chain := range chains {
+		for _, c := range chain {
+			block, _ := pem.Decode([]byte(c))
+			key := c
+			if block != nil {
+				key = string(block.Bytes)
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			certs = append(certs, c)
+		}
+	}
+	return certs
+}
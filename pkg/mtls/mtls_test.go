@@ -0,0 +1,94 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func parse(t *testing.T, data string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		t.Fatal("no PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestIssue(t *testing.T) {
+	req := Request{
+		Server:  Identity{CommonName: "payments.example.com", DNSNames: []string{"payments.example.com"}},
+		Client:  Identity{CommonName: "orders", URIs: []string{"spiffe://example.com/orders"}},
+		KeyType: certificate.KeyTypeECDSA,
+	}
+	pair, err := Issue(context.Background(), fake.NewConnector(false, nil), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Server.PrivateKey == "" || pair.Client.PrivateKey == "" {
+		t.Fatal("missing private keys")
+	}
+	if len(pair.CABundle) == 0 || len(pair.CABundle) > len(pair.Server.Chain)+len(pair.Client.Chain) {
+		t.Fatalf("unexpected CA bundle of %d certificates", len(pair.CABundle))
+	}
+	// both certificates come from the same CA, which is in the bundle once
+	if len(pair.CABundle) != len(pair.Server.Chain) {
+		t.Fatalf("CA bundle has %d certificates, the chain %d", len(pair.CABundle), len(pair.Server.Chain))
+	}
+
+	roots := x509.NewCertPool()
+	for _, c := range pair.CABundle {
+		roots.AddCert(parse(t, c))
+	}
+	server := parse(t, pair.Server.Certificate)
+	_, err = server.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	if err != nil {
+		t.Fatalf("server certificate: %s", err)
+	}
+	client := parse(t, pair.Client.Certificate)
+	_, err = client.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	if err != nil {
+		t.Fatalf("client certificate: %s", err)
+	}
+	if len(client.URIs) != 1 || client.URIs[0].String() != "spiffe://example.com/orders" {
+		t.Fatalf("unexpected client URIs %v", client.URIs)
+	}
+
+	// the server certificate doesn't have clientAuth
+	err = checkExtKeyUsage(pair.Server.Certificate, x509.ExtKeyUsageClientAuth)
+	if !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected certificate check error, got %v", err)
+	}
+}
+
+func TestIssueInvalid(t *testing.T) {
+	_, err := Issue(context.Background(), fake.NewConnector(false, nil), Request{Server: Identity{CommonName: "a"}})
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected user data error, got %v", err)
+	}
+}
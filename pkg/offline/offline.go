@@ -0,0 +1,265 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package offline carries enrollments in and out of air-gapped networks. The enrollment request, CSR and metadata,
+// is written to a portable file on the disconnected host, whose private key never leaves it. The file is submitted
+// from a connected network, and the response file holding the certificate is imported back:
+//
+//	air-gapped:  req, _ := offline.NewRequest(certRequest, zone); req.WriteFile("request.json")
+//	connected:   resp, _ := req.Submit(connector); resp.WriteFile("response.json")
+//	air-gapped:  pcc, _ := resp.Import(req)
+package offline
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	formatVersion = 1
+
+	// DefaultTimeout is how long Submit waits for the certificate to be issued
+	DefaultTimeout = 180 * time.Second
+)
+
+// Request is an enrollment request prepared on an air-gapped host
+type Request struct {
+	Version int `json:"version"`
+	// ID identifies the request, the response carries it back
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Zone      string    `json:"zone"`
+	// CSR is PEM encoded
+	CSR           string        `json:"csr"`
+	FriendlyName  string        `json:"friendlyName,omitempty"`
+	ValidityHours int           `json:"validityHours,omitempty"`
+	IssuerHint    string        `json:"issuerHint,omitempty"`
+	CustomFields  []CustomField `json:"customFields,omitempty"`
+}
+
+type CustomField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Origin bool   `json:"origin,omitempty"`
+}
+
+// Response is the outcome of a Request submitted from a connected network
+type Response struct {
+	Version   int       `json:"version"`
+	RequestID string    `json:"requestId"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	PickupID  string    `json:"pickupId"`
+	// Certificate and Chain are PEM encoded, the chain has the root last
+	Certificate string   `json:"certificate"`
+	Chain       []string `json:"chain,omitempty"`
+}
+
+// NewRequest prepares the offline enrollment of req in zone. The CSR of req must already be generated, or set.
+func NewRequest(req *certificate.Request, zone string) (*Request, error) {
+	csr := req.GetCSR()
+	if len(csr) == 0 {
+		return nil, fmt.Errorf("%w: offline requests need a CSR", verror.UserDataError)
+	}
+	if zone == "" {
+		return nil, fmt.Errorf("%w: offline requests need a zone", verror.UserDataError)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	r := &Request{
+		Version:       formatVersion,
+		ID:            hex.EncodeToString(id),
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+		Zone:          zone,
+		CSR:           string(csr),
+		FriendlyName:  req.FriendlyName,
+		ValidityHours: req.ValidityHours,
+		IssuerHint:    req.IssuerHint,
+	}
+	for _, f := range req.CustomFields {
+		r.CustomFields = append(r.CustomFields, CustomField{Name: f.Name, Value: f.Value, Origin: f.Type == certificate.CustomFieldOrigin})
+	}
+	return r, nil
+}
+
+// CertificateRequest returns the request to submit to the platform
+func (r *Request) CertificateRequest() (*certificate.Request, error) {
+	req := &certificate.Request{
+		CsrOrigin:     certificate.UserProvidedCSR,
+		FriendlyName:  r.FriendlyName,
+		ValidityHours: r.ValidityHours,
+		IssuerHint:    r.IssuerHint,
+		ChainOption:   certificate.ChainOptionRootLast,
+	}
+	err := req.SetCSR([]byte(r.CSR))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSR in offline request: %s", verror.UserDataError, err)
+	}
+	for _, f := range r.CustomFields {
+		field := certificate.CustomField{Name: f.Name, Value: f.Value}
+		if f.Origin {
+			field.Type = certificate.CustomFieldOrigin
+		}
+		req.CustomFields = append(req.CustomFields, field)
+	}
+	return req, nil
+}
+
+// Submit requests the certificate and waits up to timeout for it to be issued, DefaultTimeout when timeout is
+// zero. When the wait times out the returned error holds the pickup ID, and Pickup can be called later.
+func (r *Request) Submit(conn endpoint.Connector, timeout time.Duration) (*Response, error) {
+	req, err := r.CertificateRequest()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetZone(r.Zone)
+	err = conn.GenerateRequest(nil, req)
+	if err != nil {
+		return nil, err
+	}
+	req.PickupID, err = conn.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	return r.Pickup(conn, req.PickupID, timeout)
+}
+
+// Pickup retrieves the certificate of a request already submitted
+func (r *Request) Pickup(conn endpoint.Connector, pickupID string, timeout time.Duration) (*Response, error) {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	req := &certificate.Request{PickupID: pickupID, ChainOption: certificate.ChainOptionRootLast, Timeout: timeout}
+	pcc, err := conn.RetrieveCertificate(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve certificate %s: %w", pickupID, err)
+	}
+	return &Response{
+		Version:     formatVersion,
+		RequestID:   r.ID,
+		IssuedAt:    time.Now().UTC().Truncate(time.Second),
+		PickupID:    pickupID,
+		Certificate: pcc.Certificate,
+		Chain:       pcc.Chain,
+	}, nil
+}
+
+// Import checks that the response answers r and that the certificate was issued for the public key of its CSR,
+// then returns the certificate and its chain
+func (resp *Response) Import(r *Request) (*certificate.PEMCollection, error) {
+	if resp.RequestID != r.ID {
+		return nil, fmt.Errorf("%w: response is for request %s, not %s", verror.UserDataError, resp.RequestID, r.ID)
+	}
+	b, _ := pem.Decode([]byte(resp.Certificate))
+	if b == nil {
+		return nil, fmt.Errorf("%w: response has no certificate", verror.UserDataError)
+	}
+	cert, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid certificate in response: %s", verror.UserDataError, err)
+	}
+	b, _ = pem.Decode([]byte(r.CSR))
+	if b == nil {
+		return nil, fmt.Errorf("%w: request has no CSR", verror.UserDataError)
+	}
+	csr, err := x509.ParseCertificateRequest(b.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSR in request: %s", verror.UserDataError, err)
+	}
+	certKey, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	csrKey, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(certKey, csrKey) {
+		return nil, fmt.Errorf("%w: certificate of the response wasn't issued for the key of the request", verror.UserDataError)
+	}
+	return &certificate.PEMCollection{Certificate: resp.Certificate, Chain: resp.Chain}, nil
+}
+
+// WriteFile writes the request as JSON
+func (r *Request) WriteFile(path string) error {
+	return writeJSON(path, r)
+}
+
+// WriteFile writes the response as JSON
+func (resp *Response) WriteFile(path string) error {
+	return writeJSON(path, resp)
+}
+
+// ReadRequest reads a request written by Request.WriteFile
+func ReadRequest(path string) (*Request, error) {
+	r := &Request{}
+	err := readJSON(path, r, &r.Version)
+	if err != nil {
+		return nil, err
+	}
+	if r.ID == "" || r.CSR == "" {
+		return nil, fmt.Errorf("%w: %s is not an offline request", verror.UserDataError, path)
+	}
+	return r, nil
+}
+
+// ReadResponse reads a response written by Response.WriteFile
+func ReadResponse(path string) (*Response, error) {
+	resp := &Response{}
+	err := readJSON(path, resp, &resp.Version)
+	if err != nil {
+		return nil, err
+	}
+	if resp.RequestID == "" || resp.Certificate == "" {
+		return nil, fmt.Errorf("%w: %s is not an offline response", verror.UserDataError, path)
+	}
+	return resp, nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func readJSON(path string, v interface{}, version *int) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", verror.UserDataError, err)
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse %s: %s", verror.UserDataError, path, err)
+	}
+	if *version != formatVersion {
+		return fmt.Errorf("%w: %s has unsupported version %d", verror.UserDataError, path, *version)
+	}
+	return nil
+}
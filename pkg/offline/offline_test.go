@@ -0,0 +1,116 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package offline
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func newOfflineRequest(t *testing.T, cn string) *Request {
+	req := &certificate.Request{KeyType: certificate.KeyTypeECDSA, KeyCurve: certificate.EllipticCurveP256, ValidityHours: 48}
+	req.Subject.CommonName = cn
+	req.DNSNames = []string{cn}
+	req.CustomFields = []certificate.CustomField{{Name: "Cost Center", Value: "42"}, {Name: "Origin", Value: "test", Type: certificate.CustomFieldOrigin}}
+	err := req.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = req.GenerateCSR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRequest(req, "Default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestOfflineEnrollment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = NewRequest(&certificate.Request{}, "Default")
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("request without CSR should be rejected, got %v", err)
+	}
+
+	r := newOfflineRequest(t, "www.example.com")
+	requestFile := filepath.Join(dir, "request.json")
+	err = r.WriteFile(requestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// on the connected side
+	submitted, err := ReadRequest(requestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(submitted.CustomFields) != 2 || !submitted.CustomFields[1].Origin || submitted.ValidityHours != 48 {
+		t.Fatalf("metadata wasn't kept: %+v", submitted)
+	}
+	resp, err := submitted.Submit(fake.NewConnector(false, nil), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseFile := filepath.Join(dir, "response.json")
+	err = resp.WriteFile(responseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// back on the air-gapped host
+	imported, err := ReadResponse(responseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcc, err := imported.Import(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pcc.Certificate == "" || len(pcc.Chain) == 0 {
+		t.Fatalf("unexpected certificates %+v", pcc)
+	}
+
+	other := newOfflineRequest(t, "www.example.com")
+	_, err = imported.Import(other)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("response of another request should be rejected, got %v", err)
+	}
+	imported.RequestID = other.ID
+	_, err = imported.Import(other)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("certificate for another key should be rejected, got %v", err)
+	}
+
+	_, err = ReadResponse(requestFile)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("request file isn't a response, got %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/youmark/pkcs8"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/installer"
+	"github.com/Venafi/vcert/v4/pkg/util"
+)
+
+// endpointCheckDeadline bounds the time spent waiting for an endpoint to serve the installed certificate
+const endpointCheckDeadline = 10 * time.Second
+
+// Drift is a difference between what the playbook declares and what is installed
+type Drift struct {
+	Task string
+	// Location is the file or the endpoint that drifted
+	Location string
+	Reason   string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Task, d.Location, d.Reason)
+}
+
+// Check compares the installed certificates with the playbook without changing anything nor contacting the
+// platform. For each installation the certificate must be present, carry the requested names, not be due for
+// renewal and match the key and the certificates of the other installations of the task. Installations with an
+// endpoint are also checked to serve that certificate.
+func (r *Runner) Check(ctx context.Context) ([]Drift, error) {
+	var drifts []Drift
+	for i := range r.Playbook.CertificateTasks {
+		task := &r.Playbook.CertificateTasks[i]
+		d, err := r.checkTask(ctx, task)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, d...)
+	}
+	return drifts, nil
+}
+
+func (r *Runner) checkTask(ctx context.Context, task *CertificateTask) ([]Drift, error) {
+	threshold, err := task.renewalThreshold()
+	if err != nil {
+		return nil, err
+	}
+	keyPassword, err := resolveSecret(task.Request.KeyPassword)
+	if err != nil {
+		return nil, err
+	}
+	var drifts []Drift
+	drift := func(location, format string, args ...interface{}) {
+		drifts = append(drifts, Drift{Task: task.Name, Location: location, Reason: fmt.Sprintf(format, args...)})
+	}
+	var first *x509.Certificate
+	var firstFile string
+	for _, inst := range task.Installations {
+		if !inst.writesFiles() {
+			// the certificates stored by services aren't read back
+			continue
+		}
+		inst, err := task.installed(inst)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := readCertificate(inst.File)
+		if os.IsNotExist(err) {
+			drift(inst.File, "certificate is not installed")
+			continue
+		}
+		if err != nil {
+			drift(inst.File, "installed certificate can't be read: %s", err)
+			continue
+		}
+		if first == nil {
+			first, firstFile = cert, inst.File
+		} else if !bytes.Equal(first.Raw, cert.Raw) {
+			drift(inst.File, "certificate %s differs from %s installed to %s", thumbprint(cert), thumbprint(first), firstFile)
+		}
+		for _, name := range missingNames(&task.Request, cert) {
+			drift(inst.File, "certificate doesn't include %s", name)
+		}
+		if now := r.now(); !now.Before(cert.NotAfter) {
+			drift(inst.File, "certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+		} else if !now.Before(r.renewAt(threshold, task.jitterKey(), cert.NotBefore, cert.NotAfter)) {
+			drift(inst.File, "certificate expires on %s and is due for renewal", cert.NotAfter.Format(time.RFC3339))
+		}
+		if inst.ChainFile != "" {
+			if reason := checkChain(inst.ChainFile, cert); reason != "" {
+				drift(inst.ChainFile, reason)
+			}
+		}
+		if inst.KeyFile != "" {
+			if reason := checkKey(inst.KeyFile, keyPassword, cert); reason != "" {
+				drift(inst.KeyFile, reason)
+			}
+		}
+		if inst.Endpoint != "" {
+			err = installer.VerifyServed(ctx, inst.Endpoint, cert, installer.VerifyOptions{Deadline: endpointCheckDeadline, Once: true})
+			if err != nil {
+				drift(inst.Endpoint, "%s", err)
+			}
+		}
+	}
+	return drifts, nil
+}
+
+// missingNames returns the common name, DNS names and IP addresses of the request that the certificate lacks
+func missingNames(req *Request, cert *x509.Certificate) []string {
+	var missing []string
+	if cn := req.Subject.CommonName; cn != "" && !strings.EqualFold(cn, cert.Subject.CommonName) {
+		if a, err := certificate.ToASCII(cn); err != nil || !strings.EqualFold(a, cert.Subject.CommonName) {
+			missing = append(missing, "common name "+cn)
+		}
+	}
+	for _, name := range req.SANs.DNS {
+		a, err := certificate.ToASCII(name)
+		if err != nil {
+			a = name
+		}
+		found := false
+		for _, n := range cert.DNSNames {
+			found = found || strings.EqualFold(n, a)
+		}
+		if !found {
+			missing = append(missing, "DNS name "+name)
+		}
+	}
+	for _, s := range req.SANs.IP {
+		ip := net.ParseIP(s)
+		found := false
+		for _, certIP := range cert.IPAddresses {
+			found = found || certIP.Equal(ip)
+		}
+		if !found {
+			missing = append(missing, "IP address "+s)
+		}
+	}
+	return missing
+}
+
+// extraNames returns the DNS names of the certificate, other than its common name, the request no longer has
+func extraNames(req *Request, cert *x509.Certificate) []string {
+	requested := make(map[string]bool)
+	for _, name := range req.SANs.DNS {
+		if a, err := certificate.ToASCII(name); err == nil {
+			name = a
+		}
+		requested[strings.ToLower(name)] = true
+	}
+	var extra []string
+	for _, name := range cert.DNSNames {
+		if !requested[strings.ToLower(name)] && !strings.EqualFold(name, cert.Subject.CommonName) {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	return extra
+}
+
+// checkKey tells why the private key in path doesn't go with cert, it returns an empty string when it does
+// checkChain makes sure the chain holds the issuer of cert, whatever the order of the chain
+func checkChain(path string, cert *x509.Certificate) string {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "chain is not installed"
+	}
+	if err != nil {
+		return fmt.Sprintf("chain can't be read: %s", err)
+	}
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return ""
+	}
+	var lastErr error
+	for {
+		var b *pem.Block
+		b, data = pem.Decode(data)
+		if b == nil {
+			break
+		}
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+		issuer, err := certificate.ParseCertificate(b.Bytes)
+		if err != nil {
+			return fmt.Sprintf("chain can't be parsed: %s", err)
+		}
+		if !bytes.Equal(issuer.RawSubject, cert.RawIssuer) {
+			continue
+		}
+		if lastErr = certificate.CheckSignatureFrom(cert, issuer); lastErr == nil {
+			return ""
+		}
+	}
+	if lastErr != nil {
+		return fmt.Sprintf("chain issuer didn't sign the certificate: %s", lastErr)
+	}
+	return "chain doesn't include the issuer of the certificate"
+}
+
+func checkKey(path, password string, cert *x509.Certificate) string {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "private key is not installed"
+	}
+	if err != nil {
+		return fmt.Sprintf("private key can't be read: %s", err)
+	}
+	key, err := parsePrivateKey(data, password)
+	if err != nil {
+		return fmt.Sprintf("private key can't be parsed: %s", err)
+	}
+	keyDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return fmt.Sprintf("private key can't be parsed: %s", err)
+	}
+	certDER, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil || !bytes.Equal(keyDER, certDER) {
+		return "private key doesn't match the certificate"
+	}
+	return ""
+}
+
+func parsePrivateKey(data []byte, password string) (crypto.Signer, error) {
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	der := b.Bytes
+	if b.Type == "ENCRYPTED PRIVATE KEY" {
+		key, err := pkcs8.ParsePKCS8PrivateKey(der, []byte(password))
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return signer, nil
+	}
+	if _, ok := b.Headers["DEK-Info"]; ok {
+		var err error
+		der, err = util.X509DecryptPEMBlock(b, []byte(password))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parseKeyBlock(&pem.Block{Type: b.Type, Bytes: der})
+}
+
+func thumbprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
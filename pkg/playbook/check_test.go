@@ -0,0 +1,112 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &pb.CertificateTasks[0]
+	task.Installations = append(task.Installations, Installation{Type: InstallationTypePEM, File: filepath.Join(dir, "copy.pem")})
+	task.Installations[0].ChainFile = filepath.Join(dir, "chain.pem")
+	r := NewRunner(pb)
+	r.Log = func(string, ...interface{}) {}
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	drifts, err := r.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("expected no drift, got %v", drifts)
+	}
+
+	cert, err := readCertificate(filepath.Join(dir, "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	err = ioutil.WriteFile(filepath.Join(dir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "copy.pem"))
+	task.Request.SANs.DNS = append(task.Request.SANs.DNS, "api.example.com")
+	r.Now = func() time.Time { return cert.NotAfter.Add(-time.Hour) }
+
+	tmpl := &x509.Certificate{SerialNumber: cert.SerialNumber, NotBefore: cert.NotBefore, NotAfter: cert.NotAfter}
+	served, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{served}, PrivateKey: key}}}
+	srv.StartTLS()
+	defer srv.Close()
+	task.Installations[0].Endpoint = srv.Listener.Addr().String()
+	err = ioutil.WriteFile(filepath.Join(dir, "chain.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: served}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drifts, err = r.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"certificate doesn't include DNS name api.example.com",
+		"is due for renewal",
+		"chain doesn't include the issuer of the certificate",
+		"private key doesn't match the certificate",
+		"serves certificate",
+		"copy.pem: certificate is not installed",
+	}
+	if len(drifts) != len(expected) {
+		t.Fatalf("expected %d drifts, got %v", len(expected), drifts)
+	}
+	for i, e := range expected {
+		if !strings.Contains(drifts[i].String(), e) {
+			t.Errorf("drift %d: expected %q, got %q", i, e, drifts[i])
+		}
+	}
+}
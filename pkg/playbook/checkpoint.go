@@ -0,0 +1,228 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/state"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// CheckpointKey is the key of the checkpoint in a state store
+const CheckpointKey = "checkpoint"
+
+// Checkpoint records the certificates requested by a run that weren't retrieved yet, because the run was
+// interrupted or the issuance is pending, so a resumed run picks them up instead of requesting them again
+type Checkpoint struct {
+	// Pending are the requests of the certificate tasks, by task name
+	Pending map[string]*PendingRequest `json:"pending"`
+	// Remaining are the tasks the interrupted run didn't start
+	Remaining []string `json:"remaining,omitempty"`
+	// Renewed is when the certificate of each task was last installed, by task name
+	Renewed map[string]time.Time `json:"renewed,omitempty"`
+
+	mu sync.Mutex
+}
+
+// PendingRequest is a certificate request waiting to be retrieved
+type PendingRequest struct {
+	PickupID string `json:"pickupId"`
+	// Connection is the name of the connection of the task, empty for the default one
+	Connection string `json:"connection,omitempty"`
+	// RequestedAt is when the request was first found pending
+	RequestedAt time.Time `json:"requestedAt"`
+	// PrivateKey is the PKCS#8 PEM of the key of a locally generated CSR, the certificate can't be installed without
+	// it
+	PrivateKey string `json:"privateKey,omitempty"`
+}
+
+// LoadCheckpoint reads the checkpoint written at path by WriteFile, a missing file is an empty checkpoint
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	cp := &Checkpoint{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read checkpoint: %s", verror.UserDataError, err)
+	}
+	err = json.Unmarshal(data, cp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse checkpoint %s: %s", verror.UserDataError, path, err)
+	}
+	return cp, nil
+}
+
+// LoadState reads the checkpoint saved in store by Save, nothing saved is an empty checkpoint
+func LoadState(ctx context.Context, store state.Store) (*Checkpoint, error) {
+	cp := &Checkpoint{}
+	data, err := store.Load(ctx, CheckpointKey)
+	if err == state.ErrNotFound {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, cp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse saved checkpoint: %s", verror.UserDataError, err)
+	}
+	return cp, nil
+}
+
+// WriteFile writes the checkpoint to path. It's only readable by its owner as it holds private keys.
+func (cp *Checkpoint) WriteFile(path string) error {
+	cp.mu.Lock()
+	data, err := json.MarshalIndent(cp, "", "  ")
+	cp.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Save saves the checkpoint in store, it should be a store only readable by the daemon as it holds private keys
+func (cp *Checkpoint) Save(ctx context.Context, store state.Store) error {
+	cp.mu.Lock()
+	data, err := json.Marshal(cp)
+	cp.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return store.Save(ctx, CheckpointKey, data)
+}
+
+// Empty tells whether nothing is left to resume
+func (cp *Checkpoint) Empty() bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return len(cp.Pending) == 0 && len(cp.Remaining) == 0
+}
+
+// restore sets the pickup ID and the private key of the pending request of task on req, it returns false when
+// there's none
+func (cp *Checkpoint) restore(task string, req *certificate.Request) (bool, error) {
+	if cp == nil {
+		return false, nil
+	}
+	cp.mu.Lock()
+	pending := cp.Pending[task]
+	cp.mu.Unlock()
+	if pending == nil {
+		return false, nil
+	}
+	req.PickupID = pending.PickupID
+	if pending.PrivateKey != "" {
+		b, _ := pem.Decode([]byte(pending.PrivateKey))
+		if b == nil {
+			return false, fmt.Errorf("%w: checkpoint private key of certificate task %q is not PEM", verror.UserDataError, task)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(b.Bytes)
+		if err != nil {
+			return false, fmt.Errorf("%w: failed to parse checkpoint private key of certificate task %q: %s", verror.UserDataError, task, err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return false, fmt.Errorf("%w: checkpoint private key of certificate task %q can't sign", verror.UserDataError, task)
+		}
+		req.PrivateKey = signer
+	}
+	return true, nil
+}
+
+// add records req as pending for task when the retrieval error err tells it wasn't issued yet. Otherwise the
+// request failed and it's forgotten.
+func (cp *Checkpoint) add(task *CertificateTask, req *certificate.Request, err error, now time.Time) error {
+	if cp == nil {
+		return nil
+	}
+	if req.PickupID == "" || !isPending(err) {
+		cp.done(task.Name)
+		return nil
+	}
+	pending := &PendingRequest{PickupID: req.PickupID, Connection: task.Connection, RequestedAt: now.UTC()}
+	if req.CsrOrigin != certificate.ServiceGeneratedCSR && req.PrivateKey != nil {
+		der, err := x509.MarshalPKCS8PrivateKey(req.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to checkpoint the private key of certificate task %q: %s", task.Name, err)
+		}
+		pending.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.Pending == nil {
+		cp.Pending = make(map[string]*PendingRequest)
+	}
+	// a resumed request is still as old as when it was first found pending
+	if previous := cp.Pending[task.Name]; previous != nil && previous.PickupID == pending.PickupID && !previous.RequestedAt.IsZero() {
+		pending.RequestedAt = previous.RequestedAt
+	}
+	cp.Pending[task.Name] = pending
+	return nil
+}
+
+// done forgets the pending request of task once its certificate is retrieved
+func (cp *Checkpoint) done(task string) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	delete(cp.Pending, task)
+}
+
+// renewed records when the certificate of task was installed
+func (cp *Checkpoint) renewed(task string, at time.Time) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.Renewed == nil {
+		cp.Renewed = make(map[string]time.Time)
+	}
+	cp.Renewed[task] = at.UTC()
+}
+
+// setRemaining records the tasks an interrupted run didn't start
+func (cp *Checkpoint) setRemaining(tasks []string) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.Remaining = tasks
+}
+
+func isPending(err error) bool {
+	var timeout endpoint.ErrRetrieveCertificateTimeout
+	var pending endpoint.ErrCertificatePending
+	return errors.As(err, &timeout) || errors.As(err, &pending)
+}
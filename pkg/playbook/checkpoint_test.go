@@ -0,0 +1,162 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/state"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+// pendingConnector doesn't issue the certificates until it's approved
+type pendingConnector struct {
+	*fake.Connector
+	approved bool
+	requests int
+}
+
+func (c *pendingConnector) RequestCertificate(req *certificate.Request) (string, error) {
+	c.requests++
+	return c.Connector.RequestCertificate(req)
+}
+
+func (c *pendingConnector) RetrieveCertificate(req *certificate.Request) (*certificate.PEMCollection, error) {
+	if !c.approved {
+		return nil, endpoint.ErrCertificatePending{CertificateID: req.PickupID, Status: "Pending approval"}
+	}
+	return c.Connector.RetrieveCertificate(req)
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &pb.CertificateTasks[0]
+	connector := &pendingConnector{Connector: fake.NewConnector(false, nil)}
+	r := NewRunner(pb)
+	r.Checkpoint = &Checkpoint{}
+
+	_, err = r.enroll(connector, task)
+	if !isPending(err) {
+		t.Fatalf("expected a pending error, got %v", err)
+	}
+	path := filepath.Join(dir, "checkpoint.json")
+	err = r.Checkpoint.WriteFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Fatalf("checkpoint should only be readable by its owner, got %s", fi.Mode())
+	}
+
+	r.Checkpoint, err = LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := r.Checkpoint.Pending[task.Name]
+	if pending == nil || pending.PickupID == "" || pending.PrivateKey == "" {
+		t.Fatalf("expected the pending request and its key, got %+v", pending)
+	}
+
+	connector.approved = true
+	pcc, err := r.enroll(connector, task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connector.requests != 1 {
+		t.Fatalf("the pending certificate should be retrieved, not requested again: %d requests", connector.requests)
+	}
+	if pcc.PrivateKey == "" {
+		t.Fatal("the checkpointed private key should be added to the certificate")
+	}
+	if !r.Checkpoint.Empty() {
+		t.Fatalf("checkpoint should be empty once the certificate is retrieved: %+v", r.Checkpoint.Pending)
+	}
+}
+
+func TestCheckpointInterrupted(t *testing.T) {
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, "/tmp")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(pb)
+	r.Checkpoint = &Checkpoint{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = r.RunOnce(ctx)
+	if err != context.Canceled {
+		t.Fatalf("expected the run to be cancelled, got %v", err)
+	}
+	if len(r.Checkpoint.Remaining) != 1 || r.Checkpoint.Remaining[0] != "web" {
+		t.Fatalf("expected the remaining task, got %v", r.Checkpoint.Remaining)
+	}
+
+	cp, err := LoadCheckpoint("/nonexistent/checkpoint.json")
+	if err != nil || !cp.Empty() {
+		t.Fatalf("missing checkpoint should be empty, got %+v, %v", cp, err)
+	}
+}
+
+func TestCheckpointState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &state.File{Dir: filepath.Join(dir, "state")}
+	ctx := context.Background()
+	cp, err := LoadState(ctx, store)
+	if err != nil || !cp.Empty() {
+		t.Fatalf("nothing saved should be an empty checkpoint, got %+v, %v", cp, err)
+	}
+
+	r := NewRunner(pb)
+	r.Checkpoint = cp
+	err = r.RunOnce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Checkpoint.Save(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err = LoadState(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Renewed["web"].IsZero() {
+		t.Fatalf("expected the renewal time of the task, got %v", cp.Renewed)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/lock"
+)
+
+// the kinds of leftovers
+const (
+	LeftoverPendingRequest = "pending request"
+	LeftoverRemainingTask  = "remaining task"
+	LeftoverLockFile       = "lock file"
+)
+
+// Leftover is something past runs left behind that no run will pick up: a pending request of the checkpoint that
+// was never retrieved, a task an interrupted run didn't start that's no longer in the playbook, or a lock file no
+// process holds
+type Leftover struct {
+	Kind     string `json:"kind"`
+	Task     string `json:"task,omitempty"`
+	PickupID string `json:"pickupId,omitempty"`
+	File     string `json:"file,omitempty"`
+	Reason   string `json:"reason"`
+	// Cancelled is set once the pending request is cancelled on the platform
+	Cancelled bool `json:"cancelled,omitempty"`
+	// Error tells why the leftover couldn't be cleaned up
+	Error string `json:"error,omitempty"`
+}
+
+func (l Leftover) String() string {
+	s := l.Kind
+	switch {
+	case l.PickupID != "":
+		s += fmt.Sprintf(" %s of task %s", l.PickupID, l.Task)
+	case l.Task != "":
+		s += " " + l.Task
+	case l.File != "":
+		s += " " + l.File
+	}
+	return s + ": " + l.Reason
+}
+
+type CleanupOptions struct {
+	// MaxAge is how long a request can stay pending, or a lock file unused, before it's a leftover
+	MaxAge time.Duration
+	// Cancel cancels the leftover requests on the platform besides forgetting them
+	Cancel bool
+	// DryRun only finds the leftovers
+	DryRun bool
+}
+
+// Cleanup finds the leftovers of the checkpoint of the runner and of the lock directory of the playbook, and removes
+// them unless opts.DryRun is set. The pending requests of tasks that aren't in the playbook anymore are leftovers
+// whatever their age. The leftovers that couldn't be cleaned up are returned with an error.
+func (r *Runner) Cleanup(ctx context.Context, opts CleanupOptions) ([]Leftover, error) {
+	var leftovers []Leftover
+	now := r.now()
+	tasks := make(map[string]*CertificateTask)
+	for i := range r.Playbook.CertificateTasks {
+		tasks[r.Playbook.CertificateTasks[i].Name] = &r.Playbook.CertificateTasks[i]
+	}
+
+	if cp := r.Checkpoint; cp != nil {
+		cp.mu.Lock()
+		names := make([]string, 0, len(cp.Pending))
+		for name := range cp.Pending {
+			names = append(names, name)
+		}
+		var remaining []string
+		for _, name := range cp.Remaining {
+			if tasks[name] != nil {
+				remaining = append(remaining, name)
+			} else {
+				leftovers = append(leftovers, Leftover{Kind: LeftoverRemainingTask, Task: name, Reason: "task is no longer in the playbook"})
+			}
+		}
+		if !opts.DryRun {
+			cp.Remaining = remaining
+		}
+		cp.mu.Unlock()
+		sort.Strings(names)
+
+		connections := make(map[string]*runConnection)
+		for _, name := range names {
+			if err := ctx.Err(); err != nil {
+				return leftovers, err
+			}
+			cp.mu.Lock()
+			pending := cp.Pending[name]
+			cp.mu.Unlock()
+			l := Leftover{Kind: LeftoverPendingRequest, Task: name, PickupID: pending.PickupID}
+			switch {
+			case tasks[name] == nil:
+				l.Reason = "task is no longer in the playbook"
+			case !pending.RequestedAt.IsZero() && now.Sub(pending.RequestedAt) > opts.MaxAge:
+				l.Reason = fmt.Sprintf("pending since %s", pending.RequestedAt.Format(time.RFC3339))
+			default:
+				continue
+			}
+			if !opts.DryRun {
+				if opts.Cancel {
+					err := r.cancelRequest(connections, pending)
+					if err != nil {
+						l.Error = err.Error()
+						leftovers = append(leftovers, l)
+						continue
+					}
+					l.Cancelled = true
+				}
+				cp.done(name)
+			}
+			leftovers = append(leftovers, l)
+		}
+	}
+
+	if cfg := r.Playbook.Config.Lock; cfg != nil {
+		locker := lock.NewFileLocker(cfg.Dir)
+		before := now.Add(-opts.MaxAge)
+		files, err := locker.Stale(before)
+		if err != nil {
+			return leftovers, err
+		}
+		for _, file := range files {
+			l := Leftover{Kind: LeftoverLockFile, File: file, Reason: fmt.Sprintf("not locked since %s", before.UTC().Format(time.RFC3339))}
+			if !opts.DryRun {
+				if err := locker.Remove(file); err != nil {
+					l.Error = err.Error()
+				}
+			}
+			leftovers = append(leftovers, l)
+		}
+	}
+	return leftovers, nil
+}
+
+// cancelRequest cancels the pending request on the platform of its connection
+func (r *Runner) cancelRequest(connections map[string]*runConnection, pending *PendingRequest) error {
+	c := r.taskConnection(connections, pending.Connection)
+	if c.err != nil {
+		return c.err
+	}
+	return c.connector.CancelRequest(pending.PickupID)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb.Config.Lock = &Lock{Dir: filepath.Join(dir, "locks")}
+	if err = os.Mkdir(pb.Config.Lock.Dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	for name, mtime := range map[string]time.Time{"old.lock": now.AddDate(0, 0, -30), "recent.lock": now.Add(-time.Hour)} {
+		path := filepath.Join(pb.Config.Lock.Dir, name)
+		if err = ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newRunner := func() *Runner {
+		r := NewRunner(pb)
+		r.Now = func() time.Time { return now }
+		r.Checkpoint = &Checkpoint{
+			Pending: map[string]*PendingRequest{
+				"web":     {PickupID: "\\VED\\Policy\\web", RequestedAt: now.AddDate(0, 0, -10)},
+				"removed": {PickupID: "\\VED\\Policy\\removed", RequestedAt: now},
+			},
+			Remaining: []string{"web", "gone"},
+		}
+		return r
+	}
+	opts := CleanupOptions{MaxAge: 7 * 24 * time.Hour, DryRun: true}
+
+	r := newRunner()
+	leftovers, err := r.Cleanup(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) != 4 {
+		t.Fatalf("expected 4 leftovers, got %v", leftovers)
+	}
+	if len(r.Checkpoint.Pending) != 2 || len(r.Checkpoint.Remaining) != 2 {
+		t.Fatalf("a dry run shouldn't change the checkpoint: %+v", r.Checkpoint)
+	}
+	if _, err = os.Stat(filepath.Join(pb.Config.Lock.Dir, "old.lock")); err != nil {
+		t.Fatalf("a dry run shouldn't remove the lock files: %s", err)
+	}
+
+	// the recent pending request of a task still in the playbook isn't a leftover
+	opts = CleanupOptions{MaxAge: 20 * 24 * time.Hour}
+	r = newRunner()
+	leftovers, err = r.Cleanup(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) != 3 {
+		t.Fatalf("expected 3 leftovers, got %v", leftovers)
+	}
+	if len(r.Checkpoint.Pending) != 1 || r.Checkpoint.Pending["web"] == nil {
+		t.Fatalf("expected only the pending request of web to be kept, got %+v", r.Checkpoint.Pending)
+	}
+	if len(r.Checkpoint.Remaining) != 1 || r.Checkpoint.Remaining[0] != "web" {
+		t.Fatalf("expected only web to remain, got %v", r.Checkpoint.Remaining)
+	}
+	if _, err = os.Stat(filepath.Join(pb.Config.Lock.Dir, "old.lock")); !os.IsNotExist(err) {
+		t.Fatalf("the stale lock file should be removed: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(pb.Config.Lock.Dir, "recent.lock")); err != nil {
+		t.Fatalf("the recent lock file should be kept: %s", err)
+	}
+
+	opts = CleanupOptions{MaxAge: 7 * 24 * time.Hour, Cancel: true}
+	r = newRunner()
+	leftovers, err = r.Cleanup(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled := 0
+	for _, l := range leftovers {
+		if l.Kind == LeftoverPendingRequest {
+			if l.Error != "" || !l.Cancelled {
+				t.Fatalf("expected the request to be cancelled, got %+v", l)
+			}
+			cancelled++
+		}
+	}
+	if cancelled != 2 || len(r.Checkpoint.Pending) != 0 {
+		t.Fatalf("expected both requests to be cancelled, got %v", leftovers)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/lock"
+	"github.com/Venafi/vcert/v4/pkg/state"
+	"github.com/Venafi/vcert/v4/pkg/tracing"
+)
+
+const DefaultInterval = time.Hour
+
+// Daemon runs a playbook periodically. It reports readiness to systemd once the first run is done and reloads the
+// playbook file when it receives SIGHUP.
+type Daemon struct {
+	Path string
+	// Interval between two runs, it defaults to DefaultInterval
+	Interval time.Duration
+	// Log receives progress messages when it's set
+	Log func(format string, args ...interface{})
+	// Reload triggers a reload of the playbook. It's fed with SIGHUP by Run when it's nil.
+	Reload <-chan os.Signal
+	// Tracer traces the scheduled runs when it's set
+	Tracer tracing.Tracer
+	// Locker replaces the file locks of the playbook, see Runner.Locker
+	Locker lock.Locker
+	// State keeps the checkpoint of the runs when it's set, so the pending requests and the renewal times survive
+	// restarts
+	State state.Store
+
+	runner *Runner
+}
+
+// Run loads the playbook and runs it until ctx is cancelled. Failed runs are logged and retried at the next
+// interval, only an invalid playbook at start up is returned as an error.
+func (d *Daemon) Run(ctx context.Context) error {
+	pb, err := Load(d.Path)
+	if err != nil {
+		return err
+	}
+	d.runner = &Runner{Playbook: pb, Log: d.Log, Tracer: d.Tracer, Locker: d.Locker}
+	if d.State != nil {
+		d.runner.Checkpoint, err = LoadState(ctx, d.State)
+		if err != nil {
+			return err
+		}
+	}
+
+	reload := d.Reload
+	if reload == nil {
+		var stop func()
+		reload, stop = reloadSignal()
+		defer stop()
+	}
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	d.run(ctx, "start")
+	d.notify(NotifyReady)
+	defer d.notify(NotifyStopping)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-reload:
+			d.notify(NotifyReloading)
+			d.reload()
+			d.run(ctx, "reload")
+			d.notify(NotifyReady)
+		case <-ticker.C:
+			d.run(ctx, "interval")
+		}
+	}
+}
+
+func reloadSignal() (<-chan os.Signal, func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	return c, func() { signal.Stop(c) }
+}
+
+// run runs the playbook, trigger tells what started the run: "start", "reload" or "interval"
+func (d *Daemon) run(ctx context.Context, trigger string) {
+	ctx, span := tracing.OrNoop(d.Tracer).Start(ctx, tracing.SpanScheduledRun)
+	span.SetAttributes(tracing.String(tracing.AttrTrigger, trigger))
+	err := d.runner.RunOnce(ctx)
+	tracing.End(span, err)
+	if err != nil && ctx.Err() == nil {
+		d.logf("playbook run failed: %s", err)
+	}
+	if d.State != nil {
+		// the run may have been interrupted by ctx, the checkpoint is saved anyway
+		err = d.runner.Checkpoint.Save(context.Background(), d.State)
+		if err != nil {
+			d.logf("failed to save the state of the run: %s", err)
+		}
+	}
+}
+
+// reload keeps the running playbook when the new one is invalid so a bad edit doesn't stop renewals
+func (d *Daemon) reload() {
+	pb, err := Load(d.Path)
+	if err != nil {
+		d.logf("failed to reload playbook, keeping the current one: %s", err)
+		return
+	}
+	d.runner.Playbook = pb
+	d.logf("playbook %s reloaded", d.Path)
+}
+
+func (d *Daemon) notify(state string) {
+	_, err := Notify(state)
+	if err != nil {
+		d.logf("failed to notify service manager: %s", err)
+	}
+}
+
+func (d *Daemon) logf(format string, args ...interface{}) {
+	if d.Log != nil {
+		d.Log(format, args...)
+	}
+}
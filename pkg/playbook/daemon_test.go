@@ -0,0 +1,92 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDaemonNotifiesAndReloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets aren't available: %s", err)
+	}
+	defer conn.Close()
+	os.Setenv(notifySocketEnv, socketPath)
+	defer os.Unsetenv(notifySocketEnv)
+
+	path := filepath.Join(dir, "playbook.yaml")
+	err = ioutil.WriteFile(path, []byte(fmt.Sprintf(testPlaybook, dir)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reload := make(chan os.Signal, 1)
+	d := &Daemon{Path: path, Interval: time.Hour, Reload: reload}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+
+	expect := func(state string) {
+		t.Helper()
+		buf := make([]byte, 256)
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != state {
+			t.Fatalf("expected %q, got %q", state, buf[:n])
+		}
+	}
+	expect(NotifyReady)
+	if _, err = os.Stat(filepath.Join(dir, "cert.pem")); err != nil {
+		t.Fatal(err)
+	}
+
+	// an invalid playbook is ignored and the daemon keeps running
+	err = ioutil.WriteFile(path, []byte("certificateTasks: ["), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reload <- syscall.SIGHUP
+	expect(NotifyReloading)
+	expect(NotifyReady)
+	if d.runner.Playbook == nil || len(d.runner.Playbook.CertificateTasks) != 1 {
+		t.Fatal("previous playbook should be kept")
+	}
+
+	cancel()
+	expect(NotifyStopping)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
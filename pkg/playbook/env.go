@@ -0,0 +1,87 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/util"
+)
+
+// expandEnv replaces the ${NAME} and ${NAME:-default} references to environment variables in the string values of
+// the playbook, so the same playbook can be promoted across environments unchanged
+func expandEnv(pb *Playbook) error {
+	return expandValue(reflect.ValueOf(pb).Elem(), "")
+}
+
+func expandValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.String:
+		expanded, err := util.ExpandEnv(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		v.SetString(expanded)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return expandValue(v.Elem(), path)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			err := expandValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// the values of a map aren't addressable, they're expanded in a copy
+		for _, k := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(k))
+			err := expandValue(value, fmt.Sprintf("%s.%v", path, k))
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(k, value)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			err := expandValue(v.Field(i), name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+
+	"github.com/Venafi/vcert/v4/pkg/util"
+)
+
+// playbookFile is a file of a playbook, the playbook itself or one of the files it includes
+type playbookFile struct {
+	path string
+	data []byte
+}
+
+// loader merges the YAML documents of a playbook file and of the files it includes into one playbook. The config is
+// defined once, by any of the documents, and the certificate tasks of all the documents are added in order.
+type loader struct {
+	playbook   *Playbook
+	files      []playbookFile
+	configFile int
+	// tasks is the index in files of the file defining each certificate task
+	tasks map[string]int
+	// loading are the files being loaded, to detect an include cycle
+	loading map[string]bool
+}
+
+func newLoader() *loader {
+	return &loader{
+		playbook:   &Playbook{},
+		configFile: -1,
+		tasks:      make(map[string]int),
+		loading:    make(map[string]bool),
+	}
+}
+
+func (l *loader) load(path string, data []byte) error {
+	key := path
+	if abs, err := filepath.Abs(path); err == nil && path != "" {
+		key = abs
+	}
+	if l.loading[key] {
+		return fmt.Errorf("include cycle through %s", path)
+	}
+	l.loading[key] = true
+	defer delete(l.loading, key)
+
+	file := len(l.files)
+	l.files = append(l.files, playbookFile{path: path, data: data})
+	docs, err := unmarshalDocuments(data)
+	if err != nil {
+		return l.fileError(file, err)
+	}
+	for _, doc := range docs {
+		if !reflect.ValueOf(doc.Config).IsZero() {
+			if l.configFile >= 0 {
+				return fmt.Errorf("config is defined more than once, in %s and in %s", l.name(l.configFile), l.name(file))
+			}
+			l.configFile = file
+			l.playbook.Config = doc.Config
+		}
+		for _, task := range doc.CertificateTasks {
+			if _, ok := l.tasks[task.Name]; !ok {
+				l.tasks[task.Name] = file
+			}
+			l.playbook.CertificateTasks = append(l.playbook.CertificateTasks, task)
+		}
+		for _, task := range doc.SSHHostTasks {
+			if _, ok := l.tasks[task.Name]; !ok {
+				l.tasks[task.Name] = file
+			}
+			l.playbook.SSHHostTasks = append(l.playbook.SSHHostTasks, task)
+		}
+		for _, pattern := range doc.Include {
+			err = l.include(filepath.Dir(path), pattern)
+			if err != nil {
+				return l.fileError(file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// include loads the files matching pattern, relative to dir
+func (l *loader) include(dir, pattern string) error {
+	expanded, err := util.ExpandEnv(pattern)
+	if err != nil {
+		return fmt.Errorf("include %q: %s", pattern, err)
+	}
+	if !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(dir, expanded)
+	}
+	matches, err := filepath.Glob(expanded)
+	if err != nil {
+		return fmt.Errorf("include %q: %s", pattern, err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("include %q matches no file", pattern)
+	}
+	for _, m := range matches {
+		data, err := ioutil.ReadFile(m)
+		if err != nil {
+			return fmt.Errorf("include %q: %s", pattern, err)
+		}
+		data, err = decryptPlaybook(m, data)
+		if err != nil {
+			return fmt.Errorf("include %q: %s", pattern, err)
+		}
+		err = l.load(m, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileError tells the file of an error in a file included by the playbook
+func (l *loader) fileError(file int, err error) error {
+	if file == 0 {
+		return err
+	}
+	var fe *fileError
+	if errors.As(err, &fe) {
+		return err
+	}
+	return &fileError{path: l.files[file].path, err: err}
+}
+
+func (l *loader) name(file int) string {
+	if l.files[file].path == "" {
+		return "the playbook"
+	}
+	return l.files[file].path
+}
+
+// locate returns the file and line of the certificate task called name, e.g. "line 10" when it's defined by the
+// playbook itself or "certs/api.yaml line 4" when it's defined by an included file
+func (l *loader) locate(name string) string {
+	file, ok := l.tasks[name]
+	if !ok {
+		return ""
+	}
+	line := taskLine(l.files[file].data, name)
+	if line == 0 {
+		return ""
+	}
+	if file == 0 {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s line %d", l.files[file].path, line)
+}
+
+// fileError is an error in a file included by a playbook
+type fileError struct {
+	path string
+	err  error
+}
+
+func (e *fileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.path, e.err)
+}
+
+func (e *fileError) Unwrap() error {
+	return e.err
+}
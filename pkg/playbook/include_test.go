@@ -0,0 +1,159 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"playbook.yaml": `config:
+  connection:
+    type: fake
+include:
+  - certs/*.yaml
+---
+certificateTasks:
+  - name: web
+    request:
+      subject:
+        commonName: www.example.com
+    installations: [{type: pem, file: web.pem}]
+`,
+		"certs/api.yaml": `certificateTasks:
+  - name: api
+    request:
+      subject:
+        commonName: api.example.com
+    installations: [{type: pem, file: api.pem}]
+include: [../shared/db.yaml]
+`,
+		"certs/mail.yaml": `---
+certificateTasks:
+  - name: mail
+    request:
+      subject:
+        commonName: mail.example.com
+    installations: [{type: pem, file: mail.pem}]
+`,
+		"shared/db.yaml": `certificateTasks:
+  - name: db
+    request:
+      subject:
+        commonName: db.example.com
+    installations: [{type: pem, file: db.pem}]
+`,
+	})
+
+	pb, err := Load(filepath.Join(dir, "playbook.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pb.Config.Connection.Type != ConnectionTypeFake {
+		t.Errorf("unexpected connection type %q", pb.Config.Connection.Type)
+	}
+	var names []string
+	for _, task := range pb.CertificateTasks {
+		names = append(names, task.Name)
+	}
+	if strings.Join(names, ",") != "api,db,mail,web" {
+		t.Errorf("unexpected certificate tasks %v", names)
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	cases := []struct {
+		files map[string]string
+		want  string
+	}{
+		{
+			map[string]string{"playbook.yaml": "config:\n  connection:\n    type: fake\ninclude: [certs/*.yaml]\n"},
+			`include "certs/*.yaml" matches no file`,
+		},
+		{
+			map[string]string{
+				"playbook.yaml":  "config:\n  connection:\n    type: fake\ninclude: [certs/web.yaml]\n",
+				"certs/web.yaml": "config:\n  connection:\n    type: tpp\n",
+			},
+			"config is defined more than once, in ",
+		},
+		{
+			map[string]string{
+				"playbook.yaml":  "config:\n  connection:\n    type: fake\ninclude: [certs/web.yaml]\n",
+				"certs/web.yaml": "certificateTasks:\n  - name: web\n    request:\n      subject:\n        comonName: www\n",
+			},
+			`certs/web.yaml: line 5: unknown key "comonName", did you mean "commonName"?`,
+		},
+		{
+			map[string]string{
+				"playbook.yaml":  "config:\n  connection:\n    type: fake\ninclude: [certs/web.yaml]\n",
+				"certs/web.yaml": "\n---\ncertificateTasks:\n  - name: web\n    request:\n      subject:\n        commonName: www\n",
+			},
+			filepath.Join("certs", "web.yaml") + ` line 4) has no installations`,
+		},
+		{
+			map[string]string{
+				"playbook.yaml":  "config:\n  connection:\n    type: fake\ninclude: [certs/web.yaml]\n",
+				"certs/web.yaml": "include: [../playbook.yaml]\n",
+			},
+			"include cycle through",
+		},
+	}
+	for _, c := range cases {
+		dir, err := ioutil.TempDir("", "playbook")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		writeFiles(t, dir, c.files)
+
+		_, err = Load(filepath.Join(dir, "playbook.yaml"))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("expected an error containing %q, got %v", c.want, err)
+		}
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("expected a user data error, got %v", err)
+		}
+	}
+}
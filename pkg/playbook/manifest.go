@@ -0,0 +1,332 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	manifestVersion = 1
+
+	SignatureAlgorithmECDSA   = "ecdsa-sha256"
+	SignatureAlgorithmRSA     = "rsa-pkcs1-sha256"
+	SignatureAlgorithmEd25519 = "ed25519"
+)
+
+// Manifest lists the certificates managed by a playbook as they are installed on the host. It's meant to be
+// attached to deployment artifacts, for audit and to detect the certificates changed outside of the playbook.
+type Manifest struct {
+	Version      int                   `json:"version"`
+	GeneratedAt  time.Time             `json:"generatedAt"`
+	Source       ManifestSource        `json:"source"`
+	Certificates []ManifestCertificate `json:"certificates"`
+	// Signature covers the JSON encoding of the manifest without the signature
+	Signature *ManifestSignature `json:"signature,omitempty"`
+}
+
+// ManifestSource is where the certificates are issued from
+type ManifestSource struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+// ManifestCertificate is a certificate task of the playbook
+type ManifestCertificate struct {
+	Task          string                 `json:"task"`
+	Zone          string                 `json:"zone"`
+	CommonName    string                 `json:"commonName,omitempty"`
+	DNSNames      []string               `json:"dnsNames,omitempty"`
+	Renewal       ManifestRenewal        `json:"renewal"`
+	Installations []ManifestInstallation `json:"installations"`
+}
+
+// ManifestRenewal is the renewal policy of a task
+type ManifestRenewal struct {
+	RenewBefore string `json:"renewBefore,omitempty"`
+	// RenewAt is the share of the lifetime after which the certificate is renewed, e.g. "66%"
+	RenewAt string `json:"renewAt,omitempty"`
+	// RenewalJitter is the most the renewals are brought forward on a host
+	RenewalJitter string `json:"renewalJitter,omitempty"`
+	// RenewalInfoURL is set when the renewal windows suggested by an ACME renewalInfo resource are preferred
+	RenewalInfoURL string `json:"renewalInfoURL,omitempty"`
+}
+
+// ManifestInstallation is a location of a certificate and what is found there. Each location is read, so
+// installations of the same task that got out of sync show different thumbprints.
+type ManifestInstallation struct {
+	Type      string `json:"type"`
+	File      string `json:"file"`
+	ChainFile string `json:"chainFile,omitempty"`
+	KeyFile   string `json:"keyFile,omitempty"`
+	// Error tells why the certificate couldn't be read, the fields below are empty then
+	Error        string     `json:"error,omitempty"`
+	Thumbprint   string     `json:"thumbprint,omitempty"`
+	SHA256       string     `json:"sha256,omitempty"`
+	SerialNumber string     `json:"serialNumber,omitempty"`
+	Issuer       string     `json:"issuer,omitempty"`
+	NotBefore    *time.Time `json:"notBefore,omitempty"`
+	NotAfter     *time.Time `json:"notAfter,omitempty"`
+}
+
+// ManifestSignature is a detached signature of a manifest. KeyID is the hex SHA-256 of the DER encoded public key.
+type ManifestSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId"`
+	Value     string `json:"value"`
+}
+
+// BuildManifest describes the certificates of pb as currently installed. Certificates that are missing or can't be
+// parsed are listed with the error, they don't fail the manifest.
+func BuildManifest(pb *Playbook, now time.Time) (*Manifest, error) {
+	m := &Manifest{
+		Version:     manifestVersion,
+		GeneratedAt: now.UTC().Truncate(time.Second),
+		Source: ManifestSource{
+			Type: strings.ToLower(pb.Config.Connection.Type),
+			URL:  pb.Config.Connection.URL,
+		},
+		Certificates: []ManifestCertificate{},
+	}
+	for i := range pb.CertificateTasks {
+		task := &pb.CertificateTasks[i]
+		threshold, err := task.renewalThreshold()
+		if err != nil {
+			return nil, err
+		}
+		var renewalInfoURL string
+		if c := pb.connection(task.Connection); c != nil {
+			renewalInfoURL = c.RenewalInfoURL
+		}
+		mc := ManifestCertificate{
+			Task:       task.Name,
+			Zone:       task.Request.Zone,
+			CommonName: task.Request.Subject.CommonName,
+			DNSNames:   task.Request.SANs.DNS,
+			Renewal: ManifestRenewal{
+				RenewalInfoURL: renewalInfoURL,
+				RenewalJitter:  pb.Config.RenewalJitter,
+			},
+		}
+		if threshold.before > 0 || threshold.lifetime == 0 {
+			mc.Renewal.RenewBefore = threshold.before.String()
+		}
+		if threshold.lifetime > 0 {
+			mc.Renewal.RenewAt = strconv.FormatFloat(threshold.lifetime*100, 'f', -1, 64) + "%"
+		}
+		for _, inst := range task.Installations {
+			if !inst.writesFiles() {
+				continue
+			}
+			inst, err := task.installed(inst)
+			if err != nil {
+				return nil, err
+			}
+			mi := ManifestInstallation{Type: inst.Type, File: inst.File, ChainFile: inst.ChainFile, KeyFile: inst.KeyFile}
+			cert, err := readCertificate(inst.File)
+			if err != nil {
+				mi.Error = err.Error()
+			} else {
+				sha256Sum := sha256.Sum256(cert.Raw)
+				notBefore, notAfter := cert.NotBefore.UTC(), cert.NotAfter.UTC()
+				mi.Thumbprint = thumbprint(cert)
+				mi.SHA256 = strings.ToUpper(hex.EncodeToString(sha256Sum[:]))
+				mi.SerialNumber = strings.ToUpper(cert.SerialNumber.Text(16))
+				mi.Issuer = cert.Issuer.String()
+				mi.NotBefore = &notBefore
+				mi.NotAfter = &notAfter
+			}
+			mc.Installations = append(mc.Installations, mi)
+		}
+		m.Certificates = append(m.Certificates, mc)
+	}
+	return m, nil
+}
+
+// Sign signs the manifest with an ECDSA, RSA or Ed25519 key, replacing any previous signature
+func (m *Manifest) Sign(key crypto.Signer) error {
+	alg, err := signatureAlgorithm(key.Public())
+	if err != nil {
+		return err
+	}
+	keyID, err := publicKeyID(key.Public())
+	if err != nil {
+		return err
+	}
+	data, err := m.signedContent()
+	if err != nil {
+		return err
+	}
+	var sig []byte
+	if alg == SignatureAlgorithmEd25519 {
+		sig, err = key.Sign(rand.Reader, data, crypto.Hash(0))
+	} else {
+		sum := sha256.Sum256(data)
+		sig, err = key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sign manifest: %s", err)
+	}
+	m.Signature = &ManifestSignature{Algorithm: alg, KeyID: keyID, Value: base64.StdEncoding.EncodeToString(sig)}
+	return nil
+}
+
+// Verify checks the signature of the manifest with pub
+func (m *Manifest) Verify(pub crypto.PublicKey) error {
+	if m.Signature == nil {
+		return fmt.Errorf("%w: manifest isn't signed", verror.UserDataError)
+	}
+	alg, err := signatureAlgorithm(pub)
+	if err != nil {
+		return err
+	}
+	if alg != m.Signature.Algorithm {
+		return fmt.Errorf("%w: manifest is signed with %s, the key is for %s", verror.UserDataError, m.Signature.Algorithm, alg)
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature.Value)
+	if err != nil {
+		return fmt.Errorf("%w: invalid manifest signature: %s", verror.UserDataError, err)
+	}
+	data, err := m.signedContent()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	var ok bool
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(sig, &rs); err == nil {
+			ok = ecdsa.Verify(k, sum[:], rs.R, rs.S)
+		}
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, data, sig)
+	}
+	if !ok {
+		return fmt.Errorf("%w: manifest signature doesn't match", verror.UserDataError)
+	}
+	return nil
+}
+
+// WriteFile writes the manifest as indented JSON
+func (m *Manifest) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ParseManifest parses a manifest written by WriteFile
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	err := json.Unmarshal(data, m)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse manifest: %s", verror.UserDataError, err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("%w: unsupported manifest version %d", verror.UserDataError, m.Version)
+	}
+	return m, nil
+}
+
+// ParseSigningKey parses a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key to sign manifests with
+func ParseSigningKey(data []byte) (crypto.Signer, error) {
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("%w: no PEM data found in signing key", verror.UserDataError)
+	}
+	if x509.IsEncryptedPEMBlock(b) || b.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, fmt.Errorf("%w: encrypted signing keys aren't supported", verror.UserDataError)
+	}
+	signer, err := parseKeyBlock(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse signing key: %s", verror.UserDataError, err)
+	}
+	return signer, nil
+}
+
+// parseKeyBlock parses an unencrypted PKCS#8, PKCS#1 or SEC 1 private key
+func parseKeyBlock(b *pem.Block) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+	switch b.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(b.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(b.Bytes)
+	default:
+		return certificate.ParsePKCS8PrivateKey(b.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+func (m *Manifest) signedContent() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = nil
+	return json.Marshal(&unsigned)
+}
+
+func signatureAlgorithm(pub crypto.PublicKey) (string, error) {
+	switch pub.(type) {
+	case *ecdsa.PublicKey:
+		return SignatureAlgorithmECDSA, nil
+	case *rsa.PublicKey:
+		return SignatureAlgorithmRSA, nil
+	case ed25519.PublicKey:
+		return SignatureAlgorithmEd25519, nil
+	}
+	return "", fmt.Errorf("%w: unsupported key type %T for manifest signatures", verror.UserDataError, pub)
+}
+
+func publicKeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb.CertificateTasks[0].Installations = append(pb.CertificateTasks[0].Installations,
+		Installation{Type: InstallationTypePEM, File: filepath.Join(dir, "missing.pem")})
+	r := NewRunner(pb)
+	r.Log = func(string, ...interface{}) {}
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "missing.pem"))
+
+	m, err := BuildManifest(pb, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Source.Type != ConnectionTypeFake || len(m.Certificates) != 1 {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+	mc := m.Certificates[0]
+	if mc.Task != "web" || mc.Zone != "Default" || mc.Renewal.RenewBefore != "240h0m0s" || len(mc.Installations) != 2 {
+		t.Fatalf("unexpected certificate %+v", mc)
+	}
+	cert, err := readCertificate(filepath.Join(dir, "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst := mc.Installations[0]; len(inst.Thumbprint) != 40 || len(inst.SHA256) != 64 || !inst.NotAfter.Equal(cert.NotAfter) {
+		t.Fatalf("unexpected installation %+v", inst)
+	}
+	if inst := mc.Installations[1]; inst.Error == "" || inst.Thumbprint != "" {
+		t.Fatalf("missing certificate should be reported: %+v", inst)
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	path := filepath.Join(dir, "manifest.json")
+	for _, key := range []crypto.Signer{ecKey, rsaKey, edKey} {
+		err = m.Sign(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.WriteFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseManifest(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = parsed.Verify(key.Public())
+		if err != nil {
+			t.Fatalf("%s: %s", m.Signature.Algorithm, err)
+		}
+		parsed.Certificates[0].Installations[0].Thumbprint = "0000"
+		err = parsed.Verify(key.Public())
+		if !errors.Is(err, verror.UserDataError) {
+			t.Fatalf("%s: tampered manifest should fail verification, got %v", m.Signature.Algorithm, err)
+		}
+	}
+	err = m.Verify(ecKey.Public())
+	if err == nil {
+		t.Fatal("signature with another key should fail verification")
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"net"
+	"os"
+)
+
+const (
+	notifySocketEnv = "NOTIFY_SOCKET"
+
+	NotifyReady     = "READY=1"
+	NotifyReloading = "RELOADING=1"
+	NotifyStopping  = "STOPPING=1"
+)
+
+// Notify sends state to the service manager with the sd_notify protocol. It's a no-op returning false when the
+// process isn't run by systemd with Type=notify.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv(notifySocketEnv)
+	if socket == "" {
+		return false, nil
+	}
+	// a leading @ designates a socket in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
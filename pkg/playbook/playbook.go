@@ -0,0 +1,833 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package playbook describes the certificates a host needs in a YAML file and keeps them issued and installed,
+// either once or continuously as a daemon.
+//
+//	config:
+//	  connection:
+//	    type: tpp
+//	    url: https://tpp.example.com
+//	    credentials:
+//	      accessToken: credential:tpp-token
+//	certificateTasks:
+//	  - name: web
+//	    renewBefore: 30d
+//	    request:
+//	      zone: Certificates\Web
+//	      subject:
+//	        commonName: www.example.com
+//	      sans:
+//	        dns: [www.example.com, example.com]
+//	    installations:
+//	      - type: pem
+//	        file: /etc/ssl/web/cert.pem
+//	        keyFile: /etc/ssl/web/key.pem
+//	        afterInstallAction: systemctl reload nginx
+//
+// In a container the daemon runs as a sidecar writing to a volume shared with the main container (e.g. an emptyDir
+// backed by memory), and tells the main process to pick up the new files with a signal or an HTTP call:
+//
+//	installations:
+//	  - type: pem
+//	    file: /certs/tls.crt
+//	    keyFile: /certs/tls.key
+//	    signal:
+//	      process: nginx
+//	      name: HUP
+//
+// A certificate task uses the connection of the config, or another connection named in the connections of the
+// config, so one run renews certificates from several platforms:
+//
+//	config:
+//	  connection:
+//	    type: tpp
+//	    url: https://tpp.example.com
+//	  connections:
+//	    public:
+//	      type: vaas
+//	      credentials:
+//	        apiKey: credential:vaas-key
+//	certificateTasks:
+//	  - name: shop
+//	    connection: public
+//	    ...
+//
+// A large playbook can be split into several YAML documents, in one file or in files included with paths or glob
+// patterns relative to the including file. The config is defined by only one of the documents, and the certificate
+// tasks of all the documents are run:
+//
+//	config:
+//	  connection:
+//	    type: tpp
+//	include:
+//	  - apps/*.yaml
+//	---
+//	certificateTasks:
+//	  - name: web
+//	    ...
+//
+// The string values may reference environment variables as ${NAME}, or ${NAME:-default} to use default when NAME is
+// unset or empty, so the same playbook is promoted from one environment to the next unchanged. A reference to an
+// unset variable without a default fails the parsing, and $${ is a literal ${. Inside a flow sequence or mapping
+// the values referencing variables must be quoted:
+//
+//	config:
+//	  connection:
+//	    type: tpp
+//	    url: ${TPP_URL}
+//	certificateTasks:
+//	  - name: web
+//	    request:
+//	      zone: ${ZONE:-Certificates\Web}
+//	      sans:
+//	        dns: ["www.${DOMAIN}"]
+//
+// A certificate is renewed renewBefore its expiration, 30 days by default. With renewAt it's renewed once a share of
+// its lifetime has elapsed instead, so the same task suits the 7-day, 90-day and 1-year certificates. When both are
+// set the earlier of the two renews it:
+//
+//	certificateTasks:
+//	  - name: web
+//	    renewAt: 66%
+//	    renewBefore: 30d
+//
+// When a fleet of hosts runs the same playbook, renewalJitter spreads their renewals so they don't all reach the
+// platform at once. Each certificate is renewed up to renewalJitter earlier, by an amount derived from the host name
+// and the common name that doesn't change between runs:
+//
+//	config:
+//	  renewalJitter: 6h
+//
+// The SSH host tasks keep a host key of sshd certified by an SSH certificate template, rotating the key on renewal
+// when asked to, and point sshd to the key and the certificate before reloading it:
+//
+//	sshHostTasks:
+//	  - name: host
+//	    template: Host CA
+//	    principals: [web01.example.com]
+//	    hostKey: /etc/ssh/ssh_host_ed25519_key
+//	    afterInstallAction: systemctl reload sshd
+package playbook
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/installer"
+	"github.com/Venafi/vcert/v4/pkg/lint"
+	"github.com/Venafi/vcert/v4/pkg/truststore"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	ConnectionTypeTPP   = "tpp"
+	ConnectionTypeVaaS  = "vaas"
+	ConnectionTypeFake  = "fake"
+	InstallationTypePEM = "pem"
+	// InstallationTypeDockerSecret stores the certificate as Docker Swarm secrets
+	InstallationTypeDockerSecret = "docker-secret"
+	// InstallationTypeOCI pushes the certificate to an OCI registry as an artifact
+	InstallationTypeOCI = "oci"
+	// InstallationTypeConsulKV writes the certificate to Consul keys
+	InstallationTypeConsulKV = "consul-kv"
+	// InstallationTypeVaultKV writes the certificate to a secret of a Vault KV secrets engine
+	InstallationTypeVaultKV = "vault-kv"
+	// InstallationTypePostgreSQL writes the files of a PostgreSQL server, configures it and reloads it
+	InstallationTypePostgreSQL = "postgresql"
+	// InstallationTypeMySQL writes the files of a MySQL or MariaDB server, configures it and reloads its TLS context
+	InstallationTypeMySQL = "mysql"
+	// InstallationTypeTruststore adds the CA certificates of the chain to the Java truststore File
+	InstallationTypeTruststore = "truststore"
+	// InstallationTypeRADIUS writes the EAP-TLS files of a FreeRADIUS or NPS server to the directory File
+	InstallationTypeRADIUS = "radius"
+
+	defaultLockTimeout = 5 * time.Minute
+)
+
+// Playbook is the content of a playbook file
+type Playbook struct {
+	Config           Config            `yaml:"config"`
+	CertificateTasks []CertificateTask `yaml:"certificateTasks"`
+	// SSHHostTasks keep the SSH host certificates of the host valid
+	SSHHostTasks []SSHHostTask `yaml:"sshHostTasks,omitempty"`
+	// Include are the paths or glob patterns of other playbook files whose certificate tasks are added to the
+	// playbook, relative to the directory of the file including them
+	Include []string `yaml:"include,omitempty"`
+}
+
+type Config struct {
+	Connection Connection `yaml:"connection"`
+	// Connections are other connections, by name, for the certificate tasks that don't use the default one, e.g. a
+	// VaaS connection for the public facing certificates next to a default TPP connection
+	Connections map[string]Connection `yaml:"connections,omitempty"`
+	// Lock serializes the renewals of a certificate with the other vcert processes of the host
+	Lock *Lock `yaml:"lock,omitempty"`
+	// RenewalJitter is the most a renewal is brought forward on a host, e.g. "6h", to spread the renewals of a fleet
+	RenewalJitter string `yaml:"renewalJitter,omitempty"`
+	// IssuerPins are the PEM files of the CAs the certificates of a zone, by zone, are expected to chain to. A
+	// certificate of a pinned zone that doesn't chain to one of them isn't installed.
+	IssuerPins map[string]string `yaml:"issuerPins,omitempty"`
+}
+
+// Lock is a directory of lock files, one per certificate. The processes renewing the same certificate files must
+// use the same directory.
+type Lock struct {
+	Dir string `yaml:"dir"`
+	// Timeout is how long a renewal waits for another process to finish, e.g. "5m"
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// Connection describes how to reach the Venafi platform. Secret values can reference a systemd credential
+// with the "credential:<name>" syntax, or be encrypted with age ("age -a") so the playbook can be committed.
+type Connection struct {
+	Type        string      `yaml:"type"`
+	URL         string      `yaml:"url,omitempty"`
+	TrustBundle string      `yaml:"trustBundle,omitempty"`
+	Credentials Credentials `yaml:"credentials,omitempty"`
+	// RenewalInfoURL is an ACME renewalInfo resource. When it's set, or when the connector provides renewal
+	// recommendations, the suggested renewal windows are preferred over renewBefore.
+	RenewalInfoURL string `yaml:"renewalInfoURL,omitempty"`
+	// CircuitBreaker stops calling the platform for a while once it keeps failing, so a run over many
+	// certificates fails fast instead of timing out on each of them
+	CircuitBreaker *CircuitBreaker `yaml:"circuitBreaker,omitempty"`
+}
+
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures that opens the circuit
+	Threshold int `yaml:"threshold,omitempty"`
+	// Cooldown is how long calls are suspended before the platform is probed again, e.g. "30s"
+	Cooldown string `yaml:"cooldown,omitempty"`
+}
+
+type Credentials struct {
+	APIKey      string `yaml:"apiKey,omitempty"`
+	AccessToken string `yaml:"accessToken,omitempty"`
+	User        string `yaml:"user,omitempty"`
+	Password    string `yaml:"password,omitempty"`
+}
+
+// CertificateTask is a certificate to keep valid, and where to install it
+type CertificateTask struct {
+	Name string `yaml:"name"`
+	// Connection is the name of the connection of the config used by the task, the default connection when it's
+	// empty
+	Connection string `yaml:"connection,omitempty"`
+	// RenewBefore is how long before expiration the certificate is renewed, e.g. "30d" or "12h"
+	RenewBefore string `yaml:"renewBefore,omitempty"`
+	// RenewAt is the share of the lifetime of the certificate after which it's renewed, e.g. "66%"
+	RenewAt       string         `yaml:"renewAt,omitempty"`
+	Request       Request        `yaml:"request"`
+	Installations []Installation `yaml:"installations"`
+	// PreValidate is checked before a certificate is requested
+	PreValidate *PreValidation `yaml:"preValidate,omitempty"`
+	// CAACheck makes sure the names resolve and their CAA records let the CA issue for them before a certificate
+	// is requested
+	CAACheck *CAACheck `yaml:"caaCheck,omitempty"`
+	// Location places the certificate on a device of the platform, so its installation is tracked
+	Location *Location `yaml:"location,omitempty"`
+	// Lint checks the issued certificate before it's installed, a certificate with lint errors isn't installed
+	Lint *Lint `yaml:"lint,omitempty"`
+	// SkipPossessionCheck installs the certificate without proving first that its private key signs for its
+	// public key
+	SkipPossessionCheck bool `yaml:"skipPossessionCheck,omitempty"`
+}
+
+// Lint configures the checks of package lint
+type Lint struct {
+	// ExtKeyUsages are the extended key usages the certificate must have, named like in OpenSSL e.g. serverAuth
+	ExtKeyUsages []string `yaml:"extKeyUsages,omitempty"`
+}
+
+func (l *Lint) options() (lint.Options, error) {
+	var opts lint.Options
+	for _, name := range l.ExtKeyUsages {
+		eku, err := lint.ParseExtKeyUsage(name)
+		if err != nil {
+			return opts, err
+		}
+		opts.ExtKeyUsages = append(opts.ExtKeyUsages, eku)
+	}
+	return opts, nil
+}
+
+// Location is the device and the application using the certificate. The device is replaced on each renewal.
+type Location struct {
+	// Instance is the name of the device, the host name by default
+	Instance  string `yaml:"instance,omitempty"`
+	Workload  string `yaml:"workload,omitempty"`
+	IPAddress string `yaml:"ipAddress,omitempty"`
+	// TLSAddress is the host:port where the certificate is validated, the endpoint of the first installation by
+	// default
+	TLSAddress string `yaml:"tlsAddress,omitempty"`
+	// InstallPath is where the certificate is installed, the file of the first installation by default
+	InstallPath string `yaml:"installPath,omitempty"`
+}
+
+// PreValidation makes sure the requested names resolve to the host before a certificate is issued for them
+type PreValidation struct {
+	// Addresses are the IP addresses or CIDR ranges the common name and DNS SANs must resolve to
+	Addresses []string `yaml:"addresses"`
+}
+
+// CAACheck is checked before a certificate is requested from a public CA, so a request the CA would refuse isn't
+// submitted
+type CAACheck struct {
+	// Issuers are the domains identifying the CA in CAA records, e.g. digicert.com
+	Issuers []string `yaml:"issuers"`
+	// Server is the DNS server queried for the CAA records, the first name server of /etc/resolv.conf by default
+	Server string `yaml:"server,omitempty"`
+	// Warn logs the problems found and requests the certificate anyway
+	Warn bool `yaml:"warn,omitempty"`
+}
+
+type Request struct {
+	Zone        string            `yaml:"zone"`
+	Subject     Subject           `yaml:"subject"`
+	SANs        SANs              `yaml:"sans,omitempty"`
+	KeyType     string            `yaml:"keyType,omitempty"`
+	KeySize     int               `yaml:"keySize,omitempty"`
+	KeyCurve    string            `yaml:"keyCurve,omitempty"`
+	KeyPassword string            `yaml:"keyPassword,omitempty"`
+	CsrOrigin   string            `yaml:"csrOrigin,omitempty"`
+	ChainOption string            `yaml:"chainOption,omitempty"`
+	ValidDays   int               `yaml:"validDays,omitempty"`
+	Fields      map[string]string `yaml:"fields,omitempty"`
+	// PublicCA checks the request against the CA/Browser Forum baseline requirements before it's submitted, for
+	// the zones issuing from a public CA
+	PublicCA bool `yaml:"publicCA,omitempty"`
+	// ChainPreference picks the chain when the issuers are cross-signed: default, shortest or longest-validity
+	ChainPreference string `yaml:"chainPreference,omitempty"`
+	// ChainRoot pins the root the chain ends with by its SHA-1 or SHA-256 fingerprint
+	ChainRoot string `yaml:"chainRoot,omitempty"`
+}
+
+type Subject struct {
+	CommonName   string   `yaml:"commonName"`
+	Organization string   `yaml:"organization,omitempty"`
+	OrgUnits     []string `yaml:"orgUnits,omitempty"`
+	Locality     string   `yaml:"locality,omitempty"`
+	Province     string   `yaml:"state,omitempty"`
+	Country      string   `yaml:"country,omitempty"`
+	// KeepUnicode keeps an internationalized common name in Unicode, its A-label is added to the DNS SANs
+	KeepUnicode bool `yaml:"keepUnicode,omitempty"`
+}
+
+type SANs struct {
+	DNS   []string `yaml:"dns,omitempty"`
+	IP    []string `yaml:"ip,omitempty"`
+	Email []string `yaml:"email,omitempty"`
+	URI   []string `yaml:"uri,omitempty"`
+	// Sources add the SANs they hold when the task runs, the certificate is renewed when they change
+	Sources []SANSource `yaml:"sources,omitempty"`
+}
+
+// Installation is a place where the certificate of a task is written. The paths may be templates using the task,
+// its request and the issued certificate, e.g. "/etc/ssl/{{ .CommonName }}/{{ .NotAfter | date "2006-01" }}.pem",
+// with the functions date, lower, upper, replace, trimPrefix, trimSuffix and default. Their directories are created.
+type Installation struct {
+	Type      string `yaml:"type"`
+	File      string `yaml:"file"`
+	ChainFile string `yaml:"chainFile,omitempty"`
+	KeyFile   string `yaml:"keyFile,omitempty"`
+	// AfterInstallAction is a shell command run after the files are written, e.g. to reload the service
+	AfterInstallAction string `yaml:"afterInstallAction,omitempty"`
+	// Signal notifies the program using the files once they're written
+	Signal *Signal `yaml:"signal,omitempty"`
+	// Endpoint is the host:port where the certificate is served, it's checked to serve the installed certificate
+	// by "vcert run --check"
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// DockerSecret is where a docker-secret installation stores the certificate
+	DockerSecret *DockerSecret `yaml:"dockerSecret,omitempty"`
+	// OCI is where an oci installation pushes the certificate
+	OCI *OCIArtifact `yaml:"oci,omitempty"`
+	// ConsulKV is where a consul-kv installation writes the certificate
+	ConsulKV *ConsulKV `yaml:"consulKV,omitempty"`
+	// VaultKV is where a vault-kv installation writes the certificate
+	VaultKV *VaultKV `yaml:"vaultKV,omitempty"`
+	// NomadJob is deployed again once the certificate is installed, for its templates to read the new one
+	NomadJob *NomadJob `yaml:"nomadJob,omitempty"`
+	// PostgreSQL and MySQL configure the server of a database installation, which writes File, KeyFile and the
+	// chain to ChainFile when it's set
+	PostgreSQL *PostgreSQL `yaml:"postgresql,omitempty"`
+	MySQL      *MySQL      `yaml:"mysql,omitempty"`
+	// Truststore is the format and password of the Java truststore of a truststore installation
+	Truststore *Truststore `yaml:"truststore,omitempty"`
+	// RADIUS is the server of a radius installation
+	RADIUS *RADIUS `yaml:"radius,omitempty"`
+}
+
+// writesFiles tells whether the installation writes the certificate to File, which can be read back
+func (inst *Installation) writesFiles() bool {
+	switch inst.Type {
+	case InstallationTypePEM, InstallationTypePostgreSQL, InstallationTypeMySQL:
+		return true
+	}
+	return false
+}
+
+// validateTarget checks the settings of an installation that isn't a file
+func (inst *Installation) validateTarget() error {
+	var missing string
+	switch inst.Type {
+	case InstallationTypeDockerSecret:
+		if inst.DockerSecret == nil || inst.DockerSecret.Name == "" {
+			missing = "dockerSecret.name"
+		}
+	case InstallationTypeOCI:
+		if inst.OCI == nil || inst.OCI.Reference == "" {
+			missing = "oci.reference"
+		}
+	case InstallationTypeConsulKV:
+		if inst.ConsulKV == nil || inst.ConsulKV.Prefix == "" {
+			missing = "consulKV.prefix"
+		}
+	case InstallationTypeVaultKV:
+		if inst.VaultKV == nil || inst.VaultKV.Path == "" {
+			missing = "vaultKV.path"
+		} else if v := inst.VaultKV.Version; v != 0 && v != 1 && v != 2 {
+			return fmt.Errorf("%w: unknown Vault KV version %d", verror.UserDataError, v)
+		}
+	case InstallationTypeTruststore:
+		if inst.File == "" {
+			missing = "file"
+		} else if inst.Truststore != nil && inst.Truststore.Format != "" {
+			if _, err := truststore.ParseFormat(inst.Truststore.Format); err != nil {
+				return err
+			}
+		}
+	case InstallationTypeRADIUS:
+		if inst.File == "" {
+			missing = "file"
+		} else if inst.RADIUS != nil {
+			if _, err := installer.ParseRADIUSServer(inst.RADIUS.Server); err != nil {
+				return err
+			}
+			switch inst.RADIUS.DHParams {
+			case 0, 2048, 3072, 4096:
+			default:
+				return fmt.Errorf("%w: radius installation: unsupported dhParams %d, it's 2048, 3072 or 4096", verror.UserDataError, inst.RADIUS.DHParams)
+			}
+		}
+	}
+	if missing != "" {
+		return fmt.Errorf("%w: %s installation needs %s", verror.UserDataError, inst.Type, missing)
+	}
+	return nil
+}
+
+// ConsulKV holds the certificate, its chain and its private key as the keys cert.pem, chain.pem and key.pem under
+// Prefix. Address and Token default to $CONSUL_HTTP_ADDR and $CONSUL_HTTP_TOKEN.
+type ConsulKV struct {
+	Address    string `yaml:"address,omitempty"`
+	Token      string `yaml:"token,omitempty"`
+	Prefix     string `yaml:"prefix"`
+	Datacenter string `yaml:"datacenter,omitempty"`
+}
+
+// VaultKV holds the certificate, its chain and its private key as the fields certificate, ca_chain and private_key
+// of the secret at Path of a KV secrets engine. Address, Token and Namespace default to $VAULT_ADDR, $VAULT_TOKEN
+// and $VAULT_NAMESPACE.
+type VaultKV struct {
+	Address   string `yaml:"address,omitempty"`
+	Token     string `yaml:"token,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
+	// Mount is the path of the secrets engine, secret by default
+	Mount string `yaml:"mount,omitempty"`
+	Path  string `yaml:"path"`
+	// Version is the version of the secrets engine, 2 by default
+	Version int `yaml:"version,omitempty"`
+}
+
+// PostgreSQL is the server of a postgresql installation. ConfigFile is postgresql.conf, where the ssl parameters
+// are set when it's not empty. The server is reloaded with "pg_ctl reload", DataDir defaults to $PGDATA.
+type PostgreSQL struct {
+	// Owner is the "user" or "user:group" owning the files, usually postgres
+	Owner      string `yaml:"owner,omitempty"`
+	ConfigFile string `yaml:"configFile,omitempty"`
+	DataDir    string `yaml:"dataDir,omitempty"`
+	PgCtl      string `yaml:"pgCtl,omitempty"`
+}
+
+// MySQL is the server of a mysql installation. ConfigFile is the option file where the ssl options of the [mysqld]
+// group are set when it's not empty. The TLS context is reloaded with the mysql client, which reads its
+// credentials from DefaultsFile.
+type MySQL struct {
+	// Owner is the "user" or "user:group" owning the files, usually mysql
+	Owner        string `yaml:"owner,omitempty"`
+	ConfigFile   string `yaml:"configFile,omitempty"`
+	DefaultsFile string `yaml:"defaultsFile,omitempty"`
+	// MariaDB reloads with FLUSH SSL instead of ALTER INSTANCE RELOAD TLS
+	MariaDB bool   `yaml:"mariaDB,omitempty"`
+	Client  string `yaml:"client,omitempty"`
+}
+
+// Truststore is the Java truststore of a truststore installation, like the cacerts file of a JDK. Format is jks or
+// pkcs12, the one of a truststore created by the installation, pkcs12 by default. Password defaults to changeit and
+// AliasPrefix, which starts the aliases of the certificates added, to vcert-.
+type Truststore struct {
+	Format      string `yaml:"format,omitempty"`
+	Password    string `yaml:"password,omitempty"`
+	AliasPrefix string `yaml:"aliasPrefix,omitempty"`
+}
+
+// RADIUS is the server of a radius installation, freeradius by default, whose files are written to the directory
+// File: server.pem, server.key, ca.pem and, when DHParams is 2048, 3072 or 4096, the dh file of the ffdhe group for
+// FreeRADIUS, owned by Owner, or server.pfx, protected by Password, and ca.cer for NPS. The certificate must be valid
+// for server authentication.
+type RADIUS struct {
+	Server   string `yaml:"server,omitempty"`
+	Owner    string `yaml:"owner,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	DHParams int    `yaml:"dhParams,omitempty"`
+}
+
+// NomadJob is a Nomad job deployed again when its certificate changes. Address, Token and Namespace default to
+// $NOMAD_ADDR, $NOMAD_TOKEN and $NOMAD_NAMESPACE.
+type NomadJob struct {
+	Address   string `yaml:"address,omitempty"`
+	Token     string `yaml:"token,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Job       string `yaml:"job"`
+}
+
+// DockerSecret stores the certificate and its chain as the Swarm secret Name+".crt.<serial>" and the private key
+// as Name+".key.<serial>". The services using the secrets of the previous certificate are updated.
+type DockerSecret struct {
+	Name string `yaml:"name"`
+	// Host is the Docker API endpoint, $DOCKER_HOST or the local socket by default
+	Host     string            `yaml:"host,omitempty"`
+	Services []string          `yaml:"services,omitempty"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
+}
+
+// OCIArtifact is an artifact of an OCI registry holding the certificate and its chain as cert.pem, and the private
+// key as key.pem when IncludeKey is set
+type OCIArtifact struct {
+	// Reference is the repository and tag, e.g. registry.example.com/certs/web:prod
+	Reference  string `yaml:"reference"`
+	Username   string `yaml:"username,omitempty"`
+	Password   string `yaml:"password,omitempty"`
+	IncludeKey bool   `yaml:"includeKey,omitempty"`
+	PlainHTTP  bool   `yaml:"plainHTTP,omitempty"`
+}
+
+// Load reads and validates the playbook at path, with the files it includes. A playbook file encrypted as a whole
+// with age, or with SOPS, is decrypted first.
+func Load(path string) (*Playbook, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read playbook: %s", verror.UserDataError, err)
+	}
+	data, err = decryptPlaybook(path, data)
+	if err != nil {
+		return nil, err
+	}
+	return parse(path, data)
+}
+
+// Parse parses and validates a playbook, the files it includes are relative to the current directory. Unknown keys
+// are errors, and the errors tell the line of the problem when it's known.
+func Parse(data []byte) (*Playbook, error) {
+	if isSOPS(data) {
+		return nil, fmt.Errorf("%w: playbook is encrypted with SOPS, it must be decrypted first", verror.UserDataError)
+	}
+	return parse("", data)
+}
+
+func parse(path string, data []byte) (*Playbook, error) {
+	l := newLoader()
+	err := l.load(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse playbook: %s", verror.UserDataError, err)
+	}
+	pb := l.playbook
+	err = expandEnv(pb)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse playbook: %s", verror.UserDataError, err)
+	}
+	err = pb.Validate()
+	if err != nil {
+		return nil, withTaskLine(err, l.locate)
+	}
+	return pb, nil
+}
+
+// Validate checks that the playbook can be run
+func (pb *Playbook) Validate() error {
+	if err := pb.Config.Connection.validate(); err != nil {
+		return err
+	}
+	for name, c := range pb.Config.Connections {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("connection %q: %w", name, err)
+		}
+	}
+	if l := pb.Config.Lock; l != nil {
+		if l.Dir == "" {
+			return fmt.Errorf("%w: lock directory is required", verror.UserDataError)
+		}
+		if _, err := l.timeout(); err != nil {
+			return err
+		}
+	}
+	if _, err := pb.Config.renewalJitter(); err != nil {
+		return err
+	}
+	if len(pb.CertificateTasks) == 0 && len(pb.SSHHostTasks) == 0 {
+		return fmt.Errorf("%w: playbook has no certificate tasks", verror.UserDataError)
+	}
+	names := make(map[string]bool)
+	for i, task := range pb.SSHHostTasks {
+		if task.Name == "" {
+			return fmt.Errorf("%w: SSH host task #%d has no name", verror.UserDataError, i+1)
+		}
+		if names[task.Name] {
+			return fmt.Errorf("%w: task name %q is duplicated", verror.UserDataError, task.Name)
+		}
+		names[task.Name] = true
+		if pb.connection(task.Connection) == nil {
+			return fmt.Errorf("%w: SSH host task %q: unknown connection %q", verror.UserDataError, task.Name, task.Connection)
+		}
+		if err := task.validate(); err != nil {
+			return err
+		}
+	}
+	for i, task := range pb.CertificateTasks {
+		if task.Name == "" {
+			return fmt.Errorf("%w: certificate task #%d has no name", verror.UserDataError, i+1)
+		}
+		if names[task.Name] {
+			return fmt.Errorf("%w: certificate task name %q is duplicated", verror.UserDataError, task.Name)
+		}
+		names[task.Name] = true
+		if pb.connection(task.Connection) == nil {
+			return fmt.Errorf("%w: certificate task %q: unknown connection %q", verror.UserDataError, task.Name, task.Connection)
+		}
+		if task.Request.Subject.CommonName == "" && len(task.Request.SANs.DNS) == 0 && len(task.Request.SANs.Sources) == 0 {
+			return fmt.Errorf("%w: certificate task %q needs a common name or a DNS SAN", verror.UserDataError, task.Name)
+		}
+		for i := range task.Request.SANs.Sources {
+			if err := task.Request.SANs.Sources[i].validate(); err != nil {
+				return fmt.Errorf("certificate task %q: %w", task.Name, err)
+			}
+		}
+		if _, err := task.renewalThreshold(); err != nil {
+			return err
+		}
+		if len(task.Installations) == 0 {
+			return fmt.Errorf("%w: certificate task %q has no installations", verror.UserDataError, task.Name)
+		}
+		if loc := task.Location; loc != nil {
+			if loc.IPAddress != "" && net.ParseIP(loc.IPAddress) == nil {
+				return fmt.Errorf("%w: certificate task %q: invalid location IP address %q", verror.UserDataError, task.Name, loc.IPAddress)
+			}
+			if loc.TLSAddress != "" {
+				if _, _, err := net.SplitHostPort(loc.TLSAddress); err != nil {
+					return fmt.Errorf("%w: certificate task %q: location TLS address %q is not host:port", verror.UserDataError, task.Name, loc.TLSAddress)
+				}
+			}
+		}
+		if task.CAACheck != nil && len(task.CAACheck.Issuers) == 0 {
+			return fmt.Errorf("%w: certificate task %q: caaCheck needs the issuers of the CA", verror.UserDataError, task.Name)
+		}
+		if task.Lint != nil {
+			if _, err := task.Lint.options(); err != nil {
+				return fmt.Errorf("certificate task %q: %w", task.Name, err)
+			}
+		}
+		for j, inst := range task.Installations {
+			switch inst.Type {
+			case InstallationTypePEM, InstallationTypePostgreSQL, InstallationTypeMySQL:
+				if inst.File == "" {
+					return fmt.Errorf("%w: certificate task %q: installation file is required", verror.UserDataError, task.Name)
+				}
+				if inst.Type != InstallationTypePEM && inst.KeyFile == "" {
+					return fmt.Errorf("%w: certificate task %q: %s installation needs keyFile", verror.UserDataError, task.Name, inst.Type)
+				}
+				if _, err := inst.resolve(newPathData(&pb.CertificateTasks[i], nil)); err != nil {
+					return fmt.Errorf("%w: certificate task %q: invalid installation path: %s", verror.UserDataError, task.Name, err)
+				}
+			case InstallationTypeDockerSecret, InstallationTypeOCI, InstallationTypeConsulKV, InstallationTypeVaultKV, InstallationTypeTruststore,
+				InstallationTypeRADIUS:
+				// the renewals are decided on the certificate of the first installation, which must be read back
+				if j == 0 {
+					return fmt.Errorf("%w: certificate task %q: the first installation must write files, like the pem type", verror.UserDataError, task.Name)
+				}
+				if err := inst.validateTarget(); err != nil {
+					return fmt.Errorf("certificate task %q: %w", task.Name, err)
+				}
+			default:
+				return fmt.Errorf("%w: certificate task %q: unknown installation type %q", verror.UserDataError, task.Name, inst.Type)
+			}
+			if inst.NomadJob != nil && inst.NomadJob.Job == "" {
+				return fmt.Errorf("%w: certificate task %q: nomadJob needs a job", verror.UserDataError, task.Name)
+			}
+			if inst.Endpoint != "" {
+				if _, _, err := net.SplitHostPort(inst.Endpoint); err != nil {
+					return fmt.Errorf("%w: certificate task %q: endpoint %q is not host:port", verror.UserDataError, task.Name, inst.Endpoint)
+				}
+			}
+			if inst.Signal != nil {
+				if err := inst.Signal.validate(); err != nil {
+					return fmt.Errorf("certificate task %q: %w", task.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Connection) validate() error {
+	switch strings.ToLower(c.Type) {
+	case ConnectionTypeTPP, ConnectionTypeVaaS, ConnectionTypeFake:
+	default:
+		return fmt.Errorf("%w: unknown connection type %q", verror.UserDataError, c.Type)
+	}
+	if cb := c.CircuitBreaker; cb != nil && cb.Cooldown != "" {
+		if _, err := parseDuration(cb.Cooldown); err != nil {
+			return fmt.Errorf("%w: invalid circuit breaker cooldown %q", verror.UserDataError, cb.Cooldown)
+		}
+	}
+	return nil
+}
+
+// connection returns the connection of the config called name, the default connection when name is empty, or nil
+// when there's no such connection
+func (pb *Playbook) connection(name string) *Connection {
+	if name == "" {
+		return &pb.Config.Connection
+	}
+	c, ok := pb.Config.Connections[name]
+	if !ok {
+		return nil
+	}
+	return &c
+}
+
+func (l *Lock) timeout() (time.Duration, error) {
+	if l.Timeout == "" {
+		return defaultLockTimeout, nil
+	}
+	d, err := parseDuration(l.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid lock timeout %q", verror.UserDataError, l.Timeout)
+	}
+	return d, nil
+}
+
+func (c *Config) renewalJitter() (time.Duration, error) {
+	if c.RenewalJitter == "" {
+		return 0, nil
+	}
+	d, err := parseDuration(c.RenewalJitter)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%w: invalid renewal jitter %q", verror.UserDataError, c.RenewalJitter)
+	}
+	return d, nil
+}
+
+// pinnedIssuers returns the CAs pinned for zone, none when the zone isn't pinned
+func (c *Config) pinnedIssuers(zone string) ([]*x509.Certificate, error) {
+	path, ok := c.IssuerPins[zone]
+	if !ok {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the issuers pinned for zone %q: %w", zone, err)
+	}
+	return certificate.ParsePinnedIssuers(data)
+}
+
+func (task *CertificateTask) renewalThreshold() (renewalThreshold, error) {
+	t, err := parseRenewalThreshold(task.RenewBefore, task.RenewAt)
+	if err != nil {
+		return t, fmt.Errorf("%w: certificate task %q: %s", verror.UserDataError, task.Name, err)
+	}
+	return t, nil
+}
+
+// jitterKey is hashed with the host name for the renewal jitter, the common name of the certificate or the task name
+// when there's none
+func (task *CertificateTask) jitterKey() string {
+	if task.Request.Subject.CommonName != "" {
+		return task.Request.Subject.CommonName
+	}
+	return task.Name
+}
+
+// renewalThreshold is when a certificate is renewed: a time before its expiration, once a share of its lifetime has
+// elapsed, or the earlier of both
+type renewalThreshold struct {
+	before time.Duration
+	// lifetime is the share of the lifetime after which the certificate is renewed, 0 when there's none
+	lifetime float64
+}
+
+// parseRenewalThreshold reads the renewBefore and renewAt of a task. renewBefore defaults to 30 days when neither
+// is set.
+func parseRenewalThreshold(renewBefore, renewAt string) (renewalThreshold, error) {
+	var t renewalThreshold
+	var err error
+	if renewBefore == "" && renewAt == "" {
+		renewBefore = "30d"
+	}
+	if renewBefore != "" {
+		t.before, err = parseDuration(renewBefore)
+		if err != nil {
+			return t, fmt.Errorf("invalid renewBefore %q", renewBefore)
+		}
+	}
+	if renewAt != "" {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(renewAt, "%"), 64)
+		if err != nil || !strings.HasSuffix(renewAt, "%") || percent <= 0 || percent >= 100 {
+			return t, fmt.Errorf("invalid renewAt %q, expected a percentage of the lifetime between 0%% and 100%%", renewAt)
+		}
+		t.lifetime = percent / 100
+	}
+	return t, nil
+}
+
+// renewAt returns when the certificate valid from notBefore to notAfter is renewed
+func (t renewalThreshold) renewAt(notBefore, notAfter time.Time) time.Time {
+	at := notAfter.Add(-t.before)
+	if t.lifetime > 0 {
+		elapsed := notBefore.Add(time.Duration(float64(notAfter.Sub(notBefore)) * t.lifetime))
+		if elapsed.Before(at) {
+			at = elapsed
+		}
+	}
+	return at
+}
+
+// parseDuration extends time.ParseDuration with days, e.g. "30d"
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,771 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/age"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/lock"
+	"github.com/Venafi/vcert/v4/pkg/tracing"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const testPlaybook = `
+config:
+  connection:
+    type: fake
+certificateTasks:
+  - name: web
+    renewBefore: 10d
+    request:
+      zone: Default
+      subject:
+        commonName: www.example.com
+      sans:
+        dns: [www.example.com]
+        ip: [127.0.0.1]
+    installations:
+      - type: pem
+        file: %[1]s/cert.pem
+        keyFile: %[1]s/key.pem
+        afterInstallAction: touch %[1]s/reloaded
+`
+
+func TestParseValidate(t *testing.T) {
+	cases := map[string]string{
+		"unknown connection": "config: {connection: {type: ftp}}\ncertificateTasks: [{name: a}]",
+		"no tasks":           "config: {connection: {type: fake}}",
+		"no name":            "config: {connection: {type: fake}}\ncertificateTasks: [{request: {subject: {commonName: a}}}]",
+		"no installation":    "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}}]",
+		"bad renewBefore":    "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, renewBefore: soon, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}]}]",
+		"bad renewAt":        "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, renewAt: 150%, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}]}]",
+		"bad renewal jitter": "config: {connection: {type: fake}, renewalJitter: often}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}]}]",
+		"no lock dir":        "config: {connection: {type: fake}, lock: {timeout: 1m}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}]}]",
+		"bad lock timeout":   "config: {connection: {type: fake}, lock: {dir: /tmp, timeout: later}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}]}]",
+		"bad lint usage":     "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}], lint: {extKeyUsages: [webAuth]}}]",
+		"no CAA issuers":     "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}], caaCheck: {warn: true}}]",
+		"unknown key":        "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {cn: a}}, installations: [{type: pem, file: a}]}]",
+		"wrong type":         "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {keySize: big, subject: {commonName: a}}, installations: [{type: pem, file: a}]}]",
+		"bad connection":     "config: {connection: {type: fake}, connections: {saas: {type: ftp}}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}]}]",
+		"missing connection": "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, connection: saas, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}]}]",
+		"oci first":          "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: oci, oci: {reference: r.example.com/a}}]}]",
+		"no secret name":     "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}, {type: docker-secret}]}]",
+		"bad vault version":  "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}, {type: vault-kv, vaultKV: {path: a, version: 3}}]}]",
+		"no nomad job":       "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a, nomadJob: {namespace: a}}]}]",
+		"bad truststore":     "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}, {type: truststore, file: b, truststore: {format: bks}}]}]",
+		"bad radius server":  "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}, {type: radius, file: b, radius: {server: ias}}]}]",
+		"weak dh params":     "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: a}, {type: radius, file: b, radius: {dhParams: 1024}}]}]",
+		"no database key":    "config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: postgresql, file: a, postgresql: {owner: postgres}}]}]",
+	}
+	for name, data := range cases {
+		_, err := Parse([]byte(data))
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("%s: expected user data error, got %v", name, err)
+		}
+	}
+
+	// database installations write files, they can be the first one
+	_, err := Parse([]byte("config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: mysql, file: a, keyFile: b, mysql: {owner: mysql, mariaDB: true}}]}]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, "/tmp")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	threshold, _ := pb.CertificateTasks[0].renewalThreshold()
+	if threshold.before != 10*24*time.Hour || threshold.lifetime != 0 {
+		t.Fatalf("unexpected renewal threshold %+v", threshold)
+	}
+}
+
+func TestRenewalThreshold(t *testing.T) {
+	notBefore := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		renewBefore, renewAt string
+		lifetime             time.Duration
+		expected             time.Duration
+	}{
+		{"", "", 365 * day, 335 * day},
+		{"10d", "", 90 * day, 80 * day},
+		{"", "66%", 90 * day, 59*day + 9*time.Hour + 36*time.Minute},
+		{"", "50%", 7 * day, 3*day + 12*time.Hour},
+		// the earlier of both
+		{"30d", "66%", 365 * day, 240*day + 21*time.Hour + 36*time.Minute},
+		{"30d", "95%", 365 * day, 335 * day},
+	}
+	for _, tt := range tests {
+		threshold, err := parseRenewalThreshold(tt.renewBefore, tt.renewAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := threshold.renewAt(notBefore, notBefore.Add(tt.lifetime))
+		if at.Sub(notBefore) != tt.expected {
+			t.Errorf("%q %q: expected renewal after %s, got %s", tt.renewBefore, tt.renewAt, tt.expected, at.Sub(notBefore))
+		}
+	}
+	for _, renewAt := range []string{"66", "0%", "100%", "two thirds%"} {
+		if _, err := parseRenewalThreshold("", renewAt); err == nil {
+			t.Errorf("expected an error for renewAt %q", renewAt)
+		}
+	}
+}
+
+func TestRenewalJitter(t *testing.T) {
+	notBefore := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(90 * 24 * time.Hour)
+	threshold, err := parseRenewalThreshold("30d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := threshold.renewAt(notBefore, notAfter)
+	pb := &Playbook{Config: Config{RenewalJitter: "6h"}}
+
+	times := make(map[time.Time]bool)
+	for i := 0; i < 10; i++ {
+		r := &Runner{Playbook: pb, Hostname: fmt.Sprintf("web%02d", i)}
+		jittered := r.renewAt(threshold, "www.example.com", notBefore, notAfter)
+		if jittered.After(at) || !jittered.After(at.Add(-6*time.Hour)) {
+			t.Errorf("%s: renewal at %s out of the jitter", r.Hostname, jittered)
+		}
+		if again := r.renewAt(threshold, "www.example.com", notBefore, notAfter); !again.Equal(jittered) {
+			t.Errorf("%s: renewal moved from %s to %s", r.Hostname, jittered, again)
+		}
+		times[jittered] = true
+	}
+	if len(times) < 5 {
+		t.Errorf("expected the renewals to be spread, got %v", times)
+	}
+
+	// the jitter of a short-lived certificate is capped by half its time before the threshold
+	pb.Config.RenewalJitter = "30d"
+	r := &Runner{Playbook: pb, Hostname: "web01"}
+	threshold, _ = parseRenewalThreshold("", "50%")
+	notAfter = notBefore.Add(48 * time.Hour)
+	if jittered := r.renewAt(threshold, "www.example.com", notBefore, notAfter); jittered.Before(notBefore.Add(12 * time.Hour)) {
+		t.Errorf("renewal at %s is too early", jittered)
+	}
+}
+
+func TestParseErrorLines(t *testing.T) {
+	cases := []struct {
+		data, want string
+	}{
+		{
+			"config:\n  connection:\n    type: fake\ncertificateTasks:\n  - name: web\n    request:\n      subject:\n        comonName: www\n",
+			`line 8: unknown key "comonName", did you mean "commonName"?`,
+		},
+		{
+			"config:\n  conection:\n    type: fake\n",
+			`line 2: unknown key "conection", did you mean "connection"?`,
+		},
+		{
+			"config:\n  connection:\n    type: fake\n    colour: blue\n",
+			`line 4: unknown key "colour"`,
+		},
+		{
+			"config:\n  connection:\n    type: fake\ncertificateTasks:\n  - name: web\n    request:\n      subject:\n        commonName: www\n    installations: [{type: pem, file: www.pem}]\n  - name: \"api\"\n    request:\n      subject:\n        commonName: api\n",
+			`certificate task "api" (line 10) has no installations`,
+		},
+	}
+	for _, c := range cases {
+		_, err := Parse([]byte(c.data))
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("expected an error containing %q, got %v", c.want, err)
+		}
+		if !strings.HasSuffix(c.want, "?") && strings.Contains(fmt.Sprint(err), "did you mean") {
+			t.Errorf("unexpected suggestion in %v", err)
+		}
+	}
+}
+
+func TestParseExpandsEnv(t *testing.T) {
+	data := []byte(`config:
+  connection:
+    type: ${VCERT_TEST_TYPE:-fake}
+    url: ${VCERT_TEST_URL}
+certificateTasks:
+  - name: web
+    request:
+      zone: ${VCERT_TEST_ZONE:-Certificates\Web}
+      subject:
+        commonName: www.${VCERT_TEST_DOMAIN}
+      sans:
+        dns: ["www.${VCERT_TEST_DOMAIN}"]
+      fields:
+        owner: ${VCERT_TEST_OWNER:-ops}
+    installations:
+      - type: pem
+        file: /etc/ssl/$${HOST}/cert.pem
+`)
+	_, err := Parse(data)
+	if err == nil || !strings.Contains(err.Error(), "config.connection.url: environment variable VCERT_TEST_URL is not set") {
+		t.Fatalf("expected an error about VCERT_TEST_URL, got %v", err)
+	}
+
+	os.Setenv("VCERT_TEST_URL", "https://tpp.example.com")
+	os.Setenv("VCERT_TEST_DOMAIN", "example.com")
+	defer os.Unsetenv("VCERT_TEST_URL")
+	defer os.Unsetenv("VCERT_TEST_DOMAIN")
+	pb, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := pb.CertificateTasks[0]
+	if pb.Config.Connection.Type != ConnectionTypeFake || pb.Config.Connection.URL != "https://tpp.example.com" {
+		t.Errorf("unexpected connection %+v", pb.Config.Connection)
+	}
+	if task.Request.Zone != `Certificates\Web` || task.Request.Subject.CommonName != "www.example.com" {
+		t.Errorf("unexpected request %+v", task.Request)
+	}
+	if task.Request.SANs.DNS[0] != "www.example.com" || task.Request.Fields["owner"] != "ops" {
+		t.Errorf("unexpected request %+v", task.Request)
+	}
+	if task.Installations[0].File != "/etc/ssl/${HOST}/cert.pem" {
+		t.Errorf("unexpected installation file %q", task.Installations[0].File)
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "tpp-token"), []byte("s3cr3t\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := resolveSecret("plain")
+	if err != nil || v != "plain" {
+		t.Fatalf("unexpected %q, %v", v, err)
+	}
+
+	os.Unsetenv(credentialsDirectoryEnv)
+	_, err = resolveSecret("credential:tpp-token")
+	if err == nil {
+		t.Fatal("expected error without credentials directory")
+	}
+
+	os.Setenv(credentialsDirectoryEnv, dir)
+	defer os.Unsetenv(credentialsDirectoryEnv)
+	v, err = resolveSecret("credential:tpp-token")
+	if err != nil || v != "s3cr3t" {
+		t.Fatalf("unexpected %q, %v", v, err)
+	}
+	_, err = resolveSecret("credential:../tpp-token")
+	if err == nil {
+		t.Fatal("expected error for credential name with a path")
+	}
+
+	id, _ := age.GenerateIdentity()
+	encrypted, err := age.Encrypt([]byte("s3cr3t\n"), true, id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(age.KeyEnv, id.String())
+	defer os.Unsetenv(age.KeyEnv)
+	v, err = resolveSecret(string(encrypted))
+	if err != nil || v != "s3cr3t" {
+		t.Fatalf("unexpected %q, %v", v, err)
+	}
+}
+
+func TestLoadEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	plain := []byte(fmt.Sprintf(testPlaybook, dir))
+
+	id, _ := age.GenerateIdentity()
+	encrypted, err := age.Encrypt(plain, false, id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "playbook.yaml.age")
+	err = ioutil.WriteFile(path, encrypted, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(age.KeyEnv, id.String())
+	defer os.Unsetenv(age.KeyEnv)
+	pb, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pb.CertificateTasks[0].Name != "web" {
+		t.Fatalf("unexpected playbook %+v", pb)
+	}
+
+	sopsDoc := append(append([]byte(nil), plain...), "sops:\n  mac: ENC[AES256_GCM,data:x,iv:y,tag:z,type:str]\n"...)
+	_, err = Parse(sopsDoc)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected SOPS playbook to be rejected, got %v", err)
+	}
+	path = filepath.Join(dir, "playbook.sops.yaml")
+	err = ioutil.WriteFile(path, sopsDoc, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a fake sops command printing the decrypted playbook
+	bin := filepath.Join(dir, "bin")
+	_ = os.Mkdir(bin, 0700)
+	err = ioutil.WriteFile(filepath.Join(dir, "plain.yaml"), plain, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(bin, sopsCommand), []byte("#!/bin/sh\ncat "+filepath.Join(dir, "plain.yaml")+"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	pb, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pb.CertificateTasks[0].Name != "web" {
+		t.Fatalf("unexpected playbook %+v", pb)
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	r := NewRunner(pb)
+	r.Log = func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) }
+
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"cert.pem", "key.pem", "reloaded"} {
+		if _, err = os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := readCertificate(filepath.Join(dir, "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs = nil
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 0 {
+		t.Fatalf("valid certificate shouldn't be renewed: %v", logs)
+	}
+
+	r.Now = func() time.Time { return cert.NotAfter.Add(-24 * time.Hour) }
+	r.Playbook.CertificateTasks[0].Request.Subject.CommonName = "localhost"
+	r.Playbook.CertificateTasks[0].Request.SANs.DNS = nil
+	r.Playbook.CertificateTasks[0].PreValidate = &PreValidation{Addresses: []string{"192.0.2.1"}}
+	err = r.RunOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "which is not an expected address") {
+		t.Fatalf("expected pre-validation error, got %v", err)
+	}
+
+	logs = nil
+	r.Playbook.CertificateTasks[0].PreValidate.Addresses = []string{"127.0.0.0/8", "::1"}
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 || !strings.HasPrefix(logs[0], "renewing certificate web") {
+		t.Fatalf("expiring certificate should be renewed: %v", logs)
+	}
+}
+
+func TestRunOnceTaskConnections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(`
+config:
+  connection:
+    type: fake
+  connections:
+    public:
+      type: fake
+    unreachable:
+      type: fake
+      trustBundle: %[1]s/missing.pem
+certificateTasks:
+  - name: internal
+    request:
+      subject:
+        commonName: internal.example.com
+    installations: [{type: pem, file: %[1]s/internal.pem}]
+  - name: public
+    connection: public
+    request:
+      subject:
+        commonName: www.example.com
+    installations: [{type: pem, file: %[1]s/public.pem}]
+  - name: legacy
+    connection: unreachable
+    request:
+      subject:
+        commonName: legacy.example.com
+    installations: [{type: pem, file: %[1]s/legacy.pem}]
+`, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewRunner(pb).RunOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "1 certificate task(s) failed: legacy: ") {
+		t.Fatalf("expected the legacy task to fail alone, got %v", err)
+	}
+	for _, f := range []string{"internal.pem", "public.pem"} {
+		if _, err = os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(pb)
+
+	err = r.RunTask(context.Background(), "missing")
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error for an unknown task, got %v", err)
+	}
+	err = r.RunTask(context.Background(), pb.CertificateTasks[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "cert.pem")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunOnceLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb.CertificateTasks[0].Lint = &Lint{ExtKeyUsages: []string{"codeSigning"}}
+	var logs []string
+	r := NewRunner(pb)
+	r.Log = func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) }
+
+	err = r.RunOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "certificate failed lint checks: e_sub_cert_eku_expected_missing") {
+		t.Fatalf("expected a lint error, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "cert.pem")); !os.IsNotExist(err) {
+		t.Fatal("a certificate failing lint shouldn't be installed")
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "certificate web: lint error: e_sub_cert_eku_expected_missing") {
+		t.Fatalf("expected the lint error to be logged: %v", logs)
+	}
+
+	pb.CertificateTasks[0].Lint.ExtKeyUsages = []string{"serverAuth"}
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "cert.pem")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunOnceLocked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb.Config.Lock = &Lock{Dir: filepath.Join(dir, "locks"), Timeout: "100ms"}
+
+	// another process renewing the same certificate
+	unlock, err := lock.NewFileLocker(pb.Config.Lock.Dir).Lock(context.Background(), filepath.Join(dir, "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(pb)
+	err = r.RunOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "is held by another process") {
+		t.Fatalf("expected lock error, got %v", err)
+	}
+
+	if err = unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "cert.pem")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type spanNames []string
+
+func (n *spanNames) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+	*n = append(*n, name)
+	return tracing.Noop.Start(ctx, name)
+}
+
+func TestRunOnceTraced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := &spanNames{}
+	r := NewRunner(pb)
+	r.Tracer = names
+	if err = r.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{tracing.SpanRun, tracing.SpanTask, tracing.SpanEnroll, tracing.SpanPoll, tracing.SpanInstall}
+	if strings.Join(*names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected spans %v, got %v", expected, *names)
+	}
+}
+
+func TestRunOncePrefersRenewalWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(pb)
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := readCertificate(filepath.Join(dir, "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the static threshold would renew right away, the fake connector suggests the last third of the lifetime
+	pb.CertificateTasks[0].RenewBefore = "89d"
+	var logs []string
+	r.Log = func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 0 {
+		t.Fatalf("certificate shouldn't be renewed before the suggested window: %v", logs)
+	}
+
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	r.Now = func() time.Time { return cert.NotBefore.Add(lifetime * 5 / 6) }
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 || !strings.Contains(logs[0], "suggested renewal window") {
+		t.Fatalf("certificate should be renewed in the suggested window: %v", logs)
+	}
+}
+
+func TestTaskLocation(t *testing.T) {
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, "/tmp") + `    location:
+      workload: nginx
+      ipAddress: 10.20.30.40
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &pb.CertificateTasks[0]
+	task.Installations[0].Endpoint = "www.example.com:443"
+	loc, err := task.location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+	if loc.Instance != hostname || loc.Workload != "nginx" || loc.IPAddress != "10.20.30.40" || !loc.Replace {
+		t.Fatalf("unexpected location %+v", loc)
+	}
+	if loc.TLSAddress != "www.example.com:443" || loc.InstallPath != "/tmp/cert.pem" {
+		t.Fatalf("expected the location of the first installation, got %+v", loc)
+	}
+
+	_, err = Parse([]byte(fmt.Sprintf(testPlaybook, "/tmp") + "    location: {ipAddress: web01}\n"))
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected user data error for an invalid IP address, got %v", err)
+	}
+}
+
+func TestRunOnceServiceInstallations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"ID":"web"}`))
+		}
+	}))
+	defer server.Close()
+
+	pb, err := Parse([]byte(fmt.Sprintf(`
+config:
+  connection:
+    type: fake
+certificateTasks:
+  - name: web
+    request:
+      subject:
+        commonName: www.example.com
+    installations:
+      - type: pem
+        file: %[1]s/cert.pem
+      - type: consul-kv
+        consulKV: {address: %[2]s, prefix: certs/web}
+        nomadJob: {address: %[2]s, job: web}
+`, dir, server.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	r := NewRunner(pb)
+	r.Log = func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"PUT /v1/txn", "GET /v1/job/web", "POST /v1/job/web"}
+	if strings.Join(requests, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("unexpected requests %v", requests)
+	}
+	if logs[len(logs)-1] != "installed certificate web to consul-kv:certs/web" {
+		t.Fatalf("unexpected logs %v", logs)
+	}
+}
+
+func TestIssuerPins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key, err := certificate.GenerateECDSAPrivateKey(certificate.EllipticCurveP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Another CA"},
+		NotBefore:             time.Now().AddDate(-1, 0, 0),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins := map[string]string{
+		"fake":    fake.CaCertPEM,
+		"another": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+	for name, pin := range pins {
+		if err = ioutil.WriteFile(filepath.Join(dir, name+".pem"), []byte(pin), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pb, err := Parse([]byte(fmt.Sprintf(testPlaybook, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(pb)
+	connector := fake.NewConnector(false, nil)
+	pb.Config.IssuerPins = map[string]string{"Other": filepath.Join(dir, "another.pem")}
+	if _, err = r.enroll(connector, &pb.CertificateTasks[0]); err != nil {
+		t.Fatalf("a zone that isn't pinned should be enrolled: %s", err)
+	}
+	pb.Config.IssuerPins["Default"] = filepath.Join(dir, "fake.pem")
+	if _, err = r.enroll(connector, &pb.CertificateTasks[0]); err != nil {
+		t.Fatalf("a certificate of the pinned CA should be enrolled: %s", err)
+	}
+	pb.Config.IssuerPins["Default"] = filepath.Join(dir, "another.pem")
+	if _, err = r.enroll(connector, &pb.CertificateTasks[0]); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("a certificate of another CA should be refused, got %v", err)
+	}
+}
@@ -0,0 +1,855 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4"
+	"github.com/Venafi/vcert/v4/pkg/ari"
+	"github.com/Venafi/vcert/v4/pkg/breaker"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/dns"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/installer"
+	"github.com/Venafi/vcert/v4/pkg/lint"
+	"github.com/Venafi/vcert/v4/pkg/lock"
+	"github.com/Venafi/vcert/v4/pkg/tracing"
+	"github.com/Venafi/vcert/v4/pkg/truststore"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	defaultRetrieveTimeout = 180 * time.Second
+	// renewalInfoCheckInterval is how often the renewal window is checked again when the server doesn't tell
+	renewalInfoCheckInterval = 6 * time.Hour
+	// rateLimitMaxWait bounds the time a task is paused when the platform rate limits the run
+	rateLimitMaxWait = 10 * time.Minute
+)
+
+// Runner executes the certificate tasks of a playbook
+type Runner struct {
+	Playbook *Playbook
+	// Log receives progress messages when it's set
+	Log func(format string, args ...interface{})
+	// Now returns the current time, it's time.Now when not set
+	Now func() time.Time
+	// Tracer traces the runs, the tasks and their connector calls and installations when it's set
+	Tracer tracing.Tracer
+	// Locker serializes the renewals of each certificate with other processes, e.g. with a distributed lock. It
+	// defaults to file locks in the lock directory of the playbook, when there's one.
+	Locker lock.Locker
+	// Checkpoint records the requests that weren't retrieved and the tasks an interrupted run didn't start when it's
+	// set. The pending requests it holds are retrieved instead of being requested again.
+	Checkpoint *Checkpoint
+	// Hostname picks the renewal jitter of the host, it's os.Hostname when not set
+	Hostname string
+
+	// schedules holds the renewal times picked in suggested windows, by certificate serial number
+	schedules map[string]*renewalSchedule
+	// breakers are kept between runs so an open circuit stays open, by connection name
+	breakers map[string]*breaker.Breaker
+}
+
+// runConnection is a connection of the playbook connected for a run
+type runConnection struct {
+	connector   endpoint.Connector
+	renewalInfo endpoint.RenewalInfoRetriever
+	err         error
+}
+
+type renewalSchedule struct {
+	info      *endpoint.RenewalInfo
+	renewAt   time.Time
+	nextCheck time.Time
+}
+
+// NewRunner returns a Runner for pb
+func NewRunner(pb *Playbook) *Runner {
+	return &Runner{Playbook: pb}
+}
+
+// RunOnce renews the certificates that are missing or about to expire and installs them. Every task is attempted
+// even when a previous one fails, the errors are returned together. When ctx is cancelled the task in progress is
+// finished and the remaining ones are skipped.
+func (r *Runner) RunOnce(ctx context.Context) (err error) {
+	ctx, span := tracing.OrNoop(r.Tracer).Start(ctx, tracing.SpanRun)
+	span.SetAttributes(tracing.Int(tracing.AttrTasks, len(r.Playbook.CertificateTasks)+len(r.Playbook.SSHHostTasks)))
+	defer func() { tracing.End(span, err) }()
+
+	// the connections are made when a task first needs them, a platform that can't be reached only fails the tasks
+	// using it
+	connections := make(map[string]*runConnection)
+	var failed []string
+	r.Checkpoint.setRemaining(nil)
+	for i := range r.Playbook.CertificateTasks {
+		if err = ctx.Err(); err != nil {
+			var remaining []string
+			for _, task := range r.Playbook.CertificateTasks[i:] {
+				remaining = append(remaining, task.Name)
+			}
+			r.Checkpoint.setRemaining(remaining)
+			return err
+		}
+		task := &r.Playbook.CertificateTasks[i]
+		c := r.taskConnection(connections, task.Connection)
+		err = c.err
+		if err == nil {
+			err = endpoint.RetryOnRateLimit(ctx, rateLimitMaxWait, func() error {
+				err := r.traceTask(ctx, c.connector, c.renewalInfo, task)
+				var rateLimited endpoint.ErrRateLimited
+				if errors.As(err, &rateLimited) {
+					r.logf("certificate task %s was rate limited, pausing", task.Name)
+				}
+				return err
+			})
+		}
+		if err != nil {
+			r.logf("certificate task %s failed: %s", task.Name, err)
+			failed = append(failed, fmt.Sprintf("%s: %s", task.Name, err))
+		}
+	}
+	for i := range r.Playbook.SSHHostTasks {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		task := &r.Playbook.SSHHostTasks[i]
+		c := r.taskConnection(connections, task.Connection)
+		err = c.err
+		if err == nil {
+			err = endpoint.RetryOnRateLimit(ctx, rateLimitMaxWait, func() error {
+				return r.runSSHHostTask(ctx, c.connector, task)
+			})
+		}
+		if err != nil {
+			r.logf("SSH host task %s failed: %s", task.Name, err)
+			failed = append(failed, fmt.Sprintf("%s: %s", task.Name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %d certificate task(s) failed: %s", verror.VcertError, len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// RunTask runs the certificate task called name alone, e.g. when the platform notifies that its certificate is
+// about to expire or that its pending request was approved. The certificate is renewed on the same conditions as
+// with RunOnce.
+func (r *Runner) RunTask(ctx context.Context, name string) error {
+	var task *CertificateTask
+	for i := range r.Playbook.CertificateTasks {
+		if r.Playbook.CertificateTasks[i].Name == name {
+			task = &r.Playbook.CertificateTasks[i]
+			break
+		}
+	}
+	if task == nil {
+		for i := range r.Playbook.SSHHostTasks {
+			if sshTask := &r.Playbook.SSHHostTasks[i]; sshTask.Name == name {
+				c := r.taskConnection(make(map[string]*runConnection), sshTask.Connection)
+				if c.err != nil {
+					return c.err
+				}
+				return endpoint.RetryOnRateLimit(ctx, rateLimitMaxWait, func() error {
+					return r.runSSHHostTask(ctx, c.connector, sshTask)
+				})
+			}
+		}
+		return fmt.Errorf("%w: no certificate task %q in the playbook", verror.UserDataError, name)
+	}
+	c := r.taskConnection(make(map[string]*runConnection), task.Connection)
+	if c.err != nil {
+		return c.err
+	}
+	return endpoint.RetryOnRateLimit(ctx, rateLimitMaxWait, func() error {
+		return r.traceTask(ctx, c.connector, c.renewalInfo, task)
+	})
+}
+
+// taskConnection returns the connection called name of a task, connecting to it when it's not in connections yet
+func (r *Runner) taskConnection(connections map[string]*runConnection, name string) *runConnection {
+	c, ok := connections[name]
+	if !ok {
+		c = &runConnection{}
+		c.connector, c.renewalInfo, c.err = r.runConnector(name)
+		connections[name] = c
+	}
+	return c
+}
+
+// runConnector connects to the platform of the connection called name through its circuit breaker, and returns
+// where the renewal windows are read from
+func (r *Runner) runConnector(name string) (endpoint.Connector, endpoint.RenewalInfoRetriever, error) {
+	conn := r.Playbook.connection(name)
+	if conn == nil {
+		return nil, nil, fmt.Errorf("%w: unknown connection %q", verror.UserDataError, name)
+	}
+	var connector endpoint.Connector
+	var err error
+	b := r.circuitBreaker(name, conn)
+	if b != nil {
+		err = b.Do(func() (err error) {
+			connector, err = connect(conn)
+			return err
+		})
+	} else {
+		connector, err = connect(conn)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var renewalInfo endpoint.RenewalInfoRetriever
+	if url := conn.RenewalInfoURL; url != "" {
+		renewalInfo = &ari.Client{URL: url}
+	} else if ri, ok := connector.(endpoint.RenewalInfoRetriever); ok {
+		renewalInfo = ri
+	}
+	if b != nil {
+		connector = breaker.NewConnector(connector, b)
+	}
+	return connector, renewalInfo, nil
+}
+
+func (r *Runner) traceTask(ctx context.Context, connector endpoint.Connector, renewalInfo endpoint.RenewalInfoRetriever, task *CertificateTask) (err error) {
+	if r.Tracer == nil {
+		return r.runTask(ctx, connector, renewalInfo, task)
+	}
+	ctx, span := r.Tracer.Start(ctx, tracing.SpanTask)
+	span.SetAttributes(
+		tracing.String(tracing.AttrTask, task.Name),
+		tracing.String(tracing.AttrZone, task.Request.Zone),
+		tracing.String(tracing.AttrCommonName, task.Request.Subject.CommonName),
+	)
+	defer func() { tracing.End(span, err) }()
+	return r.runTask(ctx, tracing.NewConnector(connector, r.Tracer).WithContext(ctx), renewalInfo, task)
+}
+
+func (r *Runner) runTask(ctx context.Context, connector endpoint.Connector, renewalInfo endpoint.RenewalInfoRetriever, task *CertificateTask) error {
+	task, err := r.resolveSANs(ctx, connector, task)
+	if err != nil {
+		return err
+	}
+	renew, reason, err := r.needsRenewal(task, renewalInfo)
+	if err != nil {
+		return err
+	}
+	if !renew {
+		return nil
+	}
+	if locker := r.locker(); locker != nil {
+		unlock, err := r.lock(ctx, locker, task.Installations[0].File)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				r.logf("failed to release the lock of certificate %s: %s", task.Name, err)
+			}
+		}()
+		// another process may have renewed the certificate while the lock was held
+		renew, reason, err = r.needsRenewal(task, renewalInfo)
+		if err != nil || !renew {
+			return err
+		}
+	}
+	r.logf("renewing certificate %s: %s", task.Name, reason)
+
+	if task.PreValidate != nil {
+		err = dns.PreValidate(ctx, nil, task.Request.names(), task.PreValidate.Addresses)
+		if err != nil {
+			return err
+		}
+	}
+	if c := task.CAACheck; c != nil {
+		checker := &dns.CAAChecker{Issuers: c.Issuers, Server: c.Server}
+		problems, err := checker.Check(ctx, task.Request.names())
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			r.logf("certificate %s: %s", task.Name, p)
+		}
+		if len(problems) > 0 && !c.Warn {
+			return problems[0]
+		}
+	}
+
+	pcc, err := r.enroll(connector, task)
+	if err != nil {
+		return err
+	}
+	err = r.lint(task, pcc)
+	if err != nil {
+		return err
+	}
+	for _, inst := range task.Installations {
+		inst, err = installation(task, inst, pcc)
+		if err != nil {
+			return err
+		}
+		err = r.traceInstall(ctx, inst, pcc)
+		if err != nil {
+			return err
+		}
+		r.logf("installed certificate %s to %s", task.Name, inst.target())
+	}
+	r.Checkpoint.renewed(task.Name, r.now())
+	return nil
+}
+
+// needsRenewal checks the certificate installed by the first installation of the task. The window suggested by
+// renewalInfo is preferred, renewBefore and renewAt are used when there's none.
+func (r *Runner) needsRenewal(task *CertificateTask, renewalInfo endpoint.RenewalInfoRetriever) (bool, string, error) {
+	threshold, err := task.renewalThreshold()
+	if err != nil {
+		return false, "", err
+	}
+	inst, err := task.installed(task.Installations[0])
+	if err != nil {
+		return false, "", err
+	}
+	cert, err := readCertificate(inst.File)
+	if os.IsNotExist(err) {
+		return true, "certificate is not installed", nil
+	}
+	if err != nil {
+		return true, fmt.Sprintf("installed certificate can't be read: %s", err), nil
+	}
+	if len(task.Request.SANs.Sources) > 0 {
+		if missing := missingNames(&task.Request, cert); len(missing) > 0 {
+			return true, "SAN sources added " + strings.Join(missing, ", "), nil
+		}
+		if extra := extraNames(&task.Request, cert); len(extra) > 0 {
+			return true, "SAN sources removed DNS name(s) " + strings.Join(extra, ", "), nil
+		}
+	}
+	if renewalInfo != nil {
+		if s := r.renewalSchedule(task, cert, renewalInfo); s != nil {
+			if !r.now().Before(s.renewAt) {
+				reason := fmt.Sprintf("suggested renewal window started on %s", s.info.SuggestedWindowStart.Format(time.RFC3339))
+				if s.info.ExplanationURL != "" {
+					reason += ", see " + s.info.ExplanationURL
+				}
+				return true, reason, nil
+			}
+			return false, "", nil
+		}
+	}
+	if !r.now().Before(r.renewAt(threshold, task.jitterKey(), cert.NotBefore, cert.NotAfter)) {
+		return true, fmt.Sprintf("certificate expires on %s", cert.NotAfter.Format(time.RFC3339)), nil
+	}
+	return false, "", nil
+}
+
+// renewAt returns when the certificate valid from notBefore to notAfter is renewed on this host: at its threshold,
+// brought forward by the jitter of the host for key. The jitter is at most half the time between notBefore and the
+// threshold so that a renewed certificate isn't due right away.
+func (r *Runner) renewAt(threshold renewalThreshold, key string, notBefore, notAfter time.Time) time.Time {
+	at := threshold.renewAt(notBefore, notAfter)
+	max, err := r.Playbook.Config.renewalJitter()
+	if err != nil || max <= 0 {
+		return at
+	}
+	if half := at.Sub(notBefore) / 2; half < max {
+		max = half
+	}
+	if max <= 0 {
+		return at
+	}
+	hostname := r.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	sum := sha256.Sum256([]byte(hostname + "\x00" + key))
+	return at.Add(-time.Duration(binary.BigEndian.Uint64(sum[:8]) % uint64(max)))
+}
+
+// renewalSchedule returns the renewal time picked in the window suggested for cert, or nil when no window is
+// known. The window is checked again once the delay asked by the server has passed, and a new time is picked
+// only when the window changes.
+func (r *Runner) renewalSchedule(task *CertificateTask, cert *x509.Certificate, renewalInfo endpoint.RenewalInfoRetriever) *renewalSchedule {
+	if r.schedules == nil {
+		r.schedules = make(map[string]*renewalSchedule)
+	}
+	serial := cert.SerialNumber.Text(16)
+	s := r.schedules[serial]
+	now := r.now()
+	if s != nil && now.Before(s.nextCheck) {
+		return s
+	}
+	info, err := renewalInfo.RetrieveRenewalInfo(cert)
+	if err != nil {
+		r.logf("failed to retrieve renewal information for certificate %s: %s", task.Name, err)
+		return s
+	}
+	if s == nil || !info.SuggestedWindowStart.Equal(s.info.SuggestedWindowStart) || !info.SuggestedWindowEnd.Equal(s.info.SuggestedWindowEnd) {
+		s = &renewalSchedule{info: info, renewAt: info.RenewalTime()}
+		r.schedules[serial] = s
+	}
+	retryAfter := info.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = renewalInfoCheckInterval
+	}
+	s.nextCheck = now.Add(retryAfter)
+	return s
+}
+
+func (r *Runner) enroll(connector endpoint.Connector, task *CertificateTask) (*certificate.PEMCollection, error) {
+	req, err := task.Request.certificateRequest()
+	if err != nil {
+		return nil, err
+	}
+	req.Location, err = task.location()
+	if err != nil {
+		return nil, err
+	}
+	connector.SetZone(task.Request.Zone)
+	resumed, err := r.Checkpoint.restore(task.Name, req)
+	if err != nil {
+		return nil, err
+	}
+	if resumed {
+		r.logf("resuming the request of certificate %s: %s", task.Name, req.PickupID)
+	} else {
+		err = connector.GenerateRequest(nil, req)
+		if err != nil {
+			return nil, err
+		}
+		if task.Request.PublicCA {
+			err = req.CheckBaselineRequirements()
+			if err != nil {
+				return nil, err
+			}
+		}
+		req.PickupID, err = connector.RequestCertificate(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Timeout = defaultRetrieveTimeout
+	pcc, err := connector.RetrieveCertificate(req)
+	if err != nil {
+		if cpErr := r.Checkpoint.add(task, req, err, r.now()); cpErr != nil {
+			r.logf("%s", cpErr)
+		}
+		return nil, err
+	}
+	r.Checkpoint.done(task.Name)
+	if req.CsrOrigin != certificate.ServiceGeneratedCSR && req.PrivateKey != nil {
+		err = pcc.AddPrivateKey(req.PrivateKey, []byte(req.KeyPassword))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !task.SkipPossessionCheck {
+		err = pcc.VerifyPossession([]byte(req.KeyPassword))
+		if err != nil {
+			return nil, err
+		}
+	}
+	pinned, err := r.Playbook.Config.pinnedIssuers(task.Request.Zone)
+	if err != nil {
+		return nil, err
+	}
+	if pinned != nil {
+		err = pcc.VerifyIssuer(pinned)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pcc, nil
+}
+
+// lint checks the issued certificate of a task with Lint, the findings are logged and errors stop the installation
+func (r *Runner) lint(task *CertificateTask, pcc *certificate.PEMCollection) error {
+	if task.Lint == nil {
+		return nil
+	}
+	opts, err := task.Lint.options()
+	if err != nil {
+		return err
+	}
+	opts.Now = r.now()
+	findings, err := lint.PEM([]byte(pcc.Certificate), opts)
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		r.logf("certificate %s: lint %s", task.Name, f)
+	}
+	return lint.Err(findings)
+}
+
+func (r *Runner) traceInstall(ctx context.Context, inst Installation, pcc *certificate.PEMCollection) (err error) {
+	ctx, span := tracing.OrNoop(r.Tracer).Start(ctx, tracing.SpanInstall)
+	span.SetAttributes(tracing.String(tracing.AttrFile, inst.target()))
+	defer func() { tracing.End(span, err) }()
+	return install(ctx, inst, pcc)
+}
+
+func (r *Runner) locker() lock.Locker {
+	if r.Locker != nil {
+		return r.Locker
+	}
+	if l := r.Playbook.Config.Lock; l != nil {
+		return lock.NewFileLocker(l.Dir)
+	}
+	return nil
+}
+
+// lock locks the certificate installed to file, the file of the first installation of a task, so playbooks
+// installing the same files share the lock
+func (r *Runner) lock(ctx context.Context, locker lock.Locker, file string) (func() error, error) {
+	timeout := defaultLockTimeout
+	if l := r.Playbook.Config.Lock; l != nil {
+		timeout, _ = l.timeout()
+	}
+	name, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return locker.Lock(ctx, name)
+}
+
+func connect(conn *Connection) (endpoint.Connector, error) {
+	cfg, err := conn.vcertConfig()
+	if err != nil {
+		return nil, err
+	}
+	return vcert.NewClient(cfg)
+}
+
+// circuitBreaker returns the circuit breaker of the connection called name, nil when it has none
+func (r *Runner) circuitBreaker(name string, conn *Connection) *breaker.Breaker {
+	cb := conn.CircuitBreaker
+	if cb == nil {
+		return nil
+	}
+	if r.breakers == nil {
+		r.breakers = make(map[string]*breaker.Breaker)
+	}
+	if r.breakers[name] == nil {
+		label := conn.Type
+		if name != "" {
+			label = fmt.Sprintf("connection %s", name)
+		}
+		cooldown, _ := parseDuration(cb.Cooldown)
+		r.breakers[name] = &breaker.Breaker{
+			Threshold: cb.Threshold,
+			Cooldown:  cooldown,
+			OnStateChange: func(from, to breaker.State) {
+				r.logf("circuit breaker for %s is %s", label, to)
+			},
+		}
+	}
+	return r.breakers[name]
+}
+
+func (r *Runner) logf(format string, args ...interface{}) {
+	if r.Log != nil {
+		r.Log(format, args...)
+	}
+}
+
+func (r *Runner) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+func (c *Connection) vcertConfig() (*vcert.Config, error) {
+	cfg := &vcert.Config{BaseUrl: c.URL, Credentials: &endpoint.Authentication{}}
+	switch strings.ToLower(c.Type) {
+	case ConnectionTypeTPP:
+		cfg.ConnectorType = endpoint.ConnectorTypeTPP
+	case ConnectionTypeVaaS:
+		cfg.ConnectorType = endpoint.ConnectorTypeCloud
+	case ConnectionTypeFake:
+		cfg.ConnectorType = endpoint.ConnectorTypeFake
+	default:
+		return nil, fmt.Errorf("%w: unknown connection type %q", verror.UserDataError, c.Type)
+	}
+
+	secrets := []struct {
+		value  string
+		target *string
+	}{
+		{c.Credentials.APIKey, &cfg.Credentials.APIKey},
+		{c.Credentials.AccessToken, &cfg.Credentials.AccessToken},
+		{c.Credentials.User, &cfg.Credentials.User},
+		{c.Credentials.Password, &cfg.Credentials.Password},
+	}
+	for _, s := range secrets {
+		v, err := resolveSecret(s.value)
+		if err != nil {
+			return nil, err
+		}
+		*s.target = v
+	}
+
+	if c.TrustBundle != "" {
+		data, err := ioutil.ReadFile(c.TrustBundle)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read trust bundle: %s", verror.UserDataError, err)
+		}
+		cfg.ConnectionTrust = string(data)
+	}
+	return cfg, nil
+}
+
+func (req *Request) certificateRequest() (*certificate.Request, error) {
+	r := &certificate.Request{}
+	r.Subject.CommonName = req.Subject.CommonName
+	r.KeepUnicodeCommonName = req.Subject.KeepUnicode
+	if req.Subject.Organization != "" {
+		r.Subject.Organization = []string{req.Subject.Organization}
+	}
+	r.Subject.OrganizationalUnit = req.Subject.OrgUnits
+	if req.Subject.Locality != "" {
+		r.Subject.Locality = []string{req.Subject.Locality}
+	}
+	if req.Subject.Province != "" {
+		r.Subject.Province = []string{req.Subject.Province}
+	}
+	if req.Subject.Country != "" {
+		r.Subject.Country = []string{req.Subject.Country}
+	}
+
+	r.DNSNames = req.SANs.DNS
+	r.EmailAddresses = req.SANs.Email
+	for _, s := range req.SANs.IP {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("%w: invalid IP address SAN %q", verror.UserDataError, s)
+		}
+		r.IPAddresses = append(r.IPAddresses, ip)
+	}
+	for _, s := range req.SANs.URI {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid URI SAN %q", verror.UserDataError, s)
+		}
+		r.URIs = append(r.URIs, u)
+	}
+
+	if req.KeyType != "" {
+		err := r.KeyType.Set(req.KeyType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.KeyLength = req.KeySize
+	if req.KeyCurve != "" {
+		curve, err := certificate.ParseEllipticCurve(req.KeyCurve)
+		if err != nil {
+			return nil, err
+		}
+		r.KeyCurve = curve
+	}
+	keyPassword, err := resolveSecret(req.KeyPassword)
+	if err != nil {
+		return nil, err
+	}
+	r.KeyPassword = keyPassword
+	if strings.EqualFold(req.CsrOrigin, "service") {
+		r.CsrOrigin = certificate.ServiceGeneratedCSR
+	}
+	r.ChainOption = certificate.ChainOptionFromString(req.ChainOption)
+	r.ChainPreference, err = certificate.ChainPreferenceFromString(req.ChainPreference)
+	if err != nil {
+		return nil, err
+	}
+	r.ChainRoot = req.ChainRoot
+	r.ValidityHours = req.ValidDays * 24
+	for name, value := range req.Fields {
+		r.CustomFields = append(r.CustomFields, certificate.CustomField{Name: name, Value: value})
+	}
+	return r, nil
+}
+
+// location returns where the certificate is placed on the platform, completed with the host name and the first
+// installation
+func (task *CertificateTask) location() (*certificate.Location, error) {
+	if task.Location == nil {
+		return nil, nil
+	}
+	loc := &certificate.Location{
+		Instance:    task.Location.Instance,
+		Workload:    task.Location.Workload,
+		TLSAddress:  task.Location.TLSAddress,
+		IPAddress:   task.Location.IPAddress,
+		InstallPath: task.Location.InstallPath,
+		Replace:     true,
+	}
+	if loc.Instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the host name for the location: %s", err)
+		}
+		loc.Instance = hostname
+	}
+	if len(task.Installations) > 0 {
+		if loc.TLSAddress == "" {
+			loc.TLSAddress = task.Installations[0].Endpoint
+		}
+		if loc.InstallPath == "" {
+			loc.InstallPath = task.Installations[0].File
+		}
+	}
+	return loc, nil
+}
+
+// names returns the DNS names the certificate is requested for
+func (req *Request) names() []string {
+	var names []string
+	if req.Subject.CommonName != "" {
+		names = append(names, req.Subject.CommonName)
+	}
+	for _, n := range req.SANs.DNS {
+		if n != req.Subject.CommonName {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func install(ctx context.Context, inst Installation, pcc *certificate.PEMCollection) error {
+	err := inst.installer().Install(ctx, pcc)
+	if err != nil {
+		return err
+	}
+	if n := inst.NomadJob; n != nil {
+		job := &installer.NomadJob{Address: n.Address, Token: n.Token, Namespace: n.Namespace, Job: n.Job}
+		err = job.Update(ctx, pcc)
+		if err != nil {
+			return err
+		}
+	}
+	return afterInstall(ctx, inst.AfterInstallAction, inst.Signal)
+}
+
+// installer returns the installer of the type of the installation
+func (inst Installation) installer() installer.Installer {
+	switch inst.Type {
+	case InstallationTypeDockerSecret:
+		d := inst.DockerSecret
+		return &installer.DockerSecretInstaller{SecretName: d.Name, Host: d.Host, Services: d.Services, Labels: d.Labels}
+	case InstallationTypeOCI:
+		o := inst.OCI
+		return &installer.OCIInstaller{Reference: o.Reference, Username: o.Username, Password: o.Password, IncludeKey: o.IncludeKey, PlainHTTP: o.PlainHTTP}
+	case InstallationTypeConsulKV:
+		c := inst.ConsulKV
+		return &installer.ConsulKVInstaller{Address: c.Address, Token: c.Token, Prefix: c.Prefix, Datacenter: c.Datacenter}
+	case InstallationTypeVaultKV:
+		v := inst.VaultKV
+		return &installer.VaultKVInstaller{Address: v.Address, Token: v.Token, Namespace: v.Namespace, Mount: v.Mount, Path: v.Path, Version: v.Version}
+	case InstallationTypePostgreSQL:
+		p := inst.PostgreSQL
+		if p == nil {
+			p = &PostgreSQL{}
+		}
+		return &installer.PostgreSQLInstaller{CertFile: inst.File, KeyFile: inst.KeyFile, CAFile: inst.ChainFile,
+			Owner: p.Owner, ConfigFile: p.ConfigFile, DataDir: p.DataDir, PgCtl: p.PgCtl}
+	case InstallationTypeMySQL:
+		m := inst.MySQL
+		if m == nil {
+			m = &MySQL{}
+		}
+		return &installer.MySQLInstaller{CertFile: inst.File, KeyFile: inst.KeyFile, CAFile: inst.ChainFile,
+			Owner: m.Owner, ConfigFile: m.ConfigFile, DefaultsFile: m.DefaultsFile, MariaDB: m.MariaDB, Client: m.Client}
+	case InstallationTypeTruststore:
+		ti := &installer.TruststoreInstaller{File: inst.File}
+		if t := inst.Truststore; t != nil {
+			// the format was validated with the playbook
+			ti.Format, _ = truststore.ParseFormat(t.Format)
+			ti.Password = t.Password
+			ti.AliasPrefix = t.AliasPrefix
+		}
+		return ti
+	case InstallationTypeRADIUS:
+		ri := &installer.RADIUSInstaller{Dir: inst.File}
+		if r := inst.RADIUS; r != nil {
+			ri.Server, _ = installer.ParseRADIUSServer(r.Server)
+			ri.Owner = r.Owner
+			ri.Password = r.Password
+			ri.DHParams = r.DHParams
+		} else {
+			ri.Server = installer.RADIUSFreeRADIUS
+		}
+		return ri
+	default:
+		return &installer.FileInstaller{CertFile: inst.File, ChainFile: inst.ChainFile, KeyFile: inst.KeyFile}
+	}
+}
+
+// target is where the installation puts the certificate, for logs
+func (inst Installation) target() string {
+	if inst.Type == InstallationTypePEM {
+		return inst.File
+	}
+	return inst.installer().Name()
+}
+
+// afterInstall runs the shell command action and sends signal, when they're set, once the files are written
+func afterInstall(ctx context.Context, action string, signal *Signal) error {
+	if action != "" {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", action)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", action)
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("after install action failed: %s: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	if signal != nil {
+		return signal.send(ctx)
+	}
+	return nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return certificate.ParseCertificate(b.Bytes)
+}
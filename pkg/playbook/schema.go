@@ -0,0 +1,168 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Venafi/vcert/v4/pkg/util"
+)
+
+var (
+	unknownFieldRegexp = regexp.MustCompile(`^line (\d+): field (\S+) not found in type (\S+)$`)
+	taskNameRegexp     = regexp.MustCompile(`(?:certificate|SSH host) task "([^"]+)"`)
+)
+
+// schemaKeys are the keys of the objects of a playbook, by the Go type name yaml reports
+var schemaKeys = func() map[string][]string {
+	keys := make(map[string][]string)
+	collectKeys(reflect.TypeOf(Playbook{}), keys)
+	return keys
+}()
+
+func collectKeys(t reflect.Type, keys map[string][]string) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		collectKeys(t.Elem(), keys)
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+	if _, ok := keys[t.String()]; ok {
+		return
+	}
+	keys[t.String()] = nil
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		keys[t.String()] = append(keys[t.String()], name)
+		collectKeys(f.Type, keys)
+	}
+}
+
+// unmarshalDocuments parses the YAML documents of a playbook file rejecting the unknown keys, which are most likely
+// misspelled. The errors tell the line of each problem in the file, and the key meant when an unknown key is close to
+// a known one. Empty documents are skipped.
+func unmarshalDocuments(data []byte) ([]*Playbook, error) {
+	var docs []*Playbook
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.SetStrict(true)
+	for {
+		pb := &Playbook{}
+		err := d.Decode(pb)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, strictError(err)
+		}
+		if !reflect.ValueOf(*pb).IsZero() {
+			docs = append(docs, pb)
+		}
+	}
+}
+
+func strictError(err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+	problems := make([]string, len(typeErr.Errors))
+	for i, e := range typeErr.Errors {
+		problems[i] = e
+		m := unknownFieldRegexp.FindStringSubmatch(e)
+		if m == nil {
+			continue
+		}
+		problems[i] = fmt.Sprintf("line %s: unknown key %q", m[1], m[2])
+		if s := util.Suggest(m[2], schemaKeys[m[3]]); s != "" {
+			problems[i] += fmt.Sprintf(", did you mean %q?", s)
+		}
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// lineError adds the line of a certificate task to the message of an error, errors.Is still sees the original error
+type lineError struct {
+	err error
+	msg string
+}
+
+func (e *lineError) Error() string {
+	return e.msg
+}
+
+func (e *lineError) Unwrap() error {
+	return e.err
+}
+
+// withTaskLine tells where the task is defined in an error about a certificate task, locate returns e.g. "line 10"
+// for the name of a task, or "" when it's not known
+func withTaskLine(err error, locate func(name string) string) error {
+	m := taskNameRegexp.FindStringSubmatchIndex(err.Error())
+	if m == nil {
+		return err
+	}
+	msg := err.Error()
+	location := locate(msg[m[2]:m[3]])
+	if location == "" {
+		return err
+	}
+	return &lineError{err: err, msg: fmt.Sprintf("%s (%s)%s", msg[:m[1]], location, msg[m[1]:])}
+}
+
+// taskLine returns the line number of the name of the certificate task called name, 0 when it's not found
+func taskLine(data []byte, name string) int {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		line = strings.TrimSpace(strings.TrimPrefix(line, "-"))
+		if !strings.HasPrefix(line, "name:") {
+			continue
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(line, "name:"))
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, "'")
+		}
+		if value == name {
+			return n
+		}
+	}
+	return 0
+}
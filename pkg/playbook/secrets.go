@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Venafi/vcert/v4/pkg/age"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	sopsCommand      = "sops"
+	credentialPrefix = "credential:"
+	// credentialsDirectoryEnv is set by systemd for units using LoadCredential= or SetCredential=
+	credentialsDirectoryEnv = "CREDENTIALS_DIRECTORY"
+)
+
+// resolveSecret returns value unchanged, unless it references a systemd credential ("credential:<name>") in which
+// case the content of the credential is returned. This keeps secrets out of the playbook and out of the unit's
+// environment. A value encrypted with age and armored is decrypted with the identities of $SOPS_AGE_KEY or
+// $SOPS_AGE_KEY_FILE, so the playbook can be committed with its secrets.
+func resolveSecret(value string) (string, error) {
+	if age.IsEncrypted([]byte(value)) {
+		ids, err := age.IdentitiesFromEnv()
+		if err != nil {
+			return "", err
+		}
+		plaintext, err := age.Decrypt([]byte(value), ids...)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt secret: %w", err)
+		}
+		return strings.TrimRight(string(plaintext), "\r\n"), nil
+	}
+	if !strings.HasPrefix(value, credentialPrefix) {
+		return value, nil
+	}
+	name := strings.TrimPrefix(value, credentialPrefix)
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%w: invalid credential name %q", verror.UserDataError, name)
+	}
+	dir := os.Getenv(credentialsDirectoryEnv)
+	if dir == "" {
+		return "", fmt.Errorf("%w: credential %q is referenced but $%s is not set", verror.UserDataError, name, credentialsDirectoryEnv)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to read credential %q: %s", verror.UserDataError, name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// decryptPlaybook decrypts a playbook file encrypted with age, or with SOPS in which case the sops command does the
+// decryption so all its key services are supported. Other playbooks are returned unchanged.
+func decryptPlaybook(path string, data []byte) ([]byte, error) {
+	if age.IsEncrypted(data) {
+		ids, err := age.IdentitiesFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := age.Decrypt(data, ids...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt playbook: %w", err)
+		}
+		return plaintext, nil
+	}
+	if !isSOPS(data) {
+		return data, nil
+	}
+	sops, err := exec.LookPath(sopsCommand)
+	if err != nil {
+		return nil, fmt.Errorf("%w: playbook is encrypted with SOPS but the %s command was not found", verror.UserDataError, sopsCommand)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(sops, "--decrypt", "--input-type", "yaml", "--output-type", "yaml", path)
+	cmd.Stderr = &stderr
+	plaintext, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt playbook with SOPS: %s: %s", verror.UserDataError, err, strings.TrimSpace(stderr.String()))
+	}
+	return plaintext, nil
+}
+
+// isSOPS tells whether data is a YAML document encrypted by SOPS, which keeps its metadata under a top level
+// "sops" key
+func isSOPS(data []byte) bool {
+	var doc struct {
+		SOPS *struct {
+			MAC string `yaml:"mac"`
+		} `yaml:"sops"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	return doc.SOPS != nil && doc.SOPS.MAC != ""
+}
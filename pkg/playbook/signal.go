@@ -0,0 +1,145 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/hmacauth"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	defaultSignalName = "HUP"
+	signalHTTPTimeout = 10 * time.Second
+)
+
+// Signal tells the program using the certificate that its files changed. It's meant for sidecar deployments where
+// vcert writes to a volume shared with the main container: the process is found through a shared PID namespace,
+// or notified with an HTTP call. Exactly one of Process, PIDFile and URL is set.
+type Signal struct {
+	// Process is the name of the executable of the process to signal, it's only supported on Linux
+	Process string `yaml:"process,omitempty"`
+	// PIDFile contains the ID of the process to signal
+	PIDFile string `yaml:"pidFile,omitempty"`
+	// Name is the signal sent to the process, it defaults to HUP
+	Name string `yaml:"name,omitempty"`
+	// URL receives a POST request
+	URL string `yaml:"url,omitempty"`
+	// Secret signs the request to URL with the headers of package hmacauth, so the program can authenticate it and
+	// reject its replays
+	Secret string `yaml:"secret,omitempty"`
+}
+
+func (s *Signal) validate() error {
+	set := 0
+	for _, v := range []string{s.Process, s.PIDFile, s.URL} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%w: signal needs exactly one of process, pidFile and url", verror.UserDataError)
+	}
+	if s.Secret != "" && s.URL == "" {
+		return fmt.Errorf("%w: the secret of a signal signs its url request", verror.UserDataError)
+	}
+	if s.URL == "" {
+		if _, err := signalByName(s.name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Signal) name() string {
+	if s.Name == "" {
+		return defaultSignalName
+	}
+	return strings.TrimPrefix(strings.ToUpper(s.Name), "SIG")
+}
+
+// send delivers the signal, every process matching Process is signaled
+func (s *Signal) send(ctx context.Context) error {
+	if s.URL != "" {
+		return s.post(ctx)
+	}
+	sig, err := signalByName(s.name())
+	if err != nil {
+		return err
+	}
+	var pids []int
+	if s.PIDFile != "" {
+		data, err := ioutil.ReadFile(s.PIDFile)
+		if err != nil {
+			return fmt.Errorf("failed to read pid file: %s", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return fmt.Errorf("invalid pid file %s: %s", s.PIDFile, err)
+		}
+		pids = []int{pid}
+	} else {
+		pids, err = findProcesses(s.Process)
+		if err != nil {
+			return err
+		}
+		if len(pids) == 0 {
+			return fmt.Errorf("no process named %q found, is the PID namespace shared?", s.Process)
+		}
+	}
+	for _, pid := range pids {
+		p, err := os.FindProcess(pid)
+		if err == nil {
+			err = p.Signal(sig)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to send SIG%s to process %d: %s", s.name(), pid, err)
+		}
+	}
+	return nil
+}
+
+func (s *Signal) post(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, signalHTTPTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, nil)
+	if err != nil {
+		return err
+	}
+	if s.Secret != "" {
+		if err = hmacauth.Sign(req, nil, []byte(s.Secret)); err != nil {
+			return err
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to notify %s: %s", s.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to notify %s: unexpected status %s", s.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// findProcesses looks up /proc for the processes named name, other than the current one
+func findProcesses(name string) ([]int, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %s", err)
+	}
+	var pids []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		cmdline, _ := ioutil.ReadFile(filepath.Join("/proc", e.Name(), "cmdline"))
+		comm, _ := ioutil.ReadFile(filepath.Join("/proc", e.Name(), "comm"))
+		if processNamed(cmdline, comm, name) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// commLen is the length comm is truncated to by the kernel
+const commLen = 15
+
+// processNamed tells if a process is called name. The executable of the command line is checked first; comm
+// matches the processes which rewrite their command line, as long as name fits in it untruncated.
+func processNamed(cmdline, comm []byte, name string) bool {
+	if i := bytes.IndexByte(cmdline, 0); i >= 0 {
+		cmdline = cmdline[:i]
+	}
+	exe := ""
+	if len(cmdline) > 0 {
+		exe = filepath.Base(string(cmdline))
+	}
+	if exe == name {
+		return true
+	}
+	c := strings.TrimSpace(string(comm))
+	if len(name) > commLen || c != name {
+		return false
+	}
+	// a full comm cut from a longer executable name belongs to another process
+	if f := strings.Fields(exe); len(f) > 0 {
+		exe = strings.TrimSuffix(f[0], ":")
+	}
+	return len(c) < commLen || len(exe) <= commLen || !strings.HasPrefix(exe, c)
+}
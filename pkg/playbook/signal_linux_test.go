@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"testing"
+)
+
+func TestProcessNamed(t *testing.T) {
+	cases := []struct {
+		cmdline, comm, name string
+		match               bool
+	}{
+		{"/usr/sbin/nginx\x00-g\x00daemon off;\x00", "nginx\n", "nginx", true},
+		{"/opt/app/certificate-reloader\x00--watch\x00", "certificate-rel\n", "certificate-reloader", true},
+		{"/opt/app/certificate-reloader\x00", "certificate-rel\n", "certificate-rel", false},
+		{"cert-sidecar-01: worker\x00", "cert-sidecar-01\n", "cert-sidecar-01", true},
+		{"cert-sidecar-012: worker\x00", "cert-sidecar-01\n", "cert-sidecar-012", false},
+		{"nginx: master process /usr/sbin/nginx\x00", "nginx\n", "nginx", true},
+		{"/opt/app/certificate-reloaded\x00", "certificate-rel\n", "certificate-reloader", false},
+		{"", "", "nginx", false},
+	}
+	for _, c := range cases {
+		if got := processNamed([]byte(c.cmdline), []byte(c.comm), c.name); got != c.match {
+			t.Errorf("processNamed(%q, %q, %q) = %v, want %v", c.cmdline, c.comm, c.name, got, c.match)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func findProcesses(name string) ([]int, error) {
+	return nil, fmt.Errorf("%w: looking up processes by name is not supported on %s, use pidFile instead", verror.UserDataError, runtime.GOOS)
+}
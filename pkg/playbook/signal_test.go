@@ -0,0 +1,79 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/hmacauth"
+)
+
+func TestSignalValidate(t *testing.T) {
+	invalid := []Signal{{}, {Process: "nginx", URL: "http://localhost/reload"}, {Process: "nginx", Secret: "secret"}}
+	if runtime.GOOS != "windows" {
+		invalid = append(invalid, Signal{Process: "nginx", Name: "NOPE"})
+	}
+	for _, s := range invalid {
+		if s.validate() == nil {
+			t.Errorf("expected %+v to be invalid", s)
+		}
+	}
+	if err := (&Signal{URL: "http://localhost/reload"}).validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSidecarInstallNotifiesURL(t *testing.T) {
+	calls := make(chan string, 1)
+	verifier := &hmacauth.Verifier{Secret: []byte("secret")}
+	server := httptest.NewServer(verifier.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls <- r.Method
+	})))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := strings.Replace(fmt.Sprintf(testPlaybook, dir), "afterInstallAction: touch "+dir+"/reloaded",
+		"signal: {url: "+server.URL+", secret: secret}", 1)
+	pb, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewRunner(pb).RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-calls:
+		if m != http.MethodPost {
+			t.Fatalf("unexpected method %s", m)
+		}
+	default:
+		t.Fatal("reload URL wasn't called")
+	}
+}
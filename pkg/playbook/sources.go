@@ -0,0 +1,268 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/dns"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/kubernetes"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Kinds of the Kubernetes objects SANs are read from
+const (
+	KubernetesKindService = "service"
+	KubernetesKindIngress = "ingress"
+)
+
+// SANSource is where SANs are read from each time the task runs, so a certificate follows the names it serves.
+// Exactly one of File, DNSZone and Kubernetes is set.
+type SANSource struct {
+	// File holds a SAN per line, DNS names, IP addresses, email addresses or URIs. Lines starting with # are ignored.
+	File       string            `yaml:"file,omitempty"`
+	DNSZone    *DNSZoneSource    `yaml:"dnsZone,omitempty"`
+	Kubernetes *KubernetesSource `yaml:"kubernetes,omitempty"`
+}
+
+// DNSZoneSource enumerates the A, AAAA and CNAME names of a zone with a zone transfer from Server
+type DNSZoneSource struct {
+	Zone   string `yaml:"zone"`
+	Server string `yaml:"server"`
+	// Match keeps the names matching one of the patterns, e.g. "*.web.example.com", all the names by default
+	Match       []string `yaml:"match,omitempty"`
+	TSIGKeyName string   `yaml:"tsigKeyName,omitempty"`
+	TSIGSecret  string   `yaml:"tsigSecret,omitempty"`
+}
+
+// KubernetesSource reads the names of a Service or the hosts of an Ingress
+type KubernetesSource struct {
+	Kind string `yaml:"kind"`
+	Name string `yaml:"name"`
+	// Namespace is the namespace of the kubeconfig context or of the service account by default
+	Namespace string `yaml:"namespace,omitempty"`
+	// Kubeconfig is the kubeconfig file, the service account of the pod or ~/.kube/config by default
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// ClusterDomain is the DNS domain of the services of the cluster, cluster.local by default
+	ClusterDomain string `yaml:"clusterDomain,omitempty"`
+}
+
+func (s *SANSource) validate() error {
+	set := 0
+	if s.File != "" {
+		set++
+	}
+	if z := s.DNSZone; z != nil {
+		set++
+		if z.Zone == "" || z.Server == "" {
+			return fmt.Errorf("%w: DNS zone SAN source needs a zone and a server", verror.UserDataError)
+		}
+		if (z.TSIGKeyName == "") != (z.TSIGSecret == "") {
+			return fmt.Errorf("%w: DNS zone SAN source needs both a TSIG key name and secret", verror.UserDataError)
+		}
+		for _, pattern := range z.Match {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: invalid DNS zone match pattern %q", verror.UserDataError, pattern)
+			}
+		}
+	}
+	if k := s.Kubernetes; k != nil {
+		set++
+		switch strings.ToLower(k.Kind) {
+		case KubernetesKindService, KubernetesKindIngress:
+		default:
+			return fmt.Errorf("%w: unknown Kubernetes SAN source kind %q", verror.UserDataError, k.Kind)
+		}
+		if k.Name == "" {
+			return fmt.Errorf("%w: Kubernetes SAN source needs a name", verror.UserDataError)
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("%w: a SAN source needs exactly one of file, dnsZone and kubernetes", verror.UserDataError)
+	}
+	return nil
+}
+
+// read returns the SANs of the source
+func (s *SANSource) read(ctx context.Context) (SANs, error) {
+	var sans SANs
+	switch {
+	case s.File != "":
+		f, err := os.Open(s.File)
+		if err != nil {
+			return sans, fmt.Errorf("%w: failed to read SAN file: %s", verror.UserDataError, err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			switch {
+			case net.ParseIP(line) != nil:
+				sans.IP = append(sans.IP, line)
+			case strings.Contains(line, "://"):
+				sans.URI = append(sans.URI, line)
+			case strings.Contains(line, "@"):
+				sans.Email = append(sans.Email, line)
+			default:
+				sans.DNS = append(sans.DNS, line)
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return sans, fmt.Errorf("%w: failed to read SAN file: %s", verror.UserDataError, err)
+		}
+	case s.DNSZone != nil:
+		z := s.DNSZone
+		transfer := &dns.ZoneTransfer{Server: z.Server, Zone: z.Zone, TSIGKeyName: z.TSIGKeyName, TSIGSecret: z.TSIGSecret}
+		names, err := transfer.Names(ctx)
+		if err != nil {
+			return sans, fmt.Errorf("zone transfer of %s: %w", z.Zone, err)
+		}
+		for _, name := range names {
+			if len(z.Match) == 0 {
+				sans.DNS = append(sans.DNS, name)
+				continue
+			}
+			for _, pattern := range z.Match {
+				if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+					sans.DNS = append(sans.DNS, name)
+					break
+				}
+			}
+		}
+	case s.Kubernetes != nil:
+		k := s.Kubernetes
+		client, err := kubernetes.NewClient(k.Kubeconfig)
+		if err != nil {
+			return sans, err
+		}
+		if strings.ToLower(k.Kind) == KubernetesKindService {
+			svc, err := client.GetService(ctx, k.Namespace, k.Name)
+			if err != nil {
+				return sans, fmt.Errorf("service %s: %w", k.Name, err)
+			}
+			sans.DNS, sans.IP = svc.Names(k.ClusterDomain)
+		} else {
+			ing, err := client.GetIngress(ctx, k.Namespace, k.Name)
+			if err != nil {
+				return sans, fmt.Errorf("ingress %s: %w", k.Name, err)
+			}
+			sans.DNS = ing.Hosts()
+		}
+	}
+	return sans, nil
+}
+
+// resolveSANs returns the task with the SANs of its sources added to the listed ones, without duplicates. The
+// sourced DNS names the policy of the zone rejects are left out, so that a name added to the source by mistake
+// doesn't stop the renewal of the others. The task is returned as is when it has no sources.
+func (r *Runner) resolveSANs(ctx context.Context, connector endpoint.Connector, task *CertificateTask) (*CertificateTask, error) {
+	sources := task.Request.SANs.Sources
+	if len(sources) == 0 {
+		return task, nil
+	}
+	var sourced SANs
+	for i := range sources {
+		sans, err := sources[i].read(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("SAN source #%d of certificate %s: %w", i+1, task.Name, err)
+		}
+		sourced.DNS = append(sourced.DNS, sans.DNS...)
+		sourced.IP = append(sourced.IP, sans.IP...)
+		sourced.Email = append(sourced.Email, sans.Email...)
+		sourced.URI = append(sourced.URI, sans.URI...)
+	}
+	if len(sourced.DNS) > 0 {
+		connector.SetZone(task.Request.Zone)
+		policy, err := connector.ReadPolicyConfiguration()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the policy checking the sourced SANs of certificate %s: %w", task.Name, err)
+		}
+		allowed := sourced.DNS[:0]
+		for _, name := range sourced.DNS {
+			if err := policy.ValidateDNSNames([]string{name}); err != nil {
+				r.logf("leaving DNS name %s out of certificate %s: %s", name, task.Name, err)
+				continue
+			}
+			allowed = append(allowed, name)
+		}
+		sourced.DNS = allowed
+	}
+
+	resolved := *task
+	listed := task.Request.SANs
+	resolved.Request.SANs = SANs{
+		DNS:     uniqueNames(append(append([]string(nil), listed.DNS...), sourced.DNS...), true),
+		IP:      uniqueIPs(append(append([]string(nil), listed.IP...), sourced.IP...)),
+		Email:   uniqueNames(append(append([]string(nil), listed.Email...), sourced.Email...), true),
+		URI:     uniqueNames(append(append([]string(nil), listed.URI...), sourced.URI...), false),
+		Sources: sources,
+	}
+	if resolved.Request.Subject.CommonName == "" && len(resolved.Request.SANs.DNS) == 0 {
+		return nil, fmt.Errorf("%w: certificate %s has no common name and its SAN sources returned no DNS name", verror.UserDataError, task.Name)
+	}
+	return &resolved, nil
+}
+
+// uniqueNames removes the duplicates of names, ignoring the case when foldCase is set, and keeps the first of each
+func uniqueNames(names []string, foldCase bool) []string {
+	seen := make(map[string]bool, len(names))
+	unique := names[:0]
+	for _, n := range names {
+		key := n
+		if foldCase {
+			key = strings.ToLower(n)
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, n)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	return unique
+}
+
+// uniqueIPs removes the duplicates of ips, written in any form
+func uniqueIPs(ips []string) []string {
+	seen := make(map[string]bool, len(ips))
+	unique := ips[:0]
+	for _, s := range ips {
+		key := s
+		if ip := net.ParseIP(s); ip != nil {
+			key = ip.String()
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, s)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	return unique
+}
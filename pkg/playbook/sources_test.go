@@ -0,0 +1,153 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestSANSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/networking.k8s.io/v1/namespaces/web/ingresses/site" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"metadata":{"name":"site","namespace":"web"},
+			"spec":{"rules":[{"host":"WWW.example.com"},{"host":"shop.example.com"}]}}`))
+	}))
+	defer server.Close()
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	err = ioutil.WriteFile(kubeconfig, []byte(fmt.Sprintf(`
+current-context: test
+clusters: [{name: test, cluster: {server: %s}}]
+contexts: [{name: test, context: {cluster: test, namespace: web}}]
+`, server.URL)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sanFile := filepath.Join(dir, "sans.txt")
+	err = ioutil.WriteFile(sanFile, []byte("# web servers\nwww.example.com\napi.example.com\nwww*.example.com\n10.0.0.1\nspiffe://example.com/web\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pb, err := Parse([]byte(fmt.Sprintf(`
+config:
+  connection:
+    type: fake
+certificateTasks:
+  - name: web
+    request:
+      zone: Default
+      sans:
+        dns: [www.example.com]
+        ip: [10.0.0.1]
+        sources:
+          - file: %[1]s/sans.txt
+          - kubernetes: {kind: ingress, name: site, kubeconfig: %[1]s/kubeconfig}
+    installations:
+      - type: pem
+        file: %[1]s/cert.pem
+`, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	r := NewRunner(pb)
+	r.Log = func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := readCertificate(filepath.Join(dir, "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"www.example.com", "api.example.com", "shop.example.com"}
+	if !reflect.DeepEqual(cert.DNSNames, expected) || len(cert.IPAddresses) != 1 || len(cert.URIs) != 1 {
+		t.Fatalf("unexpected SANs %v %v %v", cert.DNSNames, cert.IPAddresses, cert.URIs)
+	}
+	if !strings.Contains(strings.Join(logs, "\n"), "leaving DNS name www*.example.com out of certificate web") {
+		t.Fatalf("the name rejected by the policy should be logged: %v", logs)
+	}
+
+	logs = nil
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(logs, "\n"), "renewing") {
+		t.Fatalf("certificate in sync with its sources shouldn't be renewed: %v", logs)
+	}
+
+	err = ioutil.WriteFile(sanFile, []byte("www.example.com\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs = nil
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) == 0 || logs[0] != "renewing certificate web: SAN sources removed DNS name(s) api.example.com" {
+		t.Fatalf("certificate should be renewed when a source drops a name: %v", logs)
+	}
+
+	r.Playbook.CertificateTasks[0].Request.SANs.Sources[1].Kubernetes.Name = "missing"
+	err = r.RunOnce(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "SAN source #2 of certificate web") {
+		t.Fatalf("expected a source error, got %v", err)
+	}
+}
+
+func TestSANSourceValidate(t *testing.T) {
+	for _, s := range []SANSource{
+		{},
+		{File: "sans.txt", DNSZone: &DNSZoneSource{Zone: "example.com", Server: "ns1.example.com"}},
+		{DNSZone: &DNSZoneSource{Zone: "example.com"}},
+		{DNSZone: &DNSZoneSource{Zone: "example.com", Server: "ns1.example.com", TSIGKeyName: "vcert"}},
+		{DNSZone: &DNSZoneSource{Zone: "example.com", Server: "ns1.example.com", Match: []string{"[web"}}},
+		{Kubernetes: &KubernetesSource{Kind: "pod", Name: "web"}},
+		{Kubernetes: &KubernetesSource{Kind: "service"}},
+	} {
+		if err := s.validate(); !errors.Is(err, verror.UserDataError) {
+			t.Fatalf("expected a user data error for %+v, got %v", s, err)
+		}
+	}
+	s := SANSource{DNSZone: &DNSZoneSource{Zone: "example.com", Server: "ns1.example.com", Match: []string{"*.web.example.com"}}}
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
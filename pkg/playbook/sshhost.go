@@ -0,0 +1,354 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/installer"
+	"github.com/Venafi/vcert/v4/pkg/util"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// SSH host key types
+const (
+	SSHKeyTypeED25519 = "ed25519"
+	SSHKeyTypeECDSA   = "ecdsa"
+	SSHKeyTypeRSA     = "rsa"
+
+	defaultSSHDConfig    = "/etc/ssh/sshd_config"
+	defaultSSHRSAKeySize = 3072
+)
+
+// SSHHostTask keeps an SSH host certificate of the host valid: the host key is certified by an SSH CA of the
+// platform for the principals clients connect to, the certificate is written next to the key, sshd_config is told
+// to present it and sshd is reloaded.
+//
+//	sshHostTasks:
+//	  - name: host
+//	    template: Host CA
+//	    principals: [web01.example.com, web01]
+//	    hostKey: /etc/ssh/ssh_host_ed25519_key
+//	    rotateKey: true
+//	    afterInstallAction: sshd -t && systemctl reload sshd
+type SSHHostTask struct {
+	Name string `yaml:"name"`
+	// Connection is the name of the connection of the config used by the task, the default connection when it's
+	// empty
+	Connection string `yaml:"connection,omitempty"`
+	// RenewBefore is how long before expiration the certificate is renewed, e.g. "7d". It defaults to 30 days.
+	RenewBefore string `yaml:"renewBefore,omitempty"`
+	// RenewAt is the share of the lifetime of the certificate after which it's renewed, e.g. "66%"
+	RenewAt string `yaml:"renewAt,omitempty"`
+	// Template is the SSH certificate issuing template of the platform, which must issue host certificates
+	Template string `yaml:"template"`
+	// KeyID identifies the certificate in the logs of sshd and of the platform, the host name by default
+	KeyID string `yaml:"keyId,omitempty"`
+	// Principals are the names clients connect to the host with, the host name by default
+	Principals []string `yaml:"principals,omitempty"`
+	// ValidityPeriod is requested when it's set, e.g. "720h", otherwise the template decides
+	ValidityPeriod string `yaml:"validityPeriod,omitempty"`
+	// HostKey is the private key file of the host key, e.g. /etc/ssh/ssh_host_ed25519_key. The public key is in
+	// HostKey.pub and the certificate is written to HostKey-cert.pub.
+	HostKey string `yaml:"hostKey"`
+	// KeyType is the type of a generated host key: ed25519 (default), ecdsa or rsa
+	KeyType string `yaml:"keyType,omitempty"`
+	// RotateKey generates a new host key on every renewal, otherwise the existing key is certified again and a key
+	// is only generated when there's none
+	RotateKey bool `yaml:"rotateKey,omitempty"`
+	// SSHDConfig is the sshd configuration the HostKey and HostCertificate lines are added to, /etc/ssh/sshd_config
+	// by default. "none" leaves the configuration alone.
+	SSHDConfig string `yaml:"sshdConfig,omitempty"`
+	// AfterInstallAction is a shell command run after the files are written, e.g. to reload sshd
+	AfterInstallAction string `yaml:"afterInstallAction,omitempty"`
+	// Signal notifies sshd once the files are written, e.g. with HUP
+	Signal *Signal `yaml:"signal,omitempty"`
+}
+
+func (task *SSHHostTask) validate() error {
+	if task.Template == "" {
+		return fmt.Errorf("%w: SSH host task %q: template is required", verror.UserDataError, task.Name)
+	}
+	if task.HostKey == "" {
+		return fmt.Errorf("%w: SSH host task %q: hostKey is required", verror.UserDataError, task.Name)
+	}
+	switch strings.ToLower(task.KeyType) {
+	case "", SSHKeyTypeED25519, SSHKeyTypeECDSA, SSHKeyTypeRSA:
+	default:
+		return fmt.Errorf("%w: SSH host task %q: unknown key type %q", verror.UserDataError, task.Name, task.KeyType)
+	}
+	if _, err := task.renewalThreshold(); err != nil {
+		return err
+	}
+	if task.Signal != nil {
+		if err := task.Signal.validate(); err != nil {
+			return fmt.Errorf("SSH host task %q: %w", task.Name, err)
+		}
+	}
+	return nil
+}
+
+func (task *SSHHostTask) renewalThreshold() (renewalThreshold, error) {
+	t, err := parseRenewalThreshold(task.RenewBefore, task.RenewAt)
+	if err != nil {
+		return t, fmt.Errorf("%w: SSH host task %q: %s", verror.UserDataError, task.Name, err)
+	}
+	return t, nil
+}
+
+func (task *SSHHostTask) installer() *installer.SSHHostInstaller {
+	si := &installer.SSHHostInstaller{KeyFile: task.HostKey, SSHDConfig: task.SSHDConfig}
+	switch task.SSHDConfig {
+	case "":
+		si.SSHDConfig = defaultSSHDConfig
+	case "none":
+		si.SSHDConfig = ""
+	}
+	return si
+}
+
+// keyIDAndPrincipals returns the key ID and the principals of the request, the host name by default
+func (task *SSHHostTask) keyIDAndPrincipals() (string, []string, error) {
+	keyID, principals := task.KeyID, task.Principals
+	if keyID == "" || len(principals) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", nil, err
+		}
+		if keyID == "" {
+			keyID = hostname
+		}
+		if len(principals) == 0 {
+			principals = []string{hostname}
+		}
+	}
+	return keyID, principals, nil
+}
+
+// runSSHHostTask renews the host certificate of task when it's missing, about to expire, for other principals or
+// for another key than the host key
+func (r *Runner) runSSHHostTask(ctx context.Context, connector endpoint.Connector, task *SSHHostTask) error {
+	renew, reason, err := r.sshHostNeedsRenewal(task)
+	if err != nil || !renew {
+		return err
+	}
+	if locker := r.locker(); locker != nil {
+		unlock, err := r.lock(ctx, locker, task.HostKey)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				r.logf("failed to release the lock of SSH host certificate %s: %s", task.Name, err)
+			}
+		}()
+		renew, reason, err = r.sshHostNeedsRenewal(task)
+		if err != nil || !renew {
+			return err
+		}
+	}
+	r.logf("renewing SSH host certificate %s: %s", task.Name, reason)
+
+	privateKey, publicKey, err := task.hostKey()
+	if err != nil {
+		return err
+	}
+	keyID, principals, err := task.keyIDAndPrincipals()
+	if err != nil {
+		return err
+	}
+	req := &certificate.SshCertRequest{
+		Template:       task.Template,
+		KeyId:          keyID,
+		Principals:     principals,
+		ValidityPeriod: task.ValidityPeriod,
+		PublicKeyData:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+		Timeout:        defaultRetrieveTimeout,
+	}
+	data, err := connector.RequestSSHCertificate(req)
+	if err != nil {
+		return err
+	}
+	if data.CertificateData == "" {
+		data, err = connector.RetrieveSSHCertificate(&certificate.SshCertRequest{PickupID: data.DN, Timeout: defaultRetrieveTimeout})
+		if err != nil {
+			return err
+		}
+	}
+	cert, err := parseSSHCertificate([]byte(data.CertificateData))
+	if err != nil {
+		return err
+	}
+	if cert.CertType != ssh.HostCert {
+		return fmt.Errorf("%w: template %q issued a user certificate instead of a host certificate", verror.UserDataError, task.Template)
+	}
+	if !bytes.Equal(cert.Key.Marshal(), publicKey.Marshal()) {
+		return fmt.Errorf("%w: the SSH certificate isn't for the host key", verror.ServerBadDataResponce)
+	}
+
+	var publicKeyData []byte
+	if privateKey != nil {
+		publicKeyData = ssh.MarshalAuthorizedKey(publicKey)
+	}
+	si := task.installer()
+	configured, err := si.Install(ctx, privateKey, publicKeyData, []byte(strings.TrimSpace(data.CertificateData)+"\n"))
+	if err != nil {
+		return err
+	}
+	if configured {
+		r.logf("added SSH host certificate %s to %s", task.Name, si.SSHDConfig)
+	}
+	err = afterInstall(ctx, task.AfterInstallAction, task.Signal)
+	if err != nil {
+		return err
+	}
+	r.logf("installed SSH host certificate %s to %s", task.Name, si.CertificateFile())
+	return nil
+}
+
+func (r *Runner) sshHostNeedsRenewal(task *SSHHostTask) (bool, string, error) {
+	threshold, err := task.renewalThreshold()
+	if err != nil {
+		return false, "", err
+	}
+	si := task.installer()
+	data, err := ioutil.ReadFile(si.CertificateFile())
+	if os.IsNotExist(err) {
+		return true, "certificate is not installed", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	cert, err := parseSSHCertificate(data)
+	if err != nil {
+		return true, fmt.Sprintf("installed certificate can't be read: %s", err), nil
+	}
+	notAfter := time.Unix(int64(cert.ValidBefore), 0)
+	if cert.ValidBefore != ssh.CertTimeInfinity && !r.now().Before(r.renewAt(threshold, task.Name, time.Unix(int64(cert.ValidAfter), 0), notAfter)) {
+		return true, fmt.Sprintf("certificate expires on %s", notAfter.Format(time.RFC3339)), nil
+	}
+	_, principals, err := task.keyIDAndPrincipals()
+	if err != nil {
+		return false, "", err
+	}
+	if !samePrincipals(cert.ValidPrincipals, principals) {
+		return true, fmt.Sprintf("certificate is for %s", strings.Join(cert.ValidPrincipals, ", ")), nil
+	}
+	if pub, err := readSSHPublicKey(si.PublicKeyFile()); err == nil && !bytes.Equal(pub.Marshal(), cert.Key.Marshal()) {
+		return true, "certificate isn't for the host key", nil
+	}
+	return false, "", nil
+}
+
+// hostKey returns the host key to certify. The private key is only returned when it's generated and must be written.
+func (task *SSHHostTask) hostKey() ([]byte, ssh.PublicKey, error) {
+	if !task.RotateKey {
+		data, err := ioutil.ReadFile(task.HostKey)
+		if err == nil {
+			signer, err := ssh.ParsePrivateKey(data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: failed to read host key %s: %s", verror.UserDataError, task.HostKey, err)
+			}
+			return nil, signer.PublicKey(), nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+	}
+	return generateSSHKey(task.KeyType)
+}
+
+// generateSSHKey returns a new private key in a format sshd reads, and its public key
+func generateSSHKey(keyType string) ([]byte, ssh.PublicKey, error) {
+	var key crypto.Signer
+	var err error
+	switch strings.ToLower(keyType) {
+	case "", SSHKeyTypeED25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case SSHKeyTypeECDSA:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case SSHKeyTypeRSA:
+		key, err = rsa.GenerateKey(rand.Reader, defaultSSHRSAKeySize)
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown SSH key type %q", verror.UserDataError, keyType)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := util.MarshalSshPrivateKey(key, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, pub, nil
+}
+
+func parseSSHCertificate(data []byte) (*ssh.Certificate, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid SSH certificate: %s", verror.ServerBadDataResponce, err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an SSH certificate", verror.ServerBadDataResponce)
+	}
+	return cert, nil
+}
+
+func readSSHPublicKey(path string) (ssh.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	return key, err
+}
+
+func samePrincipals(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+// sshCAConnector signs host certificates with a local CA
+type sshCAConnector struct {
+	*fake.Connector
+	ca       ssh.Signer
+	requests []*certificate.SshCertRequest
+}
+
+func (c *sshCAConnector) RequestSSHCertificate(req *certificate.SshCertRequest) (*certificate.SshCertificateObject, error) {
+	c.requests = append(c.requests, req)
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKeyData))
+	if err != nil {
+		return nil, err
+	}
+	cert := &ssh.Certificate{
+		Key:             key,
+		KeyId:           req.KeyId,
+		CertType:        ssh.HostCert,
+		ValidPrincipals: req.Principals,
+		ValidAfter:      uint64(time.Now().Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(time.Now().Add(90 * 24 * time.Hour).Unix()),
+	}
+	err = cert.SignCert(rand.Reader, c.ca)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate.SshCertificateObject{CertificateData: string(ssh.MarshalAuthorizedKey(cert))}, nil
+}
+
+func TestRunSSHHostTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &sshCAConnector{Connector: fake.NewConnector(false, nil), ca: ca}
+	sshdConfig := filepath.Join(dir, "sshd_config")
+	if err = ioutil.WriteFile(sshdConfig, []byte("PermitRootLogin no\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	task := SSHHostTask{
+		Name:               "host",
+		Template:           "Host CA",
+		Principals:         []string{"web01.example.com", "web01"},
+		HostKey:            filepath.Join(dir, "ssh_host_ed25519_key"),
+		SSHDConfig:         sshdConfig,
+		AfterInstallAction: "touch " + filepath.Join(dir, "reloaded"),
+	}
+	pb := &Playbook{SSHHostTasks: []SSHHostTask{task}}
+	if err = pb.SSHHostTasks[0].validate(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(pb)
+	ctx := context.Background()
+
+	if err = r.runSSHHostTask(ctx, conn, &pb.SSHHostTasks[0]); err != nil {
+		t.Fatal(err)
+	}
+	keyData, err := ioutil.ReadFile(task.HostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		t.Fatalf("the generated host key can't be read: %s", err)
+	}
+	certData, err := ioutil.ReadFile(task.HostKey + "-cert.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := parseSSHCertificate(certData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.Key.Marshal(), signer.PublicKey().Marshal()) || cert.KeyId == "" {
+		t.Fatalf("unexpected certificate %+v", cert)
+	}
+	config, _ := ioutil.ReadFile(sshdConfig)
+	if !strings.Contains(string(config), "HostKey "+task.HostKey+"\n") || !strings.Contains(string(config), "HostCertificate "+task.HostKey+"-cert.pub\n") {
+		t.Errorf("unexpected sshd configuration:\n%s", config)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "reloaded")); err != nil {
+		t.Errorf("sshd wasn't reloaded: %s", err)
+	}
+
+	// nothing to do while the certificate is valid
+	if err = r.runSSHHostTask(ctx, conn, &pb.SSHHostTasks[0]); err != nil || len(conn.requests) != 1 {
+		t.Fatalf("expected no renewal, got %d requests, %v", len(conn.requests), err)
+	}
+
+	// other principals renew the certificate of the same key
+	pb.SSHHostTasks[0].Principals = []string{"web01.example.com"}
+	if err = r.runSSHHostTask(ctx, conn, &pb.SSHHostTasks[0]); err != nil || len(conn.requests) != 2 {
+		t.Fatalf("expected a renewal, got %d requests, %v", len(conn.requests), err)
+	}
+	if data, _ := ioutil.ReadFile(task.HostKey); !bytes.Equal(data, keyData) {
+		t.Error("the host key should be kept")
+	}
+
+	// a rotated key is replaced on renewal
+	pb.SSHHostTasks[0].RotateKey = true
+	r.Now = func() time.Time { return time.Now().Add(80 * 24 * time.Hour) }
+	if err = r.runSSHHostTask(ctx, conn, &pb.SSHHostTasks[0]); err != nil || len(conn.requests) != 3 {
+		t.Fatalf("expected a renewal, got %d requests, %v", len(conn.requests), err)
+	}
+	if data, _ := ioutil.ReadFile(task.HostKey); bytes.Equal(data, keyData) {
+		t.Error("the host key should be rotated")
+	}
+}
+
+func TestGenerateSSHKey(t *testing.T) {
+	for _, keyType := range []string{SSHKeyTypeECDSA, SSHKeyTypeRSA} {
+		data, pub, err := generateSSHKey(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			t.Fatalf("%s: %s", keyType, err)
+		}
+		if !bytes.Equal(signer.PublicKey().Marshal(), pub.Marshal()) {
+			t.Errorf("%s: the public key doesn't match", keyType)
+		}
+	}
+	if _, _, err := generateSSHKey("dsa"); err == nil {
+		t.Error("expected an error for an unknown key type")
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+// pathData are the values the templates of the installation paths can use, e.g.
+// "/etc/ssl/{{ .CommonName }}/{{ .NotAfter | date "2006-01" }}.pem". The values are made safe for a file name:
+// the path separators and the "*" of a wildcard name are replaced with "_".
+type pathData struct {
+	Task       string
+	CommonName string
+	Zone       string
+	DNSNames   []string
+	// the values of the certificate are a wildcard when the installed certificate is searched for
+	SerialNumber interface{}
+	Thumbprint   interface{}
+	NotBefore    interface{}
+	NotAfter     interface{}
+}
+
+// wildcard stands for the values of a certificate not known yet, it renders as a glob matching any of them
+type wildcard struct{}
+
+func (wildcard) String() string {
+	return "*"
+}
+
+// pathFuncs are the functions of the templates of installation paths. They don't access the host, the templates
+// only transform the values of the certificate.
+var pathFuncs = template.FuncMap{
+	"date": func(layout string, t interface{}) (string, error) {
+		switch v := t.(type) {
+		case time.Time:
+			return v.UTC().Format(layout), nil
+		case wildcard:
+			return v.String(), nil
+		}
+		return "", fmt.Errorf("date of %v, which is not a time", t)
+	},
+	"lower": func(s interface{}) string { return strings.ToLower(fmt.Sprint(s)) },
+	"upper": func(s interface{}) string { return strings.ToUpper(fmt.Sprint(s)) },
+	"replace": func(old, new string, s interface{}) string {
+		return strings.Replace(fmt.Sprint(s), old, new, -1)
+	},
+	"trimPrefix": func(prefix string, s interface{}) string { return strings.TrimPrefix(fmt.Sprint(s), prefix) },
+	"trimSuffix": func(suffix string, s interface{}) string { return strings.TrimSuffix(fmt.Sprint(s), suffix) },
+	"default": func(def string, s interface{}) string {
+		if v := fmt.Sprint(s); v != "" {
+			return v
+		}
+		return def
+	},
+}
+
+// newPathData returns the values of the paths of the installations of task for cert, or for any certificate when
+// cert is nil
+func newPathData(task *CertificateTask, cert *x509.Certificate) *pathData {
+	d := &pathData{
+		Task:         safeName(task.Name),
+		CommonName:   safeName(task.Request.Subject.CommonName),
+		Zone:         safeName(task.Request.Zone),
+		SerialNumber: wildcard{},
+		Thumbprint:   wildcard{},
+		NotBefore:    wildcard{},
+		NotAfter:     wildcard{},
+	}
+	for _, name := range task.Request.SANs.DNS {
+		d.DNSNames = append(d.DNSNames, safeName(name))
+	}
+	if cert != nil {
+		d.SerialNumber = strings.ToUpper(cert.SerialNumber.Text(16))
+		d.Thumbprint = thumbprint(cert)
+		d.NotBefore = cert.NotBefore
+		d.NotAfter = cert.NotAfter
+	}
+	return d
+}
+
+func safeName(s string) string {
+	if s == "." || s == ".." {
+		return strings.Repeat("_", len(s))
+	}
+	return strings.NewReplacer("/", "_", `\`, "_", "*", "_", "\x00", "_").Replace(s)
+}
+
+// templated tells whether the paths of the installation are templates
+func (inst *Installation) templated() bool {
+	return strings.Contains(inst.File, "{{") || strings.Contains(inst.ChainFile, "{{") || strings.Contains(inst.KeyFile, "{{")
+}
+
+// resolve returns the installation with its paths rendered with data
+func (inst Installation) resolve(data *pathData) (Installation, error) {
+	for _, path := range []*string{&inst.File, &inst.ChainFile, &inst.KeyFile} {
+		if !strings.Contains(*path, "{{") {
+			continue
+		}
+		t, err := template.New("path").Funcs(pathFuncs).Parse(*path)
+		if err != nil {
+			return inst, err
+		}
+		var b bytes.Buffer
+		err = t.Execute(&b, data)
+		if err != nil {
+			return inst, err
+		}
+		*path = b.String()
+	}
+	return inst, nil
+}
+
+// installed returns inst with the paths of the certificate it installed, the one expiring last when its paths
+// depend on the certificate. The paths are the glob of all the certificates when none is installed.
+func (task *CertificateTask) installed(inst Installation) (Installation, error) {
+	if !inst.templated() {
+		return inst, nil
+	}
+	pattern, err := inst.resolve(newPathData(task, nil))
+	if err != nil {
+		return inst, err
+	}
+	if !strings.Contains(pattern.File, "*") {
+		return pattern, nil
+	}
+	matches, err := filepath.Glob(pattern.File)
+	if err != nil {
+		return inst, err
+	}
+	var last *x509.Certificate
+	for _, m := range matches {
+		cert, err := readCertificate(m)
+		if err != nil {
+			// e.g. the private key when it's next to the certificate
+			continue
+		}
+		if last == nil || cert.NotAfter.After(last.NotAfter) {
+			last = cert
+		}
+	}
+	if last == nil {
+		return pattern, nil
+	}
+	return inst.resolve(newPathData(task, last))
+}
+
+// installation returns inst with its paths rendered for the certificate of pcc, and creates their directories
+func installation(task *CertificateTask, inst Installation, pcc *certificate.PEMCollection) (Installation, error) {
+	if !inst.templated() {
+		return inst, nil
+	}
+	b, _ := pem.Decode([]byte(pcc.Certificate))
+	if b == nil {
+		return inst, fmt.Errorf("no PEM data found in the certificate of %s", task.Name)
+	}
+	cert, err := certificate.ParseCertificate(b.Bytes)
+	if err != nil {
+		return inst, err
+	}
+	inst, err = inst.resolve(newPathData(task, cert))
+	if err != nil {
+		return inst, err
+	}
+	for _, path := range []string{inst.File, inst.ChainFile, inst.KeyFile} {
+		if path == "" {
+			continue
+		}
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return inst, err
+		}
+	}
+	return inst, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package playbook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestRunOnceTemplatedPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "playbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pb, err := Parse([]byte(fmt.Sprintf(`
+config:
+  connection:
+    type: fake
+certificateTasks:
+  - name: web
+    request:
+      subject:
+        commonName: "*.example.com"
+    installations:
+      - type: pem
+        file: '%[1]s/{{ .CommonName }}/{{ .NotAfter | date "2006-01" }}.pem'
+        keyFile: '%[1]s/{{ .CommonName }}/{{ .NotAfter | date "2006-01" }}-key.pem'
+`, dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []string
+	r := NewRunner(pb)
+	r.Log = func(format string, args ...interface{}) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inst, err := pb.CertificateTasks[0].installed(pb.CertificateTasks[0].Installations[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := readCertificate(inst.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "_.example.com", cert.NotAfter.UTC().Format("2006-01")+".pem")
+	if inst.File != want || inst.KeyFile != want[:len(want)-len(".pem")]+"-key.pem" {
+		t.Fatalf("unexpected installed paths %s and %s", inst.File, inst.KeyFile)
+	}
+	if _, err = os.Stat(inst.KeyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	logs = nil
+	err = r.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 0 {
+		t.Fatalf("installed certificate shouldn't be renewed: %v", logs)
+	}
+}
+
+func TestParseTemplatedPaths(t *testing.T) {
+	for _, file := range []string{
+		"/etc/ssl/{{ .CommonName }",
+		"/etc/ssl/{{ .Subject }}.pem",
+		"/etc/ssl/{{ env \"HOME\" }}.pem",
+		"/etc/ssl/{{ .CommonName | date \"2006\" }}.pem",
+	} {
+		data := fmt.Sprintf("config: {connection: {type: fake}}\ncertificateTasks: [{name: a, request: {subject: {commonName: a}}, installations: [{type: pem, file: '%s'}]}]", file)
+		_, err := Parse([]byte(data))
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("%s: expected user data error, got %v", file, err)
+		}
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	cases := map[string]string{
+		"*.example.com":    "_.example.com",
+		"../etc/passwd":    ".._etc_passwd",
+		"..":               "__",
+		`Certificates\Web`: "Certificates_Web",
+	}
+	for in, want := range cases {
+		if got := safeName(in); got != want {
+			t.Errorf("safeName(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
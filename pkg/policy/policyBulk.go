@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	BulkStatusApplied = "applied"
+	BulkStatusFailed  = "failed"
+	// BulkStatusSkipped is the status of the zones not applied since another zone failed
+	BulkStatusSkipped = "skipped"
+)
+
+// Setter applies a policy specification to a zone, it's implemented by endpoint.Connector
+type Setter interface {
+	SetPolicy(name string, ps *PolicySpecification) (string, error)
+}
+
+// ZoneLister lists the zones under a parent zone, it's implemented by endpoint.Connector
+type ZoneLister interface {
+	GetZonesByParent(parent string) ([]string, error)
+}
+
+// BulkOptions controls how ApplyBulk applies a policy to many zones
+type BulkOptions struct {
+	// Concurrency is the number of zones applied at the same time, 1 when it's not set
+	Concurrency int
+	// ContinueOnError keeps applying the policy to the remaining zones after a zone failed. Otherwise they're
+	// skipped, the zones already in progress are completed.
+	ContinueOnError bool
+}
+
+// BulkResult is the outcome of applying a policy to a zone
+type BulkResult struct {
+	Zone   string `json:"zone"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ApplyBulk applies ps to each of zones and returns their results in the same order. newSetter is called once by
+// each of the Concurrency workers, so a Setter needn't be safe for concurrent use; an authenticated connector is,
+// newSetter may return the same one to every worker.
+func ApplyBulk(newSetter func() (Setter, error), ps *PolicySpecification, zones []string, opts BulkOptions) []BulkResult {
+	results := make([]BulkResult, len(zones))
+	for i, zone := range zones {
+		results[i] = BulkResult{Zone: zone, Status: BulkStatusSkipped}
+	}
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(zones) {
+		workers = len(zones)
+	}
+
+	var mu sync.Mutex
+	failed := false
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// when the worker has no connector, the zones it receives fail with the reason
+			setter, setterErr := newSetter()
+			for i := range indexes {
+				err := setterErr
+				if err == nil {
+					_, err = setter.SetPolicy(zones[i], ps)
+				}
+				mu.Lock()
+				if err != nil {
+					results[i].Status = BulkStatusFailed
+					results[i].Error = err.Error()
+					failed = true
+				} else {
+					results[i].Status = BulkStatusApplied
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range zones {
+		mu.Lock()
+		stop := failed && !opts.ContinueOnError
+		mu.Unlock()
+		if stop {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// ReadZones reads a list of zones, one per line. Blank lines and lines starting with "#" are ignored.
+func ReadZones(r io.Reader) ([]string, error) {
+	var zones []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		zones = append(zones, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+// MatchZones returns the zones under a parent zone whose name matches pattern, e.g. "Legacy\Web*". Only the last
+// segment of the pattern can have wildcards, with the syntax of path.Match, and it's matched regardless of case.
+func MatchZones(lister ZoneLister, pattern string) ([]string, error) {
+	i := strings.LastIndex(pattern, "\\")
+	if i <= 0 {
+		return nil, fmt.Errorf("zone pattern %q has no parent zone", pattern)
+	}
+	parent, name := pattern[:i], strings.ToLower(pattern[i+1:])
+	if strings.ContainsAny(parent, "*?[") {
+		return nil, fmt.Errorf("zone pattern %q has wildcards in its parent zone, only the last segment can have them", pattern)
+	}
+	if _, err := path.Match(name, ""); err != nil {
+		return nil, fmt.Errorf("invalid zone pattern %q: %s", pattern, err)
+	}
+	children, err := lister.GetZonesByParent(parent)
+	if err != nil {
+		return nil, err
+	}
+	var zones []string
+	for _, zone := range children {
+		child := zone[strings.LastIndex(zone, "\\")+1:]
+		if ok, _ := path.Match(name, strings.ToLower(child)); ok {
+			zones = append(zones, zone)
+		}
+	}
+	return zones, nil
+}
@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type recordingSetter struct {
+	mu      sync.Mutex
+	applied []string
+	fail    map[string]bool
+	active  int32
+	maxSeen int32
+}
+
+func (s *recordingSetter) SetPolicy(name string, ps *PolicySpecification) (string, error) {
+	active := atomic.AddInt32(&s.active, 1)
+	defer atomic.AddInt32(&s.active, -1)
+	for {
+		seen := atomic.LoadInt32(&s.maxSeen)
+		if active <= seen || atomic.CompareAndSwapInt32(&s.maxSeen, seen, active) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if s.fail[name] {
+		return "", fmt.Errorf("zone %s is locked", name)
+	}
+	s.mu.Lock()
+	s.applied = append(s.applied, name)
+	s.mu.Unlock()
+	return name, nil
+}
+
+func TestApplyBulk(t *testing.T) {
+	var zones []string
+	for i := 0; i < 20; i++ {
+		zones = append(zones, fmt.Sprintf("Legacy\\Folder%02d", i))
+	}
+	setter := &recordingSetter{fail: map[string]bool{"Legacy\\Folder03": true}}
+	newSetter := func() (Setter, error) { return setter, nil }
+
+	results := ApplyBulk(newSetter, &PolicySpecification{}, zones, BulkOptions{Concurrency: 4, ContinueOnError: true})
+	if len(results) != len(zones) {
+		t.Fatalf("expected %d results, got %d", len(zones), len(results))
+	}
+	for i, r := range results {
+		if r.Zone != zones[i] {
+			t.Fatalf("result %d is for zone %s, expected %s", i, r.Zone, zones[i])
+		}
+		expected := BulkStatusApplied
+		if r.Zone == "Legacy\\Folder03" {
+			expected = BulkStatusFailed
+		}
+		if r.Status != expected {
+			t.Fatalf("zone %s: expected status %s, got %s", r.Zone, expected, r.Status)
+		}
+	}
+	if results[3].Error != "zone Legacy\\Folder03 is locked" {
+		t.Fatalf("unexpected error %q", results[3].Error)
+	}
+	if len(setter.applied) != 19 {
+		t.Fatalf("expected 19 zones applied, got %d", len(setter.applied))
+	}
+	if setter.maxSeen < 2 || setter.maxSeen > 4 {
+		t.Fatalf("expected up to 4 zones applied at the same time, got %d", setter.maxSeen)
+	}
+}
+
+func TestApplyBulkStopsOnError(t *testing.T) {
+	zones := []string{"A\\1", "A\\2", "A\\3", "A\\4", "A\\5"}
+	setter := &recordingSetter{fail: map[string]bool{"A\\1": true}}
+	results := ApplyBulk(func() (Setter, error) { return setter, nil }, &PolicySpecification{}, zones, BulkOptions{})
+
+	if results[0].Status != BulkStatusFailed {
+		t.Fatalf("expected the first zone to fail, got %s", results[0].Status)
+	}
+	for _, r := range results[2:] {
+		if r.Status != BulkStatusSkipped {
+			t.Fatalf("zone %s: expected to be skipped, got %s", r.Zone, r.Status)
+		}
+	}
+}
+
+func TestApplyBulkSetterError(t *testing.T) {
+	results := ApplyBulk(func() (Setter, error) { return nil, errors.New("authentication failed") },
+		&PolicySpecification{}, []string{"A\\1", "A\\2"}, BulkOptions{Concurrency: 2, ContinueOnError: true})
+	for _, r := range results {
+		if r.Status != BulkStatusFailed || r.Error != "authentication failed" {
+			t.Fatalf("zone %s: unexpected result %+v", r.Zone, r)
+		}
+	}
+}
+
+type staticLister []string
+
+func (l staticLister) GetZonesByParent(parent string) ([]string, error) {
+	var zones []string
+	for _, child := range l {
+		zones = append(zones, parent+"\\"+child)
+	}
+	return zones, nil
+}
+
+func TestMatchZones(t *testing.T) {
+	lister := staticLister{"Web01", "web02", "Mail", "Webmail"}
+	zones, err := MatchZones(lister, "Legacy\\Web??")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Legacy\\Web01", "Legacy\\web02"}
+	if !reflect.DeepEqual(zones, expected) {
+		t.Fatalf("expected %v, got %v", expected, zones)
+	}
+
+	for _, pattern := range []string{"Web*", "Legacy\\*\\Web", "Legacy\\[web"} {
+		if _, err := MatchZones(lister, pattern); err == nil {
+			t.Fatalf("expected an error for pattern %q", pattern)
+		}
+	}
+}
+
+func TestReadZones(t *testing.T) {
+	zones, err := ReadZones(strings.NewReader("# legacy folders\nLegacy\\Web\n\n  Legacy\\Mail  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Legacy\\Web", "Legacy\\Mail"}
+	if !reflect.DeepEqual(zones, expected) {
+		t.Fatalf("expected %v, got %v", expected, zones)
+	}
+}
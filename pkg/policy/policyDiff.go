@@ -0,0 +1,241 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Difference is a field whose value differs between two policy specifications. Scalar fields are reported with A
+// and B, "" standing for a value that isn't set. List fields are reported with the values found in only one of them.
+type Difference struct {
+	// Field is the path of the field in the specification, e.g. "policy.keyPair.rsaKeySizes"
+	Field   string   `json:"field" yaml:"field"`
+	A       string   `json:"a,omitempty" yaml:"a,omitempty"`
+	B       string   `json:"b,omitempty" yaml:"b,omitempty"`
+	OnlyInA []string `json:"onlyInA,omitempty" yaml:"onlyInA,omitempty"`
+	OnlyInB []string `json:"onlyInB,omitempty" yaml:"onlyInB,omitempty"`
+}
+
+func (d Difference) String() string {
+	if d.OnlyInA == nil && d.OnlyInB == nil {
+		return fmt.Sprintf("%s: %s -> %s", d.Field, unsetIfEmpty(d.A), unsetIfEmpty(d.B))
+	}
+	var b strings.Builder
+	b.WriteString(d.Field + ":")
+	for _, v := range d.OnlyInA {
+		b.WriteString("\n  - " + v)
+	}
+	for _, v := range d.OnlyInB {
+		b.WriteString("\n  + " + v)
+	}
+	return b.String()
+}
+
+func unsetIfEmpty(s string) string {
+	if s == "" {
+		return "(not set)"
+	}
+	return s
+}
+
+// Diff compares the policy specifications a and b, e.g. those of two zones returned by Connector.GetPolicy. The
+// differences are ordered as the fields of PolicySpecification. The order of the values of a list doesn't matter,
+// nor does the case of domains, key types and curves.
+func Diff(a, b *PolicySpecification) []Difference {
+	if a == nil {
+		a = &PolicySpecification{}
+	}
+	if b == nil {
+		b = &PolicySpecification{}
+	}
+	d := &differ{}
+	d.strings("owners", a.Owners, b.Owners, false)
+	d.strings("users", a.Users, b.Users, false)
+	d.string("userAccess", &a.UserAccess, &b.UserAccess)
+	d.strings("approvers", a.Approvers, b.Approvers, false)
+
+	pa, pb := a.Policy, b.Policy
+	if pa == nil {
+		pa = &Policy{}
+	}
+	if pb == nil {
+		pb = &Policy{}
+	}
+	d.strings("policy.domains", pa.Domains, pb.Domains, true)
+	d.bool("policy.wildcardAllowed", pa.WildcardAllowed, pb.WildcardAllowed)
+	d.bool("policy.autoInstalled", pa.AutoInstalled, pb.AutoInstalled)
+	d.int("policy.maxValidDays", pa.MaxValidDays, pb.MaxValidDays)
+	d.string("policy.certificateAuthority", pa.CertificateAuthority, pb.CertificateAuthority)
+
+	sa, sb := pa.Subject, pb.Subject
+	if sa == nil {
+		sa = &Subject{}
+	}
+	if sb == nil {
+		sb = &Subject{}
+	}
+	d.strings("policy.subject.orgs", sa.Orgs, sb.Orgs, false)
+	d.strings("policy.subject.orgUnits", sa.OrgUnits, sb.OrgUnits, false)
+	d.strings("policy.subject.localities", sa.Localities, sb.Localities, false)
+	d.strings("policy.subject.states", sa.States, sb.States, false)
+	d.strings("policy.subject.countries", sa.Countries, sb.Countries, true)
+
+	ka, kb := pa.KeyPair, pb.KeyPair
+	if ka == nil {
+		ka = &KeyPair{}
+	}
+	if kb == nil {
+		kb = &KeyPair{}
+	}
+	d.strings("policy.keyPair.keyTypes", ka.KeyTypes, kb.KeyTypes, true)
+	d.ints("policy.keyPair.rsaKeySizes", ka.RsaKeySizes, kb.RsaKeySizes)
+	d.strings("policy.keyPair.ellipticCurves", ka.EllipticCurves, kb.EllipticCurves, true)
+	d.bool("policy.keyPair.serviceGenerated", ka.ServiceGenerated, kb.ServiceGenerated)
+	d.bool("policy.keyPair.reuseAllowed", ka.ReuseAllowed, kb.ReuseAllowed)
+
+	na, nb := pa.SubjectAltNames, pb.SubjectAltNames
+	if na == nil {
+		na = &SubjectAltNames{}
+	}
+	if nb == nil {
+		nb = &SubjectAltNames{}
+	}
+	d.bool("policy.subjectAltNames.dnsAllowed", na.DnsAllowed, nb.DnsAllowed)
+	d.bool("policy.subjectAltNames.ipAllowed", na.IpAllowed, nb.IpAllowed)
+	d.bool("policy.subjectAltNames.emailAllowed", na.EmailAllowed, nb.EmailAllowed)
+	d.bool("policy.subjectAltNames.uriAllowed", na.UriAllowed, nb.UriAllowed)
+	d.bool("policy.subjectAltNames.upnAllowed", na.UpnAllowed, nb.UpnAllowed)
+	d.strings("policy.subjectAltNames.uriProtocols", na.UriProtocols, nb.UriProtocols, true)
+	d.strings("policy.subjectAltNames.ipConstraints", na.IpConstraints, nb.IpConstraints, false)
+
+	da, db := a.Default, b.Default
+	if da == nil {
+		da = &Default{}
+	}
+	if db == nil {
+		db = &Default{}
+	}
+	d.string("defaults.domain", da.Domain, db.Domain)
+	d.bool("defaults.autoInstalled", da.AutoInstalled, db.AutoInstalled)
+
+	dsa, dsb := da.Subject, db.Subject
+	if dsa == nil {
+		dsa = &DefaultSubject{}
+	}
+	if dsb == nil {
+		dsb = &DefaultSubject{}
+	}
+	d.string("defaults.subject.org", dsa.Org, dsb.Org)
+	d.strings("defaults.subject.orgUnits", dsa.OrgUnits, dsb.OrgUnits, false)
+	d.string("defaults.subject.locality", dsa.Locality, dsb.Locality)
+	d.string("defaults.subject.state", dsa.State, dsb.State)
+	d.string("defaults.subject.country", dsa.Country, dsb.Country)
+
+	dka, dkb := da.KeyPair, db.KeyPair
+	if dka == nil {
+		dka = &DefaultKeyPair{}
+	}
+	if dkb == nil {
+		dkb = &DefaultKeyPair{}
+	}
+	d.string("defaults.keyPair.keyType", dka.KeyType, dkb.KeyType)
+	d.int("defaults.keyPair.rsaKeySize", dka.RsaKeySize, dkb.RsaKeySize)
+	d.string("defaults.keyPair.ellipticCurve", dka.EllipticCurve, dkb.EllipticCurve)
+	d.bool("defaults.keyPair.serviceGenerated", dka.ServiceGenerated, dkb.ServiceGenerated)
+
+	return d.diffs
+}
+
+type differ struct {
+	diffs []Difference
+}
+
+func (d *differ) scalar(field, a, b string) {
+	if a != b {
+		d.diffs = append(d.diffs, Difference{Field: field, A: a, B: b})
+	}
+}
+
+func (d *differ) string(field string, a, b *string) {
+	var sa, sb string
+	if a != nil {
+		sa = *a
+	}
+	if b != nil {
+		sb = *b
+	}
+	d.scalar(field, sa, sb)
+}
+
+func (d *differ) bool(field string, a, b *bool) {
+	var sa, sb string
+	if a != nil {
+		sa = strconv.FormatBool(*a)
+	}
+	if b != nil {
+		sb = strconv.FormatBool(*b)
+	}
+	d.scalar(field, sa, sb)
+}
+
+func (d *differ) int(field string, a, b *int) {
+	var sa, sb string
+	if a != nil {
+		sa = strconv.Itoa(*a)
+	}
+	if b != nil {
+		sb = strconv.Itoa(*b)
+	}
+	d.scalar(field, sa, sb)
+}
+
+func (d *differ) ints(field string, a, b []int) {
+	var sa, sb []string
+	for _, v := range a {
+		sa = append(sa, strconv.Itoa(v))
+	}
+	for _, v := range b {
+		sb = append(sb, strconv.Itoa(v))
+	}
+	d.strings(field, sa, sb, false)
+}
+
+// strings reports the values of a list found in only one of a and b, ignoring their case when foldCase is set
+func (d *differ) strings(field string, a, b []string, foldCase bool) {
+	key := func(s string) string {
+		if foldCase {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+	inA := make(map[string]bool)
+	for _, v := range a {
+		inA[key(v)] = true
+	}
+	inB := make(map[string]bool)
+	for _, v := range b {
+		inB[key(v)] = true
+	}
+	// a value is marked as found once reported, so that duplicates are reported once
+	var onlyInA, onlyInB []string
+	for _, v := range a {
+		if !inB[key(v)] {
+			onlyInA = append(onlyInA, v)
+			inB[key(v)] = true
+		}
+	}
+	for _, v := range b {
+		if !inA[key(v)] {
+			onlyInB = append(onlyInB, v)
+			inA[key(v)] = true
+		}
+	}
+	if onlyInA == nil && onlyInB == nil {
+		return
+	}
+	sort.Strings(onlyInA)
+	sort.Strings(onlyInB)
+	d.diffs = append(d.diffs, Difference{Field: field, OnlyInA: onlyInA, OnlyInB: onlyInB})
+}
@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	wildcard := true
+	days90, days365 := 90, 365
+	ca := "\\VED\\Policy\\Certificate Authorities\\Internal"
+	rsa := "RSA"
+	a := &PolicySpecification{
+		Policy: &Policy{
+			Domains:              []string{"example.com", "Example.org"},
+			WildcardAllowed:      &wildcard,
+			MaxValidDays:         &days365,
+			CertificateAuthority: &ca,
+			KeyPair: &KeyPair{
+				KeyTypes:    []string{"RSA"},
+				RsaKeySizes: []int{2048, 4096},
+			},
+		},
+		Default: &Default{KeyPair: &DefaultKeyPair{KeyType: &rsa}},
+	}
+	b := &PolicySpecification{
+		Policy: &Policy{
+			Domains:              []string{"example.org", "example.net", "example.net"},
+			MaxValidDays:         &days90,
+			CertificateAuthority: &ca,
+			KeyPair: &KeyPair{
+				KeyTypes:       []string{"rsa", "ECDSA"},
+				RsaKeySizes:    []int{4096, 2048},
+				EllipticCurves: []string{"P256"},
+			},
+		},
+	}
+
+	expected := []Difference{
+		{Field: "policy.domains", OnlyInA: []string{"example.com"}, OnlyInB: []string{"example.net"}},
+		{Field: "policy.wildcardAllowed", A: "true"},
+		{Field: "policy.maxValidDays", A: "365", B: "90"},
+		{Field: "policy.keyPair.keyTypes", OnlyInB: []string{"ECDSA"}},
+		{Field: "policy.keyPair.ellipticCurves", OnlyInB: []string{"P256"}},
+		{Field: "defaults.keyPair.keyType", A: "RSA"},
+	}
+	diffs := Diff(a, b)
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, diffs)
+	}
+
+	if diffs := Diff(a, a); len(diffs) != 0 {
+		t.Fatalf("expected no difference, got %+v", diffs)
+	}
+	if diffs := Diff(nil, &PolicySpecification{Policy: &Policy{}}); len(diffs) != 0 {
+		t.Fatalf("expected no difference between empty specifications, got %+v", diffs)
+	}
+}
+
+func TestDifferenceString(t *testing.T) {
+	d := Difference{Field: "policy.maxValidDays", B: "90"}
+	if d.String() != "policy.maxValidDays: (not set) -> 90" {
+		t.Fatalf("unexpected string %q", d.String())
+	}
+	d = Difference{Field: "policy.domains", OnlyInA: []string{"example.com"}, OnlyInB: []string{"example.net"}}
+	if d.String() != "policy.domains:\n  - example.com\n  + example.net" {
+		t.Fatalf("unexpected string %q", d.String())
+	}
+}
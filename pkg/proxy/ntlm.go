@@ -0,0 +1,201 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4" // nolint:staticcheck // MD4 is what NTLM hashes the password with
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// The NTLM messages (MS-NLMP) of the handshake authenticating the CONNECT requests, with NTLMv2 responses
+const (
+	ntlmNegotiateUnicode     = 0x00000001
+	ntlmRequestTarget        = 0x00000004
+	ntlmNegotiateNTLM        = 0x00000200
+	ntlmNegotiateAlwaysSign  = 0x00008000
+	ntlmNegotiateExtendedSec = 0x00080000
+	ntlmNegotiateTargetInfo  = 0x00800000
+	ntlmNegotiate128         = 0x20000000
+	ntlmNegotiate56          = 0x80000000
+
+	ntlmFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSec | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+
+	ntlmAvEOL       = 0
+	ntlmAvTimestamp = 7
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmChallenge is the content of the CHALLENGE_MESSAGE of the proxy used by the response
+type ntlmChallenge struct {
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+// ntlmNegotiate returns the NEGOTIATE_MESSAGE, without domain nor workstation
+func ntlmNegotiate() []byte {
+	msg := append([]byte{}, ntlmSignature...)
+	msg = appendUint32(msg, 1)
+	msg = appendUint32(msg, ntlmFlags)
+	// the empty domain and workstation fields
+	return append(msg, make([]byte, 16)...)
+}
+
+// ntlmChallengeOf parses the CHALLENGE_MESSAGE of the Proxy-Authenticate header of the 407 response
+func ntlmChallengeOf(header http.Header) (*ntlmChallenge, error) {
+	for _, v := range header["Proxy-Authenticate"] {
+		if !strings.HasPrefix(v, "NTLM ") {
+			continue
+		}
+		msg, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v[len("NTLM "):]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid NTLM challenge: %s", verror.ServerBadDataResponce, err)
+		}
+		return parseNTLMChallenge(msg)
+	}
+	return nil, fmt.Errorf("%w: the proxy doesn't offer NTLM authentication", verror.AuthError)
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 48 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, fmt.Errorf("%w: invalid NTLM challenge message", verror.ServerBadDataResponce)
+	}
+	c := &ntlmChallenge{serverChallenge: msg[24:32]}
+	length := int(binary.LittleEndian.Uint16(msg[40:]))
+	offset := int(binary.LittleEndian.Uint32(msg[44:]))
+	if offset+length > len(msg) {
+		return nil, fmt.Errorf("%w: invalid NTLM target info", verror.ServerBadDataResponce)
+	}
+	c.targetInfo = msg[offset : offset+length]
+	return c, nil
+}
+
+// timestamp returns the MsvAvTimestamp of the target info, nil when there's none
+func (c *ntlmChallenge) timestamp() []byte {
+	info := c.targetInfo
+	for len(info) >= 4 {
+		id := binary.LittleEndian.Uint16(info)
+		length := int(binary.LittleEndian.Uint16(info[2:]))
+		if id == ntlmAvEOL || 4+length > len(info) {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return info[4:12]
+		}
+		info = info[4+length:]
+	}
+	return nil
+}
+
+// ntlmAuthenticate returns the AUTHENTICATE_MESSAGE answering the challenge
+func ntlmAuthenticate(c *ntlmChallenge, domain, user, password string) ([]byte, error) {
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	timestamp := c.timestamp()
+	hasTimestamp := timestamp != nil
+	if !hasTimestamp {
+		timestamp = fileTime(time.Now())
+	}
+	nt, lm := ntlmV2Responses(domain, user, password, c.serverChallenge, clientChallenge, timestamp, c.targetInfo)
+	if hasTimestamp {
+		// the LM response shouldn't be sent when the server gives its time
+		lm = make([]byte, 24)
+	}
+
+	fields := [][]byte{lm, nt, utf16le(domain), utf16le(user), nil, nil}
+	msg := append([]byte{}, ntlmSignature...)
+	msg = appendUint32(msg, 3)
+	offset := 64
+	var payload []byte
+	// the LM and NT responses, the domain, the user, the empty workstation and session key, and then the flags
+	for _, f := range fields {
+		msg = appendUint16(msg, uint16(len(f)))
+		msg = appendUint16(msg, uint16(len(f)))
+		msg = appendUint32(msg, uint32(offset))
+		offset += len(f)
+		payload = append(payload, f...)
+	}
+	msg = appendUint32(msg, ntlmFlags)
+	return append(msg, payload...), nil
+}
+
+// ntlmV2Responses computes the NTLMv2 and LMv2 responses of MS-NLMP 3.3.2
+func ntlmV2Responses(domain, user, password string, serverChallenge, clientChallenge, timestamp, targetInfo []byte) (nt, lm []byte) {
+	h := md4.New()
+	h.Write(utf16le(password))
+	key := hmacMD5(h.Sum(nil), utf16le(strings.ToUpper(user)+domain))
+
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	proof := hmacMD5(key, append(append([]byte{}, serverChallenge...), temp...))
+	nt = append(proof, temp...)
+	lm = append(hmacMD5(key, append(append([]byte{}, serverChallenge...), clientChallenge...)), clientChallenge...)
+	return nt, lm
+}
+
+func hmacMD5(key, data []byte) []byte {
+	m := hmac.New(md5.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+func utf16le(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = appendUint16(b, u)
+	}
+	return b
+}
+
+// fileTime returns t as the little endian count of 100ns since 1601 of Windows
+func fileTime(t time.Time) []byte {
+	const epochDelta = 116444736000000000
+	return appendUint64(nil, uint64(t.UnixNano()/100+epochDelta))
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v)), uint32(v>>32))
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package proxy dials connections through HTTP proxies, with basic or NTLM authentication, and through SOCKS5
+// proxies, for the environments where the Venafi platform can only be reached through a jump host.
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Proxy dials the connections through the proxy at URL
+type Proxy struct {
+	// URL is the address of the proxy: http://, https://, socks5:// for the names resolved locally or socks5h:// for
+	// the names resolved by the proxy
+	URL *url.URL
+	// Username and Password authenticate to the proxy when Username isn't empty. With NTLM, the user name may be
+	// prefixed with the domain: DOMAIN\user.
+	Username string
+	Password string
+	// NTLM authenticates to an HTTP proxy with NTLMv2 rather than the basic authentication
+	NTLM bool
+	// Forward dials the proxy, a net.Dialer does when it's nil
+	Forward func(ctx context.Context, network, address string) (net.Conn, error)
+	// Resolver resolves the names dialed through a socks5:// proxy, net.DefaultResolver does when it's nil
+	Resolver *net.Resolver
+	// TLSConfig is the configuration of the connections to an https:// proxy
+	TLSConfig *tls.Config
+}
+
+// Parse returns the proxy at rawurl, authenticated with the credentials of its user info. auth is "basic", the
+// default when it's empty, or "ntlm".
+func Parse(rawurl, auth string) (*Proxy, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid proxy URL: %s", verror.UserDataError, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("%w: proxy URL %q must be http://, https://, socks5:// or socks5h://", verror.UserDataError, rawurl)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: proxy URL %q has no host", verror.UserDataError, rawurl)
+	}
+	p := &Proxy{URL: u}
+	switch strings.ToLower(auth) {
+	case "", "basic":
+	case "ntlm":
+		if !p.isHTTP() {
+			return nil, fmt.Errorf("%w: NTLM authentication is for HTTP proxies, not %s", verror.UserDataError, u.Scheme)
+		}
+		p.NTLM = true
+	default:
+		return nil, fmt.Errorf("%w: unknown proxy authentication %q, it must be basic or ntlm", verror.UserDataError, auth)
+	}
+	if u.User != nil {
+		p.Username = u.User.Username()
+		p.Password, _ = u.User.Password()
+		u.User = nil
+	}
+	return p, nil
+}
+
+func (p *Proxy) isHTTP() bool {
+	return p.URL.Scheme == "http" || p.URL.Scheme == "https"
+}
+
+// address returns the address of the proxy, on the default port of its scheme when it has none
+func (p *Proxy) address() string {
+	if port := p.URL.Port(); port != "" {
+		return p.URL.Host
+	}
+	port := map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[p.URL.Scheme]
+	return net.JoinHostPort(p.URL.Hostname(), port)
+}
+
+// DialContext has the signature of http.Transport.DialContext, it returns a connection to address tunneled through
+// the proxy
+func (p *Proxy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	forward := p.Forward
+	if forward == nil {
+		forward = (&net.Dialer{}).DialContext
+	}
+	conn, err := forward(ctx, "tcp", p.address())
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	switch p.URL.Scheme {
+	case "socks5", "socks5h":
+		err = p.socks5(ctx, conn, address)
+	case "https":
+		config := p.TLSConfig.Clone()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config.ServerName = p.URL.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err = tlsConn.Handshake(); err == nil {
+			conn = tlsConn
+			err = p.connect(conn, address)
+		}
+	default:
+		err = p.connect(conn, address)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connect opens a tunnel to address with the CONNECT method, authenticated with the NTLM handshake when it's
+// challenged for it
+func (p *Proxy) connect(conn net.Conn, address string) error {
+	br := bufio.NewReader(conn)
+	var authorization string
+	if p.Username != "" {
+		if p.NTLM {
+			authorization = "NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiate())
+		} else {
+			authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(p.Username+":"+p.Password))
+		}
+	}
+	resp, err := p.sendConnect(conn, br, address, authorization)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusProxyAuthRequired && p.NTLM && p.Username != "" {
+		challenge, err := ntlmChallengeOf(resp.Header)
+		if err != nil {
+			return err
+		}
+		domain, user := splitDomain(p.Username)
+		msg, err := ntlmAuthenticate(challenge, domain, user, p.Password)
+		if err != nil {
+			return err
+		}
+		resp, err = p.sendConnect(conn, br, address, "NTLM "+base64.StdEncoding.EncodeToString(msg))
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return fmt.Errorf("%w: proxy %s: %s", verror.AuthError, p.URL.Host, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%w: proxy %s: CONNECT %s: %s", verror.ServerUnavailableError, p.URL.Host, address, resp.Status)
+	case br.Buffered() > 0:
+		return fmt.Errorf("%w: proxy %s sent data before the tunnel was established", verror.ServerBadDataResponce, p.URL.Host)
+	}
+	return nil
+}
+
+// sendConnect sends a CONNECT request on conn and reads its response, whose body is discarded so the connection can
+// carry the next step of the handshake
+func (p *Proxy) sendConnect(conn net.Conn, br *bufio.Reader, address, authorization string) (*http.Response, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if authorization != "" {
+		req.Header.Set("Proxy-Authorization", authorization)
+	}
+	if p.NTLM {
+		req.Header.Set("Proxy-Connection", "Keep-Alive")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %s", p.URL.Host, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// splitDomain splits the DOMAIN\user name of NTLM
+func splitDomain(username string) (domain, user string) {
+	if i := strings.Index(username, `\`); i >= 0 {
+		return username[:i], username[i+1:]
+	}
+	return "", username
+}
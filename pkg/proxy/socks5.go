@@ -0,0 +1,172 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// The values of the SOCKS5 protocol (RFC 1928) and of its username/password authentication (RFC 1929)
+const (
+	socks5Version       = 5
+	socks5NoAuth        = 0
+	socks5UserPass      = 2
+	socks5NoAcceptable  = 0xff
+	socks5Connect       = 1
+	socks5IPv4          = 1
+	socks5Domain        = 3
+	socks5IPv6          = 4
+	socks5UserPassVer   = 1
+	socks5Succeeded     = 0
+	socks5MaxDomainSize = 255
+)
+
+var socks5Replies = map[byte]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5 asks the SOCKS5 proxy at the other end of conn to connect it to address
+func (p *Proxy) socks5(ctx context.Context, conn net.Conn, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 0xffff {
+		return fmt.Errorf("%w: invalid port %q", verror.UserDataError, portStr)
+	}
+
+	methods := []byte{socks5NoAuth}
+	if p.Username != "" {
+		methods = append(methods, socks5UserPass)
+	}
+	if _, err = conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	b := make([]byte, 2)
+	if _, err = io.ReadFull(conn, b); err != nil {
+		return err
+	}
+	if b[0] != socks5Version {
+		return fmt.Errorf("%w: proxy %s isn't a SOCKS5 proxy", verror.ServerBadDataResponce, p.URL.Host)
+	}
+	switch b[1] {
+	case socks5NoAuth:
+	case socks5UserPass:
+		if err = p.socks5Authenticate(conn); err != nil {
+			return err
+		}
+	case socks5NoAcceptable:
+		return fmt.Errorf("%w: proxy %s accepts none of the authentication methods", verror.AuthError, p.URL.Host)
+	default:
+		return fmt.Errorf("%w: proxy %s chose an authentication method that wasn't offered", verror.ServerBadDataResponce, p.URL.Host)
+	}
+
+	req := []byte{socks5Version, socks5Connect, 0}
+	ip := net.ParseIP(host)
+	if ip == nil && p.URL.Scheme == "socks5" {
+		resolver := p.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return err
+		}
+		ip = addrs[0].IP
+	}
+	switch {
+	case ip.To4() != nil:
+		req = append(append(req, socks5IPv4), ip.To4()...)
+	case ip != nil:
+		req = append(append(req, socks5IPv6), ip.To16()...)
+	case len(host) > socks5MaxDomainSize:
+		return fmt.Errorf("%w: host name %q is too long for SOCKS5", verror.UserDataError, host)
+	default:
+		req = append(append(req, socks5Domain, byte(len(host))), host...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 4)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != socks5Succeeded {
+		msg, ok := socks5Replies[reply[1]]
+		if !ok {
+			msg = fmt.Sprintf("reply %d", reply[1])
+		}
+		return fmt.Errorf("%w: proxy %s: connect %s: %s", verror.ServerUnavailableError, p.URL.Host, address, msg)
+	}
+	// the address the proxy bound isn't used
+	var skip int
+	switch reply[3] {
+	case socks5IPv4:
+		skip = net.IPv4len
+	case socks5IPv6:
+		skip = net.IPv6len
+	case socks5Domain:
+		if _, err = io.ReadFull(conn, reply[:1]); err != nil {
+			return err
+		}
+		skip = int(reply[0])
+	default:
+		return fmt.Errorf("%w: proxy %s replied with an unknown address type", verror.ServerBadDataResponce, p.URL.Host)
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// socks5Authenticate sends the username and password of the proxy
+func (p *Proxy) socks5Authenticate(conn net.Conn) error {
+	if len(p.Username) > 255 || len(p.Password) > 255 {
+		return fmt.Errorf("%w: the SOCKS5 username and password are limited to 255 bytes", verror.UserDataError)
+	}
+	req := []byte{socks5UserPassVer, byte(len(p.Username))}
+	req = append(req, p.Username...)
+	req = append(req, byte(len(p.Password)))
+	req = append(req, p.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return err
+	}
+	if b[1] != socks5Succeeded {
+		return fmt.Errorf("%w: proxy %s rejected the username and password", verror.AuthError, p.URL.Host)
+	}
+	return nil
+}
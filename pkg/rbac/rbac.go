@@ -0,0 +1,156 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rbac decides which client identities may enroll into which zones. The identities are the names of the
+// verified TLS client certificates: common name, DNS names, URIs such as SPIFFE IDs, and email addresses.
+//
+// A policy is a YAML file of rules, the patterns may use * to match any sequence of characters:
+//
+//	rules:
+//	  - identities: ["spiffe://example.org/ns/web/*", "deploy.example.com"]
+//	    zones: ["DevOps\\Web*"]
+//	  - identities: ["admin@example.com"]
+//	    zones: ["*"]
+//
+// A client may enroll into a zone when a rule matches one of its identities and the zone, nothing is allowed
+// otherwise.
+package rbac
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Rule allows the clients with one of Identities to enroll into Zones
+type Rule struct {
+	Identities []string `yaml:"identities"`
+	Zones      []string `yaml:"zones"`
+}
+
+// Policy is the list of rules, a client is denied everything no rule allows
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load reads the policy of the YAML file path
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read RBAC policy: %s", verror.UserDataError, err)
+	}
+	return Parse(data)
+}
+
+// Parse returns the policy of YAML data
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	err := yaml.UnmarshalStrict(data, &p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid RBAC policy: %s", verror.UserDataError, err)
+	}
+	for i, r := range p.Rules {
+		if len(r.Identities) == 0 || len(r.Zones) == 0 {
+			return nil, fmt.Errorf("%w: RBAC rule %d needs identities and zones", verror.UserDataError, i+1)
+		}
+	}
+	return &p, nil
+}
+
+// Allowed tells whether a client with identities may enroll into zone
+func (p *Policy) Allowed(identities []string, zone string) bool {
+	for _, r := range p.Rules {
+		if matchAny(r.Zones, zone) && matchAnyOf(r.Identities, identities) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns an AuthError when a client with identities may not enroll into zone
+func (p *Policy) Authorize(identities []string, zone string) error {
+	if p.Allowed(identities, zone) {
+		return nil
+	}
+	if len(identities) == 0 {
+		return fmt.Errorf("%w: an authenticated client is required to enroll into zone %q", verror.AuthError, zone)
+	}
+	return fmt.Errorf("%w: %s may not enroll into zone %q", verror.AuthError, identities[0], zone)
+}
+
+// Identities returns the names of cert: common name, DNS names, URIs and email addresses
+func Identities(cert *x509.Certificate) []string {
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return append(ids, cert.EmailAddresses...)
+}
+
+// RequestIdentities returns the identities of the verified client certificate of r, none without mutual TLS
+func RequestIdentities(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return Identities(r.TLS.VerifiedChains[0][0])
+}
+
+func matchAnyOf(patterns, values []string) bool {
+	for _, v := range values {
+		if matchAny(patterns, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if match(strings.ToLower(p), strings.ToLower(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// match tells whether value matches pattern, where * matches any sequence of characters. Unlike path.Match, a
+// backslash isn't an escape since it separates the folders of the zones.
+func match(pattern, value string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, pattern[:star]) {
+		return false
+	}
+	rest := pattern[star+1:]
+	for i := star; i <= len(value); i++ {
+		if match(rest, value[i:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rbac
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const policy = `
+rules:
+  - identities: ["spiffe://example.org/ns/web/*", "deploy.example.com"]
+    zones: ["DevOps\\Web*"]
+  - identities: ["admin@example.com"]
+    zones: ["*"]
+`
+
+func TestAllowed(t *testing.T) {
+	p, err := Parse([]byte(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		identities []string
+		zone       string
+		allowed    bool
+	}{
+		{[]string{"spiffe://example.org/ns/web/sa/frontend"}, `DevOps\Web Servers`, true},
+		{[]string{"Deploy.Example.com"}, `devops\web`, true},
+		{[]string{"spiffe://example.org/ns/db/sa/postgres"}, `DevOps\Web Servers`, false},
+		{[]string{"deploy.example.com"}, `DevOps\Databases`, false},
+		{[]string{"other.example.com", "admin@example.com"}, `Anything\At All`, true},
+		{nil, `DevOps\Web`, false},
+	} {
+		if allowed := p.Allowed(tc.identities, tc.zone); allowed != tc.allowed {
+			t.Errorf("%v into %s: expected %t", tc.identities, tc.zone, tc.allowed)
+		}
+	}
+	if err = p.Authorize([]string{"deploy.example.com"}, `DevOps\Databases`); !errors.Is(err, verror.AuthError) {
+		t.Errorf("expected an auth error, got %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		"rules:\n  - identities: [a]\n",
+		"rules:\n  - identities: [a]\n    zones: [b]\n    groups: [c]\n",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestRequestIdentities(t *testing.T) {
+	if ids := RequestIdentities(&http.Request{}); ids != nil {
+		t.Errorf("expected no identity without TLS, got %v", ids)
+	}
+	u, _ := url.Parse("spiffe://example.org/ns/web/sa/frontend")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "frontend"},
+		DNSNames:       []string{"frontend.example.com"},
+		URIs:           []*url.URL{u},
+		EmailAddresses: []string{"web@example.com"},
+	}
+	r := &http.Request{TLS: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	ids := RequestIdentities(r)
+	if len(ids) != 4 || ids[0] != "frontend" || ids[2] != u.String() {
+		t.Errorf("unexpected identities %v", ids)
+	}
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package rotation replaces a certificate on disk without downtime. The replacement is issued ahead of time and
+// staged next to the live certificate, then activated at a scheduled time or on command, and can be rolled back.
+//
+// Every certificate is written to its own directory under Manager.Dir and Manager.Dir/live is a symbolic link to
+// the active one, so services should read their files through the live link:
+//
+//	<Dir>/live -> releases/<serial>
+//	<Dir>/releases/<serial>/cert.pem
+//	<Dir>/releases/<serial>/chain.pem
+//	<Dir>/releases/<serial>/key.pem
+//
+// Switching the link is a single rename, so readers never see a certificate from one release and a key from another.
+package rotation
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	LiveLink     = "live"
+	ReleasesDir  = "releases"
+	CertFileName = "cert.pem"
+	ChainFile    = "chain.pem"
+	KeyFileName  = "key.pem"
+	stateFile    = "state.json"
+)
+
+var (
+	ErrNothingStaged   = fmt.Errorf("%w: no certificate is staged", verror.UserDataError)
+	ErrNothingPrevious = fmt.Errorf("%w: no previous certificate to roll back to", verror.UserDataError)
+)
+
+// State describes the releases known to a Manager. The values are directory names under ReleasesDir.
+type State struct {
+	Live       string     `json:"live,omitempty"`
+	Staged     string     `json:"staged,omitempty"`
+	Previous   string     `json:"previous,omitempty"`
+	ActivateAt *time.Time `json:"activateAt,omitempty"`
+}
+
+// Manager rotates the certificate kept under Dir.
+type Manager struct {
+	Dir       string
+	Connector endpoint.Connector
+}
+
+// NewManager returns a Manager for dir. The connector is only needed by Prepare and can be nil otherwise.
+func NewManager(dir string, connector endpoint.Connector) *Manager {
+	return &Manager{Dir: dir, Connector: connector}
+}
+
+// Prepare issues the replacement certificate described by req and stages it. The live certificate isn't touched.
+func (m *Manager) Prepare(req *certificate.Request) (*certificate.PEMCollection, error) {
+	if m.Connector == nil {
+		return nil, fmt.Errorf("%w: a connector is required to issue the replacement certificate", verror.UserDataError)
+	}
+	err := m.Connector.GenerateRequest(nil, req)
+	if err != nil {
+		return nil, err
+	}
+	req.PickupID, err = m.Connector.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	pcc, err := m.Connector.RetrieveCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.CsrOrigin != certificate.ServiceGeneratedCSR && req.PrivateKey != nil {
+		err = pcc.AddPrivateKey(req.PrivateKey, []byte(req.KeyPassword))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pcc, m.Stage(pcc)
+}
+
+// Stage writes pcc as a new release without activating it. A release that was staged before and never activated
+// is discarded.
+func (m *Manager) Stage(pcc *certificate.PEMCollection) error {
+	name, err := releaseName(pcc.Certificate)
+	if err != nil {
+		return err
+	}
+	st, err := m.State()
+	if err != nil {
+		return err
+	}
+	if name == st.Live {
+		return fmt.Errorf("%w: certificate %s is already live", verror.UserDataError, name)
+	}
+
+	dir := filepath.Join(m.Dir, ReleasesDir, name)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, CertFileName), []byte(pcc.Certificate), 0644)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, ChainFile), []byte(strings.Join(pcc.Chain, "")), 0644)
+	if err != nil {
+		return err
+	}
+	if pcc.PrivateKey != "" {
+		err = ioutil.WriteFile(filepath.Join(dir, KeyFileName), []byte(pcc.PrivateKey), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	if st.Staged != "" && st.Staged != name && st.Staged != st.Previous {
+		m.removeRelease(st.Staged)
+	}
+	st.Staged = name
+	st.ActivateAt = nil
+	return m.saveState(st)
+}
+
+// Activate makes the staged release live. The release it replaces is kept for Rollback.
+func (m *Manager) Activate() error {
+	st, err := m.State()
+	if err != nil {
+		return err
+	}
+	if st.Staged == "" {
+		return ErrNothingStaged
+	}
+	err = m.link(st.Staged)
+	if err != nil {
+		return err
+	}
+	if st.Previous != "" && st.Previous != st.Live && st.Previous != st.Staged {
+		m.removeRelease(st.Previous)
+	}
+	st.Previous, st.Live, st.Staged = st.Live, st.Staged, ""
+	st.ActivateAt = nil
+	return m.saveState(st)
+}
+
+// ActivateAt records the activation time, waits for it and then activates the staged release. It returns early
+// with the context error if ctx is done first, leaving the release staged.
+func (m *Manager) ActivateAt(ctx context.Context, at time.Time) error {
+	st, err := m.State()
+	if err != nil {
+		return err
+	}
+	if st.Staged == "" {
+		return ErrNothingStaged
+	}
+	st.ActivateAt = &at
+	err = m.saveState(st)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return m.Activate()
+	}
+}
+
+// Rollback makes the previous release live again. The release that was live becomes staged, so it can be
+// activated once more after the problem is fixed.
+func (m *Manager) Rollback() error {
+	st, err := m.State()
+	if err != nil {
+		return err
+	}
+	if st.Previous == "" {
+		return ErrNothingPrevious
+	}
+	err = m.link(st.Previous)
+	if err != nil {
+		return err
+	}
+	if st.Staged != "" && st.Staged != st.Live && st.Staged != st.Previous {
+		m.removeRelease(st.Staged)
+	}
+	st.Live, st.Staged, st.Previous = st.Previous, st.Live, ""
+	st.ActivateAt = nil
+	return m.saveState(st)
+}
+
+// State returns the current state of the releases. An empty State is returned for a directory that has never
+// been used.
+func (m *Manager) State() (*State, error) {
+	st := &State{}
+	b, err := ioutil.ReadFile(filepath.Join(m.Dir, stateFile))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, st)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rotation state: %s", err)
+	}
+	return st, nil
+}
+
+// LivePath returns the path of file within the live release, e.g. LivePath(CertFileName)
+func (m *Manager) LivePath(file string) string {
+	return filepath.Join(m.Dir, LiveLink, file)
+}
+
+func (m *Manager) saveState(st *State) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(m.Dir, stateFile+".tmp")
+	err = ioutil.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.Dir, stateFile))
+}
+
+// link points the live link to release by renaming a new link over it, which is atomic on POSIX systems
+func (m *Manager) link(release string) error {
+	tmp := filepath.Join(m.Dir, LiveLink+".tmp")
+	_ = os.Remove(tmp)
+	err := os.Symlink(filepath.Join(ReleasesDir, release), tmp)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.Dir, LiveLink))
+}
+
+func (m *Manager) removeRelease(release string) {
+	_ = os.RemoveAll(filepath.Join(m.Dir, ReleasesDir, release))
+}
+
+func releaseName(certPEM string) (string, error) {
+	b, _ := pem.Decode([]byte(certPEM))
+	if b == nil {
+		return "", fmt.Errorf("%w: failed to decode certificate PEM", verror.UserDataError)
+	}
+	cert, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", cert.SerialNumber), nil
+}
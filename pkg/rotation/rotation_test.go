@@ -0,0 +1,165 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rotation
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+func prepare(t *testing.T, m *Manager, cn string) *certificate.PEMCollection {
+	req := &certificate.Request{}
+	req.Subject.CommonName = cn
+	pcc, err := m.Prepare(req)
+	if err != nil {
+		t.Fatalf("failed to prepare certificate: %s", err)
+	}
+	return pcc
+}
+
+func liveCertificate(t *testing.T, m *Manager) string {
+	b, err := ioutil.ReadFile(m.LivePath(CertFileName))
+	if err != nil {
+		t.Fatalf("failed to read live certificate: %s", err)
+	}
+	return string(b)
+}
+
+func TestStageActivateRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := NewManager(dir, fake.NewConnector(false, nil))
+
+	first := prepare(t, m, "first.example.com")
+	if err = m.Activate(); err != nil {
+		t.Fatal(err)
+	}
+	if liveCertificate(t, m) != first.Certificate {
+		t.Fatal("first certificate should be live")
+	}
+
+	second := prepare(t, m, "second.example.com")
+	if liveCertificate(t, m) != first.Certificate {
+		t.Fatal("staging must not change the live certificate")
+	}
+	if err = m.Activate(); err != nil {
+		t.Fatal(err)
+	}
+	if liveCertificate(t, m) != second.Certificate {
+		t.Fatal("second certificate should be live")
+	}
+
+	if err = m.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if liveCertificate(t, m) != first.Certificate {
+		t.Fatal("rollback should restore the first certificate")
+	}
+	st, err := m.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Staged == "" || st.Previous != "" {
+		t.Fatalf("unexpected state after rollback: %+v", st)
+	}
+	if err = m.Rollback(); !errors.Is(err, ErrNothingPrevious) {
+		t.Fatalf("expected ErrNothingPrevious, got %v", err)
+	}
+}
+
+func TestStagePrevious(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := NewManager(dir, fake.NewConnector(false, nil))
+
+	first := prepare(t, m, "first.example.com")
+	if err = m.Activate(); err != nil {
+		t.Fatal(err)
+	}
+	prepare(t, m, "second.example.com")
+	if err = m.Activate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// staging the previous release again and rolling back must keep it on disk
+	if err = m.Stage(first); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if liveCertificate(t, m) != first.Certificate {
+		t.Fatal("rollback should restore the first certificate")
+	}
+
+	// and so must activating it
+	if err = m.Activate(); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Stage(first); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Activate(); err != nil {
+		t.Fatal(err)
+	}
+	if liveCertificate(t, m) != first.Certificate {
+		t.Fatal("first certificate should be live after activating the previous release")
+	}
+}
+
+func TestActivateAt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := NewManager(dir, fake.NewConnector(false, nil))
+	if err = m.Activate(); !errors.Is(err, ErrNothingStaged) {
+		t.Fatalf("expected ErrNothingStaged, got %v", err)
+	}
+
+	pcc := prepare(t, m, "scheduled.example.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = m.ActivateAt(ctx, time.Now().Add(time.Hour)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	st, _ := m.State()
+	if st.ActivateAt == nil || st.Live != "" {
+		t.Fatalf("activation should be pending: %+v", st)
+	}
+
+	if err = m.ActivateAt(context.Background(), time.Now().Add(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if liveCertificate(t, m) != pcc.Certificate {
+		t.Fatal("scheduled certificate should be live")
+	}
+}
@@ -0,0 +1,283 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sds
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	streamSecretsPath = "/envoy.service.secret.v3.SecretDiscoveryService/StreamSecrets"
+	fetchSecretsPath  = "/envoy.service.secret.v3.SecretDiscoveryService/FetchSecrets"
+
+	maxMessageSize = 4 << 20
+)
+
+// gRPC status codes
+const (
+	codeOK              = 0
+	codeInvalidArgument = 3
+	codeNotFound        = 5
+	codeUnimplemented   = 12
+	codeUnavailable     = 14
+)
+
+// ServeHTTP serves the StreamSecrets and FetchSecrets calls, over HTTP/2
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "only gRPC calls are served", http.StatusUnsupportedMediaType)
+		return
+	}
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC needs HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	switch r.URL.Path {
+	case streamSecretsPath:
+		s.stream(w, r)
+	case fetchSecretsPath:
+		s.fetch(w, r)
+	default:
+		w.WriteHeader(http.StatusOK)
+		finish(w, codeUnimplemented, "unknown method "+r.URL.Path)
+	}
+}
+
+// stream answers the requests of a proxy and sends it the secrets it watches again once they're renewed. A response
+// is acknowledged by the next request with its nonce, which is rejecting it when it has an error detail.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	requests := make(chan *discoveryRequest)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			req, err := readRequest(r.Body)
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		node    string
+		names   []string
+		nonce   string
+		version string
+	)
+	for {
+		changed := s.watch()
+		// a request for other secrets is answered even when their version is the one last sent
+		asked := false
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errs:
+			if err == io.EOF {
+				finish(w, codeOK, "")
+			} else {
+				finish(w, codeInvalidArgument, err.Error())
+			}
+			return
+		case req := <-requests:
+			if node == "" {
+				node = req.NodeID
+				s.logf("SDS stream opened by %s", describeNode(req))
+			}
+			if req.TypeURL != "" && req.TypeURL != SecretTypeURL {
+				finish(w, codeInvalidArgument, "unsupported resource type "+req.TypeURL)
+				return
+			}
+			if req.ResponseNonce != "" && req.ResponseNonce != nonce {
+				// answers a previous response, the proxy will answer the last one too
+				continue
+			}
+			if req.ErrorDetail != "" {
+				s.logf("%s rejected the secrets %s version %s: %s", describeNode(req), strings.Join(names, ", "), version, req.ErrorDetail)
+				continue
+			}
+			if req.ResponseNonce != "" && equalNames(names, req.ResourceNames) {
+				continue
+			}
+			names = req.ResourceNames
+			asked = true
+		case <-changed:
+		}
+		if len(names) == 0 {
+			continue
+		}
+		resp, err := s.response(ctx, names)
+		if err != nil {
+			finish(w, errorCode(err), err.Error())
+			return
+		}
+		if !asked && resp.VersionInfo == version {
+			continue
+		}
+		resp.Nonce = newNonce()
+		if err = writeMessage(w, resp.marshal()); err != nil {
+			return
+		}
+		nonce, version = resp.Nonce, resp.VersionInfo
+	}
+}
+
+// fetch answers a single request
+func (s *Server) fetch(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	req, err := readRequest(r.Body)
+	if err != nil {
+		finish(w, codeInvalidArgument, err.Error())
+		return
+	}
+	resp, err := s.response(r.Context(), req.ResourceNames)
+	if err != nil {
+		finish(w, errorCode(err), err.Error())
+		return
+	}
+	resp.Nonce = newNonce()
+	if err = writeMessage(w, resp.marshal()); err != nil {
+		return
+	}
+	finish(w, codeOK, "")
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func describeNode(req *discoveryRequest) string {
+	switch {
+	case req.NodeID == "":
+		return "an unnamed proxy"
+	case req.NodeCluster != "":
+		return req.NodeID + " of " + req.NodeCluster
+	}
+	return req.NodeID
+}
+
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, errUnknownSecret):
+		return codeNotFound
+	case errors.Is(err, verror.UserDataError):
+		return codeInvalidArgument
+	}
+	return codeUnavailable
+}
+
+func newNonce() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// readRequest reads a length-prefixed message, compression isn't accepted as no grpc-accept-encoding is sent
+func readRequest(body io.Reader) (*discoveryRequest, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated gRPC message")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, fmt.Errorf("compressed gRPC messages aren't supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("gRPC message of %d bytes is too large", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, fmt.Errorf("truncated gRPC message")
+	}
+	req := &discoveryRequest{}
+	if err := req.unmarshal(msg); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func writeMessage(w http.ResponseWriter, msg []byte) error {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	flush(w)
+	return nil
+}
+
+// finish ends the call with its status in the trailers
+func finish(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", percentEncode(message))
+	}
+}
+
+// percentEncode escapes a status message the way gRPC expects, only printable ASCII is kept as is
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sds
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// The few xDS messages of SDS are encoded by hand, the fields are the ones of envoy.service.discovery.v3 and
+// envoy.extensions.transport_sockets.tls.v3 which SDS needs, the others are skipped when decoding.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// discoveryRequest is a DiscoveryRequest. A request with a ResponseNonce acknowledges the response with that nonce,
+// or rejects it when ErrorDetail is set.
+type discoveryRequest struct {
+	VersionInfo   string
+	NodeID        string
+	NodeCluster   string
+	ResourceNames []string
+	TypeURL       string
+	ResponseNonce string
+	// ErrorDetail is the message of the google.rpc.Status of a rejected response
+	ErrorDetail string
+}
+
+// discoveryResponse is a DiscoveryResponse of Secret resources
+type discoveryResponse struct {
+	VersionInfo string
+	Resources   []secret
+	Nonce       string
+}
+
+// secret is a Secret holding either a TLS certificate or the CAs of a validation context, in PEM
+type secret struct {
+	Name             string
+	CertificateChain []byte
+	PrivateKey       []byte
+	TrustedCA        []byte
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendTag(b []byte, field int, wire int) []byte {
+	return appendVarint(b, uint64(field)<<3|uint64(wire))
+}
+
+// appendField appends a length-delimited field, an empty one is left out like proto3 does
+func appendField(b []byte, field int, data []byte) []byte {
+	if len(data) == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// appendMessage appends an embedded message, which is kept even when it's empty
+func appendMessage(b []byte, field int, data []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// dataSource is a DataSource with inline_bytes
+func dataSource(data []byte) []byte {
+	return appendField(nil, 2, data)
+}
+
+func (s secret) marshal() []byte {
+	b := appendField(nil, 1, []byte(s.Name))
+	if s.TrustedCA != nil {
+		// validation_context: CertificateValidationContext{trusted_ca}
+		return appendMessage(b, 4, appendMessage(nil, 1, dataSource(s.TrustedCA)))
+	}
+	// tls_certificate: TlsCertificate{certificate_chain, private_key}
+	var tc []byte
+	tc = appendMessage(tc, 1, dataSource(s.CertificateChain))
+	tc = appendMessage(tc, 2, dataSource(s.PrivateKey))
+	return appendMessage(b, 2, tc)
+}
+
+func (r *discoveryResponse) marshal() []byte {
+	b := appendField(nil, 1, []byte(r.VersionInfo))
+	for _, s := range r.Resources {
+		// google.protobuf.Any{type_url, value}
+		wrapped := appendField(nil, 1, []byte(SecretTypeURL))
+		wrapped = appendField(wrapped, 2, s.marshal())
+		b = appendMessage(b, 2, wrapped)
+	}
+	b = appendField(b, 4, []byte(SecretTypeURL))
+	return appendField(b, 5, []byte(r.Nonce))
+}
+
+// field is a decoded field, Data holds the value of a length-delimited one
+type field struct {
+	Number int
+	Wire   int
+	Data   []byte
+	Varint uint64
+}
+
+// fields decodes the fields of a message
+func fields(b []byte) ([]field, error) {
+	var result []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("%w: malformed protobuf tag", verror.UserDataError)
+		}
+		b = b[n:]
+		f := field{Number: int(tag >> 3), Wire: int(tag & 7)}
+		switch f.Wire {
+		case wireVarint:
+			f.Varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, fmt.Errorf("%w: malformed protobuf varint", verror.UserDataError)
+			}
+			b = b[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if f.Wire == wireFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return nil, fmt.Errorf("%w: truncated protobuf field", verror.UserDataError)
+			}
+			b = b[size:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, fmt.Errorf("%w: truncated protobuf field", verror.UserDataError)
+			}
+			f.Data = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			return nil, fmt.Errorf("%w: unsupported protobuf wire type %d", verror.UserDataError, f.Wire)
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+func (r *discoveryRequest) unmarshal(b []byte) error {
+	fs, err := fields(b)
+	if err != nil {
+		return err
+	}
+	for _, f := range fs {
+		if f.Wire != wireBytes {
+			continue
+		}
+		switch f.Number {
+		case 1:
+			r.VersionInfo = string(f.Data)
+		case 2:
+			// Node{id, cluster}
+			node, err := fields(f.Data)
+			if err != nil {
+				return err
+			}
+			for _, nf := range node {
+				switch {
+				case nf.Number == 1 && nf.Wire == wireBytes:
+					r.NodeID = string(nf.Data)
+				case nf.Number == 2 && nf.Wire == wireBytes:
+					r.NodeCluster = string(nf.Data)
+				}
+			}
+		case 3:
+			r.ResourceNames = append(r.ResourceNames, string(f.Data))
+		case 4:
+			r.TypeURL = string(f.Data)
+		case 5:
+			r.ResponseNonce = string(f.Data)
+		case 6:
+			// google.rpc.Status{code, message}
+			status, err := fields(f.Data)
+			if err != nil {
+				return err
+			}
+			r.ErrorDetail = "rejected"
+			for _, sf := range status {
+				if sf.Number == 2 && sf.Wire == wireBytes {
+					r.ErrorDetail = string(sf.Data)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sds serves certificates to Envoy proxies, like the sidecars of an Istio mesh, with the Secret Discovery
+// Service of the xDS APIs. A certificate is requested from the connector the first time a proxy asks for its secret
+// and renewed before it expires, the proxies receive the new one on their open streams without restarting.
+package sds
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	// SecretTypeURL is the type of the resources of SDS
+	SecretTypeURL = "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret"
+	// DefaultSecretName is the secret of the identity of the workload, the one Istio proxies ask for
+	DefaultSecretName = "default"
+	// RootSecretName is the validation context trusting the roots of the chain of the default secret, the peers of
+	// the mesh are verified with it
+	RootSecretName = "ROOTCA"
+
+	DefaultCheckInterval = time.Minute
+
+	retrieveTimeout = 3 * time.Minute
+)
+
+// errUnknownSecret is returned for the secrets no certificate is served as
+var errUnknownSecret = fmt.Errorf("%w: unknown secret", verror.UserDataError)
+
+// Server serves the secrets of SDS, it's the http.Handler of the gRPC service
+// envoy.service.secret.v3.SecretDiscoveryService. gRPC needs HTTP/2, which the server is given over TLS.
+type Server struct {
+	Connector endpoint.Connector
+	// Request returns the request of the certificate of the secret name, nil when no certificate is served as that
+	// secret. It's called for every certificate requested, a new request each time.
+	Request func(name string) (*certificate.Request, error)
+	// RenewBefore is how long before its expiry a certificate is renewed, a third of its validity by default
+	RenewBefore time.Duration
+	// Log receives progress messages when it's set
+	Log func(format string, args ...interface{})
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+
+	mu      sync.Mutex
+	secrets map[string]*entry
+	changed chan struct{}
+	// issuing serializes the requests, a proxy opening several streams gets a single certificate per secret
+	issuing sync.Mutex
+}
+
+// entry is a certificate served as a secret
+type entry struct {
+	cert *x509.Certificate
+	// chain is the certificate followed by the intermediates, the proxies send it to their peers
+	chain []byte
+	key   []byte
+	roots []byte
+}
+
+func (e *entry) version() string {
+	return fmt.Sprintf("%x", e.cert.SerialNumber)
+}
+
+// Check renews the certificates served which are about to expire, the streams waiting for them are notified. A
+// failed renewal is logged and tried again at the next check, the previous certificate is served meanwhile.
+func (s *Server) Check(ctx context.Context) error {
+	s.mu.Lock()
+	var due []string
+	for name, e := range s.secrets {
+		if s.now().After(e.cert.NotAfter.Add(-s.renewBefore(e.cert))) {
+			due = append(due, name)
+		}
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, name := range due {
+		s.logf("Renewing the certificate of secret %s", name)
+		e, err := s.issue(ctx, name)
+		if err != nil {
+			s.logf("Failed to renew the certificate of secret %s: %s", name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		s.store(name, e)
+	}
+	return firstErr
+}
+
+// Run checks the certificates every interval until ctx is done
+func (s *Server) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = s.Check(ctx)
+		}
+	}
+}
+
+// watch returns a channel closed once a certificate changes
+func (s *Server) watch() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.changed == nil {
+		s.changed = make(chan struct{})
+	}
+	return s.changed
+}
+
+func (s *Server) store(name string, e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.secrets == nil {
+		s.secrets = make(map[string]*entry)
+	}
+	s.secrets[name] = e
+	if s.changed != nil {
+		close(s.changed)
+	}
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) cached(name string) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.secrets[name]
+}
+
+// entry returns the certificate of a secret, requesting it the first time
+func (s *Server) entry(ctx context.Context, name string) (*entry, error) {
+	if e := s.cached(name); e != nil {
+		return e, nil
+	}
+	s.issuing.Lock()
+	defer s.issuing.Unlock()
+	// another stream may have requested it meanwhile
+	if e := s.cached(name); e != nil {
+		return e, nil
+	}
+	s.logf("Requesting the certificate of secret %s", name)
+	e, err := s.request(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.store(name, e)
+	return e, nil
+}
+
+func (s *Server) issue(ctx context.Context, name string) (*entry, error) {
+	s.issuing.Lock()
+	defer s.issuing.Unlock()
+	return s.request(ctx, name)
+}
+
+func (s *Server) request(ctx context.Context, name string) (*entry, error) {
+	if s.Request == nil {
+		return nil, fmt.Errorf("%w: no certificate requests configured", verror.UserDataError)
+	}
+	req, err := s.Request(name)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, fmt.Errorf("%w %q", errUnknownSecret, name)
+	}
+	if req.CsrOrigin == certificate.ServiceGeneratedCSR {
+		return nil, fmt.Errorf("%w: the proxies need the private key in clear, it can't be generated by the service", verror.UserDataError)
+	}
+	zc, err := s.Connector.ReadZoneConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read zone configuration: %w", err)
+	}
+	err = s.Connector.GenerateRequest(zc, req)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	req.PickupID, err = s.Connector.RequestCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	req.ChainOption = certificate.ChainOptionRootLast
+	req.Timeout = retrieveTimeout
+	pcc, err := s.Connector.RetrieveCertificate(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.CsrOrigin == certificate.LocalGeneratedCSR {
+		err = pcc.AddPrivateKey(req.PrivateKey, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pcc.PrivateKey == "" {
+		return nil, fmt.Errorf("%w: the certificate of secret %q was issued without its private key", verror.ServerBadDataResponce, name)
+	}
+	return newEntry(pcc)
+}
+
+// newEntry splits the chain of the certificate between the intermediates, sent by the proxies, and the roots
+func newEntry(pcc *certificate.PEMCollection) (*entry, error) {
+	e := &entry{chain: []byte(pcc.Certificate), key: []byte(pcc.PrivateKey)}
+	b, _ := pem.Decode(e.chain)
+	if b == nil {
+		return nil, fmt.Errorf("%w: failed to decode certificate PEM", verror.ServerBadDataResponce)
+	}
+	var err error
+	e.cert, err = x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	var last string
+	for _, c := range pcc.Chain {
+		b, _ := pem.Decode([]byte(c))
+		if b == nil {
+			return nil, fmt.Errorf("%w: failed to decode chain certificate PEM", verror.ServerBadDataResponce)
+		}
+		ca, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(ca.RawIssuer, ca.RawSubject) {
+			e.roots = append(e.roots, c...)
+		} else {
+			e.chain = append(e.chain, c...)
+		}
+		last = c
+	}
+	// without the root in the chain, the last CA is the anchor the peers are verified with
+	if e.roots == nil && last != "" {
+		e.roots = []byte(last)
+	}
+	return e, nil
+}
+
+// lookup returns the resource of a secret and its version
+func (s *Server) lookup(ctx context.Context, name string) (secret, string, error) {
+	if name == RootSecretName {
+		e, err := s.entry(ctx, DefaultSecretName)
+		if err != nil {
+			return secret{}, "", err
+		}
+		if len(e.roots) == 0 {
+			return secret{}, "", fmt.Errorf("%w: the certificate of secret %s was issued without its chain", verror.ServerBadDataResponce, DefaultSecretName)
+		}
+		sum := sha256.Sum256(e.roots)
+		return secret{Name: name, TrustedCA: e.roots}, hex.EncodeToString(sum[:8]), nil
+	}
+	e, err := s.entry(ctx, name)
+	if err != nil {
+		return secret{}, "", err
+	}
+	return secret{Name: name, CertificateChain: e.chain, PrivateKey: e.key}, e.version(), nil
+}
+
+// response returns the response holding the secrets names, its version is the one of all of them
+func (s *Server) response(ctx context.Context, names []string) (*discoveryResponse, error) {
+	resp := &discoveryResponse{}
+	versions := make([]string, 0, len(names))
+	for _, name := range names {
+		res, version, err := s.lookup(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		resp.Resources = append(resp.Resources, res)
+		versions = append(versions, version)
+	}
+	resp.VersionInfo = strings.Join(versions, ",")
+	return resp, nil
+}
+
+func (s *Server) renewBefore(cert *x509.Certificate) time.Duration {
+	if s.RenewBefore > 0 {
+		return s.RenewBefore
+	}
+	return cert.NotAfter.Sub(cert.NotBefore) / 3
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Log != nil {
+		s.Log(format, args...)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sds
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+// listen serves s over TLS with a self-signed certificate, HTTP/2 is negotiated
+func listen(t *testing.T, s *Server) (string, func()) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sds"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: s, TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}}
+	go func() { _ = server.ServeTLS(ln, "", "") }()
+	return "https://" + ln.Addr().String(), func() { _ = server.Close() }
+}
+
+func client() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+}
+
+func newServer() *Server {
+	return &Server{
+		Connector: fake.NewConnector(false, nil),
+		Request: func(name string) (*certificate.Request, error) {
+			if name != DefaultSecretName {
+				return nil, nil
+			}
+			spiffe, _ := url.Parse("spiffe://cluster.local/ns/shop/sa/web")
+			req := &certificate.Request{KeyType: certificate.KeyTypeECDSA, URIs: []*url.URL{spiffe}}
+			req.Subject.CommonName = "web.shop.svc"
+			return req, nil
+		},
+	}
+}
+
+func encodeRequest(req *discoveryRequest) []byte {
+	b := appendField(nil, 1, []byte(req.VersionInfo))
+	b = appendMessage(b, 2, appendField(nil, 1, []byte(req.NodeID)))
+	for _, name := range req.ResourceNames {
+		b = appendField(b, 3, []byte(name))
+	}
+	b = appendField(b, 4, []byte(SecretTypeURL))
+	b = appendField(b, 5, []byte(req.ResponseNonce))
+	msg := make([]byte, 5, 5+len(b))
+	binary.BigEndian.PutUint32(msg[1:], uint32(len(b)))
+	return append(msg, b...)
+}
+
+// readResponse decodes a response into its version, nonce and secrets
+func readResponse(t *testing.T, body io.Reader) (*discoveryResponse, []map[int][]byte) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	msg := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(body, msg); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := fields(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &discoveryResponse{}
+	var secrets []map[int][]byte
+	for _, f := range fs {
+		switch f.Number {
+		case 1:
+			resp.VersionInfo = string(f.Data)
+		case 5:
+			resp.Nonce = string(f.Data)
+		case 2:
+			wrapped, _ := fields(f.Data)
+			if string(wrapped[0].Data) != SecretTypeURL {
+				t.Fatalf("unexpected resource type %s", wrapped[0].Data)
+			}
+			// the name, then the TLS certificate or the validation context
+			secretFields, _ := fields(wrapped[1].Data)
+			s := map[int][]byte{}
+			for _, sf := range secretFields {
+				s[sf.Number] = sf.Data
+			}
+			secrets = append(secrets, s)
+		}
+	}
+	return resp, secrets
+}
+
+// inline returns the inline bytes of the data sources of a message
+func inline(t *testing.T, msg []byte) [][]byte {
+	fs, err := fields(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result [][]byte
+	for _, f := range fs {
+		ds, _ := fields(f.Data)
+		result = append(result, ds[0].Data)
+	}
+	return result
+}
+
+func TestStreamSecrets(t *testing.T) {
+	s := newServer()
+	address, stop := listen(t, s)
+	defer stop()
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, address+streamSecretsPath, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	go func() {
+		_, _ = pw.Write(encodeRequest(&discoveryRequest{NodeID: "sidecar~10.0.0.1~web", ResourceNames: []string{DefaultSecretName, RootSecretName}}))
+	}()
+	resp, err := client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	first, secrets := readResponse(t, resp.Body)
+	if len(secrets) != 2 || string(secrets[0][1]) != DefaultSecretName || string(secrets[1][1]) != RootSecretName {
+		t.Fatalf("unexpected secrets %v", secrets)
+	}
+	pair := inline(t, secrets[0][2])
+	if _, err = tls.X509KeyPair(pair[0], pair[1]); err != nil {
+		t.Fatalf("the certificate and key served don't match: %s", err)
+	}
+	b, _ := pem.Decode(pair[0])
+	cert, err := x509.ParseCertificate(b.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://cluster.local/ns/shop/sa/web" {
+		t.Fatalf("unexpected identity %v", cert.URIs)
+	}
+	roots := inline(t, secrets[1][4])
+	if !bytes.Contains(roots[0], []byte("BEGIN CERTIFICATE")) {
+		t.Fatalf("unexpected trusted CA %s", roots[0])
+	}
+
+	// acknowledged, nothing is sent until the certificate is renewed
+	_, _ = pw.Write(encodeRequest(&discoveryRequest{VersionInfo: first.VersionInfo, ResponseNonce: first.Nonce, ResourceNames: []string{DefaultSecretName, RootSecretName}}))
+	s.Now = func() time.Time { return cert.NotAfter.Add(-time.Hour) }
+	if err = s.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	second, secrets := readResponse(t, resp.Body)
+	if second.VersionInfo == first.VersionInfo || second.Nonce == first.Nonce || len(secrets) != 2 {
+		t.Fatalf("the renewed certificate wasn't sent: version %s", second.VersionInfo)
+	}
+
+	pw.Close()
+	if _, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if status := resp.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("unexpected status %s: %s", status, resp.Trailer.Get("Grpc-Message"))
+	}
+}
+
+func TestFetchUnknownSecret(t *testing.T) {
+	address, stop := listen(t, newServer())
+	defer stop()
+
+	body := bytes.NewReader(encodeRequest(&discoveryRequest{ResourceNames: []string{"payments"}}))
+	resp, err := client().Post(address+fetchSecretsPath, "application/grpc", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if status := resp.Trailer.Get("Grpc-Status"); status != "5" {
+		t.Fatalf("expected the not found status, got %s: %s", status, resp.Trailer.Get("Grpc-Message"))
+	}
+}
+
+func TestPercentEncode(t *testing.T) {
+	if s := percentEncode("100% sûr\n"); s != "100%25 s%C3%BBr%0A" {
+		t.Fatalf("unexpected encoding %s", s)
+	}
+}
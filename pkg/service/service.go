@@ -0,0 +1,116 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package service installs the renewal daemon as a native service: a Windows service logging to the event log, or
+// a launchd daemon on macOS. Linux hosts use a systemd unit, which the daemon supports with sd_notify.
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// DefaultName is the name of the service when none is given
+const DefaultName = "vcert"
+
+// ErrUnsupported is returned on the systems without a supported service manager
+var ErrUnsupported = errors.New("native services are only supported on Windows and macOS, use a systemd unit instead")
+
+// Config describes the service
+type Config struct {
+	// Name identifies the service, it defaults to DefaultName. The launchd label is "com.venafi." followed by the name.
+	Name        string
+	DisplayName string
+	Description string
+	// Executable defaults to the running executable
+	Executable string
+	// Args are the arguments the executable is started with
+	Args []string
+}
+
+func (c *Config) defaults() error {
+	if c.Name == "" {
+		c.Name = DefaultName
+	}
+	if c.DisplayName == "" {
+		c.DisplayName = c.Name
+	}
+	if c.Executable == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find the executable of the service: %s", err)
+		}
+		c.Executable = exe
+	}
+	return nil
+}
+
+func nameOrDefault(name string) string {
+	if name == "" {
+		return DefaultName
+	}
+	return name
+}
+
+func launchdLabel(name string) string {
+	return "com.venafi." + nameOrDefault(name)
+}
+
+// launchdPlist returns the property list of the launchd daemon of cfg. The daemon is restarted when it fails,
+// but not when it's stopped, and its output is appended to a log file of /Library/Logs.
+func launchdPlist(cfg Config) ([]byte, error) {
+	if cfg.Executable == "" {
+		return nil, fmt.Errorf("%w: the executable of the service is required", verror.UserDataError)
+	}
+	label := launchdLabel(cfg.Name)
+	logFile := "/Library/Logs/" + label + ".log"
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	key := func(k string) {
+		b.WriteString("\t<key>" + k + "</key>\n")
+	}
+	str := func(indent, s string) {
+		b.WriteString(indent + "<string>")
+		_ = xml.EscapeText(&b, []byte(s))
+		b.WriteString("</string>\n")
+	}
+	key("Label")
+	str("\t", label)
+	key("ProgramArguments")
+	b.WriteString("\t<array>\n")
+	str("\t\t", cfg.Executable)
+	for _, arg := range cfg.Args {
+		str("\t\t", arg)
+	}
+	b.WriteString("\t</array>\n")
+	key("RunAtLoad")
+	b.WriteString("\t<true/>\n")
+	key("KeepAlive")
+	b.WriteString("\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>\n\t</dict>\n")
+	key("StandardOutPath")
+	str("\t", logFile)
+	key("StandardErrorPath")
+	str("\t", logFile)
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes(), nil
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const launchDaemonsDir = "/Library/LaunchDaemons"
+
+func plistPath(name string) string {
+	return filepath.Join(launchDaemonsDir, launchdLabel(name)+".plist")
+}
+
+// Install writes the launchd daemon of cfg and loads it, so it's started now and at boot
+func Install(cfg Config) error {
+	err := cfg.defaults()
+	if err != nil {
+		return err
+	}
+	plist, err := launchdPlist(cfg)
+	if err != nil {
+		return err
+	}
+	path := plistPath(cfg.Name)
+	if _, err = os.Stat(path); err == nil {
+		return fmt.Errorf("service %s is already installed in %s", cfg.Name, path)
+	}
+	err = ioutil.WriteFile(path, plist, 0644)
+	if err != nil {
+		return err
+	}
+	return launchctl("load", "-w", path)
+}
+
+// Uninstall unloads the launchd daemon called name and removes it
+func Uninstall(name string) error {
+	path := plistPath(name)
+	err := launchctl("unload", "-w", path)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Start starts the launchd daemon called name
+func Start(name string) error {
+	return launchctl("start", launchdLabel(name))
+}
+
+// Stop stops the launchd daemon called name
+func Stop(name string) error {
+	return launchctl("stop", launchdLabel(name))
+}
+
+// Run returns false, launchd runs the daemon as a plain process stopped with SIGTERM
+func Run(name string, run func(ctx context.Context) error) (bool, error) {
+	return false, nil
+}
+
+// EventLog is only supported on Windows, launchd writes the output of the daemon to its log file
+func EventLog(name string) (io.WriteCloser, error) {
+	return nil, ErrUnsupported
+}
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s failed: %s: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"io"
+)
+
+// Install is not supported, see ErrUnsupported
+func Install(cfg Config) error {
+	return ErrUnsupported
+}
+
+// Uninstall is not supported, see ErrUnsupported
+func Uninstall(name string) error {
+	return ErrUnsupported
+}
+
+// Start is not supported, see ErrUnsupported
+func Start(name string) error {
+	return ErrUnsupported
+}
+
+// Stop is not supported, see ErrUnsupported
+func Stop(name string) error {
+	return ErrUnsupported
+}
+
+// Run returns false, the daemon is run as a plain process
+func Run(name string, run func(ctx context.Context) error) (bool, error) {
+	return false, nil
+}
+
+// EventLog is not supported, see ErrUnsupported
+func EventLog(name string) (io.WriteCloser, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLaunchdPlist(t *testing.T) {
+	plist, err := launchdPlist(Config{
+		Executable: "/usr/local/bin/vcert",
+		Args:       []string{"run", "--daemon", "--file", "/etc/vcert/a&b.yaml"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(plist)
+	for _, want := range []string{
+		"<key>Label</key>\n\t<string>com.venafi.vcert</string>",
+		"<string>/usr/local/bin/vcert</string>\n\t\t<string>run</string>\n\t\t<string>--daemon</string>",
+		"<string>/etc/vcert/a&amp;b.yaml</string>",
+		"<key>SuccessfulExit</key>\n\t\t<false/>",
+		"<string>/Library/Logs/com.venafi.vcert.log</string>",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("plist doesn't contain %q:\n%s", want, s)
+		}
+	}
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		_, err := d.Token()
+		if err != nil {
+			if err != io.EOF {
+				t.Errorf("plist is not well formed: %s", err)
+			}
+			break
+		}
+	}
+
+	if _, err = launchdPlist(Config{}); err == nil {
+		t.Error("expected an error without executable")
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// stopTimeout bounds the wait for the service to stop
+const stopTimeout = 30 * time.Second
+
+// Install creates the Windows service of cfg, started automatically at boot, and registers its event log source
+func Install(cfg Config) error {
+	err := cfg.defaults()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %s", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(cfg.Name)
+	if err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", cfg.Name)
+	}
+	s, err = m.CreateService(cfg.Name, cfg.Executable, mgr.Config{
+		DisplayName: cfg.DisplayName,
+		Description: cfg.Description,
+		StartType:   mgr.StartAutomatic,
+	}, cfg.Args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service %s: %s", cfg.Name, err)
+	}
+	defer s.Close()
+	err = eventlog.InstallAsEventCreate(cfg.Name, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		_ = s.Delete()
+		return fmt.Errorf("failed to register the event log source of service %s: %s", cfg.Name, err)
+	}
+	return nil
+}
+
+// Uninstall deletes the Windows service called name and its event log source
+func Uninstall(name string) error {
+	name = nameOrDefault(name)
+	s, err := openService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	err = s.Delete()
+	if err != nil {
+		return fmt.Errorf("failed to delete service %s: %s", name, err)
+	}
+	return eventlog.Remove(name)
+}
+
+// Start starts the Windows service called name
+func Start(name string) error {
+	name = nameOrDefault(name)
+	s, err := openService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	err = s.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start service %s: %s", name, err)
+	}
+	return nil
+}
+
+// Stop stops the Windows service called name and waits until it's stopped
+func Stop(name string) error {
+	name = nameOrDefault(name)
+	s, err := openService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return fmt.Errorf("failed to stop service %s: %s", name, err)
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %s didn't stop within %s", name, stopTimeout)
+		}
+		time.Sleep(300 * time.Millisecond)
+		status, err = s.Query()
+		if err != nil {
+			return fmt.Errorf("failed to query service %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func openService(name string) (*mgr.Service, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the service manager: %s", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return nil, fmt.Errorf("service %s is not installed: %s", name, err)
+	}
+	return s, nil
+}
+
+// Run runs run as the Windows service called name when the process was started by the service manager, the
+// context of run is cancelled when the service is stopped. It returns false when the process isn't a service.
+func Run(name string, run func(ctx context.Context) error) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return false, err
+	}
+	h := &handler{run: run}
+	err = svc.Run(nameOrDefault(name), h)
+	if err == nil {
+		err = h.err
+	}
+	return true, err
+}
+
+type handler struct {
+	run func(ctx context.Context) error
+	err error
+}
+
+func (h *handler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run(ctx)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case h.err = <-done:
+			changes <- svc.Status{State: svc.StopPending}
+			if h.err != nil {
+				return false, 1
+			}
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				cancel()
+				h.err = <-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// EventLog returns a writer logging every write as an information event of the event log source called name
+func EventLog(name string) (io.WriteCloser, error) {
+	l, err := eventlog.Open(nameOrDefault(name))
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogWriter{l: l}, nil
+}
+
+type eventLogWriter struct {
+	l *eventlog.Log
+}
+
+func (w *eventLogWriter) Write(p []byte) (int, error) {
+	err := w.l.Info(1, strings.TrimRight(string(p), "\r\n"))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *eventLogWriter) Close() error {
+	return w.l.Close()
+}
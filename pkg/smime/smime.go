@@ -0,0 +1,233 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package smime issues the certificates mail clients sign and encrypt mail with. The certificate names the mailboxes
+// in rfc822Name SANs and has the emailProtection extended key usage, and it is returned with its private key and
+// chain in a password-protected PKCS#12 file, which Outlook, Apple Mail and Thunderbird import.
+package smime
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/escrow"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const retrieveTimeout = 180 * time.Second
+
+// Request describes the certificate of a mail user. The key settings have the defaults of certificate.Request.
+type Request struct {
+	// Zone is the zone of the certificate, the one of the connector when empty
+	Zone string
+	// Emails are the mailbox addresses of the certificate, alice@example.com, not Alice <alice@example.com>
+	Emails []string
+	// CommonName is the first email address when empty
+	CommonName    string
+	KeyType       certificate.KeyType
+	KeyLength     int
+	KeyCurve      certificate.EllipticCurve
+	ValidityHours int
+	// Escrow has the platform generate the private key and keep it, so that the mail encrypted to the certificate
+	// can still be read once the user lost the key. The escrow package retrieves it again with the pickup ID.
+	Escrow bool
+	// Password protects the PKCS#12 file, and the private key while the platform sends it when Escrow is set. It is
+	// required: a mail client doesn't import a PKCS#12 file without one.
+	Password string
+}
+
+// Result is the issued certificate
+type Result struct {
+	// PEM is the certificate, its chain and its unencrypted private key
+	PEM *certificate.PEMCollection
+	// PKCS12 is the certificate, its chain and its private key encrypted with the password of the request
+	PKCS12 []byte
+	// PickupID identifies the certificate on the platform, e.g. to retrieve an escrowed key
+	PickupID string
+}
+
+// Enroll requests the S/MIME certificate of req. The request is checked against the policy of the zone before it's
+// sent, and the issued certificate is checked to hold the email addresses and the emailProtection extended key usage,
+// which the CA may not have kept.
+func Enroll(ctx context.Context, connector endpoint.Connector, req Request) (*Result, error) {
+	if req.Password == "" {
+		return nil, fmt.Errorf("%w: a password is required to protect the PKCS#12 file", verror.UserDataError)
+	}
+	r, err := req.build()
+	if err != nil {
+		return nil, err
+	}
+	if req.Zone != "" {
+		connector.SetZone(req.Zone)
+	}
+	zc, err := connector.ReadZoneConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("could not read zone configuration: %w", err)
+	}
+	err = connector.GenerateRequest(zc, r)
+	if err != nil {
+		return nil, err
+	}
+	err = zc.ValidateCertificateRequest(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: the request doesn't match the policy of the zone: %s", verror.PolicyValidationError, err)
+	}
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.PickupID, err = connector.RequestCertificate(r)
+	if err != nil {
+		return nil, err
+	}
+	r.Timeout = retrieveTimeout
+	pcc, err := connector.RetrieveCertificate(r)
+	if err != nil {
+		return nil, err
+	}
+	key := r.PrivateKey
+	if req.Escrow {
+		// the certificate is issued now, its key is retrieved out of escrow, which proves the platform kept it
+		pcc, err = escrow.RetrievePrivateKey(connector, &escrow.Request{
+			PickupID:    r.PickupID,
+			Password:    req.Password,
+			ChainOption: r.ChainOption,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve the escrowed private key: %w", err)
+		}
+		key, err = parsePrivateKey(pcc.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err = pcc.AddPrivateKey(key, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cert, err := parseCertificate(pcc.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	err = check(cert, r.EmailAddresses)
+	if err != nil {
+		return nil, err
+	}
+	p12, err := encodePKCS12(cert, pcc.Chain, key, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{PEM: pcc, PKCS12: p12, PickupID: r.PickupID}, nil
+}
+
+func (req Request) build() (*certificate.Request, error) {
+	if len(req.Emails) == 0 {
+		return nil, fmt.Errorf("%w: an S/MIME certificate needs an email address", verror.UserDataError)
+	}
+	b := certificate.NewRequestBuilder().
+		EmailAddresses(req.Emails...).
+		KeyType(req.KeyType).
+		ChainOption(certificate.ChainOptionRootLast)
+	if req.CommonName != "" {
+		b.CommonName(req.CommonName)
+	}
+	if req.KeyLength != 0 {
+		b.KeyLength(req.KeyLength)
+	}
+	if req.KeyCurve != certificate.EllipticCurveNotSet {
+		b.KeyCurve(req.KeyCurve)
+	}
+	if req.ValidityHours != 0 {
+		b.ValidityHours(req.ValidityHours)
+	}
+	if req.Escrow {
+		b.CsrOrigin(certificate.ServiceGeneratedCSR).KeyPassword(req.Password)
+	}
+	return b.Profile(certificate.ProfileEmailProtection).Build()
+}
+
+// check checks the certificate can sign and encrypt the mail of the addresses. A certificate without extended key
+// usages can be used for any, which mail clients accept, but the issuance then ignored the profile.
+func check(cert *x509.Certificate, emails []string) error {
+	found := false
+	for _, u := range cert.ExtKeyUsage {
+		if u == x509.ExtKeyUsageAny {
+			return fmt.Errorf("%w: the certificate was issued with the any extended key usage", verror.CertificateCheckError)
+		}
+		found = found || u == x509.ExtKeyUsageEmailProtection
+	}
+	if !found {
+		return fmt.Errorf("%w: the certificate was issued without the emailProtection extended key usage, check the policy of the zone", verror.CertificateCheckError)
+	}
+	for _, email := range emails {
+		issued := false
+		for _, e := range cert.EmailAddresses {
+			issued = issued || strings.EqualFold(e, email)
+		}
+		if !issued {
+			return fmt.Errorf("%w: the certificate was issued without the email address %s", verror.CertificateCheckError, email)
+		}
+	}
+	return nil
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("%w: failed to decode the issued certificate", verror.ServerError)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// encodePKCS12 encodes the certificate, its chain and its key, encrypted with the legacy algorithms the mail clients
+// of Windows and macOS still require
+func encodePKCS12(cert *x509.Certificate, chainPEM []string, key crypto.Signer, password string) ([]byte, error) {
+	var chain []*x509.Certificate
+	for _, c := range chainPEM {
+		ca, err := parseCertificate(c)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, ca)
+	}
+	return pkcs12.Encode(rand.Reader, key, cert, chain, password)
+}
+
+// parsePrivateKey parses the unencrypted private key of the escrow package
+func parsePrivateKey(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data found in the private key", verror.ServerBadDataResponce)
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	return certificate.ParsePKCS8PrivateKey(block.Bytes)
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package smime
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestEnroll(t *testing.T) {
+	for _, escrow := range []bool{false, true} {
+		res, err := Enroll(context.Background(), fake.NewConnector(false, nil), Request{
+			Emails:   []string{"alice@example.com", "alice.smith@example.com"},
+			KeyType:  certificate.KeyTypeRSA,
+			Escrow:   escrow,
+			Password: "Passw0rd!",
+		})
+		if err != nil {
+			t.Fatalf("escrow %v: %s", escrow, err)
+		}
+		cert, err := parseCertificate(res.PEM.Certificate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.Subject.CommonName != "alice@example.com" || len(cert.EmailAddresses) != 2 || len(cert.ExtKeyUsage) != 1 ||
+			cert.ExtKeyUsage[0] != x509.ExtKeyUsageEmailProtection {
+			t.Fatalf("escrow %v: unexpected certificate %s %v %v", escrow, cert.Subject, cert.EmailAddresses, cert.ExtKeyUsage)
+		}
+		if res.PEM.PrivateKey == "" || res.PickupID == "" {
+			t.Fatalf("escrow %v: expected the private key and the pickup ID", escrow)
+		}
+
+		blocks, err := pkcs12.ToPEM(res.PKCS12, "Passw0rd!")
+		if err != nil {
+			t.Fatalf("escrow %v: %s", escrow, err)
+		}
+		types := map[string]int{}
+		for _, b := range blocks {
+			types[b.Type]++
+		}
+		if types["PRIVATE KEY"] != 1 || types["CERTIFICATE"] != 2 {
+			t.Fatalf("escrow %v: unexpected PKCS#12 content %v", escrow, types)
+		}
+		if _, err = pkcs12.ToPEM(res.PKCS12, "wrong"); err == nil {
+			t.Fatalf("escrow %v: expected the PKCS#12 file to be protected by the password", escrow)
+		}
+	}
+}
+
+func TestEnrollInvalid(t *testing.T) {
+	for name, req := range map[string]Request{
+		"no password":  {Emails: []string{"alice@example.com"}},
+		"no email":     {CommonName: "Alice", Password: "Passw0rd!"},
+		"display name": {Emails: []string{"Alice <alice@example.com>"}, Password: "Passw0rd!"},
+		"other name":   {Emails: []string{"alice@example.com"}, CommonName: "bob@example.com", Password: "Passw0rd!"},
+	} {
+		_, err := Enroll(context.Background(), fake.NewConnector(false, nil), req)
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("%s: expected a user data error, got %v", name, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cert := &x509.Certificate{EmailAddresses: []string{"Alice@example.com"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}}
+	if err := check(cert, []string{"alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := check(cert, []string{"bob@example.com"}); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected a certificate check error for a missing address, got %v", err)
+	}
+	cert.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	if err := check(cert, []string{"alice@example.com"}); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected a certificate check error for a missing usage, got %v", err)
+	}
+}
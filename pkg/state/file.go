@@ -0,0 +1,88 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// File saves each key in a file of Dir. The files are only readable by their owner as the state holds private
+// keys and tokens.
+type File struct {
+	Dir string
+}
+
+func (s *File) Load(_ context.Context, key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read state: %s", verror.UserDataError, err)
+	}
+	return data, nil
+}
+
+// Save writes the value to a temporary file renamed over the previous one, so a crash never leaves a partial value
+func (s *File) Save(_ context.Context, key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create state directory: %s", verror.UserDataError, err)
+	}
+	f, err := ioutil.TempFile(s.Dir, "."+key+".*")
+	if err != nil {
+		return fmt.Errorf("%w: failed to write state: %s", verror.UserDataError, err)
+	}
+	_, err = f.Write(value)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(s.Dir, key))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("%w: failed to write state: %s", verror.UserDataError, err)
+	}
+	return nil
+}
+
+func (s *File) Delete(_ context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.Dir, key))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("%w: failed to delete state: %s", verror.UserDataError, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/Venafi/vcert/v4/pkg/kubernetes"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// conflictRetries is how many times a write is attempted again when another process changed the object since it
+// was read
+const conflictRetries = 5
+
+// Kubernetes saves the keys in a config map, or in a secret when Secret is set, so the state of a daemon running in
+// a pod survives the pod. The object is created by the first Save.
+type Kubernetes struct {
+	Client *kubernetes.Client
+	// Namespace is the namespace of the object, the namespace of the client when it's empty
+	Namespace string
+	Name      string
+	// Secret keeps the state in a secret rather than a config map, it should be set when the state holds private
+	// keys or tokens
+	Secret bool
+}
+
+// object is the data of the config map or the secret with its metadata
+type object struct {
+	meta kubernetes.ObjectMeta
+	data map[string][]byte
+}
+
+func (s *Kubernetes) Load(ctx context.Context, key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	obj, err := s.get(ctx)
+	if kubernetes.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, ok := obj.data[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *Kubernetes) Save(ctx context.Context, key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return s.update(ctx, func(data map[string][]byte) bool {
+		data[key] = value
+		return true
+	})
+}
+
+func (s *Kubernetes) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	return s.update(ctx, func(data map[string][]byte) bool {
+		_, ok := data[key]
+		delete(data, key)
+		return ok
+	})
+}
+
+// update changes the data of the object with change and writes it when change returns true. The object is read
+// again and the change retried when another process wrote it in between.
+func (s *Kubernetes) update(ctx context.Context, change func(map[string][]byte) bool) error {
+	var err error
+	for i := 0; i < conflictRetries; i++ {
+		var obj *object
+		obj, err = s.get(ctx)
+		if kubernetes.IsNotFound(err) {
+			obj, err = &object{meta: kubernetes.ObjectMeta{Name: s.Name, Namespace: s.Namespace}}, nil
+		}
+		if err != nil {
+			return err
+		}
+		if obj.data == nil {
+			obj.data = make(map[string][]byte)
+		}
+		if !change(obj.data) {
+			return nil
+		}
+		err = s.put(ctx, obj)
+		if !kubernetes.IsConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: state %s was changed by other processes %d times: %s", verror.ServerTemporaryUnavailableError, s.Name, conflictRetries, err)
+}
+
+func (s *Kubernetes) get(ctx context.Context) (*object, error) {
+	if s.Secret {
+		var secret kubernetes.Secret
+		err := s.Client.Get(ctx, s.path(), &secret)
+		if err != nil {
+			return nil, err
+		}
+		return &object{meta: secret.Metadata, data: secret.Data}, nil
+	}
+	var cm kubernetes.ConfigMap
+	err := s.Client.Get(ctx, s.path(), &cm)
+	if err != nil {
+		return nil, err
+	}
+	data := cm.BinaryData
+	if data == nil {
+		data = make(map[string][]byte)
+	}
+	// values written by hand are kept in data
+	for k, v := range cm.Data {
+		if _, ok := data[k]; !ok {
+			data[k] = []byte(v)
+		}
+	}
+	return &object{meta: cm.Metadata, data: data}, nil
+}
+
+// put creates the object, or replaces it when it was read. Both fail with a conflict when another process created
+// or changed it since.
+func (s *Kubernetes) put(ctx context.Context, obj *object) error {
+	var in interface{}
+	if s.Secret {
+		in = &kubernetes.Secret{APIVersion: "v1", Kind: "Secret", Metadata: obj.meta, Type: "Opaque", Data: obj.data}
+	} else {
+		// the values are moved to binaryData as a key can't be in both
+		in = &kubernetes.ConfigMap{APIVersion: "v1", Kind: "ConfigMap", Metadata: obj.meta, BinaryData: obj.data}
+	}
+	if obj.meta.ResourceVersion == "" {
+		return s.Client.Create(ctx, s.collection(), in, in)
+	}
+	return s.Client.Replace(ctx, s.path(), in, in)
+}
+
+func (s *Kubernetes) collection() string {
+	namespace := s.Namespace
+	if namespace == "" {
+		namespace = s.Client.Namespace
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	if s.Secret {
+		return kubernetes.SecretsPath(namespace)
+	}
+	return kubernetes.ConfigMapsPath(namespace)
+}
+
+func (s *Kubernetes) path() string {
+	return s.collection() + "/" + url.PathEscape(s.Name)
+}
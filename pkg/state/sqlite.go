@@ -0,0 +1,133 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// DefaultTable is the table of the state in a SQLite database
+const DefaultTable = "vcert_state"
+
+// sqliteDrivers are the names the SQLite drivers register, github.com/mattn/go-sqlite3 and modernc.org/sqlite
+var sqliteDrivers = []string{"sqlite3", "sqlite"}
+
+// SQLite saves the keys in a table of a SQLite database. This package doesn't link a SQLite driver, the vcert command
+// links modernc.org/sqlite and other programs that use this store import one, e.g. github.com/mattn/go-sqlite3.
+type SQLite struct {
+	DB *sql.DB
+	// Table is the table of the state, it defaults to DefaultTable. It's created by Init.
+	Table string
+}
+
+// OpenSQLite opens the SQLite database at path and creates the table of the state
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := OpenSQLiteDB(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLite{DB: db}
+	err = s.Init(context.Background())
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenSQLiteDB opens the SQLite database at path with the SQLite driver registered by the build
+func OpenSQLiteDB(path string) (*sql.DB, error) {
+	driver := ""
+	for _, name := range sql.Drivers() {
+		for _, d := range sqliteDrivers {
+			if name == d && driver == "" {
+				driver = name
+			}
+		}
+	}
+	if driver == "" {
+		return nil, fmt.Errorf("%w: no SQLite driver is linked in this build of vcert", verror.UserDataError)
+	}
+	db, err := sql.Open(driver, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to open database %s: %s", verror.UserDataError, path, err)
+	}
+	return db, nil
+}
+
+// Init creates the table of the state when it doesn't exist
+func (s *SQLite) Init(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+s.table()+" (name TEXT PRIMARY KEY, value BLOB NOT NULL)")
+	if err != nil {
+		return fmt.Errorf("%w: failed to create state table: %s", verror.UserDataError, err)
+	}
+	return nil
+}
+
+func (s *SQLite) Load(ctx context.Context, key string) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	var value []byte
+	err := s.DB.QueryRowContext(ctx, "SELECT value FROM "+s.table()+" WHERE name = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read state: %s", verror.UserDataError, err)
+	}
+	return value, nil
+}
+
+func (s *SQLite) Save(ctx context.Context, key string, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := s.DB.ExecContext(ctx, "INSERT OR REPLACE INTO "+s.table()+" (name, value) VALUES (?, ?)", key, value)
+	if err != nil {
+		return fmt.Errorf("%w: failed to write state: %s", verror.UserDataError, err)
+	}
+	return nil
+}
+
+func (s *SQLite) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, "DELETE FROM "+s.table()+" WHERE name = ?", key)
+	if err != nil {
+		return fmt.Errorf("%w: failed to delete state: %s", verror.UserDataError, err)
+	}
+	return nil
+}
+
+// table quotes the name of the table
+func (s *SQLite) table() string {
+	table := s.Table
+	if table == "" {
+		table = DefaultTable
+	}
+	return `"` + strings.Replace(table, `"`, `""`, -1) + `"`
+}
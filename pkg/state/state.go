@@ -0,0 +1,90 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package state persists the state of the renewal daemon, e.g. the pickup IDs of pending requests, so it survives
+// restarts. The state is kept in files, in a SQLite database or in a Kubernetes config map or secret depending on
+// how vcert is deployed.
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/kubernetes"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// ErrNotFound is returned by Store.Load when nothing was saved under a key
+var ErrNotFound = errors.New("state not found")
+
+// Store saves values by key. Keys are made of letters, digits, '-', '_' and '.' so they are valid file names and
+// config map keys.
+type Store interface {
+	// Load returns the value saved under key, or ErrNotFound
+	Load(ctx context.Context, key string) ([]byte, error)
+	// Save replaces the value saved under key
+	Save(ctx context.Context, key string, value []byte) error
+	// Delete removes the value saved under key, deleting a missing key isn't an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Open returns the store of spec, one of "file:<directory>", "sqlite:<database file>", "configmap:[<namespace>/]<name>"
+// and "secret:[<namespace>/]<name>". The config maps and secrets are read with the kubeconfig file at kubeconfig, see
+// kubernetes.NewClient.
+func Open(spec, kubeconfig string) (Store, error) {
+	i := strings.IndexByte(spec, ':')
+	if i < 0 || spec[i+1:] == "" {
+		return nil, fmt.Errorf("%w: state store %q is not <type>:<location>", verror.UserDataError, spec)
+	}
+	kind, location := spec[:i], spec[i+1:]
+	switch kind {
+	case "file":
+		return &File{Dir: location}, nil
+	case "sqlite":
+		return OpenSQLite(location)
+	case "configmap", "secret":
+		namespace, name := "", location
+		if j := strings.IndexByte(location, '/'); j >= 0 {
+			namespace, name = location[:j], location[j+1:]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%w: state store %q has no name", verror.UserDataError, spec)
+		}
+		client, err := kubernetes.NewClient(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return &Kubernetes{Client: client, Namespace: namespace, Name: name, Secret: kind == "secret"}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown state store type %q, expected file, sqlite, configmap or secret", verror.UserDataError, kind)
+	}
+}
+
+// checkKey fails when key can't be used by all the stores
+func checkKey(key string) error {
+	if key == "" || len(key) > 253 || key == "." || key == ".." {
+		return fmt.Errorf("%w: invalid state key %q", verror.UserDataError, key)
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return fmt.Errorf("%w: invalid state key %q", verror.UserDataError, key)
+		}
+	}
+	return nil
+}
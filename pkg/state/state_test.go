@@ -0,0 +1,199 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/kubernetes"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// testStore saves, reads and deletes a key of s
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	_, err := s.Load(ctx, "checkpoint")
+	if err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	for _, value := range []string{"first", "second"} {
+		err = s.Save(ctx, "checkpoint", []byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Load(ctx, "checkpoint")
+		if err != nil || string(got) != value {
+			t.Fatalf("expected %q, got %q, %v", value, got, err)
+		}
+	}
+	err = s.Save(ctx, "../escape", []byte("x"))
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected an invalid key error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		err = s.Delete(ctx, "checkpoint")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = s.Load(ctx, "checkpoint")
+	if err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound once deleted, got %v", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := &File{Dir: filepath.Join(dir, "state")}
+	testStore(t, s)
+
+	err = s.Save(context.Background(), "token", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(s.Dir, "token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("state should only be readable by its owner, got %s", fi.Mode())
+	}
+	files, _ := ioutil.ReadDir(s.Dir)
+	if len(files) != 1 {
+		t.Fatalf("expected only the saved file, got %d files", len(files))
+	}
+}
+
+// fakeAPI stores the config maps and secrets of the default namespace, conflicts counts the writes to fail with a
+// conflict
+type fakeAPI struct {
+	mu        sync.Mutex
+	objects   map[string]json.RawMessage
+	versions  map[string]int
+	conflicts int
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/default/")
+	switch r.Method {
+	case http.MethodGet:
+		obj, ok := a.objects[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(obj)
+		return
+	case http.MethodPost, http.MethodPut:
+		var obj struct {
+			Metadata kubernetes.ObjectMeta `json:"metadata"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &obj)
+		if r.Method == http.MethodPost {
+			path += "/" + obj.Metadata.Name
+		}
+		_, exists := a.objects[path]
+		if a.conflicts > 0 || r.Method == http.MethodPost && exists || r.Method == http.MethodPut && obj.Metadata.ResourceVersion != strconv.Itoa(a.versions[path]) {
+			a.conflicts--
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		a.versions[path]++
+		var stored map[string]interface{}
+		_ = json.Unmarshal(body, &stored)
+		stored["metadata"].(map[string]interface{})["resourceVersion"] = strconv.Itoa(a.versions[path])
+		a.objects[path], _ = json.Marshal(stored)
+		_, _ = w.Write(a.objects[path])
+	}
+}
+
+func TestKubernetes(t *testing.T) {
+	api := &fakeAPI{objects: make(map[string]json.RawMessage), versions: make(map[string]int)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	client := &kubernetes.Client{Server: server.URL}
+
+	for _, secret := range []bool{false, true} {
+		testStore(t, &Kubernetes{Client: client, Name: "vcert-state", Secret: secret})
+	}
+	if _, ok := api.objects["configmaps/vcert-state"]; !ok {
+		t.Fatalf("expected a config map, got %v", api.objects)
+	}
+	if !strings.Contains(string(api.objects["secrets/vcert-state"]), `"Opaque"`) {
+		t.Fatalf("expected an opaque secret, got %s", api.objects["secrets/vcert-state"])
+	}
+
+	// a value written by hand in the data of the config map is read
+	api.objects["configmaps/edited"] = json.RawMessage(`{"metadata":{"name":"edited","resourceVersion":"1"},"data":{"note":"hello"}}`)
+	api.versions["configmaps/edited"] = 1
+	s := &Kubernetes{Client: client, Name: "edited"}
+	value, err := s.Load(context.Background(), "note")
+	if err != nil || string(value) != "hello" {
+		t.Fatalf("expected the value of data, got %q, %v", value, err)
+	}
+
+	// writes are retried when another process changed the object
+	api.conflicts = conflictRetries - 1
+	err = s.Save(context.Background(), "other", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.conflicts = conflictRetries
+	err = s.Save(context.Background(), "other", []byte("value"))
+	if !errors.Is(err, verror.ServerTemporaryUnavailableError) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	s, err := Open("file:/var/lib/vcert", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := s.(*File); !ok || f.Dir != "/var/lib/vcert" {
+		t.Fatalf("expected a file store, got %#v", s)
+	}
+	for _, spec := range []string{"", "file", "file:", "etcd:/vcert", "secret:vcert/"} {
+		_, err = Open(spec, "")
+		if !errors.Is(err, verror.UserDataError) {
+			t.Errorf("%q: expected an invalid store error, got %v", spec, err)
+		}
+	}
+	// the tests don't link a SQLite driver
+	_, err = Open("sqlite:/var/lib/vcert/state.db", "")
+	if err == nil || !strings.Contains(err.Error(), "no SQLite driver") {
+		t.Fatalf("expected a missing driver error, got %v", err)
+	}
+}
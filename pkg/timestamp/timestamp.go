@@ -0,0 +1,268 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package timestamp is a client of the Time-Stamp Protocol of RFC 3161. It asks a time-stamping authority (TSA) for
+// a token proving a hash, usually the one of a signature, existed at a time, and verifies the tokens against the
+// chain of the TSA certificate, e.g. the one retrieved by vcert.
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	contentTypeQuery = "application/timestamp-query"
+	contentTypeReply = "application/timestamp-reply"
+)
+
+var (
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   oidSHA1,
+	crypto.SHA256: oidSHA256,
+	crypto.SHA384: oidSHA384,
+	crypto.SHA512: oidSHA512,
+}
+
+// ParseHash returns the hash named sha1, sha256, sha384 or sha512
+func ParseHash(name string) (crypto.Hash, error) {
+	switch strings.ToLower(strings.Replace(name, "-", "", 1)) {
+	case "sha1":
+		return crypto.SHA1, nil
+	case "sha256":
+		return crypto.SHA256, nil
+	case "sha384":
+		return crypto.SHA384, nil
+	case "sha512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("%w: unsupported hash %q, use sha256, sha384, sha512 or sha1", verror.UserDataError, name)
+}
+
+func hashOf(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	for h, o := range hashOIDs {
+		if o.Equal(oid) {
+			return h, true
+		}
+	}
+	return 0, false
+}
+
+// Digest returns the hash of what r reads
+func Digest(r io.Reader, hash crypto.Hash) ([]byte, error) {
+	if _, ok := hashOIDs[hash]; !ok {
+		return nil, fmt.Errorf("%w: unsupported hash %s", verror.UserDataError, hash)
+	}
+	h := hash.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// Request asks for a token of Digest, the hash of the data by Hash
+type Request struct {
+	Hash   crypto.Hash
+	Digest []byte
+	// Nonce is echoed in the token to match it to the request, NewRequest sets a random one
+	Nonce *big.Int
+	// Policy is the TSA policy the token is asked under, the one of the TSA when empty
+	Policy asn1.ObjectIdentifier
+	// CertReq asks the TSA to include its certificate in the token, NewRequest sets it
+	CertReq bool
+}
+
+// NewRequest returns a request for the token of the hash of what r reads, with a random nonce
+func NewRequest(r io.Reader, hash crypto.Hash) (*Request, error) {
+	digest, err := Digest(r, hash)
+	if err != nil {
+		return nil, err
+	}
+	return NewDigestRequest(digest, hash)
+}
+
+// NewDigestRequest returns a request for the token of digest, the hash of the data by hash, with a random nonce
+func NewDigestRequest(digest []byte, hash crypto.Hash) (*Request, error) {
+	if _, ok := hashOIDs[hash]; !ok {
+		return nil, fmt.Errorf("%w: unsupported hash %s", verror.UserDataError, hash)
+	}
+	if len(digest) != hash.Size() {
+		return nil, fmt.Errorf("%w: a %s digest has %d bytes, not %d", verror.UserDataError, hash, hash.Size(), len(digest))
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	return &Request{Hash: hash, Digest: digest, Nonce: nonce, CertReq: true}, nil
+}
+
+// Marshal returns the DER TimeStampReq, the content of a .tsq file
+func (r *Request) Marshal() ([]byte, error) {
+	oid, ok := hashOIDs[r.Hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported hash %s", verror.UserDataError, r.Hash)
+	}
+	return asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue},
+			HashedMessage: r.Digest,
+		},
+		ReqPolicy: r.Policy,
+		Nonce:     r.Nonce,
+		CertReq:   r.CertReq,
+	})
+}
+
+// ParseResponse returns the token of a DER TimeStampResp, the content of a .tsr file, or the error the TSA replied
+func ParseResponse(der []byte) (*Token, error) {
+	var resp timeStampResp
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: can't read the time-stamp response", verror.ServerError)
+	}
+	// 0 is granted and 1 granted with modifications
+	if resp.Status.Status > 1 {
+		msg := fmt.Sprintf("status %d", resp.Status.Status)
+		if len(resp.Status.StatusString) > 0 {
+			msg += ": " + strings.Join(resp.Status.StatusString, ", ")
+		}
+		if f := failure(resp.Status.FailInfo); f != "" {
+			msg += " (" + f + ")"
+		}
+		return nil, fmt.Errorf("%w: the TSA rejected the request with %s", verror.ServerError, msg)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("%w: the TSA granted the request without a token", verror.ServerError)
+	}
+	return ParseToken(resp.TimeStampToken.FullBytes)
+}
+
+var failures = []string{0: "badAlg", 2: "badRequest", 5: "badDataFormat", 14: "timeNotAvailable", 15: "unacceptedPolicy",
+	16: "unacceptedExtension", 17: "addInfoNotAvailable", 25: "systemFailure"}
+
+func failure(info asn1.BitString) string {
+	var names []string
+	for i, name := range failures {
+		if name != "" && info.At(i) == 1 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Client asks a TSA for tokens over HTTP
+type Client struct {
+	// URL is where the TSA receives the requests, e.g. http://timestamp.digicert.com
+	URL string
+	// HTTPClient is http.DefaultClient when nil
+	HTTPClient *http.Client
+	// Username and Password authenticate to the TSAs requiring basic authentication
+	Username string
+	Password string
+}
+
+// Timestamp returns the token of req. The token is checked to be the one of the request, with its digest and nonce,
+// and to be signed by a certificate it holds, which Token.Verify checks is trusted.
+func (c *Client) Timestamp(ctx context.Context, req *Request) (*Token, error) {
+	body, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid TSA URL: %s", verror.UserDataError, err)
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", contentTypeQuery)
+	httpReq.Header.Set("Accept", contentTypeReply)
+	if c.Username != "" {
+		httpReq.SetBasicAuth(c.Username, c.Password)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", verror.ServerUnavailableError, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: the TSA returned %s", verror.ServerError, resp.Status)
+	}
+	token, err := ParseResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	if token.Hash != req.Hash || !bytes.Equal(token.Digest, req.Digest) {
+		return nil, fmt.Errorf("%w: the token doesn't hold the digest of the request", verror.ServerError)
+	}
+	if req.Nonce != nil && (token.Nonce == nil || token.Nonce.Cmp(req.Nonce) != 0) {
+		return nil, fmt.Errorf("%w: the token doesn't hold the nonce of the request", verror.ServerError)
+	}
+	if req.CertReq && token.Signer == nil {
+		return nil, fmt.Errorf("%w: the token doesn't hold the TSA certificate that was requested", verror.ServerError)
+	}
+	return token, nil
+}
@@ -0,0 +1,364 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// the responses were made by "openssl ts -reply" for the digests of "signature bytes": resp.tsr for a SHA-256 query
+// with -cert, signed with the ESS signing certificate v2 attribute, and resp2.tsr for a SHA-512 query without -cert
+// nor nonce, signed with the v1 attribute
+const (
+	tsaRootPEM = `-----BEGIN CERTIFICATE-----
+MIIBlzCCAT2gAwIBAgIUPxH/b6XRNF8WwEHM2+Y2sSWbBnMwCgYIKoZIzj0EAwIw
+GDEWMBQGA1UEAwwNVGVzdCBUU0EgUm9vdDAgFw0yNjEwMTUxMjExMzlaGA8yMTI2
+MDkyMTEyMTEzOVowGDEWMBQGA1UEAwwNVGVzdCBUU0EgUm9vdDBZMBMGByqGSM49
+AgEGCCqGSM49AwEHA0IABHduEwg8kcp3dPuX7CdIowQ2Sa6etiz2/DzcCeZWSneI
+5RQfIragU6O21+fAfM0kg35KgRc4RdAZW5MpBgsZ/NKjYzBhMB0GA1UdDgQWBBSN
+LFkLFvr9zgQ/2EcY7ASQ+0JFjDAfBgNVHSMEGDAWgBSNLFkLFvr9zgQ/2EcY7ASQ
++0JFjDAPBgNVHRMBAf8EBTADAQH/MA4GA1UdDwEB/wQEAwICBDAKBggqhkjOPQQD
+AgNIADBFAiEA7PVOu74E+ExgcdFcxlEi7dRJm6d1RE1gXV0WMxiyjswCIECVxMv6
+q3dABM33G418mo/zmfkqDkicgth0dsbJ3RmZ
+-----END CERTIFICATE-----
+`
+	tsaCertPEM = `-----BEGIN CERTIFICATE-----
+MIICbzCCAhWgAwIBAgIUQG7AUXk4LweecyZp25Bld6FsCz4wCgYIKoZIzj0EAwIw
+GDEWMBQGA1UEAwwNVGVzdCBUU0EgUm9vdDAgFw0yNjEwMTUxMjExMzlaGA8yMTI2
+MDkyMTEyMTEzOVowEzERMA8GA1UEAwwIVGVzdCBUU0EwggEiMA0GCSqGSIb3DQEB
+AQUAA4IBDwAwggEKAoIBAQDerTCpfzCsoiITk21s7raaxZjeaotTBsPnPdbGHzlC
+vwtJf+8FSWgFuMEdaL2X2yoYZw7EzzzwNm1w6IQz8zfgAFOy4xhiPwgpO7ZpIzve
+CP0ABYe8zFmsS9jaF8QqYpPy/m7dbq77L4ynT0wvAEIMdWaX//hTY4eX72HqfuCH
+2F2fkL3JQY/Mn8dwNTdPdmde6JHMWp0qcM9wC0jcfyiV7DbUemIqvYsHTgiGntgr
+aed1NEo+FmMzOnB1c6RLiZqhzEvXTFS2rTu3MbnpreXqTKPls8FBuT2HSVvr1ebW
+PMzlwQiYb9ni33G1/pMOzZG9xXx6E9iQzDdSCtCEgtizAgMBAAGjdTBzMBYGA1Ud
+JQEB/wQMMAoGCCsGAQUFBwMIMA4GA1UdDwEB/wQEAwIHgDAJBgNVHRMEAjAAMB0G
+A1UdDgQWBBTMstuQLEJA5HWQR/iarPsYxLpr9DAfBgNVHSMEGDAWgBSNLFkLFvr9
+zgQ/2EcY7ASQ+0JFjDAKBggqhkjOPQQDAgNIADBFAiAokwgYIvy8fI3QA+ADhoX+
+D5i7tfKaw9oM4BdbosxeBQIhAPAQfYmnttWsZzKccK6HIYWz44PE8JSHqCTHwRXB
+OEi2
+-----END CERTIFICATE-----
+`
+	opensslResponse = `
+MIIG4zADAgEAMIIG2gYJKoZIhvcNAQcCoIIGyzCCBscCAQMxDzANBglghkgBZQMEAgEFADCBmAYLKoZIhvcNAQkQAQSggYgEgYUw
+gYICAQEGBCoDBAEwMTANBglghkgBZQMEAgEFAAQg9ML+5HBym8xg2Q7fxoe7Wz43fNMdOef63MbZl4/xjfQCAQIYDzIwMjYxMDE1
+MTIxMTM5WjAKAgEBgAIB9IEBZAEB/wIIcYcjzrVTIPugF6QVMBMxETAPBgNVBAMMCFRlc3QgVFNBoIIEDjCCAm8wggIVoAMCAQIC
+FEBuwFF5OC8HnnMmaduQZXehbAs+MAoGCCqGSM49BAMCMBgxFjAUBgNVBAMMDVRlc3QgVFNBIFJvb3QwIBcNMjYxMDE1MTIxMTM5
+WhgPMjEyNjA5MjExMjExMzlaMBMxETAPBgNVBAMMCFRlc3QgVFNBMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA3q0w
+qX8wrKIiE5NtbO62msWY3mqLUwbD5z3Wxh85Qr8LSX/vBUloBbjBHWi9l9sqGGcOxM888DZtcOiEM/M34ABTsuMYYj8IKTu2aSM7
+3gj9AAWHvMxZrEvY2hfEKmKT8v5u3W6u+y+Mp09MLwBCDHVml//4U2OHl+9h6n7gh9hdn5C9yUGPzJ/HcDU3T3ZnXuiRzFqdKnDP
+cAtI3H8olew21HpiKr2LB04Ihp7YK2nndTRKPhZjMzpwdXOkS4maocxL10xUtq07tzG56a3l6kyj5bPBQbk9h0lb69Xm1jzM5cEI
+mG/Z4t9xtf6TDs2RvcV8ehPYkMw3UgrQhILYswIDAQABo3UwczAWBgNVHSUBAf8EDDAKBggrBgEFBQcDCDAOBgNVHQ8BAf8EBAMC
+B4AwCQYDVR0TBAIwADAdBgNVHQ4EFgQUzLLbkCxCQOR1kEf4mqz7GMS6a/QwHwYDVR0jBBgwFoAUjSxZCxb6/c4EP9hHGOwEkPtC
+RYwwCgYIKoZIzj0EAwIDSAAwRQIgKJMIGCL8vHyN0APgA4aF/g+Yu7XymsPaDOAXW6LMXgUCIQDwEH2Jp7bVrGcynHCuhyGFs+OD
+xPCUh6gkx8EVwThItjCCAZcwggE9oAMCAQICFD8R/2+l0TRfFsBBzNvmNrElmwZzMAoGCCqGSM49BAMCMBgxFjAUBgNVBAMMDVRl
+c3QgVFNBIFJvb3QwIBcNMjYxMDE1MTIxMTM5WhgPMjEyNjA5MjExMjExMzlaMBgxFjAUBgNVBAMMDVRlc3QgVFNBIFJvb3QwWTAT
+BgcqhkjOPQIBBggqhkjOPQMBBwNCAAR3bhMIPJHKd3T7l+wnSKMENkmunrYs9vw83AnmVkp3iOUUHyK2oFOjttfnwHzNJIN+SoEX
+OEXQGVuTKQYLGfzSo2MwYTAdBgNVHQ4EFgQUjSxZCxb6/c4EP9hHGOwEkPtCRYwwHwYDVR0jBBgwFoAUjSxZCxb6/c4EP9hHGOwE
+kPtCRYwwDwYDVR0TAQH/BAUwAwEB/zAOBgNVHQ8BAf8EBAMCAgQwCgYIKoZIzj0EAwIDSAAwRQIhAOz1Tru+BPhMYHHRXMZRIu3U
+SZundURNYF1dFjMYso7MAiBAlcTL+qt3QATN9xuNfJqP85n5Kg5InILYdHbGyd0ZmTGCAgIwggH+AgEBMDAwGDEWMBQGA1UEAwwN
+VGVzdCBUU0EgUm9vdAIUQG7AUXk4LweecyZp25Bld6FsCz4wDQYJYIZIAWUDBAIBBQCggaQwGgYJKoZIhvcNAQkDMQ0GCyqGSIb3
+DQEJEAEEMBwGCSqGSIb3DQEJBTEPFw0yNjEwMTUxMjExMzlaMC8GCSqGSIb3DQEJBDEiBCCoYiZdFJma1qA2rjqFbD/kthfkqjgK
+osMVsduxHu/SsTA3BgsqhkiG9w0BCRACLzEoMCYwJDAiBCDRlKc1NAa4aDGh3Sp026biyySmjw0aYZURout7QBdhCjANBgkqhkiG
+9w0BAQEFAASCAQC1RcJvuXjHQ6ou6bEyBlKmk17yq4WoWytKwJaygLrfXgDZSfaQjuaPxs1mgvQGDJF2qaDJhUPwZQuhqimr7c7x
+5KOkfVPq1Pgs1xcvCZDfqwpYDfoZrSB/oUUL2htK1xA4XPXtss4qXs8xASx4oGvFFlybHOimJRXCuBH5w4y43JD1RDfgwNU9Jd4a
+NRLRcBhYTcYGLA5GH3Z31Vl0kv/jE8k7SATZPC6cBnf8pUvjI7Kj9eqw9AZK4ymS/7x03USwZ+525UbZ64LtLEia3PqXMWMJHKgS
+jgWiOLEMizEDL7r78fNDCCP4CnRyXPHNR8yJszX1fnl4dIbWmmbtRwvo`
+	opensslResponseNoCerts = `
+MIIC1DADAgEAMIICywYJKoZIhvcNAQcCoIICvDCCArgCAQMxDzANBglghkgBZQMEAgEFADCBpwYLKoZIhvcNAQkQAQSggZcEgZQw
+gZECAQEGBCoDBAEwUTANBglghkgBZQMEAgMFAARAEkx5RTuwgo8kyh6c7L3rqJm4il2ECzJdDXly1xVaDKm3C/xpr4eWGQa+b8mk
+ocyqe/gdnMPpuGR+2hzHOh3U/QIBAxgPMjAyNjEwMTUxMjExNDVaMAMCAQIBAf+gF6QVMBMxETAPBgNVBAMMCFRlc3QgVFNBMYIB
+9jCCAfICAQEwMDAYMRYwFAYDVQQDDA1UZXN0IFRTQSBSb290AhRAbsBReTgvB55zJmnbkGV3oWwLPjANBglghkgBZQMEAgEFAKCB
+mDAaBgkqhkiG9w0BCQMxDQYLKoZIhvcNAQkQAQQwHAYJKoZIhvcNAQkFMQ8XDTI2MTAxNTEyMTE0NVowKwYLKoZIhvcNAQkQAgwx
+HDAaMBgwFgQUty+0VUeVRFo796DOW4qPIg2OXJEwLwYJKoZIhvcNAQkEMSIEIAwACt9UmnPfoEVjiLtbPr971yogq+2QDI7j9dBX
+Mz1CMA0GCSqGSIb3DQEBAQUABIIBAMrSIlL5a0Y1GbvwZ8t8TTn88svc8P3rnB5lLz5nVypLzKfZ9RnQL7p94X7HqxfsbzZNk9Ol
+wtOV54L0WGpI3xIiHNtzJ6puysqhoC7UnPWZ1KIuFNjxBxLlgRAj9E6ISZ91pjipOQRS/Opl1Pf/x9hH3DSwyASUz+I3Q+wXYhLS
+zWN/n/1oVYO7Vjxq13Qn2Wk8SCPBHERcHHAutPeoXzejDrYeeMjtDf3opKcqGyBSyDSBfJNVu8YodYD9oVXE17vwelz54LAEtIzP
+rAfCtpvVqdxTsdoXbo4tyC+AcRj1cg+uJQNHhkeR3WBtSCmf/P6B0bKzfPX2srRUyuB3Orw=`
+)
+
+var timestampedData = []byte("signature bytes")
+
+func decodeBase64(t *testing.T, s string) []byte {
+	data, err := base64.StdEncoding.DecodeString(strings.Replace(s, "\n", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func parsePEM(t *testing.T, s string) *x509.Certificate {
+	block, _ := pem.Decode([]byte(s))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestParseOpenSSLResponse(t *testing.T) {
+	roots := x509.NewCertPool()
+	roots.AddCert(parsePEM(t, tsaRootPEM))
+	digest, err := Digest(bytes.NewReader(timestampedData), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ParseResponse(decodeBase64(t, opensslResponse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Hash != crypto.SHA256 || !bytes.Equal(token.Digest, digest) || token.Nonce == nil || token.Signer == nil {
+		t.Fatalf("unexpected token %+v", token)
+	}
+	if token.Accuracy != 1500100*time.Microsecond || !token.Policy.Equal(asn1.ObjectIdentifier{1, 2, 3, 4, 1}) {
+		t.Fatalf("unexpected accuracy %s or policy %s", token.Accuracy, token.Policy)
+	}
+	chains, err := token.Verify(VerifyOptions{Roots: roots, Digest: digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 2 {
+		t.Fatalf("unexpected chains %v", chains)
+	}
+	if _, err = token.Verify(VerifyOptions{Roots: roots, Digest: make([]byte, 32)}); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected a check error for another digest, got %v", err)
+	}
+	if _, err = token.Verify(VerifyOptions{Roots: x509.NewCertPool()}); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected a check error for an untrusted TSA, got %v", err)
+	}
+
+	// the TSA certificate is found among the given ones when the token doesn't hold it
+	token, err = ParseResponse(decodeBase64(t, opensslResponseNoCerts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Hash != crypto.SHA512 || token.Signer != nil || token.Nonce != nil {
+		t.Fatalf("unexpected token %+v", token)
+	}
+	if _, err = token.Verify(VerifyOptions{Roots: roots}); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected a check error without the TSA certificate, got %v", err)
+	}
+	digest, _ = Digest(bytes.NewReader(timestampedData), crypto.SHA512)
+	_, err = token.Verify(VerifyOptions{Roots: roots, Certificates: []*x509.Certificate{parsePEM(t, tsaCertPEM)}, Digest: digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTamperedToken(t *testing.T) {
+	token, err := ParseResponse(decodeBase64(t, opensslResponse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := append([]byte(nil), token.Raw...)
+	// a byte of the digest of the TSTInfo
+	i := bytes.Index(raw, token.Digest)
+	raw[i] ^= 1
+	if _, err = ParseToken(raw); !errors.Is(err, verror.CertificateCheckError) {
+		t.Fatalf("expected a check error, got %v", err)
+	}
+}
+
+// testTSA signs tokens for the requests it receives with an ECDSA certificate issued by its root
+type testTSA struct {
+	root *x509.Certificate
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// status replaces the granted status when it's set
+	status int
+}
+
+func newTestTSA(t *testing.T) *testTSA {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := x509.ParseCertificate(der)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl = &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err = x509.CreateCertificate(rand.Reader, tmpl, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testTSA{root: root, cert: cert, key: key}
+}
+
+func (tsa *testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != contentTypeQuery {
+		http.Error(w, "unexpected content type", http.StatusBadRequest)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := timeStampResp{Status: pkiStatusInfo{Status: tsa.status}}
+	if tsa.status == 0 {
+		token, err := tsa.sign(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.TimeStampToken = asn1.RawValue{FullBytes: token}
+	} else {
+		resp.Status.StatusString = []string{"policy not accepted"}
+		resp.Status.FailInfo = asn1.BitString{Bytes: []byte{0, 1}, BitLength: 16}
+	}
+	data, _ := asn1.Marshal(resp)
+	w.Header().Set("Content-Type", contentTypeReply)
+	w.Write(data)
+}
+
+func (tsa *testTSA) sign(req timeStampReq) ([]byte, error) {
+	content, err := asn1.Marshal(struct {
+		Version        int
+		Policy         asn1.ObjectIdentifier
+		MessageImprint messageImprint
+		SerialNumber   *big.Int
+		GenTime        time.Time `asn1:"generalized"`
+		Nonce          *big.Int  `asn1:"optional"`
+	}{1, asn1.ObjectIdentifier{1, 2, 3}, req.MessageImprint, big.NewInt(7), time.Now().UTC().Truncate(time.Second), req.Nonce})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(content)
+	contentType, _ := asn1.Marshal(oidTSTInfo)
+	messageDigest, _ := asn1.Marshal(digest[:])
+	attrs, err := asn1.Marshal([]attribute{
+		{Type: oidContentType, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: contentType}},
+		{Type: oidMessageDigest, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: messageDigest}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var set asn1.RawValue
+	asn1.Unmarshal(attrs, &set)
+	set.Tag, set.FullBytes = asn1.TagSet, nil
+	signed, _ := asn1.Marshal(set)
+	h := sha256.Sum256(signed)
+	signature, err := tsa.key.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	sid, _ := asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: tsa.cert.RawIssuer}, SerialNumber: tsa.cert.SerialNumber})
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: set.Bytes},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+}
+
+func TestClient(t *testing.T) {
+	tsa := newTestTSA(t)
+	server := httptest.NewServer(tsa)
+	defer server.Close()
+
+	req, err := NewRequest(bytes.NewReader(timestampedData), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{URL: server.URL}
+	token, err := client.Timestamp(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Nonce.Cmp(req.Nonce) != 0 || token.SerialNumber.Int64() != 7 {
+		t.Fatalf("unexpected token %+v", token)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(tsa.root)
+	_, err = token.Verify(VerifyOptions{Roots: roots, Digest: req.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tsa.status = 2
+	_, err = client.Timestamp(context.Background(), req)
+	if !errors.Is(err, verror.ServerError) || !strings.Contains(err.Error(), "unacceptedPolicy") {
+		t.Fatalf("expected the rejection of the TSA, got %v", err)
+	}
+}
+
+func TestNewDigestRequest(t *testing.T) {
+	if _, err := NewDigestRequest(make([]byte, 20), crypto.SHA256); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected user data error, got %v", err)
+	}
+	if h, err := ParseHash("SHA-384"); err != nil || h != crypto.SHA384 {
+		t.Fatalf("unexpected hash %s: %v", h, err)
+	}
+}
@@ -0,0 +1,412 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package timestamp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+var (
+	oidSignedData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidSigningCertV2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	oidRSA             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSA           = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData is the SignedData of RFC 5652
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// Token is a time-stamp token, the signed TSTInfo of RFC 3161
+type Token struct {
+	// Raw is the DER token, a CMS ContentInfo
+	Raw []byte
+	// Time is when the TSA stamped the digest, give or take Accuracy
+	Time         time.Time
+	Accuracy     time.Duration
+	SerialNumber *big.Int
+	Policy       asn1.ObjectIdentifier
+	Hash         crypto.Hash
+	Digest       []byte
+	Nonce        *big.Int
+	// Certificates are the certificates the token holds
+	Certificates []*x509.Certificate
+	// Signer is the TSA certificate that signed the token, nil until Verify finds it when the token doesn't hold it
+	Signer *x509.Certificate
+
+	content []byte
+	signer  signerInfo
+}
+
+// ParseToken reads a DER time-stamp token. When the token holds the TSA certificate, its signature is checked, but
+// not whether the certificate is trusted, which Verify does.
+func ParseToken(der []byte) (*Token, error) {
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(der, &ci)
+	if err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%w: can't read the time-stamp token", verror.UserDataError)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: the time-stamp token isn't signed data but %s", verror.UserDataError, ci.ContentType)
+	}
+	var sd signedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read the signed data of the time-stamp token: %s", verror.UserDataError, err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("%w: the token signs %s instead of a TSTInfo", verror.UserDataError, sd.EncapContentInfo.EContentType)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: the time-stamp token has %d signers instead of one", verror.UserDataError, len(sd.SignerInfos))
+	}
+	var info tstInfo
+	_, err = asn1.Unmarshal(sd.EncapContentInfo.EContent, &info)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read the TSTInfo of the time-stamp token: %s", verror.UserDataError, err)
+	}
+	hash, ok := hashOf(info.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported hash %s of the time-stamp token", verror.UserDataError, info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	genTime, err := time.Parse("20060102150405Z0700", string(info.GenTime.Bytes))
+	if err != nil || info.GenTime.Tag != asn1.TagGeneralizedTime {
+		return nil, fmt.Errorf("%w: invalid time %q of the time-stamp token", verror.UserDataError, info.GenTime.Bytes)
+	}
+	t := &Token{
+		Raw:          der,
+		Time:         genTime,
+		Accuracy:     time.Duration(info.Accuracy.Seconds)*time.Second + time.Duration(info.Accuracy.Millis)*time.Millisecond + time.Duration(info.Accuracy.Micros)*time.Microsecond,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Hash:         hash,
+		Digest:       info.MessageImprint.HashedMessage,
+		Nonce:        info.Nonce,
+		content:      sd.EncapContentInfo.EContent,
+		signer:       sd.SignerInfos[0],
+	}
+	if len(sd.Certificates.Bytes) > 0 {
+		t.Certificates, err = x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't read the certificates of the time-stamp token: %s", verror.UserDataError, err)
+		}
+	}
+	if cert := t.findSigner(t.Certificates); cert != nil {
+		err = t.checkSignature(cert)
+		if err != nil {
+			return nil, err
+		}
+		t.Signer = cert
+	}
+	return t, nil
+}
+
+// VerifyOptions are what a token is verified against
+type VerifyOptions struct {
+	// Roots are the trusted CA certificates, e.g. the root of the chain vcert retrieved, the system roots when nil
+	Roots *x509.CertPool
+	// Certificates are the other certificates of the chain, e.g. the ones vcert retrieved. They complete the chain
+	// along with the certificates of the token, and are searched for the TSA certificate when the token doesn't
+	// hold it.
+	Certificates []*x509.Certificate
+	// Digest, when set, is the digest by the hash of the token the token must hold
+	Digest []byte
+}
+
+// Verify checks the token is signed by a TSA certificate with the timeStamping extended key usage, valid at the time
+// of the token and chaining to opts.Roots, and holds opts.Digest. The chains of the TSA certificate are returned.
+func (t *Token) Verify(opts VerifyOptions) ([][]*x509.Certificate, error) {
+	if opts.Digest != nil && !bytes.Equal(opts.Digest, t.Digest) {
+		return nil, fmt.Errorf("%w: the time-stamp token is for another digest", verror.CertificateCheckError)
+	}
+	if t.Signer == nil {
+		cert := t.findSigner(opts.Certificates)
+		if cert == nil {
+			return nil, fmt.Errorf("%w: the TSA certificate isn't in the time-stamp token or the given certificates", verror.CertificateCheckError)
+		}
+		err := t.checkSignature(cert)
+		if err != nil {
+			return nil, err
+		}
+		t.Signer = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range append(t.Certificates, opts.Certificates...) {
+		intermediates.AddCert(c)
+	}
+	chains, err := t.Signer.Verify(x509.VerifyOptions{
+		Roots:         opts.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   t.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: the TSA certificate isn't trusted: %s", verror.CertificateCheckError, err)
+	}
+	return chains, nil
+}
+
+// findSigner returns the certificate of certs identified by the signer of the token
+func (t *Token) findSigner(certs []*x509.Certificate) *x509.Certificate {
+	sid := t.signer.SID
+	for _, c := range certs {
+		if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+			if len(c.SubjectKeyId) > 0 && bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c
+			}
+			continue
+		}
+		var ias issuerAndSerialNumber
+		if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+			return nil
+		}
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// checkSignature checks cert signed the token, with the signed attributes binding the TSTInfo and the certificate
+func (t *Token) checkSignature(cert *x509.Certificate) error {
+	si := t.signer
+	digestHash, ok := hashOf(si.DigestAlgorithm.Algorithm)
+	if !ok {
+		return fmt.Errorf("%w: unsupported digest algorithm %s of the time-stamp token", verror.UserDataError, si.DigestAlgorithm.Algorithm)
+	}
+	algo, err := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, digestHash)
+	if err != nil {
+		return err
+	}
+	signed := t.content
+	if len(si.SignedAttrs.FullBytes) > 0 {
+		err = t.checkSignedAttrs(digestHash, cert)
+		if err != nil {
+			return err
+		}
+		// the attributes are signed as a SET, not with the implicit tag of the SignerInfo
+		signed = append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	}
+	err = cert.CheckSignature(algo, signed, si.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: invalid signature of the time-stamp token: %s", verror.CertificateCheckError, err)
+	}
+	return nil
+}
+
+func (t *Token) checkSignedAttrs(digestHash crypto.Hash, cert *x509.Certificate) error {
+	var digest, contentType, signingCert []byte
+	var v2 bool
+	rest := t.signer.SignedAttrs.Bytes
+	for len(rest) > 0 {
+		var attr attribute
+		var err error
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil {
+			return fmt.Errorf("%w: can't read the signed attributes of the time-stamp token: %s", verror.UserDataError, err)
+		}
+		switch {
+		case attr.Type.Equal(oidMessageDigest):
+			digest = attr.Values.Bytes
+		case attr.Type.Equal(oidContentType):
+			contentType = attr.Values.Bytes
+		case attr.Type.Equal(oidSigningCertificate):
+			signingCert = attr.Values.Bytes
+		case attr.Type.Equal(oidSigningCertV2):
+			signingCert, v2 = attr.Values.Bytes, true
+		}
+	}
+	var ct asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(contentType, &ct); err != nil || !ct.Equal(oidTSTInfo) {
+		return fmt.Errorf("%w: the content type attribute of the time-stamp token isn't TSTInfo", verror.CertificateCheckError)
+	}
+	var md []byte
+	if _, err := asn1.Unmarshal(digest, &md); err != nil {
+		return fmt.Errorf("%w: the time-stamp token has no message digest attribute", verror.CertificateCheckError)
+	}
+	h := digestHash.New()
+	h.Write(t.content)
+	if !bytes.Equal(md, h.Sum(nil)) {
+		return fmt.Errorf("%w: the message digest attribute doesn't match the TSTInfo of the time-stamp token", verror.CertificateCheckError)
+	}
+	if signingCert != nil && !matchesSigningCertificate(signingCert, v2, cert) {
+		return fmt.Errorf("%w: the signing certificate attribute of the time-stamp token names another certificate", verror.CertificateCheckError)
+	}
+	return nil
+}
+
+// matchesSigningCertificate tells whether cert is the first certificate of the ESS signing certificate attribute of
+// RFC 2634 or RFC 5035, which binds the signature to the TSA certificate
+func matchesSigningCertificate(value []byte, v2 bool, cert *x509.Certificate) bool {
+	var sc struct {
+		Certs []asn1.RawValue
+		Rest  asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(value, &sc); err != nil || len(sc.Certs) == 0 {
+		return false
+	}
+	hash := crypto.SHA1
+	rest := sc.Certs[0].Bytes
+	if v2 {
+		hash = crypto.SHA256
+		// the hash algorithm is omitted when it's the default SHA-256
+		var first asn1.RawValue
+		if _, err := asn1.Unmarshal(rest, &first); err != nil {
+			return false
+		}
+		if first.Tag == asn1.TagSequence {
+			var alg pkix.AlgorithmIdentifier
+			r, err := asn1.Unmarshal(rest, &alg)
+			if err != nil {
+				return false
+			}
+			h, ok := hashOf(alg.Algorithm)
+			if !ok {
+				return false
+			}
+			hash, rest = h, r
+		}
+	}
+	var certHash []byte
+	if _, err := asn1.Unmarshal(rest, &certHash); err != nil {
+		return false
+	}
+	h := hash.New()
+	h.Write(cert.Raw)
+	return bytes.Equal(certHash, h.Sum(nil))
+}
+
+func signatureAlgorithm(oid asn1.ObjectIdentifier, digest crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch {
+	case oid.Equal(oidRSA):
+		switch digest {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case oid.Equal(oidECDSA):
+		switch digest {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	case oid.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA, nil
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case oid.Equal(oidECDSAWithSHA1):
+		return x509.ECDSAWithSHA1, nil
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	}
+	return 0, fmt.Errorf("%w: unsupported signature algorithm %s of the time-stamp token", verror.UserDataError, oid)
+}
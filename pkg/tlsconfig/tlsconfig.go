@@ -0,0 +1,287 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tlsconfig keeps the certificate of a TLS server or client up to date without restarting it. The
+// functions of a Reloader are set as tls.Config.GetCertificate or tls.Config.GetClientCertificate, each handshake
+// gets the latest certificate of the source: the files are polled for changes, and a renewal done by the program
+// itself is handed over with Update.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+const DefaultCheckInterval = 10 * time.Second
+
+// Source is where a Reloader loads its certificate from
+type Source interface {
+	// Load returns the certificate, its chain and its private key
+	Load() (*certificate.PEMCollection, error)
+	// Version changes whenever Load would return another certificate, it's called at every check so it has to be
+	// cheap
+	Version() (string, error)
+}
+
+// FileSource is a certificate in PEM files, like the ones written by the enroll and renew commands or by a
+// rotation.Manager through its live link. The files are replaced as a whole when renewed, a change of their
+// modification time or size is a new version.
+type FileSource struct {
+	// CertFile holds the certificate, optionally followed by its chain
+	CertFile string
+	// ChainFile holds the chain when it's written apart
+	ChainFile string
+	KeyFile   string
+	// KeyPassword decrypts the private key
+	KeyPassword string
+}
+
+func (s *FileSource) files() []string {
+	files := []string{s.CertFile, s.KeyFile}
+	if s.ChainFile != "" {
+		files = append(files, s.ChainFile)
+	}
+	return files
+}
+
+// Version returns the modification times and sizes of the files
+func (s *FileSource) Version() (string, error) {
+	var version []string
+	for _, f := range s.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		version = append(version, fmt.Sprintf("%d.%d", info.ModTime().UnixNano(), info.Size()))
+	}
+	return strings.Join(version, ","), nil
+}
+
+// Load reads the files, the private key is decrypted
+func (s *FileSource) Load() (*certificate.PEMCollection, error) {
+	contents := make([][]byte, 0, 3)
+	for _, f := range s.files() {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, b)
+	}
+	certs := contents[0]
+	if s.ChainFile != "" {
+		certs = append(append(certs, '\n'), contents[2]...)
+	}
+	pcc, err := certificate.PEMCollectionFromBytes(certs, certificate.ChainOptionRootLast)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.CertFile, err)
+	}
+	pcc.PrivateKey = string(contents[1])
+	if err := pcc.DecryptPrivateKey([]byte(s.KeyPassword)); err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", s.KeyFile, err)
+	}
+	return pcc, nil
+}
+
+// Reloader serves the latest valid certificate of its source. A certificate which can't be loaded or doesn't fit
+// the TLS role of the Reloader is logged and skipped, the previous one is served meanwhile.
+type Reloader struct {
+	// Source is checked every CheckInterval at most, nil when the certificate only changes with Update
+	Source        Source
+	CheckInterval time.Duration
+	Log           func(format string, args ...interface{})
+	Now           func() time.Time
+
+	convert func(*certificate.PEMCollection) (tls.Certificate, error)
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	version   string
+	checked   time.Time
+	checking  sync.Mutex
+	lastError string
+}
+
+// NewServerReloader returns a Reloader of a server certificate, it fails when the source has no valid one yet
+func NewServerReloader(source Source) (*Reloader, error) {
+	return newReloader(source, (*certificate.PEMCollection).ToServerTLSCertificate)
+}
+
+// NewClientReloader returns a Reloader of a client certificate, it fails when the source has no valid one yet
+func NewClientReloader(source Source) (*Reloader, error) {
+	return newReloader(source, (*certificate.PEMCollection).ToClientTLSCertificate)
+}
+
+func newReloader(source Source, convert func(*certificate.PEMCollection) (tls.Certificate, error)) (*Reloader, error) {
+	r := &Reloader{Source: source, convert: convert}
+	if source != nil {
+		if err := r.Reload(); err != nil {
+			return nil, err
+		}
+		r.checked = r.now()
+	}
+	return r, nil
+}
+
+// Update serves pcc from now on, it's the renewal event of a program requesting its certificates itself
+func (r *Reloader) Update(pcc *certificate.PEMCollection) error {
+	if r.convert == nil {
+		return errNotBuilt
+	}
+	cert, err := r.convert(pcc)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// errNotBuilt is returned by a Reloader which doesn't know its TLS role
+var errNotBuilt = fmt.Errorf("the reloader has to be built by NewServerReloader or NewClientReloader")
+
+// Reload loads the certificate of the source again if its version changed
+func (r *Reloader) Reload() error {
+	if r.convert == nil {
+		return errNotBuilt
+	}
+	if r.Source == nil {
+		return fmt.Errorf("the reloader has no source to load the certificate from")
+	}
+	r.checking.Lock()
+	defer r.checking.Unlock()
+
+	version, err := r.Source.Version()
+	if err == nil {
+		r.mu.RLock()
+		unchanged := r.cert != nil && version == r.version
+		r.mu.RUnlock()
+		if unchanged {
+			return nil
+		}
+		var pcc *certificate.PEMCollection
+		pcc, err = r.Source.Load()
+		if err == nil {
+			var cert tls.Certificate
+			cert, err = r.convert(pcc)
+			if err == nil {
+				r.mu.Lock()
+				r.cert = &cert
+				r.version = version
+				r.lastError = ""
+				r.mu.Unlock()
+				r.logf("Loaded the certificate %s", cert.Leaf.Subject)
+				return nil
+			}
+		}
+	}
+
+	// the same failure is logged once, the source is checked again and again until it's fixed
+	r.mu.Lock()
+	repeated := err.Error() == r.lastError
+	r.lastError = err.Error()
+	r.mu.Unlock()
+	if !repeated {
+		r.logf("Failed to reload the certificate, the previous one is still served: %s", err)
+	}
+	return err
+}
+
+// Run reloads the certificate every CheckInterval until ctx is done, without waiting for a handshake
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.checkInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// GetCertificate is the tls.Config.GetCertificate of a server
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current()
+}
+
+// GetClientCertificate is the tls.Config.GetClientCertificate of a client
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current()
+}
+
+func (r *Reloader) current() (*tls.Certificate, error) {
+	r.check()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert == nil {
+		return nil, fmt.Errorf("no certificate loaded yet")
+	}
+	return r.cert, nil
+}
+
+// check reloads the certificate when the last check is older than CheckInterval. Only the first caller past the
+// interval checks the source, the others keep the served certificate without waiting for it.
+func (r *Reloader) check() {
+	if r.Source == nil || r.convert == nil {
+		return
+	}
+	now := r.now()
+	r.mu.RLock()
+	due := now.Sub(r.checked) >= r.checkInterval()
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+	r.mu.Lock()
+	due = now.Sub(r.checked) >= r.checkInterval()
+	if due {
+		r.checked = now
+	}
+	r.mu.Unlock()
+	if due {
+		_ = r.Reload()
+	}
+}
+
+func (r *Reloader) checkInterval() time.Duration {
+	if r.CheckInterval > 0 {
+		return r.CheckInterval
+	}
+	return DefaultCheckInterval
+}
+
+func (r *Reloader) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+func (r *Reloader) logf(format string, args ...interface{}) {
+	if r.Log != nil {
+		r.Log(format, args...)
+	}
+}
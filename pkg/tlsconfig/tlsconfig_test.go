@@ -0,0 +1,276 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tlsconfig
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+func newCollection(t *testing.T, cn string, password string, eku ...x509.ExtKeyUsage) *certificate.PEMCollection {
+	key, err := certificate.GenerateECDSAPrivateKey(certificate.EllipticCurveP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 90),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  eku,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcc, err := certificate.NewPEMCollection(cert, key, []byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pcc
+}
+
+func writeFiles(t *testing.T, s *FileSource, pcc *certificate.PEMCollection, modTime time.Time) {
+	for f, content := range map[string]string{s.CertFile: pcc.Certificate, s.KeyFile: pcc.PrivateKey} {
+		if err := ioutil.WriteFile(f, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source := &FileSource{
+		CertFile:    filepath.Join(dir, "cert.pem"),
+		KeyFile:     filepath.Join(dir, "key.pem"),
+		KeyPassword: "secret",
+	}
+	modTime := time.Now().Add(-time.Hour)
+	writeFiles(t, source, newCollection(t, "first", "secret", x509.ExtKeyUsageServerAuth), modTime)
+
+	if _, err = NewClientReloader(source); err == nil {
+		t.Fatal("a server certificate shouldn't be loaded by a client")
+	}
+	r, err := NewServerReloader(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.Now = func() time.Time { return now }
+	served := func() string {
+		cert, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+	if cn := served(); cn != "first" {
+		t.Fatalf("expected first, got %s", cn)
+	}
+
+	// the files are checked once per interval
+	modTime = modTime.Add(time.Minute)
+	writeFiles(t, source, newCollection(t, "second", "secret", x509.ExtKeyUsageServerAuth), modTime)
+	if cn := served(); cn != "first" {
+		t.Fatalf("the files shouldn't be checked before the interval, got %s", cn)
+	}
+	now = now.Add(DefaultCheckInterval)
+	if cn := served(); cn != "second" {
+		t.Fatalf("expected second, got %s", cn)
+	}
+
+	// an invalid certificate keeps the previous one
+	modTime = modTime.Add(time.Minute)
+	writeFiles(t, source, newCollection(t, "client", "secret", x509.ExtKeyUsageClientAuth), modTime)
+	now = now.Add(DefaultCheckInterval)
+	if cn := served(); cn != "second" {
+		t.Fatalf("a client certificate shouldn't be served, got %s", cn)
+	}
+	if err = r.Reload(); err == nil {
+		t.Fatal("the reload of a client certificate should fail")
+	}
+
+	// a renewal event is served at once
+	if err = r.Update(newCollection(t, "renewed", "")); err != nil {
+		t.Fatal(err)
+	}
+	if cn := served(); cn != "renewed" {
+		t.Fatalf("expected renewed, got %s", cn)
+	}
+	if err = r.Update(newCollection(t, "client", "", x509.ExtKeyUsageClientAuth)); err == nil {
+		t.Fatal("the update with a client certificate should fail")
+	}
+}
+
+type countingSource struct {
+	pcc      *certificate.PEMCollection
+	versions int32
+}
+
+func (s *countingSource) Load() (*certificate.PEMCollection, error) {
+	return s.pcc, nil
+}
+
+func (s *countingSource) Version() (string, error) {
+	atomic.AddInt32(&s.versions, 1)
+	return "1", nil
+}
+
+func TestReloaderChecksOncePerInterval(t *testing.T) {
+	source := &countingSource{pcc: newCollection(t, "server", "", x509.ExtKeyUsageServerAuth)}
+	r, err := NewServerReloader(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.Now = func() time.Time { return now }
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.GetCertificate(nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := atomic.LoadInt32(&source.versions); v != 1 {
+		t.Fatalf("expected the version to be checked once at creation, got %d checks", v)
+	}
+	now = now.Add(DefaultCheckInterval)
+	for i := 0; i < 50; i++ {
+		if _, err := r.GetCertificate(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := atomic.LoadInt32(&source.versions); v != 2 {
+		t.Fatalf("expected one more check after the interval, got %d checks", v)
+	}
+}
+
+func TestReloaderWithoutSource(t *testing.T) {
+	var zero Reloader
+	if err := zero.Reload(); err == nil {
+		t.Error("a zero reloader shouldn't reload")
+	}
+	if err := zero.Update(newCollection(t, "server", "", x509.ExtKeyUsageServerAuth)); err == nil {
+		t.Error("a zero reloader shouldn't be updated")
+	}
+	if _, err := zero.GetCertificate(nil); err == nil {
+		t.Error("a zero reloader shouldn't serve a certificate")
+	}
+
+	r, err := NewServerReloader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Reload(); err == nil {
+		t.Error("a reloader without a source shouldn't reload")
+	}
+}
+
+func TestReloaderHandshake(t *testing.T) {
+	server, err := NewServerReloader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClientReloader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = server.GetCertificate(nil); err == nil {
+		t.Fatal("a reloader without a certificate should fail")
+	}
+	if err = client.Update(newCollection(t, "client", "", x509.ExtKeyUsageClientAuth)); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetCertificate: server.GetCertificate,
+		ClientAuth:     tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	peers := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if err = tlsConn.Handshake(); err == nil {
+				peers <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Run(ctx)
+
+	for _, cn := range []string{"first", "second"} {
+		if err = server.Update(newCollection(t, cn, "", x509.ExtKeyUsageServerAuth)); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			InsecureSkipVerify:   true,
+			GetClientCertificate: client.GetClientCertificate,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if served := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; served != cn {
+			t.Errorf("expected %s, got %s", cn, served)
+		}
+		_ = conn.Close()
+		if peer := <-peers; peer != "client" {
+			t.Errorf("expected the client certificate, got %s", peer)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+// Connector traces the enrollment calls of a connector. The other calls are passed through.
+type Connector struct {
+	endpoint.Connector
+	Tracer Tracer
+
+	ctx  context.Context
+	zone string
+}
+
+// NewConnector wraps c with t
+func NewConnector(c endpoint.Connector, t Tracer) *Connector {
+	return &Connector{Connector: c, Tracer: OrNoop(t), ctx: context.Background()}
+}
+
+// WithContext returns a copy of the connector whose spans are children of the span in ctx
+func (c *Connector) WithContext(ctx context.Context) *Connector {
+	cc := *c
+	cc.ctx = ctx
+	return &cc
+}
+
+func (c *Connector) SetZone(zone string) {
+	c.zone = zone
+	c.Connector.SetZone(zone)
+}
+
+func (c *Connector) start(name string, req *certificate.Request) Span {
+	_, span := c.Tracer.Start(c.ctx, name)
+	if c.zone != "" {
+		span.SetAttributes(String(AttrZone, c.zone))
+	}
+	if req != nil {
+		if req.Subject.CommonName != "" {
+			span.SetAttributes(String(AttrCommonName, req.Subject.CommonName))
+		}
+		if req.PickupID != "" {
+			span.SetAttributes(String(AttrPickupID, req.PickupID))
+		}
+	}
+	return span
+}
+
+func (c *Connector) Authenticate(auth *endpoint.Authentication) (err error) {
+	span := c.start(SpanAuthenticate, nil)
+	defer func() { End(span, err) }()
+	return c.Connector.Authenticate(auth)
+}
+
+func (c *Connector) RequestCertificate(req *certificate.Request) (requestID string, err error) {
+	span := c.start(SpanEnroll, req)
+	defer func() { End(span, err) }()
+	requestID, err = c.Connector.RequestCertificate(req)
+	if requestID != "" {
+		span.SetAttributes(String(AttrPickupID, requestID))
+	}
+	return
+}
+
+// RetrieveCertificate is traced as a poll when the request has a timeout, since the connector then waits for the
+// certificate to be issued
+func (c *Connector) RetrieveCertificate(req *certificate.Request) (pcc *certificate.PEMCollection, err error) {
+	name := SpanRetrieve
+	if req.Timeout > 0 {
+		name = SpanPoll
+	}
+	span := c.start(name, req)
+	defer func() { End(span, err) }()
+	return c.Connector.RetrieveCertificate(req)
+}
+
+func (c *Connector) RenewCertificate(req *certificate.RenewalRequest) (requestID string, err error) {
+	span := c.start(SpanRenew, req.CertificateRequest)
+	defer func() { End(span, err) }()
+	requestID, err = c.Connector.RenewCertificate(req)
+	if requestID != "" {
+		span.SetAttributes(String(AttrPickupID, requestID))
+	}
+	return
+}
+
+func (c *Connector) CancelRequest(pickupID string) (err error) {
+	span := c.start(SpanCancel, &certificate.Request{PickupID: pickupID})
+	defer func() { End(span, err) }()
+	return c.Connector.CancelRequest(pickupID)
+}
+
+func (c *Connector) RevokeCertificate(req *certificate.RevocationRequest) (err error) {
+	span := c.start(SpanRevoke, nil)
+	defer func() { End(span, err) }()
+	return c.Connector.RevokeCertificate(req)
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tracing instruments the connector operations and the playbook runs with spans, so vcert calls show up in
+// distributed traces. It doesn't depend on a tracing library: an OpenTelemetry tracer is plugged in with a small
+// adapter implementing Tracer and Span, e.g.
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string) (context.Context, tracing.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+//
+// where otelSpan converts the attributes with attribute.String and attribute.Int, and calls RecordError and End.
+package tracing
+
+import (
+	"context"
+)
+
+// Span names
+const (
+	SpanRun          = "vcert.run"
+	SpanScheduledRun = "vcert.scheduled_run"
+	SpanTask         = "vcert.task"
+	SpanAuthenticate = "vcert.authenticate"
+	SpanEnroll       = "vcert.enroll"
+	SpanPoll         = "vcert.poll"
+	SpanRetrieve     = "vcert.retrieve"
+	SpanRenew        = "vcert.renew"
+	SpanRevoke       = "vcert.revoke"
+	SpanCancel       = "vcert.cancel"
+	SpanInstall      = "vcert.install"
+)
+
+// Attribute keys
+const (
+	AttrZone       = "vcert.zone"
+	AttrCommonName = "vcert.common_name"
+	AttrPickupID   = "vcert.pickup_id"
+	AttrTask       = "vcert.task"
+	AttrTasks      = "vcert.tasks"
+	AttrFile       = "vcert.file"
+	AttrTrigger    = "vcert.trigger"
+	AttrResult     = "vcert.result"
+)
+
+// Result attribute values
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Tracer starts spans. The returned context carries the span, so spans started from it are its children.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation being traced
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a span attribute, its value is a string or an int
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Noop is a Tracer that records nothing
+var Noop Tracer = noopTracer{}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// End sets the result attribute of span from err, records err and ends span
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(String(AttrResult, ResultError))
+	} else {
+		span.SetAttributes(String(AttrResult, ResultSuccess))
+	}
+	span.End()
+}
+
+// OrNoop returns t, or Noop when t is nil
+func OrNoop(t Tracer) Tracer {
+	if t == nil {
+		return Noop
+	}
+	return t
+}
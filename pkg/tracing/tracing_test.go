@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/venafi/fake"
+)
+
+type recordedSpan struct {
+	name   string
+	parent *recordedSpan
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+type spanKey struct{}
+
+type recorder struct {
+	spans []*recordedSpan
+}
+
+func (r *recorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	s := &recordedSpan{name: name, parent: parent, attrs: make(map[string]interface{})}
+	r.spans = append(r.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func TestConnector(t *testing.T) {
+	rec := &recorder{}
+	ctx, parent := rec.Start(context.Background(), SpanTask)
+	c := NewConnector(fake.NewConnector(false, nil), rec).WithContext(ctx)
+	c.SetZone("Default")
+
+	req := &certificate.Request{}
+	req.Subject.CommonName = "www.example.com"
+	if err := c.GenerateRequest(nil, req); err != nil {
+		t.Fatal(err)
+	}
+	id, err := c.RequestCertificate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PickupID = id
+	req.Timeout = time.Minute
+	if _, err = c.RetrieveCertificate(req); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(rec.spans))
+	}
+	for i, name := range []string{SpanEnroll, SpanPoll} {
+		s := rec.spans[i+1]
+		if s.name != name || s.parent != parent || !s.ended {
+			t.Errorf("unexpected span %d: %+v", i, s)
+		}
+		if s.attrs[AttrZone] != "Default" || s.attrs[AttrCommonName] != "www.example.com" ||
+			s.attrs[AttrPickupID] != id || s.attrs[AttrResult] != ResultSuccess {
+			t.Errorf("unexpected attributes of %s: %v", s.name, s.attrs)
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	s := &recordedSpan{attrs: make(map[string]interface{})}
+	End(s, errors.New("failed"))
+	if s.err == nil || s.attrs[AttrResult] != ResultError || !s.ended {
+		t.Errorf("unexpected span %+v", s)
+	}
+	// the no-op tracer must be usable without checks
+	_, span := OrNoop(nil).Start(context.Background(), SpanRun)
+	End(span, nil)
+}
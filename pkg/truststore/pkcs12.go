@@ -0,0 +1,467 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package truststore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/pbkdf2"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// The PKCS#12 structures of RFC 7292 needed to read a truststore
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidCertBag         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+
+	oidFriendlyName = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHAAnd128BitRC2CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}
+	oidPBEWithSHAAnd40BitRC2CBC      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidPBES2                         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256                = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384                = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512                = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+var errIncorrectPassword = fmt.Errorf("%w: wrong password for the PKCS#12 truststore", verror.UserDataError)
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue  `asn1:"tag:0,explicit"`
+	Attributes []bagAttribute `asn1:"set,optional"`
+}
+
+type bagAttribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// pkcs12Store keeps the trusted certificates of a PKCS#12 file, the certificate bags that don't belong to a private
+// key, and counts the other bags
+type pkcs12Store struct {
+	entries []trustedEntry
+	others  int
+}
+
+type trustedEntry struct {
+	alias string
+	cert  *x509.Certificate
+}
+
+func (p *pkcs12Store) trusted() []trustedEntry {
+	return p.entries
+}
+
+// setTrusted replaces the certificate of the trusted entry alias, or adds the entry
+func (p *pkcs12Store) setTrusted(alias string, cert *x509.Certificate) {
+	for i, e := range p.entries {
+		if e.alias == alias {
+			p.entries[i].cert = cert
+			return
+		}
+	}
+	p.entries = append(p.entries, trustedEntry{alias: alias, cert: cert})
+}
+
+// encode writes the trusted certificates with go-pkcs12, which protects the file with an HMAC-SHA1 MAC every JDK
+// and OpenSSL version verifies
+func (p *pkcs12Store) encode(password string) ([]byte, error) {
+	if p.others > 0 {
+		return nil, fmt.Errorf("%w: the PKCS#12 file holds private keys or other entries that can't be written back, use a dedicated truststore", verror.UserDataError)
+	}
+	entries := make([]pkcs12.TrustStoreEntry, len(p.entries))
+	for i, e := range p.entries {
+		entries[i] = pkcs12.TrustStoreEntry{Cert: e.cert, FriendlyName: e.alias}
+	}
+	return pkcs12.EncodeTrustStoreEntries(rand.Reader, entries, password)
+}
+
+// decodePKCS12 reads the certificates of a PKCS#12 file with their friendly names, the aliases. go-pkcs12 only
+// decodes the truststores made by Java, and without the friendly names.
+func decodePKCS12(data []byte, password string) (*pkcs12Store, error) {
+	var pfx pfxPDU
+	if err := unmarshal(data, &pfx); err != nil {
+		return nil, fmt.Errorf("%w: the truststore is neither a Java keystore nor a PKCS#12 file: %s", verror.UserDataError, err)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidData) {
+		return nil, fmt.Errorf("%w: PKCS#12 files protected by public keys aren't supported", verror.UserDataError)
+	}
+	var authSafe []byte
+	if err := unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, fmt.Errorf("%w: invalid PKCS#12 file: %s", verror.UserDataError, err)
+	}
+	if len(pfx.MacData.Mac.Algorithm.Algorithm) > 0 {
+		expected, err := computeMAC(pfx.MacData, authSafe, password)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(expected, pfx.MacData.Mac.Digest) {
+			return nil, errIncorrectPassword
+		}
+	}
+	var contents []contentInfo
+	if err := unmarshal(authSafe, &contents); err != nil {
+		return nil, fmt.Errorf("%w: invalid PKCS#12 file: %s", verror.UserDataError, err)
+	}
+	store := &pkcs12Store{}
+	for _, ci := range contents {
+		var data []byte
+		var err error
+		switch {
+		case ci.ContentType.Equal(oidData):
+			err = unmarshal(ci.Content.Bytes, &data)
+		case ci.ContentType.Equal(oidEncryptedData):
+			var ed encryptedData
+			err = unmarshal(ci.Content.Bytes, &ed)
+			if err == nil {
+				data, err = decrypt(ed.EncryptedContentInfo.ContentEncryptionAlgorithm, ed.EncryptedContentInfo.EncryptedContent, password)
+			}
+		default:
+			err = fmt.Errorf("unsupported content type %s", ci.ContentType)
+		}
+		if err != nil {
+			if errors.Is(err, verror.UserDataError) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: can't read the PKCS#12 file: %s", verror.UserDataError, err)
+		}
+		var bags []safeBag
+		if err = unmarshal(data, &bags); err != nil {
+			return nil, fmt.Errorf("%w: can't read the PKCS#12 file, check its password: %s", verror.UserDataError, err)
+		}
+		for _, bag := range bags {
+			if bag.ID.Equal(oidKeyBag) {
+				return nil, fmt.Errorf("%w: the PKCS#12 file has an unencrypted private key, it isn't a truststore", verror.UserDataError)
+			}
+			if !bag.ID.Equal(oidCertBag) || hasAttribute(bag, oidLocalKeyID) {
+				store.others++
+				continue
+			}
+			cert, err := bagCertificate(bag)
+			if err != nil {
+				return nil, fmt.Errorf("%w: can't read a certificate of the PKCS#12 file: %s", verror.UserDataError, err)
+			}
+			store.entries = append(store.entries, trustedEntry{alias: friendlyName(bag), cert: cert})
+		}
+	}
+	return store, nil
+}
+
+func bagCertificate(bag safeBag) (*x509.Certificate, error) {
+	var cb certBag
+	if err := unmarshal(bag.Value.Bytes, &cb); err != nil {
+		return nil, err
+	}
+	if !cb.ID.Equal(oidX509Certificate) {
+		return nil, fmt.Errorf("unsupported certificate type %s", cb.ID)
+	}
+	return x509.ParseCertificate(cb.Data)
+}
+
+func hasAttribute(bag safeBag, id asn1.ObjectIdentifier) bool {
+	for _, a := range bag.Attributes {
+		if a.ID.Equal(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func friendlyName(bag safeBag) string {
+	for _, a := range bag.Attributes {
+		if !a.ID.Equal(oidFriendlyName) {
+			continue
+		}
+		var value asn1.RawValue
+		if _, err := asn1.Unmarshal(a.Value.Bytes, &value); err != nil || value.Tag != asn1.TagBMPString || len(value.Bytes)%2 != 0 {
+			return ""
+		}
+		s := make([]uint16, len(value.Bytes)/2)
+		for i := range s {
+			s[i] = uint16(value.Bytes[2*i])<<8 | uint16(value.Bytes[2*i+1])
+		}
+		return string(utf16.Decode(s))
+	}
+	return ""
+}
+
+// bmpPassword encodes password in UTF-16 big endian, with the two zero bytes the PKCS#12 passwords end with
+func bmpPassword(password string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(password)) {
+		b = append(b, byte(c>>8), byte(c))
+	}
+	return append(b, 0, 0)
+}
+
+// unmarshal is asn1.Unmarshal failing on trailing data
+func unmarshal(data []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(data, v)
+	if err == nil && len(rest) > 0 {
+		err = errors.New("trailing data")
+	}
+	return err
+}
+
+func macHash(oid asn1.ObjectIdentifier) (func() hash.Hash, int, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return sha1.New, 64, nil
+	case oid.Equal(oidSHA256):
+		return sha256.New, 64, nil
+	case oid.Equal(oidSHA384):
+		return sha512.New384, 128, nil
+	case oid.Equal(oidSHA512):
+		return sha512.New, 128, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unsupported PKCS#12 MAC algorithm %s", verror.UserDataError, oid)
+}
+
+func computeMAC(md macData, message []byte, password string) ([]byte, error) {
+	h, blockSize, err := macHash(md.Mac.Algorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	key := pkcs12KDF(h, blockSize, bmpPassword(password), md.MacSalt, md.Iterations, 3, h().Size())
+	mac := hmac.New(h, key)
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
+
+// pkcs12KDF derives size bytes for the purpose id (1 for keys, 2 for IVs, 3 for MACs) from the password, as
+// described in appendix B.2 of RFC 7292
+func pkcs12KDF(h func() hash.Hash, v int, password, salt []byte, iterations int, id byte, size int) []byte {
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	fill := func(pattern []byte) []byte {
+		if len(pattern) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(pattern)+v-1)/v))
+		for i := range out {
+			out[i] = pattern[i%len(pattern)]
+		}
+		return out
+	}
+	i := append(fill(salt), fill(password)...)
+	var out []byte
+	for len(out) < size {
+		a := append(append([]byte(nil), d...), i...)
+		for r := 0; r < iterations; r++ {
+			hh := h()
+			hh.Write(a)
+			a = hh.Sum(nil)
+		}
+		out = append(out, a...)
+		b := fill(a)[:v]
+		// I_j = (I_j + B + 1) mod 2^(8v) for each block of I
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(i[j+k]) + int(b[k]) + carry
+				i[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size]
+}
+
+// decrypt decrypts an encrypted SafeContents with the PKCS#12 or the PBES2 password based encryption
+func decrypt(alg pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+	var err error
+	switch {
+	case alg.Algorithm.Equal(oidPBES2):
+		var params pbes2Params
+		if err = unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		block, iv, err = pbes2Cipher(params, password)
+	case alg.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC), alg.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC),
+		alg.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC):
+		var params pbeParams
+		if err = unmarshal(alg.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		pw := bmpPassword(password)
+		keySize := 24
+		if alg.Algorithm.Equal(oidPBEWithSHAAnd128BitRC2CBC) {
+			keySize = 16
+		} else if alg.Algorithm.Equal(oidPBEWithSHAAnd40BitRC2CBC) {
+			keySize = 5
+		}
+		key := pkcs12KDF(sha1.New, 64, pw, params.Salt, params.Iterations, 1, keySize)
+		iv = pkcs12KDF(sha1.New, 64, pw, params.Salt, params.Iterations, 2, 8)
+		if keySize == 24 {
+			block, err = des.NewTripleDESCipher(key)
+		} else {
+			block = newRC2(key, keySize*8)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported PKCS#12 encryption algorithm %s", verror.UserDataError, alg.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 || len(iv) != block.BlockSize() {
+		return nil, errors.New("invalid encrypted data")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errIncorrectPassword
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errIncorrectPassword
+		}
+	}
+	return plain[:len(plain)-padding], nil
+}
+
+func pbes2Cipher(params pbes2Params, password string) (cipher.Block, []byte, error) {
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, nil, fmt.Errorf("%w: unsupported PBES2 key derivation %s", verror.UserDataError, params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if err := unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, nil, err
+	}
+	prf := sha1.New
+	switch alg := kdf.PRF.Algorithm; {
+	case len(alg) == 0, alg.Equal(oidHMACWithSHA1):
+	case alg.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case alg.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case alg.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported PBKDF2 function %s", verror.UserDataError, alg)
+	}
+	var keySize int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keySize = 16
+	case alg.Equal(oidAES192CBC):
+		keySize = 24
+	case alg.Equal(oidAES256CBC):
+		keySize = 32
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported PBES2 encryption %s", verror.UserDataError, alg)
+	}
+	var iv []byte
+	if err := unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, nil, err
+	}
+	key := pbkdf2.Key([]byte(password), kdf.Salt, kdf.Iterations, keySize, prf)
+	block, err := aes.NewCipher(key)
+	return block, iv, err
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package truststore adds CA certificates to Java truststores, JKS or PKCS#12 files, under aliases derived from the
+// certificates, so adding the same chain again changes nothing and a renewed CA replaces its previous certificate.
+package truststore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pavel-v-chernykh/keystore-go/v4"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// Format is the file format of a truststore
+type Format string
+
+const (
+	FormatJKS    Format = "jks"
+	FormatPKCS12 Format = "pkcs12"
+)
+
+// DefaultPassword is the password of the truststores of the JDK
+const DefaultPassword = "changeit"
+
+// DefaultAliasPrefix starts the aliases of the certificates added to a truststore
+const DefaultAliasPrefix = "vcert-"
+
+// jksMagic starts the Java keystores
+var jksMagic = []byte{0xfe, 0xed, 0xfe, 0xed}
+
+// ParseFormat returns the format named "jks" or "pkcs12", also called "p12"
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "jks":
+		return FormatJKS, nil
+	case "pkcs12", "p12":
+		return FormatPKCS12, nil
+	}
+	return "", fmt.Errorf("%w: unknown truststore format %q, use jks or pkcs12", verror.UserDataError, name)
+}
+
+// Store is a truststore. The entries of a Java keystore other than the trusted certificates, like private keys, are
+// kept as they are. A PKCS#12 file with such entries can be read but not written.
+type Store struct {
+	format Format
+	jks    keystore.KeyStore
+	p12    *pkcs12Store
+}
+
+// Result tells what Add did with the certificates, by alias
+type Result struct {
+	Added     []string
+	Updated   []string
+	Unchanged []string
+}
+
+// Changed tells whether the truststore must be written again
+func (r Result) Changed() bool {
+	return len(r.Added) > 0 || len(r.Updated) > 0
+}
+
+// New returns an empty truststore
+func New(format Format) (*Store, error) {
+	switch format {
+	case FormatJKS:
+		return &Store{format: format, jks: keystore.New(keystore.WithOrderedAliases())}, nil
+	case FormatPKCS12:
+		return &Store{format: format, p12: &pkcs12Store{}}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown truststore format %q", verror.UserDataError, format)
+}
+
+// Load decodes a truststore, JKS and PKCS#12 are told apart by their content. The password checks the integrity of
+// the file and decrypts the certificates of a PKCS#12 file.
+func Load(data []byte, password string) (*Store, error) {
+	if bytes.HasPrefix(data, jksMagic) {
+		ks := keystore.New(keystore.WithOrderedAliases())
+		err := ks.Load(bytes.NewReader(data), []byte(password))
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't read the Java keystore, check its password: %s", verror.UserDataError, err)
+		}
+		return &Store{format: FormatJKS, jks: ks}, nil
+	}
+	p12, err := decodePKCS12(data, password)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{format: FormatPKCS12, p12: p12}, nil
+}
+
+// Format returns the file format of the truststore
+func (s *Store) Format() Format {
+	return s.format
+}
+
+// Certificates returns the trusted certificates by alias. The PKCS#12 certificates without a friendly name are
+// returned under an alias made of their position.
+func (s *Store) Certificates() (map[string]*x509.Certificate, error) {
+	certs := map[string]*x509.Certificate{}
+	if s.format == FormatPKCS12 {
+		for i, e := range s.p12.trusted() {
+			alias := e.alias
+			if alias == "" {
+				alias = fmt.Sprintf("#%d", i+1)
+			}
+			certs[alias] = e.cert
+		}
+		return certs, nil
+	}
+	for _, alias := range s.jks.Aliases() {
+		if !s.jks.IsTrustedCertificateEntry(alias) {
+			continue
+		}
+		entry, err := s.jks.GetTrustedCertificateEntry(alias)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(entry.Certificate.Content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't read the certificate %s of the Java keystore: %s", verror.UserDataError, alias, err)
+		}
+		certs[alias] = cert
+	}
+	return certs, nil
+}
+
+// Add adds the CA certificates among certs, the others are ignored. A certificate the truststore already trusts,
+// under any alias, is left alone; one whose alias is taken by another certificate, a previous certificate of the
+// same CA, replaces it.
+func (s *Store) Add(certs []*x509.Certificate, aliasPrefix string) (Result, error) {
+	var result Result
+	existing, err := s.Certificates()
+	if err != nil {
+		return result, err
+	}
+	trusted := map[string]string{}
+	for alias, cert := range existing {
+		trusted[string(cert.Raw)] = alias
+	}
+	for _, cert := range certs {
+		if !isCA(cert) {
+			continue
+		}
+		if alias, ok := trusted[string(cert.Raw)]; ok {
+			result.Unchanged = append(result.Unchanged, alias)
+			continue
+		}
+		alias := Alias(aliasPrefix, cert)
+		if _, ok := existing[alias]; ok {
+			result.Updated = append(result.Updated, alias)
+		} else {
+			result.Added = append(result.Added, alias)
+		}
+		if s.format == FormatPKCS12 {
+			s.p12.setTrusted(alias, cert)
+		} else {
+			err = s.jks.SetTrustedCertificateEntry(alias, keystore.TrustedCertificateEntry{
+				CreationTime: time.Now(),
+				Certificate:  keystore.Certificate{Type: "X509", Content: cert.Raw},
+			})
+			if err != nil {
+				return result, err
+			}
+		}
+		existing[alias] = cert
+		trusted[string(cert.Raw)] = alias
+	}
+	sort.Strings(result.Unchanged)
+	return result, nil
+}
+
+// Encode returns the file of the truststore protected by password
+func (s *Store) Encode(password string) ([]byte, error) {
+	if s.format == FormatPKCS12 {
+		return s.p12.encode(password)
+	}
+	var buf bytes.Buffer
+	err := s.jks.Store(&buf, []byte(password))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Alias returns the alias of cert made of prefix, its common name in lower case with the characters other than
+// letters, digits, dots and dashes replaced, and the first 8 hex digits of the SHA-256 of its subject and public
+// key. A renewed CA certificate keeps the alias of the previous one.
+func Alias(prefix string, cert *x509.Certificate) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, cert.Subject.CommonName)
+	if name == "" {
+		name = "ca"
+	}
+	h := sha256.New()
+	h.Write(cert.RawSubject)
+	h.Write(cert.RawSubjectPublicKeyInfo)
+	return prefix + name + "-" + hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// isCA tells whether cert is a CA certificate, the self-signed ones without basic constraints included
+func isCA(cert *x509.Certificate) bool {
+	if cert.BasicConstraintsValid {
+		return cert.IsCA
+	}
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject)
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package truststore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// PKCS#12 files holding the certificate "Test Root CA" under the name "test root", made by OpenSSL 3 with
+// "openssl pkcs12 -export -nokeys -caname 'test root' -passout pass:changeit" and the default PBES2 AES-256, -legacy for RC2-40, and
+// -certpbe PBE-SHA1-3DES
+const (
+	opensslAES = "MIICxwIBAzCCAn0GCSqGSIb3DQEHAaCCAm4EggJqMIICZjCCAmIGCSqGSIb3DQEHBqCCAlMwggJPAgEAMIICSAYJKoZIhvcNAQcB" +
+		"MFcGCSqGSIb3DQEFDTBKMCkGCSqGSIb3DQEFDDAcBAjTXYk1ZRKE2QICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQMEASoEEJ47" +
+		"uQzFQFqR1Fs8o8vRFh6AggHgd3mvFq/9DIhRw9osCkG4moDMNTwN87ns5YtWilyAHULBaCVBDR5XzRyGzoJFbSyglb1yNVDxIahS" +
+		"2o9Hnwq9X+KhuC4371icJ50BxFbNPZeieevqFZ37rYj/MKiXJGUJT5DSSa6UWzdhjHHzqxhp/3PNSu3bj2bAf3ffG1qul5Ds/e57" +
+		"k/X8qx2TUnl9RZ7nuinnXtH9YGSjEwZsrA5JlbZb7g1r300jDrhmzPFcaVFVy+l/NGmijy5/c562ei4FMGpZq2RT/C6onavBfA2l" +
+		"6oHhLgItKRywu8jwcVJKk8gQ0Ev3brGK5VVUd/oSIcCfy9fcE1Qu9OsP3Ni2EG6xfTonR+JAuOdfAjwMry1PbucsijEWHtWPv4IC" +
+		"d38egSmYLee+AoyRhWiXi8FfC1449/QKitob43ZJMlZZN77SYrret0mbN5jzTc11ZunkIgHARcK+paLTcEyzu6V7JNW8PfgjeGzQ" +
+		"/g2CycDwZyOIEh2p+5IcCj4swaKUCR9XDttT5yYHHW05mGZNwoF4+Ujsk/b2V/fVtiI5DXMFr6OruEulbcesINTPfpamMYgz6fpK" +
+		"COjNAn2XfswZBw3ccOixswdm9WFx3fnDg5FbcTlZdsTuQh46lD/Paj/tCFqgtQJgMEEwMTANBglghkgBZQMEAgEFAAQgVY6tQKeZ" +
+		"6rF+HvPfJS9pNQ0oLLNvBFpWmUpU3V2r+4QECGw2bn3V6os6AgIIAA=="
+	opensslRC2 = "MIICfAIBAzCCAkIGCSqGSIb3DQEHAaCCAjMEggIvMIICKzCCAicGCSqGSIb3DQEHBqCCAhgwggIUAgEAMIICDQYJKoZIhvcNAQcB" +
+		"MBwGCiqGSIb3DQEMAQYwDgQIGJ0rbyt6hPkCAggAgIIB4Lep4GAElkns/X2ekVKy3Qj+EueR6T5wWXPdn5nBKuv5j7pkwZpJ+NgW" +
+		"TeB0hsMgFBtFoHW0sNgLSsIsRZhK+PmVvYcE7xNvn8WKtbeLnsJH9mETQPnuIRHxQaBYAi7YUqAPvnH814p6hspC5rnffVi6PIj3" +
+		"wDOP1vgI+Rbty+sFg8pwEpxJvpef5zQT8301fpXHo+2xA7oecT2eEu/1j4cKiccaSjtkAgIxzhrPZTYec7ug6yV1P3mrQcZURKeB" +
+		"MFL/Zc8NlKnFe1PngTgx06GgoO/moAOqCqIjDV2ZBQVcg3Iq4PigZP0nQryzWGU2RmJtjWLg5H4aPTGrKROLrhkNttSwAxsY/LlD" +
+		"N0H5jvd1o0Lt+H77Stbbh1nHYK9n6eCYzSNZGHq45lX04OWsjLm4SwWrB3N5IwdCHTOUsoaa4T8xufbU8FuTTX/77BCsG31GcKed" +
+		"uQQuQUAkccLY2I3mIftKZ8/Y48D9C9YiFHZKqmORYlC12x6STK8Hh1s1s9oDEbWe0WRjNzRaVgwzJfmzpXVXXIkj2XUIeTKfESJT" +
+		"H4hFPohtp7J3JEM9WCovOBgJ/a/DWkrXXRNSN9pAFVeojEgaWhzjvtlggt0Lw3QY/FaH4YYL7X5z1YRZybXKVDAxMCEwCQYFKw4D" +
+		"AhoFAAQUQCVFnjCeoMaobOrgbV0kZNLrKtQECGRaJAvA8kOkAgIIAA=="
+	openssl3DES = "MIICjAIBAzCCAkIGCSqGSIb3DQEHAaCCAjMEggIvMIICKzCCAicGCSqGSIb3DQEHBqCCAhgwggIUAgEAMIICDQYJKoZIhvcNAQcB" +
+		"MBwGCiqGSIb3DQEMAQMwDgQIswIdLM6J2+YCAggAgIIB4GldcHyfZ7RhN5udPLHH7AraAndrAMQa9Qm07J1OyQAZVg7WqBkLhyeB" +
+		"QWOJZR1yk796jBMszxdqypRDImKUYrH5z3DyubQYTdAIvCGTmioZ8qlK5U0f7L9fZP+plFhXucTVngtSNIQ/zqE5EeXLuv3jF/ae" +
+		"VeSOtRYVGRNeczE30NqFAeT+wpNjSWSJGJfmhFMz9sxYSudBcTwcD++unN6suJVM267zfiiSJAvAWmg3N6xwwtCvd+4ojS6yepiB" +
+		"jrHO0GAm+VPcOSTYrD5vgD3bSWXEgnng3BoHFdjUxze6x7uByJ11V/QYSduZ4NZrNUvNdJW/wz1Z4vEtqKpU8x0novl/ezwi3Tja" +
+		"fqJ73yJARpjj/8CVVqY+u4iDUXy/dCr3Nfqrnv1xZygCik+t8w6UcE61avdnuKP/mk9M7/p+rdG1l2vc+V7fGEctuAvNWEhiH9q1" +
+		"iOMjnZVWRYZSodPTXG/JgBXaBmcorwYq/NBIgDqju5C5bO64bjby1d36wRwogu/6R74gT+a09g8k5JTyBss/lzpURoY0waTTp8uh" +
+		"93L0LiUIUybIijp8txYWLr9He70RrgxH5uZi7sfpwf7aAFVwgdbzX8e00W+aasOXgQdmySYPiaHgwCg1vlCrXDBBMDEwDQYJYIZI" +
+		"AWUDBAIBBQAEIM/yvQIwEgEVXqJKG1gHkGjrX28OG7m2nPXDR05tshjjBAgwe9J86YazuQICCAA="
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, cn string, key *ecdsa.PrivateKey, parent *testCA, serial int64) *testCA {
+	if key == nil {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	parentCert, parentKey := tmpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func TestRC2(t *testing.T) {
+	// test vectors of RFC 2268
+	vectors := []struct {
+		key, plain, cipher string
+		bits               int
+	}{
+		{"0000000000000000", "0000000000000000", "ebb773f993278eff", 63},
+		{"ffffffffffffffff", "ffffffffffffffff", "278b27e42e2f0d49", 64},
+		{"88", "0000000000000000", "61a8a244adacccf0", 64},
+		{"88bca90e90875a7f0f79c384627bafb2", "0000000000000000", "2269552ab0f85ca6", 128},
+	}
+	for _, v := range vectors {
+		key, _ := hex.DecodeString(v.key)
+		plain, _ := hex.DecodeString(v.plain)
+		c := newRC2(key, v.bits)
+		out := make([]byte, 8)
+		c.Encrypt(out, plain)
+		if hex.EncodeToString(out) != v.cipher {
+			t.Errorf("key %s: got %x, expected %s", v.key, out, v.cipher)
+		}
+		c.Decrypt(out, out)
+		if !bytes.Equal(out, plain) {
+			t.Errorf("key %s: decrypted %x", v.key, out)
+		}
+	}
+}
+
+func TestLoadOpenSSL(t *testing.T) {
+	for name, encoded := range map[string]string{"aes": opensslAES, "rc2": opensslRC2, "3des": openssl3DES} {
+		data, _ := base64.StdEncoding.DecodeString(encoded)
+		s, err := Load(data, "changeit")
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		certs, err := s.Certificates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Format() != FormatPKCS12 || len(certs) != 1 || certs["test root"] == nil || certs["test root"].Subject.CommonName != "Test Root CA" {
+			t.Fatalf("%s: unexpected certificates %v", name, certs)
+		}
+		if _, err = Load(data, "wrong"); !errors.Is(err, verror.UserDataError) {
+			t.Fatalf("%s: expected a password error, got %v", name, err)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	root := newTestCA(t, "Example Root CA", nil, nil, 1)
+	intermediate := newTestCA(t, "Example Issuing CA", nil, root, 2)
+	leaf := newTestCA(t, "www.example.com", nil, intermediate, 3)
+	leaf.cert.IsCA = false
+	for _, format := range []Format{FormatJKS, FormatPKCS12} {
+		s, err := New(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := s.Add([]*x509.Certificate{leaf.cert, intermediate.cert, root.cert}, DefaultAliasPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Added) != 2 || !strings.HasPrefix(result.Added[0], "vcert-example_issuing_ca-") {
+			t.Fatalf("%s: unexpected result %+v", format, result)
+		}
+		data, err := s.Encode(DefaultPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// adding the chain again changes nothing, a renewed root replaces the previous one
+		s, err = Load(data, DefaultPassword)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		if s.Format() != format {
+			t.Fatalf("expected %s, got %s", format, s.Format())
+		}
+		result, err = s.Add([]*x509.Certificate{intermediate.cert, root.cert}, DefaultAliasPrefix)
+		if err != nil || result.Changed() || len(result.Unchanged) != 2 {
+			t.Fatalf("%s: unexpected result %+v %v", format, result, err)
+		}
+		renewed := newTestCA(t, "Example Root CA", root.key, nil, 4)
+		result, err = s.Add([]*x509.Certificate{renewed.cert}, DefaultAliasPrefix)
+		if err != nil || len(result.Updated) != 1 || result.Updated[0] != Alias(DefaultAliasPrefix, root.cert) {
+			t.Fatalf("%s: unexpected result %+v %v", format, result, err)
+		}
+		data, err = s.Encode("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err = Load(data, "secret")
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		certs, err := s.Certificates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(certs) != 2 || !certs[Alias(DefaultAliasPrefix, root.cert)].Equal(renewed.cert) {
+			t.Fatalf("%s: unexpected certificates %v", format, certs)
+		}
+		if _, err = Load(data, DefaultPassword); err == nil {
+			t.Fatalf("%s: expected a password error", format)
+		}
+	}
+}
+
+func TestAddKeepsEntries(t *testing.T) {
+	data, _ := base64.StdEncoding.DecodeString(opensslRC2)
+	s, err := Load(data, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := newTestCA(t, "Example Root CA", nil, nil, 1)
+	if _, err = s.Add([]*x509.Certificate{root.cert}, "corp-"); err != nil {
+		t.Fatal(err)
+	}
+	data, err = s.Encode("changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = Load(data, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := s.Certificates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || certs["test root"] == nil || certs[Alias("corp-", root.cert)] == nil {
+		t.Fatalf("unexpected certificates %v", certs)
+	}
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	root := newTestCA(t, "Example Root CA", nil, nil, 1)
+	s, err := New(FormatPKCS12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Add([]*x509.Certificate{root.cert}, DefaultAliasPrefix); err != nil {
+		t.Fatal(err)
+	}
+	data, err := s.Encode(DefaultPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Java only trusts the certificates marked as trusted
+	certs, err := pkcs12.DecodeTrustStore(data, DefaultPassword)
+	if err != nil || len(certs) != 1 || !certs[0].Equal(root.cert) {
+		t.Fatalf("unexpected Java truststore %v %v", certs, err)
+	}
+
+	// the private keys can't be written back
+	data, err = pkcs12.Encode(rand.Reader, root.key, root.cert, nil, DefaultPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = Load(data, DefaultPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Encode(DefaultPassword); !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected an error for the private key, got %v", err)
+	}
+}
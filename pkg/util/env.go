@@ -0,0 +1,76 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExpandEnv replaces the ${NAME} references in s with the value of the environment variable NAME, and the
+// ${NAME:-default} references with default when NAME is unset or empty. A reference to an unset variable without a
+// default is an error, so a value isn't silently dropped when a file is promoted to an environment missing it.
+// "$${" is kept as a literal "${", and a "$" not followed by "{" is left as it is.
+func ExpandEnv(s string) (string, error) {
+	return expandEnv(s, os.LookupEnv)
+}
+
+// CheckEnv checks the syntax of the references in s like ExpandEnv, without requiring the variables to be set
+func CheckEnv(s string) error {
+	_, err := expandEnv(s, func(string) (string, bool) { return "", true })
+	return err
+}
+
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.Index(s[i:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference %q", s[i:])
+		}
+		ref := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		name, def, hasDefault := ref, "", false
+		if j := strings.Index(ref, ":-"); j >= 0 {
+			name, def, hasDefault = ref[:j], ref[j+2:], true
+		}
+		if !validEnvName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+		v, ok := lookup(name)
+		switch {
+		case hasDefault && v == "":
+			v = def
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(v)
+	}
+}
+
+func validEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
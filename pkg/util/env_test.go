@@ -0,0 +1,57 @@
+package util
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("VCERT_TEST_ZONE", `Certificates\Web`)
+	os.Setenv("VCERT_TEST_EMPTY", "")
+	defer os.Unsetenv("VCERT_TEST_ZONE")
+	defer os.Unsetenv("VCERT_TEST_EMPTY")
+
+	cases := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${VCERT_TEST_ZONE}", `Certificates\Web`},
+		{"zone=${VCERT_TEST_ZONE}!", `zone=Certificates\Web!`},
+		{"${VCERT_TEST_UNSET:-https://tpp.example.com}", "https://tpp.example.com"},
+		{"${VCERT_TEST_EMPTY:-fallback}", "fallback"},
+		{"${VCERT_TEST_EMPTY}", ""},
+		{"${VCERT_TEST_ZONE:-fallback}", `Certificates\Web`},
+		{"${VCERT_TEST_UNSET:-}", ""},
+		{"p$ss$$word", "p$ss$$word"},
+		{"$${VCERT_TEST_ZONE}", "${VCERT_TEST_ZONE}"},
+	}
+	for _, c := range cases {
+		got, err := ExpandEnv(c.in)
+		if err != nil {
+			t.Errorf("ExpandEnv(%q) failed: %s", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ExpandEnv(%q) = %q, expected %q", c.in, got, c.want)
+		}
+	}
+
+	for _, in := range []string{"${VCERT_TEST_UNSET}", "${VCERT_TEST_ZONE", "${}", "${1ZONE}", "${ZONE-NAME}"} {
+		if _, err := ExpandEnv(in); err == nil {
+			t.Errorf("ExpandEnv(%q) should fail", in)
+		}
+	}
+}
+
+func TestCheckEnv(t *testing.T) {
+	for _, in := range []string{"plain", "${VCERT_TEST_UNSET}", "${VCERT_TEST_UNSET:-default}", "$${VCERT_TEST_UNSET"} {
+		if err := CheckEnv(in); err != nil {
+			t.Errorf("CheckEnv(%q) failed: %s", in, err)
+		}
+	}
+	for _, in := range []string{"${VCERT_TEST_ZONE", "${}", "${1ZONE}", "${ZONE-NAME}"} {
+		if err := CheckEnv(in); err == nil {
+			t.Errorf("CheckEnv(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+const (
+	// DefaultPasswordLength is the length of the passwords generated when PasswordPolicy.Length is not set
+	DefaultPasswordLength = 24
+	// DefaultPasswordCharset has the characters the generated passwords are made of when PasswordPolicy.Charset is
+	// not set, none of them needs to be quoted in a shell, a properties file or a URL
+	DefaultPasswordCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.~"
+	// MinPasswordStrength is the least entropy in bits a policy must give to the passwords
+	MinPasswordStrength = 80
+)
+
+// PasswordPolicy tells how the passwords encrypting private keys and keystores are generated
+type PasswordPolicy struct {
+	Length  int
+	Charset string
+}
+
+func (p PasswordPolicy) length() int {
+	if p.Length == 0 {
+		return DefaultPasswordLength
+	}
+	return p.Length
+}
+
+func (p PasswordPolicy) charset() []rune {
+	if p.Charset == "" {
+		return []rune(DefaultPasswordCharset)
+	}
+	var charset []rune
+	seen := map[rune]bool{}
+	for _, r := range p.Charset {
+		if !seen[r] {
+			seen[r] = true
+			charset = append(charset, r)
+		}
+	}
+	return charset
+}
+
+// Strength returns the entropy in bits of the passwords generated by the policy
+func (p PasswordPolicy) Strength() float64 {
+	n := len(p.charset())
+	if n < 2 {
+		return 0
+	}
+	return float64(p.length()) * math.Log2(float64(n))
+}
+
+// Validate checks that the policy generates passwords at least MinPasswordStrength bits strong
+func (p PasswordPolicy) Validate() error {
+	if p.Length < 0 {
+		return fmt.Errorf("password length can't be negative")
+	}
+	if s := p.Strength(); s < MinPasswordStrength {
+		return fmt.Errorf("passwords of %d characters out of %d are %.0f bits strong, at least %d are required",
+			p.length(), len(p.charset()), s, MinPasswordStrength)
+	}
+	return nil
+}
+
+// GeneratePassword returns a random password made by policy
+func GeneratePassword(policy PasswordPolicy) (string, error) {
+	err := policy.Validate()
+	if err != nil {
+		return "", err
+	}
+	charset := policy.charset()
+	max := big.NewInt(int64(len(charset)))
+	password := make([]rune, policy.length())
+	for i := range password {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %s", err)
+		}
+		password[i] = charset[n.Int64()]
+	}
+	return string(password), nil
+}
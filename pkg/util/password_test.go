@@ -0,0 +1,52 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	p1, err := GeneratePassword(PasswordPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := GeneratePassword(PasswordPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p1) != DefaultPasswordLength || p1 == p2 {
+		t.Fatalf("expected two different passwords of %d characters, got %q and %q", DefaultPasswordLength, p1, p2)
+	}
+	for _, r := range p1 {
+		if !strings.ContainsRune(DefaultPasswordCharset, r) {
+			t.Fatalf("password %q has a character out of the default charset", p1)
+		}
+	}
+
+	p, err := GeneratePassword(PasswordPolicy{Length: 40, Charset: "0123456789abcdef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 40 || strings.Trim(p, "0123456789abcdef") != "" {
+		t.Fatalf("expected 40 hex digits, got %q", p)
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	for _, p := range []PasswordPolicy{
+		{Length: 12},
+		{Length: -1},
+		{Length: 100, Charset: "aaaa"},
+		{Length: 20, Charset: "0123456789"},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("expected policy %+v to be too weak", p)
+		}
+		if _, err := GeneratePassword(p); err == nil {
+			t.Fatalf("expected no password to be generated by policy %+v", p)
+		}
+	}
+	if err := (PasswordPolicy{Length: 25, Charset: "0123456789"}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
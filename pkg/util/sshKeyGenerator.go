@@ -1,9 +1,13 @@
 package util
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/pem"
 	"fmt"
 	"github.com/youmark/pkcs8"
@@ -128,3 +132,68 @@ func GenerateSshKeyPair(bitSize int, keyPassword, certId string, format ...strin
 	return privateKeyBytes, []byte(sPubKey), nil
 
 }
+
+// MarshalSshPrivateKey encodes key the way ssh-keygen writes it: Ed25519 keys in the OpenSSH format, RSA and ECDSA
+// keys in PEM like ssh-keygen -m PEM, encrypted with keyPassword when it's set. Only the PEM keys can be encrypted.
+func MarshalSshPrivateKey(key crypto.Signer, keyPassword string) ([]byte, error) {
+	var blockType string
+	var der []byte
+	var err error
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		if keyPassword != "" {
+			return nil, fmt.Errorf("encrypting an Ed25519 key in the OpenSSH format isn't supported, use ssh-keygen -p to protect it")
+		}
+		return marshalOpenSshEd25519PrivateKey(k)
+	case *rsa.PrivateKey:
+		blockType, der = RsaPrivKeyType, x509.MarshalPKCS1PrivateKey(k)
+	case *ecdsa.PrivateKey:
+		blockType = "EC PRIVATE KEY"
+		der, err = x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported SSH private key %T", key)
+	}
+	block := &pem.Block{Type: blockType, Bytes: der}
+	if keyPassword != "" {
+		block, err = X509EncryptPEMBlock(rand.Reader, blockType, der, []byte(keyPassword), PEMCipherAES256)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// marshalOpenSshEd25519PrivateKey encodes an unencrypted Ed25519 key in the openssh-key-v1 format, which this
+// version of x/crypto/ssh can read but not write
+func marshalOpenSshEd25519PrivateKey(key ed25519.PrivateKey) ([]byte, error) {
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	var check [4]byte
+	_, _ = rand.Read(check[:])
+	checkValue := binary.BigEndian.Uint32(check[:])
+	block := ssh.Marshal(struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Pub     []byte
+		Priv    []byte
+		Comment string
+	}{checkValue, checkValue, ssh.KeyAlgoED25519, []byte(key.Public().(ed25519.PublicKey)), []byte(key), ""})
+	for i := byte(1); len(block)%8 != 0; i++ {
+		block = append(block, i)
+	}
+	data := ssh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{"none", "none", "", 1, pub.Marshal(), block})
+	return pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: append([]byte("openssh-key-v1\x00"), data...)}), nil
+}
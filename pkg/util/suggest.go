@@ -0,0 +1,53 @@
+package util
+
+import "strings"
+
+// Suggest returns the candidate closest to word, compared case insensitively, to propose it in place of a
+// misspelled name. It's empty when no candidate is within 2 edits of word, or 1 edit for words of up to 4 letters.
+func Suggest(word string, candidates []string) string {
+	max := 2
+	if len(word) <= 4 {
+		max = 1
+	}
+	best, bestDistance := "", max+1
+	w := strings.ToLower(word)
+	for _, c := range candidates {
+		d := editDistance(w, strings.ToLower(c))
+		if d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,22 @@
+package util
+
+import "testing"
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"commonName", "organization", "orgUnits", "dns", "ip"}
+	cases := []struct {
+		word, want string
+	}{
+		{"comonName", "commonName"},
+		{"CommonNmae", "commonName"},
+		{"organisation", "organization"},
+		{"dsn", ""},
+		{"dnss", "dns"},
+		{"locality", ""},
+	}
+	for _, c := range cases {
+		if got := Suggest(c.word, candidates); got != c.want {
+			t.Errorf("Suggest(%q) = %q, expected %q", c.word, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package vault keeps a local archive of issued certificates with their chains and private keys, encrypted with age
+// to the recipients of master keys, so they can be restored when the systems using them are rebuilt. The index of
+// the archive only holds the public details of the certificates and stays in clear, so the archive can be searched
+// by common name or thumbprint without the master keys.
+package vault
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/age"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const (
+	indexFile     = "index.json"
+	entryFileExt  = ".age"
+	indexVersion  = 1
+	vaultDirPerm  = 0700
+	vaultFilePerm = 0600
+)
+
+// Entry describes a certificate stored in the vault
+type Entry struct {
+	Thumbprint   string    `json:"thumbprint"`
+	CommonName   string    `json:"commonName"`
+	DNSNames     []string  `json:"dnsNames,omitempty"`
+	SerialNumber string    `json:"serialNumber"`
+	NotAfter     time.Time `json:"notAfter"`
+	// PrivateKey tells whether the private key of the certificate is stored with it
+	PrivateKey bool      `json:"privateKey"`
+	StoredAt   time.Time `json:"storedAt"`
+}
+
+type index struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// Vault is an archive of certificates in a directory
+type Vault struct {
+	Dir string
+	// Now returns the current time, it's time.Now when not set
+	Now func() time.Time
+
+	entries []Entry
+}
+
+// Open opens the vault in dir, which is created when it doesn't exist
+func Open(dir string) (*Vault, error) {
+	err := os.MkdirAll(dir, vaultDirPerm)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create vault: %s", verror.UserDataError, err)
+	}
+	v := &Vault{Dir: dir}
+	data, err := ioutil.ReadFile(filepath.Join(dir, indexFile))
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read vault index: %s", verror.UserDataError, err)
+	}
+	var idx index
+	err = json.Unmarshal(data, &idx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse vault index: %s", verror.UserDataError, err)
+	}
+	if idx.Version != indexVersion {
+		return nil, fmt.Errorf("%w: unsupported vault index version %d", verror.UserDataError, idx.Version)
+	}
+	v.entries = idx.Entries
+	return v, nil
+}
+
+// Entries returns the certificates in the vault, the ones expiring last first
+func (v *Vault) Entries() []Entry {
+	entries := append([]Entry(nil), v.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].NotAfter.After(entries[j].NotAfter)
+	})
+	return entries
+}
+
+// Find returns the certificates whose thumbprint, common name or DNS name is query, compared case insensitively,
+// the ones expiring last first
+func (v *Vault) Find(query string) []Entry {
+	thumbprint := normalizeThumbprint(query)
+	var found []Entry
+	for _, e := range v.Entries() {
+		if e.Thumbprint == thumbprint || strings.EqualFold(e.CommonName, query) || containsFold(e.DNSNames, query) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Store encrypts the certificate, chain and private key of pcc to the recipients and adds them to the vault,
+// replacing the same certificate stored before. The private key is stored as it is, encrypted when pcc has an
+// encrypted key.
+func (v *Vault) Store(pcc *certificate.PEMCollection, recipients ...*age.Recipient) (*Entry, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: at least one recipient is required to store a certificate", verror.UserDataError)
+	}
+	b, _ := pem.Decode([]byte(pcc.Certificate))
+	if b == nil {
+		return nil, fmt.Errorf("%w: no PEM data found in the certificate", verror.UserDataError)
+	}
+	cert, err := certificate.ParseCertificate(b.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse the certificate: %s", verror.UserDataError, err)
+	}
+	sum := sha1.Sum(cert.Raw)
+	entry := Entry{
+		Thumbprint:   strings.ToUpper(hex.EncodeToString(sum[:])),
+		CommonName:   cert.Subject.CommonName,
+		DNSNames:     cert.DNSNames,
+		SerialNumber: strings.ToUpper(cert.SerialNumber.Text(16)),
+		NotAfter:     cert.NotAfter.UTC(),
+		PrivateKey:   pcc.PrivateKey != "",
+		StoredAt:     v.now().UTC().Truncate(time.Second),
+	}
+
+	plaintext, err := json.Marshal(pcc)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := age.Encrypt(plaintext, false, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(v.entryPath(entry.Thumbprint), encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{entry}
+	for _, e := range v.entries {
+		if e.Thumbprint != entry.Thumbprint {
+			entries = append(entries, e)
+		}
+	}
+	err = v.writeIndex(entries)
+	if err != nil {
+		return nil, err
+	}
+	v.entries = entries
+	return &entry, nil
+}
+
+// Restore decrypts the certificate with thumbprint with the first of the identities that is one of its recipients
+func (v *Vault) Restore(thumbprint string, identities ...*age.Identity) (*certificate.PEMCollection, error) {
+	thumbprint = normalizeThumbprint(thumbprint)
+	found := false
+	for _, e := range v.entries {
+		if e.Thumbprint == thumbprint {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: certificate %s is not in the vault", verror.UserDataError, thumbprint)
+	}
+	data, err := ioutil.ReadFile(v.entryPath(thumbprint))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read certificate %s: %s", verror.UserDataError, thumbprint, err)
+	}
+	plaintext, err := age.Decrypt(data, identities...)
+	if err != nil {
+		return nil, err
+	}
+	pcc := &certificate.PEMCollection{}
+	err = json.Unmarshal(plaintext, pcc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse certificate %s: %s", verror.UserDataError, thumbprint, err)
+	}
+	return pcc, nil
+}
+
+func (v *Vault) entryPath(thumbprint string) string {
+	return filepath.Join(v.Dir, thumbprint+entryFileExt)
+}
+
+func (v *Vault) writeIndex(entries []Entry) error {
+	data, err := json.MarshalIndent(&index{Version: indexVersion, Entries: entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(v.Dir, indexFile), data)
+}
+
+func (v *Vault) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+// normalizeThumbprint accepts the thumbprints with colons or in lower case
+func normalizeThumbprint(s string) string {
+	return strings.ToUpper(strings.Replace(s, ":", "", -1))
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, data, vaultFilePerm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/age"
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func selfSigned(t *testing.T, cn string, notAfter time.Time) *certificate.PEMCollection {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn, "alt." + cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcc, err := certificate.NewPEMCollection(cert, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcc.Chain = []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+	return pcc
+}
+
+func TestStoreRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	id, err := age.GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := selfSigned(t, "www.example.com", time.Now().Add(24*time.Hour))
+	current := selfSigned(t, "www.example.com", time.Now().Add(90*24*time.Hour))
+	other := selfSigned(t, "api.example.com", time.Now().Add(30*24*time.Hour))
+	var stored []*Entry
+	for _, pcc := range []*certificate.PEMCollection{old, current, other} {
+		e, err := v.Store(pcc, id.Recipient())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored = append(stored, e)
+	}
+	// storing the same certificate again replaces it
+	if _, err = v.Store(current, id.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(v.entryPath(stored[1].Thumbprint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "PRIVATE KEY") {
+		t.Fatal("the vault should not hold private keys in clear")
+	}
+
+	v, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(v.Entries()); n != 3 {
+		t.Fatalf("expected 3 certificates in the vault, got %d", n)
+	}
+	found := v.Find("WWW.example.com")
+	if len(found) != 2 || found[0].Thumbprint != stored[1].Thumbprint || found[1].Thumbprint != stored[0].Thumbprint {
+		t.Fatalf("unexpected certificates found by common name: %+v", found)
+	}
+	if found = v.Find("alt.api.example.com"); len(found) != 1 || found[0].Thumbprint != stored[2].Thumbprint {
+		t.Fatalf("unexpected certificates found by DNS name: %+v", found)
+	}
+	if found = v.Find(strings.ToLower(stored[2].Thumbprint)); len(found) != 1 || !found[0].PrivateKey {
+		t.Fatalf("unexpected certificates found by thumbprint: %+v", found)
+	}
+
+	pcc, err := v.Restore(stored[1].Thumbprint, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pcc, current) {
+		t.Fatalf("restored certificate differs:\n%+v\n%+v", pcc, current)
+	}
+
+	other2, _ := age.GenerateIdentity()
+	_, err = v.Restore(stored[1].Thumbprint, other2)
+	if !errors.Is(err, age.ErrNoIdentity) {
+		t.Fatalf("expected ErrNoIdentity, got %v", err)
+	}
+	_, err = v.Restore("00", id)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error, got %v", err)
+	}
+	_, err = v.Store(current)
+	if !errors.Is(err, verror.UserDataError) {
+		t.Fatalf("expected a user data error without recipients, got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloud
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+)
+
+// issuerCache keeps the PEM of the issuing CA certificates by their Venafi Cloud certificate ID, so that a bulk
+// retrieval doesn't download the same chain for every certificate signed by the same CA.
+type issuerCache struct {
+	mu    sync.RWMutex
+	certs map[string]string
+}
+
+func (ic *issuerCache) get(id string) (string, bool) {
+	ic.mu.RLock()
+	defer ic.mu.RUnlock()
+	p, ok := ic.certs[id]
+	return p, ok
+}
+
+func (ic *issuerCache) put(id string, p string) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if ic.certs == nil {
+		ic.certs = make(map[string]string)
+	}
+	ic.certs[id] = p
+}
+
+// retrieveCertificateAndChain downloads the end-entity certificate while the chain is resolved from the issuer
+// cache, fetching only the issuers that haven't been seen yet.
+func (c *Connector) retrieveCertificateAndChain(url string, issuerIds []string, req *certificate.Request) (*certificate.PEMCollection, error) {
+	var (
+		wg         sync.WaitGroup
+		statusCode int
+		status     string
+		body       []byte
+		err        error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		statusCode, status, body, err = c.waitForCertificate(fmt.Sprintf("%s?chainOrder=%s&format=PEM", url, condorChainOptionEEOnly), req)
+	}()
+	chain, chainErr := c.getIssuerCertificates(issuerIds)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	if statusCode == http.StatusConflict { // Http Status Code 409 means the certificate has not been signed by the ca yet.
+		return nil, endpoint.ErrCertificatePending{CertificateID: req.PickupID}
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve certificate. StatusCode: %d -- Status: %s", statusCode, status)
+	}
+	if chainErr != nil {
+		return nil, chainErr
+	}
+
+	leaf, err := newPEMCollectionFromResponse(body, certificate.ChainOptionIgnore)
+	if err != nil {
+		return nil, err
+	}
+	ordered, err := orderChain(leaf.Certificate, chain)
+	if err != nil {
+		return nil, err
+	}
+	certificates, err := newPEMCollectionFromResponse([]byte(leaf.Certificate+strings.Join(ordered, "")), certificate.ChainOptionRootLast)
+	if err != nil {
+		return nil, err
+	}
+	if req.ChainOption == certificate.ChainOptionRootFirst {
+		for i, j := 0, len(certificates.Chain)-1; i < j; i, j = i+1, j-1 {
+			certificates.Chain[i], certificates.Chain[j] = certificates.Chain[j], certificates.Chain[i]
+		}
+	}
+	if err = req.SelectChain(certificates); err != nil {
+		return nil, err
+	}
+	err = req.CheckCertificate(certificates.Certificate)
+	req.CheckChain(certificates)
+	return certificates, err
+}
+
+// getIssuerCertificates returns the PEM of each issuer, in the same order as ids. The issuers missing from the
+// cache are downloaded in parallel.
+func (c *Connector) getIssuerCertificates(ids []string) ([]string, error) {
+	pems := make([]string, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		if p, ok := c.issuers.get(id); ok {
+			pems[i] = p
+			continue
+		}
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			url := fmt.Sprintf(c.getURL(urlResourceCertificateRetrievePem), id)
+			url = fmt.Sprintf("%s?chainOrder=%s&format=PEM", url, condorChainOptionEEOnly)
+			statusCode, status, body, err := c.request("GET", url, nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if statusCode != http.StatusOK {
+				errs[i] = fmt.Errorf("failed to retrieve issuer certificate %s. StatusCode: %d -- Status: %s", id, statusCode, status)
+				return
+			}
+			p := string(bytes.TrimSpace(body)) + "\n"
+			c.issuers.put(id, p)
+			pems[i] = p
+		}(i, id)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pems, nil
+}
+
+// orderChain sorts the issuers from the one that signed leafPEM up to the root, so the result doesn't depend on
+// the order the service lists them in. Issuers that don't belong to the path are dropped. When several issuers
+// have the expected name, e.g. a re-keyed CA, the one whose key verifies the signature is picked.
+func orderChain(leafPEM string, issuers []string) ([]string, error) {
+	parse := func(p string) (*x509.Certificate, error) {
+		b, _ := pem.Decode([]byte(p))
+		if b == nil {
+			return nil, fmt.Errorf("failed to decode certificate PEM")
+		}
+		return certificate.ParseCertificate(b.Bytes)
+	}
+	current, err := parse(leafPEM)
+	if err != nil {
+		return nil, err
+	}
+	parsed := make([]*x509.Certificate, len(issuers))
+	for i := range issuers {
+		parsed[i], err = parse(issuers[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ordered []string
+	used := make([]bool, len(issuers))
+	for len(ordered) < len(issuers) {
+		next := -1
+		for i, cert := range parsed {
+			if !used[i] && bytes.Equal(cert.RawSubject, current.RawIssuer) {
+				if next == -1 {
+					next = i
+				}
+				if certificate.CheckSignatureFrom(current, cert) == nil {
+					next = i
+					break
+				}
+			}
+		}
+		if next == -1 {
+			break
+		}
+		used[next] = true
+		ordered = append(ordered, issuers[next])
+		if bytes.Equal(parsed[next].RawSubject, parsed[next].RawIssuer) {
+			break
+		}
+		current = parsed[next]
+	}
+	return ordered, nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloud
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newTestCert(t *testing.T, cn string, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+func TestRetrieveCertificateAndChainUsesCache(t *testing.T) {
+	root := newTestCert(t, "root", true, nil)
+	intermediate := newTestCert(t, "intermediate", true, root)
+	leaf := newTestCert(t, "leaf.example.com", false, intermediate)
+
+	var issuerHits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/certificates/leaf/contents"):
+			_, _ = w.Write([]byte(leaf.pem))
+		case strings.HasSuffix(r.URL.Path, "/certificates/root/contents"):
+			atomic.AddInt32(&issuerHits, 1)
+			_, _ = w.Write([]byte(root.pem))
+		case strings.HasSuffix(r.URL.Path, "/certificates/intermediate/contents"):
+			atomic.AddInt32(&issuerHits, 1)
+			_, _ = w.Write([]byte(intermediate.pem))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &Connector{baseURL: server.URL + "/", user: &userDetails{Company: &company{}}, client: server.Client()}
+	url := c.getURL(urlResourceCertificateRetrievePem)
+	url = strings.Replace(url, "%s", "leaf", 1)
+
+	for i := 0; i < 3; i++ {
+		req := &certificate.Request{PickupID: "leaf", ChainOption: certificate.ChainOptionRootFirst}
+		pcc, err := c.retrieveCertificateAndChain(url, []string{"root", "intermediate"}, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pcc.Certificate != leaf.pem {
+			t.Fatalf("unexpected leaf certificate: %s", pcc.Certificate)
+		}
+		if len(pcc.Chain) != 2 || pcc.Chain[0] != root.pem || pcc.Chain[1] != intermediate.pem {
+			t.Fatalf("unexpected chain: %v", pcc.Chain)
+		}
+	}
+	if issuerHits != 2 {
+		t.Fatalf("issuers should be fetched once each, got %d requests", issuerHits)
+	}
+}
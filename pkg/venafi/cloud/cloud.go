@@ -18,6 +18,7 @@ package cloud
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"crypto/tls"
 	"encoding/json"
@@ -230,6 +231,10 @@ type ApplicationDetails struct {
 
 //GenerateRequest generates a CertificateRequest based on the zone configuration, and returns the request along with the private key.
 func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+	err = req.NormalizeIDN()
+	if err != nil {
+		return err
+	}
 	switch req.CsrOrigin {
 	case certificate.LocalGeneratedCSR:
 		if config == nil {
@@ -239,6 +244,9 @@ func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *cer
 			}
 		}
 		config.UpdateCertificateRequest(req)
+		if err := config.ValidateDNSNames(req.DNSNames); err != nil {
+			return err
+		}
 		if err := req.GeneratePrivateKey(); err != nil {
 			return err
 		}
@@ -262,7 +270,12 @@ func (c *Connector) getURL(resource urlResource) string {
 	return fmt.Sprintf("%s%s", c.baseURL, resource)
 }
 
+// maxIdleConnsPerHost keeps enough connections to the server open for concurrent enrollments to reuse them
+const maxIdleConnsPerHost = 100
+
 func (c *Connector) getHTTPClient() *http.Client {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
 	if c.client != nil {
 		return c.client
 	}
@@ -274,6 +287,7 @@ func (c *Connector) getHTTPClient() *http.Client {
 			DualStack: true,
 		}).DialContext,
 		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
@@ -297,6 +311,10 @@ func (c *Connector) getHTTPClient() *http.Client {
 }
 
 func (c *Connector) request(method string, url string, data interface{}, authNotRequired ...bool) (statusCode int, statusText string, body []byte, err error) {
+	return c.requestContext(context.Background(), method, url, data, authNotRequired...)
+}
+
+func (c *Connector) requestContext(ctx context.Context, method string, url string, data interface{}, authNotRequired ...bool) (statusCode int, statusText string, body []byte, err error) {
 	if c.user == nil || c.user.Company == nil {
 		if !(len(authNotRequired) == 1 && authNotRequired[0]) {
 			err = fmt.Errorf("%w: must be autheticated to retrieve certificate", verror.VcertError)
@@ -314,7 +332,7 @@ func (c *Connector) request(method string, url string, data interface{}, authNot
 		payload = bytes.NewReader(b)
 	}
 
-	r, err := http.NewRequest(method, url, payload)
+	r, err := http.NewRequestWithContext(ctx, method, url, payload)
 	if err != nil {
 		err = fmt.Errorf("%w: %v", verror.VcertError, err)
 		return
@@ -347,6 +365,8 @@ func (c *Connector) request(method string, url string, data interface{}, authNot
 	body, err = ioutil.ReadAll(res.Body)
 	if err != nil {
 		err = fmt.Errorf("%w: %v", verror.ServerError, err)
+	} else if statusCode == http.StatusTooManyRequests {
+		err = endpoint.ErrRateLimited{RetryAfter: endpoint.ParseRetryAfter(res.Header.Get("Retry-After"), time.Now())}
 	}
 	// Do not enable trace in production
 	trace := false // IMPORTANT: sensitive information can be diclosured
@@ -371,13 +391,13 @@ func parseUserDetailsResult(expectedStatusCode int, httpStatusCode int, httpStat
 	}
 	respErrors, err := parseResponseErrors(body)
 	if err != nil {
-		return nil, err // parseResponseErrors always return verror.ServerError
+		return nil, verror.NewStatusError(httpStatusCode, err) // parseResponseErrors always return verror.ServerError
 	}
 	respError := fmt.Sprintf("unexpected status code on Venafi Cloud registration. Status: %s\n", httpStatus)
 	for _, e := range respErrors {
 		respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 	}
-	return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+	return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 }
 
 func parseUserDetailsResultFromPOST(httpStatusCode int, httpStatus string, body []byte) (*userDetails, error) {
@@ -386,13 +406,13 @@ func parseUserDetailsResultFromPOST(httpStatusCode int, httpStatus string, body
 	}
 	respErrors, err := parseResponseErrors(body)
 	if err != nil {
-		return nil, err // parseResponseErrors always return verror.ServerError
+		return nil, verror.NewStatusError(httpStatusCode, err) // parseResponseErrors always return verror.ServerError
 	}
 	respError := fmt.Sprintf("unexpected status code on Venafi Cloud registration. Status: %s\n", httpStatus)
 	for _, e := range respErrors {
 		respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 	}
-	return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+	return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 }
 
 func parseUserDetailsData(b []byte) (*userDetails, error) {
@@ -411,13 +431,13 @@ func parseUserByIdResult(expectedStatusCode int, httpStatusCode int, httpStatus
 	}
 	respErrors, err := parseResponseErrors(body)
 	if err != nil {
-		return nil, err // parseResponseErrors always return verror.ServerError
+		return nil, verror.NewStatusError(httpStatusCode, err) // parseResponseErrors always return verror.ServerError
 	}
 	respError := fmt.Sprintf("unexpected status code on retrieval of user by ID. Status: %s\n", httpStatus)
 	for _, e := range respErrors {
 		respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 	}
-	return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+	return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 }
 
 func parseUserByIdData(b []byte) (*user, error) {
@@ -436,13 +456,13 @@ func parseUsersByNameResult(expectedStatusCode int, httpStatusCode int, httpStat
 	}
 	respErrors, err := parseResponseErrors(body)
 	if err != nil {
-		return nil, err // parseResponseErrors always return verror.ServerError
+		return nil, verror.NewStatusError(httpStatusCode, err) // parseResponseErrors always return verror.ServerError
 	}
 	respError := fmt.Sprintf("unexpected status code on retrieval of users by name. Status: %s\n", httpStatus)
 	for _, e := range respErrors {
 		respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 	}
-	return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+	return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 }
 
 func parseUsersByNameData(b []byte) (*users, error) {
@@ -461,13 +481,13 @@ func parseTeamsResult(expectedStatusCode int, httpStatusCode int, httpStatus str
 	}
 	respErrors, err := parseResponseErrors(body)
 	if err != nil {
-		return nil, err // parseResponseErrors always return verror.ServerError
+		return nil, verror.NewStatusError(httpStatusCode, err) // parseResponseErrors always return verror.ServerError
 	}
 	respError := fmt.Sprintf("unexpected status code on retrieval of teams. Status: %s\n", httpStatus)
 	for _, e := range respErrors {
 		respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 	}
-	return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+	return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 }
 
 func parseTeamsData(b []byte) (*teams, error) {
@@ -489,7 +509,7 @@ func parseZoneConfigurationResult(httpStatusCode int, httpStatus string, body []
 	default:
 		respErrors, err := parseResponseErrors(body)
 		if err != nil {
-			return nil, err
+			return nil, verror.NewStatusError(httpStatusCode, err)
 		}
 
 		respError := fmt.Sprintf("Unexpected status code on Venafi Cloud zone read. Status: %s\n", httpStatus)
@@ -499,7 +519,7 @@ func parseZoneConfigurationResult(httpStatusCode int, httpStatus string, body []
 			}
 			respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 		}
-		return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+		return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 	}
 }
 
@@ -521,7 +541,7 @@ func parseCertificateTemplateResult(httpStatusCode int, httpStatus string, body
 	default:
 		respErrors, err := parseResponseErrors(body)
 		if err != nil {
-			return nil, err
+			return nil, verror.NewStatusError(httpStatusCode, err)
 		}
 
 		respError := fmt.Sprintf("Unexpected status code on Venafi Cloud zone read. Status: %s\n", httpStatus)
@@ -531,7 +551,7 @@ func parseCertificateTemplateResult(httpStatusCode int, httpStatus string, body
 			}
 			respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 		}
-		return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+		return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 	}
 }
 
@@ -551,14 +571,14 @@ func parseCertificateRequestResult(httpStatusCode int, httpStatus string, body [
 	default:
 		respErrors, err := parseResponseErrors(body)
 		if err != nil {
-			return nil, err
+			return nil, verror.NewStatusError(httpStatusCode, err)
 		}
 
 		respError := fmt.Sprintf("Unexpected status code on Venafi Cloud zone read. Status: %s\n", httpStatus)
 		for _, e := range respErrors {
 			respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 		}
-		return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+		return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 	}
 }
 
@@ -590,7 +610,7 @@ func parseApplicationDetailsResult(httpStatusCode int, httpStatus string, body [
 	default:
 		respErrors, err := parseResponseErrors(body)
 		if err != nil {
-			return nil, err
+			return nil, verror.NewStatusError(httpStatusCode, err)
 		}
 
 		respError := fmt.Sprintf("Unexpected status code on Venafi Cloud application read. Status: %s\n", httpStatus)
@@ -600,7 +620,7 @@ func parseApplicationDetailsResult(httpStatusCode int, httpStatus string, body [
 			}
 			respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 		}
-		return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+		return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 	}
 }
 
@@ -614,49 +634,41 @@ func parseApplicationDetailsData(b []byte) (*ApplicationDetails, error) {
 }
 
 type cloudZone struct {
-	zone          string
-	appName       string
-	templateAlias string
+	zone string
 }
 
 func (z cloudZone) String() string {
 	return z.zone
 }
 
-func (z *cloudZone) getApplicationName() string {
-	if z.appName == "" {
-		err := z.parseZone()
-		if err != nil {
-			return ""
-		}
+func (z cloudZone) getApplicationName() string {
+	appName, _, err := z.parseZone()
+	if err != nil {
+		return ""
 	}
-	return z.appName
+	return appName
 }
 
-func (z *cloudZone) getTemplateAlias() string {
-	if z.templateAlias == "" {
-		err := z.parseZone()
-		if err != nil {
-			return ""
-		}
+func (z cloudZone) getTemplateAlias() string {
+	_, templateAlias, err := z.parseZone()
+	if err != nil {
+		return ""
 	}
-	return z.templateAlias
+	return templateAlias
 }
 
-func (z *cloudZone) parseZone() error {
+// parseZone splits the zone into its application name and template alias
+func (z cloudZone) parseZone() (appName, templateAlias string, err error) {
 	if z.zone == "" {
-		return fmt.Errorf("zone not specified")
+		return "", "", fmt.Errorf("zone not specified")
 	}
 
 	segments := strings.Split(z.zone, "\\")
 	if len(segments) > 2 || len(segments) < 2 {
-		return fmt.Errorf("invalid zone format")
+		return "", "", fmt.Errorf("invalid zone format")
 	}
 
-	z.appName = segments[0]
-	z.templateAlias = segments[1]
-
-	return nil
+	return segments[0], segments[1], nil
 }
 
 func createAppUpdateRequest(applicationDetails *ApplicationDetails) policy.Application {
@@ -934,13 +946,13 @@ func parseCitResult(expectedStatusCode int, httpStatusCode int, httpStatus strin
 	}
 	respErrors, err := parseResponseErrors(body)
 	if err != nil {
-		return nil, err // parseResponseErrors always return verror.ServerError
+		return nil, verror.NewStatusError(httpStatusCode, err) // parseResponseErrors always return verror.ServerError
 	}
 	respError := fmt.Sprintf("unexpected status code on Venafi Cloud registration. Status: %s\n", httpStatus)
 	for _, e := range respErrors {
 		respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 	}
-	return nil, fmt.Errorf("%w: %v", verror.ServerError, respError)
+	return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("%w: %v", verror.ServerError, respError))
 }
 
 func parseCitDetailsData(b []byte, status int) (*certificateTemplate, error) {
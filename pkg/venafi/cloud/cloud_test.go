@@ -17,9 +17,16 @@
 package cloud
 
 import (
+	"errors"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var (
@@ -139,3 +146,97 @@ func TestParseCertificateRetrieveResponse(t *testing.T) {
 		t.Fatalf("err is not nil, err: %s", err)
 	}
 }
+
+func TestRequestRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := &Connector{baseURL: server.URL + "/", user: &userDetails{Company: &company{}}, client: server.Client()}
+	_, _, _, err := c.request("GET", c.getURL(urlResourceCertificates), nil)
+	var rateLimited endpoint.ErrRateLimited
+	if !errors.As(err, &rateLimited) || rateLimited.RetryAfter != 7*time.Second {
+		t.Fatalf("expected rate limited error with retry after 7s, got %v", err)
+	}
+}
+
+func TestConcurrentZoneAndPolicyCalls(t *testing.T) {
+	var mu sync.Mutex
+	templates := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/certificateissuingtemplates/"):
+			mu.Lock()
+			templates[strings.TrimPrefix(r.URL.Path, "/outagedetection/v1/applications/")]++
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"id":"template","name":"template"}`))
+		case strings.HasSuffix(r.URL.Path, "/useraccounts"):
+			_, _ = w.Write(successGetUserAccount)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	user := &userDetails{Company: &company{}}
+	c := &Connector{baseURL: server.URL + "/", user: user, client: server.Client()}
+	c.SetZone("Enroll\\Web")
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ReadZoneConfiguration(); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if exist, err := PolicyExist("Policy\\Other", c); err != nil || !exist {
+				t.Errorf("expected the policy to exist, got %v, %v", exist, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := c.getOwnerFromUserDetails(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := map[string]int{"Enroll/certificateissuingtemplates/Web": n, "Policy/certificateissuingtemplates/Other": n}
+	for path, count := range expected {
+		if templates[path] != count {
+			t.Errorf("expected %d reads of %s, got %v", count, path, templates)
+		}
+	}
+	if c.zone.String() != "Enroll\\Web" || c.user != user {
+		t.Errorf("the connector was reconfigured by the policy calls: zone %s", c.zone)
+	}
+}
+
+func TestParseCertificateRequestResultStatus(t *testing.T) {
+	cases := []struct {
+		statusCode int
+		body       []byte
+	}{
+		{http.StatusBadRequest, errorRequestCertificate},
+		{http.StatusBadGateway, []byte("<html>Bad Gateway</html>")},
+		{http.StatusInternalServerError, []byte(`{"errors": [{"code": 10000, "message": "Internal error"}]}`)},
+	}
+	for _, c := range cases {
+		_, err := parseCertificateRequestResult(c.statusCode, http.StatusText(c.statusCode), c.body)
+		var statusErr verror.StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != c.statusCode {
+			t.Errorf("expected an error with status %d, got %v", c.statusCode, err)
+		}
+		if !errors.Is(err, verror.ServerError) {
+			t.Errorf("status %d: expected a server error, got %v", c.statusCode, err)
+		}
+	}
+}
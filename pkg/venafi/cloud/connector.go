@@ -19,6 +19,7 @@ package cloud
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/base64"
@@ -32,6 +33,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Venafi/vcert/v4/pkg/certificate"
@@ -70,6 +72,9 @@ const (
 	urlTeams                          urlResource = apiVersion + "teams"
 
 	defaultAppName = "Default"
+
+	// rateLimitMaxWait bounds the time batch operations spend paused on HTTP 429 responses
+	rateLimitMaxWait = 5 * time.Minute
 )
 
 type condorChainOption string
@@ -77,6 +82,7 @@ type condorChainOption string
 const (
 	condorChainOptionRootFirst condorChainOption = "ROOT_FIRST"
 	condorChainOptionRootLast  condorChainOption = "EE_FIRST"
+	condorChainOptionEEOnly    condorChainOption = "EE_ONLY"
 )
 
 // Connector contains the base data needed to communicate with the Venafi Cloud servers
@@ -88,6 +94,9 @@ type Connector struct {
 	trust   *x509.CertPool
 	zone    cloudZone
 	client  *http.Client
+	issuers issuerCache
+	// clientMu guards the lazy creation of client by concurrent calls
+	clientMu sync.Mutex
 }
 
 func (c *Connector) RetrieveCertificateMetaData(dn string) (*certificate.CertificateMetaData, error) {
@@ -219,20 +228,16 @@ func (c *Connector) GetPolicyWithRegex(name string) (*policy.PolicySpecification
 
 func retrievePolicySpecification(c *Connector, name string) (*certificateTemplate, error) {
 	appName := policy.GetApplicationName(name)
-	if appName != "" {
-		c.zone.appName = appName
-	} else {
+	if appName == "" {
 		return nil, fmt.Errorf("application name is not valid, please provide a valid zone name in the format: appName\\CitName")
 	}
 	citName := policy.GetCitName(name)
-	if citName != "" {
-		c.zone.templateAlias = citName
-	} else {
+	if citName == "" {
 		return nil, fmt.Errorf("cit name is not valid, please provide a valid zone name in the format: appName\\CitName")
 	}
 
 	log.Println("Getting CIT")
-	cit, err := c.getTemplateByID()
+	cit, err := c.getTemplate(appName, citName)
 
 	if err != nil {
 		return nil, err
@@ -259,7 +264,7 @@ func (c *Connector) GetPolicy(name string) (*policy.PolicySpecification, error)
 	ps := buildPolicySpecification(cit, info, true)
 
 	// getting the users to set to the PolicySpecification
-	users, error := c.getUsers()
+	users, error := c.getApplicationOwners(policy.GetApplicationName(name))
 	if error != nil {
 		return nil, error
 	}
@@ -268,9 +273,10 @@ func (c *Connector) GetPolicy(name string) (*policy.PolicySpecification, error)
 	return ps, nil
 }
 
-func (c *Connector) getUsers() ([]string, error) {
+// getApplicationOwners returns the names of the users and teams owning the application
+func (c *Connector) getApplicationOwners(appName string) ([]string, error) {
 	var usersList []string
-	appDetails, _, error := c.getAppDetailsByName(c.zone.getApplicationName())
+	appDetails, _, error := c.getAppDetailsByName(appName)
 	if error != nil {
 		return nil, error
 	}
@@ -306,15 +312,12 @@ func (c *Connector) getUsers() ([]string, error) {
 
 func PolicyExist(policyName string, c *Connector) (bool, error) {
 
-	c.zone.appName = policy.GetApplicationName(policyName)
 	citName := policy.GetCitName(policyName)
-	if citName != "" {
-		c.zone.templateAlias = citName
-	} else {
+	if citName == "" {
 		return false, fmt.Errorf("cit name is not valid, please provide a valid zone name in the format: appName\\CitName")
 	}
 
-	_, err := c.getTemplateByID()
+	_, err := c.getTemplate(policy.GetApplicationName(policyName), citName)
 	return err == nil, nil
 }
 
@@ -654,6 +657,28 @@ func (c *Connector) Ping() (err error) {
 	return nil
 }
 
+// PingContext checks that the Venafi Cloud API is reachable. If the connector holds an API key, the key is
+// validated against the user account endpoint as well.
+func (c *Connector) PingContext(ctx context.Context) (err error) {
+	url := c.getURL(urlResourceUserAccounts)
+	statusCode, status, _, err := c.requestContext(ctx, "GET", url, nil, true)
+	if err != nil {
+		return err
+	}
+	if c.apiKey == "" {
+		// any answer from the server is good enough when there is nothing to authenticate
+		return nil
+	}
+	switch statusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %s", verror.AuthError, status)
+	default:
+		return verror.NewStatusError(statusCode, fmt.Errorf("%w: %s", verror.ServerError, status))
+	}
+}
+
 // Authenticate authenticates the user with Venafi Cloud using the provided API Key
 func (c *Connector) Authenticate(auth *endpoint.Authentication) (err error) {
 	if auth == nil {
@@ -708,7 +733,7 @@ func (c *Connector) ReadZoneConfiguration() (config *endpoint.ZoneConfiguration,
 		}
 	}
 	if template == nil {
-		template, err = c.getTemplateByID()
+		template, err = c.getTemplate(c.zone.getApplicationName(), citAlias)
 		if err != nil {
 			return
 		}
@@ -830,10 +855,10 @@ func (c *Connector) getCertificateStatus(requestID string) (certStatus *certific
 		for _, e := range respErrors {
 			respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 		}
-		return nil, fmt.Errorf(respError)
+		return nil, verror.NewStatusError(statusCode, fmt.Errorf(respError))
 	}
 
-	return nil, fmt.Errorf("unexpected status code on Venafi Cloud certificate search. Status: %d", statusCode)
+	return nil, verror.NewStatusError(statusCode, fmt.Errorf("unexpected status code on Venafi Cloud certificate search. Status: %d", statusCode))
 
 }
 
@@ -915,15 +940,20 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (certificates
 	url = fmt.Sprintf(url, certificateId)
 
 	var dekInfo *EdgeEncryptionKey
+	var details *managedCertificate
 	var currentId string
 	if req.CertID != "" {
-		dekInfo, err = getDekInfo(c, req.CertID)
 		currentId = req.CertID
-	} else if certificateId != "" {
-		dekInfo, err = getDekInfo(c, certificateId)
+	} else {
 		currentId = certificateId
 	}
-	if err == nil && dekInfo.Key != "" {
+	if currentId != "" {
+		details, err = getCertificateDetails(c, currentId)
+		if err == nil {
+			dekInfo, err = getDekInfoByHash(c, details.DekHash)
+		}
+	}
+	if err == nil && dekInfo != nil && dekInfo.Key != "" {
 		req.CertID = currentId
 		return retrieveServiceGeneratedCertData(c, req, dekInfo)
 	}
@@ -935,10 +965,13 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (certificates
 			return nil, err
 		}
 		if statusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to retrieve certificate. StatusCode: %d -- Status: %s -- Server Data: %s", statusCode, status, body)
+			return nil, verror.NewStatusError(statusCode, fmt.Errorf("failed to retrieve certificate. StatusCode: %d -- Status: %s -- Server Data: %s", statusCode, status, body))
 		}
 		return newPEMCollectionFromResponse(body, certificate.ChainOptionIgnore)
 	case req.PickupID != "":
+		if details != nil && len(details.IssuerCertificateIds) > 0 && req.ChainOption != certificate.ChainOptionIgnore {
+			return c.retrieveCertificateAndChain(url, details.IssuerCertificateIds, req)
+		}
 		url += "?chainOrder=%s&format=PEM"
 		switch req.ChainOption {
 		case certificate.ChainOptionRootFirst:
@@ -955,12 +988,16 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (certificates
 			if err != nil {
 				return nil, err
 			}
+			if err = req.SelectChain(certificates); err != nil {
+				return nil, err
+			}
 			err = req.CheckCertificate(certificates.Certificate)
+			req.CheckChain(certificates)
 			return certificates, err
 		} else if statusCode == http.StatusConflict { // Http Status Code 409 means the certificate has not been signed by the ca yet.
 			return nil, endpoint.ErrCertificatePending{CertificateID: req.PickupID}
 		} else {
-			return nil, fmt.Errorf("failed to retrieve certificate. StatusCode: %d -- Status: %s", statusCode, status)
+			return nil, verror.NewStatusError(statusCode, fmt.Errorf("failed to retrieve certificate. StatusCode: %d -- Status: %s", statusCode, status))
 		}
 	}
 	return nil, fmt.Errorf("couldn't retrieve certificate because both PickupID and CertId are empty")
@@ -1003,7 +1040,7 @@ func retrieveServiceGeneratedCertData(c *Connector, req *certificate.Request, de
 	}
 
 	if statusCode != http.StatusOK && statusCode != http.StatusCreated {
-		return nil, fmt.Errorf("failed to retrieve KeyStore on VaaS, status: %s", status)
+		return nil, verror.NewStatusError(statusCode, fmt.Errorf("failed to retrieve KeyStore on VaaS, status: %s", status))
 	}
 
 	rootFirst := false
@@ -1016,26 +1053,30 @@ func retrieveServiceGeneratedCertData(c *Connector, req *certificate.Request, de
 }
 
 func getDekInfo(c *Connector, cerId string) (*EdgeEncryptionKey, error) {
-	//get certificate details for getting DekHash
-	url := c.getURL(urlResourceCertificateByID)
-	url = fmt.Sprintf(url, cerId)
-
-	statusCode, status, body, err := c.request("GET", url, nil)
+	managedCert, err := getCertificateDetails(c, cerId)
 	if err != nil {
 		return nil, err
 	}
+	return getDekInfoByHash(c, managedCert.DekHash)
+}
 
-	managedCert, err := parseCertificateInfo(statusCode, status, body)
+func getCertificateDetails(c *Connector, cerId string) (*managedCertificate, error) {
+	url := c.getURL(urlResourceCertificateByID)
+	url = fmt.Sprintf(url, cerId)
 
+	statusCode, status, body, err := c.request("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
+	return parseCertificateInfo(statusCode, status, body)
+}
 
+func getDekInfoByHash(c *Connector, dekHash string) (*EdgeEncryptionKey, error) {
 	//get Dek info for getting DEK's key
-	url = c.getURL(urlDekPublicKey)
-	url = fmt.Sprintf(url, managedCert.DekHash)
+	url := c.getURL(urlDekPublicKey)
+	url = fmt.Sprintf(url, dekHash)
 
-	statusCode, status, body, err = c.request("GET", url, nil)
+	statusCode, status, body, err := c.request("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1140,6 +1181,11 @@ func (c *Connector) waitForCertificate(url string, request *certificate.Request)
 	}
 }
 
+// CancelRequest attempts to cancel the certificate request
+func (c *Connector) CancelRequest(pickupID string) error {
+	return fmt.Errorf("not supported by endpoint")
+}
+
 // RevokeCertificate attempts to revoke the certificate
 func (c *Connector) RevokeCertificate(revReq *certificate.RevocationRequest) (err error) {
 	return fmt.Errorf("not supported by endpoint")
@@ -1311,10 +1357,11 @@ func (c *Connector) searchCertificatesByFingerprint(fp string) (*CertificateSear
 
 */
 type managedCertificate struct {
-	Id                   string `json:"id"`
-	CompanyId            string `json:"companyId"`
-	CertificateRequestId string `json:"certificateRequestId"`
-	DekHash              string `json:"dekHash,omitempty"`
+	Id                   string   `json:"id"`
+	CompanyId            string   `json:"companyId"`
+	CertificateRequestId string   `json:"certificateRequestId"`
+	DekHash              string   `json:"dekHash,omitempty"`
+	IssuerCertificateIds []string `json:"issuerCertificateIds,omitempty"`
 }
 
 func (c *Connector) getCertificate(certificateId string) (*managedCertificate, error) {
@@ -1342,10 +1389,10 @@ func (c *Connector) getCertificate(certificateId string) (*managedCertificate, e
 				for _, e := range respErrors {
 					respError += fmt.Sprintf("Error Code: %d Error: %s\n", e.Code, e.Message)
 				}
-				return nil, fmt.Errorf(respError)
+				return nil, verror.NewStatusError(statusCode, fmt.Errorf(respError))
 			}
 		}
-		return nil, fmt.Errorf("unexpected status code on Venafi Cloud certificate search. Status: %d", statusCode)
+		return nil, verror.NewStatusError(statusCode, fmt.Errorf("unexpected status code on Venafi Cloud certificate search. Status: %d", statusCode))
 	}
 }
 
@@ -1419,6 +1466,8 @@ func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certific
 }
 
 func (c *Connector) SetHTTPClient(client *http.Client) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
 	c.client = client
 }
 
@@ -1435,7 +1484,10 @@ func (c *Connector) ListCertificates(filter endpoint.Filter) ([]certificate.Cert
 	for page := 0; limit > 0; limit, page = limit-batchSize, page+1 {
 		var b []certificate.CertificateInfo
 		var err error
-		b, err = c.getCertsBatch(page, batchSize, filter.WithExpired)
+		err = endpoint.RetryOnRateLimit(context.Background(), rateLimitMaxWait, func() error {
+			b, err = c.getCertsBatch(page, batchSize, filter)
+			return err
+		})
 		if limit < batchSize && len(b) > limit {
 			b = b[:limit]
 		}
@@ -1460,7 +1512,19 @@ func (c *Connector) ListCertificates(filter endpoint.Filter) ([]certificate.Cert
 	return infos, nil
 }
 
-func (c *Connector) getCertsBatch(page, pageSize int, withExpired bool) ([]certificate.CertificateInfo, error) {
+// ListCertificatesPage implements endpoint.CertificatePager
+func (c *Connector) ListCertificatesPage(filter endpoint.Filter, page, pageSize int) (infos []certificate.CertificateInfo, err error) {
+	if c.zone.String() == "" {
+		return nil, fmt.Errorf("empty zone")
+	}
+	err = endpoint.RetryOnRateLimit(context.Background(), rateLimitMaxWait, func() error {
+		infos, err = c.getCertsBatch(page, pageSize, filter)
+		return err
+	})
+	return infos, err
+}
+
+func (c *Connector) getCertsBatch(page, pageSize int, filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
 
 	appDetails, _, err := c.getAppDetailsByName(c.zone.getApplicationName())
 	if err != nil {
@@ -1476,13 +1540,16 @@ func (c *Connector) getCertsBatch(page, pageSize int, withExpired bool) ([]certi
 		},
 		Paging: &Paging{PageSize: pageSize, PageNumber: page},
 	}
-	if !withExpired {
+	if !filter.WithExpired {
 		req.Expression.Operands = append(req.Expression.Operands, Operand{
 			"validityEnd",
 			GTE,
 			time.Now().Format(time.RFC3339),
 		})
 	}
+	if filter.CommonName != "" {
+		req.Expression.Operands = append(req.Expression.Operands, Operand{"subjectCN", EQ, filter.CommonName})
+	}
 	r, err := c.searchCertificates(req)
 	if err != nil {
 		return nil, err
@@ -1528,10 +1595,10 @@ func (c *Connector) GetZonesByParent(parent string) ([]string, error) {
 	return zones, nil
 }
 
-func (c *Connector) getTemplateByID() (*certificateTemplate, error) {
+func (c *Connector) getTemplate(appName, citAlias string) (*certificateTemplate, error) {
 	url := c.getURL(urlResourceTemplate)
-	appNameEncoded := netUrl.PathEscape(c.zone.getApplicationName())
-	citAliasEncoded := netUrl.PathEscape(c.zone.getTemplateAlias())
+	appNameEncoded := netUrl.PathEscape(appName)
+	citAliasEncoded := netUrl.PathEscape(citAlias)
 	url = fmt.Sprintf(url, appNameEncoded, citAliasEncoded)
 	statusCode, status, body, err := c.request("GET", url, nil)
 	if err != nil {
@@ -1616,7 +1683,6 @@ func getUserDetails(c *Connector) (*userDetails, error) {
 	if err != nil {
 		return nil, err
 	}
-	c.user = ud
 	return ud, nil
 }
 
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloud
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Venafi/vcert/v4/pkg/policy"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// GetCertificateContacts isn't supported, in Venafi as a Service a certificate is owned by its application
+func (c *Connector) GetCertificateContacts(certificateID string) ([]string, error) {
+	return nil, fmt.Errorf("%w: certificates are owned by their application, get the contacts of the zone instead", verror.VcertError)
+}
+
+// SetCertificateContacts isn't supported, in Venafi as a Service a certificate is owned by its application
+func (c *Connector) SetCertificateContacts(certificateID string, contacts []string) error {
+	return fmt.Errorf("%w: certificates are owned by their application, set the contacts of the zone instead", verror.VcertError)
+}
+
+// GetZoneContacts returns the names of the users and teams owning the application of zone
+func (c *Connector) GetZoneContacts(zone string) ([]string, error) {
+	return c.getApplicationOwners(policy.GetApplicationName(zone))
+}
+
+// SetZoneContacts replaces the users and teams owning the application of zone. An application needs an owner.
+func (c *Connector) SetZoneContacts(zone string, contacts []string) error {
+	if len(contacts) == 0 {
+		return fmt.Errorf("%w: an application needs at least one owner", verror.UserDataError)
+	}
+	appName := policy.GetApplicationName(zone)
+	appDetails, _, err := c.getAppDetailsByName(appName)
+	if err != nil {
+		return err
+	}
+	owners, err := c.resolveOwners(contacts)
+	if err != nil {
+		return fmt.Errorf("%w: failed to resolve the owners: %s", verror.UserDataError, err)
+	}
+	appReq := createAppUpdateRequest(appDetails)
+	appReq.OwnerIdsAndTypes = owners
+	url := c.getURL(urlAppRoot)
+	url = fmt.Sprint(url, "/", appDetails.ApplicationId)
+	statusCode, status, _, err := c.request("PUT", url, appReq)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return verror.NewStatusError(statusCode, fmt.Errorf("%w: unexpected result %s attempting to update application %s", verror.ServerError, status, appName))
+	}
+	return nil
+}
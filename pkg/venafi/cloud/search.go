@@ -79,6 +79,13 @@ type Certificate struct {
 	Fingerprint                   string              `json:"fingerprint"`
 	ValidityStart                 string              `json:"validityStart"`
 	ValidityEnd                   string              `json:"validityEnd"`
+	IssuerCN                      []string            `json:"issuerCN"`
+	EncryptionType                string              `json:"encryptionType"`
+	KeyStrength                   int                 `json:"keyStrength"`
+	CustomFields                  []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"customFields"`
 	/* ... and many more fields ... */
 }
 
@@ -110,10 +117,21 @@ func (c Certificate) ToCertificateInfo() certificate.CertificateInfo {
 			c.SubjectAlternativeNamesByType["uniformResourceIdentifier"],
 			[]string{}, // todo: find correct field
 		},
-		Serial:     c.SerialNumber,
-		Thumbprint: c.Fingerprint,
-		ValidFrom:  start,
-		ValidTo:    end,
+		Serial:       c.SerialNumber,
+		Thumbprint:   c.Fingerprint,
+		ValidFrom:    start,
+		ValidTo:      end,
+		KeyAlgorithm: c.EncryptionType,
+		KeySize:      c.KeyStrength,
+	}
+	if len(c.IssuerCN) > 0 {
+		ci.Issuer = c.IssuerCN[0]
+	}
+	for _, f := range c.CustomFields {
+		if ci.CustomFields == nil {
+			ci.CustomFields = make(map[string][]string)
+		}
+		ci.CustomFields[f.Name] = append(ci.CustomFields[f.Name], f.Value)
 	}
 	return ci
 }
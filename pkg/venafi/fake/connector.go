@@ -17,6 +17,7 @@
 package fake
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/x509"
@@ -153,6 +154,10 @@ func (c *Connector) Ping() (err error) {
 	return
 }
 
+func (c *Connector) PingContext(ctx context.Context) (err error) {
+	return ctx.Err()
+}
+
 func (c *Connector) Authenticate(auth *endpoint.Authentication) (err error) {
 	return
 }
@@ -317,10 +322,28 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (pcc *certific
 			return
 		}
 	}
+	if err = req.SelectChain(pcc); err != nil {
+		return nil, err
+	}
 	err = req.CheckCertificate(pcc.Certificate)
+	req.CheckChain(pcc)
 	return
 }
 
+// RetrieveRenewalInfo suggests to renew in the last third of the certificate lifetime, like ACME clients usually do
+func (c *Connector) RetrieveRenewalInfo(cert *x509.Certificate) (*endpoint.RenewalInfo, error) {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return &endpoint.RenewalInfo{
+		SuggestedWindowStart: cert.NotBefore.Add(lifetime * 2 / 3),
+		SuggestedWindowEnd:   cert.NotBefore.Add(lifetime * 5 / 6),
+	}, nil
+}
+
+// CancelRequest has nothing to cancel, the certificates are issued as soon as they're requested
+func (c *Connector) CancelRequest(pickupID string) error {
+	return nil
+}
+
 // RevokeCertificate attempts to revoke the certificate
 func (c *Connector) RevokeCertificate(revReq *certificate.RevocationRequest) (err error) {
 	return fmt.Errorf("revocation is not supported in -test-mode")
@@ -24,6 +24,10 @@ import (
 
 //GenerateRequest creates a new certificate request, based on the zone/policy configuration and the user data
 func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+	err = req.NormalizeIDN()
+	if err != nil {
+		return err
+	}
 
 	switch req.CsrOrigin {
 	case certificate.LocalGeneratedCSR:
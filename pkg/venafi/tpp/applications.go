@@ -0,0 +1,69 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"fmt"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// GetCertificateApplications returns the DNs of the applications associated with the certificate with DN certificateID
+func (c *Connector) GetCertificateApplications(certificateID string) ([]string, error) {
+	certDN := getPolicyDN(certificateID)
+	guid, err := c.configDNToGuid(certDN)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve certificate guid: %s", err)
+	}
+	if guid == "" {
+		return nil, fmt.Errorf("%w: certificate %s doesn't exist", verror.UserDataError, certDN)
+	}
+	details, err := c.searchCertificateDetails(guid)
+	if err != nil {
+		return nil, err
+	}
+	if details.Consumers == nil {
+		return []string{}, nil
+	}
+	return details.Consumers, nil
+}
+
+// AssociateApplications associates the applications with the certificate with DN certificateID. The applications
+// must already exist, when push is set the certificate is pushed to the applications it wasn't installed on yet.
+func (c *Connector) AssociateApplications(certificateID string, applications []string, push bool) error {
+	if len(applications) == 0 {
+		return fmt.Errorf("%w: no applications to associate", verror.UserDataError)
+	}
+	return c.associate(getPolicyDN(certificateID), applicationDNs(applications), push)
+}
+
+// DissociateApplications removes the association of the applications with the certificate with DN certificateID,
+// the application objects are kept
+func (c *Connector) DissociateApplications(certificateID string, applications []string) error {
+	if len(applications) == 0 {
+		return fmt.Errorf("%w: no applications to dissociate", verror.UserDataError)
+	}
+	return c.dissociate(getPolicyDN(certificateID), applicationDNs(applications), false)
+}
+
+func applicationDNs(applications []string) []string {
+	dns := make([]string, len(applications))
+	for i, application := range applications {
+		dns[i] = getPolicyDN(application)
+	}
+	return dns
+}
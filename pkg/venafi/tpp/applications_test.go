@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCertificateApplications(t *testing.T) {
+	const certDN = "\\VED\\Policy\\Web\\www.example.com"
+	consumers := []string{"\\VED\\Policy\\Web\\web01\\nginx"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ObjectDN      string
+			CertificateDN string
+			ApplicationDN []string
+			PushToNew     bool
+			DeleteOrphans bool
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		path := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/"))
+		switch {
+		case path == strings.ToLower(string(urlResourceConfigDnToGuid)):
+			if req.ObjectDN != certDN {
+				t.Errorf("unexpected object %s", req.ObjectDN)
+			}
+			_, _ = w.Write([]byte(`{"GUID":"{1234}","Result":1}`))
+		case path == string(urlResourceCertificate)+"{1234}":
+			_ = json.NewEncoder(w).Encode(CertificateDetailsResponse{Consumers: consumers})
+		case path == string(urlResourceCertificatesAssociate):
+			if req.CertificateDN != certDN || !req.PushToNew {
+				t.Errorf("unexpected associate request %+v", req)
+			}
+			consumers = append(consumers, req.ApplicationDN...)
+			_, _ = w.Write([]byte(`{"Success":true}`))
+		case path == string(urlResourceCertificatesDissociate):
+			if req.DeleteOrphans {
+				t.Errorf("the applications must not be deleted")
+			}
+			consumers = consumers[:0]
+			_, _ = w.Write([]byte(`{"Success":true}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	c := &Connector{baseURL: server.URL + "/", accessToken: "token", client: server.Client()}
+
+	err := c.AssociateApplications("Web\\www.example.com", []string{"Web\\web02\\nginx"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applications, err := c.GetCertificateApplications("Web\\www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"\\VED\\Policy\\Web\\web01\\nginx", "\\VED\\Policy\\Web\\web02\\nginx"}
+	if !reflect.DeepEqual(applications, expected) {
+		t.Fatalf("expected %v, got %v", expected, applications)
+	}
+
+	err = c.DissociateApplications(certDN, applications)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applications, err = c.GetCertificateApplications(certDN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applications) != 0 {
+		t.Fatalf("expected no applications, got %v", applications)
+	}
+
+	if err = c.AssociateApplications(certDN, nil, false); err == nil {
+		t.Fatal("expected an error without applications")
+	}
+}
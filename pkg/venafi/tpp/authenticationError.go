@@ -19,6 +19,8 @@ package tpp
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
 )
 
 type authenticationError struct {
@@ -41,3 +43,7 @@ func NewAuthenticationError(b []byte) error {
 func (e *authenticationError) Error() string {
 	return fmt.Sprintf("Authentication error. Error ID: %s Description: %s", e.ErrorId, e.ErrorDescription)
 }
+
+func (e *authenticationError) Code() string {
+	return verror.CodeAuth
+}
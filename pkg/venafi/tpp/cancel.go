@@ -0,0 +1,56 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// CancelRequest resets the processing of the certificate with DN pickupID, so a request waiting for an approval or
+// stuck in error stops. The certificate object is kept with the certificate it last issued.
+func (c *Connector) CancelRequest(pickupID string) error {
+	req := struct {
+		CertificateDN string
+		Restart       bool
+	}{
+		getPolicyDN(pickupID),
+		false,
+	}
+	statusCode, status, body, err := c.request("POST", urlResourceCertificateReset, req)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		ProcessingResetCompleted bool
+		Error                    string
+	}
+	_ = json.Unmarshal(body, &resp)
+	if statusCode != http.StatusOK {
+		if resp.Error != "" {
+			return verror.NewStatusError(statusCode, fmt.Errorf("%w: failed to cancel the request of %s: %s", verror.ServerError, req.CertificateDN, resp.Error))
+		}
+		return verror.NewStatusError(statusCode, fmt.Errorf("%w: unexpected status code on TPP certificate reset. Status: %s", verror.ServerError, status))
+	}
+	if !resp.ProcessingResetCompleted {
+		return fmt.Errorf("%w: the request of %s wasn't cancelled: %s", verror.ServerError, req.CertificateDN, resp.Error)
+	}
+	return nil
+}
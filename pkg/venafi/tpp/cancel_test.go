@@ -0,0 +1,58 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func TestCancelRequest(t *testing.T) {
+	const certDN = "\\VED\\Policy\\Web\\www.example.com"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			CertificateDN string
+			Restart       bool
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if strings.TrimPrefix(r.URL.Path, "/") != string(urlResourceCertificateReset) || req.Restart {
+			t.Errorf("unexpected request %+v to %s", req, r.URL.Path)
+		}
+		if req.CertificateDN != certDN {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"Error":"Certificate does not exist"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ProcessingResetCompleted":true,"RestartCompleted":false}`))
+	}))
+	defer server.Close()
+	c := &Connector{baseURL: server.URL + "/", accessToken: "token", client: server.Client()}
+
+	if err := c.CancelRequest(certDN); err != nil {
+		t.Fatal(err)
+	}
+	err := c.CancelRequest("Web\\api.example.com")
+	if !errors.Is(err, verror.ServerError) || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected a server error, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+)
+
+// enrollmentServer issues the certificates of the CSRs posted to it like TPP, counting the connections it accepts
+type enrollmentServer struct {
+	*httptest.Server
+	ca          *x509.Certificate
+	caKey       *ecdsa.PrivateKey
+	serial      int64
+	connections int64
+	issued      sync.Map
+}
+
+func newEnrollmentServer(t testing.TB) *enrollmentServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Bench CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &enrollmentServer{caKey: key, serial: 1}
+	s.ca, _ = x509.ParseCertificate(der)
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&s.connections, 1)
+		}
+	}
+	s.Start()
+	return s
+}
+
+func (s *enrollmentServer) serve(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/") {
+	case string(urlResourceCertificateRequest):
+		var req certificateRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		b, _ := pem.Decode([]byte(req.PKCS10))
+		if b == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(b.Bytes)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		serial := atomic.AddInt64(&s.serial, 1)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      csr.Subject,
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, s.ca, csr.PublicKey, s.caKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		dn := fmt.Sprintf("%s\\%d", req.PolicyDN, serial)
+		s.issued.Store(dn, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+		_ = json.NewEncoder(w).Encode(certificateRequestResponse{CertificateDN: dn})
+	case string(urlResourceCertificateRetrieve):
+		var req certificateRetrieveRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		cert, ok := s.issued.Load(req.CertificateDN)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(certificateRetrieveResponse{CertificateData: base64.StdEncoding.EncodeToString(cert.([]byte))})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// enrollmentCSR returns a CSR, the benchmarks measure the connector rather than the key generation
+func enrollmentCSR(t testing.TB) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"www.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func enroll(c *Connector, csr []byte) error {
+	req := &certificate.Request{CsrOrigin: certificate.UserProvidedCSR}
+	if err := req.SetCSR(csr); err != nil {
+		return err
+	}
+	_, err := c.RequestCertificate(req)
+	if err != nil {
+		return err
+	}
+	pcc, err := c.RetrieveCertificate(req)
+	if err != nil {
+		return err
+	}
+	if pcc == nil || pcc.Certificate == "" {
+		return fmt.Errorf("no certificate retrieved for %s", req.PickupID)
+	}
+	return nil
+}
+
+// newEnrollmentConnector returns a connector using its own pooled client, the one of the server wouldn't show the
+// connections it reuses
+func newEnrollmentConnector(s *enrollmentServer) *Connector {
+	return &Connector{baseURL: s.URL + "/", accessToken: "token", zone: "Bench"}
+}
+
+func TestConnectorConcurrentEnrollments(t *testing.T) {
+	s := newEnrollmentServer(t)
+	defer s.Close()
+	c := newEnrollmentConnector(s)
+	csr := enrollmentCSR(t)
+
+	const workers, enrollments = 20, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*enrollments)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < enrollments; j++ {
+				if err := enroll(c, csr); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	// every enrollment makes two calls, the pooled connections are reused by them
+	if n := atomic.LoadInt64(&s.connections); n > workers {
+		t.Fatalf("%d connections opened for %d concurrent workers, the connections aren't reused", n, workers)
+	}
+}
+
+// BenchmarkConcurrentEnrollments runs b.N enrollments with a single connector shared by an increasing number of
+// goroutines, e.g. go test -run NONE -bench ConcurrentEnrollments ./pkg/venafi/tpp
+func BenchmarkConcurrentEnrollments(b *testing.B) {
+	s := newEnrollmentServer(b)
+	defer s.Close()
+	csr := enrollmentCSR(b)
+
+	for _, workers := range []int{1, 10, 100, 500} {
+		b.Run(fmt.Sprintf("goroutines=%d", workers), func(b *testing.B) {
+			c := newEnrollmentConnector(s)
+			var next int64
+			var wg sync.WaitGroup
+			b.ResetTimer()
+			for i := 0; i < workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for atomic.AddInt64(&next, 1) <= int64(b.N) {
+						if err := enroll(c, csr); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -17,16 +17,19 @@
 package tpp
 
 import (
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	neturl "net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Venafi/vcert/v4/pkg/policy"
@@ -47,6 +50,8 @@ type Connector struct {
 	trust       *x509.CertPool
 	zone        string
 	client      *http.Client
+	// clientMu guards the lazy creation of client by concurrent calls
+	clientMu sync.Mutex
 }
 
 func (c *Connector) IsCSRServiceGenerated(req *certificate.Request) (bool, error) {
@@ -117,6 +122,27 @@ func (c *Connector) Ping() (err error) {
 	return
 }
 
+// PingContext checks that the TPP Server WebSDK API is reachable. If the connector holds an access token the token is
+// verified as well, so an error means the connector can't be used for further requests.
+func (c *Connector) PingContext(ctx context.Context) (err error) {
+	resource := urlResource("vedsdk/")
+	if c.accessToken != "" {
+		resource = urlResourceAuthorizeVerify
+	}
+	statusCode, status, _, err := c.requestContext(ctx, "GET", resource, nil)
+	if err != nil {
+		return
+	}
+	switch statusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %s", verror.AuthError, status)
+	default:
+		return fmt.Errorf("%w: %s", verror.ServerError, status)
+	}
+}
+
 // Authenticate authenticates the user to the TPP
 func (c *Connector) Authenticate(auth *endpoint.Authentication) (err error) {
 	defer func() {
@@ -324,7 +350,7 @@ func processAuthData(c *Connector, url urlResource, data interface{}) (resp inte
 			return resp, fmt.Errorf("can not determine data type")
 		}
 	} else {
-		return resp, fmt.Errorf("unexpected status code on TPP Authorize. Status: %s", status)
+		return resp, verror.NewStatusError(statusCode, fmt.Errorf("unexpected status code on TPP Authorize. Status: %s", status))
 	}
 
 	return resp, nil
@@ -565,6 +591,13 @@ func prepareRequest(req *certificate.Request, zone string) (tppReq certificateRe
 			dev.Applications[0].ValidationHost = host
 			dev.Applications[0].ValidationPort = port
 		}
+		if req.Location.IPAddress != "" {
+			if net.ParseIP(req.Location.IPAddress) == nil {
+				return tppReq, fmt.Errorf("%w: invalid IP address %s for Location", verror.UserDataError, req.Location.IPAddress)
+			}
+			dev.Host = req.Location.IPAddress
+		}
+		dev.Applications[0].Description = req.Location.InstallPath
 		tppReq.Devices = append(tppReq.Devices, dev)
 	}
 	switch req.KeyType {
@@ -619,7 +652,7 @@ func (c *Connector) proccessLocation(req *certificate.Request) error {
 		}
 		if device == requestedDevice {
 			if req.Location.Replace {
-				err = c.dissociate(certDN, device)
+				err = c.dissociate(certDN, []string{device}, true)
 				if err != nil {
 					return err
 				}
@@ -768,27 +801,27 @@ func (c *Connector) retrieveUserNamesForPolicySpecification(policyName string) (
 	if error != nil {
 		return nil, error
 	}
-	if values != nil {
-		var users []string
-		for _, prefixedUniversal := range values {
-			validateIdentityRequest := policy.ValidateIdentityRequest{
-				ID: policy.IdentityInformation{
-					PrefixedUniversal: prefixedUniversal,
-				},
-			}
+	return c.identityNames(values)
+}
 
-			validateIdentityResponse, error := c.validateIdentity(validateIdentityRequest)
-			if error != nil {
-				return nil, error
-			}
+// identityNames returns the names of the identities referenced by their prefixed universal
+func (c *Connector) identityNames(prefixedUniversals []string) ([]string, error) {
+	var users []string
+	for _, prefixedUniversal := range prefixedUniversals {
+		validateIdentityRequest := policy.ValidateIdentityRequest{
+			ID: policy.IdentityInformation{
+				PrefixedUniversal: prefixedUniversal,
+			},
+		}
 
-			users = append(users, validateIdentityResponse.ID.Name)
+		validateIdentityResponse, error := c.validateIdentity(validateIdentityRequest)
+		if error != nil {
+			return nil, error
 		}
 
-		return users, nil
+		users = append(users, validateIdentityResponse.ID.Name)
 	}
-
-	return nil, nil
+	return users, nil
 }
 
 func (c *Connector) validateIdentity(validateIdentityRequest policy.ValidateIdentityRequest) (*policy.ValidateIdentityResponse, error) {
@@ -1186,6 +1219,10 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (certificates
 
 	startTime := time.Now()
 	for {
+		if req.Timeout > 0 {
+			certReq.WorkToDoTimeout = workToDoTimeout(time.Until(startTime.Add(req.Timeout)))
+		}
+		callTime := time.Now()
 		var retrieveResponse *certificateRetrieveResponse
 		retrieveResponse, err = c.retrieveCertificateOnce(certReq)
 		if err != nil {
@@ -1196,7 +1233,11 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (certificates
 			if err != nil {
 				return
 			}
+			if err = req.SelectChain(certificates); err != nil {
+				return nil, err
+			}
 			err = req.CheckCertificate(certificates.Certificate)
+			req.CheckChain(certificates)
 			return
 		}
 		if req.Timeout == 0 {
@@ -1205,10 +1246,31 @@ func (c *Connector) RetrieveCertificate(req *certificate.Request) (certificates
 		if time.Now().After(startTime.Add(req.Timeout)) {
 			return nil, endpoint.ErrRetrieveCertificateTimeout{CertificateID: req.PickupID}
 		}
-		time.Sleep(2 * time.Second)
+		// no need to wait when TPP already held the request until the timeout
+		if wait := retrievePollInterval - time.Since(callTime); wait > 0 {
+			time.Sleep(wait)
+		}
 	}
 }
 
+const (
+	retrievePollInterval = 2 * time.Second
+	// maxWorkToDoTimeout keeps the long-poll of the certificate retrieval below the timeout of the HTTP client
+	maxWorkToDoTimeout = 20 * time.Second
+)
+
+// workToDoTimeout returns how many seconds TPP waits for the certificate to be issued before answering the
+// retrieval, so it's long-polled instead of polled. Servers not supporting it answer right away.
+func workToDoTimeout(remaining time.Duration) int {
+	if remaining > maxWorkToDoTimeout {
+		remaining = maxWorkToDoTimeout
+	}
+	if remaining < time.Second {
+		return 0
+	}
+	return int(remaining / time.Second)
+}
+
 func (c *Connector) retrieveCertificateOnce(certReq certificateRetrieveRequest) (*certificateRetrieveResponse, error) {
 	statusCode, status, body, err := c.request("POST", urlResourceCertificateRetrieve, certReq)
 	if err != nil {
@@ -1231,7 +1293,7 @@ func (c *Connector) putCertificateInfo(dn string, attributes []nameSliceValuePai
 		return err
 	}
 	if statusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %v", statusCode)
+		return verror.NewStatusError(statusCode, fmt.Errorf("unexpected status code: %v", statusCode))
 	}
 	return nil
 }
@@ -1469,7 +1531,7 @@ func (c *Connector) ImportCertificate(req *certificate.ImportRequest) (*certific
 		}
 		return nil, fmt.Errorf("%w: can't import certificate %s", verror.ServerBadDataResponce, errorResponse.Error)
 	default:
-		return nil, fmt.Errorf("%w: unexpected response status %d: %s", verror.ServerTemporaryUnavailableError, statusCode, string(body))
+		return nil, verror.NewStatusError(statusCode, fmt.Errorf("%w: unexpected response status %d: %s", verror.ServerTemporaryUnavailableError, statusCode, string(body)))
 	}
 }
 
@@ -1490,6 +1552,8 @@ func (c *Connector) SearchCertificates(req *certificate.SearchRequest) (*certifi
 }
 
 func (c *Connector) SetHTTPClient(client *http.Client) {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
 	c.client = client
 }
 
@@ -1512,7 +1576,7 @@ func (c *Connector) ListCertificates(filter endpoint.Filter) ([]certificate.Cert
 	for offset := 0; limit > 0; limit, offset = limit-batchSize, offset+batchSize {
 		var b []certificate.CertificateInfo
 		var err error
-		b, err = c.getCertsBatch(offset, min(limit, batchSize), filter.WithExpired)
+		b, err = c.getCertsBatch(offset, min(limit, batchSize), filter)
 		if err != nil {
 			return nil, err
 		}
@@ -1534,14 +1598,25 @@ func (c *Connector) ListCertificates(filter endpoint.Filter) ([]certificate.Cert
 	return infos, nil
 }
 
-func (c *Connector) getCertsBatch(offset, limit int, withExpired bool) ([]certificate.CertificateInfo, error) {
+// ListCertificatesPage implements endpoint.CertificatePager
+func (c *Connector) ListCertificatesPage(filter endpoint.Filter, page, pageSize int) ([]certificate.CertificateInfo, error) {
+	if c.zone == "" {
+		return nil, fmt.Errorf("empty zone")
+	}
+	return c.getCertsBatch(page*pageSize, pageSize, filter)
+}
+
+func (c *Connector) getCertsBatch(offset, limit int, filter endpoint.Filter) ([]certificate.CertificateInfo, error) {
 	url := urlResourceCertificatesList + urlResource(
 		"?ParentDNRecursive="+neturl.QueryEscape(getPolicyDN(c.zone))+
 			"&limit="+fmt.Sprintf("%d", limit)+
 			"&offset="+fmt.Sprintf("%d", offset))
-	if !withExpired {
+	if !filter.WithExpired {
 		url += urlResource("&ValidToGreater=" + neturl.QueryEscape(time.Now().Format(time.RFC3339)))
 	}
+	if filter.CommonName != "" {
+		url += urlResource("&CN=" + neturl.QueryEscape(filter.CommonName))
+	}
 	statusCode, status, body, err := c.request("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -1578,17 +1653,17 @@ func parseHostPort(s string) (host string, port string, err error) {
 	return
 }
 
-func (c *Connector) dissociate(certDN, applicationDN string) error {
+func (c *Connector) dissociate(certDN string, applicationDNs []string, deleteOrphans bool) error {
 	req := struct {
 		CertificateDN string
 		ApplicationDN []string
 		DeleteOrphans bool
 	}{
 		certDN,
-		[]string{applicationDN},
-		true,
+		applicationDNs,
+		deleteOrphans,
 	}
-	log.Println("Dissociating device", applicationDN)
+	log.Println("Dissociating device", strings.Join(applicationDNs, ", "))
 	statusCode, status, body, err := c.request("POST", urlResourceCertificatesDissociate, req)
 	if err != nil {
 		return err
@@ -1599,17 +1674,17 @@ func (c *Connector) dissociate(certDN, applicationDN string) error {
 	return nil
 }
 
-func (c *Connector) associate(certDN, applicationDN string, pushToNew bool) error {
+func (c *Connector) associate(certDN string, applicationDNs []string, pushToNew bool) error {
 	req := struct {
 		CertificateDN string
 		ApplicationDN []string
 		PushToNew     bool
 	}{
 		certDN,
-		[]string{applicationDN},
+		applicationDNs,
 		pushToNew,
 	}
-	log.Println("Associating device", applicationDN)
+	log.Println("Associating device", strings.Join(applicationDNs, ", "))
 	statusCode, status, body, err := c.request("POST", urlResourceCertificatesAssociate, req)
 	if err != nil {
 		return err
@@ -1955,7 +2030,7 @@ func parseDNToGUIDRequestResponse(httpStatusCode int, httpStatus string, body []
 		}
 		return reqData, nil
 	default:
-		return nil, fmt.Errorf("Unexpected status code on TPP DN to GUID request.\n Status:\n %s. \n Body:\n %s\n", httpStatus, body)
+		return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on TPP DN to GUID request.\n Status:\n %s. \n Body:\n %s\n", httpStatus, body))
 	}
 }
 
@@ -1973,7 +2048,7 @@ func parseCertificateMetaData(httpStatusCode int, httpStatus string, body []byte
 		}
 		return reqData, nil
 	default:
-		return nil, fmt.Errorf("Unexpected status code on TPP DN to GUID request.\n Status:\n %s. \n Body:\n %s\n", httpStatus, body)
+		return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on TPP DN to GUID request.\n Status:\n %s. \n Body:\n %s\n", httpStatus, body))
 	}
 }
 
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Venafi/vcert/v4/pkg/policy"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+const contactAttribute = "Contact"
+
+type configWriteRequest struct {
+	ObjectDN      string
+	AttributeData []nameValues
+}
+
+type nameValues struct {
+	Name  string
+	Value []string
+}
+
+type configResponse struct {
+	Result int
+	Error  string `json:",omitempty"`
+	Values []string
+}
+
+// configResultSuccess is the Result of a successful config call
+const configResultSuccess = 1
+
+// GetCertificateContacts returns the names of the contacts of the certificate with DN certificateID
+func (c *Connector) GetCertificateContacts(certificateID string) ([]string, error) {
+	resp, err := c.configCall(urlResourceConfigRead, ConfigReadDNRequest{
+		ObjectDN:      getPolicyDN(certificateID),
+		AttributeName: contactAttribute,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.identityNames(resp.Values)
+}
+
+// SetCertificateContacts replaces the contacts of the certificate with DN certificateID. The contacts are user or
+// group names, no contact clears them.
+func (c *Connector) SetCertificateContacts(certificateID string, contacts []string) error {
+	dn := getPolicyDN(certificateID)
+	if len(contacts) == 0 {
+		_, err := c.configCall(urlResourceConfigClearAttribute, ConfigReadDNRequest{ObjectDN: dn, AttributeName: contactAttribute})
+		return err
+	}
+	identities, err := c.resolveContacts(contacts)
+	if err != nil {
+		return fmt.Errorf("%w: failed to resolve the contacts: %s", verror.UserDataError, err)
+	}
+	_, err = c.configCall(urlResourceConfigWrite, configWriteRequest{
+		ObjectDN:      dn,
+		AttributeData: []nameValues{{Name: contactAttribute, Value: identities}},
+	})
+	return err
+}
+
+// GetZoneContacts returns the names of the contacts of the policy folder zone, i.e. the contacts of the
+// certificates created in it
+func (c *Connector) GetZoneContacts(zone string) ([]string, error) {
+	return c.retrieveUserNamesForPolicySpecification(getPolicyDN(zone))
+}
+
+// SetZoneContacts replaces the contacts of the policy folder zone, as the users of a policy specification do
+func (c *Connector) SetZoneContacts(zone string, contacts []string) error {
+	dn := getPolicyDN(zone)
+	if len(contacts) == 0 {
+		return resetTPPAttribute(c, policy.TppContact, dn)
+	}
+	name := dn
+	_, err := c.setContact(&policy.TppPolicy{Name: &name, Contact: contacts})
+	return err
+}
+
+func (c *Connector) configCall(url urlResource, req interface{}) (*configResponse, error) {
+	statusCode, status, body, err := c.request("POST", url, req)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, verror.NewStatusError(statusCode, fmt.Errorf("%w: unexpected status code on %s. Status: %s", verror.ServerError, url, status))
+	}
+	var resp configResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s response: %s", verror.ServerError, url, err)
+	}
+	if resp.Result != configResultSuccess {
+		if resp.Error == "" {
+			resp.Error = fmt.Sprintf("result %d", resp.Result)
+		}
+		return nil, fmt.Errorf("%w: %s failed: %s", verror.ServerError, url, resp.Error)
+	}
+	return &resp, nil
+}
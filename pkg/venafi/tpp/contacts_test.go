@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Venafi/vcert/v4/pkg/policy"
+)
+
+// newContactsServer emulates the config and identity resources of TPP, with a single certificate object
+func newContactsServer(t *testing.T, contacts *[]string) *httptest.Server {
+	identities := map[string]string{
+		"local:{alice}":    "alice",
+		"local:{web-team}": "Web Team",
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch strings.ToLower(strings.TrimPrefix(r.URL.Path, "/")) {
+		case string(urlResourceConfigRead):
+			if req["ObjectDN"] != "\\VED\\Policy\\Web\\www.example.com" || req["AttributeName"] != "Contact" {
+				t.Errorf("unexpected read request %v", req)
+			}
+			_ = json.NewEncoder(w).Encode(configResponse{Result: configResultSuccess, Values: *contacts})
+		case string(urlResourceConfigWrite):
+			var values []string
+			for _, v := range req["AttributeData"].([]interface{})[0].(map[string]interface{})["Value"].([]interface{}) {
+				values = append(values, v.(string))
+			}
+			*contacts = values
+			_ = json.NewEncoder(w).Encode(configResponse{Result: configResultSuccess})
+		case string(urlResourceConfigClearAttribute):
+			*contacts = nil
+			_ = json.NewEncoder(w).Encode(configResponse{Result: configResultSuccess})
+		case strings.ToLower(string(urlResourceValidateIdentity)):
+			universal := req["ID"].(map[string]interface{})["PrefixedUniversal"].(string)
+			_ = json.NewEncoder(w).Encode(policy.ValidateIdentityResponse{ID: policy.IdentityEntry{
+				Name: identities[universal], PrefixedUniversal: universal,
+			}})
+		case strings.ToLower(string(urlResourceBrowseIdentities)):
+			var resp policy.BrowseIdentitiesResponse
+			for universal, name := range identities {
+				if name == req["Filter"] {
+					resp.Identities = append(resp.Identities, policy.IdentityEntry{Name: name, PrefixedUniversal: universal})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCertificateContacts(t *testing.T) {
+	contacts := []string{"local:{alice}"}
+	server := newContactsServer(t, &contacts)
+	defer server.Close()
+	c := &Connector{baseURL: server.URL + "/", accessToken: "token", client: server.Client()}
+
+	names, err := c.GetCertificateContacts("Web\\www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"alice"}) {
+		t.Fatalf("expected alice, got %v", names)
+	}
+
+	err = c.SetCertificateContacts("\\VED\\Policy\\Web\\www.example.com", []string{"Web Team", "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(contacts, []string{"local:{web-team}", "local:{alice}"}) {
+		t.Fatalf("unexpected contacts %v", contacts)
+	}
+
+	err = c.SetCertificateContacts("Web\\www.example.com", []string{"bob"})
+	if err == nil || !strings.Contains(err.Error(), "bob") {
+		t.Fatalf("expected an error for an unknown contact, got %v", err)
+	}
+
+	err = c.SetCertificateContacts("Web\\www.example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contacts != nil {
+		t.Fatalf("expected the contacts to be cleared, got %v", contacts)
+	}
+}
+
+func TestConfigCallError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Result":400,"Error":"Object does not exist"}`))
+	}))
+	defer server.Close()
+	c := &Connector{baseURL: server.URL + "/", accessToken: "token", client: server.Client()}
+
+	_, err := c.GetCertificateContacts("Web\\missing.example.com")
+	if err == nil || !strings.Contains(err.Error(), "Object does not exist") {
+		t.Fatalf("expected the TPP error, got %v", err)
+	}
+}
@@ -19,6 +19,8 @@ package tpp
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/Venafi/vcert/v4/pkg/verror"
 )
 
 type responseError struct {
@@ -40,3 +42,7 @@ func NewResponseError(b []byte) error {
 func (e *responseError) Error() string {
 	return e.ErrorDetails
 }
+
+func (e *responseError) Code() string {
+	return verror.CodeServer
+}
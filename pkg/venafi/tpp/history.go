@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// certificateVersionDetails is the X.509 part of the details of a version of a certificate
+type certificateVersionDetails struct {
+	CN                         string
+	Issuer                     string
+	Serial                     string
+	Thumbprint                 string
+	ValidFrom                  time.Time
+	ValidTo                    time.Time
+	KeyAlgorithm               string
+	KeySize                    int
+	SubjectAltNameDNS          []string
+	SubjectAltNameIPAddress    []string
+	SubjectAltNameEmail        []string
+	SubjectAltNameURI          []string
+	SubjectAltNameOtherNameUPN []string
+}
+
+type previousVersionsResponse struct {
+	PreviousVersions []struct {
+		CertificateDetails certificateVersionDetails
+		VaultId            int
+	}
+}
+
+// RetrieveCertificateVersions returns the current version of the certificate with DN certificateID, then its
+// previous versions the latest first
+func (c *Connector) RetrieveCertificateVersions(certificateID string) ([]certificate.CertificateInfo, error) {
+	certDN := getPolicyDN(certificateID)
+	guid, err := c.configDNToGuid(certDN)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve certificate guid: %s", err)
+	}
+	if guid == "" {
+		return nil, fmt.Errorf("%w: certificate %s doesn't exist", verror.UserDataError, certDN)
+	}
+	details, err := c.searchCertificateDetails(guid)
+	if err != nil {
+		return nil, err
+	}
+	versions := []certificate.CertificateInfo{details.CertificateDetails.info(certDN)}
+
+	statusCode, status, body, err := c.request("GET", urlResourceCertificate+urlResource(guid+"/PreviousVersions"), nil)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, verror.NewStatusError(statusCode, fmt.Errorf("%w: unexpected status code on %s: %s", verror.ServerBadDataResponce, "PreviousVersions", status))
+	}
+	var resp previousVersionsResponse
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse previous versions: %s", verror.ServerBadDataResponce, err)
+	}
+	for _, v := range resp.PreviousVersions {
+		versions = append(versions, v.CertificateDetails.info(certDN))
+	}
+	// the versions are listed in no documented order
+	previous := versions[1:]
+	sort.SliceStable(previous, func(i, j int) bool { return previous[i].ValidFrom.After(previous[j].ValidFrom) })
+	return versions, nil
+}
+
+func (d certificateVersionDetails) info(dn string) certificate.CertificateInfo {
+	info := certificate.CertificateInfo{
+		ID:           dn,
+		CN:           d.CN,
+		Serial:       d.Serial,
+		Thumbprint:   d.Thumbprint,
+		ValidFrom:    d.ValidFrom,
+		ValidTo:      d.ValidTo,
+		Issuer:       d.Issuer,
+		KeyAlgorithm: d.KeyAlgorithm,
+		KeySize:      d.KeySize,
+	}
+	info.SANS.DNS = d.SubjectAltNameDNS
+	info.SANS.IP = d.SubjectAltNameIPAddress
+	info.SANS.Email = d.SubjectAltNameEmail
+	info.SANS.URI = d.SubjectAltNameURI
+	info.SANS.UPN = d.SubjectAltNameOtherNameUPN
+	return info
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tpp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRetrieveCertificateVersions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/"))
+		switch path {
+		case strings.ToLower(string(urlResourceConfigDnToGuid)):
+			_, _ = w.Write([]byte(`{"GUID":"{1234}","Result":1}`))
+		case string(urlResourceCertificate) + "{1234}":
+			_, _ = w.Write([]byte(`{"CertificateDetails":{"CN":"www.example.com","Thumbprint":"CCC","ValidFrom":"2023-03-01T00:00:00.0000000Z","ValidTo":"2023-06-01T00:00:00.0000000Z","SubjectAltNameDNS":["www.example.com"]}}`))
+		case string(urlResourceCertificate) + "{1234}/previousversions":
+			_, _ = w.Write([]byte(`{"PreviousVersions":[
+				{"CertificateDetails":{"CN":"www.example.com","Thumbprint":"AAA","ValidFrom":"2023-01-01T00:00:00Z","ValidTo":"2023-04-01T00:00:00Z"},"VaultId":1},
+				{"CertificateDetails":{"CN":"www.example.com","Thumbprint":"BBB","ValidFrom":"2023-02-01T00:00:00Z","ValidTo":"2023-05-01T00:00:00Z"},"VaultId":2}]}`))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	c := &Connector{baseURL: server.URL + "/", accessToken: "token", client: server.Client()}
+
+	versions, err := c.RetrieveCertificateVersions("Web\\www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var thumbprints []string
+	for _, v := range versions {
+		if v.ID != "\\VED\\Policy\\Web\\www.example.com" {
+			t.Errorf("unexpected ID %s", v.ID)
+		}
+		thumbprints = append(thumbprints, v.Thumbprint)
+	}
+	if got := strings.Join(thumbprints, " "); got != "CCC BBB AAA" {
+		t.Fatalf("expected the current version then the previous ones latest first, got %s", got)
+	}
+	if len(versions[0].SANS.DNS) != 1 || versions[0].ValidTo.IsZero() {
+		t.Fatalf("expected the details of the current version, got %+v", versions[0])
+	}
+}
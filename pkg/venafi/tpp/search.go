@@ -22,6 +22,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 	"net/http"
 	"strings"
 )
@@ -43,8 +44,9 @@ type CertificateDetailsResponse struct {
 		Name  string
 		Value []string
 	}
-	Consumers []string
-	Disabled  bool `json:",omitempty"`
+	Consumers          []string
+	Disabled           bool `json:",omitempty"`
+	CertificateDetails certificateVersionDetails
 }
 
 type CertificateSearchResponse struct {
@@ -84,7 +86,7 @@ func (c *Connector) configReadDN(req ConfigReadDNRequest) (resp ConfigReadDNResp
 			return resp, err
 		}
 	} else {
-		return resp, fmt.Errorf("unexpected status code on %s. Status: %s", urlResourceConfigReadDn, status)
+		return resp, verror.NewStatusError(statusCode, fmt.Errorf("unexpected status code on %s. Status: %s", urlResourceConfigReadDn, status))
 	}
 
 	return resp, nil
@@ -112,9 +114,9 @@ func parseCertificateDetailsResponse(statusCode int, body []byte) (searchResult
 		return searchResult, nil
 	default:
 		if body != nil {
-			return nil, NewResponseError(body)
+			return nil, verror.NewStatusError(statusCode, NewResponseError(body))
 		} else {
-			return nil, fmt.Errorf("Unexpected status code on certificate search. Status: %d", statusCode)
+			return nil, verror.NewStatusError(statusCode, fmt.Errorf("Unexpected status code on certificate search. Status: %d", statusCode))
 		}
 	}
 }
@@ -130,9 +132,9 @@ func ParseCertificateSearchResponse(httpStatusCode int, body []byte) (searchResu
 		return searchResult, nil
 	default:
 		if body != nil {
-			return nil, NewResponseError(body)
+			return nil, verror.NewStatusError(httpStatusCode, NewResponseError(body))
 		} else {
-			return nil, fmt.Errorf("Unexpected status code on certificate search. Status: %d", httpStatusCode)
+			return nil, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on certificate search. Status: %d", httpStatusCode))
 		}
 	}
 }
@@ -17,6 +17,7 @@
 package tpp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -28,6 +29,7 @@ import (
 	"github.com/Venafi/vcert/v4/pkg/certificate"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
 	"github.com/Venafi/vcert/v4/pkg/util"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 )
 
 const (
@@ -44,9 +46,10 @@ func RequestSshCertificate(c *Connector, req *certificate.SshCertRequest) (*cert
 		log.Println("Requesting SSH certificate with certificate identifier: ", sshCertReq.KeyId)
 	}
 
-	//TODO: Maybe, there is a better way to set the timeout.
-	c.client.Timeout = time.Duration(req.Timeout) * time.Second
-	statusCode, status, body, err := c.request("POST", urlResourceSshCertReq, sshCertReq)
+	// the timeout is set on a copy of the client, which shares its connections, the connector may be in use by other calls
+	client := *c.getHTTPClient()
+	client.Timeout = time.Duration(req.Timeout) * time.Second
+	statusCode, status, body, err := c.requestClient(context.Background(), &client, "POST", urlResourceSshCertReq, sshCertReq)
 	if err != nil {
 		return nil, err
 	}
@@ -227,7 +230,7 @@ func parseSshCertOperationResponse(httpStatusCode int, httpStatus string, body [
 		err := NewAuthenticationError(body)
 		return retrieveResponse, err
 	default:
-		return retrieveResponse, fmt.Errorf("unexpected status code. Status: %s", httpStatus)
+		return retrieveResponse, verror.NewStatusError(httpStatusCode, fmt.Errorf("unexpected status code. Status: %s", httpStatus))
 	}
 }
 
@@ -373,7 +376,7 @@ func parseSshCaDetailsRequestResult(httpStatusCode int, httpStatus string, body
 		if err != nil {
 			return nil, err
 		}
-		return data, fmt.Errorf("unexpected status code on TPP CA details Request. Status code: %s, %s", httpStatus, data.Response.ErrorMessage)
+		return data, verror.NewStatusError(httpStatusCode, fmt.Errorf("unexpected status code on TPP CA details Request. Status code: %s, %s", httpStatus, data.Response.ErrorMessage))
 
 	}
 }
@@ -18,6 +18,7 @@ package tpp
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -35,6 +36,7 @@ import (
 
 	"github.com/Venafi/vcert/v4/pkg/certificate"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 )
 
 const defaultKeySize = 2048
@@ -54,6 +56,7 @@ type application struct {
 	DriverName     string
 	ValidationHost string `json:",omitempty"`
 	ValidationPort string `json:",omitempty"`
+	Description    string `json:",omitempty"`
 }
 
 type device struct {
@@ -96,6 +99,8 @@ type certificateRetrieveRequest struct {
 	IncludeChain      bool   `json:",omitempty"`
 	FriendlyName      string `json:",omitempty"`
 	RootFirstOrder    bool   `json:",omitempty"`
+	// WorkToDoTimeout is how many seconds TPP holds the request while the certificate is processed
+	WorkToDoTimeout int `json:",omitempty"`
 }
 
 type certificateRetrieveResponse struct {
@@ -337,6 +342,7 @@ const (
 	urlResourceCertificateRequest     urlResource = "vedsdk/certificates/request"
 	urlResourceCertificateRetrieve    urlResource = "vedsdk/certificates/retrieve"
 	urlResourceCertificateRevoke      urlResource = "vedsdk/certificates/revoke"
+	urlResourceCertificateReset       urlResource = "vedsdk/certificates/reset"
 	urlResourceCertificatesAssociate  urlResource = "vedsdk/certificates/associate"
 	urlResourceCertificatesDissociate urlResource = "vedsdk/certificates/dissociate"
 	urlResourceCertificate            urlResource = "vedsdk/certificates/"
@@ -344,6 +350,9 @@ const (
 	urlResourceCertificatesList                   = urlResourceCertificate
 	urlResourceConfigDnToGuid         urlResource = "vedsdk/config/dntoguid"
 	urlResourceConfigReadDn           urlResource = "vedsdk/config/readdn"
+	urlResourceConfigRead             urlResource = "vedsdk/config/read"
+	urlResourceConfigWrite            urlResource = "vedsdk/config/write"
+	urlResourceConfigClearAttribute   urlResource = "vedsdk/config/clearattribute"
 	urlResourceFindPolicy             urlResource = "vedsdk/config/findpolicy"
 	urlResourceMetadataSet            urlResource = "vedsdk/metadata/set"
 	urlResourceAllMetadataGet         urlResource = "vedsdk/metadata/getitems"
@@ -414,6 +423,15 @@ func retrieveChainOptionFromString(order string) retrieveChainOption {
 }
 
 func (c *Connector) request(method string, resource urlResource, data interface{}) (statusCode int, statusText string, body []byte, err error) {
+	return c.requestContext(context.Background(), method, resource, data)
+}
+
+func (c *Connector) requestContext(ctx context.Context, method string, resource urlResource, data interface{}) (statusCode int, statusText string, body []byte, err error) {
+	return c.requestClient(ctx, c.getHTTPClient(), method, resource, data)
+}
+
+// requestClient sends the request with client, a copy of the pooled client when a call needs other settings
+func (c *Connector) requestClient(ctx context.Context, client *http.Client, method string, resource urlResource, data interface{}) (statusCode int, statusText string, body []byte, err error) {
 	url := c.baseURL + string(resource)
 	var payload io.Reader
 	var b []byte
@@ -422,8 +440,7 @@ func (c *Connector) request(method string, resource urlResource, data interface{
 		payload = bytes.NewReader(b)
 	}
 
-	r, _ := http.NewRequest(method, url, payload)
-	r.Close = true
+	r, _ := http.NewRequestWithContext(ctx, method, url, payload)
 	if c.accessToken != "" {
 		r.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
 	} else if c.apiKey != "" {
@@ -432,7 +449,7 @@ func (c *Connector) request(method string, resource urlResource, data interface{
 	r.Header.Add("content-type", "application/json")
 	r.Header.Add("cache-control", "no-cache")
 
-	res, err := c.getHTTPClient().Do(r)
+	res, err := client.Do(r)
 	if res != nil {
 		statusCode = res.StatusCode
 		statusText = res.Status
@@ -461,7 +478,12 @@ func (c *Connector) request(method string, resource urlResource, data interface{
 	return
 }
 
+// maxIdleConnsPerHost keeps enough connections to the server open for concurrent enrollments to reuse them
+const maxIdleConnsPerHost = 100
+
 func (c *Connector) getHTTPClient() *http.Client {
+	c.clientMu.Lock()
+	defer c.clientMu.Unlock()
 	if c.client != nil {
 		return c.client
 	}
@@ -473,6 +495,7 @@ func (c *Connector) getHTTPClient() *http.Client {
 			DualStack: true,
 		}).DialContext,
 		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
@@ -497,6 +520,10 @@ func (c *Connector) getHTTPClient() *http.Client {
 
 // GenerateRequest creates a new certificate request, based on the zone/policy configuration and the user data
 func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *certificate.Request) (err error) {
+	err = req.NormalizeIDN()
+	if err != nil {
+		return err
+	}
 	if config == nil {
 		config, err = c.ReadZoneConfiguration()
 		if err != nil {
@@ -510,6 +537,10 @@ func (c *Connector) GenerateRequest(config *endpoint.ZoneConfiguration, req *cer
 	}
 
 	config.UpdateCertificateRequest(req)
+	err = config.ValidateDNSNames(req.DNSNames)
+	if err != nil {
+		return err
+	}
 
 	switch req.CsrOrigin {
 	case certificate.LocalGeneratedCSR:
@@ -580,7 +611,7 @@ func parseConfigResult(httpStatusCode int, httpStatus string, body []byte) (tppD
 		}
 		return tppData, nil
 	default:
-		return tppData, fmt.Errorf("Unexpected status code on TPP Config Operation. Status: %s", httpStatus)
+		return tppData, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on TPP Config Operation. Status: %s", httpStatus))
 	}
 }
 
@@ -598,7 +629,7 @@ func parseRequestResult(httpStatusCode int, httpStatus string, body []byte) (str
 		}
 		return reqData.CertificateDN, nil
 	default:
-		return "", fmt.Errorf("Unexpected status code on TPP Certificate Request.\n Status:\n %s. \n Body:\n %s\n", httpStatus, body)
+		return "", verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on TPP Certificate Request.\n Status:\n %s. \n Body:\n %s\n", httpStatus, body))
 	}
 }
 
@@ -617,7 +648,7 @@ func parseRetrieveResult(httpStatusCode int, httpStatus string, body []byte) (ce
 		}
 		return retrieveResponse, nil
 	default:
-		return retrieveResponse, fmt.Errorf("Unexpected status code on TPP Certificate Retrieval. Status: %s", httpStatus)
+		return retrieveResponse, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on TPP Certificate Retrieval. Status: %s", httpStatus))
 	}
 }
 
@@ -636,7 +667,7 @@ func parseRevokeResult(httpStatusCode int, httpStatus string, body []byte) (cert
 		}
 		return revokeResponse, nil
 	default:
-		return revokeResponse, fmt.Errorf("Unexpected status code on TPP Certificate Revocation. Status: %s", httpStatus)
+		return revokeResponse, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on TPP Certificate Revocation. Status: %s", httpStatus))
 	}
 }
 
@@ -680,7 +711,7 @@ func parseBrowseIdentitiesResult(httpStatusCode int, httpStatus string, body []b
 		}
 		return browseIdentitiesResponse, nil
 	default:
-		return browseIdentitiesResponse, fmt.Errorf("Unexpected status code on TPP Browse Identities. Status: %s", httpStatus)
+		return browseIdentitiesResponse, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on TPP Browse Identities. Status: %s", httpStatus))
 	}
 }
 
@@ -699,7 +730,7 @@ func parseValidateIdentityResponse(httpStatusCode int, httpStatus string, body [
 		}
 		return validateIdentityResponse, nil
 	default:
-		return validateIdentityResponse, fmt.Errorf("Unexpected status code on TPP Validate Identity. Status: %s", httpStatus)
+		return validateIdentityResponse, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status code on TPP Validate Identity. Status: %s", httpStatus))
 	}
 }
 
@@ -718,7 +749,7 @@ func parseFindObjectsOfClassResponse(httpStatusCode int, httpStatus string, body
 		}
 		return response, nil
 	default:
-		return response, fmt.Errorf("Unexpected status from FindObjectsOfClass. Status: %s", httpStatus)
+		return response, verror.NewStatusError(httpStatusCode, fmt.Errorf("Unexpected status from FindObjectsOfClass. Status: %s", httpStatus))
 	}
 }
 
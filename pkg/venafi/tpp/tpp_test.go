@@ -18,11 +18,17 @@ package tpp
 
 import (
 	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"github.com/Venafi/vcert/v4/pkg/certificate"
 	"github.com/Venafi/vcert/v4/pkg/endpoint"
+	"github.com/Venafi/vcert/v4/pkg/verror"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const (
@@ -410,3 +416,96 @@ func TestConvertServerPolicyToInternalPolicy(t *testing.T) {
 	}
 
 }
+
+func TestPrepareRequestLocation(t *testing.T) {
+	req := certificate.Request{
+		CsrOrigin: certificate.ServiceGeneratedCSR,
+		Location: &certificate.Location{
+			Instance:    "web01",
+			Workload:    "nginx",
+			TLSAddress:  "web01.example.com:443",
+			IPAddress:   "10.20.30.40",
+			InstallPath: "/etc/nginx/tls/www.pem",
+		},
+	}
+	req.Subject.CommonName = "www.example.com"
+	tppReq, err := prepareRequest(&req, "Web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tppReq.Devices) != 1 {
+		t.Fatalf("expected 1 device, got %d", len(tppReq.Devices))
+	}
+	dev := tppReq.Devices[0]
+	if dev.ObjectName != "web01" || dev.Host != "10.20.30.40" || dev.PolicyDN != "\\VED\\Policy\\Web" {
+		t.Fatalf("unexpected device %+v", dev)
+	}
+	app := dev.Applications[0]
+	if app.ObjectName != "nginx" || app.ValidationHost != "web01.example.com" || app.ValidationPort != "443" ||
+		app.Description != "/etc/nginx/tls/www.pem" {
+		t.Fatalf("unexpected application %+v", app)
+	}
+
+	req.Location.IPAddress = "web01"
+	_, err = prepareRequest(&req, "Web")
+	if err == nil {
+		t.Fatal("expected an error for an invalid IP address")
+	}
+}
+
+func TestWorkToDoTimeout(t *testing.T) {
+	cases := map[time.Duration]int{
+		-time.Second:            0,
+		500 * time.Millisecond:  0,
+		1500 * time.Millisecond: 1,
+		10 * time.Second:        10,
+		time.Hour:               int(maxWorkToDoTimeout / time.Second),
+	}
+	for remaining, expected := range cases {
+		if actual := workToDoTimeout(remaining); actual != expected {
+			t.Errorf("%s: expected %d, got %d", remaining, expected, actual)
+		}
+	}
+}
+
+func TestRetrieveCertificateLongPoll(t *testing.T) {
+	var mu sync.Mutex
+	var timeouts []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req certificateRetrieveRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		timeouts = append(timeouts, req.WorkToDoTimeout)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"Stage":500,"Status":"Pending approval"}`))
+	}))
+	defer server.Close()
+	c := &Connector{baseURL: server.URL + "/", accessToken: "token", client: server.Client()}
+
+	_, err := c.RetrieveCertificate(&certificate.Request{PickupID: "\\VED\\Policy\\Web\\www.example.com", Timeout: 1500 * time.Millisecond})
+	if _, ok := err.(endpoint.ErrRetrieveCertificateTimeout); !ok {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(timeouts) == 0 || timeouts[0] != 1 {
+		t.Fatalf("expected the first retrieval to be long-polled for 1 second, got %v", timeouts)
+	}
+}
+
+func TestParseResultServerErrors(t *testing.T) {
+	for _, statusCode := range []int{http.StatusBadRequest, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		_, requestErr := parseRequestResult(statusCode, http.StatusText(statusCode), []byte("{}"))
+		_, retrieveErr := parseRetrieveResult(statusCode, http.StatusText(statusCode), []byte("{}"))
+		for _, err := range []error{requestErr, retrieveErr} {
+			var statusErr verror.StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != statusCode {
+				t.Errorf("expected an error with status %d, got %v", statusCode, err)
+			}
+			if serverError := statusCode >= 500; errors.Is(err, verror.ServerError) != serverError {
+				t.Errorf("status %d: expected server error %v, got %v", statusCode, serverError, err)
+			}
+		}
+	}
+}
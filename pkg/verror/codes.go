@@ -0,0 +1,88 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package verror
+
+import "errors"
+
+// The stable codes of the errors, for support tooling and alert routing to key off instead of the English messages,
+// which may change. A code is never reused for another condition.
+const (
+	CodeUnknown                    = "VCERT-GEN-000"
+	CodeVcert                      = "VCERT-GEN-001"
+	CodeServer                     = "VCERT-SRV-001"
+	CodeServerUnavailable          = "VCERT-SRV-002"
+	CodeServerTemporaryUnavailable = "VCERT-SRV-003"
+	CodeServerBadData              = "VCERT-SRV-004"
+	CodeRateLimited                = "VCERT-SRV-005"
+	CodeCircuitOpen                = "VCERT-SRV-006"
+	CodeUserData                   = "VCERT-USR-001"
+	CodeZoneNotFound               = "VCERT-USR-002"
+	CodeApplicationNotFound        = "VCERT-USR-003"
+	CodeUnexpectedAddress          = "VCERT-USR-004"
+	CodeCAAForbidden               = "VCERT-USR-005"
+	CodeAuth                       = "VCERT-AUTH-001"
+	CodePolicyValidation           = "VCERT-POLICY-001"
+	CodePolicyViolation            = "VCERT-POLICY-002"
+	CodeCertificateCheck           = "VCERT-CERT-001"
+	CodeCertificatePending         = "VCERT-CERT-002"
+	CodeRetrieveTimeout            = "VCERT-CERT-003"
+	CodeCertificateRejected        = "VCERT-CERT-004"
+	CodeDuplicateCertificate       = "VCERT-CERT-005"
+	CodeNotServed                  = "VCERT-INST-001"
+	CodeLocked                     = "VCERT-LOCK-001"
+)
+
+// Coder is implemented by the typed errors, their code is more specific than the one of the error they wrap
+type Coder interface {
+	Code() string
+}
+
+// sentinelCodes are the codes of the errors of this package, the most specific first since they wrap each other
+var sentinelCodes = []struct {
+	err  error
+	code string
+}{
+	{CertificateCheckError, CodeCertificateCheck},
+	{AuthError, CodeAuth},
+	{ZoneNotFoundError, CodeZoneNotFound},
+	{ApplicationNotFoundError, CodeApplicationNotFound},
+	{UserDataError, CodeUserData},
+	{PolicyValidationError, CodePolicyValidation},
+	{ServerTemporaryUnavailableError, CodeServerTemporaryUnavailable},
+	{ServerUnavailableError, CodeServerUnavailable},
+	{ServerBadDataResponce, CodeServerBadData},
+	{ServerError, CodeServer},
+	{VcertError, CodeVcert},
+}
+
+// CodeOf returns the code of err: the one of the first error of its chain implementing Coder, or else the one of
+// the error of this package it wraps. It's CodeUnknown for the other errors, and empty for nil.
+func CodeOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.Code()
+	}
+	for _, s := range sentinelCodes {
+		if errors.Is(err, s.err) {
+			return s.code
+		}
+	}
+	return CodeUnknown
+}
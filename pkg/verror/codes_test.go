@@ -0,0 +1,53 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package verror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type codedError struct{}
+
+func (codedError) Error() string { return "coded" }
+func (codedError) Code() string  { return "VCERT-TEST-001" }
+func (codedError) Unwrap() error { return UserDataError }
+
+func TestCodeOf(t *testing.T) {
+	cases := []struct {
+		err  error
+		code string
+	}{
+		{nil, ""},
+		{errors.New("unknown"), CodeUnknown},
+		{fmt.Errorf("%w: bad zone", UserDataError), CodeUserData},
+		{fmt.Errorf("%w: expired token", AuthError), CodeAuth},
+		{fmt.Errorf("%w: chain", CertificateCheckError), CodeCertificateCheck},
+		{fmt.Errorf("%w: 503", ServerTemporaryUnavailableError), CodeServerTemporaryUnavailable},
+		{fmt.Errorf("%w: 500", ServerError), CodeServer},
+		{fmt.Errorf("%w: key usage", PolicyValidationError), CodePolicyValidation},
+		{fmt.Errorf("enroll: %w", codedError{}), "VCERT-TEST-001"},
+		{NewStatusError(502, errors.New("bad gateway")), CodeServer},
+		{NewStatusError(404, errors.New("not found")), CodeUnknown},
+	}
+	for _, c := range cases {
+		if code := CodeOf(c.err); code != c.code {
+			t.Errorf("%v: expected code %q, got %q", c.err, c.code, code)
+		}
+	}
+}
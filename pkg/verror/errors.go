@@ -1,6 +1,9 @@
 package verror
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+)
 
 var (
 	VcertError                      = fmt.Errorf("vcert error")
@@ -15,3 +18,28 @@ var (
 	ZoneNotFoundError               = fmt.Errorf("%w: zone not found", UserDataError)
 	ApplicationNotFoundError        = fmt.Errorf("%w: application not found", UserDataError)
 )
+
+// StatusError is an error response of the platform. Its HTTP status tells whether the server failed (5xx) or
+// rejected the request.
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+// NewStatusError returns err as the error of a response with statusCode
+func NewStatusError(statusCode int, err error) error {
+	return StatusError{StatusCode: statusCode, Err: err}
+}
+
+func (err StatusError) Error() string {
+	return err.Err.Error()
+}
+
+func (err StatusError) Unwrap() error {
+	return err.Err
+}
+
+// Is makes the error of a 5xx status a ServerError, whichever error it wraps
+func (err StatusError) Is(target error) bool {
+	return err.StatusCode >= http.StatusInternalServerError && (target == ServerError || target == VcertError)
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package webhook receives the notifications of the platform, e.g. expiry warnings or completed approvals, and
+// turns them into local actions such as running the certificate task of a playbook.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Venafi/vcert/v4/pkg/hmacauth"
+	"github.com/Venafi/vcert/v4/pkg/rbac"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+// SignatureHeader is the header carrying the HMAC-SHA256 of the notification body keyed with the shared secret, in
+// the "sha256=<hex>" format
+const SignatureHeader = "X-Venafi-Signature"
+
+const (
+	signaturePrefix  = "sha256="
+	maxBodySize      = 1 << 20
+	defaultQueueSize = 100
+)
+
+// Notification events
+const (
+	// EventExpiring warns that a certificate is about to expire
+	EventExpiring = "certificate.expiring"
+	// EventApproved tells that a pending request was approved, its certificate can be picked up
+	EventApproved = "request.approved"
+	// EventIssued tells that a certificate was issued
+	EventIssued = "certificate.issued"
+)
+
+// Notification is the body of a notification. Task names the certificate task of a playbook the notification is
+// for, otherwise it's found from the pickup ID or the common name.
+type Notification struct {
+	Event         string `json:"event"`
+	Task          string `json:"task,omitempty"`
+	CertificateID string `json:"certificateId,omitempty"`
+	PickupID      string `json:"pickupId,omitempty"`
+	CommonName    string `json:"commonName,omitempty"`
+	// ClientIdentities are the names of the verified TLS client certificate the notification was sent with, see
+	// rbac.Identities. They're empty without mutual TLS.
+	ClientIdentities []string `json:"-"`
+}
+
+func (n Notification) String() string {
+	for _, id := range []string{n.Task, n.PickupID, n.CertificateID, n.CommonName} {
+		if id != "" {
+			return n.Event + " " + id
+		}
+	}
+	return n.Event
+}
+
+// ErrIgnored is returned by an action for the notifications it has nothing to do for
+var ErrIgnored = errors.New("notification ignored")
+
+// Sign returns the value of SignatureHeader for body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of body, in constant time
+func Verify(secret, body []byte, signature string) error {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return fmt.Errorf("%w: missing or unsupported signature", verror.AuthError)
+	}
+	if !hmac.Equal([]byte(Sign(secret, body)), []byte(signature)) {
+		return fmt.Errorf("%w: bad signature", verror.AuthError)
+	}
+	return nil
+}
+
+// Listener is an http.Handler accepting the signed notifications. They are queued and their actions are run one at a
+// time by Run, so a slow renewal doesn't make the platform time out and send the notification again.
+type Listener struct {
+	// Secret is the key of the signatures, all the notifications are rejected without it
+	Secret []byte
+	// Verifier, when it's set, authenticates the notifications with the timestamp and nonce signed in the headers of
+	// package hmacauth rather than with SignatureHeader, so a captured notification can't be replayed. Secret isn't
+	// used then.
+	Verifier *hmacauth.Verifier
+	// Action is run for every notification, its errors are logged
+	Action func(ctx context.Context, n Notification) error
+	// QueueSize bounds the notifications waiting for their action, the next ones are refused with 503 Service
+	// Unavailable so the platform sends them again later. It defaults to 100.
+	QueueSize int
+	// Log receives progress messages when it's set
+	Log func(format string, args ...interface{})
+
+	once  sync.Once
+	queue chan Notification
+}
+
+func (l *Listener) init() {
+	l.once.Do(func() {
+		size := l.QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		l.queue = make(chan Notification, size)
+	})
+}
+
+// ServeHTTP verifies and queues a notification, it answers 202 Accepted once the notification is queued
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	switch {
+	case l.Verifier != nil:
+		err = l.Verifier.Verify(r, body)
+	case len(l.Secret) == 0:
+		err = fmt.Errorf("%w: no secret to verify signatures", verror.AuthError)
+	default:
+		err = Verify(l.Secret, body, r.Header.Get(SignatureHeader))
+	}
+	if errors.Is(err, verror.ServerTemporaryUnavailableError) {
+		l.logf("refused notification from %s: %s", r.RemoteAddr, err)
+		http.Error(w, "too many notifications", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		l.logf("rejected notification from %s: %s", r.RemoteAddr, err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	var n Notification
+	err = json.Unmarshal(body, &n)
+	if err != nil || n.Event == "" {
+		http.Error(w, "invalid notification", http.StatusBadRequest)
+		return
+	}
+	n.ClientIdentities = rbac.RequestIdentities(r)
+	l.init()
+	select {
+	case l.queue <- n:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		l.logf("notification queue is full, refused %s", n)
+		http.Error(w, "too many notifications", http.StatusServiceUnavailable)
+	}
+}
+
+// Health serves the status of the listener the way the gRPC health checking protocol reports it: {"status":"SERVING"}
+// while notifications are accepted, {"status":"NOT_SERVING"} with 503 Service Unavailable while the queue is full.
+func (l *Listener) Health() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.init()
+		status, code := "SERVING", http.StatusOK
+		if len(l.queue) == cap(l.queue) {
+			status, code = "NOT_SERVING", http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_, _ = fmt.Fprintf(w, "{\"status\":%q}\n", status)
+	})
+}
+
+// Run runs the actions of the queued notifications until ctx is cancelled
+func (l *Listener) Run(ctx context.Context) {
+	l.init()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-l.queue:
+			err := l.Action(ctx, n)
+			switch {
+			case errors.Is(err, ErrIgnored):
+				l.logf("ignored notification %s", n)
+			case err != nil:
+				l.logf("notification %s failed: %s", n, err)
+			default:
+				l.logf("notification %s handled", n)
+			}
+		}
+	}
+}
+
+func (l *Listener) logf(format string, args ...interface{}) {
+	if l.Log != nil {
+		l.Log(format, args...)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2022 Venafi, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Venafi/vcert/v4/pkg/hmacauth"
+	"github.com/Venafi/vcert/v4/pkg/verror"
+)
+
+func post(l *Listener, body, signature string) int {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, req)
+	return w.Code
+}
+
+func health(l *Listener) (int, string) {
+	w := httptest.NewRecorder()
+	l.Health().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	return w.Code, w.Body.String()
+}
+
+func TestVerify(t *testing.T) {
+	secret, body := []byte("secret"), []byte(`{"event":"certificate.expiring"}`)
+	if err := Verify(secret, body, Sign(secret, body)); err != nil {
+		t.Fatal(err)
+	}
+	for _, signature := range []string{"", Sign([]byte("other"), body), "sha1=00"} {
+		if err := Verify(secret, body, signature); !errors.Is(err, verror.AuthError) {
+			t.Errorf("expected signature %q to be rejected, got %v", signature, err)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	secret := []byte("secret")
+	handled := make(chan Notification, 1)
+	l := &Listener{
+		Secret:    secret,
+		QueueSize: 1,
+		Action: func(ctx context.Context, n Notification) error {
+			handled <- n
+			return nil
+		},
+	}
+
+	if code, status := health(l); code != http.StatusOK || status != `{"status":"SERVING"}`+"\n" {
+		t.Errorf("expected the listener to be serving, got %d %s", code, status)
+	}
+	body := `{"event":"request.approved","pickupId":"\\VED\\Policy\\www"}`
+	if code := post(l, body, ""); code != http.StatusUnauthorized {
+		t.Errorf("expected an unsigned notification to be refused, got %d", code)
+	}
+	if code := post(l, `{}`, Sign(secret, []byte(`{}`))); code != http.StatusBadRequest {
+		t.Errorf("expected a notification without event to be refused, got %d", code)
+	}
+	if code := post(l, body, Sign(secret, []byte(body))); code != http.StatusAccepted {
+		t.Fatalf("expected the notification to be accepted, got %d", code)
+	}
+	if code := post(l, body, Sign(secret, []byte(body))); code != http.StatusServiceUnavailable {
+		t.Errorf("expected the notification to be refused by the full queue, got %d", code)
+	}
+	if code, status := health(l); code != http.StatusServiceUnavailable || status != `{"status":"NOT_SERVING"}`+"\n" {
+		t.Errorf("expected the listener with a full queue not to be serving, got %d %s", code, status)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET to be refused, got %d", w.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.Run(ctx)
+	select {
+	case n := <-handled:
+		if n.Event != EventApproved || n.PickupID != `\VED\Policy\www` {
+			t.Errorf("unexpected notification %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification wasn't handled")
+	}
+}
+
+func TestListenerWithoutSecret(t *testing.T) {
+	l := &Listener{}
+	body := `{"event":"certificate.expiring"}`
+	if code := post(l, body, Sign(nil, []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("expected notifications to be refused without a secret, got %d", code)
+	}
+}
+
+func TestListenerReplayProtection(t *testing.T) {
+	secret := []byte("secret")
+	l := &Listener{Verifier: &hmacauth.Verifier{Secret: secret}}
+	body := `{"event":"certificate.issued","task":"web"}`
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	if err := hmacauth.Sign(req, []byte(body), secret); err != nil {
+		t.Fatal(err)
+	}
+	replay := req.Clone(req.Context())
+	replay.Body = ioutil.NopCloser(bytes.NewBufferString(body))
+
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected the notification to be accepted, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	l.ServeHTTP(w, replay)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the replayed notification to be refused, got %d", w.Code)
+	}
+	if code := post(l, body, Sign(secret, []byte(body))); code != http.StatusUnauthorized {
+		t.Errorf("expected a notification without timestamp and nonce to be refused, got %d", code)
+	}
+}